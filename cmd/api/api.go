@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
@@ -18,17 +19,19 @@ import (
 	"github.com/go-chi/render"
 
 	"viz/api/routes"
+	"viz/internal/analytics"
 	"viz/internal/auth"
 	"viz/internal/config"
-	"viz/internal/db"
+	"viz/internal/downloads"
 	"viz/internal/entities"
+	"viz/internal/federation"
 	libhttp "viz/internal/http"
 	"viz/internal/imageops"
-	libvips "viz/internal/imageops/vips"
 	"viz/internal/images"
 	"viz/internal/jobs"
 	"viz/internal/jobs/workers"
 	imalog "viz/internal/logger"
+	"viz/internal/mail"
 	"viz/internal/settings"
 	"viz/internal/utils"
 )
@@ -36,6 +39,13 @@ import (
 var (
 	ServerConfig       = config.VizServers["api"]
 	StorageStatsHolder *images.StorageStatsHolder
+	Mailer             mail.Mailer
+	RateLimiter        *libhttp.Limiter
+	// Federation is this server as its peers see it, or nil if federation
+	// isn't enabled.
+	Federation *federation.Instance
+	// Analytics records views and downloads, or is nil if analytics are off.
+	Analytics *analytics.Recorder
 )
 
 type APIServer struct {
@@ -92,10 +102,17 @@ func (server APIServer) Launch(router *chi.Mux) *http.Server {
 	// API Routes
 	router.Route("/api", func(r chi.Router) {
 		// Public routes (no auth required)
-		r.Mount("/auth", routes.AuthRouter(dbClient, logger))
-		r.Mount("/accounts", routes.AccountsRouter(dbClient, logger)) // auth middleware added internally
+		r.Mount("/auth", routes.AuthRouter(dbClient, logger, Mailer, RateLimiter))
+		r.Mount("/accounts", routes.AccountsRouter(dbClient, logger, Mailer)) // auth middleware added internally
 		r.Mount("/system", routes.SystemRouter(dbClient, logger))
-		r.Mount("/setup", routes.SetupRouter(dbClient, logger)) // superadmin setup
+		r.Mount("/setup", routes.SetupRouter(dbClient, logger))              // superadmin setup
+		r.Mount("/oauth", routes.OAuthRouter(dbClient, logger, RateLimiter)) // consent routes add auth internally
+		r.Mount("/public/shares", routes.PublicSharesRouter(dbClient, logger, RateLimiter, server.WSBroker, Analytics))
+		r.Mount("/public/uploads", routes.UploadLinksRouter(dbClient, logger, RateLimiter))
+		r.Mount("/oembed", routes.OEmbedRouter(dbClient, logger))
+		if Federation != nil {
+			r.Mount("/federation", routes.FederationRouter(dbClient, logger, Federation)) // user routes add auth internally
+		}
 		r.Get("/ping", func(res http.ResponseWriter, req *http.Request) {
 			jsonResponse := map[string]any{"message": "pong"}
 			render.JSON(res, req, jsonResponse)
@@ -115,7 +132,7 @@ func (server APIServer) Launch(router *chi.Mux) *http.Server {
 					auth.CollectionsReadScope,
 					auth.CollectionsUpdateScope,
 				}))
-				r.Mount("/collections", routes.CollectionsRouter(dbClient, logger))
+				r.Mount("/collections", routes.CollectionsRouter(dbClient, logger, Analytics))
 			})
 			r.Group(func(r chi.Router) {
 				r.Use(libhttp.ScopeMiddleware([]auth.Scope{
@@ -125,7 +142,7 @@ func (server APIServer) Launch(router *chi.Mux) *http.Server {
 					auth.ImagesUpdateScope,
 					auth.ImagesUploadScope,
 				}))
-				r.Mount("/images", routes.ImagesRouter(dbClient, logger))
+				r.Mount("/images", routes.ImagesRouter(dbClient, logger, RateLimiter, Analytics))
 			})
 			r.Group(func(r chi.Router) {
 				r.Use(libhttp.ScopeMiddleware([]auth.Scope{
@@ -133,12 +150,13 @@ func (server APIServer) Launch(router *chi.Mux) *http.Server {
 					auth.CollectionsReadScope,
 				}))
 				r.Mount("/search", routes.SearchRouter(dbClient, logger))
+				r.Mount("/analytics", routes.AnalyticsRouter(dbClient, logger))
 			})
 			r.Group(func(r chi.Router) {
 				r.Use(libhttp.ScopeMiddleware([]auth.Scope{
 					auth.DownloadsCreateScope,
 				}))
-				r.Mount("/download", routes.DownloadRouter(dbClient, logger))
+				r.Mount("/download", routes.DownloadRouter(dbClient, logger, RateLimiter, Analytics))
 			})
 			r.Group(func(r chi.Router) {
 				r.Use(libhttp.ScopeMiddleware([]auth.Scope{
@@ -160,6 +178,10 @@ func (server APIServer) Launch(router *chi.Mux) *http.Server {
 		r.Mount("/jobs", routes.JobsRouter(dbClient, logger))
 	})
 
+	if Federation != nil {
+		router.Get(federation.WellKnownPath, Federation.ServeDiscovery)
+	}
+
 	// Serve Frontend (SPA + Static Files)
 	frontendPath := os.Getenv("VIZ_FRONTEND_BUILD_PATH")
 	if frontendPath == "" {
@@ -242,32 +264,26 @@ func main() {
 
 	appConfig = config.AppConfig
 
-	apiServer.Database = &db.DB{
-		Address: func() string {
-			if host := os.Getenv("DB_HOST"); host != "" {
-				return host
-			}
-			return "localhost"
-		}(),
-		Port: func() int {
-			if appConfig.Database.Port == 0 {
-				return 5432
-			}
-			return appConfig.Database.Port
-		}(),
-		User: func() string {
-			if user := os.Getenv("DB_USER"); user != "" {
-				return user
-			}
-			return appConfig.Database.User
-		}(),
-		Password: appConfig.Database.Password,
-		AppName:  utils.AppName,
-		DatabaseName: appConfig.Database.Name,
-		Logger:   logger,
-		LogLevel: logLevel,
+	libhttp.RequireAdminTwoFactor = appConfig.Security.RequireAdmin2FA
+	libhttp.TrustProxyHeaders = appConfig.Security.RateLimit.TrustProxyHeaders
+
+	urlSigningKey, err := libhttp.LoadURLSigningKey(appConfig.Security.URLSigningKey, appConfig.BaseDir)
+	if err != nil {
+		logger.Error("failed to load url signing key", slog.Any("error", err))
+		panic(err)
+	}
+	libhttp.URLSigningKey = urlSigningKey
+
+	if appConfig.Federation.Enabled {
+		Federation, err = federation.Configured()
+		if err != nil {
+			logger.Error("failed to set up federation", slog.Any("error", err))
+			panic(err)
+		}
 	}
 
+	apiServer.Database = config.NewDatabase(appConfig, logger, logLevel)
+
 	// Lmao I hate this
 	client := apiServer.ConnectToDatabase(
 		entities.ImageAsset{},
@@ -277,9 +293,38 @@ func main() {
 		entities.User{},
 		entities.DownloadToken{},
 		entities.WorkerJob{},
+		entities.JobBatch{},
+		entities.QueueMessage{},
+		entities.JobAuditEntry{},
+		entities.UserTOTP{},
+		entities.RecoveryCode{},
+		entities.LoginChallenge{},
+		entities.PasskeyWithCredential{},
+		entities.WebAuthnCeremony{},
+		entities.UserIdentity{},
+		entities.OIDCLoginState{},
+		entities.EmailToken{},
+		entities.SecurityEvent{},
+		entities.CollectionShare{},
+		entities.Group{},
+		entities.GroupMember{},
 		entities.UserWithPassword{},
+		entities.SessionWithToken{},
+		entities.OAuthClientWithSecret{},
+		entities.OAuthAuthorizationRequest{},
+		entities.OAuthToken{},
+		entities.ShareGuestWithKey{},
+		entities.ProofingMark{},
+		entities.ProofingComment{},
 		entities.SettingDefault{},
 		entities.SettingOverride{},
+		entities.DownloadLog{},
+		entities.ExportArchive{},
+		entities.FederationPeer{},
+		entities.CollectionMirror{},
+		entities.UploadLink{},
+		entities.AnalyticsEvent{},
+		entities.AnalyticsDailyStat{},
 	)
 	apiServer.VizServer.Database.Client = client
 
@@ -293,44 +338,57 @@ func main() {
 		}
 	}
 
-	var libvipsLogLevel libvips.LogLevel = libvips.LogLevelInfo
-	if appConfig.Libvips.MatchSystemLogging {
-		switch logLevel {
-		case slog.LevelDebug:
-			libvipsLogLevel = libvips.LogLevelDebug
-		case slog.LevelInfo:
-			libvipsLogLevel = libvips.LogLevelInfo
-		case slog.LevelWarn:
-			libvipsLogLevel = libvips.LogLevelWarning
-		case slog.LevelError:
-			libvipsLogLevel = libvips.LogLevelError
-		default:
-			libvipsLogLevel = libvips.LogLevelInfo
-		}
-	} else {
-		// TODO: fix this error message, it sucks and is confusing
-		logger.Info("libvipsLogLevel: matching server level is off. using default: info")
+	imageops.ConfigureLogging(appConfig.Libvips, logger, logLevel)
+	imageops.WarmupAllOps(appConfig.Libvips)
+
+	StorageStatsHolder = images.NewStorageStatsHolder(appConfig.BaseDir)
+
+	if appConfig.Mail.FileDir == "" {
+		appConfig.Mail.FileDir = filepath.Join(appConfig.BaseDir, "mail")
 	}
 
-	var libvipsLogHandler libvips.LoggingHandlerFunction = func(messageDomain string, messageLevel libvips.LogLevel, message string) {
-		switch messageLevel {
-		case libvips.LogLevelCritical:
-			imalog.Fatal(logger, fmt.Sprintf("%s: %s", messageDomain, message))
-		case libvips.LogLevelError:
-			logger.Error(fmt.Sprintf("%s: %s", messageDomain, message))
-		case libvips.LogLevelWarning:
-			logger.Warn(fmt.Sprintf("%s: %s", messageDomain, message))
-		case libvips.LogLevelMessage, libvips.LogLevelInfo:
-			logger.Info(fmt.Sprintf("%s: %s", messageDomain, message))
-		case libvips.LogLevelDebug:
-			logger.Debug(fmt.Sprintf("%s: %s", messageDomain, message))
+	Mailer, err = mail.New(appConfig.Mail, logger)
+	if err != nil {
+		logger.Error("invalid mail config", slog.Any("error", err))
+		panic(err)
+	}
+
+	if rl := appConfig.Security.RateLimit; rl.Enabled {
+		var store libhttp.RateLimitStore = libhttp.NewMemoryRateLimitStore()
+		if rl.Store == "redis" {
+			store = libhttp.NewRedisRateLimitStore(jobs.NewRedisClient(appConfig.Queue))
 		}
+
+		RateLimiter = libhttp.NewLimiter(store, libhttp.RateLimitPolicy{
+			Requests:      rl.RequestsPerMinute,
+			Window:        time.Minute,
+			MaxFailures:   rl.MaxFailures,
+			FailureWindow: time.Duration(rl.FailureWindowSeconds) * time.Second,
+			Lockout:       time.Duration(rl.LockoutSeconds) * time.Second,
+			MaxLockout:    time.Duration(rl.MaxLockoutSeconds) * time.Second,
+		}, logger)
+		RateLimiter.TrustProxyHeaders = rl.TrustProxyHeaders
+		RateLimiter.OnLockout = routes.RecordLockout(client, logger)
+	} else {
+		logger.Warn("rate limiting is disabled")
 	}
 
-	libvips.SetLogging(libvipsLogHandler, libvipsLogLevel)
-	imageops.WarmupAllOps(appConfig.Libvips)
+	if appConfig.Analytics.Enabled {
+		ipHashing, err := analytics.ParseIPHashing(appConfig.Analytics.IPHashing)
+		if err != nil {
+			logger.Error("invalid analytics config", slog.Any("error", err))
+			panic(err)
+		}
 
-	StorageStatsHolder = images.NewStorageStatsHolder(appConfig.BaseDir)
+		// Visitors are hashed with the URL signing key, which every API
+		// instance shares, so they count the same visitor alike.
+		Analytics = analytics.NewRecorder(client, logger, analytics.Options{
+			IPHashing:     ipHashing,
+			Key:           urlSigningKey,
+			BatchSize:     appConfig.Analytics.BatchSize,
+			FlushInterval: time.Duration(appConfig.Analytics.FlushIntervalSeconds) * time.Second,
+		})
+	}
 
 	httpServer := apiServer.Launch(router)
 
@@ -345,6 +403,33 @@ func main() {
 		logger.Debug("transform cache gc: disabled by config")
 	}
 
+	// Expired download tokens and share links are removed even if nobody
+	// tries them again.
+	downloads.StartTokenCleanup(ctx, logger, client, time.Hour)
+	downloads.StartExportCleanup(ctx, logger, client, time.Hour)
+
+	if Analytics != nil {
+		Analytics.Start(ctx)
+
+		interval := time.Duration(appConfig.Analytics.RollupIntervalMinutes) * time.Minute
+		if interval <= 0 {
+			interval = 15 * time.Minute
+		}
+
+		// Events have to outlive a late rollup of the day before
+		retention := time.Duration(max(appConfig.Analytics.RetentionDays, 2)) * 24 * time.Hour
+		analytics.StartRollups(ctx, logger, client, interval, retention)
+	}
+
+	if Federation != nil {
+		interval := time.Duration(appConfig.Federation.SyncIntervalMinutes) * time.Minute
+		if interval <= 0 {
+			interval = time.Hour
+		}
+
+		workers.StartMirrorSync(ctx, logger, client, interval)
+	}
+
 	if appConfig.StorageMetrics.Enabled {
 		interval := time.Duration(appConfig.StorageMetrics.IntervalSeconds) * time.Second
 		if interval <= 0 {
@@ -354,14 +439,33 @@ func main() {
 		go StorageStatsHolder.StartStorageStatsWorker(ctx, logger, interval)
 	}
 
+	jobs.Broker = apiServer.WSBroker
+
 	imageWorker := workers.NewImageWorker(client, apiServer.WSBroker)
 	xmpWorker := workers.NewXMPWorker(client, apiServer.WSBroker)
 	exifWorker := workers.NewExifWorker(client, apiServer.WSBroker)
+	exportWorker := workers.NewExportWorker(client, apiServer.WSBroker)
+	federationSyncWorker := workers.NewFederationSyncWorker(client, apiServer.WSBroker)
+
+	if appConfig.Queue.Mode == jobs.QueueModeAPI {
+		// Standalone workers (cmd/worker) consume the jobs; this process only
+		// publishes them and relays the workers' events to WebSocket clients.
+		jobs.SetPublishOnly(true)
+		jobs.OpenQueue(appConfig.Queue, client, logger)
+
+		relay, err := jobs.NewEventRelay(appConfig.Queue, client)
+		if err != nil {
+			logger.Error("API-only queue mode needs a shared queue backend", slog.Any("error", err))
+			panic(err)
+		}
 
-	// Run the job router in a goroutine so we can wait for shutdown signals here
-	go func() {
-		jobs.RunJobQueue(appConfig.Queue, logger, imageWorker, xmpWorker, exifWorker)
-	}()
+		go jobs.RelayEvents(ctx, relay, apiServer.WSBroker)
+	} else {
+		// Run the job router in a goroutine so we can wait for shutdown signals here
+		go func() {
+			jobs.RunJobQueue(appConfig.Queue, client, logger, imageWorker, xmpWorker, exifWorker, exportWorker, federationSyncWorker)
+		}()
+	}
 
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
@@ -0,0 +1,155 @@
+package routes
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/render"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+
+	"viz/internal/dto"
+	"viz/internal/entities"
+	libhttp "viz/internal/http"
+	"viz/internal/policy"
+)
+
+// requestUser is the user making req, whether signed in, using an API key or
+// an app acting for them with an OAuth2 access token.
+func requestUser(req *http.Request) *entities.User {
+	if user, ok := libhttp.UserFromContext(req); ok && user != nil {
+		return user
+	}
+
+	if apiKey, ok := libhttp.APIKeyFromContext(req); ok && apiKey != nil {
+		return apiKey.User
+	}
+
+	if token, ok := libhttp.OAuthTokenFromContext(req); ok && token != nil {
+		return token.User
+	}
+
+	return nil
+}
+
+// keyCollections returns the collections the API key making req is limited
+// to, or nil if it isn't limited or req isn't using one.
+func keyCollections(req *http.Request) []string {
+	if user, ok := libhttp.UserFromContext(req); ok && user != nil {
+		return nil
+	}
+
+	apiKey, ok := libhttp.APIKeyFromContext(req)
+	if !ok || apiKey == nil || len(lo.FromPtr(apiKey.AllowedCollections)) == 0 {
+		return nil
+	}
+
+	return *apiKey.AllowedCollections
+}
+
+// visibleImages limits a query on images to those the user making req can
+// see, and to the collections their API key is limited to.
+func visibleImages(req *http.Request) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Scopes(policy.VisibleImages(requestUser(req)))
+		if uids := keyCollections(req); uids != nil {
+			db = db.Scopes(policy.WithinCollections(uids))
+		}
+		return db
+	}
+}
+
+// visibleCollections limits a query on collections to those the user making
+// req can see, and to the ones their API key is limited to.
+func visibleCollections(req *http.Request) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Scopes(policy.VisibleCollections(requestUser(req)))
+		if uids := keyCollections(req); uids != nil {
+			db = db.Where("collections.uid IN ?", uids)
+		}
+		return db
+	}
+}
+
+// keyAllowsImages reports whether the API key making req may touch all of
+// imageUIDs, which it may only if they're in the collections it is limited to.
+func keyAllowsImages(db *gorm.DB, req *http.Request, imageUIDs ...string) (bool, error) {
+	uids := keyCollections(req)
+	if uids == nil {
+		return true, nil
+	}
+
+	imageUIDs = lo.Uniq(imageUIDs)
+
+	var count int64
+	err := db.Model(&entities.ImageAsset{}).
+		Scopes(policy.WithinCollections(uids)).
+		Where("images.uid IN ?", imageUIDs).
+		Count(&count).Error
+
+	return count == int64(len(imageUIDs)), err
+}
+
+// checkKeyUnlimited answers 403 and returns false if req uses an API key
+// limited to some collections, for routes that would reach beyond them,
+// such as uploading.
+func checkKeyUnlimited(res http.ResponseWriter, req *http.Request) bool {
+	if keyCollections(req) == nil {
+		return true
+	}
+
+	render.Status(req, http.StatusForbidden)
+	render.JSON(res, req, dto.ErrorResponse{Error: "This API key is limited to specific collections"})
+	return false
+}
+
+// collectionRoleDTO is a role on a collection as reported to the user, nil
+// when they have none of their own.
+func collectionRoleDTO(role policy.Role) *dto.CollectionDetailResponseRole {
+	if role < policy.Viewer {
+		return nil
+	}
+
+	r := dto.CollectionDetailResponseRole(role.String())
+	return &r
+}
+
+// checkImageVisible answers 404 and returns false if the user making req
+// may not see img, so private images don't leak their existence.
+func checkImageVisible(res http.ResponseWriter, req *http.Request, db *gorm.DB, logger *slog.Logger, img *entities.ImageAsset) bool {
+	visible, err := policy.CanSeeImage(db, img, requestUser(req))
+	if err == nil && visible {
+		visible, err = keyAllowsImages(db, req, img.Uid)
+	}
+
+	if err != nil {
+		libhttp.ServerError(res, req, err, logger, nil,
+			"failed to check image access",
+			"Something went wrong, please try again later",
+		)
+		return false
+	}
+
+	if !visible {
+		render.Status(req, http.StatusNotFound)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Image not found"})
+		return false
+	}
+
+	return true
+}
+
+// checkGroupRole reports whether user may hand something over to group
+// groupUid, which takes being at least a member of it.
+func checkGroupRole(db *gorm.DB, user *entities.User, groupUid string) (bool, error) {
+	if user == nil {
+		return false, nil
+	}
+
+	groups, err := policy.GroupRoles(db, user.Uid)
+	if err != nil {
+		return false, err
+	}
+
+	return groups[groupUid] >= policy.Editor, nil
+}
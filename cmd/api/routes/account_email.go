@@ -0,0 +1,350 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"gorm.io/gorm"
+
+	"viz/internal/auth"
+	"viz/internal/config"
+	"viz/internal/crypto"
+	"viz/internal/dto"
+	"viz/internal/entities"
+	libhttp "viz/internal/http"
+	"viz/internal/mail"
+	"viz/internal/utils"
+)
+
+// Purposes an EmailToken can be issued for.
+const (
+	emailTokenPasswordReset = "password_reset"
+	emailTokenVerifyEmail   = "verify_email"
+)
+
+const (
+	passwordResetTTL     = time.Hour
+	emailVerificationTTL = 48 * time.Hour
+
+	// Mail goes out after the response, so it gets its own deadline.
+	mailSendTimeout = time.Minute
+)
+
+var errInvalidEmailToken = errors.New("email token is invalid or has expired")
+
+// userDisplayName is how to address a user in emails and on authenticators.
+func userDisplayName(user entities.User) string {
+	if name := strings.TrimSpace(user.FirstName + " " + user.LastName); name != "" {
+		return name
+	}
+	return user.Username
+}
+
+// appLink builds a link to a frontend page carrying token.
+func appLink(path, token string) string {
+	return strings.TrimRight(config.AppConfig.BaseURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+// issueEmailToken replaces any outstanding token userUid has for purpose.
+func issueEmailToken(db *gorm.DB, userUid, purpose, email string, ttl time.Duration) (string, error) {
+	now := time.Now().UTC()
+
+	err := db.Where("(user_uid = ? AND purpose = ?) OR expires_at < ?", userUid, purpose, now).
+		Delete(&entities.EmailToken{}).Error
+	if err != nil {
+		return "", err
+	}
+
+	token := auth.GenerateAuthToken()
+	tokenHash, _ := auth.HashSecret(token)
+
+	row := entities.EmailToken{
+		TokenHash: tokenHash,
+		UserUid:   userUid,
+		Purpose:   purpose,
+		Email:     email,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	if err := db.Create(&row).Error; err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// takeEmailToken spends an unexpired token issued for purpose.
+func takeEmailToken(db *gorm.DB, token, purpose string) (*entities.EmailToken, error) {
+	if token == "" {
+		return nil, errInvalidEmailToken
+	}
+
+	tokenHash, _ := auth.HashSecret(token)
+	now := time.Now().UTC()
+
+	var row entities.EmailToken
+	err := db.Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", tokenHash, purpose, now).First(&row).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errInvalidEmailToken
+		}
+		return nil, err
+	}
+
+	spent := db.Model(&entities.EmailToken{}).Where("id = ? AND used_at IS NULL", row.ID).Update("used_at", now)
+	if spent.Error != nil {
+		return nil, spent.Error
+	}
+
+	if spent.RowsAffected == 0 {
+		return nil, errInvalidEmailToken
+	}
+
+	return &row, nil
+}
+
+// sendEmail renders and sends a templated email in the background, so
+// neither the mail server's latency nor its failures reach the client.
+func sendEmail(mailer mail.Mailer, logger *slog.Logger, template, to string, data mail.TemplateData) {
+	msg, err := mail.Render(template, to, data)
+	if err != nil {
+		logger.Error("failed to render email", slog.String("template", template), slog.Any("error", err))
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+		defer cancel()
+
+		if err := mailer.Send(ctx, msg); err != nil {
+			logger.Error("failed to send email", slog.String("template", template), slog.Any("error", err))
+		}
+	}()
+}
+
+// sendVerificationEmail sends user a link confirming they own email.
+func sendVerificationEmail(db *gorm.DB, mailer mail.Mailer, logger *slog.Logger, user entities.User, email string) error {
+	token, err := issueEmailToken(db, user.Uid, emailTokenVerifyEmail, email, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	sendEmail(mailer, logger, mail.TemplateVerifyEmail, email, mail.TemplateData{
+		Name:      userDisplayName(user),
+		Email:     email,
+		Link:      appLink("/auth/verify-email", token),
+		ExpiresIn: "2 days",
+	})
+
+	return nil
+}
+
+// passwordResetRoutes serves /auth/password/forgot and /auth/password/reset.
+func passwordResetRoutes(db *gorm.DB, logger *slog.Logger, mailer mail.Mailer) func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Post("/forgot", func(res http.ResponseWriter, req *http.Request) {
+			var body dto.PasswordForgotRequest
+			if err := render.DecodeJSON(req.Body, &body); err != nil || !utils.IsValidEmail(string(body.Email)) {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "A valid email is required"})
+				return
+			}
+
+			// Same answer whether or not the account exists, so this can't
+			// be used to find out who has one.
+			accepted := dto.MessageResponse{Message: "If an account exists for that email, a reset link is on its way"}
+
+			var user entities.User
+			err := db.Where("email = ?", strings.TrimSpace(string(body.Email))).First(&user).Error
+			if err != nil {
+				if !errors.Is(err, gorm.ErrRecordNotFound) {
+					logger.Error("failed to look up user for password reset", slog.Any("error", err))
+				}
+
+				render.Status(req, http.StatusAccepted)
+				render.JSON(res, req, accepted)
+				return
+			}
+
+			token, err := issueEmailToken(db, user.Uid, emailTokenPasswordReset, user.Email, passwordResetTTL)
+			if err != nil {
+				libhttp.ServerError(res, req, err, logger, nil,
+					"failed to create password reset token",
+					"Something went wrong, please try again later",
+				)
+				return
+			}
+
+			sendEmail(mailer, logger, mail.TemplatePasswordReset, user.Email, mail.TemplateData{
+				Name:      userDisplayName(user),
+				Email:     user.Email,
+				Link:      appLink("/auth/reset-password", token),
+				ExpiresIn: "1 hour",
+			})
+
+			logger.Info("password reset requested", slog.String("user_uid", user.Uid))
+			render.Status(req, http.StatusAccepted)
+			render.JSON(res, req, accepted)
+		})
+
+		r.Post("/reset", func(res http.ResponseWriter, req *http.Request) {
+			var body dto.PasswordResetRequest
+			if err := render.DecodeJSON(req.Body, &body); err != nil || body.Token == "" || body.Password == "" {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Token and new password are required"})
+				return
+			}
+
+			token, err := takeEmailToken(db, body.Token, emailTokenPasswordReset)
+			if err != nil {
+				if errors.Is(err, errInvalidEmailToken) {
+					render.Status(req, http.StatusBadRequest)
+					render.JSON(res, req, dto.ErrorResponse{Error: "This reset link is invalid or has expired"})
+					return
+				}
+
+				libhttp.ServerError(res, req, err, logger, nil, "failed to get password reset token", "Something went wrong, please try again later")
+				return
+			}
+
+			argonParams := &crypto.Argon2Params{
+				MemoryMB: config.AppConfig.Security.Argon2MemoryMB,
+				Time:     config.AppConfig.Security.Argon2Time,
+				Threads:  config.AppConfig.Security.Argon2Threads,
+			}
+
+			hashed, err := crypto.HashPassword(body.Password, argonParams)
+			if err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to hash password", "Something went wrong, please try again later")
+				return
+			}
+
+			err = db.Transaction(func(tx *gorm.DB) error {
+				updates := map[string]any{"password": hashed}
+
+				// Following the link proved they read mail at this address.
+				var user entities.User
+				if err := tx.Where("uid = ?", token.UserUid).First(&user).Error; err != nil {
+					return err
+				}
+				if user.Email == token.Email {
+					updates["email_verified"] = true
+				}
+
+				if err := tx.Model(&entities.User{}).Where("uid = ?", token.UserUid).Updates(updates).Error; err != nil {
+					return err
+				}
+
+				if err := tx.Where("user_uid = ?", token.UserUid).Delete(&entities.LoginChallenge{}).Error; err != nil {
+					return err
+				}
+
+				// Sign out everywhere, apps included, in case someone else had
+				// the old password.
+				if err := deleteSessions(tx, "user_uid = ?", token.UserUid); err != nil {
+					return err
+				}
+
+				return revokeUserOAuthTokens(tx, token.UserUid)
+			})
+
+			if err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to reset password", "Something went wrong, please try again later")
+				return
+			}
+
+			logger.Info("password reset", slog.String("user_uid", token.UserUid))
+			render.JSON(res, req, dto.MessageResponse{Message: "Password changed. Please sign in again."})
+		})
+	}
+}
+
+// verifyEmailHandler serves POST /auth/email/verify. For a new account it
+// confirms the address; for an email change it is when the change happens.
+func verifyEmailHandler(db *gorm.DB, logger *slog.Logger, mailer mail.Mailer) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		var body dto.EmailVerifyRequest
+		if err := render.DecodeJSON(req.Body, &body); err != nil || body.Token == "" {
+			render.Status(req, http.StatusBadRequest)
+			render.JSON(res, req, dto.ErrorResponse{Error: "A token is required"})
+			return
+		}
+
+		token, err := takeEmailToken(db, body.Token, emailTokenVerifyEmail)
+		if err != nil {
+			if errors.Is(err, errInvalidEmailToken) {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "This verification link is invalid or has expired"})
+				return
+			}
+
+			libhttp.ServerError(res, req, err, logger, nil, "failed to get verification token", "Something went wrong, please try again later")
+			return
+		}
+
+		var user entities.User
+		if err := db.Where("uid = ?", token.UserUid).First(&user).Error; err != nil {
+			render.Status(req, http.StatusBadRequest)
+			render.JSON(res, req, dto.ErrorResponse{Error: "This verification link is invalid or has expired"})
+			return
+		}
+
+		previousEmail := user.Email
+		switch {
+		case token.Email == user.Email:
+			err = db.Model(&user).Update("email_verified", true).Error
+
+		case user.PendingEmail != nil && *user.PendingEmail == token.Email:
+			var taken int64
+			if err := db.Model(&entities.User{}).Where("email = ? AND uid <> ?", token.Email, user.Uid).Count(&taken).Error; err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to check email", "Something went wrong, please try again later")
+				return
+			}
+
+			if taken > 0 {
+				render.Status(req, http.StatusConflict)
+				render.JSON(res, req, dto.ErrorResponse{Error: "This email now belongs to another account"})
+				return
+			}
+
+			err = db.Model(&user).Updates(map[string]any{
+				"email":          token.Email,
+				"pending_email":  nil,
+				"email_verified": true,
+			}).Error
+
+		default:
+			// The user changed their mind about the address since.
+			render.Status(req, http.StatusBadRequest)
+			render.JSON(res, req, dto.ErrorResponse{Error: "This verification link is invalid or has expired"})
+			return
+		}
+
+		if err != nil {
+			libhttp.ServerError(res, req, err, logger, nil, "failed to verify email", "Something went wrong, please try again later")
+			return
+		}
+
+		if err := db.Where("uid = ?", user.Uid).First(&user).Error; err != nil {
+			libhttp.ServerError(res, req, err, logger, nil, "failed to fetch user", "Something went wrong, please try again later")
+			return
+		}
+
+		if previousEmail != user.Email {
+			sendEmail(mailer, logger, mail.TemplateEmailChanged, previousEmail, mail.TemplateData{
+				Name:  userDisplayName(user),
+				Email: user.Email,
+			})
+			logger.Info("email changed", slog.String("user_uid", user.Uid))
+		}
+
+		render.JSON(res, req, user.DTO())
+	}
+}
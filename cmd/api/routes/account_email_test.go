@@ -0,0 +1,88 @@
+package routes_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"viz/api/routes"
+	"viz/internal/config"
+	"viz/internal/entities"
+	"viz/internal/mail"
+)
+
+// captureMailer hands what it's asked to send to a channel.
+type captureMailer chan mail.Message
+
+func (m captureMailer) Send(ctx context.Context, msg mail.Message) error {
+	m <- msg
+	return nil
+}
+
+func TestPasswordResetSignsOutEverywhere(t *testing.T) {
+	db := newTestDB(t)
+	config.AppConfig.Security.Argon2MemoryMB = 8
+	config.AppConfig.Security.Argon2Time = 1
+	config.AppConfig.Security.Argon2Threads = 1
+
+	mailer := make(captureMailer, 1)
+	router := chi.NewRouter()
+	router.Mount("/auth", routes.AuthRouter(db, newTestLogger(), mailer, nil))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	require.NoError(t, db.Create(&entities.User{Uid: "reset_user", Username: "reset_user", Email: "reset@example.com"}).Error)
+	require.NoError(t, db.Create(&entities.SessionWithToken{
+		Session:   entities.Session{Uid: "reset_session", UserUid: "reset_user"},
+		TokenHash: "reset_session_hash",
+	}).Error)
+
+	refresh := "reset_refresh_hash"
+	later := time.Now().Add(30 * 24 * time.Hour)
+	require.NoError(t, db.Create(&[]entities.OAuthToken{
+		{GrantUid: "reset_grant", UserUid: "reset_user", AccessTokenHash: "reset_access_hash", AccessExpiresAt: later, RefreshTokenHash: &refresh, RefreshExpiresAt: &later},
+		{GrantUid: "reset_other_grant", UserUid: "reset_other_user", AccessTokenHash: "reset_other_access_hash", AccessExpiresAt: later},
+	}).Error)
+
+	resp, err := http.Post(server.URL+"/auth/password/forgot", "application/json", strings.NewReader(`{"email": "reset@example.com"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	var msg mail.Message
+	select {
+	case msg = <-mailer:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reset email sent")
+	}
+
+	link := regexp.MustCompile(`token=[^\s"<]+`).FindString(msg.Text)
+	require.NotEmpty(t, link)
+	token, err := url.QueryUnescape(strings.TrimPrefix(link, "token="))
+	require.NoError(t, err)
+
+	resp, err = http.Post(server.URL+"/auth/password/reset", "application/json",
+		strings.NewReader(`{"token": "`+token+`", "password": "a new password"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var sessions int64
+	require.NoError(t, db.Model(&entities.Session{}).Where("user_uid = ?", "reset_user").Count(&sessions).Error)
+	assert.Zero(t, sessions)
+
+	var tokens []entities.OAuthToken
+	require.NoError(t, db.Where("grant_uid IN ?", []string{"reset_grant", "reset_other_grant"}).Order("grant_uid").Find(&tokens).Error)
+	require.Len(t, tokens, 2)
+	assert.NotNil(t, tokens[0].RevokedAt, "the user's app tokens survived the reset")
+	assert.Nil(t, tokens[1].RevokedAt, "another user's app tokens were revoked")
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"net/http"
 	"runtime"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -161,6 +162,40 @@ func AdminRouter(db *gorm.DB, logger *slog.Logger, storageStats *images.StorageS
 		render.JSON(res, req, stats)
 	})
 
+	// Lockouts and other security events, newest first
+	r.Get("/security/events", func(res http.ResponseWriter, req *http.Request) {
+		limit, err := strconv.Atoi(req.URL.Query().Get("limit"))
+		if err != nil || limit < 1 {
+			limit = 100
+		}
+		limit = min(limit, 500)
+
+		query := db.Order("created_at desc").Limit(limit)
+		if scope := req.URL.Query().Get("scope"); scope != "" {
+			query = query.Where("scope = ?", scope)
+		}
+
+		var events []entities.SecurityEvent
+		if err := query.Find(&events).Error; err != nil {
+			libhttp.ServerError(res, req, err, logger, nil, "failed to list security events", "Failed to fetch security events")
+			return
+		}
+
+		items := make([]dto.SecurityEvent, 0, len(events))
+		for _, e := range events {
+			items = append(items, e.DTO())
+		}
+
+		render.Status(req, http.StatusOK)
+		render.JSON(res, req, dto.SecurityEventList{Items: items})
+	})
+
+	// Groups and their members
+	r.Route("/groups", adminGroupRoutes(db, logger))
+
+	// Third-party apps using the OAuth2 server
+	r.Route("/oauth-clients", adminOAuthClientRoutes(db, logger))
+
 	// User Management
 	r.Route("/users", func(r chi.Router) {
 		r.Get("/", func(res http.ResponseWriter, req *http.Request) {
@@ -285,22 +320,31 @@ func AdminRouter(db *gorm.DB, logger *slog.Logger, storageStats *images.StorageS
 				Role:      *update.Role,
 			}
 
-			if err := db.Model(&user).Updates(updates).Error; err != nil {
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Model(&user).Updates(updates).Error; err != nil {
+					return err
+				}
+
+				if update.Role == nil {
+					return nil
+				}
+
+				// A new role takes effect at once: the user signs in again,
+				// and apps have to be approved again
+				if err := deleteSessions(tx, "user_uid = ?", user.Uid); err != nil {
+					return err
+				}
+
+				return revokeUserOAuthTokens(tx, user.Uid)
+			})
+
+			if err != nil {
 				logger.Error("failed to update user", slog.Any("error", err))
 				render.Status(req, http.StatusInternalServerError)
 				render.JSON(res, req, dto.ErrorResponse{Error: "Failed to update user"})
 				return
 			}
 
-			// Force token revocation if role changed? maybe
-			if update.Role != nil {
-				// Revoke sessions for security
-				if err := db.Where("user_uid = ?", user.Uid).Delete(&entities.Session{}).Error; err != nil {
-					// failing the request is unecessary
-					logger.Error("failed to revoke user sessions after role change", slog.String("uid", user.Uid), slog.Any("error", err))
-				}
-			}
-
 			render.JSON(res, req, user.DTO())
 		})
 
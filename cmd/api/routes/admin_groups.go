@@ -0,0 +1,342 @@
+package routes
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"gorm.io/gorm"
+
+	"viz/internal/dto"
+	"viz/internal/entities"
+	libhttp "viz/internal/http"
+	"viz/internal/policy"
+	"viz/internal/uid"
+)
+
+var (
+	errGroupNameTaken  = errors.New("group name taken")
+	errMemberNotFound  = errors.New("group member not found")
+	errMemberUserFound = errors.New("user to add not found")
+)
+
+// writeGroupError answers for the errors the group routes return.
+func writeGroupError(res http.ResponseWriter, req *http.Request, logger *slog.Logger, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		render.Status(req, http.StatusNotFound)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Group not found"})
+	case errors.Is(err, errMemberNotFound):
+		render.Status(req, http.StatusNotFound)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Member not found"})
+	case errors.Is(err, errMemberUserFound):
+		render.Status(req, http.StatusNotFound)
+		render.JSON(res, req, dto.ErrorResponse{Error: "User not found"})
+	case errors.Is(err, errGroupNameTaken):
+		render.Status(req, http.StatusConflict)
+		render.JSON(res, req, dto.ErrorResponse{Error: "A group with this name already exists"})
+	default:
+		libhttp.ServerError(res, req, err, logger, nil,
+			"failed to update group",
+			"Something went wrong, please try again later",
+		)
+	}
+}
+
+// checkGroupName returns errGroupNameTaken if another group than exceptUid
+// is called name.
+func checkGroupName(tx *gorm.DB, name, exceptUid string) error {
+	var taken int64
+	if err := tx.Model(&entities.Group{}).Where("LOWER(name) = LOWER(?) AND uid <> ?", name, exceptUid).Count(&taken).Error; err != nil {
+		return err
+	}
+
+	if taken > 0 {
+		return errGroupNameTaken
+	}
+	return nil
+}
+
+// findGroupMember gets userUid's membership of group groupUid.
+func findGroupMember(tx *gorm.DB, groupUid, userUid string) (entities.GroupMember, error) {
+	var member entities.GroupMember
+	err := tx.Preload("User").Where("group_uid = ? AND user_id = ?", groupUid, userUid).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return member, errMemberNotFound
+	}
+	return member, err
+}
+
+// adminGroupRoutes serves /admin/groups, where admins manage groups and who
+// is in them.
+func adminGroupRoutes(db *gorm.DB, logger *slog.Logger) func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Get("/", func(res http.ResponseWriter, req *http.Request) {
+			var groups []entities.Group
+			if err := db.Order("name").Find(&groups).Error; err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to list groups", "Failed to list groups")
+				return
+			}
+
+			items := make([]dto.Group, len(groups))
+			for i := range groups {
+				items[i] = groups[i].DTO()
+			}
+
+			render.JSON(res, req, dto.GroupList{Items: items})
+		})
+
+		r.Post("/", func(res http.ResponseWriter, req *http.Request) {
+			var body dto.GroupCreate
+			if err := render.DecodeJSON(req.Body, &body); err != nil || strings.TrimSpace(body.Name) == "" {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Name is required"})
+				return
+			}
+
+			group := entities.Group{
+				Uid:         uid.MustGenerate(),
+				Name:        strings.TrimSpace(body.Name),
+				Description: body.Description,
+			}
+
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := checkGroupName(tx, group.Name, group.Uid); err != nil {
+					return err
+				}
+				return tx.Create(&group).Error
+			})
+
+			if err != nil {
+				writeGroupError(res, req, logger, err)
+				return
+			}
+
+			logger.Info("group created", slog.String("group_uid", group.Uid), slog.String("name", group.Name))
+			render.Status(req, http.StatusCreated)
+			render.JSON(res, req, group.DTO())
+		})
+
+		r.Get("/{uid}", func(res http.ResponseWriter, req *http.Request) {
+			var group entities.Group
+			if err := db.Where("uid = ?", chi.URLParam(req, "uid")).First(&group).Error; err != nil {
+				writeGroupError(res, req, logger, err)
+				return
+			}
+
+			render.JSON(res, req, group.DTO())
+		})
+
+		r.Patch("/{uid}", func(res http.ResponseWriter, req *http.Request) {
+			var body dto.GroupUpdate
+			if err := render.DecodeJSON(req.Body, &body); err != nil || (body.Name != nil && strings.TrimSpace(*body.Name) == "") {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Invalid request body"})
+				return
+			}
+
+			var group entities.Group
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Where("uid = ?", chi.URLParam(req, "uid")).First(&group).Error; err != nil {
+					return err
+				}
+
+				if body.Name != nil {
+					group.Name = strings.TrimSpace(*body.Name)
+					if err := checkGroupName(tx, group.Name, group.Uid); err != nil {
+						return err
+					}
+				}
+
+				if body.Description != nil {
+					group.Description = body.Description
+				}
+
+				return tx.Save(&group).Error
+			})
+
+			if err != nil {
+				writeGroupError(res, req, logger, err)
+				return
+			}
+
+			render.JSON(res, req, group.DTO())
+		})
+
+		r.Delete("/{uid}", func(res http.ResponseWriter, req *http.Request) {
+			err := db.Transaction(func(tx *gorm.DB) error {
+				var group entities.Group
+				if err := tx.Where("uid = ?", chi.URLParam(req, "uid")).First(&group).Error; err != nil {
+					return err
+				}
+
+				// What the group owned stays with its individual owners
+				if err := tx.Model(&entities.ImageAsset{}).Where("owner_group_id = ?", group.Uid).Update("owner_group_id", nil).Error; err != nil {
+					return err
+				}
+				if err := tx.Model(&entities.Collection{}).Where("owner_group_id = ?", group.Uid).Update("owner_group_id", nil).Error; err != nil {
+					return err
+				}
+
+				if err := tx.Where("group_id = ?", group.Uid).Delete(&entities.CollectionShare{}).Error; err != nil {
+					return err
+				}
+				if err := tx.Where("group_uid = ?", group.Uid).Delete(&entities.GroupMember{}).Error; err != nil {
+					return err
+				}
+
+				return tx.Delete(&group).Error
+			})
+
+			if err != nil {
+				writeGroupError(res, req, logger, err)
+				return
+			}
+
+			res.WriteHeader(http.StatusNoContent)
+		})
+
+		r.Get("/{uid}/members", func(res http.ResponseWriter, req *http.Request) {
+			var members []entities.GroupMember
+
+			err := db.Transaction(func(tx *gorm.DB) error {
+				var group entities.Group
+				if err := tx.Where("uid = ?", chi.URLParam(req, "uid")).First(&group).Error; err != nil {
+					return err
+				}
+
+				return tx.Preload("User").Where("group_uid = ?", group.Uid).Order("created_at").Find(&members).Error
+			})
+
+			if err != nil {
+				writeGroupError(res, req, logger, err)
+				return
+			}
+
+			items := make([]dto.GroupMember, len(members))
+			for i := range members {
+				items[i] = members[i].DTO()
+			}
+
+			render.JSON(res, req, dto.GroupMemberList{Items: items})
+		})
+
+		r.Post("/{uid}/members", func(res http.ResponseWriter, req *http.Request) {
+			var body dto.GroupMemberCreate
+			if err := render.DecodeJSON(req.Body, &body); err != nil || body.UserUid == "" {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "A user and role are required"})
+				return
+			}
+
+			role := dto.GroupMemberRole(body.Role)
+			if _, ok := policy.GroupRole(role); !ok {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Role must be viewer, member or owner"})
+				return
+			}
+
+			var member entities.GroupMember
+			status := http.StatusOK
+
+			err := db.Transaction(func(tx *gorm.DB) error {
+				var group entities.Group
+				if err := tx.Where("uid = ?", chi.URLParam(req, "uid")).First(&group).Error; err != nil {
+					return err
+				}
+
+				var user entities.User
+				if err := tx.Where("uid = ?", body.UserUid).First(&user).Error; err != nil {
+					if errors.Is(err, gorm.ErrRecordNotFound) {
+						return errMemberUserFound
+					}
+					return err
+				}
+
+				var err error
+				member, err = findGroupMember(tx, group.Uid, user.Uid)
+				switch {
+				case err == nil:
+					member.Role = role
+				case errors.Is(err, errMemberNotFound):
+					member = entities.GroupMember{
+						Uid:      uid.MustGenerate(),
+						GroupUid: group.Uid,
+						UserID:   &user.Uid,
+						Role:     role,
+					}
+					status = http.StatusCreated
+				default:
+					return err
+				}
+
+				if err := tx.Omit("User").Save(&member).Error; err != nil {
+					return err
+				}
+
+				member.User = &user
+				return nil
+			})
+
+			if err != nil {
+				writeGroupError(res, req, logger, err)
+				return
+			}
+
+			logger.Info("group member added",
+				slog.String("group_uid", member.GroupUid),
+				slog.String("user_uid", body.UserUid),
+				slog.String("role", string(role)),
+			)
+
+			render.Status(req, status)
+			render.JSON(res, req, member.DTO())
+		})
+
+		r.Patch("/{uid}/members/{user_uid}", func(res http.ResponseWriter, req *http.Request) {
+			var body dto.GroupMemberUpdate
+			if err := render.DecodeJSON(req.Body, &body); err != nil {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Invalid request body"})
+				return
+			}
+
+			role := dto.GroupMemberRole(body.Role)
+			if _, ok := policy.GroupRole(role); !ok {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Role must be viewer, member or owner"})
+				return
+			}
+
+			member, err := findGroupMember(db, chi.URLParam(req, "uid"), chi.URLParam(req, "user_uid"))
+			if err == nil {
+				member.Role = role
+				err = db.Omit("User").Save(&member).Error
+			}
+
+			if err != nil {
+				writeGroupError(res, req, logger, err)
+				return
+			}
+
+			render.JSON(res, req, member.DTO())
+		})
+
+		r.Delete("/{uid}/members/{user_uid}", func(res http.ResponseWriter, req *http.Request) {
+			member, err := findGroupMember(db, chi.URLParam(req, "uid"), chi.URLParam(req, "user_uid"))
+			if err == nil {
+				err = db.Delete(&member).Error
+			}
+
+			if err != nil {
+				writeGroupError(res, req, logger, err)
+				return
+			}
+
+			res.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
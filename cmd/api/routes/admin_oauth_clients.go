@@ -0,0 +1,257 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+
+	"viz/internal/auth"
+	"viz/internal/dto"
+	"viz/internal/entities"
+	libhttp "viz/internal/http"
+	"viz/internal/uid"
+)
+
+// validateRedirectURIs checks the redirect URIs an OAuth client registers.
+// They're matched exactly, so they must be absolute and can't carry a
+// fragment (RFC 6749 section 3.1.2).
+func validateRedirectURIs(uris []string) ([]string, error) {
+	uris = lo.Uniq(lo.Map(uris, func(u string, _ int) string { return strings.TrimSpace(u) }))
+	if len(uris) == 0 {
+		return nil, errors.New("At least one redirect URI is required")
+	}
+
+	for _, raw := range uris {
+		u, err := url.Parse(raw)
+		if err != nil || u.Scheme == "" || (u.Host == "" && u.Opaque == "") {
+			return nil, fmt.Errorf("Invalid redirect URI %q", raw)
+		}
+		if u.Fragment != "" || strings.Contains(raw, "#") {
+			return nil, fmt.Errorf("Redirect URI %q can't have a fragment", raw)
+		}
+	}
+
+	return uris, nil
+}
+
+// validateClientScopes checks the scopes an OAuth client may ask for. Apps
+// never get the "*" scope.
+func validateClientScopes(scopes []string) ([]string, error) {
+	parsed, err := auth.ParseScopes(strings.Join(scopes, " "))
+	if err != nil {
+		return nil, errors.New("Unknown scope in scopes")
+	}
+
+	if len(parsed) == 0 {
+		return nil, errors.New("At least one scope is required")
+	}
+
+	if slices.Contains(parsed, string(auth.AllScope)) {
+		return nil, errors.New("OAuth clients can't be given every scope")
+	}
+
+	return parsed, nil
+}
+
+// newOAuthClientSecret makes a client secret and the hash kept of it.
+func newOAuthClientSecret() (string, string) {
+	secret := auth.GenerateOAuthToken(auth.OAuthClientSecretPrefix)
+	hash, _ := auth.HashSecret(secret)
+	return secret, hash
+}
+
+// adminOAuthClientRoutes serves /admin/oauth-clients, where admins register
+// the third-party apps that can use the OAuth2 server.
+func adminOAuthClientRoutes(db *gorm.DB, logger *slog.Logger) func(r chi.Router) {
+	notFound := func(res http.ResponseWriter, req *http.Request, err error) {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			render.Status(req, http.StatusNotFound)
+			render.JSON(res, req, dto.ErrorResponse{Error: "OAuth client not found"})
+			return
+		}
+
+		libhttp.ServerError(res, req, err, logger, nil,
+			"failed to update oauth client",
+			"Something went wrong, please try again later",
+		)
+	}
+
+	return func(r chi.Router) {
+		r.Get("/", func(res http.ResponseWriter, req *http.Request) {
+			var clients []entities.OAuthClient
+			if err := db.Order("name").Find(&clients).Error; err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to list oauth clients", "Failed to list OAuth clients")
+				return
+			}
+
+			items := make([]dto.OAuthClient, len(clients))
+			for i := range clients {
+				items[i] = clients[i].DTO()
+			}
+
+			render.JSON(res, req, dto.OAuthClientList{Items: items})
+		})
+
+		r.Post("/", func(res http.ResponseWriter, req *http.Request) {
+			var body dto.OAuthClientCreate
+			if err := render.DecodeJSON(req.Body, &body); err != nil || strings.TrimSpace(body.Name) == "" {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Name is required"})
+				return
+			}
+
+			redirectURIs, err := validateRedirectURIs(body.RedirectUris)
+			if err == nil {
+				body.Scopes, err = validateClientScopes(body.Scopes)
+			}
+			if err != nil {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: err.Error()})
+				return
+			}
+
+			client := entities.OAuthClientWithSecret{
+				OAuthClient: entities.OAuthClient{
+					Uid:          uid.MustGenerate(),
+					Name:         strings.TrimSpace(body.Name),
+					Description:  body.Description,
+					RedirectUris: redirectURIs,
+					Scopes:       body.Scopes,
+					Confidential: lo.FromPtr(body.Confidential),
+				},
+			}
+
+			var secret *string
+			if client.Confidential {
+				plain, hash := newOAuthClientSecret()
+				client.SecretHash = hash
+				secret = &plain
+			}
+
+			if err := db.Create(&client).Error; err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to create oauth client", "Failed to create OAuth client")
+				return
+			}
+
+			logger.Info("oauth client created", slog.String("client_uid", client.Uid), slog.String("name", client.Name))
+			render.Status(req, http.StatusCreated)
+			render.JSON(res, req, dto.OAuthClientSecretResponse{Client: client.DTO(), ClientSecret: secret})
+		})
+
+		r.Get("/{uid}", func(res http.ResponseWriter, req *http.Request) {
+			var client entities.OAuthClient
+			if err := db.Where("uid = ?", chi.URLParam(req, "uid")).First(&client).Error; err != nil {
+				notFound(res, req, err)
+				return
+			}
+
+			render.JSON(res, req, client.DTO())
+		})
+
+		r.Patch("/{uid}", func(res http.ResponseWriter, req *http.Request) {
+			var body dto.OAuthClientUpdate
+			if err := render.DecodeJSON(req.Body, &body); err != nil || (body.Name != nil && strings.TrimSpace(*body.Name) == "") {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Invalid request body"})
+				return
+			}
+
+			var client entities.OAuthClient
+			if err := db.Where("uid = ?", chi.URLParam(req, "uid")).First(&client).Error; err != nil {
+				notFound(res, req, err)
+				return
+			}
+
+			var err error
+			if body.RedirectUris != nil {
+				client.RedirectUris, err = validateRedirectURIs(*body.RedirectUris)
+			}
+			if err == nil && body.Scopes != nil {
+				client.Scopes, err = validateClientScopes(*body.Scopes)
+			}
+			if err != nil {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: err.Error()})
+				return
+			}
+
+			if body.Name != nil {
+				client.Name = strings.TrimSpace(*body.Name)
+			}
+			if body.Description != nil {
+				client.Description = body.Description
+			}
+
+			// Grants already made keep their scopes until they're revoked or
+			// run out; narrowing a client only affects new consent.
+			if err := db.Save(&client).Error; err != nil {
+				notFound(res, req, err)
+				return
+			}
+
+			render.JSON(res, req, client.DTO())
+		})
+
+		r.Delete("/{uid}", func(res http.ResponseWriter, req *http.Request) {
+			err := db.Transaction(func(tx *gorm.DB) error {
+				var client entities.OAuthClient
+				if err := tx.Where("uid = ?", chi.URLParam(req, "uid")).First(&client).Error; err != nil {
+					return err
+				}
+
+				// Nobody keeps access through an app that no longer exists
+				if err := tx.Model(&entities.OAuthToken{}).
+					Where("client_uid = ? AND revoked_at IS NULL", client.Uid).
+					Update("revoked_at", time.Now().UTC()).Error; err != nil {
+					return err
+				}
+				if err := tx.Where("client_uid = ?", client.Uid).Delete(&entities.OAuthAuthorizationRequest{}).Error; err != nil {
+					return err
+				}
+
+				return tx.Delete(&client).Error
+			})
+
+			if err != nil {
+				notFound(res, req, err)
+				return
+			}
+
+			logger.Info("oauth client deleted", slog.String("client_uid", chi.URLParam(req, "uid")))
+			res.WriteHeader(http.StatusNoContent)
+		})
+
+		r.Post("/{uid}/secret", func(res http.ResponseWriter, req *http.Request) {
+			var client entities.OAuthClientWithSecret
+			if err := db.Where("uid = ?", chi.URLParam(req, "uid")).First(&client).Error; err != nil {
+				notFound(res, req, err)
+				return
+			}
+
+			if !client.Confidential {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Public clients don't have a secret"})
+				return
+			}
+
+			secret, hash := newOAuthClientSecret()
+			if err := db.Model(&client).Update("secret_hash", hash).Error; err != nil {
+				notFound(res, req, err)
+				return
+			}
+
+			logger.Info("oauth client secret rotated", slog.String("client_uid", client.Uid))
+			render.JSON(res, req, dto.OAuthClientSecretResponse{Client: client.DTO(), ClientSecret: &secret})
+		})
+	}
+}
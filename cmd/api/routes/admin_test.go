@@ -38,9 +38,37 @@ func newTestDB(t *testing.T) *gorm.DB {
 		&entities.APIKey{},
 		&entities.DownloadToken{},
 		&entities.WorkerJob{},
+		&entities.JobBatch{},
+		&entities.JobAuditEntry{},
+		&entities.UserTOTP{},
+		&entities.RecoveryCode{},
+		&entities.LoginChallenge{},
+		&entities.PasskeyWithCredential{},
+		&entities.WebAuthnCeremony{},
+		&entities.UserIdentity{},
+		&entities.OIDCLoginState{},
+		&entities.EmailToken{},
+		&entities.SecurityEvent{},
+		&entities.CollectionShare{},
+		&entities.Group{},
+		&entities.GroupMember{},
 		&entities.UserWithPassword{},
+		&entities.SessionWithToken{},
+		&entities.OAuthClientWithSecret{},
+		&entities.OAuthAuthorizationRequest{},
+		&entities.OAuthToken{},
+		&entities.ShareGuestWithKey{},
+		&entities.ProofingMark{},
+		&entities.ProofingComment{},
 		&entities.SettingDefault{},
 		&entities.SettingOverride{},
+		&entities.DownloadLog{},
+		&entities.ExportArchive{},
+		&entities.FederationPeer{},
+		&entities.CollectionMirror{},
+		&entities.UploadLink{},
+		&entities.AnalyticsEvent{},
+		&entities.AnalyticsDailyStat{},
 	)
 	assert.NoError(t, err)
 	return db
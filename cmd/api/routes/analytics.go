@@ -0,0 +1,302 @@
+package routes
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+
+	"viz/internal/analytics"
+	"viz/internal/dto"
+	"viz/internal/entities"
+	libhttp "viz/internal/http"
+	"viz/internal/imageops"
+	"viz/internal/transform"
+)
+
+const (
+	analyticsDefaultDays = 30
+	analyticsMaxDays     = 366
+)
+
+var errAnalyticsNotFound = errors.New("nothing of the user's to show analytics for")
+
+// recordImageFile counts a request for img's file as a view, or a download.
+// Thumbnails aren't views, since galleries load one for every image, and
+// owners looking at their own images aren't counted.
+func recordImageFile(recorder *analytics.Recorder, req *http.Request, img *entities.ImageAsset, params *transform.TransformParams, isDownload bool, collectionUid, shareToken string) {
+	if recorder == nil {
+		return
+	}
+
+	if user := requestUser(req); user != nil && img.OwnerID != nil && *img.OwnerID == user.Uid {
+		return
+	}
+
+	kind := analytics.KindView
+	if isDownload {
+		kind = analytics.KindDownload
+	} else if thumb, err := imageops.ParseTransformParams(img.ImagePaths.Thumbnail); err == nil && *thumb == *params {
+		return
+	}
+
+	recorder.Record(analytics.Event{
+		Kind:          kind,
+		ImageUid:      img.Uid,
+		CollectionUid: collectionUid,
+		ShareToken:    shareToken,
+		IP:            libhttp.ClientIP(req, libhttp.TrustProxyHeaders),
+	})
+}
+
+// recordDownloads counts a download of each of uids, e.g. in a zip.
+func recordDownloads(recorder *analytics.Recorder, req *http.Request, uids []string, collectionUid, shareToken string) {
+	if recorder == nil {
+		return
+	}
+
+	ip := libhttp.ClientIP(req, libhttp.TrustProxyHeaders)
+	for _, uid := range uids {
+		recorder.Record(analytics.Event{
+			Kind:          analytics.KindDownload,
+			ImageUid:      uid,
+			CollectionUid: collectionUid,
+			ShareToken:    shareToken,
+			IP:            ip,
+		})
+	}
+}
+
+// recordCollectionView counts collection being opened, unless by its owner.
+func recordCollectionView(recorder *analytics.Recorder, req *http.Request, collection *entities.Collection, shareToken string) {
+	if recorder == nil {
+		return
+	}
+
+	if user := requestUser(req); user != nil && collection.OwnerID != nil && *collection.OwnerID == user.Uid {
+		return
+	}
+
+	recorder.Record(analytics.Event{
+		Kind:          analytics.KindView,
+		CollectionUid: collection.Uid,
+		ShareToken:    shareToken,
+		IP:            libhttp.ClientIP(req, libhttp.TrustProxyHeaders),
+	})
+}
+
+// analyticsRange reads the from and to query params, which default to the
+// last 30 days. It writes the error response itself when it returns false.
+func analyticsRange(res http.ResponseWriter, req *http.Request) (analytics.Range, bool) {
+	query := req.URL.Query()
+	r := analytics.Range{To: time.Now().UTC().Truncate(24 * time.Hour)}
+
+	var err error
+	if to := query.Get("to"); to != "" {
+		r.To, err = time.Parse(analytics.DayFormat, to)
+	}
+
+	if from := query.Get("from"); err == nil && from != "" {
+		r.From, err = time.Parse(analytics.DayFormat, from)
+	} else {
+		r.From = r.To.AddDate(0, 0, -(analyticsDefaultDays - 1))
+	}
+
+	if err != nil || r.From.After(r.To) || r.To.Sub(r.From) >= analyticsMaxDays*24*time.Hour {
+		render.Status(req, http.StatusBadRequest)
+		render.JSON(res, req, dto.ErrorResponse{Error: "from and to must be dates as YYYY-MM-DD, at most a year apart"})
+		return r, false
+	}
+
+	return r, true
+}
+
+// AnalyticsRouter serves the views and downloads of what the signed in user
+// owns. Counts come from the daily rollups, so they can be a rollup interval
+// behind.
+func AnalyticsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
+	router := chi.NewRouter()
+
+	writeError := func(res http.ResponseWriter, req *http.Request, err error) {
+		if errors.Is(err, errAnalyticsNotFound) {
+			render.Status(req, http.StatusNotFound)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Image, collection or share link not found"})
+			return
+		}
+
+		libhttp.ServerError(res, req, err, logger, nil,
+			"failed to get analytics",
+			"Something went wrong, please try again later",
+		)
+	}
+
+	router.Get("/images/top", func(res http.ResponseWriter, req *http.Request) {
+		r, ok := analyticsRange(res, req)
+		if !ok {
+			return
+		}
+
+		by := analytics.Kind(req.URL.Query().Get("by"))
+		if by == "" {
+			by = analytics.KindView
+		} else if by != analytics.KindView && by != analytics.KindDownload {
+			render.Status(req, http.StatusBadRequest)
+			render.JSON(res, req, dto.ErrorResponse{Error: "by must be view or download"})
+			return
+		}
+
+		limit, err := strconv.Atoi(req.URL.Query().Get("limit"))
+		if err != nil || limit <= 0 {
+			limit = 20
+		}
+		limit = min(limit, 100)
+
+		authUser := requestUser(req)
+		totals, err := analytics.TopImages(db, authUser.Uid, r, by, limit)
+		if err != nil {
+			writeError(res, req, err)
+			return
+		}
+
+		var imgs []entities.ImageAsset
+		uids := lo.Map(totals, func(t analytics.ImageTotals, _ int) string { return t.ImageUid })
+		if err := db.Where("uid IN ?", uids).Find(&imgs).Error; err != nil {
+			writeError(res, req, err)
+			return
+		}
+		byUid := lo.KeyBy(imgs, func(img entities.ImageAsset) string { return img.Uid })
+
+		items := make([]dto.AnalyticsImageStat, 0, len(totals))
+		for _, t := range totals {
+			img, ok := byUid[t.ImageUid]
+			if !ok {
+				continue
+			}
+
+			items = append(items, dto.AnalyticsImageStat{
+				ImageUid:   img.Uid,
+				Name:       img.Name,
+				ImagePaths: img.ImagePaths,
+				Views:      t.Views,
+				Downloads:  t.Downloads,
+				Visitors:   t.Visitors,
+			})
+		}
+
+		render.JSON(res, req, dto.AnalyticsTopImages{
+			From:  r.From.Format(analytics.DayFormat),
+			To:    r.To.Format(analytics.DayFormat),
+			Items: items,
+		})
+	})
+
+	router.Get("/shares", func(res http.ResponseWriter, req *http.Request) {
+		r, ok := analyticsRange(res, req)
+		if !ok {
+			return
+		}
+
+		authUser := requestUser(req)
+		totals, err := analytics.ShareStats(db, authUser.Uid, r)
+		if err != nil {
+			writeError(res, req, err)
+			return
+		}
+
+		var tokens []entities.DownloadToken
+		uids := lo.Map(totals, func(t analytics.ShareTotals, _ int) string { return t.ShareToken })
+		if err := db.Where("uid IN ?", uids).Find(&tokens).Error; err != nil {
+			writeError(res, req, err)
+			return
+		}
+		byUid := lo.KeyBy(tokens, func(token entities.DownloadToken) string { return token.Uid })
+
+		items := make([]dto.AnalyticsShareStat, 0, len(totals))
+		for _, t := range totals {
+			token, ok := byUid[t.ShareToken]
+			if !ok {
+				continue
+			}
+
+			items = append(items, dto.AnalyticsShareStat{
+				TokenUid:      token.Uid,
+				Description:   token.Description,
+				CollectionUid: token.CollectionUid,
+				Views:         t.Views,
+				Downloads:     t.Downloads,
+				Visitors:      t.Visitors,
+			})
+		}
+
+		render.JSON(res, req, dto.AnalyticsShareStats{
+			From:  r.From.Format(analytics.DayFormat),
+			To:    r.To.Format(analytics.DayFormat),
+			Items: items,
+		})
+	})
+
+	router.Get("/timeseries", func(res http.ResponseWriter, req *http.Request) {
+		r, ok := analyticsRange(res, req)
+		if !ok {
+			return
+		}
+
+		query := req.URL.Query()
+		authUser := requestUser(req)
+		filter := analytics.Filter{
+			ImageUid:      query.Get("image_uid"),
+			CollectionUid: query.Get("collection_uid"),
+			ShareToken:    query.Get("share_token"),
+			OwnerUid:      authUser.Uid,
+		}
+
+		// Only what the user owns can be looked at, anything else isn't found
+		var err error
+		switch {
+		case filter.ImageUid != "":
+			err = db.Where("uid = ? AND owner_id = ?", filter.ImageUid, authUser.Uid).First(&entities.ImageAsset{}).Error
+		case filter.CollectionUid != "":
+			err = db.Where("uid = ? AND owner_id = ?", filter.CollectionUid, authUser.Uid).First(&entities.Collection{}).Error
+		case filter.ShareToken != "":
+			err = db.Where("uid = ? AND created_by_id = ?", filter.ShareToken, authUser.Uid).First(&entities.DownloadToken{}).Error
+		}
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = errAnalyticsNotFound
+		}
+
+		var series []analytics.DayTotals
+		if err == nil {
+			series, err = analytics.TimeSeries(db, filter, r)
+		}
+
+		if err != nil {
+			writeError(res, req, err)
+			return
+		}
+
+		points := make([]dto.AnalyticsTimeSeriesPoint, len(series))
+		for i, day := range series {
+			points[i] = dto.AnalyticsTimeSeriesPoint{
+				Date:      day.Day,
+				Views:     day.Views,
+				Downloads: day.Downloads,
+				Visitors:  day.Visitors,
+			}
+		}
+
+		render.JSON(res, req, dto.AnalyticsTimeSeries{
+			From:   r.From.Format(analytics.DayFormat),
+			To:     r.To.Format(analytics.DayFormat),
+			Points: points,
+		})
+	})
+
+	return router
+}
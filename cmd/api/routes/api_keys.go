@@ -8,12 +8,14 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
+	"github.com/samber/lo"
 	"gorm.io/gorm"
 
 	"viz/internal/auth"
 	"viz/internal/dto"
 	"viz/internal/entities"
 	libhttp "viz/internal/http"
+	"viz/internal/policy"
 	"viz/internal/uid"
 )
 
@@ -38,7 +40,7 @@ func APIKeysRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
         }
 
         var existingCount int64
-        if err := db.Model(&entities.APIKey{}).Where("user_uid = ?", authUser.Uid).Count(&existingCount).Error; err == nil {
+        if err := db.Model(&entities.APIKey{}).Where("user_id = ?", authUser.Uid).Count(&existingCount).Error; err == nil {
             if existingCount >= 50 {
                 render.Status(req, http.StatusTooManyRequests)
                 render.JSON(res, req, dto.ErrorResponse{Error: "API key limit reached"})
@@ -76,6 +78,16 @@ func APIKeysRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
             Description: body.Description,
             Scopes:      scopes,
             ExpiresAt:   body.ExpiresAt,
+            ReadOnly:    body.ReadOnly,
+        }
+
+        if msg, err := applyAPIKeyConstraints(db, authUser, &apiEnt, body); err != nil {
+            libhttp.ServerError(res, req, err, logger, nil, "failed to check api key constraints", "Failed to create API key")
+            return
+        } else if msg != "" {
+            render.Status(req, http.StatusBadRequest)
+            render.JSON(res, req, dto.ErrorResponse{Error: msg})
+            return
         }
 
         if err := db.Transaction(func(tx *gorm.DB) error {
@@ -104,7 +116,7 @@ func APIKeysRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
         var keys []entities.APIKey
         q := db.Order("created_at desc").Model(&entities.APIKey{})
         if authUser.Role != "admin" && authUser.Role != "superadmin" {
-            q = q.Where("user_uid = ?", authUser.Uid)
+            q = q.Where("user_id = ?", authUser.Uid)
         }
 
         if err := q.Find(&keys).Error; err != nil {
@@ -133,7 +145,7 @@ func APIKeysRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
         var ent entities.APIKey
         q := db.Where("uid = ?", keyUid).Preload("User")
         if authUser.Role != "admin" && authUser.Role != "superadmin" {
-            q = q.Where("user_uid = ?", authUser.Uid)
+            q = q.Where("user_id = ?", authUser.Uid)
         }
 
         if err := q.First(&ent).Error; err != nil {
@@ -164,7 +176,7 @@ func APIKeysRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
         if err := db.Transaction(func(tx *gorm.DB) error {
             tq := tx.Model(&entities.APIKey{}).Where("uid = ?", keyUid)
             if authUser.Role != "admin" && authUser.Role != "superadmin" {
-                tq = tq.Where("user_uid = ?", authUser.Uid)
+                tq = tq.Where("user_id = ?", authUser.Uid)
             }
 
             if err := tq.Updates(updates).Error; err != nil {
@@ -195,7 +207,7 @@ func APIKeysRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
         var existing entities.APIKey
         q := db.Where("uid = ?", keyUid).Model(&entities.APIKey{}).Preload("User")
         if authUser.Role != "admin" && authUser.Role != "superadmin" {
-            q = q.Where("user_uid = ?", authUser.Uid)
+            q = q.Where("user_id = ?", authUser.Uid)
         }
 		
         if err := q.First(&existing).Error; err != nil {
@@ -239,6 +251,12 @@ func APIKeysRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
                 Description: existing.Description,
                 Scopes:      existing.Scopes,
                 ExpiresAt:   existing.ExpiresAt,
+
+                AllowedCollections: existing.AllowedCollections,
+                AllowedCidrs:       existing.AllowedCidrs,
+                ReadOnly:           existing.ReadOnly,
+                QuotaLimit:         existing.QuotaLimit,
+                QuotaPeriod:        existing.QuotaPeriod,
             }
 
             if err := tx.Create(&apiEnt).Error; err != nil {
@@ -275,7 +293,7 @@ func APIKeysRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
         if err := db.Transaction(func(tx *gorm.DB) error {
             tq := tx.Where("uid = ?", keyUid)
             if authUser.Role != "admin" && authUser.Role != "superadmin" {
-                tq = tq.Where("user_uid = ?", authUser.Uid)
+                tq = tq.Where("user_id = ?", authUser.Uid)
             }
             if err := tq.Delete(&entities.APIKey{}).Error; err != nil {
                 return err
@@ -292,3 +310,61 @@ func APIKeysRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 
     return r
 }
+
+// applyAPIKeyConstraints checks the constraints in body and sets them on
+// key. It returns a message for the user if they don't hold up.
+func applyAPIKeyConstraints(db *gorm.DB, user *entities.User, key *entities.APIKey, body dto.APIKeyCreate) (string, error) {
+	if uids := lo.Uniq(lo.FromPtr(body.AllowedCollections)); len(uids) > 0 {
+		// Only collections the user can see themselves
+		var count int64
+		err := db.Model(&entities.Collection{}).
+			Scopes(policy.VisibleCollections(user)).
+			Where("collections.uid IN ?", uids).
+			Count(&count).Error
+		if err != nil {
+			return "", err
+		}
+
+		if count != int64(len(uids)) {
+			return "One or more collections not found", nil
+		}
+
+		key.AllowedCollections = &uids
+	}
+
+	if ranges := lo.FromPtr(body.AllowedCidrs); len(ranges) > 0 {
+		cidrs := make([]string, 0, len(ranges))
+		for _, r := range ranges {
+			cidr, err := libhttp.ParseCIDR(r)
+			if err != nil {
+				return err.Error(), nil
+			}
+			cidrs = append(cidrs, cidr)
+		}
+
+		cidrs = lo.Uniq(cidrs)
+		key.AllowedCidrs = &cidrs
+	}
+
+	if (body.QuotaLimit == nil) != (body.QuotaPeriod == nil) {
+		return "quota_limit and quota_period must be set together", nil
+	}
+
+	if body.QuotaLimit != nil {
+		period := dto.APIKeyQuotaPeriod(*body.QuotaPeriod)
+		switch period {
+		case dto.APIKeyQuotaPeriodHour, dto.APIKeyQuotaPeriodDay, dto.APIKeyQuotaPeriodMonth:
+		default:
+			return "quota_period must be hour, day or month", nil
+		}
+
+		if *body.QuotaLimit < 1 {
+			return "quota_limit must be at least 1", nil
+		}
+
+		key.QuotaLimit = body.QuotaLimit
+		key.QuotaPeriod = &period
+	}
+
+	return "", nil
+}
@@ -25,8 +25,7 @@ import (
 	"viz/internal/dto"
 	"viz/internal/entities"
 	libhttp "viz/internal/http"
-	"viz/internal/uid"
-	"viz/internal/utils"
+	"viz/internal/mail"
 )
 
 type VizAuthCodeFlow struct {
@@ -39,13 +38,14 @@ type VizAuthPasswordFlow struct {
 	State string
 }
 
-func AuthRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
+func AuthRouter(db *gorm.DB, logger *slog.Logger, mailer mail.Mailer, limiter *libhttp.Limiter) *chi.Mux {
 	router := chi.NewRouter()
-	router.Post("/login", func(res http.ResponseWriter, req *http.Request) {
+	router.With(limiter.Throttle(rateLimitScopeLogin)).Post("/login", func(res http.ResponseWriter, req *http.Request) {
 		// Accept minimal login payload to avoid coupling to entities
 		var login struct {
-			Email    string `json:"email"`
-			Password string `json:"password"`
+			Email      string `json:"email"`
+			Password   string `json:"password"`
+			RememberMe bool   `json:"remember_me"`
 		}
 
 		err := render.DecodeJSON(req.Body, &login)
@@ -63,19 +63,26 @@ func AuthRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			return
 		}
 
+		rateLimitKeys := []string{limiter.IPKey(req), libhttp.AccountKey(login.Email)}
+		if wait := limiter.Check(req.Context(), rateLimitScopeLogin, rateLimitKeys...); wait > 0 {
+			libhttp.TooManyRequests(res, req, wait)
+			return
+		}
+
 		// Fetch password hash and uid directly from users table by email
 		var row struct {
-			UID      string
-			Password string
+			UID              string
+			Password         string
+			Role             string
+			TwoFactorEnabled bool
 		}
 
-		tx := db.Model(&entities.User{}).Select("uid, password").Where("email = ?", login.Email).Scan(&row)
-		if tx.Error != nil || row.Password == "" {
-			if tx.Error == gorm.ErrRecordNotFound || row.Password == "" {
-				render.Status(req, http.StatusNotFound)
-				render.JSON(res, req, dto.ErrorResponse{Error: "Cannot find user with provided email"})
-				return
-			}
+		tx := db.Model(&entities.User{}).Select("uid, password, role, two_factor_enabled").Where("email = ?", login.Email).Scan(&row)
+		if tx.Error != nil {
+			libhttp.ServerError(res, req, tx.Error, logger, nil,
+				"failed to look up user",
+				"Something went wrong while signing you in. Please try again.",
+			)
 			return
 		}
 
@@ -85,37 +92,64 @@ func AuthRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			Threads:  config.AppConfig.Security.Argon2Threads,
 		}
 
-		isValidPass, err := crypto.VerifyPassword(row.Password, login.Password, argonParams)
-		if err != nil {
-			render.Status(req, http.StatusInternalServerError)
-			render.JSON(res, req, dto.ErrorResponse{Error: "Failed to verify password"})
-			return
+		// An unknown email and a wrong password get the same answer in the
+		// same time, so this can't be used to find out who has an account.
+		isValidPass := false
+		if row.Password == "" {
+			burnPasswordCheck(login.Password, argonParams)
+		} else {
+			isValidPass, err = crypto.VerifyPassword(row.Password, login.Password, argonParams)
+			if err != nil {
+				render.Status(req, http.StatusInternalServerError)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Failed to verify password"})
+				return
+			}
 		}
 
 		if !isValidPass {
+			limiter.Failure(req, rateLimitScopeLogin, rateLimitKeys...)
 			render.Status(req, http.StatusUnauthorized)
-			render.JSON(res, req, dto.ErrorResponse{Error: "Invalid password"})
+			render.JSON(res, req, dto.ErrorResponse{Error: "Invalid email or password"})
 			return
 		}
 
-		// Create auth token and persistent session
-		authToken := auth.GenerateAuthToken()
-		expiryTime := carbon.Now().AddYear().StdTime()
-		http.SetCookie(res, libhttp.CreateAuthTokenCookie(expiryTime, authToken))
+		// The IP keeps its count: one valid account shouldn't buy it more
+		// guesses at the others.
+		limiter.Success(req.Context(), rateLimitScopeLogin, libhttp.AccountKey(login.Email))
+
+		// With two-factor enabled the password alone doesn't get a session,
+		// just a challenge to exchange at /login/2fa.
+		if row.TwoFactorEnabled {
+			token, expiresAt, err := issueLoginChallenge(db, row.UID, login.RememberMe)
+			if err != nil {
+				libhttp.ServerError(res, req, err, logger, nil,
+					"failed to create login challenge",
+					"Something went wrong while signing you in. Please try again.",
+				)
+				return
+			}
 
-		// Persist session for server-side validation
-		lastActive := time.Now()
-		sess := entities.Session{
-			Token:      authToken,
-			Uid:        uid.MustGenerate(),
-			UserUid:    row.UID,
-			ClientIp:   &req.RemoteAddr,
-			UserAgent:  utils.StringPtr(req.UserAgent()),
-			LastActive: &lastActive,
-			ExpiresAt:  &expiryTime,
+			methods, err := secondFactorMethods(db, row.UID)
+			if err != nil {
+				libhttp.ServerError(res, req, err, logger, nil,
+					"failed to list second factors",
+					"Something went wrong while signing you in. Please try again.",
+				)
+				return
+			}
+
+			render.Status(req, http.StatusOK)
+			render.JSON(res, req, dto.LoginResult{
+				Message:            "Two-factor authentication required",
+				TwoFactorRequired:  true,
+				ChallengeToken:     &token,
+				ChallengeExpiresAt: &expiresAt,
+				TwoFactorMethods:   &methods,
+			})
+			return
 		}
 
-		if err := db.Create(&sess).Error; err != nil {
+		if _, err := createSession(db, res, req, row.UID, login.RememberMe); err != nil {
 			libhttp.ServerError(res, req, err, logger, nil,
 				"failed to create session",
 				"Something went wrong while signing you in. Please try again.",
@@ -123,11 +157,205 @@ func AuthRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			return
 		}
 
+		response := dto.LoginResult{Message: "User authenticated"}
+		if libhttp.TwoFactorRequired(&entities.User{Role: dto.UserRole(row.Role)}) {
+			setupRequired := true
+			response.TwoFactorSetupRequired = &setupRequired
+		}
+
 		logger.Info("user authenticated", slog.String("request_id", libhttp.GetRequestID(req)))
 		render.Status(req, http.StatusOK)
-		render.JSON(res, req, dto.MessageResponse{Message: "User authenticated"})
+		render.JSON(res, req, response)
 	})
 
+	router.With(limiter.Throttle(rateLimitScopeTwoFactor)).Post("/login/2fa", func(res http.ResponseWriter, req *http.Request) {
+		var body dto.LoginTwoFactorRequest
+		if err := render.DecodeJSON(req.Body, &body); err != nil {
+			render.Status(req, http.StatusBadRequest)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Invalid request body"})
+			return
+		}
+
+		var factor secondFactor
+		if body.Code != nil {
+			factor.Code = *body.Code
+		}
+		if body.RecoveryCode != nil {
+			factor.RecoveryCode = *body.RecoveryCode
+		}
+		if body.CeremonyId != nil && body.Credential != nil {
+			factor.CeremonyID = *body.CeremonyId
+			factor.Credential = *body.Credential
+		}
+
+		if body.ChallengeToken == "" || (factor.Code == "" && factor.RecoveryCode == "" && factor.CeremonyID == "") {
+			render.Status(req, http.StatusBadRequest)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Required fields are missing"})
+			return
+		}
+
+		challenge, err := findLoginChallenge(db, body.ChallengeToken)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				render.Status(req, http.StatusUnauthorized)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Login challenge is invalid or has expired"})
+				return
+			}
+
+			libhttp.ServerError(res, req, err, logger, nil,
+				"failed to get login challenge",
+				"Something went wrong while signing you in. Please try again.",
+			)
+			return
+		}
+
+		// Each challenge allows a few guesses; this limits how many a
+		// client can get by signing in again.
+		rateLimitKeys := []string{limiter.IPKey(req), libhttp.AccountKey(challenge.UserUid)}
+		if wait := limiter.Check(req.Context(), rateLimitScopeTwoFactor, rateLimitKeys...); wait > 0 {
+			libhttp.TooManyRequests(res, req, wait)
+			return
+		}
+
+		// Count the attempt before checking the code so concurrent guesses
+		// can't get past the limit.
+		attempt := db.Model(&entities.LoginChallenge{}).
+			Where("id = ? AND attempts < ?", challenge.ID, loginChallengeMaxAttempts).
+			Update("attempts", gorm.Expr("attempts + 1"))
+
+		if attempt.Error != nil {
+			libhttp.ServerError(res, req, attempt.Error, logger, nil,
+				"failed to update login challenge",
+				"Something went wrong while signing you in. Please try again.",
+			)
+			return
+		}
+
+		if attempt.RowsAffected == 0 {
+			db.Delete(challenge)
+			render.Status(req, http.StatusUnauthorized)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Too many attempts, please sign in again"})
+			return
+		}
+
+		if err := verifySecondFactor(db, challenge.UserUid, factor); err != nil {
+			if errors.Is(err, errInvalidSecondFactor) {
+				limiter.Failure(req, rateLimitScopeTwoFactor, rateLimitKeys...)
+				render.Status(req, http.StatusUnauthorized)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Invalid code"})
+				return
+			}
+
+			libhttp.ServerError(res, req, err, logger, nil,
+				"failed to verify two-factor code",
+				"Something went wrong while signing you in. Please try again.",
+			)
+			return
+		}
+
+		limiter.Success(req.Context(), rateLimitScopeTwoFactor, libhttp.AccountKey(challenge.UserUid))
+
+		// Deleting is what spends the challenge; if another request got
+		// there first, it already has the session.
+		spent := db.Delete(challenge)
+		if spent.Error != nil || spent.RowsAffected == 0 {
+			render.Status(req, http.StatusUnauthorized)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Login challenge is invalid or has expired"})
+			return
+		}
+
+		if _, err := createSession(db, res, req, challenge.UserUid, challenge.RememberMe); err != nil {
+			libhttp.ServerError(res, req, err, logger, nil,
+				"failed to create session",
+				"Something went wrong while signing you in. Please try again.",
+			)
+			return
+		}
+
+		logger.Info("user authenticated with two-factor", slog.String("request_id", libhttp.GetRequestID(req)))
+		render.Status(req, http.StatusOK)
+		render.JSON(res, req, dto.LoginResult{Message: "User authenticated"})
+	})
+
+	router.Post("/login/2fa/passkey", func(res http.ResponseWriter, req *http.Request) {
+		var body dto.PasskeySecondFactorRequest
+		if err := render.DecodeJSON(req.Body, &body); err != nil || body.ChallengeToken == "" {
+			render.Status(req, http.StatusBadRequest)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Required fields are missing"})
+			return
+		}
+
+		challenge, err := findLoginChallenge(db, body.ChallengeToken)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				render.Status(req, http.StatusUnauthorized)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Login challenge is invalid or has expired"})
+				return
+			}
+
+			libhttp.ServerError(res, req, err, logger, nil,
+				"failed to get login challenge",
+				"Something went wrong while signing you in. Please try again.",
+			)
+			return
+		}
+
+		w, err := newWebAuthn()
+		if err != nil {
+			libhttp.ServerError(res, req, err, logger, nil, "webauthn is misconfigured", "Passkeys are not available on this server")
+			return
+		}
+
+		passkeyUser, err := loadPasskeyUser(db, challenge.UserUid)
+		if err != nil {
+			libhttp.ServerError(res, req, err, logger, nil,
+				"failed to load passkeys",
+				"Something went wrong while signing you in. Please try again.",
+			)
+			return
+		}
+
+		if len(passkeyUser.Credentials) == 0 {
+			render.Status(req, http.StatusBadRequest)
+			render.JSON(res, req, dto.ErrorResponse{Error: "No passkeys are registered for this account"})
+			return
+		}
+
+		assertion, session, err := w.BeginLogin(passkeyUser)
+		if err != nil {
+			libhttp.ServerError(res, req, err, logger, nil,
+				"failed to begin passkey login",
+				"Something went wrong while signing you in. Please try again.",
+			)
+			return
+		}
+
+		ceremonyID, expiresAt, err := startPasskeyCeremony(db, passkeyPurposeSecondFactor, challenge.UserUid, "", session)
+		if err != nil {
+			libhttp.ServerError(res, req, err, logger, nil,
+				"failed to save passkey ceremony",
+				"Something went wrong while signing you in. Please try again.",
+			)
+			return
+		}
+
+		options, err := jsonMap(assertion)
+		if err != nil {
+			libhttp.ServerError(res, req, err, logger, nil,
+				"failed to encode passkey options",
+				"Something went wrong while signing you in. Please try again.",
+			)
+			return
+		}
+
+		render.JSON(res, req, dto.PasskeyCeremony{CeremonyId: ceremonyID, Options: options, ExpiresAt: expiresAt})
+	})
+
+	router.Route("/passkey", passkeyLoginRoutes(db, logger))
+	router.Route("/oidc", oidcRoutes(db, logger))
+	router.With(limiter.Throttle(rateLimitScopeAccount)).Route("/password", passwordResetRoutes(db, logger, mailer))
+	router.Post("/email/verify", verifyEmailHandler(db, logger, mailer))
+
 	router.Get("/session", func(res http.ResponseWriter, req *http.Request) {
 		var userSession entities.Session
 		cookieToken, err := req.Cookie(libhttp.AuthTokenCookie)
@@ -146,14 +374,21 @@ func AuthRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			return
 		}
 		
-		err = db.Where("token = ?", cookieToken.Value).First(&userSession).Error
+		found, err := libhttp.FindSession(db, cookieToken.Value)
 		if err != nil {
-			if err == gorm.ErrRecordNotFound {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
 				render.Status(req, http.StatusUnauthorized)
 				render.JSON(res, req, dto.ErrorResponse{Error: "Session not found"})
 				return
 			}
 
+			if errors.Is(err, libhttp.ErrSessionExpired) {
+				libhttp.ClearCookie(libhttp.AuthTokenCookie, res)
+				render.Status(req, http.StatusUnauthorized)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Session expired"})
+				return
+			}
+
 			libhttp.ServerError(res, req, err, logger, nil,
 				"failed to get session",
 				"Something went wrong, please try again later",
@@ -161,28 +396,13 @@ func AuthRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			return
 		}
 
-		if userSession.ExpiresAt != nil && userSession.ExpiresAt.Before(time.Now()) {
-			db.Delete(&userSession)
-			libhttp.ClearCookie(libhttp.AuthTokenCookie, res)
-			render.Status(req, http.StatusUnauthorized)
-			render.JSON(res, req, dto.ErrorResponse{Error: "Session expired"})
-			return
-		}
-
-		// Async debounce update of LastActive
-		if userSession.LastActive == nil || time.Since(*userSession.LastActive) > 5*time.Minute {
-			// Capture needed vars for goroutine
-			uid := userSession.Uid
-			go func() {
-				if err := db.Model(&entities.Session{}).Where("uid = ?", uid).Update("last_active", time.Now()).Error; err != nil {
-					logger.Error("failed to update session last_active", slog.Any("error", err))
-				}
-			}()
-		}
+		userSession = found.Session
+		libhttp.TouchSession(db, &userSession, libhttp.ClientIP(req, false), logger)
 
 		var user entities.User
 		if err := db.Where("uid = ?", userSession.UserUid).First(&user).Error; err == nil {
-			libhttp.SetSessionCache(cookieToken.Value, &user, userSession.ExpiresAt)
+			expiry := libhttp.SessionExpiry(&userSession)
+			libhttp.SetSessionCache(libhttp.HashSessionToken(cookieToken.Value), &user, &expiry)
 		}
 
 		lastActiveNano := int64(0)
@@ -340,14 +560,12 @@ func AuthRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 	router.Post("/logout", func(res http.ResponseWriter, req *http.Request) {
 		if cookie, err := req.Cookie(libhttp.AuthTokenCookie); err == nil && cookie.Value != "" {
 			// don't fail the logout if DB delete errors
-			tx := db.Where("token = ?", cookie.Value).Delete(&entities.Session{})
-			if tx.Error != nil {
-				logger.Warn("failed to delete session on logout", slog.String("request_id", libhttp.GetRequestID(req)), slog.Any("error", tx.Error))
+			// Also invalidates the in-memory cache for this session token so other
+			// requests don't continue using a now-deleted session until their cache
+			// entry expires.
+			if err := deleteSessions(db, "token_hash = ?", libhttp.HashSessionToken(cookie.Value)); err != nil {
+				logger.Warn("failed to delete session on logout", slog.String("request_id", libhttp.GetRequestID(req)), slog.Any("error", err))
 			}
-
-			// Invalidate any in-memory cache for this session token so other requests
-			// don't continue using a now-deleted session until their cache entry expires.
-			libhttp.ClearSessionCache(cookie.Value)
 		}
 
 		// clear anything related to auth in the browser. even stuff that may linger
@@ -0,0 +1,273 @@
+package routes
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+
+	"viz/internal/auth"
+	"viz/internal/dto"
+	"viz/internal/entities"
+	libhttp "viz/internal/http"
+	"viz/internal/policy"
+	"viz/internal/uid"
+)
+
+var (
+	errShareNotFound        = errors.New("share not found")
+	errShareUserNotFound    = errors.New("user to share with not found")
+	errCannotShareWithOwner = errors.New("cannot share a collection with its owner")
+)
+
+// writeCollectionShareError answers for the errors the share routes return.
+func writeCollectionShareError(res http.ResponseWriter, req *http.Request, logger *slog.Logger, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		render.Status(req, http.StatusNotFound)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Collection not found"})
+	case errors.Is(err, errShareNotFound):
+		render.Status(req, http.StatusNotFound)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Share not found"})
+	case errors.Is(err, ErrCollectionUnauthorised):
+		render.Status(req, http.StatusForbidden)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Only the owner can share this collection"})
+	default:
+		libhttp.ServerError(res, req, err, logger, nil,
+			"failed to update collection shares",
+			"Something went wrong, please try again later",
+		)
+	}
+}
+
+// findShare gets share shareUid of collection collectionUid.
+func findShare(tx *gorm.DB, collectionUid, shareUid string) (entities.CollectionShare, error) {
+	var share entities.CollectionShare
+	err := tx.Preload("User").Preload("Group").Where("uid = ? AND collection_uid = ?", shareUid, collectionUid).First(&share).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return share, errShareNotFound
+	}
+	return share, err
+}
+
+// collectionShareRoutes serves /collections/{uid}/shares. Anyone a collection
+// is shared with can see who else it is shared with; only its owners change
+// that, though anyone can leave a collection shared with them directly.
+func collectionShareRoutes(db *gorm.DB, logger *slog.Logger) func(r chi.Router) {
+	return func(r chi.Router) {
+		manage := r.With(libhttp.ScopeMiddleware([]auth.Scope{auth.CollectionsShareScope}))
+
+		r.Get("/", func(res http.ResponseWriter, req *http.Request) {
+			var shares []entities.CollectionShare
+
+			err := db.Transaction(func(tx *gorm.DB) error {
+				collection, _, err := loadCollection(tx, req, chi.URLParam(req, "uid"), policy.Viewer)
+				if err != nil {
+					return err
+				}
+
+				return tx.Preload("User").Preload("Group").Where("collection_uid = ?", collection.Uid).Order("created_at").Find(&shares).Error
+			})
+
+			if err != nil {
+				// Public visitors don't get to see who else has access
+				if errors.Is(err, ErrCollectionUnauthorised) {
+					err = gorm.ErrRecordNotFound
+				}
+
+				writeCollectionShareError(res, req, logger, err)
+				return
+			}
+
+			items := make([]dto.CollectionShare, len(shares))
+			for i := range shares {
+				items[i] = shares[i].DTO()
+			}
+
+			render.JSON(res, req, dto.CollectionShareList{Items: items})
+		})
+
+		manage.Post("/", func(res http.ResponseWriter, req *http.Request) {
+			var body dto.CollectionShareCreate
+			err := render.DecodeJSON(req.Body, &body)
+			userUid, groupUid := lo.FromPtr(body.UserUid), lo.FromPtr(body.GroupUid)
+			if err != nil || (userUid == "") == (groupUid == "") {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "A role and either a user or a group are required"})
+				return
+			}
+
+			role := dto.CollectionShareRole(body.Role)
+			if _, ok := policy.ShareRole(role); !ok {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Role must be viewer, contributor or editor"})
+				return
+			}
+
+			var share entities.CollectionShare
+			status := http.StatusOK
+
+			err = db.Transaction(func(tx *gorm.DB) error {
+				collection, _, err := loadCollection(tx, req, chi.URLParam(req, "uid"), policy.Owner)
+				if err != nil {
+					return err
+				}
+
+				if collection.OwnerID != nil && *collection.OwnerID == userUid {
+					return errCannotShareWithOwner
+				}
+
+				// Either the user or the group is shared with, never both
+				existing := tx.Where("collection_uid = ?", collection.Uid)
+				if userUid != "" {
+					var user entities.User
+					if err := tx.Where("uid = ?", userUid).First(&user).Error; err != nil {
+						if errors.Is(err, gorm.ErrRecordNotFound) {
+							return errShareUserNotFound
+						}
+						return err
+					}
+
+					share.User = &user
+					existing = existing.Where("user_id = ?", user.Uid)
+				} else {
+					var group entities.Group
+					if err := tx.Where("uid = ?", groupUid).First(&group).Error; err != nil {
+						if errors.Is(err, gorm.ErrRecordNotFound) {
+							return errShareUserNotFound
+						}
+						return err
+					}
+
+					share.Group = &group
+					existing = existing.Where("group_id = ?", group.Uid)
+				}
+
+				user, group := share.User, share.Group
+				err = existing.First(&share).Error
+				switch {
+				case err == nil:
+					share.Role = role
+				case errors.Is(err, gorm.ErrRecordNotFound):
+					share = entities.CollectionShare{
+						Uid:           uid.MustGenerate(),
+						CollectionUid: collection.Uid,
+						Role:          role,
+					}
+					if user != nil {
+						share.UserID = &user.Uid
+					} else {
+						share.GroupID = &group.Uid
+					}
+					status = http.StatusCreated
+				default:
+					return err
+				}
+
+				if err := tx.Omit("User", "Group").Save(&share).Error; err != nil {
+					return err
+				}
+
+				share.User, share.Group = user, group
+				return nil
+			})
+
+			if err != nil {
+				switch {
+				case errors.Is(err, errShareUserNotFound):
+					render.Status(req, http.StatusNotFound)
+					render.JSON(res, req, dto.ErrorResponse{Error: "User or group not found"})
+				case errors.Is(err, errCannotShareWithOwner):
+					render.Status(req, http.StatusBadRequest)
+					render.JSON(res, req, dto.ErrorResponse{Error: "The owner already has access to the collection"})
+				default:
+					writeCollectionShareError(res, req, logger, err)
+				}
+				return
+			}
+
+			logger.Info("collection shared",
+				slog.String("collection_uid", share.CollectionUid),
+				slog.String("user_uid", userUid),
+				slog.String("group_uid", groupUid),
+				slog.String("role", string(role)),
+			)
+
+			render.Status(req, status)
+			render.JSON(res, req, share.DTO())
+		})
+
+		manage.Patch("/{share_uid}", func(res http.ResponseWriter, req *http.Request) {
+			var body dto.CollectionShareUpdate
+			if err := render.DecodeJSON(req.Body, &body); err != nil {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Invalid request body"})
+				return
+			}
+
+			role := dto.CollectionShareRole(body.Role)
+			if _, ok := policy.ShareRole(role); !ok {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Role must be viewer, contributor or editor"})
+				return
+			}
+
+			var share entities.CollectionShare
+			err := db.Transaction(func(tx *gorm.DB) error {
+				collection, _, err := loadCollection(tx, req, chi.URLParam(req, "uid"), policy.Owner)
+				if err != nil {
+					return err
+				}
+
+				share, err = findShare(tx, collection.Uid, chi.URLParam(req, "share_uid"))
+				if err != nil {
+					return err
+				}
+
+				share.Role = role
+				return tx.Omit("User", "Group").Save(&share).Error
+			})
+
+			if err != nil {
+				writeCollectionShareError(res, req, logger, err)
+				return
+			}
+
+			render.JSON(res, req, share.DTO())
+		})
+
+		manage.Delete("/{share_uid}", func(res http.ResponseWriter, req *http.Request) {
+			authUser := requestUser(req)
+
+			err := db.Transaction(func(tx *gorm.DB) error {
+				collection, role, err := loadCollection(tx, req, chi.URLParam(req, "uid"), policy.Viewer)
+				if err != nil {
+					return err
+				}
+
+				share, err := findShare(tx, collection.Uid, chi.URLParam(req, "share_uid"))
+				if err != nil {
+					return err
+				}
+
+				leaving := share.UserID != nil && *share.UserID == authUser.Uid
+				if role < policy.Owner && !leaving {
+					return ErrCollectionUnauthorised
+				}
+
+				return tx.Delete(&share).Error
+			})
+
+			if err != nil {
+				writeCollectionShareError(res, req, logger, err)
+				return
+			}
+
+			res.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
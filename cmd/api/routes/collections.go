@@ -5,28 +5,83 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
+	"github.com/samber/lo"
 	"gorm.io/gorm"
 
+	"viz/internal/analytics"
 	"viz/internal/dto"
 	"viz/internal/entities"
 	libhttp "viz/internal/http"
+	"viz/internal/policy"
 	"viz/internal/uid"
 	"viz/internal/utils"
 )
 
 var ErrCollectionUnauthorised = errors.New("unauthorized")
 
-func findCollectionImages(db *gorm.DB, imgUIDs []string, collection entities.Collection, limit, offset int) ([]dto.ImagesResponse, error) {
+// errImageNotShareable is returned for adding someone else's private image
+// to a collection, which would share it with everyone the collection is
+// shared with.
+var errImageNotShareable = errors.New("image is private to someone else")
+
+// errCollectionMirrored is returned for changing the images or details of a
+// collection mirrored from another server, which come from there.
+var errCollectionMirrored = errors.New("collection is a read-only mirror")
+
+// loadCollection gets collection uid for the user making req, who needs at
+// least role on it. A collection the user can't see at all, or that their
+// API key isn't allowed, is not found.
+func loadCollection(tx *gorm.DB, req *http.Request, uid string, role policy.Role, preload ...string) (entities.Collection, policy.Role, error) {
+	var collection entities.Collection
+
+	if allowed := keyCollections(req); allowed != nil && !slices.Contains(allowed, uid) {
+		return collection, policy.None, gorm.ErrRecordNotFound
+	}
+
+	query := tx
+	for _, relation := range preload {
+		query = query.Preload(relation)
+	}
+
+	if err := query.First(&collection, "uid = ?", uid).Error; err != nil {
+		return collection, policy.None, err
+	}
+
+	has, err := policy.CollectionRole(tx, &collection, requestUser(req))
+	if err != nil {
+		return collection, has, err
+	}
+
+	if has == policy.None {
+		// Return "not found" to avoid leaking existence
+		return collection, has, gorm.ErrRecordNotFound
+	}
+
+	if has < role {
+		return collection, has, ErrCollectionUnauthorised
+	}
+
+	return collection, has, nil
+}
+
+// findCollectionImages gets a page of collection's images. Someone who can
+// only see the collection because it is public doesn't get the private
+// images in it that they couldn't otherwise see.
+func findCollectionImages(db *gorm.DB, imgUIDs []string, collection entities.Collection, role policy.Role, user *entities.User, limit, offset int) ([]dto.ImagesResponse, error) {
 	var images []entities.ImageAsset
 
-	if err := db.Preload("Owner").Preload("UploadedBy").Where("uid IN ?", imgUIDs).
-		Limit(limit).Offset(offset).
-		Find(&images).Error; err != nil {
+	query := db.Preload("Owner").Preload("UploadedBy").Where("images.uid IN ?", imgUIDs)
+	if role < policy.Viewer {
+		query = query.Scopes(policy.VisibleImages(user))
+	}
+
+	if err := query.Limit(limit).Offset(offset).Find(&images).Error; err != nil {
 		return nil, err
 	}
 
@@ -55,10 +110,14 @@ func findCollectionImages(db *gorm.DB, imgUIDs []string, collection entities.Col
 	return imgResponse, nil
 }
 
-func CollectionsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
+func CollectionsRouter(db *gorm.DB, logger *slog.Logger, recorder *analytics.Recorder) *chi.Mux {
 	router := chi.NewRouter()
 
 	router.Post("/", func(res http.ResponseWriter, req *http.Request) {
+		if !checkKeyUnlimited(res, req) {
+			return
+		}
+
 		var create struct {
 			Description *string `json:"description,omitempty"`
 			Name        string  `json:"name"`
@@ -86,7 +145,12 @@ func CollectionsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			)
 		}
 
-		authUser, _ := libhttp.UserFromContext(req)
+		authUser := requestUser(req)
+		if authUser == nil {
+			render.Status(req, http.StatusUnauthorized)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Unauthorized"})
+			return
+		}
 
 		// Map request -> entity for persistence
 		collection := entities.Collection{
@@ -123,16 +187,8 @@ func CollectionsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 		var total int64
 
 		err = db.Transaction(func(tx *gorm.DB) error {
-			query := tx.Model(&entities.Collection{})
-
-			authUser, ok := libhttp.UserFromContext(req)
-			if ok {
-				// Show: Public OR (Private AND Owned by me)
-				query = query.Where("private = ? OR (private = ? AND owner_id = ?)", false, true, authUser.Uid)
-			} else {
-				// Show: Only Public
-				query = query.Where("private = ?", false)
-			}
+			// Show: Public OR owned by me OR shared with me
+			query := tx.Model(&entities.Collection{}).Scopes(visibleCollections(req))
 
 			// Count total collections
 			if err := query.Count(&total).Error; err != nil {
@@ -140,7 +196,7 @@ func CollectionsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			}
 
 			// Fetch current page
-			return query.Preload("Thumbnail").Preload("CreatedBy").
+			return query.Preload("Thumbnail").Preload("CreatedBy").Preload("OwnerGroup").
 				Limit(limit).
 				Offset(page * limit).
 				Find(&collections).Error
@@ -196,23 +252,17 @@ func CollectionsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 		defaultImageOffset := 0
 
 		var collection entities.Collection
+		var role policy.Role
 		var imgResponse []dto.ImagesResponse
+		authUser := requestUser(req)
 
 		err := db.Transaction(func(tx *gorm.DB) error {
-			if err := tx.Preload("Thumbnail").Preload("CreatedBy").First(&collection, "uid = ?", uid).Error; err != nil {
+			var err error
+			collection, role, err = loadCollection(tx, req, uid, policy.Public, "Thumbnail", "CreatedBy")
+			if err != nil {
 				return err
 			}
 
-			// Access Control: If private, only owner can view
-			if collection.Private != nil && *collection.Private {
-				authUser, ok := libhttp.UserFromContext(req)
-				// If not authenticated or not the owner
-				if !ok || (collection.OwnerID != nil && *collection.OwnerID != authUser.Uid) {
-					// Return "not found" to avoid leaking existence
-					return gorm.ErrRecordNotFound
-				}
-			}
-
 			var collectionImages []dto.CollectionImage
 			if collection.Images != nil {
 				collectionImages = *collection.Images
@@ -223,7 +273,7 @@ func CollectionsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 				imageUIDs[i] = img.Uid
 			}
 
-			allColImages, err := findCollectionImages(tx, imageUIDs, collection, defaultImageLimit, defaultImageOffset)
+			allColImages, err := findCollectionImages(tx, imageUIDs, collection, role, authUser, defaultImageLimit, defaultImageOffset)
 			if err != nil {
 				return err
 			}
@@ -246,6 +296,8 @@ func CollectionsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			return
 		}
 
+		recordCollectionView(recorder, req, &collection, "")
+
 		defaultImagePage := 0
 		href := fmt.Sprintf("/collections/%s/images/?page=%d&limit=%d", uid, defaultImagePage, defaultImageLimit)
 
@@ -288,6 +340,7 @@ func CollectionsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			UpdatedAt:   collectionDTO.UpdatedAt,
 			Description: collectionDTO.Description,
 			Thumbnail:   collectionDTO.Thumbnail,
+			Role:        collectionRoleDTO(role),
 		}
 
 		render.JSON(res, req, result)
@@ -305,14 +358,35 @@ func CollectionsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			return
 		}
 
+		// Editors can change the details, but only the owner decides who
+		// the collection belongs to and who can see it.
+		needed := policy.Editor
+		if update.Private != nil || update.OwnerUID != nil || update.OwnerGroupUID != nil {
+			needed = policy.Owner
+		}
+
+		authUser := requestUser(req)
+
 		err = db.Transaction(func(tx *gorm.DB) error {
-			if err := tx.First(&collection, "uid = ?", uid).Error; err != nil {
+			var err error
+			collection, _, err = loadCollection(tx, req, uid, needed)
+			if err != nil {
 				return err
 			}
 
-			authUser, ok := libhttp.UserFromContext(req)
-			if !ok || (collection.OwnerID != nil && *collection.OwnerID != authUser.Uid) {
-				return fmt.Errorf("unauthorized")
+			if collection.MirrorUid != nil && (update.Name != nil || update.Description != nil || update.ThumbnailUID != nil) {
+				return errCollectionMirrored
+			}
+
+			// Only members of a group can give it a collection
+			if groupUid := lo.FromPtr(update.OwnerGroupUID); groupUid != "" {
+				allowed, err := checkGroupRole(tx, authUser, groupUid)
+				if err != nil {
+					return err
+				}
+				if !allowed {
+					return ErrCollectionUnauthorised
+				}
 			}
 
 			updateCollectionFromDTO(&collection, update)
@@ -322,7 +396,7 @@ func CollectionsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			}
 
 			// Reload to ensure updated data is sent to clients
-			return tx.Preload("Thumbnail").Preload("CreatedBy").First(&collection, "uid = ?", uid).Error
+			return tx.Preload("Thumbnail").Preload("CreatedBy").Preload("OwnerGroup").First(&collection, "uid = ?", uid).Error
 		})
 
 		if err != nil {
@@ -338,6 +412,12 @@ func CollectionsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 				return
 			}
 
+			if err == errCollectionMirrored {
+				render.Status(req, http.StatusForbidden)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Mirrored collections are read-only"})
+				return
+			}
+
 			libhttp.ServerError(res, req, err, logger, nil,
 				"Failed to update collection",
 				"Something went wrong, please try again later",
@@ -353,21 +433,21 @@ func CollectionsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 		uid := chi.URLParam(req, "uid")
 
 		err := db.Transaction(func(tx *gorm.DB) error {
-			var collection entities.Collection
-			if err := tx.First(&collection, "uid = ?", uid).Error; err != nil {
+			collection, _, err := loadCollection(tx, req, uid, policy.Owner)
+			if err != nil {
 				return err
 			}
 
-			authUser, ok := libhttp.UserFromContext(req)
-			if !ok || (collection.OwnerID != nil && *collection.OwnerID != authUser.Uid) {
-				return fmt.Errorf("unauthorized")
+			if err := tx.Where("collection_uid = ?", collection.Uid).Delete(&entities.CollectionShare{}).Error; err != nil {
+				return err
 			}
 
-			if err := tx.Delete(&collection).Error; err != nil {
+			// A mirror has nothing to sync into once its collection is gone
+			if err := tx.Where("collection_uid = ?", collection.Uid).Delete(&entities.CollectionMirror{}).Error; err != nil {
 				return err
 			}
 
-			return nil
+			return tx.Delete(&collection).Error
 		})
 
 		if err != nil {
@@ -393,6 +473,10 @@ func CollectionsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 		res.WriteHeader(http.StatusNoContent)
 	})
 
+	router.Route("/{uid}/shares", collectionShareRoutes(db, logger))
+	router.Route("/{uid}/proofing", collectionProofingRoutes(db, logger))
+	router.Route("/{uid}/upload-links", uploadLinkRoutes(db, logger))
+
 	router.Get("/{uid}/images", func(res http.ResponseWriter, req *http.Request) {
 		uid := chi.URLParam(req, "uid")
 		limit, err := strconv.Atoi(req.URL.Query().Get("limit"))
@@ -407,20 +491,15 @@ func CollectionsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 
 		var imgResponse []dto.ImagesResponse
 		var collection entities.Collection
+		authUser := requestUser(req)
 
 		err = db.Transaction(func(tx *gorm.DB) error {
-			if err := tx.Select("images", "private", "owner_id").First(&collection, "uid = ?", uid).Error; err != nil {
+			var role policy.Role
+			collection, role, err = loadCollection(tx, req, uid, policy.Public)
+			if err != nil {
 				return err
 			}
 
-			// Access Control: If private, only owner can view
-			if collection.Private != nil && *collection.Private {
-				authUser, ok := libhttp.UserFromContext(req)
-				if !ok || (collection.OwnerID != nil && *collection.OwnerID != authUser.Uid) {
-					return gorm.ErrRecordNotFound
-				}
-			}
-
 			var collectionImages []dto.CollectionImage
 			if collection.Images != nil {
 				collectionImages = *collection.Images
@@ -431,7 +510,7 @@ func CollectionsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 				imageUIDs[i] = img.Uid
 			}
 
-			imgResponse, err = findCollectionImages(tx, imageUIDs, collection, limit, offset)
+			imgResponse, err = findCollectionImages(tx, imageUIDs, collection, role, authUser, limit, offset)
 			if err != nil {
 				return err
 			}
@@ -500,15 +579,25 @@ func CollectionsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			return
 		}
 
+		authUser := requestUser(req)
+
 		err = db.Transaction(func(tx *gorm.DB) error {
-			var collection entities.Collection
-			if err := tx.First(&collection, "uid = ?", uid).Error; err != nil {
+			collection, _, err := loadCollection(tx, req, uid, policy.Contributor)
+			if err != nil {
 				return err
 			}
 
-			authUser, ok := libhttp.UserFromContext(req)
-			if !ok || (collection.OwnerID != nil && *collection.OwnerID != authUser.Uid) {
-				return fmt.Errorf("unauthorized")
+			if collection.MirrorUid != nil {
+				return errCollectionMirrored
+			}
+
+			// A key limited to some collections can't bring in images from outside them
+			allowed, err := keyAllowsImages(tx, req, colImage.UIDs...)
+			if err != nil {
+				return err
+			}
+			if !allowed {
+				return gorm.ErrRecordNotFound
 			}
 
 			for _, imgUID := range colImage.UIDs {
@@ -518,6 +607,19 @@ func CollectionsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 					return err
 				}
 
+				// Adding an image shares it with everyone who can see the
+				// collection, so it has to be public or one the user could
+				// change themselves.
+				if img.Private {
+					imgRole, err := policy.ImageRole(tx, &img, authUser)
+					if err != nil {
+						return err
+					}
+					if imgRole < policy.Editor {
+						return errImageNotShareable
+					}
+				}
+
 				userDTO := authUser.DTO()
 				colImageEnt := dto.CollectionImage{
 					Uid:     imgUID,
@@ -552,6 +654,18 @@ func CollectionsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 				return
 			}
 
+			if err == errCollectionMirrored {
+				render.Status(req, http.StatusForbidden)
+				render.JSON(res, req, dto.AddImagesResponse{Added: false, Error: utils.StringPtr("Mirrored collections are read-only")})
+				return
+			}
+
+			if err == errImageNotShareable {
+				render.Status(req, http.StatusForbidden)
+				render.JSON(res, req, dto.AddImagesResponse{Added: false, Error: utils.StringPtr("You can only add public images, your own or your groups'")})
+				return
+			}
+
 			libhttp.ServerError(res, req, err, logger, nil,
 				"",
 				"Something went wrong, please try again later",
@@ -575,15 +689,16 @@ func CollectionsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			return
 		}
 
+		authUser := requestUser(req)
+
 		err := db.Transaction(func(tx *gorm.DB) error {
-			var collection entities.Collection
-			if err := tx.First(&collection, "uid = ?", uid).Error; err != nil {
+			collection, role, err := loadCollection(tx, req, uid, policy.Contributor)
+			if err != nil {
 				return err
 			}
 
-			authUser, ok := libhttp.UserFromContext(req)
-			if !ok || (collection.OwnerID != nil && *collection.OwnerID != authUser.Uid) {
-				return ErrCollectionUnauthorised
+			if collection.MirrorUid != nil {
+				return errCollectionMirrored
 			}
 
 			var images []dto.CollectionImage
@@ -601,6 +716,15 @@ func CollectionsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 				toRemove[u] = struct{}{}
 			}
 
+			// Contributors can only take back the images they added
+			if role < policy.Editor {
+				for _, img := range images {
+					if _, found := toRemove[img.Uid]; found && (img.AddedBy == nil || img.AddedBy.Uid != authUser.Uid) {
+						return ErrCollectionUnauthorised
+					}
+				}
+			}
+
 			j := 0
 			for i := 0; i < len(images); i++ {
 				img := images[i]
@@ -635,6 +759,12 @@ func CollectionsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 				return
 			}
 
+			if err == errCollectionMirrored {
+				render.Status(req, http.StatusForbidden)
+				render.JSON(res, req, dto.DeleteImagesResponse{Deleted: false, Error: utils.StringPtr("mirrored collections are read-only")})
+				return
+			}
+
 			libhttp.ServerError(res, req, err, logger, nil,
 				"Failed to remove images from collection",
 				"Something went wrong, please try again later",
@@ -673,4 +803,11 @@ func updateCollectionFromDTO(collection *entities.Collection, update dto.Collect
 	if update.OwnerUID != nil {
 		collection.OwnerID = update.OwnerUID
 	}
+	if update.OwnerGroupUID != nil {
+		if *update.OwnerGroupUID == "" {
+			collection.OwnerGroupID = nil
+		} else {
+			collection.OwnerGroupID = update.OwnerGroupUID
+		}
+	}
 }
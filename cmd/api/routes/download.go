@@ -2,92 +2,36 @@ package routes
 
 import (
 	"archive/zip"
-	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
-	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
+	"github.com/samber/lo"
 	"gorm.io/gorm"
 
+	"viz/internal/analytics"
 	"viz/internal/downloads"
 	"viz/internal/dto"
 	"viz/internal/entities"
-	"viz/internal/images"
+	libhttp "viz/internal/http"
+	"viz/internal/imageops"
+	"viz/internal/policy"
+	"viz/internal/settings"
 	"viz/internal/utils"
 )
 
-// writeImagesToZip queries images for the given uids and writes them into the provided zip.Writer
-// in the order of the provided uids slice. Missing or unreadable files are skipped and logged.
-func writeImagesToZip(ctx context.Context, db *gorm.DB, logger *slog.Logger, zw *zip.Writer, uids []string) error {
-	if len(uids) == 0 {
-		return nil
-	}
-
-	var imgs []entities.ImageAsset
-	if err := db.WithContext(ctx).Where("uid IN ? AND deleted_at IS NULL", uids).Find(&imgs).Error; err != nil {
-		return err
-	}
-
-	imgMap := make(map[string]entities.ImageAsset, len(imgs))
-	for _, im := range imgs {
-		imgMap[im.Uid] = im
-	}
-
-	for _, uid := range uids {
-		imageEntity, ok := imgMap[uid]
-		if !ok {
-			logger.Warn("image not found for export", slog.String("uid", uid))
-			continue
-		}
-
-		diskPath := images.GetImagePath(imageEntity.Uid, imageEntity.ImageMetadata.FileName)
-		f, err := os.Open(diskPath)
-		if err != nil {
-			logger.Error("failed to open image file for export", slog.Any("error", err), slog.String("path", diskPath))
-			continue
-		}
-
-		safeName := filepath.Base(imageEntity.ImageMetadata.FileName)
-		// Use the original filename inside the ZIP (do not prefix with UID)
-		zipFileName := safeName
-
-		fileHeader := &zip.FileHeader{
-			Name:   zipFileName,
-			Method: zip.Deflate,
-		}
-
-		// try to set a meaningful mod time
-		fileHeader.Modified = imageEntity.UpdatedAt
-
-		w, err := zw.CreateHeader(fileHeader)
-		if err != nil {
-			f.Close()
-			logger.Error("failed to create zip entry", slog.Any("error", err))
-			continue
-		}
-
-		if _, err := io.Copy(w, f); err != nil {
-			f.Close()
-			logger.Error("failed to write image to zip", slog.Any("error", err))
-			continue
-		}
-
-		f.Close()
-	}
-
-	return nil
-}
-
 // streamZipResponse streams a zip of the given uids to the http.ResponseWriter using an io.Pipe
-// to avoid buffering the entire archive in memory.
-func streamZipResponse(res http.ResponseWriter, req *http.Request, db *gorm.DB, logger *slog.Logger, uids []string, filename string) {
+// to avoid buffering the entire archive in memory. Images are rendered with profile if it's set.
+func streamZipResponse(res http.ResponseWriter, req *http.Request, db *gorm.DB, logger *slog.Logger, uids []string, filename string, profile *dto.ExportProfile) {
 	if filename == "" {
 		filename = fmt.Sprintf("%s_export_%s.zip", utils.AppName, time.Now().Format("20060102T150405"))
 	}
@@ -101,13 +45,24 @@ func streamZipResponse(res http.ResponseWriter, req *http.Request, db *gorm.DB,
 	go func() {
 		// Ensure any writer-side errors are propagated to the reader via CloseWithError
 		zw := zip.NewWriter(pw)
-		if err := writeImagesToZip(req.Context(), db, logger, zw, uids); err != nil {
+		opts := downloads.ArchiveOptions{Profile: profile, Render: imageops.CachedTransform}
+		written, skipped, err := downloads.WriteArchive(req.Context(), db, zw, uids, opts, nil)
+		if err != nil {
 			logger.Error("error while creating zip", slog.Any("error", err))
 			_ = zw.Close()
 			_ = pw.CloseWithError(err)
 			return
 		}
 
+		// The headers are already sent, so skipped images can only be
+		// reported inside the archive
+		if len(skipped) > 0 {
+			logger.Warn("images skipped from zip", slog.Int("skipped", len(skipped)))
+			if err := downloads.WriteManifest(zw, written, skipped); err != nil {
+				logger.Error("failed to write zip manifest", slog.Any("error", err))
+			}
+		}
+
 		if err := zw.Close(); err != nil {
 			logger.Error("failed to close zip writer", slog.Any("error", err))
 			_ = pw.CloseWithError(err)
@@ -130,9 +85,110 @@ func streamZipResponse(res http.ResponseWriter, req *http.Request, db *gorm.DB,
 	}
 }
 
-func DownloadRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
+// validExportProfile checks the values of an export profile the spec can't
+// check for itself. A missing profile is valid.
+func validExportProfile(profile *dto.ExportProfile) bool {
+	if profile == nil {
+		return true
+	}
+
+	if format := profile.Format; format != nil && !slices.Contains([]dto.ExportProfileFormat{
+		dto.ExportProfileFormatOriginal,
+		dto.ExportProfileFormatJpg,
+		dto.ExportProfileFormatPng,
+		dto.ExportProfileFormatWebp,
+		dto.ExportProfileFormatAvif,
+	}, *format) {
+		return false
+	}
+
+	if colorProfile := profile.ColorProfile; colorProfile != nil && !slices.Contains([]dto.ExportProfileColorProfile{
+		dto.ExportProfileColorProfileSrgb,
+		dto.ExportProfileColorProfileP3,
+		dto.ExportProfileColorProfileOriginal,
+	}, *colorProfile) {
+		return false
+	}
+
+	if quality := profile.Quality; quality != nil && (*quality < 1 || *quality > 100) {
+		return false
+	}
+
+	return lo.FromPtr(profile.LongEdge) >= 0 && len(lo.FromPtr(profile.FilenameTemplate)) <= 255
+}
+
+// resolveExportProfile fills in the format and quality profile leaves out
+// from the user's image_download_format and image_download_quality settings.
+func resolveExportProfile(db *gorm.DB, req *http.Request, profile *dto.ExportProfile) *dto.ExportProfile {
+	var resolved dto.ExportProfile
+	if profile != nil {
+		resolved = *profile
+	}
+
+	var userUid *string
+	if user := requestUser(req); user != nil {
+		userUid = &user.Uid
+	}
+
+	if resolved.Format == nil {
+		if value, err := settings.GetSetting(db, settings.SettingNameImageDownloadFormat, userUid); err == nil {
+			format := dto.ExportProfileFormat(value)
+			resolved.Format = &format
+		}
+	}
+
+	if resolved.Quality == nil {
+		if value, err := settings.GetSetting(db, settings.SettingNameImageDownloadQuality, userUid); err == nil {
+			if quality, err := strconv.Atoi(value); err == nil && quality >= 1 && quality <= 100 {
+				resolved.Quality = &quality
+			}
+		}
+	}
+
+	if !validExportProfile(&resolved) {
+		// A setting with a value the profile doesn't know
+		resolved.Format = nil
+	}
+
+	return &resolved
+}
+
+// checkSignableImages makes sure uids are images the user can see, since a
+// token can only hand out images the user can see themselves. It writes the
+// error response itself when it returns false.
+func checkSignableImages(res http.ResponseWriter, req *http.Request, db *gorm.DB, logger *slog.Logger, uids *[]string) bool {
+	if uids == nil || len(*uids) == 0 {
+		render.Status(req, http.StatusBadRequest)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Image UIDs are required"})
+		return false
+	}
+
+	var visible int64
+	err := db.Model(&entities.ImageAsset{}).Scopes(visibleImages(req)).
+		Where("images.uid IN ?", *uids).Distinct("images.uid").Count(&visible).Error
+	if err != nil {
+		libhttp.ServerError(res, req, err, logger, nil,
+			"failed to check image access",
+			"Something went wrong, please try again later",
+		)
+		return false
+	}
+
+	if visible != int64(len(lo.Uniq(*uids))) {
+		render.Status(req, http.StatusNotFound)
+		render.JSON(res, req, dto.ErrorResponse{Error: "One or more images not found"})
+		return false
+	}
+
+	return true
+}
+
+func DownloadRouter(db *gorm.DB, logger *slog.Logger, limiter *libhttp.Limiter, recorder *analytics.Recorder) *chi.Mux {
 	router := chi.NewRouter()
 
+	router.Route("/tokens", downloadTokenRoutes(db, logger))
+	router.Route("/exports", downloadExportRoutes(db, logger))
+
 	router.Post("/sign", func(res http.ResponseWriter, req *http.Request) {
 		var body dto.SignDownloadRequest
 
@@ -142,10 +198,22 @@ func DownloadRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			return
 		}
 
-		// require uids present
-		if body.Uids == nil || len(*body.Uids) == 0 {
-			render.Status(req, http.StatusBadRequest)
-			render.JSON(res, req, dto.ErrorResponse{Error: "Image UIDs are required"})
+		collectionUid := lo.FromPtr(body.CollectionUid)
+		if collectionUid != "" {
+			if body.Uids != nil && len(*body.Uids) > 0 {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Give either image UIDs or a collection UID, not both"})
+				return
+			}
+
+			// Only the owner hands a collection out to people without accounts
+			if _, _, err := loadCollection(db, req, collectionUid, policy.Owner); err != nil {
+				writeCollectionShareError(res, req, logger, err)
+				return
+			}
+
+			body.Uids = &[]string{}
+		} else if !checkSignableImages(res, req, db, logger, body.Uids) {
 			return
 		}
 
@@ -162,6 +230,7 @@ func DownloadRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			AllowDownload: body.AllowDownload == nil || *body.AllowDownload, // Default: true
 			AllowEmbed:    body.AllowEmbed != nil && *body.AllowEmbed,       // Default: false
 			ShowMetadata:  body.ShowMetadata == nil || *body.ShowMetadata,   // Default: true
+			AllowProofing: lo.FromPtr(body.AllowProofing),                   // Default: false
 		}
 
 		if body.Password != nil {
@@ -171,6 +240,12 @@ func DownloadRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			opts.Description = *body.Description
 		}
 
+		opts.CollectionUid = collectionUid
+		opts.MaxUses = max(lo.FromPtr(body.MaxUses), 0)
+		if user := requestUser(req); user != nil {
+			opts.CreatedBy = user.Uid
+		}
+
 		token, err := downloads.CreateTokenWithOptions(db, *body.Uids, opts)
 		if err != nil {
 			logger.Error("failed to create download token", slog.Any("error", err))
@@ -188,28 +263,12 @@ func DownloadRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 		}
 
 		render.Status(req, http.StatusOK)
-		render.JSON(res, req, tokenEntity.DTO())
+		render.JSON(res, req, downloadTokenDTO(tokenEntity))
 	})
 
-	router.Post("/", func(res http.ResponseWriter, req *http.Request) {
-		tokenParam := req.URL.Query().Get("token")
-		passwordParam := req.URL.Query().Get("password")
-
-		if tokenParam == "" {
-			render.Status(req, http.StatusBadRequest)
-			render.JSON(res, req, dto.ErrorResponse{Error: "Missing token query param"})
-			return
-		}
-
-		allowedUIDs, tokenEntity, ok := downloads.ValidateTokenWithPassword(db, tokenParam, passwordParam)
+	router.With(limiter.Throttle(rateLimitScopeDownload)).Post("/", func(res http.ResponseWriter, req *http.Request) {
+		allowedUIDs, tokenEntity, ok := checkDownloadToken(res, req, db, limiter)
 		if !ok {
-			if tokenEntity != nil && tokenEntity.Password != nil {
-				render.Status(req, http.StatusUnauthorized)
-				render.JSON(res, req, dto.ErrorResponse{Error: "Invalid or missing password"})
-				return
-			}
-			render.Status(req, http.StatusUnauthorized)
-			render.JSON(res, req, dto.ErrorResponse{Error: "Invalid or expired token"})
 			return
 		}
 
@@ -221,7 +280,7 @@ func DownloadRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 
 		var body dto.DownloadRequest
 
-		if err := render.DecodeJSON(req.Body, &body); err != nil {
+		if err := render.DecodeJSON(req.Body, &body); err != nil || !validExportProfile(body.Profile) {
 			render.Status(req, http.StatusBadRequest)
 			render.JSON(res, req, dto.ErrorResponse{Error: "Invalid request body"})
 			return
@@ -246,13 +305,98 @@ func DownloadRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			}
 		}
 
+		if !recordTokenDownload(res, req, db, logger, tokenEntity, body.Uids) {
+			return
+		}
+		recordDownloads(recorder, req, body.Uids, lo.FromPtr(tokenEntity.CollectionUid), tokenEntity.Uid)
+
 		// Stream ZIP using a pipe to avoid buffering the entire archive in memory
 		var filename string
 		if body.FileName != nil {
 			filename = *body.FileName
 		}
-		streamZipResponse(res, req, db, logger, body.Uids, filename)
+		streamZipResponse(res, req, db, logger, body.Uids, filename, resolveExportProfile(db, req, body.Profile))
 	})
 
 	return router
 }
+
+// checkDownloadToken validates the token and password query params. Wrong
+// guesses count against the client IP and the token, and either can be
+// locked out. It writes the error response itself when it returns false.
+func checkDownloadToken(res http.ResponseWriter, req *http.Request, db *gorm.DB, limiter *libhttp.Limiter) ([]string, *entities.DownloadToken, bool) {
+	token := req.URL.Query().Get("token")
+	if token == "" {
+		render.Status(req, http.StatusBadRequest)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Missing token query param"})
+		return nil, nil, false
+	}
+
+	return checkTokenPassword(res, req, db, limiter, token, req.URL.Query().Get("password"))
+}
+
+// checkTokenPassword is checkDownloadToken for a token that didn't come from
+// the query, like a share link's.
+func checkTokenPassword(res http.ResponseWriter, req *http.Request, db *gorm.DB, limiter *libhttp.Limiter, token, password string) ([]string, *entities.DownloadToken, bool) {
+	rateLimitKeys := []string{limiter.IPKey(req), libhttp.TokenKey(token)}
+	if wait := limiter.Check(req.Context(), rateLimitScopeDownload, rateLimitKeys...); wait > 0 {
+		libhttp.TooManyRequests(res, req, wait)
+		return nil, nil, false
+	}
+
+	uids, tokenEntity, ok := downloads.ValidateTokenWithPassword(db, token, password)
+	if !ok {
+		if tokenEntity != nil && tokenEntity.Password != nil {
+			// Asking for the password isn't a wrong guess.
+			if password != "" {
+				limiter.Failure(req, rateLimitScopeDownload, rateLimitKeys...)
+			}
+
+			render.Status(req, http.StatusUnauthorized)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Invalid or missing password"})
+			return nil, nil, false
+		}
+
+		limiter.Failure(req, rateLimitScopeDownload, limiter.IPKey(req))
+		render.Status(req, http.StatusUnauthorized)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Invalid or expired token"})
+		return nil, nil, false
+	}
+
+	if tokenEntity.Password != nil {
+		limiter.Success(req.Context(), rateLimitScopeDownload, libhttp.TokenKey(token))
+	}
+
+	return uids, tokenEntity, true
+}
+
+// recordTokenDownload counts a download of uids with dt against its limit
+// and logs it. It writes the error response itself when it returns false.
+func recordTokenDownload(res http.ResponseWriter, req *http.Request, db *gorm.DB, logger *slog.Logger, dt *entities.DownloadToken, uids []string) bool {
+	_ = downloads.TouchToken(db, dt)
+
+	err := downloads.RecordDownload(db, dt, libhttp.ClientIP(req, libhttp.TrustProxyHeaders), uids)
+	if errors.Is(err, downloads.ErrTokenUsedUp) {
+		render.Status(req, http.StatusForbidden)
+		render.JSON(res, req, dto.ErrorResponse{Error: "This link has reached its download limit"})
+		return false
+	}
+
+	if err != nil {
+		libhttp.ServerError(res, req, err, logger, nil,
+			"failed to record download",
+			"Something went wrong, please try again later",
+		)
+		return false
+	}
+
+	return true
+}
+
+// downloadTokenDTO is dt as its owner sees it, without the password hash.
+func downloadTokenDTO(dt entities.DownloadToken) dto.DownloadToken {
+	hasPassword := dt.Password != nil
+	dt.Password = nil
+	dt.HasPassword = &hasPassword
+	return dt.DTO()
+}
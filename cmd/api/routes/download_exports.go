@@ -0,0 +1,256 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+
+	"viz/internal/downloads"
+	"viz/internal/dto"
+	"viz/internal/entities"
+	libhttp "viz/internal/http"
+	"viz/internal/jobs"
+	"viz/internal/jobs/workers"
+	"viz/internal/policy"
+	"viz/internal/uid"
+	"viz/internal/utils"
+)
+
+// findOwnExport gets the export uid if the request's user started it.
+func findOwnExport(tx *gorm.DB, req *http.Request, exportUid string) (entities.ExportArchive, error) {
+	var export entities.ExportArchive
+
+	user := requestUser(req)
+	if user == nil {
+		return export, gorm.ErrRecordNotFound
+	}
+
+	err := tx.Where("uid = ? AND created_by_id = ?", exportUid, user.Uid).First(&export).Error
+	return export, err
+}
+
+// writeExportError answers for the errors the export routes return.
+func writeExportError(res http.ResponseWriter, req *http.Request, logger *slog.Logger, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		render.Status(req, http.StatusNotFound)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Export not found"})
+		return
+	}
+
+	libhttp.ServerError(res, req, err, logger, nil,
+		"failed to update export",
+		"Something went wrong, please try again later",
+	)
+}
+
+// exportImageUids works out which images an export asks for, in archive
+// order. It writes the error response itself when it returns false.
+func exportImageUids(res http.ResponseWriter, req *http.Request, db *gorm.DB, logger *slog.Logger, body dto.ExportCreate) ([]string, string, bool) {
+	collectionUid := lo.FromPtr(body.CollectionUid)
+	if collectionUid == "" {
+		if !checkSignableImages(res, req, db, logger, body.Uids) {
+			return nil, "", false
+		}
+
+		return lo.Uniq(*body.Uids), "", true
+	}
+
+	if body.Uids != nil && len(*body.Uids) > 0 {
+		render.Status(req, http.StatusBadRequest)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Give either image UIDs or a collection UID, not both"})
+		return nil, "", false
+	}
+
+	// Anyone who can see the collection could download its images one by one
+	collection, _, err := loadCollection(db, req, collectionUid, policy.Viewer)
+	if err != nil {
+		writeCollectionShareError(res, req, logger, err)
+		return nil, "", false
+	}
+
+	uids := []string{}
+	if collection.Images != nil {
+		for _, img := range *collection.Images {
+			uids = append(uids, img.Uid)
+		}
+	}
+
+	if len(uids) == 0 {
+		render.Status(req, http.StatusBadRequest)
+		render.JSON(res, req, dto.ErrorResponse{Error: "The collection has no images"})
+		return nil, "", false
+	}
+
+	return uids, collection.Name, true
+}
+
+// downloadExportRoutes serves /download/exports. Exports build an archive
+// to storage with a background job instead of streaming it, so large
+// downloads get a Content-Length and can be resumed.
+func downloadExportRoutes(db *gorm.DB, logger *slog.Logger) func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Get("/", func(res http.ResponseWriter, req *http.Request) {
+			user := requestUser(req)
+			if user == nil {
+				render.Status(req, http.StatusUnauthorized)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Unauthorized"})
+				return
+			}
+
+			var exports []entities.ExportArchive
+			if err := db.Where("created_by_id = ?", user.Uid).Order("created_at DESC").Find(&exports).Error; err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to list exports", "Failed to list exports")
+				return
+			}
+
+			render.JSON(res, req, dto.ExportArchiveList{Items: lo.Map(exports, func(e entities.ExportArchive, _ int) dto.ExportArchive {
+				return e.DTO()
+			})})
+		})
+
+		r.Post("/", func(res http.ResponseWriter, req *http.Request) {
+			user := requestUser(req)
+			if user == nil {
+				render.Status(req, http.StatusUnauthorized)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Unauthorized"})
+				return
+			}
+
+			var body dto.ExportCreate
+			if err := render.DecodeJSON(req.Body, &body); err != nil || !validExportProfile(body.Profile) {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Invalid request body"})
+				return
+			}
+
+			uids, collectionName, ok := exportImageUids(res, req, db, logger, body)
+			if !ok {
+				return
+			}
+
+			filename := strings.TrimSpace(strings.ReplaceAll(filepath.Base(lo.FromPtr(body.FileName)), `"`, ""))
+			if filename == "" || filename == "." || filename == string(filepath.Separator) {
+				filename = fmt.Sprintf("%s_export_%s", utils.AppName, time.Now().Format("20060102T150405"))
+				if collectionName != "" {
+					filename = collectionName
+				}
+			}
+			if !strings.HasSuffix(strings.ToLower(filename), ".zip") {
+				filename += ".zip"
+			}
+
+			export := entities.ExportArchive{
+				Uid:         uid.MustGenerate(),
+				Status:      dto.ExportArchiveStatusQueued,
+				CreatedByID: &user.Uid,
+				FileName:    filename,
+				ImageUids:   uids,
+				Profile:     resolveExportProfile(db, req, body.Profile),
+			}
+
+			if err := db.Create(&export).Error; err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to create export", "Failed to create export")
+				return
+			}
+
+			jobUid, err := jobs.Enqueue(db, workers.TopicExportArchive, jobs.PriorityNormal, &workers.ExportArchiveJob{ExportUid: export.Uid}, nil, nil)
+			if err != nil {
+				_ = db.Delete(&export).Error
+				libhttp.ServerError(res, req, err, logger, nil, "failed to enqueue export", "Failed to start export")
+				return
+			}
+
+			export.JobUid = &jobUid
+			if err := db.Model(&export).Update("job_uid", jobUid).Error; err != nil {
+				logger.Warn("failed to save export job", slog.String("export_uid", export.Uid), slog.Any("error", err))
+			}
+
+			logger.Info("export queued", slog.String("export_uid", export.Uid), slog.Int("images", len(uids)))
+			render.Status(req, http.StatusAccepted)
+			render.JSON(res, req, export.DTO())
+		})
+
+		r.Get("/{uid}", func(res http.ResponseWriter, req *http.Request) {
+			export, err := findOwnExport(db, req, chi.URLParam(req, "uid"))
+			if err != nil {
+				writeExportError(res, req, logger, err)
+				return
+			}
+
+			render.JSON(res, req, export.DTO())
+		})
+
+		r.Delete("/{uid}", func(res http.ResponseWriter, req *http.Request) {
+			export, err := findOwnExport(db, req, chi.URLParam(req, "uid"))
+			if err == nil {
+				err = downloads.DeleteExport(db, &export)
+			}
+
+			if err != nil {
+				writeExportError(res, req, logger, err)
+				return
+			}
+
+			res.WriteHeader(http.StatusNoContent)
+		})
+
+		r.Get("/{uid}/file", func(res http.ResponseWriter, req *http.Request) {
+			export, err := findOwnExport(db, req, chi.URLParam(req, "uid"))
+			if err != nil {
+				writeExportError(res, req, logger, err)
+				return
+			}
+
+			if export.ExpiresAt != nil && export.ExpiresAt.Before(time.Now()) {
+				render.Status(req, http.StatusGone)
+				render.JSON(res, req, dto.ErrorResponse{Error: "This export has expired"})
+				return
+			}
+
+			switch export.Status {
+			case dto.ExportArchiveStatusCompleted:
+			case dto.ExportArchiveStatusFailed:
+				render.Status(req, http.StatusConflict)
+				render.JSON(res, req, dto.ErrorResponse{Error: "This export failed"})
+				return
+			default:
+				render.Status(req, http.StatusConflict)
+				render.JSON(res, req, dto.ErrorResponse{Error: "This export isn't ready yet"})
+				return
+			}
+
+			f, err := os.Open(downloads.ExportPath(export.Uid))
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					render.Status(req, http.StatusGone)
+					render.JSON(res, req, dto.ErrorResponse{Error: "This export has expired"})
+					return
+				}
+
+				libhttp.ServerError(res, req, err, logger, nil, "failed to open export", "Failed to open export")
+				return
+			}
+			defer f.Close()
+
+			// ServeContent answers Range and If-Range requests, so an
+			// interrupted download picks up where it stopped. The archive
+			// never changes once built, so its uid is a strong ETag.
+			res.Header().Set("Content-Type", "application/zip")
+			res.Header().Set("ETag", fmt.Sprintf("%q", export.Uid))
+			res.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"; filename*=UTF-8''%s", export.FileName, url.PathEscape(export.FileName)))
+			http.ServeContent(res, req, export.FileName, lo.FromPtr(export.CompletedAt), f)
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package routes_test
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"viz/api/routes"
+	"viz/internal/config"
+	"viz/internal/downloads"
+	"viz/internal/dto"
+	"viz/internal/entities"
+)
+
+func TestDownloadExports(t *testing.T) {
+	db := newTestDB(t)
+	server := newUserTestServer(t, db, "/api/download", routes.DownloadRouter(db, newTestLogger(), nil, nil))
+	base := server.URL + "/api/download/exports/"
+
+	defer func(dir string) { config.AppConfig.Export.Directory = dir }(config.AppConfig.Export.Directory)
+	config.AppConfig.Export.Directory = t.TempDir()
+
+	require.NoError(t, db.Create(&[]entities.User{
+		{Uid: "exports_owner", Username: "exports_owner", Email: "exports_owner@example.com"},
+		{Uid: "exports_other", Username: "exports_other", Email: "exports_other@example.com"},
+	}).Error)
+
+	// Nobody exports a private collection they can't see
+	collection := createSharedImage(t, db, "exports_img")
+	require.NoError(t, db.Model(&collection).Update("owner_id", "exports_owner").Error)
+	status, _ := doAs(t, "exports_other", http.MethodPost, base, dto.ExportCreate{CollectionUid: &collection.Uid})
+	assert.Equal(t, http.StatusNotFound, status)
+
+	archive := []byte("zip archive contents")
+	later := time.Now().Add(time.Hour)
+	exports := []entities.ExportArchive{
+		{Uid: "exports_done", Status: dto.ExportArchiveStatusCompleted, CompletedAt: lo.ToPtr(time.Now()), ExpiresAt: &later},
+		{Uid: "exports_running", Status: dto.ExportArchiveStatusRunning},
+		{Uid: "exports_failed", Status: dto.ExportArchiveStatusFailed},
+		{Uid: "exports_expired", Status: dto.ExportArchiveStatusCompleted, ExpiresAt: lo.ToPtr(time.Now().Add(-time.Minute))},
+		{Uid: "exports_missing", Status: dto.ExportArchiveStatusCompleted},
+	}
+	for i := range exports {
+		exports[i].CreatedByID = lo.ToPtr("exports_owner")
+		exports[i].FileName = exports[i].Uid + ".zip"
+		require.NoError(t, db.Create(&exports[i]).Error)
+	}
+	require.NoError(t, os.WriteFile(downloads.ExportPath("exports_done"), archive, 0o600))
+	require.NoError(t, os.WriteFile(downloads.ExportPath("exports_expired"), archive, 0o600))
+
+	// Exports are their creator's alone
+	for _, path := range []string{"exports_done", "exports_done/file"} {
+		status, _ := doAs(t, "exports_other", http.MethodGet, base+path, nil)
+		assert.Equal(t, http.StatusNotFound, status, path)
+	}
+	status, _ = doAs(t, "exports_other", http.MethodDelete, base+"exports_done", nil)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	for uid, want := range map[string]int{
+		"exports_running": http.StatusConflict,
+		"exports_failed":  http.StatusConflict,
+		"exports_expired": http.StatusGone,
+		"exports_missing": http.StatusGone,
+	} {
+		status, _ := doAs(t, "exports_owner", http.MethodGet, base+uid+"/file", nil)
+		assert.Equal(t, want, status, uid)
+	}
+
+	// A dropped download picks up where it stopped
+	status, body := doAs(t, "exports_owner", http.MethodGet, base+"exports_done/file", nil)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, archive, body)
+
+	req, err := http.NewRequest(http.MethodGet, base+"exports_done/file", nil)
+	require.NoError(t, err)
+	req.Header.Set(testUserHeader, "exports_owner")
+	req.Header.Set("Range", "bytes=4-")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, archive[4:], body)
+
+	// Deleting an export deletes its archive
+	status, _ = doAs(t, "exports_owner", http.MethodDelete, base+"exports_done", nil)
+	require.Equal(t, http.StatusNoContent, status)
+	_, err = os.Stat(downloads.ExportPath("exports_done"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,211 @@
+package routes
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+
+	"viz/internal/downloads"
+	"viz/internal/dto"
+	"viz/internal/entities"
+	libhttp "viz/internal/http"
+)
+
+// findOwnDownloadToken gets token if the request's user created it. Tokens
+// made before tokens had owners belong to nobody.
+func findOwnDownloadToken(tx *gorm.DB, req *http.Request, token string) (entities.DownloadToken, error) {
+	var dt entities.DownloadToken
+
+	user := requestUser(req)
+	if user == nil {
+		return dt, gorm.ErrRecordNotFound
+	}
+
+	err := tx.Where("uid = ? AND created_by_id = ?", token, user.Uid).First(&dt).Error
+	return dt, err
+}
+
+// writeDownloadTokenError answers for the errors the token routes return.
+func writeDownloadTokenError(res http.ResponseWriter, req *http.Request, logger *slog.Logger, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		render.Status(req, http.StatusNotFound)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Token not found"})
+		return
+	}
+
+	libhttp.ServerError(res, req, err, logger, nil,
+		"failed to update download token",
+		"Something went wrong, please try again later",
+	)
+}
+
+// downloadTokenRoutes serves /download/tokens, where users manage the
+// download tokens and share links they made.
+func downloadTokenRoutes(db *gorm.DB, logger *slog.Logger) func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Get("/", func(res http.ResponseWriter, req *http.Request) {
+			user := requestUser(req)
+			if user == nil {
+				render.Status(req, http.StatusUnauthorized)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Unauthorized"})
+				return
+			}
+
+			query := db.Where("created_by_id = ?", user.Uid)
+			if collectionUid := req.URL.Query().Get("collection_uid"); collectionUid != "" {
+				query = query.Where("collection_uid = ?", collectionUid)
+			}
+
+			var tokens []entities.DownloadToken
+			if err := query.Order("created_at DESC").Find(&tokens).Error; err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to list download tokens", "Failed to list download tokens")
+				return
+			}
+
+			render.JSON(res, req, dto.DownloadTokenList{Items: lo.Map(tokens, func(dt entities.DownloadToken, _ int) dto.DownloadToken {
+				return downloadTokenDTO(dt)
+			})})
+		})
+
+		r.Get("/{token}", func(res http.ResponseWriter, req *http.Request) {
+			dt, err := findOwnDownloadToken(db, req, chi.URLParam(req, "token"))
+			if err != nil {
+				writeDownloadTokenError(res, req, logger, err)
+				return
+			}
+
+			render.JSON(res, req, downloadTokenDTO(dt))
+		})
+
+		r.Patch("/{token}", func(res http.ResponseWriter, req *http.Request) {
+			var body dto.DownloadTokenUpdate
+			if err := render.DecodeJSON(req.Body, &body); err != nil ||
+				(body.ExpiresIn != nil && *body.ExpiresIn < 0) ||
+				(body.MaxUses != nil && *body.MaxUses < 0) ||
+				(body.Description != nil && len(*body.Description) > 500) {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Invalid request body"})
+				return
+			}
+
+			var dt entities.DownloadToken
+			err := db.Transaction(func(tx *gorm.DB) error {
+				var err error
+				dt, err = findOwnDownloadToken(tx, req, chi.URLParam(req, "token"))
+				if err != nil {
+					return err
+				}
+
+				if body.ExpiresIn != nil {
+					dt.ExpiresAt = nil
+					if *body.ExpiresIn > 0 {
+						expires := time.Now().Add(time.Duration(*body.ExpiresIn) * time.Second)
+						dt.ExpiresAt = &expires
+					}
+				}
+
+				if body.Password != nil {
+					if dt.Password, err = downloads.HashPassword(*body.Password); err != nil {
+						return err
+					}
+					hasPassword := dt.Password != nil
+					dt.HasPassword = &hasPassword
+				}
+
+				if body.MaxUses != nil {
+					dt.MaxUses = nil
+					if *body.MaxUses > 0 {
+						dt.MaxUses = body.MaxUses
+					}
+				}
+
+				if body.Description != nil {
+					dt.Description = body.Description
+				}
+				if body.AllowDownload != nil {
+					dt.AllowDownload = *body.AllowDownload
+				}
+				if body.AllowEmbed != nil {
+					dt.AllowEmbed = *body.AllowEmbed
+				}
+				if body.ShowMetadata != nil {
+					dt.ShowMetadata = *body.ShowMetadata
+				}
+				if body.AllowProofing != nil {
+					dt.AllowProofing = body.AllowProofing
+				}
+
+				return tx.Omit("CreatedBy").Save(&dt).Error
+			})
+
+			if err != nil {
+				writeDownloadTokenError(res, req, logger, err)
+				return
+			}
+
+			render.JSON(res, req, downloadTokenDTO(dt))
+		})
+
+		r.Delete("/{token}", func(res http.ResponseWriter, req *http.Request) {
+			dt, err := findOwnDownloadToken(db, req, chi.URLParam(req, "token"))
+			if err == nil {
+				err = db.Delete(&dt).Error
+			}
+
+			if err != nil {
+				writeDownloadTokenError(res, req, logger, err)
+				return
+			}
+
+			logger.Info("download token revoked", slog.Int64("token_id", int64(dt.ID)))
+			res.WriteHeader(http.StatusNoContent)
+		})
+
+		r.Get("/{token}/logs", func(res http.ResponseWriter, req *http.Request) {
+			limit, err := strconv.Atoi(req.URL.Query().Get("limit"))
+			if err != nil || limit <= 0 {
+				limit = 100
+			}
+
+			offset, err := strconv.Atoi(req.URL.Query().Get("offset"))
+			if err != nil || offset < 0 {
+				offset = 0
+			}
+
+			var logs []entities.DownloadLog
+			var count int64
+			err = db.Transaction(func(tx *gorm.DB) error {
+				dt, err := findOwnDownloadToken(tx, req, chi.URLParam(req, "token"))
+				if err != nil {
+					return err
+				}
+
+				query := tx.Model(&entities.DownloadLog{}).Where("token_uid = ?", dt.Uid)
+				if err := query.Count(&count).Error; err != nil {
+					return err
+				}
+
+				return query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&logs).Error
+			})
+
+			if err != nil {
+				writeDownloadTokenError(res, req, logger, err)
+				return
+			}
+
+			render.JSON(res, req, dto.DownloadLogList{
+				Items:  lo.Map(logs, func(l entities.DownloadLog, _ int) dto.DownloadLog { return l.DTO() }),
+				Offset: offset,
+				Limit:  limit,
+				Count:  int(count),
+			})
+		})
+	}
+}
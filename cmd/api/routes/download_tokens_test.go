@@ -0,0 +1,152 @@
+package routes_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"viz/api/routes"
+	"viz/internal/dto"
+	"viz/internal/entities"
+	libhttp "viz/internal/http"
+)
+
+// testUserHeader names the user a request to newUserTestServer runs as.
+const testUserHeader = "X-Test-User"
+
+// newUserTestServer serves router as whichever user each request names in
+// testUserHeader, or as nobody.
+func newUserTestServer(t *testing.T, db *gorm.DB, pattern string, router http.Handler) *httptest.Server {
+	t.Helper()
+
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if uid := req.Header.Get(testUserHeader); uid != "" {
+				var user entities.User
+				require.NoError(t, db.First(&user, "uid = ?", uid).Error)
+				req = libhttp.WithUser(req, &user)
+			}
+			next.ServeHTTP(res, req)
+		})
+	})
+	r.Mount(pattern, router)
+
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// doAs sends a request as user with body, if it isn't nil, as JSON.
+func doAs(t *testing.T, user, method, url string, body any) (int, []byte) {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, url, reader)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	if user != "" {
+		req.Header.Set(testUserHeader, user)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, data
+}
+
+func TestDownloadTokens(t *testing.T) {
+	db := newTestDB(t)
+	server := newUserTestServer(t, db, "/api/download", routes.DownloadRouter(db, newTestLogger(), nil, nil))
+	base := server.URL + "/api/download"
+
+	require.NoError(t, db.Create(&[]entities.User{
+		{Uid: "tokens_owner", Username: "tokens_owner", Email: "tokens_owner@example.com"},
+		{Uid: "tokens_other", Username: "tokens_other", Email: "tokens_other@example.com"},
+	}).Error)
+	collection := createSharedImage(t, db, "tokens_img")
+	require.NoError(t, db.Model(&collection).Update("owner_id", "tokens_owner").Error)
+
+	// Only the owner hands a collection out
+	status, _ := doAs(t, "tokens_other", http.MethodPost, base+"/sign", dto.SignDownloadRequest{CollectionUid: &collection.Uid})
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status, body := doAs(t, "tokens_owner", http.MethodPost, base+"/sign", dto.SignDownloadRequest{CollectionUid: &collection.Uid})
+	require.Equal(t, http.StatusOK, status, string(body))
+	var token dto.DownloadToken
+	require.NoError(t, json.Unmarshal(body, &token))
+	tokenURL := base + "/tokens/" + token.Uid
+
+	download := func() int {
+		status, _ := doAs(t, "", http.MethodPost, base+"?token="+token.Uid, dto.DownloadRequest{Uids: []string{"tokens_img"}})
+		return status
+	}
+
+	// Tokens are their creator's alone
+	status, body = doAs(t, "tokens_owner", http.MethodGet, base+"/tokens", nil)
+	require.Equal(t, http.StatusOK, status)
+	var list dto.DownloadTokenList
+	require.NoError(t, json.Unmarshal(body, &list))
+	assert.Len(t, list.Items, 1)
+
+	status, body = doAs(t, "tokens_other", http.MethodGet, base+"/tokens", nil)
+	require.Equal(t, http.StatusOK, status)
+	require.NoError(t, json.Unmarshal(body, &list))
+	assert.Empty(t, list.Items)
+
+	for _, method := range []string{http.MethodGet, http.MethodPatch, http.MethodDelete} {
+		status, _ := doAs(t, "tokens_other", method, tokenURL, dto.DownloadTokenUpdate{})
+		assert.Equal(t, http.StatusNotFound, status, method)
+	}
+	status, _ = doAs(t, "tokens_other", http.MethodGet, tokenURL+"/logs", nil)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// A use limit holds, and each download is logged
+	one := 1
+	status, _ = doAs(t, "tokens_owner", http.MethodPatch, tokenURL, dto.DownloadTokenUpdate{MaxUses: &one})
+	require.Equal(t, http.StatusOK, status)
+
+	assert.Equal(t, http.StatusOK, download())
+	assert.Equal(t, http.StatusForbidden, download())
+
+	status, body = doAs(t, "tokens_owner", http.MethodGet, tokenURL+"/logs", nil)
+	require.Equal(t, http.StatusOK, status)
+	var logs dto.DownloadLogList
+	require.NoError(t, json.Unmarshal(body, &logs))
+	require.Equal(t, 1, logs.Count)
+	assert.Equal(t, []string{"tokens_img"}, logs.Items[0].ImageUids)
+
+	// Changing the password locks out whoever only has the token
+	zero, password := 0, "secret"
+	status, _ = doAs(t, "tokens_owner", http.MethodPatch, tokenURL, dto.DownloadTokenUpdate{MaxUses: &zero, Password: &password})
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, http.StatusUnauthorized, download())
+
+	status, _ = doAs(t, "tokens_owner", http.MethodPatch, tokenURL, dto.DownloadTokenUpdate{Password: new(string)})
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, http.StatusOK, download())
+
+	// Revoking it locks out everyone
+	status, _ = doAs(t, "tokens_owner", http.MethodDelete, tokenURL, nil)
+	require.Equal(t, http.StatusNoContent, status)
+	assert.Equal(t, http.StatusUnauthorized, download())
+	status, _ = doAs(t, "tokens_owner", http.MethodGet, tokenURL, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+}
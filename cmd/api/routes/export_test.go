@@ -0,0 +1,5 @@
+package routes
+
+// AddUploadedImage is addUploadedImage, for tests that can't decode an
+// upload without libvips.
+var AddUploadedImage = addUploadedImage
@@ -0,0 +1,659 @@
+package routes
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+
+	"viz/internal/dto"
+	"viz/internal/entities"
+	"viz/internal/federation"
+	libhttp "viz/internal/http"
+	"viz/internal/images"
+	"viz/internal/jobs"
+	"viz/internal/jobs/workers"
+	"viz/internal/policy"
+	"viz/internal/uid"
+)
+
+var (
+	errPeerNotTrusted      = errors.New("server isn't a trusted peer")
+	errPeerBlocked         = errors.New("server is blocked")
+	errPeerUndiscoverable  = errors.New("server can't be discovered")
+	errPeerExists          = errors.New("peer already added")
+	errMirrorOwnCollection = errors.New("can't mirror a collection on this server")
+)
+
+// writeFederationError answers for the errors the federation routes return.
+func writeFederationError(res http.ResponseWriter, req *http.Request, logger *slog.Logger, err error) {
+	var statusErr *federation.StatusError
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		render.Status(req, http.StatusNotFound)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Not found"})
+	case errors.Is(err, federation.ErrUnsigned), errors.Is(err, federation.ErrInvalidSignature), errors.Is(err, federation.ErrStaleSignature):
+		render.Status(req, http.StatusUnauthorized)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Missing or invalid request signature"})
+	case errors.Is(err, errPeerNotTrusted):
+		render.Status(req, http.StatusForbidden)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Server isn't a trusted peer"})
+	case errors.Is(err, errPeerBlocked):
+		render.Status(req, http.StatusForbidden)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Server is blocked"})
+	case errors.Is(err, federation.ErrInvalidURI):
+		render.Status(req, http.StatusBadRequest)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Invalid viz URI"})
+	case errors.Is(err, federation.ErrInvalidServerURL):
+		render.Status(req, http.StatusBadRequest)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Server URL must be an http or https origin"})
+	case errors.Is(err, errMirrorOwnCollection):
+		render.Status(req, http.StatusBadRequest)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Collections on this server can't be mirrored"})
+	case errors.Is(err, errPeerExists):
+		render.Status(req, http.StatusConflict)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Peer already added"})
+	case errors.Is(err, workers.ErrMirrorSyncPending):
+		render.Status(req, http.StatusConflict)
+		render.JSON(res, req, dto.ErrorResponse{Error: "A sync is already queued or running"})
+	case errors.Is(err, errPeerUndiscoverable):
+		logger.Warn("federation peer can't be discovered", slog.Any("error", err))
+		render.Status(req, http.StatusBadGateway)
+		render.JSON(res, req, dto.ErrorResponse{Error: "The remote server can't be reached"})
+	case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound:
+		render.Status(req, http.StatusNotFound)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Not found on the remote server"})
+	case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusForbidden:
+		render.Status(req, http.StatusForbidden)
+		render.JSON(res, req, dto.ErrorResponse{Error: "The remote server doesn't trust this one yet"})
+	case statusErr != nil:
+		logger.Warn("federation request failed", slog.Any("error", err))
+		render.Status(req, http.StatusBadGateway)
+		render.JSON(res, req, dto.ErrorResponse{Error: "The remote server can't be reached"})
+	default:
+		libhttp.ServerError(res, req, err, logger, nil,
+			"federation request failed",
+			"Something went wrong, please try again later",
+		)
+	}
+}
+
+// requireTrustedPeer lets through requests signed by a trusted peer, with
+// the key it had at its last handshake.
+func requireTrustedPeer(db *gorm.DB, logger *slog.Logger, instance *federation.Instance) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			var peer entities.FederationPeer
+			_, err := instance.Verify(req, func(ctx context.Context, serverURL string) (ed25519.PublicKey, error) {
+				if err := db.WithContext(ctx).Where("url = ?", serverURL).First(&peer).Error; err != nil {
+					if errors.Is(err, gorm.ErrRecordNotFound) {
+						return nil, errPeerNotTrusted
+					}
+					return nil, err
+				}
+
+				if peer.Status != dto.FederationPeerStatusTrusted {
+					return nil, errPeerNotTrusted
+				}
+
+				return base64.StdEncoding.DecodeString(peer.PublicKey)
+			})
+			if err != nil {
+				writeFederationError(res, req, logger, err)
+				return
+			}
+
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+// sendHandshake tells peer whether this server trusts it, and records
+// whether it trusts this server back.
+func sendHandshake(ctx context.Context, db *gorm.DB, instance *federation.Instance, peer *entities.FederationPeer) error {
+	var answer dto.FederationHandshake
+	err := instance.Call(ctx, http.MethodPost, peer.FederationEndpoint+"/handshake", dto.FederationHandshake{
+		Server: instance.URL,
+		Status: dto.FederationHandshakeStatus(peer.Status),
+	}, &answer)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	peer.RemoteStatus = dto.FederationPeerRemoteStatus(answer.Status)
+	peer.LastHandshakeAt = &now
+	return db.Model(peer).Updates(map[string]any{
+		"remote_status":     peer.RemoteStatus,
+		"last_handshake_at": now,
+	}).Error
+}
+
+// remoteImage is img as peers are given it.
+func remoteImage(instance *federation.Instance, img *entities.ImageAsset) dto.RemoteImage {
+	remote := dto.RemoteImage{
+		Uid:         img.Uid,
+		Uri:         instance.URI(federation.ResourceImages, img.Uid).String(),
+		Name:        img.Name,
+		Description: img.Description,
+		Width:       int(img.Width),
+		Height:      int(img.Height),
+		TakenAt:     img.TakenAt,
+		UpdatedAt:   img.UpdatedAt,
+	}
+
+	if img.ImageMetadata != nil {
+		remote.FileName = img.ImageMetadata.FileName
+		remote.Checksum = img.ImageMetadata.Checksum
+	}
+
+	return remote
+}
+
+// findPublicImage gets image imageUid if anyone may see it.
+func findPublicImage(db *gorm.DB, imageUid string) (*entities.ImageAsset, error) {
+	var img entities.ImageAsset
+	if err := db.Scopes(policy.VisibleImages(nil)).Where("uid = ?", imageUid).First(&img).Error; err != nil {
+		return nil, err
+	}
+
+	return &img, nil
+}
+
+// FederationRouter serves other Viz servers (RFC 001): the handshake that
+// establishes trust, and the public collections and images trusted peers
+// mirror, all over requests signed with the peer's key. Admins manage peers
+// under /peers; users mirror remote collections under /mirrors.
+func FederationRouter(db *gorm.DB, logger *slog.Logger, instance *federation.Instance) *chi.Mux {
+	router := chi.NewRouter()
+
+	router.Post("/handshake", func(res http.ResponseWriter, req *http.Request) {
+		// The sender may not be known yet, so its key comes from its
+		// discovery document
+		var doc *federation.Document
+		server, err := instance.Verify(req, func(ctx context.Context, serverURL string) (ed25519.PublicKey, error) {
+			discovered, err := instance.Discover(ctx, serverURL)
+			if err != nil {
+				return nil, errors.Join(errPeerUndiscoverable, err)
+			}
+			doc = discovered
+			return doc.Key()
+		})
+		if errors.Is(err, errPeerUndiscoverable) {
+			logger.Warn("handshake from a server that can't be discovered", slog.Any("error", err))
+			render.Status(req, http.StatusBadRequest)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Sender can't be discovered"})
+			return
+		}
+		if err != nil {
+			writeFederationError(res, req, logger, err)
+			return
+		}
+
+		var handshake dto.FederationHandshake
+		if err := render.DecodeJSON(req.Body, &handshake); err != nil || handshake.Server != server {
+			render.Status(req, http.StatusBadRequest)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Invalid request body"})
+			return
+		}
+
+		now := time.Now().UTC()
+		var peer entities.FederationPeer
+		err = db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Where("url = ?", server).First(&peer).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				peerUid, err := uid.Generate()
+				if err != nil {
+					return err
+				}
+				// Strangers wait for an admin to trust them
+				peer = entities.FederationPeer{Uid: peerUid, Url: server, Status: dto.FederationPeerStatusPending}
+			} else if err != nil {
+				return err
+			}
+
+			if peer.Status == dto.FederationPeerStatusBlocked {
+				return errPeerBlocked
+			}
+
+			peer.Name = doc.Server.Name
+			peer.PublicKey = doc.PublicKey
+			peer.FederationEndpoint = doc.Endpoints.Federation
+			peer.RemoteStatus = dto.FederationPeerRemoteStatus(handshake.Status)
+			peer.LastHandshakeAt = &now
+			return tx.Save(&peer).Error
+		})
+		if err != nil {
+			writeFederationError(res, req, logger, err)
+			return
+		}
+
+		render.Status(req, http.StatusOK)
+		render.JSON(res, req, dto.FederationHandshake{
+			Server: instance.URL,
+			Status: dto.FederationHandshakeStatus(peer.Status),
+		})
+	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(requireTrustedPeer(db, logger, instance))
+
+		r.Get("/collections/{uid}", func(res http.ResponseWriter, req *http.Request) {
+			var collection entities.Collection
+			err := db.Scopes(policy.VisibleCollections(nil)).Where("uid = ?", chi.URLParam(req, "uid")).First(&collection).Error
+			if err != nil {
+				writeFederationError(res, req, logger, err)
+				return
+			}
+
+			var imageUids []string
+			if collection.Images != nil {
+				imageUids = lo.Map(*collection.Images, func(img dto.CollectionImage, _ int) string { return img.Uid })
+			}
+
+			var found []entities.ImageAsset
+			if len(imageUids) > 0 {
+				if err := db.Scopes(policy.VisibleImages(nil)).Where("uid IN ?", imageUids).Find(&found).Error; err != nil {
+					writeFederationError(res, req, logger, err)
+					return
+				}
+			}
+
+			byUid := lo.SliceToMap(found, func(img entities.ImageAsset) (string, *entities.ImageAsset) { return img.Uid, &img })
+			remote := dto.RemoteCollection{
+				Uid:         collection.Uid,
+				Uri:         instance.URI(federation.ResourceCollections, collection.Uid).String(),
+				Name:        collection.Name,
+				Description: collection.Description,
+				Images:      []dto.RemoteImage{},
+				UpdatedAt:   collection.UpdatedAt,
+			}
+			for _, imageUid := range imageUids {
+				if img, ok := byUid[imageUid]; ok {
+					remote.Images = append(remote.Images, remoteImage(instance, img))
+				}
+			}
+
+			render.Status(req, http.StatusOK)
+			render.JSON(res, req, remote)
+		})
+
+		r.Get("/images/{uid}", func(res http.ResponseWriter, req *http.Request) {
+			img, err := findPublicImage(db, chi.URLParam(req, "uid"))
+			if err != nil {
+				writeFederationError(res, req, logger, err)
+				return
+			}
+
+			render.Status(req, http.StatusOK)
+			render.JSON(res, req, remoteImage(instance, img))
+		})
+
+		r.Get("/images/{uid}/file", func(res http.ResponseWriter, req *http.Request) {
+			img, err := findPublicImage(db, chi.URLParam(req, "uid"))
+			if err == nil && img.ImageMetadata == nil {
+				err = gorm.ErrRecordNotFound
+			}
+			if err != nil {
+				writeFederationError(res, req, logger, err)
+				return
+			}
+
+			f, err := os.Open(images.GetImagePath(img.Uid, img.ImageMetadata.FileName))
+			if err != nil {
+				libhttp.ServerError(res, req, err, logger, nil,
+					"failed to open image for peer",
+					"Something went wrong, please try again later",
+				)
+				return
+			}
+			defer f.Close()
+
+			http.ServeContent(res, req, img.ImageMetadata.FileName, img.UpdatedAt, f)
+		})
+	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(libhttp.AuthMiddleware(db, logger))
+		r.Use(libhttp.UserAuthMiddleware)
+
+		r.Get("/resolve", func(res http.ResponseWriter, req *http.Request) {
+			uri, err := federation.ParseURI(req.URL.Query().Get("uri"))
+			if err != nil {
+				writeFederationError(res, req, logger, err)
+				return
+			}
+
+			resolved, err := instance.Resolve(req.Context(), uri)
+			if err != nil {
+				writeFederationError(res, req, logger, errors.Join(errPeerUndiscoverable, err))
+				return
+			}
+
+			peerStatus := dto.Unknown
+			var peer entities.FederationPeer
+			if err := db.Where("url = ?", resolved.Server.Server.URL).First(&peer).Error; err == nil {
+				peerStatus = dto.ResolvedURIPeerStatus(peer.Status)
+			} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+				writeFederationError(res, req, logger, err)
+				return
+			}
+
+			resourceType := dto.Images
+			if uri.IsCollection() {
+				resourceType = dto.Collections
+			}
+
+			render.Status(req, http.StatusOK)
+			render.JSON(res, req, dto.ResolvedURI{
+				Uri:          uri.String(),
+				ServerUrl:    resolved.Server.Server.URL,
+				ServerName:   resolved.Server.Server.Name,
+				ResourceType: resourceType,
+				ResourceId:   uri.ID,
+				Endpoint:     resolved.Endpoint,
+				PeerStatus:   peerStatus,
+			})
+		})
+
+		r.Route("/peers", federationPeerRoutes(db, logger, instance))
+		r.Route("/mirrors", collectionMirrorRoutes(db, logger, instance))
+	})
+
+	return router
+}
+
+// federationPeerRoutes serves /federation/peers, where admins choose which
+// servers to trust.
+func federationPeerRoutes(db *gorm.DB, logger *slog.Logger, instance *federation.Instance) func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Use(libhttp.AdminMiddleware)
+
+		r.Get("/", func(res http.ResponseWriter, req *http.Request) {
+			var peers []entities.FederationPeer
+			if err := db.Order("created_at DESC").Find(&peers).Error; err != nil {
+				writeFederationError(res, req, logger, err)
+				return
+			}
+
+			render.Status(req, http.StatusOK)
+			render.JSON(res, req, dto.FederationPeerList{
+				Items: lo.Map(peers, func(p entities.FederationPeer, _ int) dto.FederationPeer { return p.DTO() }),
+			})
+		})
+
+		r.Post("/", func(res http.ResponseWriter, req *http.Request) {
+			var create dto.FederationPeerCreate
+			if err := render.DecodeJSON(req.Body, &create); err != nil {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Invalid request body"})
+				return
+			}
+
+			serverURL, err := federation.NormalizeServerURL(create.Url)
+			if err == nil && serverURL == instance.URL {
+				err = federation.ErrInvalidServerURL
+			}
+			if err != nil {
+				writeFederationError(res, req, logger, err)
+				return
+			}
+
+			if err := db.Where("url = ?", serverURL).First(&entities.FederationPeer{}).Error; err == nil {
+				writeFederationError(res, req, logger, errPeerExists)
+				return
+			} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+				writeFederationError(res, req, logger, err)
+				return
+			}
+
+			doc, err := instance.Discover(req.Context(), serverURL)
+			if err != nil {
+				writeFederationError(res, req, logger, errors.Join(errPeerUndiscoverable, err))
+				return
+			}
+
+			peerUid, err := uid.Generate()
+			if err != nil {
+				writeFederationError(res, req, logger, err)
+				return
+			}
+
+			peer := entities.FederationPeer{
+				Uid:                peerUid,
+				Url:                serverURL,
+				Name:               doc.Server.Name,
+				PublicKey:          doc.PublicKey,
+				FederationEndpoint: doc.Endpoints.Federation,
+				Status:             dto.FederationPeerStatusTrusted,
+				RemoteStatus:       dto.FederationPeerRemoteStatusUnknown,
+			}
+			if err := db.Create(&peer).Error; err != nil {
+				writeFederationError(res, req, logger, err)
+				return
+			}
+
+			// The peer is trusted either way; it may just not know yet
+			if err := sendHandshake(req.Context(), db, instance, &peer); err != nil {
+				logger.Warn("handshake with new peer failed", slog.String("peer", peer.Url), slog.Any("error", err))
+			}
+
+			render.Status(req, http.StatusCreated)
+			render.JSON(res, req, peer.DTO())
+		})
+
+		r.Patch("/{uid}", func(res http.ResponseWriter, req *http.Request) {
+			var update dto.FederationPeerUpdate
+			if err := render.DecodeJSON(req.Body, &update); err != nil ||
+				(update.Status != dto.FederationPeerUpdateStatusTrusted && update.Status != dto.FederationPeerUpdateStatusBlocked) {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Invalid request body"})
+				return
+			}
+
+			var peer entities.FederationPeer
+			if err := db.Where("uid = ?", chi.URLParam(req, "uid")).First(&peer).Error; err != nil {
+				writeFederationError(res, req, logger, err)
+				return
+			}
+
+			peer.Status = dto.FederationPeerStatus(update.Status)
+			if err := db.Model(&peer).Update("status", peer.Status).Error; err != nil {
+				writeFederationError(res, req, logger, err)
+				return
+			}
+
+			if err := sendHandshake(req.Context(), db, instance, &peer); err != nil {
+				logger.Warn("handshake with peer failed", slog.String("peer", peer.Url), slog.Any("error", err))
+			}
+
+			render.Status(req, http.StatusOK)
+			render.JSON(res, req, peer.DTO())
+		})
+
+		r.Delete("/{uid}", func(res http.ResponseWriter, req *http.Request) {
+			// Removed for good, so the server can be added again
+			result := db.Unscoped().Where("uid = ?", chi.URLParam(req, "uid")).Delete(&entities.FederationPeer{})
+			if result.Error == nil && result.RowsAffected == 0 {
+				result.Error = gorm.ErrRecordNotFound
+			}
+			if result.Error != nil {
+				writeFederationError(res, req, logger, result.Error)
+				return
+			}
+
+			res.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// collectionMirrorRoutes serves /federation/mirrors, where users keep local
+// copies of public collections on trusted peers. Each user sees their own.
+func collectionMirrorRoutes(db *gorm.DB, logger *slog.Logger, instance *federation.Instance) func(r chi.Router) {
+	findMirror := func(req *http.Request) (entities.CollectionMirror, error) {
+		var mirror entities.CollectionMirror
+		err := db.Preload("CreatedBy").
+			Where("uid = ? AND created_by_id = ?", chi.URLParam(req, "uid"), requestUser(req).Uid).
+			First(&mirror).Error
+		return mirror, err
+	}
+
+	return func(r chi.Router) {
+		r.Get("/", func(res http.ResponseWriter, req *http.Request) {
+			var mirrors []entities.CollectionMirror
+			err := db.Preload("CreatedBy").Where("created_by_id = ?", requestUser(req).Uid).
+				Order("created_at DESC").Find(&mirrors).Error
+			if err != nil {
+				writeFederationError(res, req, logger, err)
+				return
+			}
+
+			render.Status(req, http.StatusOK)
+			render.JSON(res, req, dto.CollectionMirrorList{
+				Items: lo.Map(mirrors, func(m entities.CollectionMirror, _ int) dto.CollectionMirror { return m.DTO() }),
+			})
+		})
+
+		r.Post("/", func(res http.ResponseWriter, req *http.Request) {
+			var create dto.CollectionMirrorCreate
+			if err := render.DecodeJSON(req.Body, &create); err != nil {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Invalid request body"})
+				return
+			}
+
+			uri, err := federation.ParseURI(create.Uri)
+			if err == nil && !uri.IsCollection() {
+				err = federation.ErrInvalidURI
+			}
+			if err == nil && uri.Authority == instance.Authority() {
+				err = errMirrorOwnCollection
+			}
+			if err != nil {
+				writeFederationError(res, req, logger, err)
+				return
+			}
+
+			var peer entities.FederationPeer
+			err = db.Where("url = ?", instance.ServerURL(uri.Authority)).First(&peer).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && peer.Status != dto.FederationPeerStatusTrusted) {
+				err = errPeerNotTrusted
+			}
+			if err != nil {
+				writeFederationError(res, req, logger, err)
+				return
+			}
+
+			// Check it's there and shared with us before making anything
+			var remote dto.RemoteCollection
+			endpoint := peer.FederationEndpoint + "/collections/" + url.PathEscape(uri.ID)
+			if err := instance.Call(req.Context(), http.MethodGet, endpoint, nil, &remote); err != nil {
+				writeFederationError(res, req, logger, err)
+				return
+			}
+
+			authUser := requestUser(req)
+			var mirror entities.CollectionMirror
+			err = db.Transaction(func(tx *gorm.DB) error {
+				collectionUid, err := uid.Generate()
+				if err != nil {
+					return err
+				}
+				mirrorUid, err := uid.Generate()
+				if err != nil {
+					return err
+				}
+
+				collection := entities.Collection{
+					Uid:         collectionUid,
+					Name:        remote.Name,
+					Description: remote.Description,
+					Private:     lo.ToPtr(true),
+					CreatedByID: &authUser.Uid,
+					OwnerID:     &authUser.Uid,
+					MirrorUid:   &mirrorUid,
+				}
+				if err := tx.Create(&collection).Error; err != nil {
+					return err
+				}
+
+				mirror = entities.CollectionMirror{
+					Uid:           mirrorUid,
+					CollectionUid: collectionUid,
+					PeerUid:       peer.Uid,
+					RemoteUri:     uri.String(),
+					Status:        dto.CollectionMirrorStatusQueued,
+					Images:        []dto.MirroredImage{},
+					CreatedByID:   &authUser.Uid,
+				}
+				return tx.Create(&mirror).Error
+			})
+			if err == nil {
+				_, err = jobs.Enqueue(db, workers.TopicFederationSync, jobs.PriorityNormal, workers.FederationSyncJob{MirrorUid: mirror.Uid}, nil, nil)
+			}
+			if err != nil {
+				writeFederationError(res, req, logger, err)
+				return
+			}
+
+			mirror.CreatedBy = authUser
+			render.Status(req, http.StatusAccepted)
+			render.JSON(res, req, mirror.DTO())
+		})
+
+		r.Get("/{uid}", func(res http.ResponseWriter, req *http.Request) {
+			mirror, err := findMirror(req)
+			if err != nil {
+				writeFederationError(res, req, logger, err)
+				return
+			}
+
+			render.Status(req, http.StatusOK)
+			render.JSON(res, req, mirror.DTO())
+		})
+
+		r.Delete("/{uid}", func(res http.ResponseWriter, req *http.Request) {
+			mirror, err := findMirror(req)
+			if err == nil {
+				// The collection stays, as an ordinary one
+				err = db.Transaction(func(tx *gorm.DB) error {
+					if err := tx.Model(&entities.Collection{}).Where("uid = ?", mirror.CollectionUid).Update("mirror_uid", nil).Error; err != nil {
+						return err
+					}
+					return tx.Delete(&mirror).Error
+				})
+			}
+			if err != nil {
+				writeFederationError(res, req, logger, err)
+				return
+			}
+
+			res.WriteHeader(http.StatusNoContent)
+		})
+
+		r.Post("/{uid}/sync", func(res http.ResponseWriter, req *http.Request) {
+			mirror, err := findMirror(req)
+			if err == nil {
+				_, err = workers.EnqueueMirrorSync(db, &mirror, jobs.PriorityInteractive)
+			}
+			if err != nil {
+				writeFederationError(res, req, logger, err)
+				return
+			}
+
+			render.Status(req, http.StatusAccepted)
+			render.JSON(res, req, mirror.DTO())
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package routes_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"viz/api/routes"
+	"viz/internal/dto"
+	"viz/internal/entities"
+	"viz/internal/federation"
+	libhttp "viz/internal/http"
+)
+
+// fedServer is an in-process server with its own database.
+type fedServer struct {
+	db       *gorm.DB
+	instance *federation.Instance
+}
+
+func newFederatedServer(t *testing.T, name string) *fedServer {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file:"+name+"?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(
+		&entities.User{},
+		&entities.ImageAsset{},
+		&entities.Collection{},
+		&entities.FederationPeer{},
+		&entities.CollectionMirror{},
+	))
+
+	_, key, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	instance := &federation.Instance{Name: name, Key: key, Insecure: true}
+	router := chi.NewRouter()
+	router.Get(federation.WellKnownPath, instance.ServeDiscovery)
+	router.Route("/api", func(r chi.Router) {
+		r.Mount("/federation", routes.FederationRouter(db, newTestLogger(), instance))
+	})
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	instance.URL = server.URL
+	instance.Client = server.Client()
+
+	return &fedServer{db: db, instance: instance}
+}
+
+func TestFederationHandshakeAndCollections(t *testing.T) {
+	ctx := context.Background()
+	a := newFederatedServer(t, "fed_a")
+	b := newFederatedServer(t, "fed_b")
+
+	// b has a public collection with a public and a private image, and a
+	// private collection
+	require.NoError(t, b.db.Create(&[]entities.ImageAsset{
+		{Uid: "pub1", Name: "public", Width: 10, Height: 10, ImageMetadata: &dto.ImageMetadata{FileName: "pub1.jpg", Checksum: "abc"}},
+		{Uid: "priv1", Name: "private", Private: true, ImageMetadata: &dto.ImageMetadata{FileName: "priv1.jpg"}},
+	}).Error)
+	require.NoError(t, b.db.Create(&[]entities.Collection{
+		{Uid: "col1", Name: "Trip", Private: lo.ToPtr(false), Images: &[]dto.CollectionImage{{Uid: "priv1"}, {Uid: "pub1"}}},
+		{Uid: "col2", Name: "Secret", Private: lo.ToPtr(true)},
+	}).Error)
+
+	collectionURL := b.instance.URL + "/api/federation/collections/col1"
+	statusOf := func(err error) int {
+		var statusErr *federation.StatusError
+		if errors.As(err, &statusErr) {
+			return statusErr.StatusCode
+		}
+		return 0
+	}
+
+	// a isn't known to b yet
+	err := a.instance.Call(ctx, http.MethodGet, collectionURL, nil, nil)
+	assert.Equal(t, http.StatusForbidden, statusOf(err))
+
+	// a's handshake makes it known, but b's admin has to trust it
+	var answer dto.FederationHandshake
+	err = a.instance.Call(ctx, http.MethodPost, b.instance.URL+"/api/federation/handshake",
+		dto.FederationHandshake{Server: a.instance.URL, Status: dto.FederationHandshakeStatusTrusted}, &answer)
+	require.NoError(t, err)
+	assert.Equal(t, dto.FederationHandshakeStatusPending, answer.Status)
+	assert.Equal(t, b.instance.URL, answer.Server)
+
+	var peer entities.FederationPeer
+	require.NoError(t, b.db.Where("url = ?", a.instance.URL).First(&peer).Error)
+	assert.Equal(t, dto.FederationPeerStatusPending, peer.Status)
+	assert.Equal(t, dto.FederationPeerRemoteStatusTrusted, peer.RemoteStatus)
+	assert.Equal(t, a.instance.URL+"/api/federation", peer.FederationEndpoint)
+
+	err = a.instance.Call(ctx, http.MethodGet, collectionURL, nil, nil)
+	assert.Equal(t, http.StatusForbidden, statusOf(err))
+
+	require.NoError(t, b.db.Model(&peer).Update("status", dto.FederationPeerStatusTrusted).Error)
+
+	var remote dto.RemoteCollection
+	require.NoError(t, a.instance.Call(ctx, http.MethodGet, collectionURL, nil, &remote))
+	assert.Equal(t, "Trip", remote.Name)
+	assert.Equal(t, b.instance.URI(federation.ResourceCollections, "col1").String(), remote.Uri)
+	if assert.Len(t, remote.Images, 1, "private images aren't served") {
+		assert.Equal(t, "pub1", remote.Images[0].Uid)
+		assert.Equal(t, "abc", remote.Images[0].Checksum)
+	}
+
+	err = a.instance.Call(ctx, http.MethodGet, b.instance.URL+"/api/federation/collections/col2", nil, nil)
+	assert.Equal(t, http.StatusNotFound, statusOf(err))
+
+	err = a.instance.Call(ctx, http.MethodGet, b.instance.URL+"/api/federation/images/priv1", nil, nil)
+	assert.Equal(t, http.StatusNotFound, statusOf(err))
+
+	// Unsigned requests and other servers using a's name get nothing
+	res, err := http.Get(collectionURL)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+	impostor := &federation.Instance{URL: a.instance.URL, Key: otherKey, Client: a.instance.Client, Insecure: true}
+	err = impostor.Call(ctx, http.MethodGet, collectionURL, nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, statusOf(err))
+
+	// Blocked servers can't hand shake again
+	require.NoError(t, b.db.Model(&peer).Update("status", dto.FederationPeerStatusBlocked).Error)
+	err = a.instance.Call(ctx, http.MethodPost, b.instance.URL+"/api/federation/handshake",
+		dto.FederationHandshake{Server: a.instance.URL, Status: dto.FederationHandshakeStatusTrusted}, nil)
+	assert.Equal(t, http.StatusForbidden, statusOf(err))
+}
+
+func TestDeletingMirroredCollectionDeletesMirror(t *testing.T) {
+	db := newTestDB(t)
+	owner := &entities.User{Uid: "mirror_delete_owner", Username: "mirror_delete_owner"}
+
+	router := chi.NewRouter()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			next.ServeHTTP(res, libhttp.WithUser(req, owner))
+		})
+	})
+	router.Mount("/api/collections", routes.CollectionsRouter(db, newTestLogger(), nil))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	require.NoError(t, db.Create(&entities.Collection{
+		Uid:       "mirror_delete_col",
+		Name:      "Mirrored",
+		OwnerID:   &owner.Uid,
+		MirrorUid: lo.ToPtr("mirror_delete"),
+	}).Error)
+	require.NoError(t, db.Create(&entities.CollectionMirror{
+		Uid:           "mirror_delete",
+		CollectionUid: "mirror_delete_col",
+		CreatedByID:   &owner.Uid,
+		PeerUid:       "mirror_delete_peer",
+		Status:        dto.CollectionMirrorStatusSynced,
+	}).Error)
+
+	req, err := http.NewRequest(http.MethodDelete, server.URL+"/api/collections/mirror_delete_col", nil)
+	require.NoError(t, err)
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	var mirrors int64
+	require.NoError(t, db.Model(&entities.CollectionMirror{}).Where("uid = ?", "mirror_delete").Count(&mirrors).Error)
+	assert.Zero(t, mirrors, "the mirror would keep failing to sync")
+}
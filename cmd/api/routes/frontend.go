@@ -148,6 +148,11 @@ func (h *FrontendHandler) serveIndex(w http.ResponseWriter, r *http.Request) {
 	responseHtml := bytes.Replace(indexData, []byte(ThemeStylePlaceholder), []byte(criticalCss), 1)
 	responseHtml = bytes.Replace(responseHtml, []byte(ThemeAttrPlaceholder), []byte(themeAttr), 1)
 
+	// Share pages describe themselves to link previews, which don't run the app
+	if token, imageUid, ok := parseSharePagePath(r.URL.Path); ok {
+		responseHtml = h.injectSharePreview(responseHtml, token, imageUid)
+	}
+
 	// Inject System Status
 	status, err := GetSystemStatus(h.DB, h.Logger, r)
 	configJson := "{}"
@@ -5,9 +5,11 @@ import (
 	"crypto/sha1"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -20,8 +22,10 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 	_ "github.com/joho/godotenv/autoload"
+	"github.com/samber/lo"
 	"gorm.io/gorm"
 
+	"viz/internal/analytics"
 	"viz/internal/config"
 	"viz/internal/downloads"
 	"viz/internal/dto"
@@ -33,8 +37,8 @@ import (
 	"viz/internal/jobs"
 	"viz/internal/jobs/workers"
 	libos "viz/internal/os"
+	"viz/internal/policy"
 	"viz/internal/transform"
-	"viz/internal/uid"
 	"viz/internal/utils"
 )
 
@@ -50,113 +54,13 @@ type ImageUploadError struct {
 	Error     string `json:"error"`
 }
 
-func createNewImageEntity(logger *slog.Logger, fileName string, libvipsImg *libvips.Image) (*entities.ImageAsset, error) {
-	logger.Info("Generating ID", slog.String("file", fileName))
-	id, err := uid.Generate()
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate ID: %w", err)
-	}
-
-	if strings.Trim(fileName, " ") == "" {
-		fileName = id
-	}
-
-	logger = logger.With(
-		slog.String("name", fileName),
-		slog.String("id", id),
-	)
-
-	logger.Info("reading exif data")
-	exifData := libvipsImg.Exif()
-
-	if len(exifData) == 0 {
-		logger.Warn("No exif data found. Blank fields", slog.String("file", fileName))
-	} else {
-		logger.Debug("exif data", slog.Any("data", exifData), slog.Int("length", len(exifData)))
-	}
-
-	exif, fileCreatedAt, fileModifiedAt := imageops.BuildImageEXIF(exifData)
-
-	// If EXIF contains a rating-like value, parse it and set the initial
-	// canonical rating on the image entity (clamped to 0..5). We store the
-	// raw EXIF rating in Exif.Rating as provenance but the top-level Rating
-	// becomes the canonical value once DB column exists / migration runs.
-	var initialRating *int
-	if exif.Rating != nil {
-		if r, err := strconv.Atoi(*exif.Rating); err == nil {
-			if r < 0 {
-				r = 0
-			} else if r > 5 {
-				r = 5
-			}
-			initialRating = &r
-		}
-	}
-
-	var keywords []string
-	keywordsPtr := imageops.FindExif(exifData, "Keywords", "Subject")
-	if keywordsPtr != nil {
-		keywords = strings.Split(*keywordsPtr, ",")
-	}
-
-	label := dto.ImageMetadataLabelNone
-
-	metadata := dto.ImageMetadata{
-		FileName:         fileName,
-		OriginalFileName: &fileName,
-		FileType:         string(libvipsImg.Format()),
-		ColorSpace:       imageops.GetColourSpaceString(libvipsImg),
-		FileModifiedAt:   fileModifiedAt,
-		FileCreatedAt:    fileCreatedAt,
-		Keywords:         &keywords,
-		Label:            &label,
-	}
-
-	// Seed canonical rating into the stored image metadata (NULL = unrated)
-	metadata.Rating = initialRating
-
-	// Construct paths with reasonable defaults matching the {uid}/file route params
-	originalPath := fmt.Sprintf("/images/%s/file", id)
-
-	thumbParams, _ := images.GetPermanentTransformParams(images.TransformThumbnail)
-	previewParams, _ := images.GetPermanentTransformParams(images.TransformPreview)
-
-	thumbnailPath := fmt.Sprintf("/images/%s/file?%s", id, thumbParams.ToQueryString())
-	previewPath := fmt.Sprintf("/images/%s/file?%s", id, previewParams.ToQueryString())
-
-	paths := dto.ImagePaths{
-		Original:  originalPath,
-		Thumbnail: thumbnailPath,
-		Preview:   previewPath,
-	}
-
-	allImageData := entities.ImageAsset{
-		Uid:           id,
-		Name:          fileName,
-		Private:       false,
-		Processed:     false,
-		Exif:          &exif,
-		ImageMetadata: &metadata,
-		ImagePaths:    paths,
-		Width:         int32(libvipsImg.Width()),
-		Height:        int32(libvipsImg.Height()),
-		Description:   nil, // TODO: evaluate if necessary, blank for now
-	}
-
-	ta := imageops.GetTakenAt(allImageData)
-	allImageData.TakenAt = &ta
-
-	return &allImageData, nil
-}
-
 // moveDirWithFallback attempts to rename src->dst. If rename fails (e.g., cross-device),
 // it copies the directory contents to dst and removes the src directory.
 func moveDirWithFallback(src, dst string) error {
 	return libos.MoveDirWithFallback(src, dst)
 }
 
-func ImagesRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
+func ImagesRouter(db *gorm.DB, logger *slog.Logger, limiter *libhttp.Limiter, recorder *analytics.Recorder) *chi.Mux {
 	router := chi.NewRouter()
 
 	// List images with pagination
@@ -198,15 +102,8 @@ func ImagesRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 		if err := db.WithContext(req.Context()).Transaction(func(tx *gorm.DB) error {
 			query := tx.Model(&entities.ImageAsset{}).Where("deleted_at IS NULL")
 
-			// Access Control: Filter private images
-			authUser, ok := libhttp.UserFromContext(req)
-			if ok {
-				// Show: Public OR (Private AND Owned by me)
-				query = query.Where("private = ? OR (private = ? AND owner_id = ?)", false, true, authUser.Uid)
-			} else {
-				// Show: Only Public
-				query = query.Where("private = ?", false)
-			}
+			// Access Control: Show public, my own and those shared with me
+			query = query.Scopes(visibleImages(req))
 
 			// Count total non-deleted images for pagination metadata
 			if err := query.Count(&total).Error; err != nil {
@@ -328,26 +225,32 @@ func ImagesRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			return
 		}
 
+		// Signed URLs were checked by AuthMiddleware, and whoever signed one
+		// could see the image then. Embed URLs of share links are checked
+		// against the link again, so they stop working along with it.
 		isDownload := req.URL.Query().Get("download") == "1"
-		if isDownload {
-			if !validateDownloadRequest(res, req, db, uid) {
+		if libhttp.SignedURLFromContext(req) {
+			if req.URL.Query().Has(shareEmbedParam) && !checkShareEmbed(res, req, db, logger, uid) {
+				return
+			}
+
+			res.Header().Set("Cross-Origin-Resource-Policy", "cross-origin")
+		} else if isDownload {
+			if !validateDownloadRequest(res, req, db, logger, limiter, uid) {
 				return
 			}
 		} else {
-			// Access Control: If private, only owner can view (unless using a valid download token logic, which is handled above)
-			if imgEnt.Private {
-				authUser, ok := libhttp.UserFromContext(req)
-				// If not authenticated or not the owner
-				if !ok || (imgEnt.OwnerID != nil && *imgEnt.OwnerID != authUser.Uid) {
-					// Return 404 to avoid leaking existence
-					render.Status(req, http.StatusNotFound)
-					render.JSON(res, req, dto.ErrorResponse{Error: "Image not found"})
-					return
-				}
+			// Access Control: If private, only the owner and those it is shared
+			// with can view (unless using a valid download token logic, which is
+			// handled above)
+			if !checkImageVisible(res, req, db, logger, &imgEnt) {
+				return
 			}
 		}
 
-		hasTransformParams := params.Format != "" || params.Width > 0 || params.Height > 0 || params.Quality > 0 || params.Rotate > 0 || params.Flip != ""
+		recordImageFile(recorder, req, &imgEnt, params, isDownload, "", "")
+
+		hasTransformParams := params.Format != "" || params.Width > 0 || params.Height > 0 || params.Quality > 0 || params.Rotate > 0 || params.Flip != "" || params.LongEdge > 0 || params.ColorProfile != "" || params.KeepMetadata
 		if !hasTransformParams {
 			serveOriginalImage(res, req, logger, &imgEnt, isDownload)
 			return
@@ -356,6 +259,75 @@ func ImagesRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 		serveTransformedImage(res, req, logger, &imgEnt, params, isDownload)
 	})
 
+	router.Post("/{uid}/signed-url", func(res http.ResponseWriter, req *http.Request) {
+		uid := chi.URLParam(req, "uid")
+
+		var body dto.SignedImageURLCreate
+		if err := render.DecodeJSON(req.Body, &body); err != nil {
+			render.Status(req, http.StatusBadRequest)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Invalid request body"})
+			return
+		}
+
+		expiresIn := lo.FromPtr(body.ExpiresIn)
+		if expiresIn == 0 {
+			expiresIn = int(defaultSignedURLExpiry.Seconds())
+		}
+
+		if expiresIn < 0 || expiresIn > int(maxSignedURLExpiry.Seconds()) {
+			render.Status(req, http.StatusBadRequest)
+			render.JSON(res, req, dto.ErrorResponse{Error: "expires_in must be between 1 second and a year"})
+			return
+		}
+
+		if lo.FromPtr(body.Width) < 0 || lo.FromPtr(body.Height) < 0 || lo.FromPtr(body.LongEdge) < 0 || lo.FromPtr(body.Quality) < 0 || lo.FromPtr(body.Quality) > 100 {
+			render.Status(req, http.StatusBadRequest)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Invalid transform parameters"})
+			return
+		}
+
+		ip := strings.TrimSpace(lo.FromPtr(body.Ip))
+		if ip != "" && net.ParseIP(ip) == nil {
+			render.Status(req, http.StatusBadRequest)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Invalid IP address"})
+			return
+		}
+
+		var imgEnt entities.ImageAsset
+		if err := db.Where("uid = ? AND deleted_at IS NULL", uid).First(&imgEnt).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				render.Status(req, http.StatusNotFound)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Image not found"})
+				return
+			}
+
+			libhttp.ServerError(res, req, err, logger, nil,
+				"failed to get image to sign",
+				"Something went wrong, please try again later",
+			)
+			return
+		}
+
+		// The URL lets anyone see what the signer can see now, and nothing more
+		if !checkImageVisible(res, req, db, logger, &imgEnt) {
+			return
+		}
+
+		params := &transform.TransformParams{
+			Format:   string(lo.FromPtr(body.Format)),
+			Width:    int64(lo.FromPtr(body.Width)),
+			Height:   int64(lo.FromPtr(body.Height)),
+			Quality:  int64(lo.FromPtr(body.Quality)),
+			LongEdge: int64(lo.FromPtr(body.LongEdge)),
+		}
+
+		expiresAt := time.Now().Add(time.Duration(expiresIn) * time.Second).UTC().Truncate(time.Second)
+		render.JSON(res, req, dto.SignedImageURL{
+			Url:       signedImagePath(imgEnt.Uid, params, lo.FromPtr(body.Download), expiresAt, ip),
+			ExpiresAt: expiresAt,
+		})
+	})
+
 	router.Get("/{uid}/exif", func(res http.ResponseWriter, req *http.Request) {
 		uid := chi.URLParam(req, "uid")
 		simple := req.URL.Query().Get("simple") == "true"
@@ -375,6 +347,10 @@ func ImagesRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			return
 		}
 
+		if !checkImageVisible(res, req, db, logger, &imgEnt) {
+			return
+		}
+
 		if simple {
 			if imgEnt.Exif == nil {
 				render.Status(req, http.StatusNotFound)
@@ -433,16 +409,9 @@ func ImagesRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			return
 		}
 
-		// Access Control: If private, only owner can view
-		if imgEnt.Private {
-			authUser, ok := libhttp.UserFromContext(req)
-			// If not authenticated or not the owner
-			if !ok || (imgEnt.OwnerID != nil && *imgEnt.OwnerID != authUser.Uid) {
-				// Return 404 to avoid leaking existence
-				render.Status(req, http.StatusNotFound)
-				render.JSON(res, req, dto.ErrorResponse{Error: "Image not found"})
-				return
-			}
+		// Access Control: If private, only the owner and those it is shared with can view
+		if !checkImageVisible(res, req, db, logger, &imgEnt) {
+			return
 		}
 
 		render.Status(req, http.StatusOK)
@@ -465,12 +434,43 @@ func ImagesRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 				return e.Error
 			}
 
-			// Access Control: Only owner can update
-			authUser, ok := libhttp.UserFromContext(req)
-			if !ok || (img.OwnerID != nil && *img.OwnerID != authUser.Uid) {
+			// Access Control: The owner and their group's members can update,
+			// but only owners decide who it belongs to and who can see it
+			authUser := requestUser(req)
+			role, err := policy.ImageRole(tx, &img, authUser)
+			if err != nil {
+				return err
+			}
+
+			needed := policy.Editor
+			if update.Private != nil || update.OwnerUid != nil || update.OwnerGroupUid != nil {
+				needed = policy.Owner
+			}
+
+			allowed, err := keyAllowsImages(tx, req, img.Uid)
+			if err != nil {
+				return err
+			}
+
+			if role < policy.Viewer || !allowed {
+				return gorm.ErrRecordNotFound
+			}
+
+			if role < needed {
 				return fmt.Errorf("unauthorized")
 			}
 
+			// Only members of a group can give it an image
+			if groupUid := lo.FromPtr(update.OwnerGroupUid); groupUid != "" {
+				allowed, err := checkGroupRole(tx, authUser, groupUid)
+				if err != nil {
+					return err
+				}
+				if !allowed {
+					return fmt.Errorf("unauthorized")
+				}
+			}
+
 			updateImageFromDTO(&img, update)
 
 			if err := tx.Save(&img).Error; err != nil {
@@ -478,7 +478,7 @@ func ImagesRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			}
 
 			// send updated data
-			if err := tx.Preload("Owner").Preload("UploadedBy").First(&img, "uid = ?", uid).Error; err != nil {
+			if err := tx.Preload("Owner").Preload("UploadedBy").Preload("OwnerGroup").First(&img, "uid = ?", uid).Error; err != nil {
 				return err
 			}
 
@@ -505,7 +505,7 @@ func ImagesRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 		}
 
 		logger.Info("triggering background xmp update", slog.String("uid", img.Uid))
-		_, err = jobs.Enqueue(db, workers.TopicXMPGeneration, &workers.XMPGenerationJob{Image: img}, nil, &img.Uid)
+		_, err = jobs.Enqueue(db, workers.TopicXMPGeneration, jobs.PriorityNormal, &workers.XMPGenerationJob{Image: img}, nil, &img.Uid)
 		if err != nil {
 			logger.Error("failed to enqueue xmp generation job", slog.Any("error", err))
 		}
@@ -520,6 +520,19 @@ func ImagesRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 	router.Get("/{uid}/download", func(res http.ResponseWriter, req *http.Request) {
 		uid := chi.URLParam(req, "uid")
 
+		var imgEnt entities.ImageAsset
+		if err := db.First(&imgEnt, "uid = ?", uid).Error; err != nil {
+			render.Status(req, http.StatusNotFound)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Image not found"})
+			return
+		}
+
+		// The token lets anyone holding it download the image, so only hand
+		// one out to someone who can see it
+		if !checkImageVisible(res, req, db, logger, &imgEnt) {
+			return
+		}
+
 		// Create a short-lived opaque token and redirect to the file URL
 		token, err := downloads.CreateToken(db, []string{uid}, 5*time.Minute)
 		if err != nil {
@@ -533,6 +546,10 @@ func ImagesRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 	})
 
 	router.Post("/", func(res http.ResponseWriter, req *http.Request) {
+		if !checkKeyUnlimited(res, req) {
+			return
+		}
+
 		var fileImageUpload dto.ImageUploadRequest
 
 		// Parse the multipart form in the request
@@ -600,7 +617,7 @@ func ImagesRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 		}
 		defer libvipsImg.Close()
 
-		imageEntity, err := createNewImageEntity(logger, fileImageUpload.FileName, libvipsImg)
+		imageEntity, err := imageops.NewImageEntity(logger, fileImageUpload.FileName, libvipsImg)
 		if err != nil {
 			logger.Error("Failed to process image data", slog.Any("error", err))
 			render.Status(req, http.StatusInternalServerError)
@@ -664,7 +681,7 @@ func ImagesRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			return
 		}
 
-		jobUid, err := jobs.Enqueue(db, workers.TopicImageProcess, workerJob, nil, &imageEntity.Uid)
+		jobUid, err := jobs.Enqueue(db, workers.TopicImageProcess, jobs.PriorityInteractive, workerJob, nil, &imageEntity.Uid)
 		if err != nil {
 			logger.Error("Failed to create image", slog.Any("error", err))
 			render.Status(req, http.StatusInternalServerError)
@@ -695,6 +712,10 @@ func ImagesRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			return
 		}
 
+		if !checkKeyUnlimited(res, req) {
+			return
+		}
+
 		imageUrlBytes, err := io.ReadAll(req.Body)
 
 		if err != nil {
@@ -735,7 +756,7 @@ func ImagesRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			return
 		}
 		defer libvipsImg.Close()
-		imageEntity, err := createNewImageEntity(logger, fileName, libvipsImg)
+		imageEntity, err := imageops.NewImageEntity(logger, fileName, libvipsImg)
 
 		if err != nil {
 			logger.Error("Failed to process image data", slog.Any("error", err))
@@ -799,7 +820,7 @@ func ImagesRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			return
 		}
 
-		_, err = jobs.Enqueue(db, workers.TopicImageProcess, workerJob, nil, &imageEntity.Uid)
+		_, err = jobs.Enqueue(db, workers.TopicImageProcess, jobs.PriorityInteractive, workerJob, nil, &imageEntity.Uid)
 		if err != nil {
 			logger.Error("Failed to process image", slog.Any("error", err))
 			render.Status(req, http.StatusInternalServerError)
@@ -846,8 +867,8 @@ func ImagesRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 		var anyFailed bool
 
 		// Get authenticated user
-		authUser, ok := libhttp.UserFromContext(req)
-		if !ok {
+		authUser := requestUser(req)
+		if authUser == nil {
 			render.Status(req, http.StatusUnauthorized)
 			render.JSON(res, req, dto.ErrorResponse{Error: "Unauthorized"})
 			return
@@ -858,9 +879,20 @@ func ImagesRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			var deleted bool
 			var errMsg *string
 
-			// Check ownership before deleting
+			// Check ownership before deleting. Owners of the image's group
+			// can delete it too.
 			var img entities.ImageAsset
-			if err := db.Select("owner_id").First(&img, "uid = ?", id).Error; err != nil {
+			var role policy.Role
+			var allowed bool
+			err := db.Select("uid", "private", "owner_id", "owner_group_id").First(&img, "uid = ?", id).Error
+			if err == nil {
+				role, err = policy.ImageRole(db, &img, authUser)
+			}
+			if err == nil {
+				allowed, err = keyAllowsImages(db, req, id)
+			}
+
+			if err != nil {
 				if err != gorm.ErrRecordNotFound {
 					logger.Error("failed to check ownership", slog.String("uid", id), slog.Any("error", err))
 					e := "failed to check ownership"
@@ -868,7 +900,7 @@ func ImagesRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 				}
 				// If not found, we can't delete it anyway, so let it proceed to fail naturally or skip
 			} else {
-				if img.OwnerID != nil && *img.OwnerID != authUser.Uid {
+				if role < policy.Owner || !allowed {
 					e := "permission denied"
 					errMsg = &e
 					deleted = false
@@ -1119,25 +1151,25 @@ func serveTransformedImage(res http.ResponseWriter, req *http.Request, logger *s
 	res.Write(tresult.ImageData)
 }
 
-func validateDownloadRequest(res http.ResponseWriter, req *http.Request, db *gorm.DB, uid string) bool {
-	token := req.URL.Query().Get("token")
-	password := req.URL.Query().Get("password")
+const (
+	defaultSignedURLExpiry = 24 * time.Hour
+	maxSignedURLExpiry     = 365 * 24 * time.Hour
+)
 
-	if token == "" {
-		render.Status(req, http.StatusBadRequest)
-		render.JSON(res, req, dto.ErrorResponse{Error: "Missing token query param"})
-		return false
+// signedImagePath signs the file path of the image uid with params, so it
+// can be shown to people who can't sign in, such as on other sites.
+func signedImagePath(imageUid string, params *transform.TransformParams, download bool, expires time.Time, ip string) string {
+	query, _ := url.ParseQuery(params.ToQueryString())
+	if download {
+		query.Set("download", "1")
 	}
 
-	uids, tokenEntity, ok := downloads.ValidateTokenWithPassword(db, token, password)
+	return libhttp.SignURL(fmt.Sprintf("/images/%s/file", imageUid), query, expires, ip)
+}
+
+func validateDownloadRequest(res http.ResponseWriter, req *http.Request, db *gorm.DB, logger *slog.Logger, limiter *libhttp.Limiter, uid string) bool {
+	uids, tokenEntity, ok := checkDownloadToken(res, req, db, limiter)
 	if !ok {
-		if tokenEntity != nil && tokenEntity.Password != nil {
-			render.Status(req, http.StatusUnauthorized)
-			render.JSON(res, req, dto.ErrorResponse{Error: "Invalid or missing password"})
-			return false
-		}
-		render.Status(req, http.StatusUnauthorized)
-		render.JSON(res, req, dto.ErrorResponse{Error: "Invalid or expired token"})
 		return false
 	}
 
@@ -1147,11 +1179,7 @@ func validateDownloadRequest(res http.ResponseWriter, req *http.Request, db *gor
 		return false
 	}
 
-	if !downloads.ValidateEmbedAccess(tokenEntity, req) {
-		render.Status(req, http.StatusForbidden)
-		render.JSON(res, req, dto.ErrorResponse{Error: "Embedding not allowed for this token"})
-		return false
-	}
+	downloads.SetEmbedPolicy(res, tokenEntity)
 
 	if !slices.Contains(uids, uid) {
 		render.Status(req, http.StatusUnauthorized)
@@ -1159,7 +1187,7 @@ func validateDownloadRequest(res http.ResponseWriter, req *http.Request, db *gor
 		return false
 	}
 
-	return true
+	return recordTokenDownload(res, req, db, logger, tokenEntity, []string{uid})
 }
 
 // updateImageFromDTO updates image entity fields from a small ImageUpdate
@@ -1222,4 +1250,12 @@ func updateImageFromDTO(image *entities.ImageAsset, update dto.ImageUpdate) {
 	if update.OwnerUid != nil {
 		image.OwnerID = update.OwnerUid
 	}
+
+	if update.OwnerGroupUid != nil {
+		if *update.OwnerGroupUid == "" {
+			image.OwnerGroupID = nil
+		} else {
+			image.OwnerGroupID = update.OwnerGroupUid
+		}
+	}
 }
@@ -23,12 +23,33 @@ import (
 	"viz/internal/transform"
 )
 
+// standaloneConcurrencyMessage is returned when concurrency is changed on an API
+// server whose jobs run on standalone workers.
+const standaloneConcurrencyMessage = "Concurrency is set on the standalone workers (worker -concurrency)"
+
 type ActiveBrief struct {
 	Uid      string         `json:"uid"`
 	ImageUid *string        `json:"image_uid,omitempty"`
 	Topic    string         `json:"topic"`
 	Type     string         `json:"type"`
 	Status   jobs.JobStatus `json:"status"`
+	Priority jobs.Priority  `json:"priority"`
+}
+
+// jobPriority resolves the priority lane for a job request. Single-image
+// requests default to interactive so they skip ahead of bulk reprocessing.
+func jobPriority(body dto.WorkerJobCreateRequest) (jobs.Priority, error) {
+	fallback := jobs.PriorityBulk
+	if body.Uids != nil && len(*body.Uids) == 1 {
+		fallback = jobs.PriorityInteractive
+	}
+
+	requested := ""
+	if body.Priority != nil {
+		requested = *body.Priority
+	}
+
+	return jobs.ParsePriority(requested, fallback)
 }
 
 // handleImageProcessing processes image processing job requests
@@ -41,6 +62,13 @@ func handleImageProcessing(db *gorm.DB, logger *slog.Logger, body dto.WorkerJobC
 	var count int64
 	var err error
 
+	priority, err := jobPriority(body)
+	if err != nil {
+		render.Status(req, http.StatusBadRequest)
+		render.JSON(res, req, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
 	// If UIDs provided and only one, treat as a single target
 	if body.Uids != nil && len(*body.Uids) == 1 {
 		var img entities.ImageAsset
@@ -51,7 +79,7 @@ func handleImageProcessing(db *gorm.DB, logger *slog.Logger, body dto.WorkerJobC
 		}
 
 		job := &workers.ImageProcessJob{Image: img}
-		_, err := jobs.Enqueue(db, workers.TopicImageProcess, job, nil, &img.Uid)
+		_, err := jobs.Enqueue(db, workers.TopicImageProcess, priority, job, nil, &img.Uid)
 		if err != nil {
 			render.Status(req, http.StatusInternalServerError)
 			render.JSON(res, req, dto.ErrorResponse{Error: "Failed to enqueue job"})
@@ -121,6 +149,14 @@ func handleImageProcessing(db *gorm.DB, logger *slog.Logger, body dto.WorkerJobC
 		return
 	}
 
+	batchCmd := jobs.JobCommand(command)
+	jobBatch, err := jobs.CreateBatch(db, workers.TopicImageProcess, &batchCmd, int(count))
+	if err != nil {
+		render.Status(req, http.StatusInternalServerError)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Failed to create job batch"})
+		return
+	}
+
 	// Enqueue jobs in background
 	go func(uids []string) {
 		// Batch process targetUids
@@ -137,17 +173,22 @@ func handleImageProcessing(db *gorm.DB, logger *slog.Logger, body dto.WorkerJobC
 
 			for _, img := range imgs {
 				job := &workers.ImageProcessJob{Image: img}
-				_, _ = jobs.Enqueue(db, workers.TopicImageProcess, job, nil, &img.Uid)
+				_, _ = jobs.EnqueueInBatch(db, jobBatch.Uid, workers.TopicImageProcess, priority, job, nil, &img.Uid)
 			}
 		}
-		logger.Info("image processing jobs enqueued", "command", command, "count", count)
+
+		if err := jobs.SealBatch(db, jobBatch.Uid); err != nil {
+			logger.Error("failed to seal job batch", slog.String("batch_uid", jobBatch.Uid), slog.Any("error", err))
+		}
+		logger.Info("image processing jobs enqueued", "command", command, "count", count, "batch_uid", jobBatch.Uid)
 	}(targetUids)
 
 	jobCount := int(count)
 	render.Status(req, http.StatusAccepted)
 	render.JSON(res, req, dto.WorkerJobEnqueueResponse{
-		Message: fmt.Sprintf("thumbnail generation jobs enqueued (%s)", command),
-		Count:   &jobCount,
+		Message:  fmt.Sprintf("thumbnail generation jobs enqueued (%s)", command),
+		Count:    &jobCount,
+		BatchUid: &jobBatch.Uid,
 	})
 }
 
@@ -160,6 +201,13 @@ func handleXMPGeneration(db *gorm.DB, logger *slog.Logger, body dto.WorkerJobCre
 
 	var count int64
 	var err error
+
+	priority, err := jobPriority(body)
+	if err != nil {
+		render.Status(req, http.StatusBadRequest)
+		render.JSON(res, req, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
 	var uidsWithoutXMP []string
 
 	if body.Uids != nil && len(*body.Uids) == 1 {
@@ -171,7 +219,7 @@ func handleXMPGeneration(db *gorm.DB, logger *slog.Logger, body dto.WorkerJobCre
 		}
 
 		job := &workers.XMPGenerationJob{Image: img}
-		_, err := jobs.Enqueue(db, workers.TopicXMPGeneration, job, nil, &img.Uid)
+		_, err := jobs.Enqueue(db, workers.TopicXMPGeneration, priority, job, nil, &img.Uid)
 		if err != nil {
 			render.Status(req, http.StatusInternalServerError)
 			render.JSON(res, req, dto.ErrorResponse{Error: "Failed to enqueue job"})
@@ -244,11 +292,20 @@ func handleXMPGeneration(db *gorm.DB, logger *slog.Logger, body dto.WorkerJobCre
 		return
 	}
 
+	batchCmd := jobs.JobCommand(command)
+	jobBatch, err := jobs.CreateBatch(db, workers.TopicXMPGeneration, &batchCmd, int(count))
+	if err != nil {
+		render.Status(req, http.StatusInternalServerError)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Failed to create job batch"})
+		return
+	}
+
 	go func(cmd string, uids []string) {
 		processed := 0
 
 		if cmd == "missing" {
 			if len(uids) == 0 {
+				_ = jobs.SealBatch(db, jobBatch.Uid)
 				logger.Info("XMP sidecar generation completed", "command", cmd, "enqueued", 0)
 				return
 			}
@@ -266,7 +323,7 @@ func handleXMPGeneration(db *gorm.DB, logger *slog.Logger, body dto.WorkerJobCre
 
 				for _, img := range batchImgs {
 					job := &workers.XMPGenerationJob{Image: img}
-					if _, err := jobs.Enqueue(db, workers.TopicXMPGeneration, job, nil, &img.Uid); err != nil {
+					if _, err := jobs.EnqueueInBatch(db, jobBatch.Uid, workers.TopicXMPGeneration, priority, job, nil, &img.Uid); err != nil {
 						logger.Error("failed to enqueue XMP job", "image_uid", img.Uid, "error", err)
 					} else {
 						processed++
@@ -279,7 +336,7 @@ func handleXMPGeneration(db *gorm.DB, logger *slog.Logger, body dto.WorkerJobCre
 			query.FindInBatches(&imgs, 100, func(tx *gorm.DB, batch int) error {
 				for _, img := range imgs {
 					job := &workers.XMPGenerationJob{Image: img}
-					if _, err := jobs.Enqueue(db, workers.TopicXMPGeneration, job, nil, &img.Uid); err != nil {
+					if _, err := jobs.EnqueueInBatch(db, jobBatch.Uid, workers.TopicXMPGeneration, priority, job, nil, &img.Uid); err != nil {
 						logger.Error("failed to enqueue XMP job", "image_uid", img.Uid, "error", err)
 					} else {
 						processed++
@@ -289,14 +346,18 @@ func handleXMPGeneration(db *gorm.DB, logger *slog.Logger, body dto.WorkerJobCre
 			})
 		}
 
-		logger.Info("XMP sidecar generation jobs enqueued", "command", cmd, "enqueued", processed)
+		if err := jobs.SealBatch(db, jobBatch.Uid); err != nil {
+			logger.Error("failed to seal job batch", slog.String("batch_uid", jobBatch.Uid), slog.Any("error", err))
+		}
+		logger.Info("XMP sidecar generation jobs enqueued", "command", cmd, "enqueued", processed, "batch_uid", jobBatch.Uid)
 	}(command, uidsWithoutXMP)
 
 	jobCount := int(count)
 	render.Status(req, http.StatusAccepted)
 	render.JSON(res, req, dto.WorkerJobEnqueueResponse{
-		Message: fmt.Sprintf("XMP sidecar generation jobs enqueued (%s)", command),
-		Count:   &jobCount,
+		Message:  fmt.Sprintf("XMP sidecar generation jobs enqueued (%s)", command),
+		Count:    &jobCount,
+		BatchUid: &jobBatch.Uid,
 	})
 }
 
@@ -310,6 +371,13 @@ func handleExifProcessing(db *gorm.DB, logger *slog.Logger, body dto.WorkerJobCr
 	var count int64
 	var err error
 
+	priority, err := jobPriority(body)
+	if err != nil {
+		render.Status(req, http.StatusBadRequest)
+		render.JSON(res, req, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
 	if body.Uids != nil && len(*body.Uids) == 1 {
 		var img entities.ImageAsset
 		if err := db.Where("uid = ?", (*body.Uids)[0]).First(&img).Error; err != nil {
@@ -319,7 +387,7 @@ func handleExifProcessing(db *gorm.DB, logger *slog.Logger, body dto.WorkerJobCr
 		}
 
 		job := &workers.ExifProcessJob{Image: img}
-		_, err := jobs.Enqueue(db, workers.TopicExifProcess, job, nil, &img.Uid)
+		_, err := jobs.Enqueue(db, workers.TopicExifProcess, priority, job, nil, &img.Uid)
 		if err != nil {
 			render.Status(req, http.StatusInternalServerError)
 			render.JSON(res, req, dto.ErrorResponse{Error: "Failed to enqueue job"})
@@ -360,6 +428,14 @@ func handleExifProcessing(db *gorm.DB, logger *slog.Logger, body dto.WorkerJobCr
 		return
 	}
 
+	batchCmd := jobs.JobCommand(command)
+	jobBatch, err := jobs.CreateBatch(db, workers.TopicExifProcess, &batchCmd, int(count))
+	if err != nil {
+		render.Status(req, http.StatusInternalServerError)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Failed to create job batch"})
+		return
+	}
+
 	go func(cmd string) {
 		var query *gorm.DB
 		if cmd == "missing" {
@@ -372,19 +448,23 @@ func handleExifProcessing(db *gorm.DB, logger *slog.Logger, body dto.WorkerJobCr
 		query.FindInBatches(&imgs, 100, func(tx *gorm.DB, batch int) error {
 			for _, img := range imgs {
 				job := &workers.ExifProcessJob{Image: img}
-				_, _ = jobs.Enqueue(db, workers.TopicExifProcess, job, nil, &img.Uid)
+				_, _ = jobs.EnqueueInBatch(db, jobBatch.Uid, workers.TopicExifProcess, priority, job, nil, &img.Uid)
 			}
 			return nil
 		})
 
-		logger.Info("exif processing jobs enqueued", "command", cmd, "count", count)
+		if err := jobs.SealBatch(db, jobBatch.Uid); err != nil {
+			logger.Error("failed to seal job batch", slog.String("batch_uid", jobBatch.Uid), slog.Any("error", err))
+		}
+		logger.Info("exif processing jobs enqueued", "command", cmd, "count", count, "batch_uid", jobBatch.Uid)
 	}(command)
 
 	jobCount := int(count)
 	render.Status(req, http.StatusAccepted)
 	render.JSON(res, req, dto.WorkerJobEnqueueResponse{
-		Message: fmt.Sprintf("EXIF processing jobs enqueued (%s)", command),
-		Count:   &jobCount,
+		Message:  fmt.Sprintf("EXIF processing jobs enqueued (%s)", command),
+		Count:    &jobCount,
+		BatchUid: &jobBatch.Uid,
 	})
 }
 
@@ -469,6 +549,57 @@ func findMissingTransforms(db *gorm.DB, logger *slog.Logger) ([]string, error) {
 	return missing, nil
 }
 
+// activeJobs lists the jobs being worked on. Standalone workers run them in
+// other processes, so a publish-only server reads the running rows instead of
+// its own in-memory jobs.
+func activeJobs(db *gorm.DB) ([]ActiveBrief, error) {
+	if jobs.PublishOnly() {
+		var running []entities.WorkerJob
+		if err := db.Where("status = ?", jobs.WorkerJobStatusRunning).Find(&running).Error; err != nil {
+			return nil, err
+		}
+
+		active := make([]ActiveBrief, 0, len(running))
+		for _, wj := range running {
+			priority := jobs.PriorityNormal
+			if wj.Priority != nil {
+				priority = jobs.Priority(*wj.Priority)
+			}
+
+			active = append(active, ActiveBrief{
+				Uid:      wj.Uid,
+				ImageUid: wj.ImageUid,
+				Topic:    wj.Topic,
+				Type:     wj.Topic,
+				Status:   jobs.JobStatus(wj.Status),
+				Priority: priority,
+			})
+		}
+
+		return active, nil
+	}
+
+	activeMap := jobs.GetAllJobs()
+	active := make([]ActiveBrief, 0, len(activeMap))
+	for id, j := range activeMap {
+		imgUid := j.GetImageUid()
+		var imgUidPtr *string
+		if imgUid != "" {
+			imgUidPtr = &imgUid
+		}
+		active = append(active, ActiveBrief{
+			Uid:      id,
+			ImageUid: imgUidPtr,
+			Topic:    j.Topic(),
+			Type:     j.Topic(),
+			Status:   j.GetStatus(),
+			Priority: j.Priority(),
+		})
+	}
+
+	return active, nil
+}
+
 // JobsRouter returns a router with admin-only job endpoints.
 // It applies AuthMiddleware and AdminMiddleware internally so it can be
 // mounted anywhere (we mount it under /admin/jobs in api.go).
@@ -479,47 +610,77 @@ func JobsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 	r.Use(libhttp.AdminMiddleware)
 
 	r.Get("/count", func(res http.ResponseWriter, req *http.Request) {
-		count := jobs.GetRunningJobs()
+		stats, err := jobs.CountJobs(db)
+		if err != nil {
+			libhttp.ServerError(res, req, err, logger, nil, "failed to count jobs", "Failed to count jobs")
+			return
+		}
+
 		render.Status(req, http.StatusOK)
-		render.JSON(res, req, map[string]int{"running": count})
+		render.JSON(res, req, map[string]int{"running": int(stats.Running)})
 	})
 
 	r.Get("/stats", func(res http.ResponseWriter, req *http.Request) {
-		stats := jobs.GetCounts()
+		stats, err := jobs.CountJobs(db)
+		if err != nil {
+			libhttp.ServerError(res, req, err, logger, nil, "failed to count jobs", "Failed to count jobs")
+			return
+		}
+
 		render.Status(req, http.StatusOK)
 		render.JSON(res, req, stats)
 	})
 
+	// GET /jobs/batches/{uid}: progress of a bulk request, including the images whose jobs failed
+	r.Get("/batches/{uid}", func(res http.ResponseWriter, req *http.Request) {
+		uid := chi.URLParam(req, "uid")
+
+		var batch entities.JobBatch
+		if err := db.Where("uid = ?", uid).First(&batch).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				render.Status(req, http.StatusNotFound)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Job batch not found"})
+				return
+			}
+
+			libhttp.ServerError(res, req, err, logger, nil, "failed to fetch job batch", "Failed to fetch job batch")
+			return
+		}
+
+		failedUids, err := jobs.GetBatchFailedImageUids(db, uid)
+		if err != nil {
+			libhttp.ServerError(res, req, err, logger, nil, "failed to list failed batch images", "Failed to fetch job batch")
+			return
+		}
+
+		render.Status(req, http.StatusOK)
+		render.JSON(res, req, dto.JobBatchResponse{Batch: batch.DTO(), FailedImageUids: failedUids})
+	})
+
 	// Atomic snapshot for UI bootstrap: active jobs, counters, and next event cursor
 	r.Get("/snapshot", func(res http.ResponseWriter, req *http.Request) {
-		// active jobs
-		activeMap := jobs.GetAllJobs()
-		active := make([]ActiveBrief, 0, len(activeMap))
-		for id, j := range activeMap {
-			imgUid := j.GetImageUid()
-			var imgUidPtr *string
-			if imgUid != "" {
-				imgUidPtr = &imgUid
-			}
-			active = append(active, ActiveBrief{
-				Uid:      id,
-				ImageUid: imgUidPtr,
-				Topic:    j.Topic(),
-				Type:     j.Topic(),
-				Status:   j.GetStatus(),
-			})
+		active, err := activeJobs(db)
+		if err != nil {
+			libhttp.ServerError(res, req, err, logger, nil, "failed to list active jobs", "Failed to fetch job snapshot")
+			return
 		}
 
 		// counters
-		stats := jobs.GetCounts()
+		stats, err := jobs.CountJobs(db)
+		if err != nil {
+			libhttp.ServerError(res, req, err, logger, nil, "failed to count jobs", "Failed to fetch job snapshot")
+			return
+		}
 
 		// next cursor from SSE broker via context key; the server wires it under /events router.
 		// We can’t access the broker instance directly here without a global. For now, omit nextCursor in response.
 		// Frontend can fetch /events/since with cursor=0 to bootstrap missed events if needed.
 		snap := map[string]any{
-			"active":           active,
-			"running_by_topic": stats.RunningByTopic,
-			"queued_by_topic":  stats.QueuedByTopic,
+			"active":              active,
+			"running_by_topic":    stats.RunningByTopic,
+			"queued_by_topic":     stats.QueuedByTopic,
+			"running_by_priority": stats.RunningByPriority,
+			"queued_by_priority":  stats.QueuedByPriority,
 			// nextCursor intentionally omitted due to scope isolation
 		}
 		render.Status(req, http.StatusOK)
@@ -573,7 +734,12 @@ func JobsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 
 	// GET /workers: list registered worker types
 	r.Get("/workers", func(res http.ResponseWriter, req *http.Request) {
-		stats := jobs.GetCounts()
+		stats, err := jobs.CountJobs(db)
+		if err != nil {
+			libhttp.ServerError(res, req, err, logger, nil, "failed to count jobs", "Failed to list workers")
+			return
+		}
+
 		workersList := jobs.GetAllWorkers()
 
 		items := make([]dto.WorkerInfo, 0, len(workersList))
@@ -606,10 +772,21 @@ func JobsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 
 		// Apply optional concurrency update
 		if body.Concurrency != nil {
+			if jobs.PublishOnly() {
+				render.Status(req, http.StatusConflict)
+				render.JSON(res, req, dto.ErrorResponse{Error: standaloneConcurrencyMessage})
+				return
+			}
+
 			jobs.SetConcurrency(body.Name, *body.Concurrency)
 		}
 
-		stats := jobs.GetCounts()
+		stats, err := jobs.CountJobs(db)
+		if err != nil {
+			libhttp.ServerError(res, req, err, logger, nil, "failed to count jobs", "Failed to register worker")
+			return
+		}
+
 		count := 0
 		if v := stats.RunningByTopic[body.Name]; v > 0 {
 			count = v
@@ -681,8 +858,59 @@ func JobsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 		render.JSON(res, req, dto.ErrorResponse{Error: "Job not found"})
 	})
 
+	// GET /jobs/{uid}/audit: automatic actions taken on a job, e.g. by the reaper
+	r.Get("/{uid}/audit", func(res http.ResponseWriter, req *http.Request) {
+		uid := chi.URLParam(req, "uid")
+
+		var entries []entities.JobAuditEntry
+		if err := db.Where("job_uid = ?", uid).Order("created_at asc").Find(&entries).Error; err != nil {
+			libhttp.ServerError(res, req, err, logger, nil, "failed to list job audit entries", "Failed to fetch job audit")
+			return
+		}
+
+		items := make([]dto.JobAuditEntry, 0, len(entries))
+		for _, e := range entries {
+			items = append(items, e.DTO())
+		}
+
+		render.Status(req, http.StatusOK)
+		render.JSON(res, req, dto.JobAuditResponse{Items: items})
+	})
+
 	r.Delete("/{uid}", func(res http.ResponseWriter, req *http.Request) {
 		uid := chi.URLParam(req, "uid")
+
+		// Standalone workers only check for cancellation before they start
+		// a job, so only queued jobs can be cancelled from here.
+		if jobs.PublishOnly() {
+			var ent entities.WorkerJob
+			if err := db.Select("status").Where("uid = ?", uid).First(&ent).Error; err != nil {
+				if err == gorm.ErrRecordNotFound {
+					render.Status(req, http.StatusNotFound)
+					render.JSON(res, req, dto.ErrorResponse{Error: "Job not found"})
+					return
+				}
+
+				libhttp.ServerError(res, req, err, logger, nil, "failed to fetch worker job", "Failed to cancel job")
+				return
+			}
+
+			if jobs.JobStatus(ent.Status) != jobs.WorkerJobStatusQueued {
+				render.Status(req, http.StatusConflict)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Only queued jobs can be cancelled while workers run standalone"})
+				return
+			}
+
+			if err := jobs.UpdateWorkerJobStatus(db, uid, jobs.WorkerJobStatusCancelled, nil, nil, nil, nil); err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to cancel worker job", "Failed to cancel job")
+				return
+			}
+
+			render.Status(req, http.StatusOK)
+			render.JSON(res, req, dto.MessageResponse{Message: "Job cancelled"})
+			return
+		}
+
 		all := jobs.GetAllJobs()
 		if j, ok := all[uid]; ok {
 			j.SetStatus(jobs.WorkerJobStatusCancelled)
@@ -717,6 +945,12 @@ func JobsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			return
 		}
 
+		if jobs.PublishOnly() {
+			render.Status(req, http.StatusConflict)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Jobs run on standalone workers; stop them there"})
+			return
+		}
+
 		topic := jobType
 
 		all := jobs.GetAllJobs()
@@ -756,6 +990,12 @@ func JobsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			return
 		}
 
+		if jobs.PublishOnly() {
+			render.Status(req, http.StatusConflict)
+			render.JSON(res, req, dto.ErrorResponse{Error: standaloneConcurrencyMessage})
+			return
+		}
+
 		topic := jobType
 
 		jobs.SetConcurrency(topic, body.Concurrency)
@@ -0,0 +1,145 @@
+package routes_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"viz/api/routes"
+	"viz/internal/dto"
+	"viz/internal/entities"
+	libhttp "viz/internal/http"
+	"viz/internal/jobs"
+	"viz/internal/utils"
+)
+
+// doAsAdmin sends a request with a session cookie for an admin, which the
+// jobs router needs because it applies AuthMiddleware itself.
+func doAsAdmin(t *testing.T, method, url string, body any) (int, []byte) {
+	t.Helper()
+
+	const token = "jobs-test-admin-session"
+	expires := time.Now().Add(time.Hour)
+	admin := &entities.User{Uid: "jobs-test-admin", Role: dto.UserRoleAdmin}
+	libhttp.SetSessionCache(libhttp.HashSessionToken(token), admin, &expires)
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, url, reader)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{Name: libhttp.AuthTokenCookie, Value: token})
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, data
+}
+
+func TestJobsRouterPublishOnly(t *testing.T) {
+	db := newTestDB(t)
+
+	jobs.SetPublishOnly(true)
+	t.Cleanup(func() { jobs.SetPublishOnly(false) })
+
+	server := httptest.NewServer(routes.JobsRouter(db, newTestLogger()))
+	t.Cleanup(server.Close)
+
+	const topic = "jobs_test_publish_only"
+	now := time.Now().UTC()
+	seed := []entities.WorkerJob{
+		{Uid: "jobs-po-queued", Topic: topic, Status: string(jobs.WorkerJobStatusQueued), Priority: utils.StringPtr(string(jobs.PriorityBulk)), EnqueuedAt: now},
+		{Uid: "jobs-po-queued-2", Topic: topic, Status: string(jobs.WorkerJobStatusQueued), EnqueuedAt: now},
+		{Uid: "jobs-po-running", Topic: topic, Status: string(jobs.WorkerJobStatusRunning), Priority: utils.StringPtr(string(jobs.PriorityInteractive)), ImageUid: utils.StringPtr("jobs-po-image"), EnqueuedAt: now, StartedAt: &now},
+		{Uid: "jobs-po-done", Topic: topic, Status: string(jobs.WorkerJobStatusSuccess), EnqueuedAt: now, CompletedAt: &now},
+	}
+	require.NoError(t, db.Create(&seed).Error)
+
+	// The workers run elsewhere, so the counts come from worker_jobs.
+	t.Run("stats count worker_jobs", func(t *testing.T) {
+		status, body := doAsAdmin(t, http.MethodGet, server.URL+"/stats", nil)
+		require.Equal(t, http.StatusOK, status, string(body))
+
+		var stats jobs.JobCounts
+		require.NoError(t, json.Unmarshal(body, &stats))
+		assert.Equal(t, 1, stats.RunningByTopic[topic])
+		assert.Equal(t, 2, stats.QueuedByTopic[topic])
+		assert.GreaterOrEqual(t, stats.Running, int64(1))
+		assert.GreaterOrEqual(t, stats.RunningByPriority[jobs.PriorityInteractive], 1)
+		assert.GreaterOrEqual(t, stats.QueuedByPriority[jobs.PriorityBulk], 1)
+	})
+
+	t.Run("snapshot lists running rows", func(t *testing.T) {
+		status, body := doAsAdmin(t, http.MethodGet, server.URL+"/snapshot", nil)
+		require.Equal(t, http.StatusOK, status, string(body))
+
+		var snap struct {
+			Active        []routes.ActiveBrief `json:"active"`
+			QueuedByTopic map[string]int       `json:"queued_by_topic"`
+		}
+		require.NoError(t, json.Unmarshal(body, &snap))
+		assert.Equal(t, 2, snap.QueuedByTopic[topic])
+
+		var found *routes.ActiveBrief
+		for i := range snap.Active {
+			if snap.Active[i].Uid == "jobs-po-running" {
+				found = &snap.Active[i]
+			}
+		}
+		require.NotNil(t, found)
+		assert.Equal(t, topic, found.Topic)
+		assert.Equal(t, jobs.PriorityInteractive, found.Priority)
+		require.NotNil(t, found.ImageUid)
+		assert.Equal(t, "jobs-po-image", *found.ImageUid)
+	})
+
+	t.Run("cancel marks a queued job for the workers to skip", func(t *testing.T) {
+		status, body := doAsAdmin(t, http.MethodDelete, server.URL+"/jobs-po-queued", nil)
+		require.Equal(t, http.StatusOK, status, string(body))
+
+		var wj entities.WorkerJob
+		require.NoError(t, db.First(&wj, "uid = ?", "jobs-po-queued").Error)
+		assert.Equal(t, string(jobs.WorkerJobStatusCancelled), wj.Status)
+	})
+
+	t.Run("cancel refuses jobs a worker already has", func(t *testing.T) {
+		for _, uid := range []string{"jobs-po-running", "jobs-po-done"} {
+			status, body := doAsAdmin(t, http.MethodDelete, server.URL+"/"+uid, nil)
+			assert.Equal(t, http.StatusConflict, status, string(body))
+
+			var wj entities.WorkerJob
+			require.NoError(t, db.First(&wj, "uid = ?", uid).Error)
+			assert.NotEqual(t, string(jobs.WorkerJobStatusCancelled), wj.Status)
+		}
+
+		status, _ := doAsAdmin(t, http.MethodDelete, server.URL+"/jobs-po-missing", nil)
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+
+	t.Run("stop and concurrency are refused", func(t *testing.T) {
+		status, body := doAsAdmin(t, http.MethodPost, server.URL+"/types/"+topic+"/stop", nil)
+		assert.Equal(t, http.StatusConflict, status, string(body))
+
+		status, body = doAsAdmin(t, http.MethodPut, server.URL+"/types/"+topic+"/concurrency", map[string]int{"concurrency": 2})
+		assert.Equal(t, http.StatusConflict, status, string(body))
+		assert.NotEqual(t, 2, jobs.GetConcurrency(topic))
+
+		status, body = doAsAdmin(t, http.MethodPost, server.URL+"/workers", map[string]any{"name": topic, "concurrency": 2})
+		assert.Equal(t, http.StatusConflict, status, string(body))
+	})
+}
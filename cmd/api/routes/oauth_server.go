@@ -0,0 +1,647 @@
+package routes
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+
+	"viz/internal/auth"
+	"viz/internal/dto"
+	"viz/internal/entities"
+	libhttp "viz/internal/http"
+	"viz/internal/uid"
+)
+
+const (
+	// The user gets this long on the consent screen.
+	oauthRequestTTL = 10 * time.Minute
+	// An authorization code has to be exchanged this soon after consent.
+	oauthCodeTTL         = time.Minute
+	oauthAccessTokenTTL  = time.Hour
+	oauthRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var (
+	errOAuthInvalidClient = errors.New("invalid oauth client")
+	errOAuthInvalidGrant  = errors.New("invalid oauth grant")
+	errOAuthRefreshReused = errors.New("oauth refresh token reused")
+)
+
+// oauthError writes an error in the format of RFC 6749 section 5.2.
+func oauthError(res http.ResponseWriter, req *http.Request, status int, code, description string) {
+	if status == http.StatusUnauthorized {
+		res.Header().Set("WWW-Authenticate", `Basic realm="viz"`)
+	}
+
+	render.Status(req, status)
+	render.JSON(res, req, dto.OAuthError{Error: code, ErrorDescription: &description})
+}
+
+// oauthRedirect adds params to a client's redirect URI, leaving out empty
+// ones such as a missing state.
+func oauthRedirect(redirectURI string, params url.Values) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		if len(values) > 0 && values[0] != "" {
+			query[key] = values
+		}
+	}
+
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// authenticateOAuthClient works out which client is making a token or
+// revocation request, from HTTP Basic credentials or the form. Confidential
+// clients have to prove it with their secret.
+func authenticateOAuthClient(db *gorm.DB, req *http.Request) (*entities.OAuthClientWithSecret, error) {
+	clientID, secret, basic := req.BasicAuth()
+	if !basic {
+		clientID, secret = req.PostFormValue("client_id"), req.PostFormValue("client_secret")
+	}
+
+	if clientID == "" {
+		return nil, errOAuthInvalidClient
+	}
+
+	var client entities.OAuthClientWithSecret
+	if err := db.Where("uid = ?", clientID).First(&client).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errOAuthInvalidClient
+		}
+		return nil, err
+	}
+
+	if client.Confidential {
+		hash, _ := auth.HashSecret(secret)
+		if secret == "" || subtle.ConstantTimeCompare([]byte(hash), []byte(client.SecretHash)) != 1 {
+			return nil, errOAuthInvalidClient
+		}
+	}
+
+	return &client, nil
+}
+
+// findPendingOAuthRequest gets the authorization request with ID id that is
+// still waiting for the user's decision.
+func findPendingOAuthRequest(tx *gorm.DB, id string) (entities.OAuthAuthorizationRequest, error) {
+	hash, _ := auth.HashSecret(id)
+
+	var request entities.OAuthAuthorizationRequest
+	err := tx.Where("request_hash = ? AND code_hash IS NULL AND expires_at > ?", hash, time.Now().UTC()).First(&request).Error
+	return request, err
+}
+
+// issueOAuthTokens issues a new access token in grant, and a refresh token
+// too if the grant includes auth:refresh.
+func issueOAuthTokens(tx *gorm.DB, grant entities.OAuthToken) (dto.OAuthTokenResponse, error) {
+	now := time.Now().UTC()
+	accessToken := auth.GenerateOAuthToken(auth.OAuthAccessTokenPrefix)
+
+	token := entities.OAuthToken{
+		GrantUid:        grant.GrantUid,
+		ClientUid:       grant.ClientUid,
+		UserUid:         grant.UserUid,
+		Scopes:          grant.Scopes,
+		AccessExpiresAt: now.Add(oauthAccessTokenTTL),
+		GrantedAt:       grant.GrantedAt,
+	}
+	token.AccessTokenHash, _ = auth.HashSecret(accessToken)
+
+	response := dto.OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(oauthAccessTokenTTL.Seconds()),
+		Scope:       strings.Join(grant.Scopes, " "),
+	}
+
+	if slices.Contains(grant.Scopes, string(auth.AuthRefreshScope)) {
+		refreshToken := auth.GenerateOAuthToken(auth.OAuthRefreshTokenPrefix)
+		refreshHash, _ := auth.HashSecret(refreshToken)
+		refreshExpires := now.Add(oauthRefreshTokenTTL)
+
+		token.RefreshTokenHash = &refreshHash
+		token.RefreshExpiresAt = &refreshExpires
+		response.RefreshToken = &refreshToken
+	}
+
+	return response, tx.Omit("User").Create(&token).Error
+}
+
+// revokeOAuthGrant revokes every token issued in the grant grantUid.
+func revokeOAuthGrant(tx *gorm.DB, grantUid string) error {
+	return tx.Model(&entities.OAuthToken{}).
+		Where("grant_uid = ? AND revoked_at IS NULL", grantUid).
+		Update("revoked_at", time.Now().UTC()).Error
+}
+
+// revokeUserOAuthTokens revokes every token issued to userUid, and deletes
+// the codes they've approved that haven't been exchanged yet, so apps have
+// to be approved again.
+func revokeUserOAuthTokens(tx *gorm.DB, userUid string) error {
+	if err := tx.Where("user_uid = ?", userUid).Delete(&entities.OAuthAuthorizationRequest{}).Error; err != nil {
+		return err
+	}
+
+	return tx.Model(&entities.OAuthToken{}).
+		Where("user_uid = ? AND revoked_at IS NULL", userUid).
+		Update("revoked_at", time.Now().UTC()).Error
+}
+
+// exchangeOAuthCode swaps an authorization code for the first tokens of a
+// new grant. Codes are single use, so a failed exchange still spends the
+// code and the caller should commit tx either way.
+func exchangeOAuthCode(tx *gorm.DB, client *entities.OAuthClientWithSecret, req *http.Request) (dto.OAuthTokenResponse, error) {
+	codeHash, _ := auth.HashSecret(req.PostFormValue("code"))
+
+	var request entities.OAuthAuthorizationRequest
+	if err := tx.Where("code_hash = ?", codeHash).First(&request).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return dto.OAuthTokenResponse{}, errOAuthInvalidGrant
+		}
+		return dto.OAuthTokenResponse{}, err
+	}
+
+	spent := tx.Delete(&request)
+	if spent.Error != nil {
+		return dto.OAuthTokenResponse{}, spent.Error
+	}
+	if spent.RowsAffected == 0 {
+		return dto.OAuthTokenResponse{}, errOAuthInvalidGrant
+	}
+
+	now := time.Now().UTC()
+	if request.ClientUid != client.Uid ||
+		!request.ExpiresAt.After(now) ||
+		request.RedirectURI != req.PostFormValue("redirect_uri") ||
+		!auth.VerifyPKCE(req.PostFormValue("code_verifier"), request.CodeChallenge) {
+		return dto.OAuthTokenResponse{}, errOAuthInvalidGrant
+	}
+
+	return issueOAuthTokens(tx, entities.OAuthToken{
+		GrantUid:  uid.MustGenerate(),
+		ClientUid: client.Uid,
+		UserUid:   request.UserUid,
+		Scopes:    request.Scopes,
+		GrantedAt: now,
+	})
+}
+
+// refreshOAuthToken swaps a refresh token for new tokens in the same grant,
+// optionally with fewer scopes. A refresh token that was already swapped
+// returns errOAuthRefreshReused, and the caller revokes its grant.
+func refreshOAuthToken(tx *gorm.DB, client *entities.OAuthClientWithSecret, req *http.Request) (dto.OAuthTokenResponse, *entities.OAuthToken, error) {
+	refreshHash, _ := auth.HashSecret(req.PostFormValue("refresh_token"))
+
+	var token entities.OAuthToken
+	if err := tx.Where("refresh_token_hash = ?", refreshHash).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return dto.OAuthTokenResponse{}, nil, errOAuthInvalidGrant
+		}
+		return dto.OAuthTokenResponse{}, nil, err
+	}
+
+	if token.ClientUid != client.Uid {
+		return dto.OAuthTokenResponse{}, nil, errOAuthInvalidGrant
+	}
+
+	if token.RevokedAt != nil {
+		return dto.OAuthTokenResponse{}, &token, errOAuthRefreshReused
+	}
+
+	now := time.Now().UTC()
+	if token.RefreshExpiresAt == nil || !token.RefreshExpiresAt.After(now) {
+		return dto.OAuthTokenResponse{}, nil, errOAuthInvalidGrant
+	}
+
+	scopes := token.Scopes
+	if raw := req.PostFormValue("scope"); raw != "" {
+		narrowed, err := auth.ParseScopes(raw)
+		if err != nil || len(lo.Without(narrowed, token.Scopes...)) > 0 {
+			return dto.OAuthTokenResponse{}, nil, errOAuthInvalidGrant
+		}
+		scopes = narrowed
+	}
+
+	// Only one of two concurrent refreshes with the same token wins
+	swapped := tx.Model(&token).Where("revoked_at IS NULL").Update("revoked_at", now)
+	if swapped.Error != nil {
+		return dto.OAuthTokenResponse{}, nil, swapped.Error
+	}
+	if swapped.RowsAffected == 0 {
+		return dto.OAuthTokenResponse{}, &token, errOAuthRefreshReused
+	}
+
+	grant := token
+	grant.Scopes = scopes
+	response, err := issueOAuthTokens(tx, grant)
+	return response, nil, err
+}
+
+// OAuthRouter is Viz's OAuth2 authorization server, which lets third-party
+// apps act for users with the scopes they consent to. Every client uses the
+// authorization code flow with PKCE.
+func OAuthRouter(db *gorm.DB, logger *slog.Logger, limiter *libhttp.Limiter) *chi.Mux {
+	router := chi.NewRouter()
+
+	router.Get("/authorize", func(res http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+
+		var client entities.OAuthClient
+		if err := db.Where("uid = ?", query.Get("client_id")).First(&client).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				oauthError(res, req, http.StatusBadRequest, "invalid_client", "Unknown client")
+				return
+			}
+
+			libhttp.ServerError(res, req, err, logger, nil, "failed to get oauth client", "Something went wrong, please try again later")
+			return
+		}
+
+		// Without a registered redirect URI there is nowhere safe to send
+		// errors, so they're shown here instead.
+		redirectURI := query.Get("redirect_uri")
+		if !slices.Contains(client.RedirectUris, redirectURI) {
+			oauthError(res, req, http.StatusBadRequest, "invalid_request", "The redirect_uri is not registered for this client")
+			return
+		}
+
+		state := query.Get("state")
+		fail := func(code, description string) {
+			http.Redirect(res, req, oauthRedirect(redirectURI, url.Values{
+				"error":             {code},
+				"error_description": {description},
+				"state":             {state},
+			}), http.StatusFound)
+		}
+
+		if query.Get("response_type") != "code" {
+			fail("unsupported_response_type", "Only the code response type is supported")
+			return
+		}
+
+		challenge := query.Get("code_challenge")
+		if query.Get("code_challenge_method") != "S256" || !auth.ValidCodeChallenge(challenge) {
+			fail("invalid_request", "PKCE with the S256 method is required")
+			return
+		}
+
+		scopes, err := auth.ParseScopes(query.Get("scope"))
+		if err != nil {
+			fail("invalid_scope", err.Error())
+			return
+		}
+
+		if len(scopes) == 0 {
+			scopes = client.Scopes
+		}
+
+		if extra := lo.Without(scopes, client.Scopes...); len(extra) > 0 {
+			fail("invalid_scope", "The client may not ask for "+strings.Join(extra, ", "))
+			return
+		}
+
+		now := time.Now().UTC()
+		if err := db.Where("expires_at < ?", now).Delete(&entities.OAuthAuthorizationRequest{}).Error; err != nil {
+			logger.Warn("failed to sweep expired oauth requests", slog.Any("error", err))
+		}
+
+		id := auth.GenerateAuthToken()
+		request := entities.OAuthAuthorizationRequest{
+			ClientUid:     client.Uid,
+			RedirectURI:   redirectURI,
+			Scopes:        scopes,
+			State:         state,
+			CodeChallenge: challenge,
+			ExpiresAt:     now.Add(oauthRequestTTL),
+		}
+		request.RequestHash, _ = auth.HashSecret(id)
+
+		if err := db.Create(&request).Error; err != nil {
+			libhttp.ServerError(res, req, err, logger, nil, "failed to save oauth request", "Something went wrong, please try again later")
+			return
+		}
+
+		// The consent page signs the user in first if it has to
+		http.Redirect(res, req, "/oauth/consent?request="+url.QueryEscape(id), http.StatusFound)
+	})
+
+	router.With(limiter.Throttle(rateLimitScopeOAuth)).Post("/token", func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Cache-Control", "no-store")
+		res.Header().Set("Pragma", "no-cache")
+
+		if err := req.ParseForm(); err != nil {
+			oauthError(res, req, http.StatusBadRequest, "invalid_request", "Invalid form body")
+			return
+		}
+
+		client, err := authenticateOAuthClient(db, req)
+		if err != nil {
+			if errors.Is(err, errOAuthInvalidClient) {
+				limiter.Failure(req, rateLimitScopeOAuth, limiter.IPKey(req))
+				oauthError(res, req, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+				return
+			}
+
+			libhttp.ServerError(res, req, err, logger, nil, "failed to authenticate oauth client", "Something went wrong, please try again later")
+			return
+		}
+
+		var response dto.OAuthTokenResponse
+		var reused *entities.OAuthToken
+
+		switch grantType := req.PostFormValue("grant_type"); grantType {
+		case string(dto.OAuthTokenRequestGrantTypeAuthorizationCode):
+			var exchangeErr error
+			err = db.Transaction(func(tx *gorm.DB) error {
+				response, exchangeErr = exchangeOAuthCode(tx, client, req)
+				if errors.Is(exchangeErr, errOAuthInvalidGrant) {
+					return nil
+				}
+				return exchangeErr
+			})
+			if err == nil {
+				err = exchangeErr
+			}
+		case string(dto.OAuthTokenRequestGrantTypeRefreshToken):
+			err = db.Transaction(func(tx *gorm.DB) error {
+				response, reused, err = refreshOAuthToken(tx, client, req)
+				return err
+			})
+		default:
+			oauthError(res, req, http.StatusBadRequest, "unsupported_grant_type", "Only authorization_code and refresh_token are supported")
+			return
+		}
+
+		switch {
+		case errors.Is(err, errOAuthRefreshReused):
+			// Either the app or someone who stole the token used it twice,
+			// and there's no telling which, so neither keeps access.
+			if err := revokeOAuthGrant(db, reused.GrantUid); err != nil {
+				logger.Error("failed to revoke oauth grant", slog.Any("error", err))
+			}
+
+			logger.Warn("oauth refresh token reused, grant revoked",
+				slog.String("client_uid", client.Uid),
+				slog.String("user_uid", reused.UserUid),
+			)
+			oauthError(res, req, http.StatusBadRequest, "invalid_grant", "The refresh token is no longer valid")
+		case errors.Is(err, errOAuthInvalidGrant):
+			oauthError(res, req, http.StatusBadRequest, "invalid_grant", "The code or refresh token is invalid or expired")
+		case err != nil:
+			libhttp.ServerError(res, req, err, logger, nil, "failed to issue oauth tokens", "Something went wrong, please try again later")
+		default:
+			render.JSON(res, req, response)
+		}
+	})
+
+	router.With(limiter.Throttle(rateLimitScopeOAuth)).Post("/revoke", func(res http.ResponseWriter, req *http.Request) {
+		if err := req.ParseForm(); err != nil || req.PostFormValue("token") == "" {
+			oauthError(res, req, http.StatusBadRequest, "invalid_request", "A token is required")
+			return
+		}
+
+		client, err := authenticateOAuthClient(db, req)
+		if err != nil {
+			if errors.Is(err, errOAuthInvalidClient) {
+				limiter.Failure(req, rateLimitScopeOAuth, limiter.IPKey(req))
+				oauthError(res, req, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+				return
+			}
+
+			libhttp.ServerError(res, req, err, logger, nil, "failed to authenticate oauth client", "Something went wrong, please try again later")
+			return
+		}
+
+		hash, _ := auth.HashSecret(req.PostFormValue("token"))
+
+		var token entities.OAuthToken
+		err = db.Where("access_token_hash = ? OR refresh_token_hash = ?", hash, hash).First(&token).Error
+		if err != nil {
+			// Unknown tokens count as revoked already (RFC 7009 section 2.2)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				res.WriteHeader(http.StatusOK)
+				return
+			}
+
+			libhttp.ServerError(res, req, err, logger, nil, "failed to find oauth token", "Something went wrong, please try again later")
+			return
+		}
+
+		if token.ClientUid != client.Uid {
+			oauthError(res, req, http.StatusBadRequest, "unauthorized_client", "The token was not issued to this client")
+			return
+		}
+
+		if !slices.Contains(token.Scopes, string(auth.AuthRevokeScope)) {
+			oauthError(res, req, http.StatusForbidden, "insufficient_scope", "Revoking tokens needs the auth:revoke scope")
+			return
+		}
+
+		if err := revokeOAuthGrant(db, token.GrantUid); err != nil {
+			libhttp.ServerError(res, req, err, logger, nil, "failed to revoke oauth grant", "Something went wrong, please try again later")
+			return
+		}
+
+		res.WriteHeader(http.StatusOK)
+	})
+
+	// The consent screen and connected apps are only for users themselves,
+	// never for API keys or apps.
+	router.Group(func(r chi.Router) {
+		r.Use(libhttp.AuthMiddleware(db, logger))
+		r.Use(libhttp.UserAuthMiddleware)
+
+		r.Get("/requests/{id}", func(res http.ResponseWriter, req *http.Request) {
+			request, err := findPendingOAuthRequest(db, chi.URLParam(req, "id"))
+			var client entities.OAuthClient
+			if err == nil {
+				err = db.Where("uid = ?", request.ClientUid).First(&client).Error
+			}
+
+			if err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					render.Status(req, http.StatusNotFound)
+					render.JSON(res, req, dto.ErrorResponse{Error: "This authorization request has expired"})
+					return
+				}
+
+				libhttp.ServerError(res, req, err, logger, nil, "failed to get oauth request", "Something went wrong, please try again later")
+				return
+			}
+
+			scopes := make([]dto.OAuthScope, len(request.Scopes))
+			for i, scope := range request.Scopes {
+				scopes[i] = dto.OAuthScope{Value: scope, Label: auth.ScopeLabel(auth.Scope(scope))}
+			}
+
+			render.JSON(res, req, dto.OAuthConsentRequest{
+				ClientUid:         client.Uid,
+				ClientName:        client.Name,
+				ClientDescription: client.Description,
+				RedirectUri:       request.RedirectURI,
+				Scopes:            scopes,
+				ExpiresAt:         request.ExpiresAt,
+			})
+		})
+
+		r.Post("/requests/{id}", func(res http.ResponseWriter, req *http.Request) {
+			user, _ := libhttp.UserFromContext(req)
+
+			var body dto.OAuthConsentDecision
+			if err := render.DecodeJSON(req.Body, &body); err != nil {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Invalid request body"})
+				return
+			}
+
+			var redirectTo string
+			err := db.Transaction(func(tx *gorm.DB) error {
+				request, err := findPendingOAuthRequest(tx, chi.URLParam(req, "id"))
+				if err != nil {
+					return err
+				}
+
+				if !body.Approve {
+					redirectTo = oauthRedirect(request.RedirectURI, url.Values{
+						"error":             {"access_denied"},
+						"error_description": {"The user denied the request"},
+						"state":             {request.State},
+					})
+					return tx.Delete(&request).Error
+				}
+
+				granted := request.Scopes
+				if body.Scopes != nil {
+					granted = lo.Uniq(*body.Scopes)
+					if len(granted) == 0 || len(lo.Without(granted, request.Scopes...)) > 0 {
+						return auth.ErrUnknownScope
+					}
+				}
+
+				code := auth.GenerateAuthToken()
+				codeHash, _ := auth.HashSecret(code)
+
+				decided := tx.Model(&request).
+					Where("code_hash IS NULL").
+					Select("user_uid", "scopes", "code_hash", "expires_at").
+					Updates(entities.OAuthAuthorizationRequest{
+						UserUid:   user.Uid,
+						Scopes:    granted,
+						CodeHash:  &codeHash,
+						ExpiresAt: time.Now().UTC().Add(oauthCodeTTL),
+					})
+				if decided.Error != nil {
+					return decided.Error
+				}
+				if decided.RowsAffected == 0 {
+					return gorm.ErrRecordNotFound
+				}
+
+				redirectTo = oauthRedirect(request.RedirectURI, url.Values{
+					"code":  {code},
+					"state": {request.State},
+				})
+				return nil
+			})
+
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				render.Status(req, http.StatusNotFound)
+				render.JSON(res, req, dto.ErrorResponse{Error: "This authorization request has expired"})
+			case errors.Is(err, auth.ErrUnknownScope):
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Grant at least one of the requested scopes, and no others"})
+			case err != nil:
+				libhttp.ServerError(res, req, err, logger, nil, "failed to decide oauth request", "Something went wrong, please try again later")
+			default:
+				logger.Info("oauth request decided",
+					slog.String("user_uid", user.Uid),
+					slog.Bool("approved", body.Approve),
+				)
+				render.JSON(res, req, dto.OAuthRedirectResponse{RedirectTo: redirectTo})
+			}
+		})
+
+		r.Get("/authorizations", func(res http.ResponseWriter, req *http.Request) {
+			user, _ := libhttp.UserFromContext(req)
+			now := time.Now().UTC()
+
+			var tokens []entities.OAuthToken
+			err := db.Where("user_uid = ? AND revoked_at IS NULL AND (access_expires_at > ? OR refresh_expires_at > ?)", user.Uid, now, now).
+				Order("granted_at").
+				Find(&tokens).Error
+			if err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to list oauth tokens", "Something went wrong, please try again later")
+				return
+			}
+
+			var clients []entities.OAuthClient
+			clientUids := lo.Uniq(lo.Map(tokens, func(t entities.OAuthToken, _ int) string { return t.ClientUid }))
+			if err := db.Where("uid IN ?", clientUids).Find(&clients).Error; err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to list oauth clients", "Something went wrong, please try again later")
+				return
+			}
+
+			// One entry per app, however many grants it holds
+			items := make([]dto.OAuthAuthorization, 0, len(clients))
+			for _, client := range clients {
+				item := dto.OAuthAuthorization{ClientUid: client.Uid, ClientName: client.Name, Scopes: []string{}}
+				for _, token := range tokens {
+					if token.ClientUid != client.Uid {
+						continue
+					}
+
+					item.Scopes = lo.Union(item.Scopes, token.Scopes)
+					if item.CreatedAt.IsZero() || token.GrantedAt.Before(item.CreatedAt) {
+						item.CreatedAt = token.GrantedAt
+					}
+					if token.LastUsedAt != nil && (item.LastUsedAt == nil || token.LastUsedAt.After(*item.LastUsedAt)) {
+						item.LastUsedAt = token.LastUsedAt
+					}
+				}
+				items = append(items, item)
+			}
+
+			render.JSON(res, req, dto.OAuthAuthorizationList{Items: items})
+		})
+
+		r.Delete("/authorizations/{client_uid}", func(res http.ResponseWriter, req *http.Request) {
+			user, _ := libhttp.UserFromContext(req)
+
+			revoked := db.Model(&entities.OAuthToken{}).
+				Where("user_uid = ? AND client_uid = ? AND revoked_at IS NULL", user.Uid, chi.URLParam(req, "client_uid")).
+				Update("revoked_at", time.Now().UTC())
+			if revoked.Error != nil {
+				libhttp.ServerError(res, req, revoked.Error, logger, nil, "failed to revoke oauth tokens", "Something went wrong, please try again later")
+				return
+			}
+
+			if revoked.RowsAffected == 0 {
+				render.Status(req, http.StatusNotFound)
+				render.JSON(res, req, dto.ErrorResponse{Error: "App not found"})
+				return
+			}
+
+			logger.Info("oauth app access revoked", slog.String("user_uid", user.Uid), slog.String("client_uid", chi.URLParam(req, "client_uid")))
+			res.WriteHeader(http.StatusNoContent)
+		})
+	})
+
+	return router
+}
@@ -0,0 +1,318 @@
+package routes
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+
+	"viz/internal/auth"
+	"viz/internal/auth/oidc"
+	"viz/internal/config"
+	"viz/internal/dto"
+	"viz/internal/entities"
+	libhttp "viz/internal/http"
+	"viz/internal/settings"
+	"viz/internal/uid"
+)
+
+// The browser gets this long at the identity provider before the login has
+// to be started again.
+const oidcLoginTTL = 10 * time.Minute
+
+var (
+	errOIDCNoAccount     = errors.New("no account for this identity")
+	errOIDCEmailConflict = errors.New("an account with this email already exists")
+)
+
+// oidcCallbackURL is the default redirect URL registered with a provider.
+func oidcCallbackURL(id string) string {
+	return strings.TrimRight(config.AppConfig.BaseURL, "/") + "/api/auth/oidc/" + id + "/callback"
+}
+
+// safeRedirectPath only lets a login return to a path on this site.
+func safeRedirectPath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		return "/"
+	}
+	return path
+}
+
+// resolveOIDCUser finds the user behind identity, linking or creating one as
+// the provider allows, and brings their role in line with the provider's
+// role mappings.
+func resolveOIDCUser(tx *gorm.DB, provider *oidc.Provider, identity *oidc.Identity, role dto.UserRole) (*entities.User, error) {
+	now := time.Now().UTC()
+
+	var user entities.User
+	var link entities.UserIdentity
+	err := tx.Where("provider = ? AND subject = ?", provider.ID(), identity.Subject).First(&link).Error
+
+	switch {
+	case err == nil:
+		if err := tx.Where("uid = ?", link.UserUid).First(&user).Error; err != nil {
+			return nil, err
+		}
+
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		var existing int64
+		if identity.Email != "" {
+			found := tx.Where("email = ?", identity.Email).Limit(1).Find(&user)
+			if found.Error != nil {
+				return nil, found.Error
+			}
+			existing = found.RowsAffected
+		}
+
+		switch {
+		case existing > 0:
+			// An unverified email could be anybody's, so it's not enough
+			// to take over an existing account.
+			if !identity.EmailVerified {
+				return nil, errOIDCEmailConflict
+			}
+
+			if !user.EmailVerified {
+				if err := tx.Model(&user).Update("email_verified", true).Error; err != nil {
+					return nil, err
+				}
+			}
+
+		case provider.AllowSignup() && identity.Email != "":
+			user = entities.User{
+				Uid:           uid.MustGenerate(),
+				Email:         identity.Email,
+				Username:      oidcUsername(identity),
+				Role:          role,
+				EmailVerified: identity.EmailVerified,
+			}
+
+			created := entities.FromUser(user, nil)
+			if err := tx.Create(&created).Error; err != nil {
+				return nil, err
+			}
+			user = created.User
+
+			onboarding := entities.SettingOverride{
+				UserId: user.Uid,
+				Name:   settings.SettingNameOnboardingComplete,
+				Value:  "false",
+			}
+			if err := tx.Create(&onboarding).Error; err != nil {
+				return nil, err
+			}
+
+		default:
+			return nil, errOIDCNoAccount
+		}
+
+		link = entities.UserIdentity{
+			UserUid:  user.Uid,
+			Provider: provider.ID(),
+			Subject:  identity.Subject,
+		}
+
+	default:
+		return nil, err
+	}
+
+	link.Email = identity.Email
+	link.LastLoginAt = &now
+	if err := tx.Save(&link).Error; err != nil {
+		return nil, err
+	}
+
+	// The superadmin is set up locally and can't be demoted from outside.
+	if provider.ManagesRoles() && user.Role != role && user.Role != dto.UserRoleSuperadmin {
+		if err := tx.Model(&user).Update("role", role).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+func oidcUsername(identity *oidc.Identity) string {
+	switch {
+	case identity.Username != "":
+		return identity.Username
+	case identity.Name != "":
+		return identity.Name
+	default:
+		name, _, _ := strings.Cut(identity.Email, "@")
+		return name
+	}
+}
+
+// oidcRoutes serves OpenID Connect login under /auth/oidc. Second factors
+// are the identity provider's business, so a successful callback signs the
+// user straight in.
+func oidcRoutes(db *gorm.DB, logger *slog.Logger) func(r chi.Router) {
+	registry, err := oidc.NewRegistry(config.AppConfig.Security.OIDCProviders, oidcCallbackURL)
+	if err != nil {
+		logger.Error("invalid oidc provider configuration, oidc login is disabled", slog.Any("error", err))
+		registry, _ = oidc.NewRegistry(nil, oidcCallbackURL)
+	}
+
+	return func(r chi.Router) {
+		r.Get("/providers", func(res http.ResponseWriter, req *http.Request) {
+			render.JSON(res, req, dto.OIDCProviderListResponse{Items: registry.Providers()})
+		})
+
+		r.Get("/{provider}/login", func(res http.ResponseWriter, req *http.Request) {
+			provider, err := registry.Get(req.Context(), chi.URLParam(req, "provider"))
+			if err != nil {
+				if errors.Is(err, oidc.ErrUnknownProvider) {
+					render.Status(req, http.StatusNotFound)
+					render.JSON(res, req, dto.ErrorResponse{Error: "Provider not found"})
+					return
+				}
+
+				libhttp.ServerError(res, req, err, logger, nil,
+					"oidc provider unavailable",
+					"Signing in with this provider isn't available right now. Please try again later.",
+				)
+				return
+			}
+
+			now := time.Now().UTC()
+			if err := db.Where("expires_at < ?", now).Delete(&entities.OIDCLoginState{}).Error; err != nil {
+				logger.Warn("failed to sweep expired oidc login states", slog.Any("error", err))
+			}
+
+			state := auth.GenerateAuthToken()
+			stateHash, _ := auth.HashSecret(state)
+
+			login := entities.OIDCLoginState{
+				StateHash:    stateHash,
+				Provider:     provider.ID(),
+				Nonce:        auth.GenerateAuthToken(),
+				CodeVerifier: oauth2.GenerateVerifier(),
+				RedirectTo:   safeRedirectPath(req.FormValue("redirect_to")),
+				RememberMe:   req.FormValue("remember_me") == "true",
+				ExpiresAt:    now.Add(oidcLoginTTL),
+			}
+
+			if err := db.Create(&login).Error; err != nil {
+				libhttp.ServerError(res, req, err, logger, nil,
+					"failed to save oidc login state",
+					"Something went wrong while signing you in. Please try again.",
+				)
+				return
+			}
+
+			// Ties the callback to this browser, so nobody can hand someone
+			// else a link that finishes a login as them.
+			http.SetCookie(res, &http.Cookie{
+				Name:     libhttp.RedirectCookie,
+				Value:    stateHash,
+				Expires:  login.ExpiresAt,
+				Path:     "/",
+				Secure:   true,
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+
+			http.Redirect(res, req, provider.AuthCodeURL(state, login.Nonce, login.CodeVerifier), http.StatusFound)
+		})
+
+		r.Get("/{provider}/callback", func(res http.ResponseWriter, req *http.Request) {
+			providerID := chi.URLParam(req, "provider")
+
+			// This is a browser navigation, so failures go back to the login
+			// page rather than out as JSON.
+			fail := func(message string) {
+				http.Redirect(res, req, "/auth/login?error="+url.QueryEscape(message), http.StatusFound)
+			}
+
+			libhttp.ClearCookie(libhttp.RedirectCookie, res)
+
+			stateHash, _ := auth.HashSecret(req.FormValue("state"))
+			cookie, err := req.Cookie(libhttp.RedirectCookie)
+			if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(stateHash)) != 1 {
+				logger.Warn("oidc callback state does not match this browser", slog.String("provider", providerID))
+				fail("Your sign-in session has expired. Please try again.")
+				return
+			}
+
+			var login entities.OIDCLoginState
+			err = db.Where("state_hash = ? AND provider = ? AND expires_at > ?", stateHash, providerID, time.Now().UTC()).First(&login).Error
+			if err != nil {
+				if !errors.Is(err, gorm.ErrRecordNotFound) {
+					logger.Error("failed to get oidc login state", slog.Any("error", err))
+				}
+				fail("Your sign-in session has expired. Please try again.")
+				return
+			}
+
+			if spent := db.Delete(&login); spent.Error != nil || spent.RowsAffected == 0 {
+				fail("Your sign-in session has expired. Please try again.")
+				return
+			}
+
+			if idpErr := req.FormValue("error"); idpErr != "" {
+				logger.Info("oidc provider returned an error", slog.String("provider", providerID), slog.String("error", idpErr))
+				fail("Sign-in was cancelled or refused by the identity provider.")
+				return
+			}
+
+			provider, err := registry.Get(req.Context(), providerID)
+			if err != nil {
+				logger.Error("oidc provider unavailable", slog.String("provider", providerID), slog.Any("error", err))
+				fail("Signing in with this provider isn't available right now. Please try again later.")
+				return
+			}
+
+			identity, err := provider.Exchange(req.Context(), req.FormValue("code"), login.Nonce, login.CodeVerifier)
+			if err != nil {
+				logger.Warn("oidc login rejected", slog.String("provider", providerID), slog.Any("error", err))
+				fail("The identity provider's response could not be verified.")
+				return
+			}
+
+			role, err := provider.Role(identity.Groups)
+			if err != nil {
+				logger.Info("oidc user has no mapped group", slog.String("provider", providerID), slog.String("subject", identity.Subject))
+				fail("Your account isn't allowed to sign in here.")
+				return
+			}
+
+			var user *entities.User
+			err = db.Transaction(func(tx *gorm.DB) error {
+				var err error
+				user, err = resolveOIDCUser(tx, provider, identity, role)
+				return err
+			})
+
+			switch {
+			case errors.Is(err, errOIDCNoAccount):
+				fail("There is no account for you here. Ask an admin to create one.")
+				return
+			case errors.Is(err, errOIDCEmailConflict):
+				fail("An account with your email already exists, but the identity provider hasn't verified that the email is yours.")
+				return
+			case err != nil:
+				logger.Error("failed to resolve oidc user", slog.String("provider", providerID), slog.Any("error", err))
+				fail("Something went wrong while signing you in. Please try again.")
+				return
+			}
+
+			if _, err := createSession(db, res, req, user.Uid, login.RememberMe); err != nil {
+				logger.Error("failed to create session", slog.Any("error", err))
+				fail("Something went wrong while signing you in. Please try again.")
+				return
+			}
+
+			logger.Info("user authenticated with oidc", slog.String("provider", providerID), slog.String("request_id", libhttp.GetRequestID(req)))
+			http.Redirect(res, req, login.RedirectTo, http.StatusFound)
+		})
+	}
+}
@@ -0,0 +1,600 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"gorm.io/gorm"
+
+	"viz/internal/auth"
+	"viz/internal/config"
+	"viz/internal/dto"
+	"viz/internal/entities"
+	libhttp "viz/internal/http"
+	"viz/internal/uid"
+)
+
+// Purposes a WebAuthn ceremony can be started for.
+const (
+	passkeyPurposeRegistration = "registration"
+	passkeyPurposeLogin        = "login"
+	passkeyPurposeSecondFactor = "second_factor"
+)
+
+var errInvalidPasskeyCeremony = errors.New("passkey ceremony is invalid or has expired")
+
+func newWebAuthn() (*webauthn.WebAuthn, error) {
+	security := config.AppConfig.Security
+	return auth.NewWebAuthn(security.WebAuthnRPID, security.WebAuthnOrigins, config.AppConfig.BaseURL)
+}
+
+// startPasskeyCeremony stores the server half of a ceremony and returns the
+// ceremony ID the client finishes it with.
+func startPasskeyCeremony(db *gorm.DB, purpose, userUid, name string, session *webauthn.SessionData) (string, time.Time, error) {
+	now := time.Now().UTC()
+
+	if err := db.Where("expires_at < ?", now).Delete(&entities.WebAuthnCeremony{}).Error; err != nil {
+		return "", time.Time{}, err
+	}
+
+	sessionData, err := json.Marshal(session)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	token := auth.GenerateAuthToken()
+	tokenHash, _ := auth.HashSecret(token)
+
+	ceremony := entities.WebAuthnCeremony{
+		TokenHash:   tokenHash,
+		Purpose:     purpose,
+		UserUid:     userUid,
+		Name:        name,
+		SessionData: string(sessionData),
+		ExpiresAt:   now.Add(auth.PasskeyCeremonyTimeout),
+	}
+
+	if err := db.Create(&ceremony).Error; err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token, ceremony.ExpiresAt, nil
+}
+
+// takePasskeyCeremony looks up and spends a ceremony. An empty userUid
+// matches any user, for discoverable logins.
+func takePasskeyCeremony(db *gorm.DB, token, purpose, userUid string) (*entities.WebAuthnCeremony, *webauthn.SessionData, error) {
+	if token == "" {
+		return nil, nil, errInvalidPasskeyCeremony
+	}
+
+	tokenHash, _ := auth.HashSecret(token)
+
+	var ceremony entities.WebAuthnCeremony
+	err := db.Where("token_hash = ? AND purpose = ? AND expires_at > ?", tokenHash, purpose, time.Now().UTC()).First(&ceremony).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, errInvalidPasskeyCeremony
+		}
+		return nil, nil, err
+	}
+
+	if userUid != "" && ceremony.UserUid != userUid {
+		return nil, nil, errInvalidPasskeyCeremony
+	}
+
+	// A challenge is only good once, whether or not the response checks out.
+	spent := db.Delete(&ceremony)
+	if spent.Error != nil {
+		return nil, nil, spent.Error
+	}
+
+	if spent.RowsAffected == 0 {
+		return nil, nil, errInvalidPasskeyCeremony
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal([]byte(ceremony.SessionData), &session); err != nil {
+		return nil, nil, err
+	}
+
+	return &ceremony, &session, nil
+}
+
+// loadPasskeyUser returns userUid with their stored credentials.
+func loadPasskeyUser(db *gorm.DB, userUid string) (*auth.PasskeyUser, error) {
+	var user entities.User
+	if err := db.Where("uid = ?", userUid).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	var passkeys []entities.PasskeyWithCredential
+	if err := db.Where("user_uid = ?", userUid).Find(&passkeys).Error; err != nil {
+		return nil, err
+	}
+
+	passkeyUser := &auth.PasskeyUser{
+		Uid:         user.Uid,
+		Name:        user.Email,
+		DisplayName: userDisplayName(user),
+		Credentials: make([]webauthn.Credential, len(passkeys)),
+	}
+
+	for i, passkey := range passkeys {
+		passkeyUser.Credentials[i] = toWebAuthnCredential(passkey)
+	}
+
+	return passkeyUser, nil
+}
+
+func toWebAuthnCredential(passkey entities.PasskeyWithCredential) webauthn.Credential {
+	var transports []protocol.AuthenticatorTransport
+	for _, transport := range strings.Split(passkey.Transports, ",") {
+		if transport != "" {
+			transports = append(transports, protocol.AuthenticatorTransport(transport))
+		}
+	}
+
+	return webauthn.Credential{
+		ID:              passkey.CredentialID,
+		PublicKey:       passkey.PublicKey,
+		AttestationType: passkey.AttestationType,
+		Transport:       transports,
+		Flags: webauthn.CredentialFlags{
+			UserPresent:    true,
+			UserVerified:   passkey.UserVerified,
+			BackupEligible: passkey.BackupEligible,
+			BackupState:    passkey.BackupState,
+		},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:    passkey.AAGUID,
+			SignCount: passkey.SignCount,
+		},
+	}
+}
+
+// recordPasskeyUse saves the sign count and flags from a successful
+// assertion. A credential whose sign count went backwards is flagged and
+// refused from then on.
+func recordPasskeyUse(db *gorm.DB, cred *webauthn.Credential) error {
+	err := db.Model(&entities.PasskeyWithCredential{}).
+		Where("credential_id = ?", cred.ID).
+		Updates(map[string]any{
+			"sign_count":    cred.Authenticator.SignCount,
+			"clone_warning": gorm.Expr("clone_warning OR ?", cred.Authenticator.CloneWarning),
+			"backup_state":  cred.Flags.BackupState,
+			"last_used_at":  time.Now().UTC(),
+		}).Error
+
+	if err != nil {
+		return err
+	}
+
+	if cred.Authenticator.CloneWarning {
+		return errInvalidSecondFactor
+	}
+
+	var flagged int64
+	if err := db.Model(&entities.PasskeyWithCredential{}).Where("credential_id = ? AND clone_warning = ?", cred.ID, true).Count(&flagged).Error; err != nil {
+		return err
+	}
+
+	if flagged > 0 {
+		return errInvalidSecondFactor
+	}
+
+	return nil
+}
+
+// verifyPasskeySecondFactor checks a passkey assertion for a second_factor
+// ceremony started for userUid.
+func verifyPasskeySecondFactor(db *gorm.DB, userUid, ceremonyID string, credential map[string]any) error {
+	_, session, err := takePasskeyCeremony(db, ceremonyID, passkeyPurposeSecondFactor, userUid)
+	if err != nil {
+		if errors.Is(err, errInvalidPasskeyCeremony) {
+			return errInvalidSecondFactor
+		}
+		return err
+	}
+
+	w, err := newWebAuthn()
+	if err != nil {
+		return err
+	}
+
+	passkeyUser, err := loadPasskeyUser(db, userUid)
+	if err != nil {
+		return err
+	}
+
+	body, _ := json.Marshal(credential)
+	parsed, err := auth.ParsePasskeyAssertion(body)
+	if err != nil {
+		return errInvalidSecondFactor
+	}
+
+	cred, err := w.ValidateLogin(passkeyUser, *session, parsed)
+	if err != nil {
+		return errInvalidSecondFactor
+	}
+
+	return recordPasskeyUse(db, cred)
+}
+
+// jsonMap re-encodes v as a generic JSON object, for the options fields the
+// spec leaves open.
+func jsonMap(v any) (map[string]any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var out map[string]any
+	return out, json.Unmarshal(data, &out)
+}
+
+// passkeyRoutes serves passkey management under /accounts/me/passkeys.
+func passkeyRoutes(db *gorm.DB, logger *slog.Logger) func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Get("/", func(res http.ResponseWriter, req *http.Request) {
+			user, _ := libhttp.UserFromContext(req)
+
+			var passkeys []entities.PasskeyWithCredential
+			if err := db.Where("user_uid = ?", user.Uid).Order("created_at").Find(&passkeys).Error; err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to list passkeys", "Something went wrong, please try again later")
+				return
+			}
+
+			items := make([]dto.Passkey, len(passkeys))
+			for i, passkey := range passkeys {
+				items[i] = passkey.DTO()
+			}
+
+			render.JSON(res, req, dto.PasskeyListResponse{Items: items})
+		})
+
+		r.Post("/register/begin", func(res http.ResponseWriter, req *http.Request) {
+			user, _ := libhttp.UserFromContext(req)
+
+			var body dto.PasskeyRegistrationRequest
+			if err := render.DecodeJSON(req.Body, &body); err != nil || strings.TrimSpace(body.Name) == "" {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "A name is required"})
+				return
+			}
+
+			w, err := newWebAuthn()
+			if err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "webauthn is misconfigured", "Passkeys are not available on this server")
+				return
+			}
+
+			passkeyUser, err := loadPasskeyUser(db, user.Uid)
+			if err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to load passkeys", "Something went wrong, please try again later")
+				return
+			}
+
+			creation, session, err := w.BeginRegistration(passkeyUser, webauthn.WithExclusions(passkeyUser.Exclusions()))
+			if err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to begin passkey registration", "Something went wrong, please try again later")
+				return
+			}
+
+			ceremonyID, expiresAt, err := startPasskeyCeremony(db, passkeyPurposeRegistration, user.Uid, strings.TrimSpace(body.Name), session)
+			if err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to save passkey ceremony", "Something went wrong, please try again later")
+				return
+			}
+
+			options, err := jsonMap(creation)
+			if err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to encode passkey options", "Something went wrong, please try again later")
+				return
+			}
+
+			render.JSON(res, req, dto.PasskeyCeremony{CeremonyId: ceremonyID, Options: options, ExpiresAt: expiresAt})
+		})
+
+		r.Post("/register/finish", func(res http.ResponseWriter, req *http.Request) {
+			user, _ := libhttp.UserFromContext(req)
+
+			var body dto.PasskeyFinishRequest
+			if err := render.DecodeJSON(req.Body, &body); err != nil || body.Credential == nil {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Invalid request body"})
+				return
+			}
+
+			ceremony, session, err := takePasskeyCeremony(db, body.CeremonyId, passkeyPurposeRegistration, user.Uid)
+			if err != nil {
+				if errors.Is(err, errInvalidPasskeyCeremony) {
+					render.Status(req, http.StatusBadRequest)
+					render.JSON(res, req, dto.ErrorResponse{Error: "Passkey registration is invalid or has expired"})
+					return
+				}
+
+				libhttp.ServerError(res, req, err, logger, nil, "failed to get passkey ceremony", "Something went wrong, please try again later")
+				return
+			}
+
+			w, err := newWebAuthn()
+			if err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "webauthn is misconfigured", "Passkeys are not available on this server")
+				return
+			}
+
+			passkeyUser, err := loadPasskeyUser(db, user.Uid)
+			if err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to load passkeys", "Something went wrong, please try again later")
+				return
+			}
+
+			credential, _ := json.Marshal(body.Credential)
+			parsed, err := auth.ParsePasskeyRegistration(credential)
+			if err != nil {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Invalid passkey credential"})
+				return
+			}
+
+			cred, err := w.CreateCredential(passkeyUser, *session, parsed)
+			if err != nil {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Passkey could not be verified"})
+				return
+			}
+
+			transports := make([]string, len(cred.Transport))
+			for i, transport := range cred.Transport {
+				transports[i] = string(transport)
+			}
+
+			passkey := entities.PasskeyWithCredential{
+				Passkey: entities.Passkey{
+					Uid:            uid.MustGenerate(),
+					Name:           ceremony.Name,
+					BackupEligible: cred.Flags.BackupEligible,
+				},
+				UserUid:         user.Uid,
+				CredentialID:    cred.ID,
+				PublicKey:       cred.PublicKey,
+				AttestationType: cred.AttestationType,
+				Transports:      strings.Join(transports, ","),
+				AAGUID:          cred.Authenticator.AAGUID,
+				SignCount:       cred.Authenticator.SignCount,
+				UserVerified:    cred.Flags.UserVerified,
+				BackupState:     cred.Flags.BackupState,
+			}
+
+			var recoveryCodes []string
+			err = db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Create(&passkey).Error; err != nil {
+					return err
+				}
+
+				// The first second factor comes with recovery codes, the
+				// same as enabling TOTP would.
+				var existing int64
+				if err := tx.Model(&entities.RecoveryCode{}).Where("user_uid = ?", user.Uid).Count(&existing).Error; err != nil {
+					return err
+				}
+
+				if !user.TwoFactorEnabled && existing == 0 {
+					codes, err := replaceRecoveryCodes(tx, user.Uid)
+					if err != nil {
+						return err
+					}
+					recoveryCodes = codes
+				}
+
+				_, err := syncTwoFactorEnabled(tx, user.Uid)
+				return err
+			})
+
+			if err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to save passkey", "Something went wrong, please try again later")
+				return
+			}
+
+			clearCurrentSessionCache(req)
+			logger.Info("passkey registered", slog.String("user_uid", user.Uid), slog.String("passkey_uid", passkey.Uid))
+
+			result := dto.PasskeyRegistrationResult{Passkey: passkey.DTO()}
+			if recoveryCodes != nil {
+				result.RecoveryCodes = &recoveryCodes
+			}
+
+			render.Status(req, http.StatusCreated)
+			render.JSON(res, req, result)
+		})
+
+		r.Patch("/{uid}", func(res http.ResponseWriter, req *http.Request) {
+			user, _ := libhttp.UserFromContext(req)
+
+			var body dto.PasskeyUpdate
+			if err := render.DecodeJSON(req.Body, &body); err != nil || strings.TrimSpace(body.Name) == "" {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "A name is required"})
+				return
+			}
+
+			var passkey entities.PasskeyWithCredential
+			if err := db.Where("uid = ? AND user_uid = ?", chi.URLParam(req, "uid"), user.Uid).First(&passkey).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					render.Status(req, http.StatusNotFound)
+					render.JSON(res, req, dto.ErrorResponse{Error: "Passkey not found"})
+					return
+				}
+
+				libhttp.ServerError(res, req, err, logger, nil, "failed to get passkey", "Something went wrong, please try again later")
+				return
+			}
+
+			if err := db.Model(&passkey).Update("name", strings.TrimSpace(body.Name)).Error; err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to rename passkey", "Something went wrong, please try again later")
+				return
+			}
+
+			render.JSON(res, req, passkey.DTO())
+		})
+
+		r.Delete("/{uid}", func(res http.ResponseWriter, req *http.Request) {
+			user, _ := libhttp.UserFromContext(req)
+
+			var passkey entities.PasskeyWithCredential
+			if err := db.Where("uid = ? AND user_uid = ?", chi.URLParam(req, "uid"), user.Uid).First(&passkey).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					render.Status(req, http.StatusNotFound)
+					render.JSON(res, req, dto.ErrorResponse{Error: "Passkey not found"})
+					return
+				}
+
+				libhttp.ServerError(res, req, err, logger, nil, "failed to get passkey", "Something went wrong, please try again later")
+				return
+			}
+
+			var forbidden bool
+			err := db.Transaction(func(tx *gorm.DB) error {
+				// Hard delete so the credential ID can be registered again.
+				if err := tx.Unscoped().Delete(&passkey).Error; err != nil {
+					return err
+				}
+
+				enabled, err := syncTwoFactorEnabled(tx, user.Uid)
+				if err != nil {
+					return err
+				}
+
+				if !enabled && libhttp.TwoFactorRequired(user) {
+					forbidden = true
+					return errInvalidSecondFactor
+				}
+
+				return nil
+			})
+
+			if forbidden {
+				render.Status(req, http.StatusForbidden)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Two-factor authentication is required for admin accounts"})
+				return
+			}
+
+			if err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to delete passkey", "Something went wrong, please try again later")
+				return
+			}
+
+			clearCurrentSessionCache(req)
+			logger.Info("passkey deleted", slog.String("user_uid", user.Uid), slog.String("passkey_uid", passkey.Uid))
+			render.JSON(res, req, dto.MessageResponse{Message: "Passkey deleted"})
+		})
+	}
+}
+
+// passkeyLoginRoutes serves passkey sign-in under /auth/passkey. A passkey
+// login has to verify the user, so it stands in for both factors.
+func passkeyLoginRoutes(db *gorm.DB, logger *slog.Logger) func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Post("/begin", func(res http.ResponseWriter, req *http.Request) {
+			w, err := newWebAuthn()
+			if err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "webauthn is misconfigured", "Passkeys are not available on this server")
+				return
+			}
+
+			assertion, session, err := w.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+			if err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to begin passkey login", "Something went wrong while signing you in. Please try again.")
+				return
+			}
+
+			ceremonyID, expiresAt, err := startPasskeyCeremony(db, passkeyPurposeLogin, "", "", session)
+			if err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to save passkey ceremony", "Something went wrong while signing you in. Please try again.")
+				return
+			}
+
+			options, err := jsonMap(assertion)
+			if err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to encode passkey options", "Something went wrong while signing you in. Please try again.")
+				return
+			}
+
+			render.JSON(res, req, dto.PasskeyCeremony{CeremonyId: ceremonyID, Options: options, ExpiresAt: expiresAt})
+		})
+
+		r.Post("/finish", func(res http.ResponseWriter, req *http.Request) {
+			var body dto.PasskeyFinishRequest
+			if err := render.DecodeJSON(req.Body, &body); err != nil || body.Credential == nil {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Invalid request body"})
+				return
+			}
+
+			_, session, err := takePasskeyCeremony(db, body.CeremonyId, passkeyPurposeLogin, "")
+			if err != nil {
+				if errors.Is(err, errInvalidPasskeyCeremony) {
+					render.Status(req, http.StatusUnauthorized)
+					render.JSON(res, req, dto.ErrorResponse{Error: "Passkey login is invalid or has expired"})
+					return
+				}
+
+				libhttp.ServerError(res, req, err, logger, nil, "failed to get passkey ceremony", "Something went wrong while signing you in. Please try again.")
+				return
+			}
+
+			w, err := newWebAuthn()
+			if err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "webauthn is misconfigured", "Passkeys are not available on this server")
+				return
+			}
+
+			credential, _ := json.Marshal(body.Credential)
+			parsed, err := auth.ParsePasskeyAssertion(credential)
+			if err != nil {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Invalid passkey credential"})
+				return
+			}
+
+			var userUid string
+			cred, err := w.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+				userUid = string(userHandle)
+				return loadPasskeyUser(db, userUid)
+			}, *session, parsed)
+
+			if err == nil {
+				err = recordPasskeyUse(db, cred)
+			}
+
+			if err != nil {
+				logger.Warn("passkey login rejected", slog.String("request_id", libhttp.GetRequestID(req)), slog.Any("error", err))
+				render.Status(req, http.StatusUnauthorized)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Passkey could not be verified"})
+				return
+			}
+
+			remember := body.RememberMe != nil && *body.RememberMe
+			if _, err := createSession(db, res, req, userUid, remember); err != nil {
+				libhttp.ServerError(res, req, err, logger, nil,
+					"failed to create session",
+					"Something went wrong while signing you in. Please try again.",
+				)
+				return
+			}
+
+			logger.Info("user authenticated with passkey", slog.String("request_id", libhttp.GetRequestID(req)))
+			render.Status(req, http.StatusOK)
+			render.JSON(res, req, dto.LoginResult{Message: "User authenticated"})
+		})
+	}
+}
@@ -0,0 +1,526 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+
+	"viz/internal/analytics"
+	"viz/internal/downloads"
+	"viz/internal/dto"
+	"viz/internal/entities"
+	libhttp "viz/internal/http"
+	"viz/internal/imageops"
+	"viz/internal/images"
+	"viz/internal/transform"
+)
+
+// publicShare is a collection share link that has been checked, with the
+// images it currently gives access to.
+type publicShare struct {
+	token      *entities.DownloadToken
+	collection entities.Collection
+	uids       []string
+}
+
+// Share sessions let a browser that has given a share link's password use
+// the rest of the link without giving it again, so the password is checked
+// once rather than for every image in the gallery.
+const (
+	shareSessionCookie   = "viz-share_session"
+	shareSessionKind     = "share_session"
+	shareSessionLifetime = 12 * time.Hour
+	// sharePasswordHeader is preferred to the password query param, which
+	// ends up in access logs.
+	sharePasswordHeader = "X-Share-Password"
+)
+
+// sharePassword is the password req gives for a share link.
+func sharePassword(req *http.Request) string {
+	if password := req.Header.Get(sharePasswordHeader); password != "" {
+		return password
+	}
+
+	return req.URL.Query().Get("password")
+}
+
+// shareSessionPath is the path of share link token's routes, which its
+// session cookie is scoped to.
+func shareSessionPath(req *http.Request, token string) string {
+	prefix, _, _ := strings.Cut(req.URL.Path, "/"+token)
+	return prefix + "/" + token
+}
+
+// setShareSession gives the browser a share session for token. It doesn't
+// outlast the link, and stops working if the link's password changes.
+func setShareSession(res http.ResponseWriter, req *http.Request, token *entities.DownloadToken) {
+	expires := time.Now().Add(shareSessionLifetime)
+	if token.ExpiresAt != nil && token.ExpiresAt.Before(expires) {
+		expires = *token.ExpiresAt
+	}
+
+	session := fmt.Sprintf("%d:%d:%s", token.ID, expires.Unix(), downloads.PasswordVersion(token))
+	http.SetCookie(res, &http.Cookie{
+		Name:     shareSessionCookie,
+		Value:    libhttp.SignToken(shareSessionKind, session),
+		Expires:  expires,
+		Path:     shareSessionPath(req, token.Uid),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// shareSession returns share link token if req has a valid share session
+// for it, or nil.
+func shareSession(req *http.Request, db *gorm.DB, token string) *entities.DownloadToken {
+	cookie, err := req.Cookie(shareSessionCookie)
+	if err != nil {
+		return nil
+	}
+
+	session, err := libhttp.VerifySignedToken(shareSessionKind, cookie.Value)
+	if err != nil {
+		return nil
+	}
+
+	parts := strings.Split(session, ":")
+	if len(parts) != 3 {
+		return nil
+	}
+
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() >= expires {
+		return nil
+	}
+
+	var dt entities.DownloadToken
+	if err := db.First(&dt, "id = ? AND uid = ?", parts[0], token).Error; err != nil {
+		return nil
+	}
+
+	if (dt.ExpiresAt != nil && dt.ExpiresAt.Before(time.Now())) || downloads.PasswordVersion(&dt) != parts[2] {
+		return nil
+	}
+
+	return &dt
+}
+
+// loadPublicShare checks the share link token in the URL, and its password
+// or share session. Download tokens for a fixed list of images aren't share
+// links. It writes the error response itself when it returns false.
+func loadPublicShare(res http.ResponseWriter, req *http.Request, db *gorm.DB, logger *slog.Logger, limiter *libhttp.Limiter) (*publicShare, bool) {
+	token := chi.URLParam(req, "token")
+
+	var uids []string
+	tokenEntity := shareSession(req, db, token)
+	if tokenEntity != nil {
+		var err error
+		if uids, err = downloads.TokenImageUids(db, tokenEntity); err != nil {
+			libhttp.ServerError(res, req, err, logger, nil,
+				"failed to get shared images",
+				"Something went wrong, please try again later",
+			)
+			return nil, false
+		}
+	} else {
+		var ok bool
+		uids, tokenEntity, ok = checkTokenPassword(res, req, db, limiter, token, sharePassword(req))
+		if !ok {
+			return nil, false
+		}
+
+		if tokenEntity.Password != nil {
+			setShareSession(res, req, tokenEntity)
+		}
+	}
+
+	if tokenEntity.CollectionUid == nil {
+		render.Status(req, http.StatusUnauthorized)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Invalid or expired token"})
+		return nil, false
+	}
+
+	share := &publicShare{token: tokenEntity, uids: uids}
+	if err := db.Preload("Thumbnail").First(&share.collection, "uid = ?", *tokenEntity.CollectionUid).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			render.Status(req, http.StatusNotFound)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Collection not found"})
+			return nil, false
+		}
+
+		libhttp.ServerError(res, req, err, logger, nil,
+			"failed to get shared collection",
+			"Something went wrong, please try again later",
+		)
+		return nil, false
+	}
+
+	return share, true
+}
+
+// sharedImagePath is the file path of the image uid through share link
+// token.
+func sharedImagePath(token, uid string) string {
+	return fmt.Sprintf("/public/shares/%s/images/%s/file", url.PathEscape(token), uid)
+}
+
+// sharedImagePaths rewrites img's paths to go through the share link, so a
+// recipient's requests are checked against the link rather than an account.
+func sharedImagePaths(token string, img *entities.ImageAsset) dto.ImagePaths {
+	base := sharedImagePath(token, img.Uid)
+	rebase := func(path string) string {
+		if _, query, found := strings.Cut(path, "?"); found {
+			return base + "?" + query
+		}
+		return base
+	}
+
+	return dto.ImagePaths{
+		Original:  base,
+		Thumbnail: rebase(img.ImagePaths.Thumbnail),
+		Preview:   rebase(img.ImagePaths.Preview),
+	}
+}
+
+// shareEmbedLifetime is how long the signed embed URLs of a share link last.
+const shareEmbedLifetime = 7 * 24 * time.Hour
+
+// shareEmbedExpiry is when signed URLs made for share link token now
+// expire. It only moves on once a day, so the URLs stay the same through
+// the day and CDNs can cache them. They don't outlast the link's own expiry.
+func shareEmbedExpiry(token *entities.DownloadToken) time.Time {
+	expires := time.Now().UTC().Truncate(24 * time.Hour).Add(shareEmbedLifetime)
+	if token.ExpiresAt != nil && token.ExpiresAt.Before(expires) {
+		expires = *token.ExpiresAt
+	}
+
+	return expires
+}
+
+// Query params tying an embed URL to the share link it was made for, so it
+// stops working along with the link. The link goes by its row ID rather
+// than its token, since embed URLs end up on other sites.
+const (
+	shareEmbedParam         = "share"
+	shareEmbedPasswordParam = "share_pv"
+)
+
+// shareEmbedURL signs the file path of image uid with params for share link
+// token. The URL is checked against the link again whenever it's used.
+func shareEmbedURL(token *entities.DownloadToken, uid string, params *transform.TransformParams) string {
+	query, _ := url.ParseQuery(params.ToQueryString())
+	query.Set(shareEmbedParam, strconv.FormatUint(uint64(token.ID), 10))
+	query.Set(shareEmbedPasswordParam, downloads.PasswordVersion(token))
+
+	return libhttp.SignURL(fmt.Sprintf("/images/%s/file", uid), query, shareEmbedExpiry(token), "")
+}
+
+// shareEmbedPaths signs img's paths so they can be embedded on other sites.
+// The original, with its metadata, is only embeddable if the link allows
+// downloads; otherwise it is the preview instead.
+func shareEmbedPaths(token *entities.DownloadToken, img *entities.ImageAsset) *dto.ImagePaths {
+	sign := func(path string) string {
+		params, err := imageops.ParseTransformParams(path)
+		if err != nil {
+			params = &transform.TransformParams{}
+		}
+		return shareEmbedURL(token, img.Uid, params)
+	}
+
+	original := &transform.TransformParams{}
+	if !token.AllowDownload {
+		preview, _ := images.GetPermanentTransformParams(images.TransformPreview)
+		original = &preview
+	}
+
+	return &dto.ImagePaths{
+		Original:  shareEmbedURL(token, img.Uid, original),
+		Thumbnail: sign(img.ImagePaths.Thumbnail),
+		Preview:   sign(img.ImagePaths.Preview),
+	}
+}
+
+// checkShareEmbed checks that the share link a signed embed URL for image
+// uid was made for still allows it: that the link hasn't been revoked or
+// expired, still allows embedding, has the same password and still includes
+// the image. It writes the error response itself when it returns false.
+func checkShareEmbed(res http.ResponseWriter, req *http.Request, db *gorm.DB, logger *slog.Logger, uid string) bool {
+	query := req.URL.Query()
+
+	var token entities.DownloadToken
+	err := db.First(&token, "id = ?", query.Get(shareEmbedParam)).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		libhttp.ServerError(res, req, err, logger, nil,
+			"failed to get share link of embed",
+			"Something went wrong, please try again later",
+		)
+		return false
+	}
+
+	valid := err == nil && token.AllowEmbed &&
+		(token.ExpiresAt == nil || token.ExpiresAt.After(time.Now())) &&
+		downloads.PasswordVersion(&token) == query.Get(shareEmbedPasswordParam)
+
+	if valid {
+		uids, err := downloads.TokenImageUids(db, &token)
+		valid = err == nil && slices.Contains(uids, uid)
+	}
+
+	if !valid {
+		render.Status(req, http.StatusUnauthorized)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Invalid or expired token"})
+		return false
+	}
+
+	return true
+}
+
+// publicImage is what a share link recipient sees of img.
+func (s *publicShare) publicImage(img *entities.ImageAsset, addedAt map[string]dto.CollectionImage) dto.PublicImage {
+	image := dto.PublicImage{
+		Uid:         img.Uid,
+		Name:        img.Name,
+		Description: img.Description,
+		Width:       img.Width,
+		Height:      img.Height,
+		AddedAt:     addedAt[img.Uid].AddedAt,
+		ImagePaths:  sharedImagePaths(s.token.Uid, img),
+	}
+
+	if s.token.AllowEmbed {
+		image.EmbedPaths = shareEmbedPaths(s.token, img)
+	}
+
+	if s.token.ShowMetadata {
+		image.TakenAt = img.TakenAt
+		image.ImageMetadata = img.ImageMetadata
+		image.Exif = img.Exif
+	}
+
+	return image
+}
+
+// PublicSharesRouter serves collection share links to people without an
+// account. Access is decided by the link alone: its password, expiry and
+// what it allows.
+func PublicSharesRouter(db *gorm.DB, logger *slog.Logger, limiter *libhttp.Limiter, broker *libhttp.WSBroker, recorder *analytics.Recorder) *chi.Mux {
+	router := chi.NewRouter()
+
+	// Galleries load many images at once, so only opening a link and
+	// downloading it are throttled. Wrong passwords lock out on every route.
+	router.With(limiter.Throttle(rateLimitScopeDownload)).Get("/{token}", func(res http.ResponseWriter, req *http.Request) {
+		share, ok := loadPublicShare(res, req, db, logger, limiter)
+		if !ok {
+			return
+		}
+
+		_ = downloads.TouchToken(db, share.token)
+		recordCollectionView(recorder, req, &share.collection, share.token.Uid)
+
+		collection := dto.PublicCollection{
+			Uid:         share.collection.Uid,
+			Name:        share.collection.Name,
+			Description: share.collection.Description,
+			ImageCount:  len(share.uids),
+		}
+
+		if thumb := share.collection.Thumbnail; thumb != nil && slices.Contains(share.uids, thumb.Uid) {
+			paths := sharedImagePaths(share.token.Uid, thumb)
+			collection.Thumbnail = &paths
+		}
+
+		render.JSON(res, req, dto.PublicShare{
+			Collection:    collection,
+			Description:   share.token.Description,
+			AllowDownload: share.token.AllowDownload,
+			ShowMetadata:  share.token.ShowMetadata,
+			AllowProofing: lo.FromPtr(share.token.AllowProofing),
+			ExpiresAt:     share.token.ExpiresAt,
+		})
+	})
+
+	router.Get("/{token}/images", func(res http.ResponseWriter, req *http.Request) {
+		share, ok := loadPublicShare(res, req, db, logger, limiter)
+		if !ok {
+			return
+		}
+
+		limit, err := strconv.Atoi(req.URL.Query().Get("limit"))
+		if err != nil || limit <= 0 {
+			limit = 100
+		}
+
+		offset, err := strconv.Atoi(req.URL.Query().Get("offset"))
+		if err != nil || offset < 0 {
+			offset = 0
+		}
+
+		// Pages follow the collection's own order
+		page := share.uids[min(offset, len(share.uids)):min(offset+limit, len(share.uids))]
+
+		var imgs []entities.ImageAsset
+		if len(page) > 0 {
+			if err := db.Where("uid IN ?", page).Find(&imgs).Error; err != nil {
+				libhttp.ServerError(res, req, err, logger, nil,
+					"failed to get shared images",
+					"Something went wrong, please try again later",
+				)
+				return
+			}
+		}
+
+		byUid := make(map[string]*entities.ImageAsset, len(imgs))
+		for i := range imgs {
+			byUid[imgs[i].Uid] = &imgs[i]
+		}
+
+		addedAt := make(map[string]dto.CollectionImage)
+		if share.collection.Images != nil {
+			for _, m := range *share.collection.Images {
+				addedAt[m.Uid] = m
+			}
+		}
+
+		items := make([]dto.PublicImage, 0, len(page))
+		for _, uid := range page {
+			if img, ok := byUid[uid]; ok {
+				items = append(items, share.publicImage(img, addedAt))
+			}
+		}
+
+		pageLink := func(offset int) *string {
+			link := fmt.Sprintf("/public/shares/%s/images?offset=%d&limit=%d", url.PathEscape(share.token.Uid), offset, limit)
+			return &link
+		}
+
+		list := dto.PublicImageList{
+			Items:  items,
+			Offset: offset,
+			Limit:  limit,
+			Count:  len(share.uids),
+		}
+
+		if offset > 0 {
+			list.Prev = pageLink(max(offset-limit, 0))
+		}
+		if offset+limit < len(share.uids) {
+			list.Next = pageLink(offset + limit)
+		}
+
+		render.JSON(res, req, list)
+	})
+
+	router.Get("/{token}/images/{uid}/file", func(res http.ResponseWriter, req *http.Request) {
+		share, ok := loadPublicShare(res, req, db, logger, limiter)
+		if !ok {
+			return
+		}
+
+		uid := chi.URLParam(req, "uid")
+		if !slices.Contains(share.uids, uid) {
+			render.Status(req, http.StatusNotFound)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Image not found"})
+			return
+		}
+
+		downloads.SetEmbedPolicy(res, share.token)
+
+		isDownload := req.URL.Query().Get("download") == "1"
+		if isDownload && !share.token.AllowDownload {
+			render.Status(req, http.StatusForbidden)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Downloads not permitted for this token"})
+			return
+		}
+
+		params, err := imageops.ParseTransformParams(req.URL.String())
+		if err != nil || params.Height < 0 || params.Width < 0 {
+			render.Status(req, http.StatusBadRequest)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Invalid transform parameters"})
+			return
+		}
+
+		var imgEnt entities.ImageAsset
+		if err := db.Where("uid = ?", uid).First(&imgEnt).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				render.Status(req, http.StatusNotFound)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Image not found"})
+				return
+			}
+
+			libhttp.ServerError(res, req, err, logger, nil,
+				"failed to get shared image",
+				"Something went wrong, please try again later",
+			)
+			return
+		}
+
+		if imgEnt.ImageMetadata == nil {
+			render.Status(req, http.StatusInternalServerError)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Image is corrupted (missing metadata)"})
+			return
+		}
+
+		if isDownload && !recordTokenDownload(res, req, db, logger, share.token, []string{uid}) {
+			return
+		}
+
+		recordImageFile(recorder, req, &imgEnt, params, isDownload, share.collection.Uid, share.token.Uid)
+
+		logger := logger.With(slog.String("uid", uid))
+		if !share.token.ShowMetadata {
+			params.KeepMetadata = false
+		}
+
+		// The original is only served to links that allow downloading it,
+		// others get the preview, which has no metadata
+		hasTransformParams := params.Format != "" || params.Width > 0 || params.Height > 0 || params.Quality > 0 || params.Rotate > 0 || params.Flip != "" || params.LongEdge > 0 || params.ColorProfile != "" || params.KeepMetadata
+		if !hasTransformParams && !share.token.AllowDownload {
+			preview, _ := images.GetPermanentTransformParams(images.TransformPreview)
+			params, hasTransformParams = &preview, true
+		}
+
+		if !hasTransformParams {
+			serveOriginalImage(res, req, logger, &imgEnt, isDownload)
+			return
+		}
+
+		serveTransformedImage(res, req, logger, &imgEnt, params, isDownload)
+	})
+
+	// Client proofing, for links that allow it
+	router.Route("/{token}/proofing", proofingGuestRoutes(db, logger, limiter, broker))
+
+	router.With(limiter.Throttle(rateLimitScopeDownload)).Get("/{token}/download", func(res http.ResponseWriter, req *http.Request) {
+		share, ok := loadPublicShare(res, req, db, logger, limiter)
+		if !ok {
+			return
+		}
+
+		if !share.token.AllowDownload {
+			render.Status(req, http.StatusForbidden)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Downloads not permitted for this token"})
+			return
+		}
+
+		if !recordTokenDownload(res, req, db, logger, share.token, share.uids) {
+			return
+		}
+
+		recordDownloads(recorder, req, share.uids, share.collection.Uid, share.token.Uid)
+		streamZipResponse(res, req, db, logger, share.uids, share.collection.Name+".zip", nil)
+	})
+
+	return router
+}
@@ -0,0 +1,268 @@
+package routes_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"viz/api/routes"
+	"viz/internal/downloads"
+	"viz/internal/dto"
+	"viz/internal/entities"
+	libhttp "viz/internal/http"
+	"viz/internal/images"
+	"viz/internal/transform"
+)
+
+var (
+	originalBytes = []byte("original image, with its exif")
+	previewBytes  = []byte("preview image, metadata stripped")
+)
+
+// newShareTestServer serves share links and, behind auth as in the API,
+// images. broker may be nil.
+func newShareTestServer(t *testing.T, db *gorm.DB, broker *libhttp.WSBroker) *httptest.Server {
+	t.Helper()
+
+	libhttp.URLSigningKey = []byte("0123456789abcdef0123456789abcdef")
+	logger := newTestLogger()
+
+	router := chi.NewRouter()
+	router.Route("/api", func(r chi.Router) {
+		r.Mount("/public/shares", routes.PublicSharesRouter(db, logger, nil, broker, nil))
+		r.With(libhttp.AuthMiddleware(db, logger)).Mount("/images", routes.ImagesRouter(db, logger, nil, nil))
+	})
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// createSharedImage creates image uid in a new collection. Its original is
+// on disk and its preview is already cached, so neither needs libvips.
+func createSharedImage(t *testing.T, db *gorm.DB, uid string) entities.Collection {
+	t.Helper()
+
+	img := entities.ImageAsset{
+		Uid:           uid,
+		Name:          uid,
+		Width:         4000,
+		Height:        3000,
+		ImageMetadata: &dto.ImageMetadata{FileName: uid + ".jpg", FileType: "jpeg", Checksum: uid + "_checksum"},
+	}
+	require.NoError(t, db.Create(&img).Error)
+	require.NoError(t, images.SaveImage(originalBytes, uid, img.ImageMetadata.FileName))
+
+	preview, _ := images.GetPermanentTransformParams(images.TransformPreview)
+	key := strings.Trim(*transform.CreateTransformEtag(img, &preview), `"`)
+	require.NoError(t, images.WriteCachedTransform(uid, key, preview.Format, previewBytes))
+
+	collection := entities.Collection{
+		Uid:     uid + "_col",
+		Name:    "Shared",
+		Private: lo.ToPtr(true),
+		Images:  &[]dto.CollectionImage{{Uid: uid}},
+	}
+	require.NoError(t, db.Create(&collection).Error)
+	return collection
+}
+
+// createShareLink creates a share link for collection.
+func createShareLink(t *testing.T, db *gorm.DB, collection entities.Collection, opts downloads.TokenOptions) *entities.DownloadToken {
+	t.Helper()
+
+	opts.CollectionUid = collection.Uid
+	tok, err := downloads.CreateTokenWithOptions(db, nil, opts)
+	require.NoError(t, err)
+
+	var token entities.DownloadToken
+	require.NoError(t, db.First(&token, "uid = ?", tok).Error)
+	return &token
+}
+
+func getBody(t *testing.T, url string) (int, []byte) {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, body
+}
+
+// shareEmbedPaths lists the images of share link token and returns the
+// embed paths of the first.
+func shareEmbedPaths(t *testing.T, server *httptest.Server, token string) *dto.ImagePaths {
+	t.Helper()
+
+	status, body := getBody(t, server.URL+"/api/public/shares/"+token+"/images")
+	require.Equal(t, http.StatusOK, status, string(body))
+
+	var list dto.PublicImageList
+	require.NoError(t, json.Unmarshal(body, &list))
+	require.Len(t, list.Items, 1)
+	require.NotNil(t, list.Items[0].EmbedPaths)
+	return list.Items[0].EmbedPaths
+}
+
+func TestPublicShareOriginalNeedsDownload(t *testing.T) {
+	db := newTestDB(t)
+	server := newShareTestServer(t, db, nil)
+
+	collection := createSharedImage(t, db, "share_orig_img")
+	noDownload := createShareLink(t, db, collection, downloads.TokenOptions{AllowEmbed: true})
+	withDownload := createShareLink(t, db, collection, downloads.TokenOptions{AllowDownload: true, AllowEmbed: true, ShowMetadata: true})
+
+	file := server.URL + "/api/public/shares/%s/images/share_orig_img/file"
+
+	// Without downloads the "original" is the preview, with no metadata
+	status, body := getBody(t, strings.Replace(file, "%s", noDownload.Uid, 1))
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, previewBytes, body)
+
+	status, _ = getBody(t, strings.Replace(file, "%s", noDownload.Uid, 1)+"?download=1")
+	assert.Equal(t, http.StatusForbidden, status)
+
+	status, body = getBody(t, server.URL+"/api"+shareEmbedPaths(t, server, noDownload.Uid).Original)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, previewBytes, body)
+
+	// Links that allow downloads get the original
+	status, body = getBody(t, strings.Replace(file, "%s", withDownload.Uid, 1))
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, originalBytes, body)
+
+	status, body = getBody(t, server.URL+"/api"+shareEmbedPaths(t, server, withDownload.Uid).Original)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, originalBytes, body)
+}
+
+func TestShareEmbedStopsWithLink(t *testing.T) {
+	db := newTestDB(t)
+	server := newShareTestServer(t, db, nil)
+
+	collection := createSharedImage(t, db, "share_embed_img")
+	setImages := func(imgs ...dto.CollectionImage) error {
+		collection.Images = &imgs
+		return db.Select("images").Updates(&collection).Error
+	}
+
+	tests := []struct {
+		name   string
+		revoke func(token *entities.DownloadToken) error
+	}{
+		{"revoked", func(token *entities.DownloadToken) error {
+			return db.Delete(token).Error
+		}},
+		{"expired", func(token *entities.DownloadToken) error {
+			return db.Model(token).Update("expires_at", time.Now().Add(-time.Minute)).Error
+		}},
+		{"password changed", func(token *entities.DownloadToken) error {
+			hash, err := downloads.HashPassword("changed")
+			if err != nil {
+				return err
+			}
+			return db.Model(token).Update("password", hash).Error
+		}},
+		{"embedding turned off", func(token *entities.DownloadToken) error {
+			return db.Model(token).Update("allow_embed", false).Error
+		}},
+		{"image removed", func(token *entities.DownloadToken) error {
+			return setImages()
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, setImages(dto.CollectionImage{Uid: "share_embed_img"}))
+			token := createShareLink(t, db, collection, downloads.TokenOptions{AllowEmbed: true, TTL: time.Hour})
+			embed := server.URL + "/api" + shareEmbedPaths(t, server, token.Uid).Original
+
+			status, body := getBody(t, embed)
+			require.Equal(t, http.StatusOK, status, string(body))
+
+			require.NoError(t, tt.revoke(token))
+			status, _ = getBody(t, embed)
+			assert.Equal(t, http.StatusUnauthorized, status)
+		})
+	}
+
+	// Embed URLs don't outlast the link, and don't give its token away
+	require.NoError(t, setImages(dto.CollectionImage{Uid: "share_embed_img"}))
+	token := createShareLink(t, db, collection, downloads.TokenOptions{AllowEmbed: true, TTL: time.Hour})
+	embed, err := url.Parse(shareEmbedPaths(t, server, token.Uid).Thumbnail)
+	require.NoError(t, err)
+	assert.Equal(t, strconv.FormatInt(token.ExpiresAt.Unix(), 10), embed.Query().Get(libhttp.SignatureExpiresParam))
+	assert.NotContains(t, embed.String(), token.Uid)
+}
+
+func TestShareSessionChecksPasswordOnce(t *testing.T) {
+	db := newTestDB(t)
+	server := newShareTestServer(t, db, nil)
+
+	collection := createSharedImage(t, db, "share_session_img")
+	token := createShareLink(t, db, collection, downloads.TokenOptions{Password: "secret", AllowDownload: true})
+	other := createShareLink(t, db, collection, downloads.TokenOptions{Password: "other"})
+	base := server.URL + "/api/public/shares/" + token.Uid
+
+	get := func(url string, header http.Header) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		req.Header = header
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := get(base, http.Header{"X-Share-Password": {"wrong"}})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Empty(t, resp.Cookies())
+
+	resp = get(base, http.Header{"X-Share-Password": {"secret"}})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, resp.Cookies(), 1)
+	cookie := resp.Cookies()[0]
+	assert.Equal(t, "/api/public/shares/"+token.Uid, cookie.Path)
+	assert.True(t, cookie.HttpOnly)
+
+	// The session lets the gallery through without the password, and only
+	// opening the link is counted
+	withSession := http.Header{"Cookie": {cookie.String()}}
+	assert.Equal(t, http.StatusOK, get(base+"/images", withSession).StatusCode)
+	assert.Equal(t, http.StatusOK, get(base+"/images/share_session_img/file", withSession).StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, get(base+"/images", nil).StatusCode)
+
+	var touched entities.DownloadToken
+	require.NoError(t, db.First(&touched, token.ID).Error)
+	assert.Equal(t, int64(1), lo.FromPtr(touched.AccessCount))
+
+	// It's only good for its own link
+	assert.Equal(t, http.StatusUnauthorized,
+		get(server.URL+"/api/public/shares/"+other.Uid+"/images", withSession).StatusCode)
+
+	tampered := *cookie
+	tampered.Value = strings.Replace(cookie.Value, strconv.FormatUint(uint64(token.ID), 10)+":", strconv.FormatUint(uint64(other.ID), 10)+":", 1)
+	assert.Equal(t, http.StatusUnauthorized,
+		get(server.URL+"/api/public/shares/"+other.Uid+"/images", http.Header{"Cookie": {tampered.String()}}).StatusCode)
+
+	// and stops working when the password changes
+	hash, err := downloads.HashPassword("changed")
+	require.NoError(t, err)
+	require.NoError(t, db.Model(token).Update("password", hash).Error)
+	assert.Equal(t, http.StatusUnauthorized, get(base+"/images", withSession).StatusCode)
+}
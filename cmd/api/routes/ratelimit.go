@@ -0,0 +1,62 @@
+package routes
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"gorm.io/gorm"
+
+	"viz/internal/crypto"
+	"viz/internal/entities"
+	libhttp "viz/internal/http"
+	"viz/internal/uid"
+)
+
+// Scopes failures are counted in. Each locks out separately, so a locked
+// out download token doesn't stop its owner from signing in.
+const (
+	rateLimitScopeLogin     = "login"
+	rateLimitScopeTwoFactor = "two_factor"
+	rateLimitScopeDownload  = "download"
+	rateLimitScopeAccount   = "account_recovery"
+	rateLimitScopeOAuth     = "oauth"
+	rateLimitScopeUpload    = "upload_link"
+)
+
+// RecordLockout returns a Limiter.OnLockout that keeps lockouts as
+// SecurityEvents for admins to review.
+func RecordLockout(db *gorm.DB, logger *slog.Logger) func(ctx context.Context, lockout libhttp.Lockout) {
+	return func(ctx context.Context, lockout libhttp.Lockout) {
+		event := entities.SecurityEvent{
+			Uid:            uid.MustGenerate(),
+			Action:         "lockout",
+			Scope:          lockout.Scope,
+			Key:            lockout.Key,
+			Ip:             lockout.IP,
+			Failures:       int(lockout.Failures),
+			LockoutSeconds: int(lockout.Duration.Seconds()),
+		}
+
+		if err := db.WithContext(ctx).Create(&event).Error; err != nil {
+			logger.Error("failed to record lockout", slog.Any("error", err))
+		}
+	}
+}
+
+var (
+	dummyPasswordOnce sync.Once
+	dummyPasswordHash string
+)
+
+// burnPasswordCheck verifies password against a throwaway hash, so signing in
+// to an account that doesn't exist takes as long as one that does.
+func burnPasswordCheck(password string, params *crypto.Argon2Params) {
+	dummyPasswordOnce.Do(func() {
+		dummyPasswordHash, _ = crypto.HashPassword("not the password", params)
+	})
+
+	if dummyPasswordHash != "" {
+		crypto.VerifyPassword(dummyPasswordHash, password, params)
+	}
+}
@@ -11,7 +11,6 @@ import (
 
 	"viz/internal/dto"
 	"viz/internal/entities"
-	libhttp "viz/internal/http"
 	"viz/internal/search"
 )
 
@@ -26,25 +25,8 @@ func SearchRouter(db *gorm.DB, logger *slog.Logger) chi.Router {
 		criteria := search.ParseQuery(queryParam)
 		engine := search.NewEngine()
 
-		// security filters (private = false OR (private = true AND owner_id = :user))
-		securityScope := func(db *gorm.DB) *gorm.DB {
-			userID := ""
-			if user, ok := libhttp.UserFromContext(req); ok && user != nil {
-				userID = user.Uid
-			} else if apiKey, ok := libhttp.APIKeyFromContext(req); ok && apiKey != nil && apiKey.User != nil {
-				userID = apiKey.User.Uid
-			}
-
-			if userID != "" {
-				// allow public items OR their own private items
-				return db.Where("private = ? OR (private = ? AND owner_id = ?)", false, true, userID)
-			}
-
-			// Fallback (should be covered by middleware, but safe default): only public
-			return db.Where("private = ?", false)
-		}
-
-		imagesQuery := engine.Apply(db, criteria).Scopes(securityScope)
+		// security filters: public items, the user's own and those shared with them
+		imagesQuery := engine.Apply(db, criteria).Scopes(visibleImages(req))
 
 		limit := 100
 		page := 0
@@ -69,7 +51,7 @@ func SearchRouter(db *gorm.DB, logger *slog.Logger) chi.Router {
 			return
 		}
 
-		collectionsQuery := engine.ApplyCollections(db, criteria).Scopes(securityScope)
+		collectionsQuery := engine.ApplyCollections(db, criteria).Scopes(visibleCollections(req))
 		collectionsQuery = collectionsQuery.Limit(limit).Offset((page - 1) * limit)
 
 		var collections []entities.Collection
@@ -4,16 +4,101 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 	"gorm.io/gorm"
 
+	"viz/internal/auth"
+	"viz/internal/config"
 	"viz/internal/dto"
 	"viz/internal/entities"
 	libhttp "viz/internal/http"
+	"viz/internal/uid"
+	"viz/internal/utils"
 )
 
+// createSession signs userUid in on this client and sets the session cookie.
+// A remembered session outlives the browser; any other gets a cookie that
+// goes when the browser closes, and a shorter lifetime. It returns the
+// token, which only the cookie holds.
+func createSession(db *gorm.DB, res http.ResponseWriter, req *http.Request, userUid string, remember bool) (string, error) {
+	cfg := config.AppConfig.Security.Session
+
+	lifetime := time.Duration(cfg.BrowserSessionHours) * time.Hour
+	if remember {
+		lifetime = time.Duration(cfg.RememberMeDays) * 24 * time.Hour
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(lifetime)
+	idleTimeout := int64(cfg.IdleTimeoutMinutes) * 60
+	clientIP := libhttp.ClientIP(req, false)
+	userAgent := req.UserAgent()
+	token := auth.GenerateAuthToken()
+
+	sess := entities.SessionWithToken{
+		Session: entities.Session{
+			Uid:        uid.MustGenerate(),
+			UserUid:    userUid,
+			ClientName: utils.StringPtr(libhttp.DeviceName(userAgent)),
+			ClientIp:   &clientIP,
+			LoginIp:    &clientIP,
+			LoginAt:    &now,
+			UserAgent:  &userAgent,
+			LastActive: &now,
+			ExpiresAt:  &expiresAt,
+			Timeout:    &idleTimeout,
+			RememberMe: &remember,
+		},
+		TokenHash: libhttp.HashSessionToken(token),
+	}
+
+	if err := db.Create(&sess).Error; err != nil {
+		return "", err
+	}
+
+	cookie := libhttp.CreateAuthTokenCookie(expiresAt, token)
+	if !remember {
+		cookie.Expires = time.Time{}
+	}
+
+	http.SetCookie(res, cookie)
+	return token, nil
+}
+
+// currentSessionUid is the UID of the session req was made with, or "".
+func currentSessionUid(db *gorm.DB, req *http.Request) string {
+	cookie, err := req.Cookie(libhttp.AuthTokenCookie)
+	if err != nil || cookie.Value == "" {
+		return ""
+	}
+
+	var sessionUid string
+	db.Model(&entities.SessionWithToken{}).Where("token_hash = ?", libhttp.HashSessionToken(cookie.Value)).Limit(1).Pluck("uid", &sessionUid)
+	return sessionUid
+}
+
+// deleteSessions deletes the sessions matching query and drops them from the
+// session cache.
+func deleteSessions(db *gorm.DB, query string, args ...any) error {
+	var hashes []string
+	if err := db.Model(&entities.SessionWithToken{}).Where(query, args...).Pluck("token_hash", &hashes).Error; err != nil {
+		return err
+	}
+
+	if err := db.Where(query, args...).Delete(&entities.Session{}).Error; err != nil {
+		return err
+	}
+
+	for _, hash := range hashes {
+		libhttp.ClearSessionCache(hash)
+	}
+
+	return nil
+}
+
 func SessionsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 	router := chi.NewRouter()
 	router.Use(libhttp.UserAuthMiddleware)
@@ -132,8 +217,8 @@ func SessionsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 	router.Delete("/", func(res http.ResponseWriter, req *http.Request) {
 		user, _ := libhttp.UserFromContext(req)
 
-		// Delete all sessions for this user from the DB
-		if err := db.Where("user_uid = ?", user.Uid).Delete(&entities.Session{}).Error; err != nil {
+		// Delete all sessions for this user from the DB, and from the cache
+		if err := deleteSessions(db, "user_uid = ?", user.Uid); err != nil {
 			libhttp.ServerError(res, req, err, logger, nil,
 				"failed to delete all sessions",
 				"Something went wrong, please try again later",
@@ -141,13 +226,8 @@ func SessionsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			return
 		}
 
-		// Clear cookies for the current session (if any) and clear its cache entry
-		cookie, err := req.Cookie(libhttp.AuthTokenCookie)
-		if err == nil {
-			libhttp.ClearCookie(libhttp.AuthTokenCookie, res)
-			libhttp.ClearSessionCache(cookie.Value)
-		}
-		// Clear other auth-related cookies
+		// Clear cookies for the current session and other auth-related cookies
+		libhttp.ClearCookie(libhttp.AuthTokenCookie, res)
 		libhttp.ClearCookie(libhttp.StateCookie, res)
 		libhttp.ClearCookie(libhttp.RedirectCookie, res)
 		libhttp.ClearCookie(libhttp.RefreshTokenCookie, res)
@@ -156,6 +236,29 @@ func SessionsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 		render.JSON(res, req, dto.MessageResponse{Message: "All sessions logged out"})
 	})
 
+	// DELETE /sessions/others - Delete every session but the current one
+	router.Delete("/others", func(res http.ResponseWriter, req *http.Request) {
+		user, _ := libhttp.UserFromContext(req)
+
+		current := currentSessionUid(db, req)
+		if current == "" {
+			render.Status(req, http.StatusUnauthorized)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Not signed in with a session"})
+			return
+		}
+
+		if err := deleteSessions(db, "user_uid = ? AND uid <> ?", user.Uid, current); err != nil {
+			libhttp.ServerError(res, req, err, logger, nil,
+				"failed to delete other sessions",
+				"Something went wrong, please try again later",
+			)
+			return
+		}
+
+		render.Status(req, http.StatusOK)
+		render.JSON(res, req, dto.MessageResponse{Message: "Other sessions logged out"})
+	})
+
 	// DELETE /sessions/{uid} - Delete a specific session
 	router.Delete("/{uid}", func(res http.ResponseWriter, req *http.Request) {
 		user, _ := libhttp.UserFromContext(req)
@@ -173,20 +276,15 @@ func SessionsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			return
 		}
 
-		// Delete the session
-		if err := db.Delete(&session).Error; err != nil {
-			libhttp.ServerError(res, req, err, logger, nil, "failed to delete session", "Internal server error")
-			return
-		}
-
 		// If the deleted session is the *current* one, clear cookies
-		cookie, err := req.Cookie(libhttp.AuthTokenCookie)
-		if err == nil && cookie.Value == session.Token {
+		if session.Uid == currentSessionUid(db, req) {
 			libhttp.ClearCookie(libhttp.AuthTokenCookie, res)
-			libhttp.ClearSessionCache(cookie.Value)
-		} else {
-			// If it wasn't current, just clear it from server cache to be safe
-			libhttp.ClearSessionCache(session.Token)
+		}
+
+		// Delete the session and drop it from the server cache
+		if err := deleteSessions(db, "uid = ?", session.Uid); err != nil {
+			libhttp.ServerError(res, req, err, logger, nil, "failed to delete session", "Internal server error")
+			return
 		}
 
 		render.Status(req, http.StatusOK)
@@ -3,14 +3,11 @@ package routes
 import (
 	"log/slog"
 	"net/http"
-	"time"
 
-	"github.com/dromara/carbon/v2"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 	"gorm.io/gorm"
 
-	"viz/internal/auth"
 	"viz/internal/config"
 	"viz/internal/crypto"
 	"viz/internal/dto"
@@ -147,25 +144,9 @@ func (h *setupHandlers) SetupSuperadmin(w http.ResponseWriter, req *http.Request
 		return
 	}
 
-	// Generate session token for the new superadmin
-	// Create auth token and persistent session
-	authToken := auth.GenerateAuthToken()
-	expiryTime := carbon.Now().AddYear().StdTime()
-	http.SetCookie(w, libhttp.CreateAuthTokenCookie(expiryTime, authToken))
-
-	// Persist session for server-side validation
-	lastActive := time.Now()
-	sess := entities.Session{
-		Token:      authToken,
-		Uid:        uid.MustGenerate(),
-		UserUid:    id,
-		ClientIp:   &req.RemoteAddr,
-		UserAgent:  utils.StringPtr(req.UserAgent()),
-		LastActive: &lastActive,
-		ExpiresAt:  &expiryTime,
-	}
-
-	if err := h.db.Create(&sess).Error; err != nil {
+	// Sign the new superadmin in on this device
+	authToken, err := createSession(h.db, w, req, id, true)
+	if err != nil {
 		libhttp.ServerError(w, req, err, h.logger, nil,
 			"failed to create session",
 			"Something went wrong while signing you in. Please try again.",
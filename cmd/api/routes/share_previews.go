@@ -0,0 +1,361 @@
+package routes
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+
+	"viz/internal/config"
+	"viz/internal/downloads"
+	"viz/internal/dto"
+	"viz/internal/entities"
+	libhttp "viz/internal/http"
+	"viz/internal/images"
+	"viz/internal/transform"
+)
+
+// SharePagePath is where the frontend shows share links: SharePagePath
+// followed by the token for the collection, and by {token}/images/{uid} for
+// one of its images.
+const SharePagePath = "/share/"
+
+const (
+	shareProviderName = "Viz"
+	// oEmbedCacheAge is how long consumers may keep an oEmbed response.
+	oEmbedCacheAge = 3600
+)
+
+var (
+	errSharePreviewNotFound = errors.New("share not found")
+	titleElement            = regexp.MustCompile(`<title>[^<]*</title>`)
+)
+
+// parseSharePagePath gets the token, and the image uid if the page is of
+// one, from the path of a share page.
+func parseSharePagePath(path string) (token, imageUid string, ok bool) {
+	rest, found := strings.CutPrefix(path, SharePagePath)
+	if !found {
+		return "", "", false
+	}
+
+	parts := strings.Split(strings.Trim(rest, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] != "":
+		return parts[0], "", true
+	case len(parts) == 3 && parts[0] != "" && parts[1] == "images" && parts[2] != "":
+		return parts[0], parts[2], true
+	}
+
+	return "", "", false
+}
+
+// publicBaseURL is baseUrl, the URL this server is reached at, for links
+// that leave it. Previews are cached by whoever fetches them, so they're
+// never built from the Host of a request; without baseUrl there are none.
+func publicBaseURL() (string, bool) {
+	base := strings.TrimRight(config.AppConfig.BaseURL, "/")
+	u, err := url.Parse(base)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", false
+	}
+
+	return base, true
+}
+
+// sharePreview is what a share page tells link previews about itself.
+type sharePreview struct {
+	Title       string
+	Description string
+	token       *entities.DownloadToken
+	// image is the image the preview shows, if there's one to show
+	image *entities.ImageAsset
+	// single is set when the page is of image alone, not the collection
+	single bool
+}
+
+// sharePreviewImage is a preview's image at one size.
+type sharePreviewImage struct {
+	URL    string
+	Width  int
+	Height int
+}
+
+// loadSharePreview loads what the page of share link token, or of its image
+// imageUid if that's set, shows of itself. Links that need a password, have
+// expired or aren't collection share links aren't found, so previews give
+// away nothing about them.
+func loadSharePreview(db *gorm.DB, token, imageUid string) (*sharePreview, error) {
+	uids, dt, ok := downloads.ValidateTokenWithPassword(db, token, "")
+	if !ok || dt.CollectionUid == nil {
+		return nil, errSharePreviewNotFound
+	}
+
+	var collection entities.Collection
+	if err := db.Preload("Thumbnail").First(&collection, "uid = ?", *dt.CollectionUid).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errSharePreviewNotFound
+		}
+		return nil, err
+	}
+
+	preview := &sharePreview{
+		Title:       collection.Name,
+		Description: lo.FromPtr(collection.Description),
+		token:       dt,
+	}
+
+	if imageUid != "" {
+		if !slices.Contains(uids, imageUid) {
+			return nil, errSharePreviewNotFound
+		}
+
+		var img entities.ImageAsset
+		if err := db.Where("uid = ? AND deleted_at IS NULL", imageUid).First(&img).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, errSharePreviewNotFound
+			}
+			return nil, err
+		}
+
+		preview.Title = img.Name
+		preview.Description = lo.FromPtr(img.Description)
+		preview.image = &img
+		preview.single = true
+		return preview, nil
+	}
+
+	// The cover, or the first image if the cover isn't shared
+	if thumb := collection.Thumbnail; thumb != nil && slices.Contains(uids, thumb.Uid) {
+		preview.image = thumb
+	} else if len(uids) > 0 {
+		var img entities.ImageAsset
+		if err := db.Where("uid = ? AND deleted_at IS NULL", uids[0]).First(&img).Error; err == nil {
+			preview.image = &img
+		}
+	}
+
+	return preview, nil
+}
+
+// fitWithin scales width x height down to fit in maxWidth x maxHeight,
+// keeping its aspect ratio. A limit of 0 or less doesn't limit.
+func fitWithin(width, height, maxWidth, maxHeight int) (int, int) {
+	scale := 1.0
+	if maxWidth > 0 && width > maxWidth {
+		scale = float64(maxWidth) / float64(width)
+	}
+	if maxHeight > 0 && height > maxHeight {
+		scale = min(scale, float64(maxHeight)/float64(height))
+	}
+
+	return max(int(float64(width)*scale), 1), max(int(float64(height)*scale), 1)
+}
+
+// imageAt is the preview's image at the largest of its preview and
+// thumbnail sizes that fits within maxWidth x maxHeight, or sized to fit if
+// neither does. Links that allow embedding get signed URLs other sites can
+// show and cache; the rest go through the share link. It returns nil if the
+// preview has no image.
+func (p *sharePreview) imageAt(baseURL string, maxWidth, maxHeight int) *sharePreviewImage {
+	if p.image == nil || p.image.Width <= 0 || p.image.Height <= 0 {
+		return nil
+	}
+
+	imgWidth, imgHeight := int(p.image.Width), int(p.image.Height)
+	fits := func(width, height int) bool {
+		return (maxWidth <= 0 || width <= maxWidth) && (maxHeight <= 0 || height <= maxHeight)
+	}
+
+	var params transform.TransformParams
+	var width, height int
+	found := false
+	for _, name := range []images.PermanentTransformName{images.TransformPreview, images.TransformThumbnail} {
+		params, _ = images.GetPermanentTransformParams(name)
+		width, height = fitWithin(imgWidth, imgHeight, int(params.Width), int(params.Height))
+		if fits(width, height) {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		width, height = fitWithin(imgWidth, imgHeight, maxWidth, maxHeight)
+		params = transform.TransformParams{Format: "webp", Width: int64(width), Height: int64(height), Quality: 85}
+	}
+
+	path := sharedImagePath(p.token.Uid, p.image.Uid) + "?" + params.ToQueryString()
+	if p.token.AllowEmbed {
+		path = shareEmbedURL(p.token, p.image.Uid, &params)
+	}
+
+	return &sharePreviewImage{URL: baseURL + "/api" + path, Width: width, Height: height}
+}
+
+// pageURL is the address of the share page the preview is of.
+func (p *sharePreview) pageURL(baseURL string) string {
+	page := baseURL + SharePagePath + url.PathEscape(p.token.Uid)
+	if p.single {
+		page += "/images/" + url.PathEscape(p.image.Uid)
+	}
+
+	return page
+}
+
+// metaTags renders the preview as OpenGraph and Twitter card tags, with a
+// link to its oEmbed data.
+func (p *sharePreview) metaTags(baseURL string) string {
+	var b strings.Builder
+	tag := func(attr, name, content string) {
+		fmt.Fprintf(&b, `<meta %s="%s" content="%s" />`, attr, name, html.EscapeString(content))
+	}
+
+	pageURL := p.pageURL(baseURL)
+	tag("property", "og:type", "website")
+	tag("property", "og:site_name", shareProviderName)
+	tag("property", "og:title", p.Title)
+	tag("property", "og:url", pageURL)
+	tag("name", "twitter:title", p.Title)
+
+	if p.Description != "" {
+		tag("property", "og:description", p.Description)
+		tag("name", "twitter:description", p.Description)
+	}
+
+	card := "summary"
+	if img := p.imageAt(baseURL, 0, 0); img != nil {
+		card = "summary_large_image"
+		tag("property", "og:image", img.URL)
+		tag("property", "og:image:width", strconv.Itoa(img.Width))
+		tag("property", "og:image:height", strconv.Itoa(img.Height))
+		tag("property", "og:image:alt", p.Title)
+		tag("name", "twitter:image", img.URL)
+	}
+	tag("name", "twitter:card", card)
+
+	oEmbedURL := baseURL + "/api/oembed?url=" + url.QueryEscape(pageURL)
+	fmt.Fprintf(&b, `<link rel="alternate" type="application/json+oembed" href="%s" title="%s" />`, html.EscapeString(oEmbedURL), html.EscapeString(p.Title))
+
+	return b.String()
+}
+
+// injectSharePreview adds the title and meta tags of the share page at
+// token, or of its image imageUid, to page. Pages of links that can't be
+// previewed are left as they are.
+func (h *FrontendHandler) injectSharePreview(page []byte, token, imageUid string) []byte {
+	baseURL, ok := publicBaseURL()
+	if !ok {
+		return page
+	}
+
+	preview, err := loadSharePreview(h.DB, token, imageUid)
+	if err != nil {
+		if !errors.Is(err, errSharePreviewNotFound) {
+			h.Logger.Warn("failed to load share preview", slog.Any("error", err))
+		}
+		return page
+	}
+
+	title := fmt.Sprintf("<title>%s</title>", html.EscapeString(preview.Title))
+	page = titleElement.ReplaceAllLiteral(page, []byte(title))
+	return bytes.Replace(page, []byte("</head>"), []byte(preview.metaTags(baseURL)+"</head>"), 1)
+}
+
+// OEmbedRouter answers oEmbed requests for share pages, so share links
+// pasted into chat apps and CMSes show a preview.
+func OEmbedRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
+	router := chi.NewRouter()
+
+	router.Get("/", func(res http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		if format := query.Get("format"); format != "" && format != "json" {
+			render.Status(req, http.StatusNotImplemented)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Only the json format is supported"})
+			return
+		}
+
+		pageURL, err := url.Parse(query.Get("url"))
+		if err != nil || query.Get("url") == "" {
+			render.Status(req, http.StatusBadRequest)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Missing or invalid url"})
+			return
+		}
+
+		baseURL, ok := publicBaseURL()
+		if !ok {
+			render.Status(req, http.StatusNotFound)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Link previews need baseUrl to be set"})
+			return
+		}
+
+		token, imageUid, ok := parseSharePagePath(pageURL.Path)
+		if base, err := url.Parse(baseURL); ok && err == nil && pageURL.Host != "" && !strings.EqualFold(pageURL.Host, base.Host) {
+			ok = false
+		}
+
+		if !ok {
+			render.Status(req, http.StatusNotFound)
+			render.JSON(res, req, dto.ErrorResponse{Error: "No share at this URL"})
+			return
+		}
+
+		preview, err := loadSharePreview(db, token, imageUid)
+		if err != nil {
+			if errors.Is(err, errSharePreviewNotFound) {
+				render.Status(req, http.StatusNotFound)
+				render.JSON(res, req, dto.ErrorResponse{Error: "No share at this URL"})
+				return
+			}
+
+			libhttp.ServerError(res, req, err, logger, nil,
+				"failed to load share preview",
+				"Something went wrong, please try again later",
+			)
+			return
+		}
+
+		maxWidth, _ := strconv.Atoi(query.Get("maxwidth"))
+		maxHeight, _ := strconv.Atoi(query.Get("maxheight"))
+
+		embed := dto.OEmbed{
+			Version:      dto.N10,
+			Type:         dto.Link,
+			Title:        &preview.Title,
+			ProviderName: lo.ToPtr(shareProviderName),
+			ProviderUrl:  &baseURL,
+			CacheAge:     lo.ToPtr(oEmbedCacheAge),
+		}
+
+		if img := preview.imageAt(baseURL, maxWidth, maxHeight); img != nil {
+			// Only images that may be embedded elsewhere are photos, which
+			// consumers show straight from the URL
+			if preview.single && preview.token.AllowEmbed {
+				embed.Type = dto.Photo
+				embed.Url = &img.URL
+				embed.Width = &img.Width
+				embed.Height = &img.Height
+			} else {
+				embed.ThumbnailUrl = &img.URL
+				embed.ThumbnailWidth = &img.Width
+				embed.ThumbnailHeight = &img.Height
+			}
+		}
+
+		res.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", oEmbedCacheAge))
+		render.JSON(res, req, embed)
+	})
+
+	return router
+}
@@ -0,0 +1,83 @@
+package routes_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"viz/api/routes"
+	"viz/internal/config"
+	"viz/internal/downloads"
+	"viz/internal/dto"
+	libhttp "viz/internal/http"
+)
+
+func TestOEmbed(t *testing.T) {
+	db := newTestDB(t)
+	libhttp.URLSigningKey = []byte("0123456789abcdef0123456789abcdef")
+
+	router := chi.NewRouter()
+	router.Mount("/api/oembed", routes.OEmbedRouter(db, newTestLogger()))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	defer func(base string) { config.AppConfig.BaseURL = base }(config.AppConfig.BaseURL)
+	const base = "https://photos.example.com"
+
+	collection := createSharedImage(t, db, "oembed_img")
+	link := createShareLink(t, db, collection, downloads.TokenOptions{AllowEmbed: true})
+	locked := createShareLink(t, db, collection, downloads.TokenOptions{Password: "secret"})
+	revoked := createShareLink(t, db, collection, downloads.TokenOptions{})
+	require.NoError(t, db.Delete(revoked).Error)
+
+	oEmbed := func(page string) (int, dto.OEmbed) {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/api/oembed?url="+url.QueryEscape(page), nil)
+		require.NoError(t, err)
+		req.Host = "attacker.example"
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var embed dto.OEmbed
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&embed))
+		}
+		return resp.StatusCode, embed
+	}
+
+	// Without baseUrl there's nothing to build links from but the Host the
+	// request claims
+	for _, unset := range []string{"", "localhost"} {
+		config.AppConfig.BaseURL = unset
+		status, _ := oEmbed("/share/" + link.Uid)
+		assert.Equal(t, http.StatusNotFound, status, "baseUrl %q", unset)
+	}
+
+	config.AppConfig.BaseURL = base + "/"
+	status, embed := oEmbed(base + "/share/" + link.Uid + "/images/oembed_img")
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, base, *embed.ProviderUrl)
+	assert.Equal(t, dto.Photo, embed.Type)
+	require.NotNil(t, embed.Url)
+	assert.True(t, strings.HasPrefix(*embed.Url, base+"/api/images/oembed_img/file?"), *embed.Url)
+
+	for name, page := range map[string]string{
+		"other host":       "https://attacker.example/share/" + link.Uid,
+		"password":         base + "/share/" + locked.Uid,
+		"revoked":          base + "/share/" + revoked.Uid,
+		"image not shared": base + "/share/" + link.Uid + "/images/other_img",
+		"not a share page": base + "/collections/" + collection.Uid,
+	} {
+		status, _ := oEmbed(page)
+		assert.Equal(t, http.StatusNotFound, status, name)
+	}
+}
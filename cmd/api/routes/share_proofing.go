@@ -0,0 +1,593 @@
+package routes
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+
+	"viz/internal/auth"
+	"viz/internal/downloads"
+	"viz/internal/dto"
+	"viz/internal/entities"
+	libhttp "viz/internal/http"
+	"viz/internal/policy"
+	"viz/internal/uid"
+)
+
+// guestTokenHeader carries the token a guest got when they joined a share.
+const guestTokenHeader = "X-Guest-Token"
+
+var (
+	errGuestSubmitted   = errors.New("guest selection already submitted")
+	errNothingSelected  = errors.New("nothing selected")
+	errProofingNotFound = errors.New("proofing share link not found")
+)
+
+// writeProofingError answers for the errors the proofing routes return.
+func writeProofingError(res http.ResponseWriter, req *http.Request, logger *slog.Logger, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		render.Status(req, http.StatusNotFound)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Not found"})
+	case errors.Is(err, errProofingNotFound):
+		render.Status(req, http.StatusNotFound)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Share link not found"})
+	case errors.Is(err, ErrCollectionUnauthorised):
+		render.Status(req, http.StatusForbidden)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Only the owner can see proofing"})
+	case errors.Is(err, errGuestSubmitted):
+		render.Status(req, http.StatusConflict)
+		render.JSON(res, req, dto.ErrorResponse{Error: "The selection has already been submitted"})
+	case errors.Is(err, errNothingSelected):
+		render.Status(req, http.StatusBadRequest)
+		render.JSON(res, req, dto.ErrorResponse{Error: "No images were selected"})
+	default:
+		libhttp.ServerError(res, req, err, logger, nil,
+			"failed to update proofing",
+			"Something went wrong, please try again later",
+		)
+	}
+}
+
+// loadProofingShare is loadPublicShare for share links that allow proofing.
+func loadProofingShare(res http.ResponseWriter, req *http.Request, db *gorm.DB, logger *slog.Logger, limiter *libhttp.Limiter) (*publicShare, bool) {
+	share, ok := loadPublicShare(res, req, db, logger, limiter)
+	if !ok {
+		return nil, false
+	}
+
+	if !lo.FromPtr(share.token.AllowProofing) {
+		render.Status(req, http.StatusForbidden)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Proofing is not allowed on this share link"})
+		return nil, false
+	}
+
+	return share, true
+}
+
+// loadShareGuest finds the guest whose token is in the X-Guest-Token header
+// on share. It writes the error response itself when it returns false.
+func loadShareGuest(res http.ResponseWriter, req *http.Request, db *gorm.DB, logger *slog.Logger, share *publicShare) (*entities.ShareGuestWithKey, bool) {
+	key := req.Header.Get(guestTokenHeader)
+	hash, _ := auth.HashSecret(key)
+
+	var guest entities.ShareGuestWithKey
+	err := db.Where("key_hash = ?", hash).First(&guest).Error
+	if err == nil && (key == "" || subtle.ConstantTimeCompare([]byte(guest.ShareUid), []byte(share.token.Uid)) != 1) {
+		err = gorm.ErrRecordNotFound
+	}
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			render.Status(req, http.StatusUnauthorized)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Invalid guest token"})
+			return nil, false
+		}
+
+		libhttp.ServerError(res, req, err, logger, nil,
+			"failed to get share guest",
+			"Something went wrong, please try again later",
+		)
+		return nil, false
+	}
+
+	return &guest, true
+}
+
+// proofingGuestRoutes serves /public/shares/{token}/proofing, where people
+// with a share link pick, heart and comment on images and then submit their
+// selection to the photographer.
+func proofingGuestRoutes(db *gorm.DB, logger *slog.Logger, limiter *libhttp.Limiter, broker *libhttp.WSBroker) func(r chi.Router) {
+	return func(r chi.Router) {
+		r.With(limiter.Throttle(rateLimitScopeDownload)).Post("/guests", func(res http.ResponseWriter, req *http.Request) {
+			share, ok := loadProofingShare(res, req, db, logger, limiter)
+			if !ok {
+				return
+			}
+
+			var body dto.ShareGuestCreate
+			if err := render.DecodeJSON(req.Body, &body); err != nil {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Invalid request body"})
+				return
+			}
+
+			trim := func(s *string, maxLen int) *string {
+				if s == nil || strings.TrimSpace(*s) == "" {
+					return nil
+				}
+				v := strings.TrimSpace(*s)
+				if len(v) > maxLen {
+					v = v[:maxLen]
+				}
+				return &v
+			}
+
+			key := auth.GenerateAuthToken()
+			guest := entities.ShareGuestWithKey{
+				ShareGuest: entities.ShareGuest{
+					Uid:           uid.MustGenerate(),
+					CollectionUid: share.collection.Uid,
+					Name:          trim(body.Name, 200),
+					Email:         trim(body.Email, 320),
+				},
+				ShareUid: share.token.Uid,
+			}
+			guest.KeyHash, _ = auth.HashSecret(key)
+
+			if err := db.Create(&guest).Error; err != nil {
+				writeProofingError(res, req, logger, err)
+				return
+			}
+
+			render.Status(req, http.StatusCreated)
+			render.JSON(res, req, dto.ShareGuestSession{Guest: guest.DTO(), GuestToken: key})
+		})
+
+		r.Get("/", func(res http.ResponseWriter, req *http.Request) {
+			share, ok := loadProofingShare(res, req, db, logger, limiter)
+			if !ok {
+				return
+			}
+
+			guest, ok := loadShareGuest(res, req, db, logger, share)
+			if !ok {
+				return
+			}
+
+			var marks []entities.ProofingMark
+			var comments []entities.ProofingComment
+			err := db.Where("guest_uid = ?", guest.Uid).Find(&marks).Error
+			if err == nil {
+				err = db.Where("guest_uid = ?", guest.Uid).Order("created_at").Find(&comments).Error
+			}
+			if err != nil {
+				writeProofingError(res, req, logger, err)
+				return
+			}
+
+			render.JSON(res, req, dto.GuestProofing{
+				Guest:    guest.DTO(),
+				Marks:    lo.Map(marks, func(m entities.ProofingMark, _ int) dto.ProofingMark { return m.DTO() }),
+				Comments: lo.Map(comments, func(c entities.ProofingComment, _ int) dto.ProofingComment { return c.DTO() }),
+			})
+		})
+
+		r.Put("/images/{uid}", func(res http.ResponseWriter, req *http.Request) {
+			share, ok := loadProofingShare(res, req, db, logger, limiter)
+			if !ok {
+				return
+			}
+
+			guest, ok := loadShareGuest(res, req, db, logger, share)
+			if !ok {
+				return
+			}
+
+			var body dto.ProofingMarkUpdate
+			if err := render.DecodeJSON(req.Body, &body); err != nil {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Invalid request body"})
+				return
+			}
+
+			imageUid := chi.URLParam(req, "uid")
+			if !slices.Contains(share.uids, imageUid) {
+				writeProofingError(res, req, logger, gorm.ErrRecordNotFound)
+				return
+			}
+
+			if guest.SubmittedAt != nil {
+				writeProofingError(res, req, logger, errGuestSubmitted)
+				return
+			}
+
+			var mark entities.ProofingMark
+			err := db.Transaction(func(tx *gorm.DB) error {
+				err := tx.Where("guest_uid = ? AND image_uid = ?", guest.Uid, imageUid).First(&mark).Error
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					mark = entities.ProofingMark{Uid: uid.MustGenerate(), GuestUid: guest.Uid, ImageUid: imageUid}
+				} else if err != nil {
+					return err
+				}
+
+				if body.Selected != nil {
+					mark.Selected = *body.Selected
+				}
+				if body.Favourited != nil {
+					mark.Favourited = *body.Favourited
+				}
+
+				return tx.Save(&mark).Error
+			})
+
+			if err != nil {
+				writeProofingError(res, req, logger, err)
+				return
+			}
+
+			render.JSON(res, req, mark.DTO())
+		})
+
+		r.Post("/images/{uid}/comments", func(res http.ResponseWriter, req *http.Request) {
+			share, ok := loadProofingShare(res, req, db, logger, limiter)
+			if !ok {
+				return
+			}
+
+			guest, ok := loadShareGuest(res, req, db, logger, share)
+			if !ok {
+				return
+			}
+
+			var body dto.ProofingCommentCreate
+			if err := render.DecodeJSON(req.Body, &body); err != nil || strings.TrimSpace(body.Body) == "" || len(body.Body) > 2000 {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "A comment of up to 2000 characters is required"})
+				return
+			}
+
+			imageUid := chi.URLParam(req, "uid")
+			if !slices.Contains(share.uids, imageUid) {
+				writeProofingError(res, req, logger, gorm.ErrRecordNotFound)
+				return
+			}
+
+			if guest.SubmittedAt != nil {
+				writeProofingError(res, req, logger, errGuestSubmitted)
+				return
+			}
+
+			comment := entities.ProofingComment{
+				Uid:      uid.MustGenerate(),
+				GuestUid: guest.Uid,
+				ImageUid: imageUid,
+				Body:     strings.TrimSpace(body.Body),
+			}
+
+			if err := db.Create(&comment).Error; err != nil {
+				writeProofingError(res, req, logger, err)
+				return
+			}
+
+			render.Status(req, http.StatusCreated)
+			render.JSON(res, req, comment.DTO())
+		})
+
+		r.Delete("/comments/{comment_uid}", func(res http.ResponseWriter, req *http.Request) {
+			share, ok := loadProofingShare(res, req, db, logger, limiter)
+			if !ok {
+				return
+			}
+
+			guest, ok := loadShareGuest(res, req, db, logger, share)
+			if !ok {
+				return
+			}
+
+			if guest.SubmittedAt != nil {
+				writeProofingError(res, req, logger, errGuestSubmitted)
+				return
+			}
+
+			deleted := db.Where("uid = ? AND guest_uid = ?", chi.URLParam(req, "comment_uid"), guest.Uid).Delete(&entities.ProofingComment{})
+			if deleted.Error == nil && deleted.RowsAffected == 0 {
+				deleted.Error = gorm.ErrRecordNotFound
+			}
+			if deleted.Error != nil {
+				writeProofingError(res, req, logger, deleted.Error)
+				return
+			}
+
+			res.WriteHeader(http.StatusNoContent)
+		})
+
+		r.Post("/submit", func(res http.ResponseWriter, req *http.Request) {
+			share, ok := loadProofingShare(res, req, db, logger, limiter)
+			if !ok {
+				return
+			}
+
+			guest, ok := loadShareGuest(res, req, db, logger, share)
+			if !ok {
+				return
+			}
+
+			now := time.Now().UTC()
+			submitted := db.Model(&guest.ShareGuest).Where("submitted_at IS NULL").Update("submitted_at", now)
+			if submitted.Error == nil && submitted.RowsAffected == 0 {
+				submitted.Error = errGuestSubmitted
+			}
+			if submitted.Error != nil {
+				writeProofingError(res, req, logger, submitted.Error)
+				return
+			}
+			guest.SubmittedAt = &now
+
+			var selected int64
+			if err := db.Model(&entities.ProofingMark{}).Where("guest_uid = ? AND selected = ?", guest.Uid, true).Count(&selected).Error; err != nil {
+				logger.Warn("failed to count proofing selection", slog.Any("error", err))
+			}
+
+			// Only the collection's owner is told, since the event names
+			// their client.
+			if broker != nil && share.collection.OwnerID != nil {
+				broker.SendToUser(*share.collection.OwnerID, "proofing-submitted", map[string]any{
+					"collection_uid": share.collection.Uid,
+					"guest_uid":      guest.Uid,
+					"guest_name":     guest.Name,
+					"selected_count": selected,
+				})
+			}
+
+			logger.Info("proofing selection submitted",
+				slog.String("collection_uid", share.collection.Uid),
+				slog.String("guest_uid", guest.Uid),
+			)
+			render.JSON(res, req, guest.DTO())
+		})
+	}
+}
+
+// findProofingToken gets the share link token of collection that allows
+// proofing.
+func findProofingToken(tx *gorm.DB, collection entities.Collection, token string) (entities.DownloadToken, error) {
+	var dt entities.DownloadToken
+	err := tx.Where("uid = ? AND collection_uid = ? AND allow_proofing = ?", token, collection.Uid, true).First(&dt).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return dt, errProofingNotFound
+	}
+	return dt, err
+}
+
+// collectionProofingRoutes serves /collections/{uid}/proofing, where a
+// collection's owner sees what guests picked through its share links.
+func collectionProofingRoutes(db *gorm.DB, logger *slog.Logger) func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Get("/", func(res http.ResponseWriter, req *http.Request) {
+			var items []dto.ProofingShare
+			err := db.Transaction(func(tx *gorm.DB) error {
+				collection, _, err := loadCollection(tx, req, chi.URLParam(req, "uid"), policy.Owner)
+				if err != nil {
+					return err
+				}
+
+				var tokens []entities.DownloadToken
+				if err := tx.Where("collection_uid = ? AND allow_proofing = ?", collection.Uid, true).Order("created_at").Find(&tokens).Error; err != nil {
+					return err
+				}
+
+				var guests []entities.ShareGuestWithKey
+				if err := tx.Where("collection_uid = ?", collection.Uid).Find(&guests).Error; err != nil {
+					return err
+				}
+
+				items = make([]dto.ProofingShare, len(tokens))
+				for i, dt := range tokens {
+					items[i] = dto.ProofingShare{Token: dt.Uid, Description: dt.Description, ExpiresAt: dt.ExpiresAt}
+					for _, guest := range guests {
+						if guest.ShareUid != dt.Uid {
+							continue
+						}
+						items[i].GuestCount++
+						if guest.SubmittedAt != nil {
+							items[i].SubmittedCount++
+						}
+					}
+				}
+
+				return nil
+			})
+
+			if err != nil {
+				writeProofingError(res, req, logger, err)
+				return
+			}
+
+			render.JSON(res, req, dto.ProofingShareList{Items: items})
+		})
+
+		r.Get("/{token}", func(res http.ResponseWriter, req *http.Request) {
+			var selection dto.ProofingSelection
+			err := db.Transaction(func(tx *gorm.DB) error {
+				collection, _, err := loadCollection(tx, req, chi.URLParam(req, "uid"), policy.Owner)
+				if err != nil {
+					return err
+				}
+
+				dt, err := findProofingToken(tx, collection, chi.URLParam(req, "token"))
+				if err != nil {
+					return err
+				}
+
+				var guests []entities.ShareGuestWithKey
+				if err := tx.Where("share_uid = ?", dt.Uid).Order("created_at").Find(&guests).Error; err != nil {
+					return err
+				}
+
+				guestUids := lo.Map(guests, func(g entities.ShareGuestWithKey, _ int) string { return g.Uid })
+
+				var marks []entities.ProofingMark
+				var comments []entities.ProofingComment
+				if len(guestUids) > 0 {
+					if err := tx.Where("guest_uid IN ?", guestUids).Find(&marks).Error; err != nil {
+						return err
+					}
+					if err := tx.Where("guest_uid IN ?", guestUids).Order("created_at").Find(&comments).Error; err != nil {
+						return err
+					}
+				}
+
+				uids, err := downloads.TokenImageUids(tx, &dt)
+				if err != nil {
+					return err
+				}
+
+				selection = dto.ProofingSelection{
+					Token:       dt.Uid,
+					Description: dt.Description,
+					Guests:      lo.Map(guests, func(g entities.ShareGuestWithKey, _ int) dto.ShareGuest { return g.DTO() }),
+					Images:      []dto.ProofingImage{},
+				}
+
+				// Images in collection order, leaving out ones nobody touched
+				for _, imageUid := range uids {
+					image := dto.ProofingImage{
+						ImageUid:     imageUid,
+						SelectedBy:   []string{},
+						FavouritedBy: []string{},
+						Comments:     []dto.ProofingComment{},
+					}
+
+					for _, mark := range marks {
+						if mark.ImageUid != imageUid {
+							continue
+						}
+						if mark.Selected {
+							image.SelectedBy = append(image.SelectedBy, mark.GuestUid)
+						}
+						if mark.Favourited {
+							image.FavouritedBy = append(image.FavouritedBy, mark.GuestUid)
+						}
+					}
+
+					for _, comment := range comments {
+						if comment.ImageUid == imageUid {
+							image.Comments = append(image.Comments, comment.DTO())
+						}
+					}
+
+					if len(image.SelectedBy) > 0 || len(image.FavouritedBy) > 0 || len(image.Comments) > 0 {
+						selection.Images = append(selection.Images, image)
+					}
+				}
+
+				return nil
+			})
+
+			if err != nil {
+				writeProofingError(res, req, logger, err)
+				return
+			}
+
+			render.JSON(res, req, selection)
+		})
+
+		r.Post("/{token}/collection", func(res http.ResponseWriter, req *http.Request) {
+			var body dto.ProofingCollectionCreate
+			if err := render.DecodeJSON(req.Body, &body); err != nil || strings.TrimSpace(body.Name) == "" {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Name is required"})
+				return
+			}
+
+			authUser := requestUser(req)
+
+			var created entities.Collection
+			err := db.Transaction(func(tx *gorm.DB) error {
+				collection, _, err := loadCollection(tx, req, chi.URLParam(req, "uid"), policy.Owner)
+				if err != nil {
+					return err
+				}
+
+				dt, err := findProofingToken(tx, collection, chi.URLParam(req, "token"))
+				if err != nil {
+					return err
+				}
+
+				// Only guests of this link count, and by default only the ones
+				// who made up their mind.
+				guests := tx.Model(&entities.ShareGuestWithKey{}).Select("uid").Where("share_uid = ?", dt.Uid)
+				if body.GuestUids != nil {
+					guests = guests.Where("uid IN ?", *body.GuestUids)
+				} else {
+					guests = guests.Where("submitted_at IS NOT NULL")
+				}
+
+				column := "selected"
+				if lo.FromPtr(body.Favourites) {
+					column = "favourited"
+				}
+
+				var picked []string
+				if err := tx.Model(&entities.ProofingMark{}).
+					Where("guest_uid IN (?) AND "+column+" = ?", guests, true).
+					Distinct().Pluck("image_uid", &picked).Error; err != nil {
+					return err
+				}
+
+				uids, err := downloads.TokenImageUids(tx, &dt)
+				if err != nil {
+					return err
+				}
+
+				// Keep the order of the collection they were picked from
+				addedBy := authUser.DTO()
+				var images []dto.CollectionImage
+				for _, imageUid := range uids {
+					if slices.Contains(picked, imageUid) {
+						images = append(images, dto.CollectionImage{Uid: imageUid, AddedAt: time.Now(), AddedBy: &addedBy})
+					}
+				}
+
+				if len(images) == 0 {
+					return errNothingSelected
+				}
+
+				private := true
+				created = entities.Collection{
+					Uid:         uid.MustGenerate(),
+					Name:        strings.TrimSpace(body.Name),
+					Private:     &private,
+					CreatedByID: &authUser.Uid,
+					OwnerID:     &authUser.Uid,
+					Images:      &images,
+					ImageCount:  len(images),
+				}
+
+				return tx.Create(&created).Error
+			})
+
+			if err != nil {
+				writeProofingError(res, req, logger, err)
+				return
+			}
+
+			logger.Info("collection created from proofing",
+				slog.String("collection_uid", created.Uid),
+				slog.Int("images", created.ImageCount),
+			)
+			render.Status(req, http.StatusCreated)
+			render.JSON(res, req, created.DTO())
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package routes_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/gorilla/websocket"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"viz/internal/downloads"
+	"viz/internal/dto"
+	"viz/internal/entities"
+	libhttp "viz/internal/http"
+)
+
+// connectEvents connects to broker's event stream as the user userUid.
+func connectEvents(t *testing.T, broker *libhttp.WSBroker, userUid string) *websocket.Conn {
+	t.Helper()
+
+	// Clients are told apart by request ID
+	server := httptest.NewServer(middleware.RequestID(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		broker.ServeWS(res, libhttp.WithUser(req, &entities.User{Uid: userUid}))
+	})))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	// Skip the connection confirmation
+	_, _, err = conn.ReadMessage()
+	require.NoError(t, err)
+	return conn
+}
+
+func TestProofingSubmitOnlyTellsOwner(t *testing.T) {
+	db := newTestDB(t)
+	broker := libhttp.NewWSBroker(newTestLogger())
+	server := newShareTestServer(t, db, broker)
+
+	collection := createSharedImage(t, db, "proofing_submit_img")
+	require.NoError(t, db.Model(&collection).Update("owner_id", "proofing_owner").Error)
+	token := createShareLink(t, db, collection, downloads.TokenOptions{AllowProofing: true})
+
+	owner := connectEvents(t, broker, "proofing_owner")
+	other := connectEvents(t, broker, "proofing_other")
+
+	proofing := server.URL + "/api/public/shares/" + token.Uid + "/proofing"
+	resp, err := http.Post(proofing+"/guests", "application/json", strings.NewReader(`{"name": "Jo Client"}`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var session dto.ShareGuestSession
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&session))
+
+	req, err := http.NewRequest(http.MethodPost, proofing+"/submit", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Guest-Token", session.GuestToken)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	owner.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, msg, err := owner.ReadMessage()
+	require.NoError(t, err)
+	assert.Contains(t, string(msg), `"proofing-submitted"`)
+	assert.Contains(t, string(msg), "Jo Client")
+
+	// Nobody else gets it, and it isn't in the history everyone can read
+	other.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	_, msg, err = other.ReadMessage()
+	assert.Error(t, err, "other user got %s", msg)
+
+	history := lo.Filter(broker.GetRecent(100), func(rec libhttp.WSRecord, _ int) bool {
+		return rec.Event == "proofing-submitted"
+	})
+	assert.Empty(t, history)
+
+	// A guest can only submit once
+	req, err = http.NewRequest(http.MethodPost, proofing+"/submit", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Guest-Token", session.GuestToken)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+}
@@ -5,7 +5,6 @@ import (
 	"log/slog"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
@@ -94,18 +93,15 @@ func GetSystemStatus(db *gorm.DB, logger *slog.Logger, req *http.Request) (*dto.
 	// Since this endpoint is public, we must manually check for a session
 	var user *entities.User
 	if cookie, err := req.Cookie(libhttp.AuthTokenCookie); err == nil && cookie.Value != "" {
-		if cachedUser, ok := libhttp.GetSessionCache(cookie.Value); ok {
+		tokenHash := libhttp.HashSessionToken(cookie.Value)
+		if cachedUser, ok := libhttp.GetSessionCache(tokenHash); ok {
 			user = cachedUser
-		} else {
-			var sess entities.Session
-			if err := db.Where("token = ?", cookie.Value).First(&sess).Error; err == nil {
-				if sess.ExpiresAt == nil || sess.ExpiresAt.IsZero() || time.Now().Before(*sess.ExpiresAt) {
-					var dbUser entities.User
-					if err := db.Where("uid = ?", sess.UserUid).First(&dbUser).Error; err == nil {
-						user = &dbUser
-						libhttp.SetSessionCache(cookie.Value, user, sess.ExpiresAt)
-					}
-				}
+		} else if sess, err := libhttp.FindSession(db, cookie.Value); err == nil {
+			var dbUser entities.User
+			if err := db.Where("uid = ?", sess.UserUid).First(&dbUser).Error; err == nil {
+				user = &dbUser
+				expiry := libhttp.SessionExpiry(&sess.Session)
+				libhttp.SetSessionCache(tokenHash, user, &expiry)
 			}
 		}
 	}
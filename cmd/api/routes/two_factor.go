@@ -0,0 +1,506 @@
+package routes
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"viz/internal/auth"
+	"viz/internal/config"
+	"viz/internal/crypto"
+	"viz/internal/dto"
+	"viz/internal/entities"
+	libhttp "viz/internal/http"
+)
+
+const (
+	totpIssuer = "Viz"
+
+	// A login challenge only has to survive the user opening their
+	// authenticator app, and it allows a handful of typos.
+	loginChallengeTTL         = 5 * time.Minute
+	loginChallengeMaxAttempts = 5
+)
+
+var errInvalidSecondFactor = errors.New("invalid two-factor code")
+
+// secondFactor is whichever second factor the client answered with.
+type secondFactor struct {
+	Code         string
+	RecoveryCode string
+	// CeremonyID and Credential answer with a passkey.
+	CeremonyID string
+	Credential map[string]any
+}
+
+// issueLoginChallenge stores a new login challenge for userUid and returns its
+// token, which is only ever held by the client. remember is the "remember
+// me" choice, for the session the challenge is exchanged for.
+func issueLoginChallenge(db *gorm.DB, userUid string, remember bool) (string, time.Time, error) {
+	now := time.Now().UTC()
+
+	// Nothing else cleans these up, so sweep expired ones as we go.
+	if err := db.Where("expires_at < ?", now).Delete(&entities.LoginChallenge{}).Error; err != nil {
+		return "", time.Time{}, err
+	}
+
+	token := auth.GenerateAuthToken()
+	tokenHash, _ := auth.HashSecret(token)
+
+	challenge := entities.LoginChallenge{
+		TokenHash:  tokenHash,
+		UserUid:    userUid,
+		ExpiresAt:  now.Add(loginChallengeTTL),
+		RememberMe: remember,
+	}
+
+	if err := db.Create(&challenge).Error; err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token, challenge.ExpiresAt, nil
+}
+
+// findLoginChallenge returns the unexpired login challenge for token.
+func findLoginChallenge(db *gorm.DB, token string) (*entities.LoginChallenge, error) {
+	tokenHash, _ := auth.HashSecret(token)
+
+	var challenge entities.LoginChallenge
+	if err := db.Where("token_hash = ? AND expires_at > ?", tokenHash, time.Now().UTC()).First(&challenge).Error; err != nil {
+		return nil, err
+	}
+
+	return &challenge, nil
+}
+
+// verifySecondFactor checks a TOTP code, a passkey assertion or a recovery
+// code for userUid, in that order. Whichever is accepted is used up: the TOTP
+// step can't be reused and the recovery code is marked used.
+func verifySecondFactor(db *gorm.DB, userUid string, factor secondFactor) error {
+	if code := factor.Code; code != "" {
+		var totp entities.UserTOTP
+		if err := db.Where("user_uid = ? AND enabled = ?", userUid, true).First(&totp).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errInvalidSecondFactor
+			}
+			return err
+		}
+
+		step, ok := auth.ValidateTOTP(totp.Secret, code, time.Now(), totp.LastUsedStep)
+		if !ok {
+			return errInvalidSecondFactor
+		}
+
+		// Conditional so two requests racing with the same code can't both win.
+		res := db.Model(&entities.UserTOTP{}).
+			Where("id = ? AND last_used_step < ?", totp.ID, step).
+			Update("last_used_step", step)
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if res.RowsAffected == 0 {
+			return errInvalidSecondFactor
+		}
+
+		return nil
+	}
+
+	if factor.CeremonyID != "" {
+		return verifyPasskeySecondFactor(db, userUid, factor.CeremonyID, factor.Credential)
+	}
+
+	if recoveryCode := factor.RecoveryCode; recoveryCode != "" {
+		codeHash, _ := auth.HashSecret(auth.NormalizeRecoveryCode(recoveryCode))
+		res := db.Model(&entities.RecoveryCode{}).
+			Where("user_uid = ? AND code_hash = ? AND used_at IS NULL", userUid, codeHash).
+			Update("used_at", time.Now().UTC())
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if res.RowsAffected == 0 {
+			return errInvalidSecondFactor
+		}
+
+		return nil
+	}
+
+	return errInvalidSecondFactor
+}
+
+// replaceRecoveryCodes invalidates userUid's recovery codes and returns a new
+// set. Only their hashes are stored.
+func replaceRecoveryCodes(tx *gorm.DB, userUid string) ([]string, error) {
+	if err := tx.Where("user_uid = ?", userUid).Delete(&entities.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := auth.GenerateRecoveryCodes(auth.RecoveryCodeCount)
+	rows := make([]entities.RecoveryCode, len(codes))
+	for i, code := range codes {
+		codeHash, _ := auth.HashSecret(auth.NormalizeRecoveryCode(code))
+		rows[i] = entities.RecoveryCode{UserUid: userUid, CodeHash: codeHash}
+	}
+
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// syncTwoFactorEnabled recomputes users.two_factor_enabled from the user's
+// enrolled TOTP and passkeys. When the last second factor goes, so do the
+// recovery codes and any pending login challenges.
+func syncTwoFactorEnabled(tx *gorm.DB, userUid string) (bool, error) {
+	var totpCount, passkeyCount int64
+	if err := tx.Model(&entities.UserTOTP{}).Where("user_uid = ? AND enabled = ?", userUid, true).Count(&totpCount).Error; err != nil {
+		return false, err
+	}
+
+	if err := tx.Model(&entities.PasskeyWithCredential{}).Where("user_uid = ?", userUid).Count(&passkeyCount).Error; err != nil {
+		return false, err
+	}
+
+	enabled := totpCount+passkeyCount > 0
+	if err := tx.Model(&entities.User{}).Where("uid = ?", userUid).Update("two_factor_enabled", enabled).Error; err != nil {
+		return false, err
+	}
+
+	if enabled {
+		return true, nil
+	}
+
+	if err := tx.Where("user_uid = ?", userUid).Delete(&entities.RecoveryCode{}).Error; err != nil {
+		return false, err
+	}
+
+	return false, tx.Where("user_uid = ?", userUid).Delete(&entities.LoginChallenge{}).Error
+}
+
+// secondFactorMethods lists what userUid can answer a login challenge with.
+func secondFactorMethods(db *gorm.DB, userUid string) ([]string, error) {
+	var totpCount, passkeyCount, recoveryCount int64
+	if err := db.Model(&entities.UserTOTP{}).Where("user_uid = ? AND enabled = ?", userUid, true).Count(&totpCount).Error; err != nil {
+		return nil, err
+	}
+
+	if err := db.Model(&entities.PasskeyWithCredential{}).Where("user_uid = ?", userUid).Count(&passkeyCount).Error; err != nil {
+		return nil, err
+	}
+
+	if err := db.Model(&entities.RecoveryCode{}).Where("user_uid = ? AND used_at IS NULL", userUid).Count(&recoveryCount).Error; err != nil {
+		return nil, err
+	}
+
+	methods := []string{}
+	if totpCount > 0 {
+		methods = append(methods, "totp")
+	}
+	if passkeyCount > 0 {
+		methods = append(methods, "passkey")
+	}
+	if recoveryCount > 0 {
+		methods = append(methods, "recovery_code")
+	}
+
+	return methods, nil
+}
+
+// clearCurrentSessionCache drops the cached user for the request's session so
+// the next request sees a changed two_factor_enabled straight away.
+func clearCurrentSessionCache(req *http.Request) {
+	if cookie, err := req.Cookie(libhttp.AuthTokenCookie); err == nil {
+		libhttp.ClearSessionCache(libhttp.HashSessionToken(cookie.Value))
+	}
+}
+
+// twoFactorRoutes serves TOTP enrollment under /accounts/me/2fa.
+func twoFactorRoutes(db *gorm.DB, logger *slog.Logger) func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Get("/", func(res http.ResponseWriter, req *http.Request) {
+			user, _ := libhttp.UserFromContext(req)
+
+			status := dto.TwoFactorStatus{
+				Enabled:  user.TwoFactorEnabled,
+				Required: libhttp.TwoFactorRequired(user),
+			}
+
+			if user.TwoFactorEnabled {
+				var totp entities.UserTOTP
+				if err := db.Where("user_uid = ? AND enabled = ?", user.Uid, true).First(&totp).Error; err == nil {
+					status.TotpEnabled = true
+					status.EnabledAt = totp.EnabledAt
+				}
+
+				var passkeys int64
+				if err := db.Model(&entities.PasskeyWithCredential{}).Where("user_uid = ?", user.Uid).Count(&passkeys).Error; err != nil {
+					libhttp.ServerError(res, req, err, logger, nil, "failed to count passkeys", "Something went wrong, please try again later")
+					return
+				}
+				status.PasskeyCount = int(passkeys)
+
+				var remaining int64
+				if err := db.Model(&entities.RecoveryCode{}).Where("user_uid = ? AND used_at IS NULL", user.Uid).Count(&remaining).Error; err != nil {
+					libhttp.ServerError(res, req, err, logger, nil, "failed to count recovery codes", "Something went wrong, please try again later")
+					return
+				}
+				status.RecoveryCodesRemaining = int(remaining)
+			}
+
+			render.JSON(res, req, status)
+		})
+
+		r.Post("/setup", func(res http.ResponseWriter, req *http.Request) {
+			user, _ := libhttp.UserFromContext(req)
+
+			var enabled int64
+			if err := db.Model(&entities.UserTOTP{}).Where("user_uid = ? AND enabled = ?", user.Uid, true).Count(&enabled).Error; err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to get totp status", "Something went wrong, please try again later")
+				return
+			}
+
+			if enabled > 0 {
+				render.Status(req, http.StatusConflict)
+				render.JSON(res, req, dto.ErrorResponse{Error: "An authenticator app is already enrolled"})
+				return
+			}
+
+			// Starting over replaces any unconfirmed secret.
+			totp := entities.UserTOTP{
+				UserUid: user.Uid,
+				Secret:  auth.GenerateTOTPSecret(),
+			}
+
+			err := db.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "user_uid"}},
+				DoUpdates: clause.AssignmentColumns([]string{"secret", "enabled", "enabled_at", "last_used_step", "updated_at"}),
+			}).Create(&totp).Error
+
+			if err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to save totp secret", "Something went wrong, please try again later")
+				return
+			}
+
+			render.JSON(res, req, dto.TwoFactorSetupResponse{
+				Secret:          totp.Secret,
+				ProvisioningUri: auth.TOTPProvisioningURI(totp.Secret, totpIssuer, user.Email),
+			})
+		})
+
+		r.Post("/verify", func(res http.ResponseWriter, req *http.Request) {
+			user, _ := libhttp.UserFromContext(req)
+
+			var body dto.TwoFactorCodeRequest
+			if err := render.DecodeJSON(req.Body, &body); err != nil || body.Code == "" {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "A code is required"})
+				return
+			}
+
+			var totp entities.UserTOTP
+			if err := db.Where("user_uid = ?", user.Uid).First(&totp).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					render.Status(req, http.StatusBadRequest)
+					render.JSON(res, req, dto.ErrorResponse{Error: "Two-factor setup has not been started"})
+					return
+				}
+
+				libhttp.ServerError(res, req, err, logger, nil, "failed to get totp secret", "Something went wrong, please try again later")
+				return
+			}
+
+			if totp.Enabled {
+				render.Status(req, http.StatusConflict)
+				render.JSON(res, req, dto.ErrorResponse{Error: "An authenticator app is already enrolled"})
+				return
+			}
+
+			step, ok := auth.ValidateTOTP(totp.Secret, body.Code, time.Now(), totp.LastUsedStep)
+			if !ok {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Invalid code"})
+				return
+			}
+
+			var codes []string
+			err := db.Transaction(func(tx *gorm.DB) error {
+				now := time.Now().UTC()
+				err := tx.Model(&entities.UserTOTP{}).Where("id = ?", totp.ID).Updates(map[string]any{
+					"enabled":        true,
+					"enabled_at":     now,
+					"last_used_step": step,
+				}).Error
+
+				if err != nil {
+					return err
+				}
+
+				if err := tx.Model(&entities.User{}).Where("uid = ?", user.Uid).Update("two_factor_enabled", true).Error; err != nil {
+					return err
+				}
+
+				codes, err = replaceRecoveryCodes(tx, user.Uid)
+				return err
+			})
+
+			if err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to enable two-factor authentication", "Something went wrong, please try again later")
+				return
+			}
+
+			clearCurrentSessionCache(req)
+			logger.Info("two-factor authentication enabled", slog.String("user_uid", user.Uid))
+
+			render.JSON(res, req, dto.RecoveryCodesResponse{RecoveryCodes: codes})
+		})
+
+		r.Post("/disable", func(res http.ResponseWriter, req *http.Request) {
+			user, _ := libhttp.UserFromContext(req)
+
+			var body dto.TwoFactorDisableRequest
+			if err := render.DecodeJSON(req.Body, &body); err != nil || body.Password == "" {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Your password is required"})
+				return
+			}
+
+			var totpCount, passkeyCount int64
+			if err := db.Model(&entities.UserTOTP{}).Where("user_uid = ? AND enabled = ?", user.Uid, true).Count(&totpCount).Error; err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to get totp status", "Something went wrong, please try again later")
+				return
+			}
+
+			if totpCount == 0 {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "No authenticator app is enrolled"})
+				return
+			}
+
+			if err := db.Model(&entities.PasskeyWithCredential{}).Where("user_uid = ?", user.Uid).Count(&passkeyCount).Error; err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to count passkeys", "Something went wrong, please try again later")
+				return
+			}
+
+			// Passkeys still count as a second factor, so the policy only
+			// gets in the way when TOTP is the last one.
+			if libhttp.TwoFactorRequired(user) && passkeyCount == 0 {
+				render.Status(req, http.StatusForbidden)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Two-factor authentication is required for admin accounts"})
+				return
+			}
+
+			var row struct {
+				Password string
+			}
+
+			if err := db.Model(&entities.User{}).Select("password").Where("uid = ?", user.Uid).Scan(&row).Error; err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to fetch user password", "Something went wrong, please try again later")
+				return
+			}
+
+			argonParams := &crypto.Argon2Params{
+				MemoryMB: config.AppConfig.Security.Argon2MemoryMB,
+				Time:     config.AppConfig.Security.Argon2Time,
+				Threads:  config.AppConfig.Security.Argon2Threads,
+			}
+
+			isValidPass, err := crypto.VerifyPassword(row.Password, body.Password, argonParams)
+			if err != nil || !isValidPass {
+				render.Status(req, http.StatusUnauthorized)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Invalid password"})
+				return
+			}
+
+			var factor secondFactor
+			if body.Code != nil {
+				factor.Code = *body.Code
+			}
+			if body.RecoveryCode != nil {
+				factor.RecoveryCode = *body.RecoveryCode
+			}
+
+			err = verifySecondFactor(db, user.Uid, factor)
+			if err != nil {
+				if errors.Is(err, errInvalidSecondFactor) {
+					render.Status(req, http.StatusUnauthorized)
+					render.JSON(res, req, dto.ErrorResponse{Error: "Invalid code"})
+					return
+				}
+
+				libhttp.ServerError(res, req, err, logger, nil, "failed to verify two-factor code", "Something went wrong, please try again later")
+				return
+			}
+
+			err = db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Where("user_uid = ?", user.Uid).Delete(&entities.UserTOTP{}).Error; err != nil {
+					return err
+				}
+
+				_, err := syncTwoFactorEnabled(tx, user.Uid)
+				return err
+			})
+
+			if err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to disable two-factor authentication", "Something went wrong, please try again later")
+				return
+			}
+
+			clearCurrentSessionCache(req)
+			logger.Info("two-factor authentication disabled", slog.String("user_uid", user.Uid))
+
+			render.JSON(res, req, dto.MessageResponse{Message: "Authenticator app removed"})
+		})
+
+		r.Post("/recovery-codes", func(res http.ResponseWriter, req *http.Request) {
+			user, _ := libhttp.UserFromContext(req)
+
+			var body dto.TwoFactorCodeRequest
+			if err := render.DecodeJSON(req.Body, &body); err != nil || body.Code == "" {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "A code is required"})
+				return
+			}
+
+			if !user.TwoFactorEnabled {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Two-factor authentication is not enabled"})
+				return
+			}
+
+			if err := verifySecondFactor(db, user.Uid, secondFactor{Code: body.Code}); err != nil {
+				if errors.Is(err, errInvalidSecondFactor) {
+					render.Status(req, http.StatusUnauthorized)
+					render.JSON(res, req, dto.ErrorResponse{Error: "Invalid code"})
+					return
+				}
+
+				libhttp.ServerError(res, req, err, logger, nil, "failed to verify two-factor code", "Something went wrong, please try again later")
+				return
+			}
+
+			var codes []string
+			err := db.Transaction(func(tx *gorm.DB) error {
+				var err error
+				codes, err = replaceRecoveryCodes(tx, user.Uid)
+				return err
+			})
+
+			if err != nil {
+				libhttp.ServerError(res, req, err, logger, nil, "failed to regenerate recovery codes", "Something went wrong, please try again later")
+				return
+			}
+
+			render.JSON(res, req, dto.RecoveryCodesResponse{RecoveryCodes: codes})
+		})
+	}
+}
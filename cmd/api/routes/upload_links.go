@@ -0,0 +1,640 @@
+package routes
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"viz/internal/auth"
+	"viz/internal/config"
+	"viz/internal/dto"
+	"viz/internal/entities"
+	libhttp "viz/internal/http"
+	"viz/internal/imageops"
+	libvips "viz/internal/imageops/vips"
+	"viz/internal/images"
+	"viz/internal/jobs"
+	"viz/internal/jobs/workers"
+	"viz/internal/policy"
+	"viz/internal/uid"
+)
+
+// uploadLinkTokenKind is what upload link tokens are signed as, so no other
+// signed token passes for one.
+const uploadLinkTokenKind = "upload_link"
+
+const (
+	uploadLinkDefaultLifetime = 7 * 24 * time.Hour
+	uploadLinkMaxLifetime     = 90 * 24 * time.Hour
+	uploaderNameMaxLength     = 100
+
+	// uploadMaxFileSizeDefault caps upload link files when the server
+	// config doesn't.
+	uploadMaxFileSizeDefault = 200 << 20
+)
+
+var (
+	errUploadLinkNotFound  = errors.New("upload link not found")
+	errUploadLinkUsedUp    = errors.New("upload link has no files left")
+	errUploadLinkNotRevoke = errors.New("only the link's creator or an editor can revoke it")
+)
+
+// writeUploadLinkError answers for the errors the upload link routes return.
+func writeUploadLinkError(res http.ResponseWriter, req *http.Request, logger *slog.Logger, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		render.Status(req, http.StatusNotFound)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Collection not found"})
+	case errors.Is(err, errUploadLinkNotFound):
+		render.Status(req, http.StatusNotFound)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Upload link not found"})
+	case errors.Is(err, ErrCollectionUnauthorised):
+		render.Status(req, http.StatusForbidden)
+		render.JSON(res, req, dto.ErrorResponse{Error: "You can't add images to this collection"})
+	case errors.Is(err, errCollectionMirrored):
+		render.Status(req, http.StatusForbidden)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Mirrored collections are read-only"})
+	case errors.Is(err, errUploadLinkNotRevoke):
+		render.Status(req, http.StatusForbidden)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Only the link's creator or an editor can revoke it"})
+	default:
+		libhttp.ServerError(res, req, err, logger, nil,
+			"failed to update upload links",
+			"Something went wrong, please try again later",
+		)
+	}
+}
+
+// normalizeUploadTypes turns the allowed types of an upload link into bare
+// lower case extensions, or false if one isn't an extension.
+func normalizeUploadTypes(types []string) ([]string, bool) {
+	normalized := make([]string, 0, len(types))
+	for _, t := range types {
+		t = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(t), "."))
+		if t == "" || len(t) > 16 || strings.ContainsAny(t, "./\\ ") {
+			return nil, false
+		}
+
+		if !slices.Contains(normalized, t) {
+			normalized = append(normalized, t)
+		}
+	}
+
+	return normalized, true
+}
+
+// uploadTypeAllowed reports whether link takes a file named fileName.
+func uploadTypeAllowed(link *entities.UploadLink, fileName string) bool {
+	if len(link.AllowedTypes) == 0 {
+		return true
+	}
+
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(fileName), "."))
+	return slices.Contains(link.AllowedTypes, ext)
+}
+
+// uploadLinkRoutes serves /collections/{uid}/upload-links. Anyone who can
+// add images to a collection can hand out links that let others do it too.
+func uploadLinkRoutes(db *gorm.DB, logger *slog.Logger) func(r chi.Router) {
+	return func(r chi.Router) {
+		manage := r.With(libhttp.ScopeMiddleware([]auth.Scope{auth.CollectionsShareScope}))
+
+		r.Get("/", func(res http.ResponseWriter, req *http.Request) {
+			var links []entities.UploadLink
+
+			err := db.Transaction(func(tx *gorm.DB) error {
+				collection, _, err := loadCollection(tx, req, chi.URLParam(req, "uid"), policy.Contributor)
+				if err != nil {
+					return err
+				}
+
+				return tx.Preload("CreatedBy").Where("collection_uid = ?", collection.Uid).Order("created_at DESC").Find(&links).Error
+			})
+
+			if err != nil {
+				writeUploadLinkError(res, req, logger, err)
+				return
+			}
+
+			items := make([]dto.UploadLink, len(links))
+			for i := range links {
+				items[i] = links[i].DTO()
+			}
+
+			render.JSON(res, req, dto.UploadLinkList{Items: items})
+		})
+
+		manage.Post("/", func(res http.ResponseWriter, req *http.Request) {
+			var body dto.UploadLinkCreate
+			if err := render.DecodeJSON(req.Body, &body); err != nil {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Invalid request body"})
+				return
+			}
+
+			lifetime := uploadLinkDefaultLifetime
+			if body.ExpiresIn != nil {
+				lifetime = time.Duration(*body.ExpiresIn) * time.Second
+			}
+
+			if lifetime <= 0 || lifetime > uploadLinkMaxLifetime {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Upload links must expire within 90 days"})
+				return
+			}
+
+			if (body.MaxFiles != nil && *body.MaxFiles < 1) || (body.MaxFileSize != nil && *body.MaxFileSize < 1) {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "File limits must be at least 1"})
+				return
+			}
+
+			allowedTypes, ok := normalizeUploadTypes(lo.FromPtr(body.AllowedTypes))
+			if !ok {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Allowed types must be file extensions, e.g. jpg"})
+				return
+			}
+
+			if body.Message != nil && utf8.RuneCountInString(*body.Message) > 1000 {
+				render.Status(req, http.StatusBadRequest)
+				render.JSON(res, req, dto.ErrorResponse{Error: "Message must be at most 1000 characters"})
+				return
+			}
+
+			authUser := requestUser(req)
+			linkUid := uid.MustGenerate()
+			link := entities.UploadLink{
+				Uid:          linkUid,
+				Token:        libhttp.SignToken(uploadLinkTokenKind, linkUid),
+				CreatedByID:  &authUser.Uid,
+				Message:      body.Message,
+				ExpiresAt:    time.Now().Add(lifetime),
+				MaxFiles:     body.MaxFiles,
+				MaxFileSize:  body.MaxFileSize,
+				AllowedTypes: allowedTypes,
+			}
+
+			err := db.Transaction(func(tx *gorm.DB) error {
+				collection, _, err := loadCollection(tx, req, chi.URLParam(req, "uid"), policy.Contributor)
+				if err != nil {
+					return err
+				}
+
+				if collection.MirrorUid != nil {
+					return errCollectionMirrored
+				}
+
+				link.CollectionUid = collection.Uid
+				return tx.Omit("CreatedBy").Create(&link).Error
+			})
+
+			if err != nil {
+				writeUploadLinkError(res, req, logger, err)
+				return
+			}
+
+			logger.Info("upload link created",
+				slog.String("collection_uid", link.CollectionUid),
+				slog.String("link_uid", link.Uid),
+				slog.String("user_uid", authUser.Uid),
+			)
+
+			link.CreatedBy = authUser
+			render.Status(req, http.StatusCreated)
+			render.JSON(res, req, link.DTO())
+		})
+
+		manage.Delete("/{link_uid}", func(res http.ResponseWriter, req *http.Request) {
+			authUser := requestUser(req)
+
+			err := db.Transaction(func(tx *gorm.DB) error {
+				collection, role, err := loadCollection(tx, req, chi.URLParam(req, "uid"), policy.Contributor)
+				if err != nil {
+					return err
+				}
+
+				var link entities.UploadLink
+				err = tx.Where("uid = ? AND collection_uid = ?", chi.URLParam(req, "link_uid"), collection.Uid).First(&link).Error
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return errUploadLinkNotFound
+				} else if err != nil {
+					return err
+				}
+
+				if role < policy.Editor && lo.FromPtr(link.CreatedByID) != authUser.Uid {
+					return errUploadLinkNotRevoke
+				}
+
+				return tx.Delete(&link).Error
+			})
+
+			if err != nil {
+				writeUploadLinkError(res, req, logger, err)
+				return
+			}
+
+			res.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// loadUploadLink checks the upload link token in the URL and gets the link
+// and its collection. Forged tokens are turned away by their signature and
+// count against the client's IP like wrong share link passwords. It writes
+// the error response itself when it returns false.
+func loadUploadLink(res http.ResponseWriter, req *http.Request, db *gorm.DB, logger *slog.Logger, limiter *libhttp.Limiter) (*entities.UploadLink, *entities.Collection, bool) {
+	ipKey := limiter.IPKey(req)
+	if wait := limiter.Check(req.Context(), rateLimitScopeUpload, ipKey); wait > 0 {
+		libhttp.TooManyRequests(res, req, wait)
+		return nil, nil, false
+	}
+
+	invalid := func() (*entities.UploadLink, *entities.Collection, bool) {
+		render.Status(req, http.StatusUnauthorized)
+		render.JSON(res, req, dto.ErrorResponse{Error: "Invalid or expired link"})
+		return nil, nil, false
+	}
+
+	token := chi.URLParam(req, "token")
+	linkUid, err := libhttp.VerifySignedToken(uploadLinkTokenKind, token)
+	if err != nil {
+		limiter.Failure(req, rateLimitScopeUpload, ipKey)
+		return invalid()
+	}
+
+	var link entities.UploadLink
+	err = db.Preload("CreatedBy").Where("uid = ? AND token = ?", linkUid, token).First(&link).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Revoked, or signed with a key since replaced
+		return invalid()
+	} else if err != nil {
+		libhttp.ServerError(res, req, err, logger, nil,
+			"failed to get upload link",
+			"Something went wrong, please try again later",
+		)
+		return nil, nil, false
+	}
+
+	if time.Now().After(link.ExpiresAt) || link.CreatedBy == nil {
+		return invalid()
+	}
+
+	var collection entities.Collection
+	if err := db.First(&collection, "uid = ?", link.CollectionUid).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			render.Status(req, http.StatusNotFound)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Collection not found"})
+			return nil, nil, false
+		}
+
+		libhttp.ServerError(res, req, err, logger, nil,
+			"failed to get upload link collection",
+			"Something went wrong, please try again later",
+		)
+		return nil, nil, false
+	}
+
+	// Uploads land as the creator's own, so the link stops working once they
+	// can't add to the collection themselves
+	role, err := policy.CollectionRole(db, &collection, link.CreatedBy)
+	if err != nil {
+		libhttp.ServerError(res, req, err, logger, nil,
+			"failed to check upload link creator's access",
+			"Something went wrong, please try again later",
+		)
+		return nil, nil, false
+	}
+
+	if role < policy.Contributor {
+		return invalid()
+	}
+
+	return &link, &collection, true
+}
+
+// uploadSizeLimit is the largest file link takes in bytes, never more than
+// the server takes through any link.
+func uploadSizeLimit(link *entities.UploadLink) int64 {
+	limit := config.AppConfig.Upload.MaxFileSizeMB << 20
+	if limit <= 0 {
+		limit = uploadMaxFileSizeDefault
+	}
+
+	if link.MaxFileSize != nil {
+		limit = min(limit, *link.MaxFileSize)
+	}
+
+	return limit
+}
+
+// filesRemaining is how many more files link takes, or nil for no limit.
+func filesRemaining(link *entities.UploadLink) *int {
+	if link.MaxFiles == nil {
+		return nil
+	}
+
+	return lo.ToPtr(max(*link.MaxFiles-link.FileCount, 0))
+}
+
+// addUploadedImage counts an upload against link and adds img to the link's
+// collection, creating img unless it is already in the library. It's all
+// undone if the link has run out of files meanwhile. The file is written last,
+// once nothing else in the transaction can fail.
+func addUploadedImage(tx *gorm.DB, link *entities.UploadLink, img *entities.ImageAsset, data []byte, duplicate bool) error {
+	now := time.Now()
+	counted := tx.Model(&entities.UploadLink{}).
+		Where("uid = ? AND expires_at > ? AND (max_files IS NULL OR file_count < max_files)", link.Uid, now).
+		UpdateColumns(map[string]any{
+			"file_count":   gorm.Expr("file_count + 1"),
+			"last_used_at": now,
+		})
+	if counted.Error != nil {
+		return counted.Error
+	}
+	if counted.RowsAffected == 0 {
+		return errUploadLinkUsedUp
+	}
+
+	// Uploads through a link tend to arrive many at once, so the collection
+	// is locked to keep them from overwriting each other's images.
+	var collection entities.Collection
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&collection, "uid = ?", link.CollectionUid).Error; err != nil {
+		return err
+	}
+
+	if collection.MirrorUid != nil {
+		return errCollectionMirrored
+	}
+
+	if duplicate {
+		return addToUploadCollection(tx, &collection, link, img.Uid, now)
+	}
+
+	if err := tx.Create(img).Error; err != nil {
+		return err
+	}
+
+	if err := addToUploadCollection(tx, &collection, link, img.Uid, now); err != nil {
+		return err
+	}
+
+	return images.SaveImage(data, img.Uid, img.ImageMetadata.FileName)
+}
+
+// addToUploadCollection adds imageUid to collection as added by link's
+// creator, unless it is already there.
+func addToUploadCollection(tx *gorm.DB, collection *entities.Collection, link *entities.UploadLink, imageUid string, now time.Time) error {
+	var collectionImages []dto.CollectionImage
+	if collection.Images != nil {
+		collectionImages = *collection.Images
+	}
+
+	if slices.ContainsFunc(collectionImages, func(ci dto.CollectionImage) bool { return ci.Uid == imageUid }) {
+		return nil
+	}
+
+	creator := link.CreatedBy.DTO()
+	collectionImages = append(collectionImages, dto.CollectionImage{
+		Uid:     imageUid,
+		AddedAt: now,
+		AddedBy: &creator,
+	})
+	collection.Images = &collectionImages
+	collection.ImageCount = len(collectionImages)
+
+	return tx.Save(collection).Error
+}
+
+// UploadLinksRouter lets people without an account upload images into a
+// collection through an upload link. What they send belongs to whoever
+// created the link, and is processed like any other upload.
+func UploadLinksRouter(db *gorm.DB, logger *slog.Logger, limiter *libhttp.Limiter) *chi.Mux {
+	router := chi.NewRouter()
+
+	// Uploads come many at a time, so only opening a link is throttled.
+	// Forged tokens lock out on every route.
+	router.With(limiter.Throttle(rateLimitScopeUpload)).Get("/{token}", func(res http.ResponseWriter, req *http.Request) {
+		link, collection, ok := loadUploadLink(res, req, db, logger, limiter)
+		if !ok {
+			return
+		}
+
+		ownerName := strings.TrimSpace(link.CreatedBy.FirstName + " " + link.CreatedBy.LastName)
+		if ownerName == "" {
+			ownerName = link.CreatedBy.Username
+		}
+
+		render.JSON(res, req, dto.PublicUploadLink{
+			CollectionName: collection.Name,
+			OwnerName:      ownerName,
+			Message:        link.Message,
+			ExpiresAt:      link.ExpiresAt,
+			MaxFiles:       link.MaxFiles,
+			FilesRemaining: filesRemaining(link),
+			MaxFileSize:    uploadSizeLimit(link),
+			AllowedTypes:   link.AllowedTypes,
+		})
+	})
+
+	router.Post("/{token}/files", func(res http.ResponseWriter, req *http.Request) {
+		link, collection, ok := loadUploadLink(res, req, db, logger, limiter)
+		if !ok {
+			return
+		}
+
+		if collection.MirrorUid != nil {
+			writeUploadLinkError(res, req, logger, errCollectionMirrored)
+			return
+		}
+
+		if remaining := filesRemaining(link); remaining != nil && *remaining == 0 {
+			render.Status(req, http.StatusForbidden)
+			render.JSON(res, req, dto.ErrorResponse{Error: "This link has reached its file limit"})
+			return
+		}
+
+		tooLarge := func() {
+			render.Status(req, http.StatusRequestEntityTooLarge)
+			render.JSON(res, req, dto.ErrorResponse{Error: "The file is larger than this link allows"})
+		}
+
+		// Room for the rest of the form besides the file
+		maxFileSize := uploadSizeLimit(link)
+		req.Body = http.MaxBytesReader(res, req.Body, maxFileSize+1<<20)
+
+		if err := req.ParseMultipartForm(10 << 20); err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				tooLarge()
+				return
+			}
+
+			render.Status(req, http.StatusBadRequest)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Invalid request body"})
+			return
+		}
+
+		uploaderName := strings.TrimSpace(req.FormValue("name"))
+		if uploaderName == "" || utf8.RuneCountInString(uploaderName) > uploaderNameMaxLength {
+			render.Status(req, http.StatusBadRequest)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Your name is required, at most 100 characters"})
+			return
+		}
+
+		file, header, err := req.FormFile("data")
+		if err != nil {
+			render.Status(req, http.StatusBadRequest)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Missing file data"})
+			return
+		}
+		defer file.Close()
+
+		fileName := strings.TrimSpace(req.FormValue("file_name"))
+		if fileName == "" {
+			fileName = header.Filename
+		}
+		fileName = filepath.Base(fileName)
+
+		if header.Size > maxFileSize {
+			tooLarge()
+			return
+		}
+
+		if !uploadTypeAllowed(link, fileName) {
+			render.Status(req, http.StatusUnsupportedMediaType)
+			render.JSON(res, req, dto.ErrorResponse{Error: "This link only takes " + strings.Join(link.AllowedTypes, ", ") + " files"})
+			return
+		}
+
+		data, err := io.ReadAll(file)
+		if err != nil {
+			render.Status(req, http.StatusInternalServerError)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Failed to read file data"})
+			return
+		}
+
+		if len(data) == 0 {
+			render.Status(req, http.StatusBadRequest)
+			render.JSON(res, req, dto.ErrorResponse{Error: "Empty file data"})
+			return
+		}
+
+		libvipsImg, err := libvips.NewImageFromBuffer(data, libvips.DefaultLoadOptions())
+		if err != nil {
+			render.Status(req, http.StatusBadRequest)
+			render.JSON(res, req, dto.ErrorResponse{Error: "The file isn't an image"})
+			return
+		}
+		defer libvipsImg.Close()
+
+		imageEntity, err := imageops.NewImageEntity(logger, fileName, libvipsImg)
+		if err != nil {
+			libhttp.ServerError(res, req, err, logger, nil,
+				"failed to process uploaded image",
+				"Failed to process image data",
+			)
+			return
+		}
+
+		checksum, err := images.CalculateImageChecksum(data)
+		if err != nil {
+			libhttp.ServerError(res, req, err, logger, nil,
+				"failed to calculate checksum",
+				"Something went wrong, please try again later",
+			)
+			return
+		}
+
+		fileSize := int64(len(data))
+		imageEntity.UploadedByID = link.CreatedByID
+		imageEntity.OwnerID = link.CreatedByID
+		imageEntity.UploaderName = &uploaderName
+		imageEntity.UploadLinkUid = &link.Uid
+		imageEntity.ImageMetadata.FileSize = &fileSize
+		imageEntity.ImageMetadata.Checksum = checksum
+
+		// Sending an image the link's creator already has only adds it to
+		// the collection
+		var existing entities.ImageAsset
+		err = db.Where("owner_id = ? AND image_metadata->>'checksum' = ?", *link.CreatedByID, checksum).First(&existing).Error
+		duplicate := err == nil
+		if duplicate {
+			imageEntity = &existing
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			libhttp.ServerError(res, req, err, logger, nil,
+				"failed to check for duplicates",
+				"Something went wrong, please try again later",
+			)
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			return addUploadedImage(tx, link, imageEntity, data, duplicate)
+		})
+
+		if err != nil {
+			// The file is written just before the commit, which can still fail
+			if !duplicate {
+				if rmErr := images.DeleteImageDir(imageEntity.Uid); rmErr != nil {
+					logger.Warn("failed to remove file of failed upload", slog.String("image_uid", imageEntity.Uid), slog.Any("error", rmErr))
+				}
+			}
+
+			switch {
+			case errors.Is(err, errUploadLinkUsedUp):
+				render.Status(req, http.StatusForbidden)
+				render.JSON(res, req, dto.ErrorResponse{Error: "This link has reached its file limit"})
+			case errors.Is(err, errCollectionMirrored), errors.Is(err, gorm.ErrRecordNotFound):
+				writeUploadLinkError(res, req, logger, err)
+			default:
+				libhttp.ServerError(res, req, err, logger, nil,
+					"failed to save upload through link",
+					"Something went wrong, please try again later",
+				)
+			}
+			return
+		}
+
+		logger.Info("image uploaded through link",
+			slog.String("link_uid", link.Uid),
+			slog.String("image_uid", imageEntity.Uid),
+			slog.String("uploader", uploaderName),
+			slog.Bool("duplicate", duplicate),
+		)
+
+		// Whoever sends the file can't tell whether the creator already had
+		// it, so the link can't be used to probe their library
+		metadata := map[string]any{
+			"file_name": fileName,
+		}
+		if remaining := filesRemaining(link); remaining != nil {
+			metadata["files_remaining"] = max(*remaining-1, 0)
+		}
+
+		if !duplicate {
+			// Only now the image is committed can the job find it
+			_, err = jobs.Enqueue(db, workers.TopicImageProcess, jobs.PriorityInteractive, &workers.ImageProcessJob{Image: *imageEntity}, nil, &imageEntity.Uid)
+			if err != nil {
+				logger.Error("failed to queue processing of uploaded image", slog.String("uid", imageEntity.Uid), slog.Any("error", err))
+			}
+		}
+
+		render.Status(req, http.StatusCreated)
+		render.JSON(res, req, dto.ImageUploadResponse{Uid: imageEntity.Uid, Metadata: &metadata})
+	})
+
+	return router
+}
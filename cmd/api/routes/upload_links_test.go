@@ -0,0 +1,216 @@
+package routes_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"viz/api/routes"
+	"viz/internal/config"
+	"viz/internal/dto"
+	"viz/internal/entities"
+	libhttp "viz/internal/http"
+	"viz/internal/images"
+)
+
+// createUploadLink creates a link uploading into a new collection owned by
+// someone else, which the link's creator can add to as a contributor.
+func createUploadLink(t *testing.T, db *gorm.DB, uid string, maxFiles *int) (*entities.UploadLink, *entities.CollectionShare) {
+	t.Helper()
+
+	creator := entities.User{Uid: uid + "_creator", Username: uid + "_creator", Email: uid + "@example.com"}
+	require.NoError(t, db.Create(&creator).Error)
+
+	collection := entities.Collection{
+		Uid:     uid + "_col",
+		Name:    "Uploads",
+		Private: lo.ToPtr(true),
+		OwnerID: lo.ToPtr(uid + "_owner"),
+	}
+	require.NoError(t, db.Create(&collection).Error)
+
+	share := entities.CollectionShare{
+		Uid:           uid + "_share",
+		CollectionUid: collection.Uid,
+		UserID:        &creator.Uid,
+		Role:          dto.CollectionShareRoleContributor,
+	}
+	require.NoError(t, db.Create(&share).Error)
+
+	link := entities.UploadLink{
+		Uid:           uid,
+		Token:         libhttp.SignToken("upload_link", uid),
+		CollectionUid: collection.Uid,
+		CreatedByID:   &creator.Uid,
+		CreatedBy:     &creator,
+		ExpiresAt:     time.Now().Add(time.Hour),
+		MaxFiles:      maxFiles,
+	}
+	require.NoError(t, db.Omit("CreatedBy").Create(&link).Error)
+	return &link, &share
+}
+
+func TestUploadLinkStopsWorking(t *testing.T) {
+	db := newTestDB(t)
+	libhttp.URLSigningKey = []byte("0123456789abcdef0123456789abcdef")
+
+	router := chi.NewRouter()
+	router.Mount("/api/public/uploads", routes.UploadLinksRouter(db, newTestLogger(), nil))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		revoke func(link *entities.UploadLink, share *entities.CollectionShare) error
+	}{
+		{"revoked", func(link *entities.UploadLink, _ *entities.CollectionShare) error {
+			return db.Delete(link).Error
+		}},
+		{"expired", func(link *entities.UploadLink, _ *entities.CollectionShare) error {
+			return db.Model(link).Update("expires_at", time.Now().Add(-time.Minute)).Error
+		}},
+		{"creator lost access", func(_ *entities.UploadLink, share *entities.CollectionShare) error {
+			return db.Delete(share).Error
+		}},
+		{"creator only a viewer", func(_ *entities.UploadLink, share *entities.CollectionShare) error {
+			return db.Model(share).Update("role", dto.CollectionShareRoleViewer).Error
+		}},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link, share := createUploadLink(t, db, fmt.Sprintf("upload_stop_%d", i), nil)
+			url := server.URL + "/api/public/uploads/" + link.Token
+
+			status, body := getBody(t, url)
+			require.Equal(t, http.StatusOK, status, string(body))
+
+			require.NoError(t, tt.revoke(link, share))
+			status, _ = getBody(t, url)
+			assert.Equal(t, http.StatusUnauthorized, status)
+
+			resp, err := http.Post(url+"/files", "multipart/form-data; boundary=x", nil)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		})
+	}
+}
+
+func TestUploadLinkServerSizeCap(t *testing.T) {
+	db := newTestDB(t)
+	libhttp.URLSigningKey = []byte("0123456789abcdef0123456789abcdef")
+	config.AppConfig.Upload.MaxFileSizeMB = 1
+	defer func() { config.AppConfig.Upload.MaxFileSizeMB = 0 }()
+
+	router := chi.NewRouter()
+	router.Mount("/api/public/uploads", routes.UploadLinksRouter(db, newTestLogger(), nil))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	// The link itself takes any size
+	link, _ := createUploadLink(t, db, "upload_cap", nil)
+	url := server.URL + "/api/public/uploads/" + link.Token
+
+	status, body := getBody(t, url)
+	require.Equal(t, http.StatusOK, status, string(body))
+	var public dto.PublicUploadLink
+	require.NoError(t, json.Unmarshal(body, &public))
+	assert.Equal(t, int64(1<<20), public.MaxFileSize)
+
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	require.NoError(t, writer.WriteField("name", "Jo Client"))
+	part, err := writer.CreateFormFile("data", "big.jpg")
+	require.NoError(t, err)
+	_, err = part.Write(bytes.Repeat([]byte{0xff}, 3<<20))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	resp, err := http.Post(url+"/files", writer.FormDataContentType(), &form)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+}
+
+func TestUploadLinkFileLimitRace(t *testing.T) {
+	db := newTestDB(t)
+
+	// Two uploads both saw the link's last file free when they started
+	link, _ := createUploadLink(t, db, "upload_race", lo.ToPtr(1))
+	first, second := *link, *link
+
+	upload := func(link *entities.UploadLink, uid string) error {
+		img := &entities.ImageAsset{
+			Uid:           uid,
+			Name:          uid,
+			OwnerID:       link.CreatedByID,
+			ImageMetadata: &dto.ImageMetadata{FileName: uid + ".jpg", FileType: "jpeg", Checksum: uid + "_checksum"},
+		}
+		return db.Transaction(func(tx *gorm.DB) error {
+			return routes.AddUploadedImage(tx, link, img, []byte(uid), false)
+		})
+	}
+
+	require.NoError(t, upload(&first, "upload_race_first"))
+	assert.Error(t, upload(&second, "upload_race_second"), "the link took more files than it allows")
+
+	var stored entities.UploadLink
+	require.NoError(t, db.First(&stored, "uid = ?", link.Uid).Error)
+	assert.Equal(t, 1, stored.FileCount)
+
+	// The loser leaves nothing behind
+	var images int64
+	require.NoError(t, db.Model(&entities.ImageAsset{}).Where("uid = ?", "upload_race_second").Count(&images).Error)
+	assert.Zero(t, images)
+
+	var collection entities.Collection
+	require.NoError(t, db.First(&collection, "uid = ?", link.CollectionUid).Error)
+	require.NotNil(t, collection.Images)
+	assert.Equal(t, []string{"upload_race_first"}, lo.Map(*collection.Images, func(ci dto.CollectionImage, _ int) string { return ci.Uid }))
+}
+
+func TestUploadLinkMirroredCollectionLeavesNoFile(t *testing.T) {
+	db := newTestDB(t)
+
+	defer func(dir string) { images.Directory = dir }(images.Directory)
+	images.Directory = t.TempDir()
+
+	link, _ := createUploadLink(t, db, "upload_mirrored", nil)
+
+	upload := func(uid string) error {
+		img := &entities.ImageAsset{
+			Uid:           uid,
+			Name:          uid,
+			OwnerID:       link.CreatedByID,
+			ImageMetadata: &dto.ImageMetadata{FileName: uid + ".jpg", FileType: "jpeg", Checksum: uid + "_checksum"},
+		}
+		return db.Transaction(func(tx *gorm.DB) error {
+			return routes.AddUploadedImage(tx, link, img, []byte(uid), false)
+		})
+	}
+
+	require.NoError(t, upload("upload_mirrored_before"))
+	assert.FileExists(t, images.GetImagePath("upload_mirrored_before", "upload_mirrored_before.jpg"))
+
+	// The collection became a mirror while the next upload was being read
+	require.NoError(t, db.Model(&entities.Collection{}).Where("uid = ?", link.CollectionUid).Update("mirror_uid", "upload_mirrored_mirror").Error)
+
+	assert.Error(t, upload("upload_mirrored_after"))
+	assert.NoDirExists(t, images.GetImageDir("upload_mirrored_after"), "the rolled back upload left its file behind")
+
+	var count int64
+	require.NoError(t, db.Model(&entities.ImageAsset{}).Where("uid = ?", "upload_mirrored_after").Count(&count).Error)
+	assert.Zero(t, count)
+}
@@ -23,12 +23,13 @@ import (
 	"viz/internal/dto"
 	"viz/internal/entities"
 	libhttp "viz/internal/http"
+	"viz/internal/mail"
 	"viz/internal/settings"
 	"viz/internal/uid"
 	"viz/internal/utils"
 )
 
-func AccountsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
+func AccountsRouter(db *gorm.DB, logger *slog.Logger, mailer mail.Mailer) *chi.Mux {
 	router := chi.NewRouter()
 
 	router.Post("/", func(res http.ResponseWriter, req *http.Request) {
@@ -138,6 +139,10 @@ func AccountsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 			return
 		}
 
+		if err := sendVerificationEmail(db, mailer, logger, uwp.User, uwp.User.Email); err != nil {
+			logger.Error("failed to send verification email", slog.String("user_uid", id), slog.Any("error", err))
+		}
+
 		render.Status(req, http.StatusCreated)
 		render.JSON(res, req, uwp.User.DTO())
 	})
@@ -306,14 +311,38 @@ func AccountsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 					updateFields["username"] = *updates.Username
 				}
 
+				// A new email only takes over once the link sent to it is
+				// followed; until then it waits in pending_email.
+				var newEmail string
 				if updates.Email != nil {
-					if utils.IsValidEmail(string(*updates.Email)) {
+					newEmail = strings.TrimSpace(string(*updates.Email))
+					if !utils.IsValidEmail(newEmail) {
 						render.Status(req, http.StatusBadRequest)
 						render.JSON(res, req, dto.ErrorResponse{Error: "Email is invalid"})
 						return
 					}
 
-					updateFields["email"] = *updates.Email
+					if newEmail == user.Email {
+						newEmail = ""
+						updateFields["pending_email"] = nil
+					} else {
+						var taken int64
+						if err := db.Model(&entities.User{}).Where("email = ?", newEmail).Count(&taken).Error; err != nil {
+							libhttp.ServerError(res, req, err, logger, nil,
+								"Failed to check existing user",
+								"Something went wrong, please try again later",
+							)
+							return
+						}
+
+						if taken > 0 {
+							render.Status(req, http.StatusConflict)
+							render.JSON(res, req, dto.ErrorResponse{Error: "Email is already in use"})
+							return
+						}
+
+						updateFields["pending_email"] = newEmail
+					}
 				}
 
 				if len(updateFields) == 0 {
@@ -339,9 +368,39 @@ func AccountsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 					return
 				}
 
+				if newEmail != "" {
+					if err := sendVerificationEmail(db, mailer, logger, *user, newEmail); err != nil {
+						logger.Error("failed to send verification email", slog.String("user_uid", user.Uid), slog.Any("error", err))
+					}
+				}
+
 				render.JSON(res, req, user.DTO())
 			})
 
+			r.Post("/email/verification", func(res http.ResponseWriter, req *http.Request) {
+				user, _ := libhttp.UserFromContext(req)
+
+				email := user.Email
+				if user.PendingEmail != nil {
+					email = *user.PendingEmail
+				} else if user.EmailVerified {
+					render.Status(req, http.StatusBadRequest)
+					render.JSON(res, req, dto.ErrorResponse{Error: "Email is already verified"})
+					return
+				}
+
+				if err := sendVerificationEmail(db, mailer, logger, *user, email); err != nil {
+					libhttp.ServerError(res, req, err, logger, nil,
+						"Failed to create verification token",
+						"Something went wrong, please try again later",
+					)
+					return
+				}
+
+				render.Status(req, http.StatusAccepted)
+				render.JSON(res, req, dto.MessageResponse{Message: "Verification email sent"})
+			})
+
 			r.Put("/password", func(res http.ResponseWriter, req *http.Request) {
 				user, _ := libhttp.UserFromContext(req)
 
@@ -402,6 +461,9 @@ func AccountsRouter(db *gorm.DB, logger *slog.Logger) *chi.Mux {
 				render.JSON(res, req, dto.MessageResponse{Message: "Password updated successfully"})
 			})
 
+			r.Route("/2fa", twoFactorRoutes(db, logger))
+			r.Route("/passkeys", passkeyRoutes(db, logger))
+
 			r.Route("/settings", func(r chi.Router) {
 				r.Use(libhttp.UserAuthMiddleware)
 				r.Group(func(r chi.Router) {
@@ -0,0 +1,178 @@
+// Command worker runs job workers without the API server, so heavy image
+// processing can be scaled out separately from request handling. Run the API
+// with QUEUE_MODE=api and a shared queue backend (redis or postgres); the
+// workers' WebSocket events are relayed back to it.
+//
+// Usage:
+//
+//	worker -topics image_process,exif_process -concurrency image_process=4
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"gorm.io/gorm"
+
+	"viz/internal/config"
+	libhttp "viz/internal/http"
+	"viz/internal/imageops"
+	"viz/internal/jobs"
+	"viz/internal/jobs/workers"
+	imalog "viz/internal/logger"
+)
+
+// workerFactories builds each worker by topic.
+var workerFactories = map[string]func(db *gorm.DB, broker *libhttp.WSBroker) *jobs.Worker{
+	workers.TopicImageProcess:   workers.NewImageWorker,
+	workers.TopicExifProcess:    workers.NewExifWorker,
+	workers.TopicXMPGeneration:  workers.NewXMPWorker,
+	workers.TopicExportArchive:  workers.NewExportWorker,
+	workers.TopicFederationSync: workers.NewFederationSyncWorker,
+}
+
+func main() {
+	topicsFlag := flag.String("topics", "", "comma-separated topics to consume (default: redis.worker_topics, or all)")
+	concurrencyFlag := flag.String("concurrency", "", "comma-separated topic=n concurrency overrides")
+	flag.Parse()
+
+	v, err := config.ReadConfig()
+	if err != nil {
+		panic(fmt.Sprintf("failed to read config file: %v", err))
+	}
+
+	if err := v.Unmarshal(&config.AppConfig); err != nil {
+		panic(fmt.Sprintf("failed to unmarshal config: %v", err))
+	}
+
+	logLevel := imalog.GetLevelFromString(config.AppConfig.Logging.Level)
+	logger := libhttp.SetupChiLogger("worker", logLevel)
+
+	if os.Getenv("DB_PASSWORD") != "" {
+		config.AppConfig.Database.Password = os.Getenv("DB_PASSWORD")
+	}
+
+	appConfig := config.AppConfig
+	queueConfig := appConfig.Queue
+
+	topics := queueConfig.WorkerTopics
+	if *topicsFlag != "" {
+		topics = strings.Split(*topicsFlag, ",")
+	}
+
+	topics, err = resolveTopics(topics)
+	if err != nil {
+		logger.Error("invalid worker topics", slog.Any("error", err))
+		os.Exit(2)
+	}
+
+	concurrency := queueConfig.WorkerConcurrency
+	if *concurrencyFlag != "" {
+		concurrency, err = parseConcurrency(*concurrencyFlag)
+		if err != nil {
+			logger.Error("invalid worker concurrency", slog.Any("error", err))
+			os.Exit(2)
+		}
+	}
+
+	// The API server owns migrations, so don't run any here.
+	server := config.VizServer{
+		ServerConfig: &config.ServerConfig{Key: "worker"},
+		Logger:       logger,
+		LogLevel:     logLevel,
+		Database:     config.NewDatabase(appConfig, logger, logLevel),
+	}
+	client := server.ConnectToDatabase()
+
+	relay, err := jobs.NewEventRelay(queueConfig, client)
+	if err != nil {
+		logger.Error("standalone workers need a shared queue backend", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	imageops.ConfigureLogging(appConfig.Libvips, logger, logLevel)
+	imageops.WarmupAllOps(appConfig.Libvips)
+
+	// Nobody connects to this broker; it only forwards events to the API.
+	broker := libhttp.NewWSBroker(logger)
+	jobs.ForwardEvents(broker, relay)
+	jobs.Broker = broker
+
+	selected := make([]*jobs.Worker, 0, len(topics))
+	for _, topic := range topics {
+		selected = append(selected, workerFactories[topic](client, broker))
+		if n, ok := concurrency[topic]; ok && n > 0 {
+			jobs.SetConcurrency(topic, n)
+		}
+
+		logger.Info("consuming topic", slog.String("topic", topic), slog.Int("concurrency", jobs.GetConcurrency(topic)))
+	}
+
+	go jobs.RunJobQueue(queueConfig, client, logger, selected...)
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	s := <-sigCh
+	logger.Info("shutting down", slog.String("signal", s.String()))
+
+	// Close waits for in-flight handlers to finish. Anything still unacked
+	// when it times out is redelivered by the broker.
+	if jobs.Router != nil {
+		_ = jobs.Router.Close()
+	}
+
+	logger.Info("shutdown complete")
+}
+
+// resolveTopics validates the requested topics, defaulting to all of them.
+func resolveTopics(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		all := make([]string, 0, len(workerFactories))
+		for topic := range workerFactories {
+			all = append(all, topic)
+		}
+		slices.Sort(all)
+		return all, nil
+	}
+
+	topics := make([]string, 0, len(requested))
+	for _, topic := range requested {
+		topic = strings.TrimSpace(topic)
+		if topic == "" || slices.Contains(topics, topic) {
+			continue
+		}
+
+		if _, ok := workerFactories[topic]; !ok {
+			return nil, fmt.Errorf("unknown topic: %s", topic)
+		}
+		topics = append(topics, topic)
+	}
+
+	return topics, nil
+}
+
+// parseConcurrency parses "topic=n,topic=n".
+func parseConcurrency(s string) (map[string]int, error) {
+	out := map[string]int{}
+	for _, pair := range strings.Split(s, ",") {
+		topic, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("expected topic=n, got %q", pair)
+		}
+
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid concurrency for %s: %q", topic, value)
+		}
+		out[topic] = n
+	}
+
+	return out, nil
+}
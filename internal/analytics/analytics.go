@@ -0,0 +1,85 @@
+// Package analytics counts views and downloads of images, collections and
+// share links. Events are written in batches in the background and added up
+// into daily counts, which is what owners are shown.
+package analytics
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"time"
+)
+
+type Kind string
+
+const (
+	KindView     Kind = "view"
+	KindDownload Kind = "download"
+)
+
+// DayFormat is how days are stored: UTC dates as YYYY-MM-DD, which sort and
+// group the same in every database.
+const DayFormat = time.DateOnly
+
+// Event is a view or download of an image, a collection or both, through a
+// share link or not. Unset UIDs are left empty.
+type Event struct {
+	Kind          Kind
+	ImageUid      string
+	CollectionUid string
+	ShareToken    string
+	// IP is where the request came from. It is hashed, or dropped, as soon
+	// as the event is recorded.
+	IP string
+	At time.Time
+}
+
+// IPHashing is how visitors' IP addresses are kept to count unique visitors.
+type IPHashing string
+
+const (
+	// IPHashingOff keeps nothing, so unique visitors aren't counted.
+	IPHashingOff IPHashing = "off"
+	// IPHashingDaily hashes addresses with a key that changes every day, so
+	// a visitor can't be followed from one day to the next.
+	IPHashingDaily IPHashing = "daily"
+	// IPHashingPersistent hashes addresses with the same key every day.
+	IPHashingPersistent IPHashing = "persistent"
+)
+
+// ParseIPHashing checks an IP hashing mode from the config.
+func ParseIPHashing(mode string) (IPHashing, error) {
+	switch IPHashing(mode) {
+	case IPHashingOff, IPHashingDaily, IPHashingPersistent:
+		return IPHashing(mode), nil
+	default:
+		return "", fmt.Errorf("unknown analytics ip hashing mode %q, want off, daily or persistent", mode)
+	}
+}
+
+// VisitorHash is what is kept of ip for an event at at, or "" if nothing
+// is. The hash is keyed, so addresses can't be recovered by hashing every
+// one there is without the key.
+func VisitorHash(mode IPHashing, key []byte, ip string, at time.Time) string {
+	if mode != IPHashingDaily && mode != IPHashingPersistent || ip == "" || len(key) == 0 {
+		return ""
+	}
+
+	if parsed := net.ParseIP(ip); parsed != nil {
+		ip = parsed.String()
+	}
+
+	salt := "analytics"
+	if mode == IPHashingDaily {
+		salt += ":" + at.UTC().Format(DayFormat)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(salt))
+	mac.Write([]byte{'\n'})
+	mac.Write([]byte(ip))
+
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
@@ -0,0 +1,137 @@
+package analytics
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+
+	"viz/internal/entities"
+)
+
+// Options sets up a Recorder.
+type Options struct {
+	IPHashing IPHashing
+	// Key is what visitors' IP addresses are hashed with.
+	Key           []byte
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+// Recorder writes events to the database in batches in the background, so
+// serving an image never waits on analytics. A nil Recorder records nothing.
+type Recorder struct {
+	db      *gorm.DB
+	logger  *slog.Logger
+	opts    Options
+	events  chan entities.AnalyticsEvent
+	dropped atomic.Int64
+}
+
+// NewRecorder returns a Recorder that writes to db once started.
+func NewRecorder(db *gorm.DB, logger *slog.Logger, opts Options) *Recorder {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 10 * time.Second
+	}
+
+	return &Recorder{
+		db:     db,
+		logger: logger,
+		opts:   opts,
+		events: make(chan entities.AnalyticsEvent, opts.BatchSize*4),
+	}
+}
+
+// Record queues ev to be written. It never blocks: if the database has
+// fallen so far behind that the queue is full, the event is dropped.
+func (r *Recorder) Record(ev Event) {
+	if r == nil {
+		return
+	}
+
+	if ev.At.IsZero() {
+		ev.At = time.Now()
+	}
+
+	event := entities.AnalyticsEvent{
+		CreatedAt: ev.At,
+		Day:       ev.At.UTC().Format(DayFormat),
+		Kind:      string(ev.Kind),
+	}
+	if ev.ImageUid != "" {
+		event.ImageUid = &ev.ImageUid
+	}
+	if ev.CollectionUid != "" {
+		event.CollectionUid = &ev.CollectionUid
+	}
+	if ev.ShareToken != "" {
+		event.ShareToken = &ev.ShareToken
+	}
+	if visitor := VisitorHash(r.opts.IPHashing, r.opts.Key, ev.IP, ev.At); visitor != "" {
+		event.Visitor = &visitor
+	}
+
+	select {
+	case r.events <- event:
+	default:
+		r.dropped.Add(1)
+	}
+}
+
+// Start writes queued events every FlushInterval, or as soon as a batch is
+// full, until ctx is canceled. What is queued then is written before it
+// returns.
+func (r *Recorder) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(r.opts.FlushInterval)
+		defer ticker.Stop()
+
+		batch := make([]entities.AnalyticsEvent, 0, r.opts.BatchSize)
+		flush := func() {
+			if len(batch) > 0 {
+				r.write(batch)
+				batch = batch[:0]
+			}
+
+			if dropped := r.dropped.Swap(0); dropped > 0 {
+				r.logger.Warn("analytics events dropped, the database is falling behind", slog.Int64("count", dropped))
+			}
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				for {
+					select {
+					case event := <-r.events:
+						batch = append(batch, event)
+						if len(batch) == r.opts.BatchSize {
+							flush()
+						}
+					default:
+						flush()
+						return
+					}
+				}
+			case event := <-r.events:
+				batch = append(batch, event)
+				if len(batch) == r.opts.BatchSize {
+					flush()
+				}
+			case <-ticker.C:
+				flush()
+			}
+		}
+	}()
+}
+
+func (r *Recorder) write(batch []entities.AnalyticsEvent) {
+	if err := r.db.CreateInBatches(batch, len(batch)).Error; err != nil {
+		r.logger.Error("failed to write analytics events", slog.Int("count", len(batch)), slog.Any("error", err))
+	}
+}
@@ -0,0 +1,107 @@
+package analytics
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+
+	"viz/internal/entities"
+)
+
+// rollupLockKey is the Postgres advisory lock rollups take, so that API
+// instances sharing a database take turns.
+const rollupLockKey int64 = 0x76697a01
+
+// Rollup adds up events into daily counts. Every day with events that
+// haven't been added up yet is counted again from all of its events, so
+// running it again, or alongside new events arriving, never counts an
+// event twice. Rollups on other instances wait for this one to finish.
+func Rollup(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Two rollups counting the same day at once would both replace its
+		// counts, leaving them twice over. SQLite only takes one writer.
+		if tx.Dialector.Name() == "postgres" {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", rollupLockKey).Error; err != nil {
+				return err
+			}
+		}
+
+		// Events written after this are left for the next rollup. Their days
+		// may be counted now, but they are counted again then.
+		var lastID uint
+		if err := tx.Model(&entities.AnalyticsEvent{}).Where("rolled_up = ?", false).
+			Select("COALESCE(MAX(id), 0)").Scan(&lastID).Error; err != nil {
+			return err
+		}
+		if lastID == 0 {
+			return nil
+		}
+
+		var days []string
+		if err := tx.Model(&entities.AnalyticsEvent{}).Where("rolled_up = ? AND id <= ?", false, lastID).
+			Distinct().Pluck("day", &days).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("day IN ?", days).Delete(&entities.AnalyticsDailyStat{}).Error; err != nil {
+			return err
+		}
+
+		var stats []entities.AnalyticsDailyStat
+		err := tx.Model(&entities.AnalyticsEvent{}).
+			Select("day, kind, image_uid, collection_uid, share_token, COUNT(*) AS count, COUNT(DISTINCT visitor) AS visitors").
+			Where("day IN ?", days).
+			Group("day, kind, image_uid, collection_uid, share_token").
+			Scan(&stats).Error
+		if err != nil {
+			return err
+		}
+
+		if len(stats) > 0 {
+			if err := tx.CreateInBatches(stats, 500).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&entities.AnalyticsEvent{}).Where("rolled_up = ? AND id <= ?", false, lastID).
+			UpdateColumn("rolled_up", true).Error
+	})
+}
+
+// DeleteOldEvents deletes events that have been added up and are older than
+// retention. Their daily counts are kept.
+func DeleteOldEvents(db *gorm.DB, retention time.Duration) (int64, error) {
+	before := time.Now().Add(-retention).UTC().Format(DayFormat)
+	result := db.Where("rolled_up = ? AND day < ?", true, before).Delete(&entities.AnalyticsEvent{})
+	return result.RowsAffected, result.Error
+}
+
+// StartRollups starts a background goroutine that adds up events into daily
+// counts every interval, and deletes the ones older than retention. The
+// goroutine will stop when ctx is canceled.
+func StartRollups(ctx context.Context, logger *slog.Logger, db *gorm.DB, interval, retention time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := Rollup(db.WithContext(ctx)); err != nil {
+				logger.Warn("analytics rollup failed", slog.Any("error", err))
+			}
+
+			if deleted, err := DeleteOldEvents(db.WithContext(ctx), retention); err != nil {
+				logger.Warn("analytics event cleanup failed", slog.Any("error", err))
+			} else if deleted > 0 {
+				logger.Debug("deleted old analytics events", slog.Int64("count", deleted))
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,149 @@
+package analytics
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"viz/internal/entities"
+)
+
+// Range is the days stats are read for, from and to included.
+type Range struct {
+	From time.Time
+	To   time.Time
+}
+
+// Days lists the days of r as stored.
+func (r Range) Days() []string {
+	var days []string
+	for day := r.From.UTC().Truncate(24 * time.Hour); !day.After(r.To); day = day.AddDate(0, 0, 1) {
+		days = append(days, day.Format(DayFormat))
+	}
+	return days
+}
+
+func (r Range) scope(db *gorm.DB) *gorm.DB {
+	return db.Where("day >= ? AND day <= ?", r.From.UTC().Format(DayFormat), r.To.UTC().Format(DayFormat))
+}
+
+// Totals are the views and downloads of something over a range of days.
+// Visitors adds up each day's unique visitors, so someone coming back on
+// another day is counted again.
+type Totals struct {
+	Views     int64
+	Downloads int64
+	Visitors  int64
+}
+
+// sumTotals is the select adding up stats into Totals. Visitors are only
+// counted for views; someone downloading has already viewed.
+const sumTotals = "COALESCE(SUM(CASE WHEN kind = 'view' THEN count ELSE 0 END), 0) AS views, " +
+	"COALESCE(SUM(CASE WHEN kind = 'download' THEN count ELSE 0 END), 0) AS downloads, " +
+	"COALESCE(SUM(CASE WHEN kind = 'view' THEN visitors ELSE 0 END), 0) AS visitors"
+
+// ImageTotals are the totals of one image.
+type ImageTotals struct {
+	ImageUid string
+	Totals
+}
+
+// TopImages lists the images owned by ownerUid with the most views, or
+// downloads if by is KindDownload, in r.
+func TopImages(db *gorm.DB, ownerUid string, r Range, by Kind, limit int) ([]ImageTotals, error) {
+	order := "views DESC"
+	if by == KindDownload {
+		order = "downloads DESC"
+	}
+
+	var totals []ImageTotals
+	err := db.Model(&entities.AnalyticsDailyStat{}).Scopes(r.scope).
+		Select("image_uid, "+sumTotals).
+		Where("image_uid IN (?)", ownedImages(db, ownerUid)).
+		Group("image_uid").
+		Order(order + ", image_uid").
+		Limit(limit).
+		Scan(&totals).Error
+
+	return totals, err
+}
+
+// ShareTotals are the totals of one share link or download token.
+type ShareTotals struct {
+	ShareToken string
+	Totals
+}
+
+// ShareStats lists the totals in r of every share link and download token
+// created by ownerUid that has been used, most downloaded first.
+func ShareStats(db *gorm.DB, ownerUid string, r Range) ([]ShareTotals, error) {
+	tokens := db.Model(&entities.DownloadToken{}).Select("uid").Where("created_by_id = ?", ownerUid)
+
+	var totals []ShareTotals
+	err := db.Model(&entities.AnalyticsDailyStat{}).Scopes(r.scope).
+		Select("share_token, "+sumTotals).
+		Where("share_token IN (?)", tokens).
+		Group("share_token").
+		Order("downloads DESC, views DESC, share_token").
+		Scan(&totals).Error
+
+	return totals, err
+}
+
+// Filter picks the stats a time series is made of. Only one of its fields
+// is used, in the order they're declared.
+type Filter struct {
+	ImageUid      string
+	CollectionUid string
+	ShareToken    string
+	// OwnerUid picks the images owned by the user and the collections they
+	// own being opened.
+	OwnerUid string
+}
+
+// DayTotals are the totals of one day.
+type DayTotals struct {
+	Day string
+	Totals
+}
+
+// TimeSeries returns the totals of every day in r for what f picks,
+// including the days with none.
+func TimeSeries(db *gorm.DB, f Filter, r Range) ([]DayTotals, error) {
+	query := db.Model(&entities.AnalyticsDailyStat{}).Scopes(r.scope)
+	switch {
+	case f.ImageUid != "":
+		query = query.Where("image_uid = ?", f.ImageUid)
+	case f.CollectionUid != "":
+		query = query.Where("collection_uid = ?", f.CollectionUid)
+	case f.ShareToken != "":
+		query = query.Where("share_token = ?", f.ShareToken)
+	default:
+		collections := db.Model(&entities.Collection{}).Select("uid").Where("owner_id = ?", f.OwnerUid)
+		query = query.Where(db.Where("image_uid IN (?)", ownedImages(db, f.OwnerUid)).
+			Or("image_uid IS NULL AND collection_uid IN (?)", collections))
+	}
+
+	var totals []DayTotals
+	if err := query.Select("day, " + sumTotals).Group("day").Scan(&totals).Error; err != nil {
+		return nil, err
+	}
+
+	byDay := make(map[string]Totals, len(totals))
+	for _, t := range totals {
+		byDay[t.Day] = t.Totals
+	}
+
+	days := r.Days()
+	series := make([]DayTotals, len(days))
+	for i, day := range days {
+		series[i] = DayTotals{Day: day, Totals: byDay[day]}
+	}
+
+	return series, nil
+}
+
+// ownedImages is a subquery of the UIDs of the images ownerUid owns.
+func ownedImages(db *gorm.DB, ownerUid string) *gorm.DB {
+	return db.Model(&entities.ImageAsset{}).Select("uid").Where("owner_id = ?", ownerUid)
+}
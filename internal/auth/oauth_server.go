@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// Prefixes of the tokens Viz issues as an OAuth2 authorization server. They
+// tell them apart from API keys and from each other.
+const (
+	OAuthAccessTokenPrefix  = "vizat_"
+	OAuthRefreshTokenPrefix = "vizrt_"
+	OAuthClientSecretPrefix = "vizcs_"
+)
+
+// ErrUnknownScope is returned for a requested scope that doesn't exist.
+var ErrUnknownScope = errors.New("unknown scope")
+
+// GenerateOAuthToken makes a new token with prefix, e.g. OAuthAccessTokenPrefix.
+func GenerateOAuthToken(prefix string) string {
+	return prefix + GenerateAuthToken()
+}
+
+// A PKCE code verifier is 43 to 128 unreserved characters (RFC 7636 4.1),
+// and an S256 challenge is always 43 characters of base64url.
+var (
+	codeVerifierPattern  = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+	codeChallengePattern = regexp.MustCompile(`^[A-Za-z0-9\-_]{43}$`)
+)
+
+// ValidCodeChallenge reports whether challenge could be an S256 PKCE code
+// challenge.
+func ValidCodeChallenge(challenge string) bool {
+	return codeChallengePattern.MatchString(challenge)
+}
+
+// VerifyPKCE reports whether verifier is the S256 PKCE code verifier behind
+// challenge.
+func VerifyPKCE(verifier, challenge string) bool {
+	if !codeVerifierPattern.MatchString(verifier) {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// ScopeLabel is the label of scope shown to users, or the scope itself if
+// it has none.
+func ScopeLabel(scope Scope) string {
+	for _, item := range AllScopes {
+		if item.Value == scope {
+			return item.Label
+		}
+	}
+	return string(scope)
+}
+
+// ParseScopes reads an OAuth2 scope parameter: scopes separated by spaces.
+// Repeated scopes are dropped.
+func ParseScopes(raw string) ([]string, error) {
+	scopes := lo.Uniq(strings.Fields(raw))
+	for _, scope := range scopes {
+		if !lo.ContainsBy(AllScopes, func(item ScopeItem) bool { return string(item.Value) == scope }) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownScope, scope)
+		}
+	}
+	return scopes, nil
+}
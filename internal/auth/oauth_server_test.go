@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// RFC 7636 appendix B.
+const (
+	pkceVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	pkceChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	if !ValidCodeChallenge(pkceChallenge) {
+		t.Fatal("RFC 7636 challenge not accepted as a challenge")
+	}
+
+	if !VerifyPKCE(pkceVerifier, pkceChallenge) {
+		t.Error("RFC 7636 verifier rejected")
+	}
+
+	tests := []struct {
+		name     string
+		verifier string
+	}{
+		{"wrong verifier", strings.Replace(pkceVerifier, "d", "e", 1)},
+		{"too short", pkceVerifier[:42]},
+		{"bad characters", pkceVerifier[:42] + "+"},
+		// A plain challenge must not pass as its own verifier
+		{"challenge as verifier", pkceChallenge},
+	}
+
+	for _, tt := range tests {
+		if VerifyPKCE(tt.verifier, pkceChallenge) {
+			t.Errorf("%s: verifier accepted", tt.name)
+		}
+	}
+
+	if ValidCodeChallenge("plain-challenge") {
+		t.Error("short challenge accepted")
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes(" images:read  collections:read images:read ")
+	if err != nil {
+		t.Fatalf("ParseScopes: %v", err)
+	}
+	if want := []string{"images:read", "collections:read"}; !slices.Equal(scopes, want) {
+		t.Errorf("scopes = %v, want %v", scopes, want)
+	}
+
+	if _, err := ParseScopes("images:read images:everything"); !errors.Is(err, ErrUnknownScope) {
+		t.Errorf("unknown scope error = %v, want ErrUnknownScope", err)
+	}
+
+	if scopes, err := ParseScopes(""); err != nil || len(scopes) != 0 {
+		t.Errorf("empty scope = %v, %v", scopes, err)
+	}
+}
+
+func TestOAuthTokenPrefixes(t *testing.T) {
+	access := GenerateOAuthToken(OAuthAccessTokenPrefix)
+	if !strings.HasPrefix(access, OAuthAccessTokenPrefix) {
+		t.Errorf("access token %q missing prefix", access)
+	}
+
+	// API keys are looked up separately, so their prefix must not overlap
+	if strings.HasPrefix(access, APIKeyPrefix+"_") {
+		t.Errorf("access token %q looks like an API key", access)
+	}
+}
@@ -0,0 +1,315 @@
+// Package oidc signs users in with generic OpenID Connect identity providers
+// using the authorization code flow with PKCE, and maps the groups they
+// belong to at the provider onto Viz roles.
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+
+	"viz/internal/config"
+	"viz/internal/dto"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown oidc provider")
+	// ErrNotAuthorized means the provider vouched for the user, but the
+	// provider's configuration doesn't let them in.
+	ErrNotAuthorized = errors.New("user is not authorized by this provider's role mappings")
+)
+
+var providerIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// roleRank orders roles so the most privileged mapped group wins.
+var roleRank = map[dto.UserRole]int{
+	dto.UserRoleGuest: 1,
+	dto.UserRoleUser:  2,
+	dto.UserRoleAdmin: 3,
+}
+
+// Identity is what the provider told us about the user in their ID token.
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Username      string
+	Groups        []string
+}
+
+// Provider is a discovered OpenID Connect provider.
+type Provider struct {
+	config   config.OIDCProviderConfig
+	oauth    *oauth2.Config
+	verifier *gooidc.IDTokenVerifier
+}
+
+// Validate checks a provider's configuration without contacting it.
+func Validate(cfg config.OIDCProviderConfig) error {
+	if !providerIDPattern.MatchString(cfg.ID) {
+		return fmt.Errorf("oidc provider id %q must be lowercase letters, digits, - or _", cfg.ID)
+	}
+
+	if cfg.Issuer == "" || cfg.ClientID == "" {
+		return fmt.Errorf("oidc provider %q needs an issuer and client_id", cfg.ID)
+	}
+
+	for _, mapping := range cfg.RoleMappings {
+		if _, ok := roleRank[dto.UserRole(mapping.Role)]; !ok {
+			return fmt.Errorf("oidc provider %q maps group %q to unsupported role %q", cfg.ID, mapping.Group, mapping.Role)
+		}
+	}
+
+	if cfg.DefaultRole != "" {
+		if _, ok := roleRank[dto.UserRole(cfg.DefaultRole)]; !ok {
+			return fmt.Errorf("oidc provider %q has unsupported default_role %q", cfg.ID, cfg.DefaultRole)
+		}
+	}
+
+	return nil
+}
+
+// NewProvider runs discovery against cfg.Issuer. callbackURL is used when
+// cfg.RedirectURL is empty.
+func NewProvider(ctx context.Context, cfg config.OIDCProviderConfig, callbackURL string) (*Provider, error) {
+	if err := Validate(cfg); err != nil {
+		return nil, err
+	}
+
+	discovered, err := gooidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery for %q: %w", cfg.ID, err)
+	}
+
+	redirectURL := cfg.RedirectURL
+	if redirectURL == "" {
+		redirectURL = callbackURL
+	}
+
+	scopes := []string{gooidc.ScopeOpenID, "profile", "email"}
+	for _, scope := range cfg.Scopes {
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return &Provider{
+		config: cfg,
+		oauth: &oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  redirectURL,
+			Endpoint:     discovered.Endpoint(),
+			Scopes:       scopes,
+		},
+		verifier: discovered.Verifier(&gooidc.Config{ClientID: cfg.ClientID}),
+	}, nil
+}
+
+func (p *Provider) ID() string   { return p.config.ID }
+func (p *Provider) Name() string { return displayName(p.config) }
+
+// AuthCodeURL returns where to send the browser to sign in. The PKCE
+// verifier and nonce must be kept server side for Exchange.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	return p.oauth.AuthCodeURL(state, gooidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+}
+
+// Exchange redeems an authorization code and verifies the ID token that
+// comes back: signature, issuer, audience, expiry and nonce.
+func (p *Provider) Exchange(ctx context.Context, code, nonce, verifier string) (*Identity, error) {
+	token, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("oidc code exchange: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New("oidc token response has no id_token")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("oidc id token: %w", err)
+	}
+
+	if idToken.Nonce != nonce {
+		return nil, errors.New("oidc id token nonce does not match")
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("oidc id token claims: %w", err)
+	}
+
+	identity := &Identity{
+		Subject:  idToken.Subject,
+		Email:    stringClaim(claims, "email"),
+		Name:     stringClaim(claims, "name"),
+		Username: stringClaim(claims, "preferred_username"),
+		Groups:   groupsClaim(claims, p.groupsClaim()),
+	}
+	identity.EmailVerified, _ = claims["email_verified"].(bool)
+
+	return identity, nil
+}
+
+// Role maps the user's groups to a role, taking the most privileged match.
+// Users whose groups match nothing get the default role, or ErrNotAuthorized
+// if the provider requires a mapped group.
+func (p *Provider) Role(groups []string) (dto.UserRole, error) {
+	var role dto.UserRole
+	for _, mapping := range p.config.RoleMappings {
+		if slices.Contains(groups, mapping.Group) && roleRank[dto.UserRole(mapping.Role)] > roleRank[role] {
+			role = dto.UserRole(mapping.Role)
+		}
+	}
+
+	if role != "" {
+		return role, nil
+	}
+
+	if p.config.RequireMappedGroup {
+		return "", ErrNotAuthorized
+	}
+
+	if p.config.DefaultRole != "" {
+		return dto.UserRole(p.config.DefaultRole), nil
+	}
+
+	return dto.UserRoleUser, nil
+}
+
+// ManagesRoles reports whether the provider is the source of truth for its
+// users' roles, which it is once any role mappings are configured.
+func (p *Provider) ManagesRoles() bool {
+	return len(p.config.RoleMappings) > 0
+}
+
+// AllowSignup reports whether unknown users get an account on first login.
+func (p *Provider) AllowSignup() bool {
+	return p.config.AllowSignup
+}
+
+func (p *Provider) groupsClaim() string {
+	if p.config.GroupsClaim != "" {
+		return p.config.GroupsClaim
+	}
+	return "groups"
+}
+
+// Registry holds the configured providers. Discovery happens on first use
+// and is retried until it succeeds, so an identity provider that is down at
+// startup doesn't take the API with it.
+type Registry struct {
+	mu          sync.Mutex
+	configs     []config.OIDCProviderConfig
+	providers   map[string]*Provider
+	callbackURL func(id string) string
+}
+
+// NewRegistry validates configs. callbackURL builds the default redirect URL
+// for a provider ID.
+func NewRegistry(configs []config.OIDCProviderConfig, callbackURL func(id string) string) (*Registry, error) {
+	seen := map[string]bool{}
+	for _, cfg := range configs {
+		if err := Validate(cfg); err != nil {
+			return nil, err
+		}
+
+		if seen[cfg.ID] {
+			return nil, fmt.Errorf("oidc provider id %q is configured twice", cfg.ID)
+		}
+		seen[cfg.ID] = true
+	}
+
+	return &Registry{
+		configs:     configs,
+		providers:   map[string]*Provider{},
+		callbackURL: callbackURL,
+	}, nil
+}
+
+// Providers lists the configured providers as (id, name) pairs, in
+// configuration order.
+func (r *Registry) Providers() []dto.OIDCProvider {
+	out := make([]dto.OIDCProvider, len(r.configs))
+	for i, cfg := range r.configs {
+		out[i] = dto.OIDCProvider{Id: cfg.ID, Name: displayName(cfg)}
+	}
+	return out
+}
+
+// Get returns the provider with id, discovering it if needed.
+func (r *Registry) Get(ctx context.Context, id string) (*Provider, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if provider, ok := r.providers[id]; ok {
+		return provider, nil
+	}
+
+	for _, cfg := range r.configs {
+		if cfg.ID != id {
+			continue
+		}
+
+		provider, err := NewProvider(ctx, cfg, r.callbackURL(id))
+		if err != nil {
+			return nil, err
+		}
+
+		r.providers[id] = provider
+		return provider, nil
+	}
+
+	return nil, ErrUnknownProvider
+}
+
+func displayName(cfg config.OIDCProviderConfig) string {
+	if cfg.Name != "" {
+		return cfg.Name
+	}
+	return cfg.ID
+}
+
+func stringClaim(claims map[string]any, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+// groupsClaim reads a list of strings at a dotted path. A single string is
+// treated as a one-item list.
+func groupsClaim(claims map[string]any, path string) []string {
+	var value any = claims
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		groups := make([]string, 0, len(v))
+		for _, item := range v {
+			if group, ok := item.(string); ok {
+				groups = append(groups, group)
+			}
+		}
+		return groups
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,183 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+
+	"golang.org/x/oauth2"
+
+	"viz/internal/auth/oidc/oidctest"
+	"viz/internal/config"
+	"viz/internal/dto"
+)
+
+const callbackURL = "https://photos.example.com/api/auth/oidc/keycloak/callback"
+
+func newTestProvider(t *testing.T, issuer *oidctest.Issuer, cfg config.OIDCProviderConfig) *Provider {
+	t.Helper()
+
+	cfg.ID = "keycloak"
+	cfg.Issuer = issuer.URL
+	cfg.ClientID = issuer.ClientID
+	cfg.ClientSecret = issuer.ClientSecret
+
+	registry, err := NewRegistry([]config.OIDCProviderConfig{cfg}, func(string) string { return callbackURL })
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+
+	provider, err := registry.Get(context.Background(), "keycloak")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	return provider
+}
+
+// login runs the authorization code flow and returns the callback query.
+func login(t *testing.T, issuer *oidctest.Issuer, provider *Provider, nonce, verifier string) url.Values {
+	t.Helper()
+
+	callback, err := issuer.Authorize(provider.AuthCodeURL("state123", nonce, verifier))
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+
+	if got := callback.Scheme + "://" + callback.Host + callback.Path; got != callbackURL {
+		t.Fatalf("redirected to %s, want %s", got, callbackURL)
+	}
+
+	return callback.Query()
+}
+
+func TestLogin(t *testing.T) {
+	issuer := oidctest.New("viz", "secret")
+	defer issuer.Close()
+
+	provider := newTestProvider(t, issuer, config.OIDCProviderConfig{GroupsClaim: "realm_access.roles"})
+
+	issuer.SetUser(map[string]any{
+		"sub":                "user-1",
+		"email":              "ada@example.com",
+		"email_verified":     true,
+		"preferred_username": "ada",
+		"realm_access":       map[string]any{"roles": []string{"photographers", "offline_access"}},
+	})
+
+	verifier := oauth2.GenerateVerifier()
+	query := login(t, issuer, provider, "nonce123", verifier)
+
+	if query.Get("state") != "state123" {
+		t.Errorf("state = %q", query.Get("state"))
+	}
+
+	identity, err := provider.Exchange(context.Background(), query.Get("code"), "nonce123", verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	if identity.Subject != "user-1" || identity.Email != "ada@example.com" || !identity.EmailVerified || identity.Username != "ada" {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+
+	if len(identity.Groups) != 2 || identity.Groups[0] != "photographers" {
+		t.Errorf("groups = %v", identity.Groups)
+	}
+
+	t.Run("code is single use", func(t *testing.T) {
+		if _, err := provider.Exchange(context.Background(), query.Get("code"), "nonce123", verifier); err == nil {
+			t.Error("code was redeemed twice")
+		}
+	})
+
+	t.Run("wrong nonce", func(t *testing.T) {
+		query := login(t, issuer, provider, "nonce123", verifier)
+		if _, err := provider.Exchange(context.Background(), query.Get("code"), "other", verifier); err == nil {
+			t.Error("id token with another nonce was accepted")
+		}
+	})
+
+	t.Run("wrong pkce verifier", func(t *testing.T) {
+		query := login(t, issuer, provider, "nonce123", verifier)
+		if _, err := provider.Exchange(context.Background(), query.Get("code"), "nonce123", oauth2.GenerateVerifier()); err == nil {
+			t.Error("code was redeemed without the right verifier")
+		}
+	})
+}
+
+func TestRole(t *testing.T) {
+	mappings := []config.OIDCRoleMapping{
+		{Group: "viewers", Role: "guest"},
+		{Group: "photographers", Role: "user"},
+		{Group: "viz-admins", Role: "admin"},
+	}
+
+	tests := []struct {
+		name   string
+		cfg    config.OIDCProviderConfig
+		groups []string
+		want   dto.UserRole
+		err    error
+	}{
+		{"no mappings", config.OIDCProviderConfig{}, []string{"anything"}, dto.UserRoleUser, nil},
+		{"default role", config.OIDCProviderConfig{DefaultRole: "guest"}, nil, dto.UserRoleGuest, nil},
+		{"single match", config.OIDCProviderConfig{RoleMappings: mappings}, []string{"viewers"}, dto.UserRoleGuest, nil},
+		{"most privileged wins", config.OIDCProviderConfig{RoleMappings: mappings}, []string{"viewers", "viz-admins", "photographers"}, dto.UserRoleAdmin, nil},
+		{"group names are case sensitive", config.OIDCProviderConfig{RoleMappings: mappings}, []string{"VIZ-ADMINS"}, dto.UserRoleUser, nil},
+		{"unmapped is refused", config.OIDCProviderConfig{RoleMappings: mappings, RequireMappedGroup: true}, []string{"staff"}, "", ErrNotAuthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &Provider{config: tt.cfg}
+			got, err := provider.Role(tt.groups)
+
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+
+			if got != tt.want {
+				t.Errorf("role = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRegistryValidates(t *testing.T) {
+	valid := config.OIDCProviderConfig{ID: "authentik", Issuer: "https://sso.example.com", ClientID: "viz"}
+
+	tests := []struct {
+		name    string
+		configs []config.OIDCProviderConfig
+	}{
+		{"bad id", []config.OIDCProviderConfig{{ID: "Auth Entik", Issuer: "https://sso.example.com", ClientID: "viz"}}},
+		{"missing issuer", []config.OIDCProviderConfig{{ID: "authentik", ClientID: "viz"}}},
+		{"duplicate id", []config.OIDCProviderConfig{valid, valid}},
+		{"superadmin mapping", []config.OIDCProviderConfig{{ID: "authentik", Issuer: "https://sso.example.com", ClientID: "viz",
+			RoleMappings: []config.OIDCRoleMapping{{Group: "root", Role: "superadmin"}}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRegistry(tt.configs, func(string) string { return "" }); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+
+	registry, err := NewRegistry([]config.OIDCProviderConfig{valid}, func(string) string { return "" })
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+
+	if _, err := registry.Get(context.Background(), "google"); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("Get(unknown) = %v, want ErrUnknownProvider", err)
+	}
+
+	providers := registry.Providers()
+	if len(providers) != 1 || providers[0].Name != "authentik" {
+		t.Errorf("providers = %+v", providers)
+	}
+}
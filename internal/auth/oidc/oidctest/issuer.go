@@ -0,0 +1,239 @@
+// Package oidctest runs a minimal OpenID Connect issuer in-process so login
+// flows can be tested without a real identity provider.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	jose "github.com/go-jose/go-jose/v4"
+)
+
+const keyID = "oidctest"
+
+type grant struct {
+	clientID      string
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+	claims        map[string]any
+}
+
+// Issuer is an OpenID Connect provider backed by httptest. It signs every
+// login in as whoever was last passed to SetUser.
+type Issuer struct {
+	*httptest.Server
+
+	ClientID     string
+	ClientSecret string
+
+	mu     sync.Mutex
+	claims map[string]any
+	grants map[string]grant
+	key    *rsa.PrivateKey
+	signer jose.Signer
+}
+
+// New starts an issuer with a single registered client.
+func New(clientID, clientSecret string) *Issuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", keyID),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	issuer := &Issuer{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		claims:       map[string]any{},
+		grants:       map[string]grant{},
+		key:          key,
+		signer:       signer,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", issuer.discovery)
+	mux.HandleFunc("/jwks", issuer.jwks)
+	mux.HandleFunc("/authorize", issuer.authorize)
+	mux.HandleFunc("/token", issuer.token)
+	issuer.Server = httptest.NewServer(mux)
+
+	return issuer
+}
+
+// SetUser sets the claims for the next login. sub is required.
+func (i *Issuer) SetUser(claims map[string]any) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.claims = maps.Clone(claims)
+}
+
+// Authorize plays the browser: it follows authURL to the issuer and returns
+// the redirect back to the client, carrying the code and state.
+func (i *Issuer) Authorize(authURL string) (*url.URL, error) {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	res, err := client.Get(authURL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusFound {
+		return nil, fmt.Errorf("authorize returned %s", res.Status)
+	}
+
+	return url.Parse(res.Header.Get("Location"))
+}
+
+func (i *Issuer) discovery(res http.ResponseWriter, req *http.Request) {
+	writeJSON(res, map[string]any{
+		"issuer":                                i.URL,
+		"authorization_endpoint":                i.URL + "/authorize",
+		"token_endpoint":                        i.URL + "/token",
+		"jwks_uri":                              i.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (i *Issuer) jwks(res http.ResponseWriter, req *http.Request) {
+	writeJSON(res, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+		Key:       &i.key.PublicKey,
+		KeyID:     keyID,
+		Algorithm: string(jose.RS256),
+		Use:       "sig",
+	}}})
+}
+
+func (i *Issuer) authorize(res http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+
+	if query.Get("response_type") != "code" || query.Get("client_id") != i.ClientID {
+		http.Error(res, "invalid_request", http.StatusBadRequest)
+		return
+	}
+
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(res, "pkce required", http.StatusBadRequest)
+		return
+	}
+
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirect.Host == "" {
+		http.Error(res, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	code := rand.Text()
+
+	i.mu.Lock()
+	i.grants[code] = grant{
+		clientID:      query.Get("client_id"),
+		redirectURI:   query.Get("redirect_uri"),
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+		claims:        maps.Clone(i.claims),
+	}
+	i.mu.Unlock()
+
+	values := redirect.Query()
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	redirect.RawQuery = values.Encode()
+
+	http.Redirect(res, req, redirect.String(), http.StatusFound)
+}
+
+func (i *Issuer) token(res http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		tokenError(res, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	clientID, clientSecret, ok := req.BasicAuth()
+	if !ok {
+		clientID, clientSecret = req.PostForm.Get("client_id"), req.PostForm.Get("client_secret")
+	}
+
+	if clientID != i.ClientID || clientSecret != i.ClientSecret {
+		tokenError(res, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	i.mu.Lock()
+	code := req.PostForm.Get("code")
+	g, found := i.grants[code]
+	delete(i.grants, code)
+	i.mu.Unlock()
+
+	if !found || g.clientID != clientID || g.redirectURI != req.PostForm.Get("redirect_uri") {
+		tokenError(res, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	challenge := sha256.Sum256([]byte(req.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(challenge[:]) != g.codeChallenge {
+		tokenError(res, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := map[string]any{}
+	maps.Copy(claims, g.claims)
+	claims["iss"] = i.URL
+	claims["aud"] = clientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(5 * time.Minute).Unix()
+	if g.nonce != "" {
+		claims["nonce"] = g.nonce
+	}
+
+	payload, _ := json.Marshal(claims)
+	signed, err := i.signer.Sign(payload)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	idToken, _ := signed.CompactSerialize()
+
+	writeJSON(res, map[string]any{
+		"access_token": rand.Text(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func tokenError(res http.ResponseWriter, status int, code string) {
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	json.NewEncoder(res).Encode(map[string]string{"error": code})
+}
+
+func writeJSON(res http.ResponseWriter, v any) {
+	res.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(res).Encode(v)
+}
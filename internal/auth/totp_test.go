@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B vectors for SHA1, truncated to six digits.
+func TestTOTPCode(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := TOTPCode(secret, TOTPStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("TOTPCode(%d): %v", tt.unix, err)
+		}
+
+		if got != tt.want {
+			t.Errorf("TOTPCode(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := GenerateTOTPSecret()
+	now := time.Unix(1700000000, 0)
+	step := TOTPStep(now)
+
+	code, _ := TOTPCode(secret, step)
+	if got, ok := ValidateTOTP(secret, code, now, 0); !ok || got != step {
+		t.Fatalf("current code rejected: step %d, ok %v", got, ok)
+	}
+
+	if _, ok := ValidateTOTP(secret, code, now, step); ok {
+		t.Error("replayed code accepted")
+	}
+
+	previous, _ := TOTPCode(secret, step-1)
+	if _, ok := ValidateTOTP(secret, previous, now, 0); !ok {
+		t.Error("code from the previous step rejected")
+	}
+
+	stale, _ := TOTPCode(secret, step-2)
+	if _, ok := ValidateTOTP(secret, stale, now, 0); ok {
+		t.Error("code from two steps ago accepted")
+	}
+
+	if _, ok := ValidateTOTP(secret, "12345", now, 0); ok {
+		t.Error("short code accepted")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := TOTPProvisioningURI("ABCDEF", "viz", "ada@example.com")
+	if !strings.HasPrefix(uri, "otpauth://totp/viz:ada@example.com?") {
+		t.Errorf("unexpected uri %s", uri)
+	}
+
+	if !strings.Contains(uri, "secret=ABCDEF") || !strings.Contains(uri, "issuer=viz") {
+		t.Errorf("uri missing secret or issuer: %s", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes := GenerateRecoveryCodes(RecoveryCodeCount)
+	if len(codes) != RecoveryCodeCount {
+		t.Fatalf("got %d codes, want %d", len(codes), RecoveryCodeCount)
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("badly formatted code %q", code)
+		}
+
+		normalized := NormalizeRecoveryCode(strings.ToUpper(code))
+		if seen[normalized] {
+			t.Errorf("duplicate code %q", code)
+		}
+		seen[normalized] = true
+	}
+}
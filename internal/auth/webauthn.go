@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// PasskeyCeremonyTimeout is how long the browser gets to complete a WebAuthn
+// registration or login once it has the options.
+const PasskeyCeremonyTimeout = 5 * time.Minute
+
+// PasskeyUser adapts a user and their stored credentials to webauthn.User.
+// The user handle is the user's uid, which is how a discoverable login finds
+// the account.
+type PasskeyUser struct {
+	Uid         string
+	Name        string
+	DisplayName string
+	Credentials []webauthn.Credential
+}
+
+func (u *PasskeyUser) WebAuthnID() []byte                         { return []byte(u.Uid) }
+func (u *PasskeyUser) WebAuthnName() string                       { return u.Name }
+func (u *PasskeyUser) WebAuthnDisplayName() string                { return u.DisplayName }
+func (u *PasskeyUser) WebAuthnIcon() string                       { return "" }
+func (u *PasskeyUser) WebAuthnCredentials() []webauthn.Credential { return u.Credentials }
+
+// Exclusions lists the user's existing credentials so an authenticator isn't
+// registered twice.
+func (u *PasskeyUser) Exclusions() []protocol.CredentialDescriptor {
+	descriptors := make([]protocol.CredentialDescriptor, len(u.Credentials))
+	for i, cred := range u.Credentials {
+		descriptors[i] = cred.Descriptor()
+	}
+	return descriptors
+}
+
+// NewWebAuthn returns a relying party for rpID. If rpID or origins are empty
+// they are derived from baseURL.
+func NewWebAuthn(rpID string, origins []string, baseURL string) (*webauthn.WebAuthn, error) {
+	if rpID == "" || len(origins) == 0 {
+		u, err := url.Parse(baseURL)
+		if err != nil || u.Hostname() == "" {
+			return nil, fmt.Errorf("webauthn needs security.webauthn_rp_id or a valid baseUrl, got %q", baseURL)
+		}
+
+		if rpID == "" {
+			rpID = u.Hostname()
+		}
+
+		if len(origins) == 0 {
+			origins = []string{u.Scheme + "://" + u.Host}
+		}
+	}
+
+	return webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: "Viz",
+		RPOrigins:     origins,
+		// Passkeys only need to prove possession, attestation would just
+		// tell us the make and model.
+		AttestationPreference: protocol.PreferNoAttestation,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+			UserVerification: protocol.VerificationPreferred,
+		},
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: PasskeyCeremonyTimeout},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: PasskeyCeremonyTimeout},
+		},
+	})
+}
+
+// ParsePasskeyRegistration parses the PublicKeyCredential JSON the browser
+// returns from navigator.credentials.create().
+func ParsePasskeyRegistration(credential []byte) (*protocol.ParsedCredentialCreationData, error) {
+	return protocol.ParseCredentialCreationResponseBody(bytes.NewReader(credential))
+}
+
+// ParsePasskeyAssertion parses the PublicKeyCredential JSON the browser
+// returns from navigator.credentials.get().
+func ParsePasskeyAssertion(credential []byte) (*protocol.ParsedCredentialAssertionData, error) {
+	return protocol.ParseCredentialRequestResponseBody(bytes.NewReader(credential))
+}
@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"viz/internal/auth/webauthntest"
+)
+
+// roundTrip sends v through JSON, as it would travel to the browser and back
+// or in and out of the database.
+func roundTrip[T any](t *testing.T, v T) T {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	var out T
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	return out
+}
+
+func registerPasskey(t *testing.T, w *webauthn.WebAuthn, authenticator *webauthntest.Authenticator, user *PasskeyUser) *webauthn.Credential {
+	t.Helper()
+
+	creation, session, err := w.BeginRegistration(user, webauthn.WithExclusions(user.Exclusions()))
+	if err != nil {
+		t.Fatalf("begin registration: %v", err)
+	}
+
+	response, err := authenticator.Create(roundTrip(t, creation).Response)
+	if err != nil {
+		t.Fatalf("authenticator create: %v", err)
+	}
+
+	parsed, err := ParsePasskeyRegistration(response)
+	if err != nil {
+		t.Fatalf("parse registration: %v", err)
+	}
+
+	cred, err := w.CreateCredential(user, *roundTrip(t, session), parsed)
+	if err != nil {
+		t.Fatalf("finish registration: %v", err)
+	}
+
+	return cred
+}
+
+func TestPasskeyCeremonies(t *testing.T) {
+	w, err := NewWebAuthn("", nil, "https://photos.example.com")
+	if err != nil {
+		t.Fatalf("NewWebAuthn: %v", err)
+	}
+
+	authenticator := webauthntest.New("https://photos.example.com")
+	user := &PasskeyUser{Uid: "user123", Name: "ada@example.com", DisplayName: "Ada"}
+
+	cred := registerPasskey(t, w, authenticator, user)
+	user.Credentials = append(user.Credentials, *cred)
+
+	t.Run("discoverable login", func(t *testing.T) {
+		assertion, session, err := w.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+		if err != nil {
+			t.Fatalf("begin login: %v", err)
+		}
+
+		response, err := authenticator.Get(roundTrip(t, assertion).Response)
+		if err != nil {
+			t.Fatalf("authenticator get: %v", err)
+		}
+
+		parsed, err := ParsePasskeyAssertion(response)
+		if err != nil {
+			t.Fatalf("parse assertion: %v", err)
+		}
+
+		var found string
+		login, err := w.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+			found = string(userHandle)
+			return user, nil
+		}, *roundTrip(t, session), parsed)
+
+		if err != nil {
+			t.Fatalf("finish login: %v", err)
+		}
+
+		if found != user.Uid {
+			t.Errorf("user handle = %q, want %q", found, user.Uid)
+		}
+
+		if login.Authenticator.SignCount != 1 {
+			t.Errorf("sign count = %d, want 1", login.Authenticator.SignCount)
+		}
+	})
+
+	t.Run("second factor", func(t *testing.T) {
+		assertion, session, err := w.BeginLogin(user)
+		if err != nil {
+			t.Fatalf("begin login: %v", err)
+		}
+
+		response, err := authenticator.Get(roundTrip(t, assertion).Response)
+		if err != nil {
+			t.Fatalf("authenticator get: %v", err)
+		}
+
+		parsed, err := ParsePasskeyAssertion(response)
+		if err != nil {
+			t.Fatalf("parse assertion: %v", err)
+		}
+
+		if _, err := w.ValidateLogin(user, *roundTrip(t, session), parsed); err != nil {
+			t.Fatalf("finish login: %v", err)
+		}
+	})
+
+	t.Run("wrong origin", func(t *testing.T) {
+		assertion, session, err := w.BeginLogin(user)
+		if err != nil {
+			t.Fatalf("begin login: %v", err)
+		}
+
+		phishing := *authenticator
+		phishing.Origin = "https://photos.example.net"
+
+		response, err := phishing.Get(assertion.Response)
+		if err != nil {
+			t.Fatalf("authenticator get: %v", err)
+		}
+
+		parsed, err := ParsePasskeyAssertion(response)
+		if err != nil {
+			t.Fatalf("parse assertion: %v", err)
+		}
+
+		if _, err := w.ValidateLogin(user, *session, parsed); err == nil {
+			t.Fatal("assertion from another origin was accepted")
+		}
+	})
+
+	t.Run("replayed challenge", func(t *testing.T) {
+		assertion, _, err := w.BeginLogin(user)
+		if err != nil {
+			t.Fatalf("begin login: %v", err)
+		}
+
+		_, other, err := w.BeginLogin(user)
+		if err != nil {
+			t.Fatalf("begin login: %v", err)
+		}
+
+		response, err := authenticator.Get(assertion.Response)
+		if err != nil {
+			t.Fatalf("authenticator get: %v", err)
+		}
+
+		parsed, err := ParsePasskeyAssertion(response)
+		if err != nil {
+			t.Fatalf("parse assertion: %v", err)
+		}
+
+		if _, err := w.ValidateLogin(user, *other, parsed); err == nil {
+			t.Fatal("assertion for another challenge was accepted")
+		}
+	})
+}
+
+func TestNewWebAuthnNeedsRelyingParty(t *testing.T) {
+	if _, err := NewWebAuthn("", nil, ""); err == nil {
+		t.Error("expected an error without an rp id or base url")
+	}
+
+	w, err := NewWebAuthn("example.com", []string{"https://example.com"}, "")
+	if err != nil {
+		t.Fatalf("NewWebAuthn: %v", err)
+	}
+
+	if w.Config.RPID != "example.com" {
+		t.Errorf("rp id = %q", w.Config.RPID)
+	}
+}
@@ -0,0 +1,217 @@
+// Package webauthntest provides a software WebAuthn authenticator so
+// registration and login ceremonies can be run end to end in tests, without a
+// browser or a security key.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+)
+
+// Authenticator flags, WebAuthn §6.1.
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+type credential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	key        *ecdsa.PrivateKey
+	signCount  uint32
+}
+
+// Authenticator is an in-memory platform authenticator holding ES256
+// discoverable credentials. It uses "none" attestation and always reports
+// user presence and verification.
+type Authenticator struct {
+	Origin      string
+	credentials []*credential
+}
+
+// New returns an authenticator whose client data claims origin.
+func New(origin string) *Authenticator {
+	return &Authenticator{Origin: origin}
+}
+
+// Create performs navigator.credentials.create() for the given options and
+// returns the PublicKeyCredential JSON a browser would send back.
+func (a *Authenticator) Create(options protocol.PublicKeyCredentialCreationOptions) ([]byte, error) {
+	userHandle, err := userID(options.User.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	cred := &credential{
+		id:         randomBytes(16),
+		rpID:       options.RelyingParty.ID,
+		userHandle: userHandle,
+		key:        key,
+	}
+
+	cose, err := webauthncbor.Marshal(map[int]any{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: padded(key.X.Bytes()),
+		-3: padded(key.Y.Bytes()),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	authData := authenticatorData(cred.rpID, flagUserPresent|flagUserVerified|flagAttestedData, 0)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(cred.id)))
+	authData = append(authData, cred.id...)
+	authData = append(authData, cose...)
+
+	attestation, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	clientData, err := a.clientData("webauthn.create", options.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	a.credentials = append(a.credentials, cred)
+
+	return json.Marshal(map[string]any{
+		"id":    b64(cred.id),
+		"rawId": b64(cred.id),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    b64(clientData),
+			"attestationObject": b64(attestation),
+		},
+	})
+}
+
+// Get performs navigator.credentials.get() for the given options and returns
+// the PublicKeyCredential JSON a browser would send back. With an empty allow
+// list any credential for the relying party is used, as for a discoverable
+// login.
+func (a *Authenticator) Get(options protocol.PublicKeyCredentialRequestOptions) ([]byte, error) {
+	cred := a.find(options.RelyingPartyID, options.AllowedCredentials)
+	if cred == nil {
+		return nil, errors.New("no matching credential")
+	}
+
+	cred.signCount++
+	authData := authenticatorData(cred.rpID, flagUserPresent|flagUserVerified, cred.signCount)
+
+	clientData, err := a.clientData("webauthn.get", options.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+
+	signature, err := ecdsa.SignASN1(rand.Reader, cred.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]any{
+		"id":    b64(cred.id),
+		"rawId": b64(cred.id),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    b64(clientData),
+			"authenticatorData": b64(authData),
+			"signature":         b64(signature),
+			"userHandle":        b64(cred.userHandle),
+		},
+	})
+}
+
+func (a *Authenticator) find(rpID string, allowed []protocol.CredentialDescriptor) *credential {
+	for _, cred := range a.credentials {
+		if rpID != "" && cred.rpID != rpID {
+			continue
+		}
+
+		if len(allowed) == 0 {
+			return cred
+		}
+
+		for _, d := range allowed {
+			if string(d.CredentialID) == string(cred.id) {
+				return cred
+			}
+		}
+	}
+
+	return nil
+}
+
+func (a *Authenticator) clientData(ceremony string, challenge protocol.URLEncodedBase64) ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"type":      ceremony,
+		"challenge": b64(challenge),
+		"origin":    a.Origin,
+	})
+}
+
+func authenticatorData(rpID string, flags byte, signCount uint32) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	return binary.BigEndian.AppendUint32(data, signCount)
+}
+
+// userID decodes the user handle from creation options, which is base64url
+// once the options have been through JSON.
+func userID(id any) ([]byte, error) {
+	switch v := id.(type) {
+	case protocol.URLEncodedBase64:
+		return v, nil
+	case string:
+		return base64.RawURLEncoding.DecodeString(v)
+	default:
+		return nil, fmt.Errorf("unexpected user id type %T", id)
+	}
+}
+
+func padded(b []byte) []byte {
+	out := make([]byte, 32)
+	copy(out[32-len(b):], b)
+	return out
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -32,8 +32,34 @@ func ReadConfig() (viper.Viper, error) {
 	_ = v.BindEnv("database.password", "DB_PASSWORD")
 	_ = v.BindEnv("database.name", "DB_NAME")
 	_ = v.BindEnv("redis.password", "REDIS_PASSWORD")
+	_ = v.BindEnv("redis.backend", "QUEUE_BACKEND")
+	_ = v.BindEnv("redis.mode", "QUEUE_MODE")
+	_ = v.BindEnv("redis.worker_topics", "WORKER_TOPICS")
+	_ = v.BindEnv("security.require_admin_2fa", "REQUIRE_ADMIN_2FA")
+	_ = v.BindEnv("security.url_signing_key", "URL_SIGNING_KEY")
+	_ = v.BindEnv("security.webauthn_rp_id", "WEBAUTHN_RP_ID")
+	_ = v.BindEnv("security.webauthn_origins", "WEBAUTHN_ORIGINS")
+	_ = v.BindEnv("security.rate_limit.enabled", "RATE_LIMIT_ENABLED")
+	_ = v.BindEnv("security.rate_limit.store", "RATE_LIMIT_STORE")
+	_ = v.BindEnv("security.rate_limit.trust_proxy_headers", "TRUST_PROXY_HEADERS")
+	_ = v.BindEnv("security.session.idle_timeout_minutes", "SESSION_IDLE_TIMEOUT_MINUTES")
+	_ = v.BindEnv("security.session.remember_me_days", "SESSION_REMEMBER_ME_DAYS")
+	_ = v.BindEnv("security.session.browser_session_hours", "SESSION_BROWSER_HOURS")
+	_ = v.BindEnv("federation.enabled", "FEDERATION_ENABLED")
+	_ = v.BindEnv("federation.key", "FEDERATION_KEY")
+	_ = v.BindEnv("analytics.enabled", "ANALYTICS_ENABLED")
+	_ = v.BindEnv("analytics.ip_hashing", "ANALYTICS_IP_HASHING")
+	_ = v.BindEnv("mail.driver", "MAIL_DRIVER")
+	_ = v.BindEnv("mail.from", "MAIL_FROM")
+	_ = v.BindEnv("mail.file_dir", "MAIL_FILE_DIR")
+	_ = v.BindEnv("mail.smtp.host", "SMTP_HOST")
+	_ = v.BindEnv("mail.smtp.port", "SMTP_PORT")
+	_ = v.BindEnv("mail.smtp.username", "SMTP_USERNAME")
+	_ = v.BindEnv("mail.smtp.password", "SMTP_PASSWORD")
+	_ = v.BindEnv("mail.smtp.tls", "SMTP_TLS")
 	_ = v.BindEnv("base_directory", "BASE_DIRECTORY")
 	_ = v.BindEnv("upload.location", "UPLOAD_LOCATION")
+	_ = v.BindEnv("upload.max_file_size_mb", "UPLOAD_MAX_FILE_SIZE_MB")
 
 	// Set Defaults
 	v.SetDefault("baseUrl", "localhost")
@@ -43,6 +69,8 @@ func ReadConfig() (viper.Viper, error) {
 
 	v.SetDefault("logging.level", "debug")
 
+	v.SetDefault("upload.max_file_size_mb", 200)
+
 	v.SetDefault("database.location", "database")
 	v.SetDefault("database.port", 5432)
 	v.SetDefault("database.name", "viz")
@@ -56,6 +84,17 @@ func ReadConfig() (viper.Viper, error) {
 	v.SetDefault("redis.dial_timeout_seconds", 5)
 	v.SetDefault("redis.read_timeout_seconds", 3)
 	v.SetDefault("redis.write_timeout_seconds", 3)
+	v.SetDefault("redis.interactive_weight", 6)
+	v.SetDefault("redis.normal_weight", 3)
+	v.SetDefault("redis.bulk_weight", 1)
+	v.SetDefault("redis.bulk_rate_per_second", 10)
+	v.SetDefault("redis.backend", "")
+	v.SetDefault("redis.visibility_timeout_seconds", 300)
+	v.SetDefault("redis.poll_interval_millis", 1000)
+	v.SetDefault("redis.heartbeat_interval_seconds", 15)
+	v.SetDefault("redis.lease_timeout_seconds", 90)
+	v.SetDefault("redis.max_attempts", 3)
+	v.SetDefault("redis.mode", "all")
 
 	v.SetDefault("libvips.match_system_logging", false)
 	v.SetDefault("libvips.cache_max_memory_mb", 0)
@@ -81,6 +120,36 @@ func ReadConfig() (viper.Viper, error) {
 	v.SetDefault("security.argon2_memory_mb", 64)
 	v.SetDefault("security.argon2_time", 3)
 	v.SetDefault("security.argon2_threads", 4)
+	v.SetDefault("security.require_admin_2fa", false)
+	v.SetDefault("security.rate_limit.enabled", true)
+	v.SetDefault("security.rate_limit.store", "memory")
+	v.SetDefault("security.rate_limit.trust_proxy_headers", false)
+	v.SetDefault("security.rate_limit.requests_per_minute", 30)
+	v.SetDefault("security.rate_limit.max_failures", 5)
+	v.SetDefault("security.rate_limit.failure_window_seconds", 900)
+	v.SetDefault("security.rate_limit.lockout_seconds", 60)
+	v.SetDefault("security.rate_limit.max_lockout_seconds", 3600)
+	v.SetDefault("security.session.idle_timeout_minutes", 7*24*60)
+	v.SetDefault("security.session.remember_me_days", 30)
+	v.SetDefault("security.session.browser_session_hours", 12)
+
+	v.SetDefault("export.retention_hours", 72)
+
+	v.SetDefault("federation.enabled", false)
+	v.SetDefault("federation.sync_interval_minutes", 60)
+	v.SetDefault("federation.allow_insecure", false)
+
+	v.SetDefault("analytics.enabled", true)
+	v.SetDefault("analytics.ip_hashing", "daily")
+	v.SetDefault("analytics.batch_size", 500)
+	v.SetDefault("analytics.flush_interval_seconds", 10)
+	v.SetDefault("analytics.rollup_interval_minutes", 15)
+	v.SetDefault("analytics.retention_days", 30)
+
+	v.SetDefault("mail.driver", "log")
+	v.SetDefault("mail.from", "Viz <noreply@localhost>")
+	v.SetDefault("mail.smtp.port", 587)
+	v.SetDefault("mail.smtp.tls", "starttls")
 
 	err := v.ReadInConfig()
 	if err != nil {
@@ -9,6 +9,7 @@ import (
 	"gorm.io/gorm"
 	
 	"viz/internal/db"
+	"viz/internal/utils"
 	"viz/internal/settings"
 	libhttp "viz/internal/http"
 	_ "github.com/joho/godotenv/autoload"
@@ -22,6 +23,36 @@ type VizServer struct {
 	LogLevel slog.Level
 }
 
+// NewDatabase builds the database connection settings from cfg, letting the
+// DB_HOST and DB_USER environment variables override the config file.
+func NewDatabase(cfg VizConfig, logger *slog.Logger, logLevel slog.Level) *db.DB {
+	return &db.DB{
+		Address: func() string {
+			if host := os.Getenv("DB_HOST"); host != "" {
+				return host
+			}
+			return "localhost"
+		}(),
+		Port: func() int {
+			if cfg.Database.Port == 0 {
+				return 5432
+			}
+			return cfg.Database.Port
+		}(),
+		User: func() string {
+			if user := os.Getenv("DB_USER"); user != "" {
+				return user
+			}
+			return cfg.Database.User
+		}(),
+		Password:     cfg.Database.Password,
+		AppName:      utils.AppName,
+		DatabaseName: cfg.Database.Name,
+		Logger:       logger,
+		LogLevel:     logLevel,
+	}
+}
+
 func (server VizServer) ConnectToDatabase(dst ...any) *gorm.DB {
 	logger := server.Logger
 	database := server.Database
@@ -69,5 +100,8 @@ func (server VizServer) ConnectToDatabase(dst ...any) *gorm.DB {
 	// Run backfill for ownership
 	db.BackfillOwnership(client, logger)
 
+	// Sessions used to store their token in plaintext
+	db.HashLegacySessionTokens(client, logger)
+
 	return client
 }
\ No newline at end of file
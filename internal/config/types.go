@@ -26,6 +26,36 @@ type RedisConfig struct {
 // QueueConfig holds the configuration for the job queue.
 type QueueConfig struct {
 	RedisConfig `mapstructure:",squash"`
+	// Relative share of worker slots each priority lane gets while several
+	// lanes have jobs waiting.
+	InteractiveWeight int `json:"interactive_weight" mapstructure:"interactive_weight"`
+	NormalWeight      int `json:"normal_weight" mapstructure:"normal_weight"`
+	BulkWeight        int `json:"bulk_weight" mapstructure:"bulk_weight"`
+	// BulkRatePerSecond caps how many bulk jobs start per second. 0 disables it.
+	BulkRatePerSecond int `json:"bulk_rate_per_second" mapstructure:"bulk_rate_per_second"`
+	// Backend selects the message broker: "memory", "redis" or "postgres". When
+	// empty, Redis is used if enabled and the in-memory channel otherwise.
+	Backend string `json:"backend" mapstructure:"backend"`
+	// How long a message delivered by the Postgres backend stays hidden from
+	// other workers. The lease is renewed while the job runs, so this only
+	// matters when a worker dies mid-job.
+	VisibilityTimeoutSeconds int `json:"visibility_timeout_seconds" mapstructure:"visibility_timeout_seconds"`
+	// How often the Postgres backend polls a topic that had no messages.
+	PollIntervalMillis int `json:"poll_interval_millis" mapstructure:"poll_interval_millis"`
+	// How often a running job records a heartbeat, and how long without one
+	// before the reaper treats the job as abandoned.
+	HeartbeatIntervalSeconds int `json:"heartbeat_interval_seconds" mapstructure:"heartbeat_interval_seconds"`
+	LeaseTimeoutSeconds      int `json:"lease_timeout_seconds" mapstructure:"lease_timeout_seconds"`
+	// MaxAttempts is how many times an abandoned job is started before the
+	// reaper gives up and marks it failed.
+	MaxAttempts int `json:"max_attempts" mapstructure:"max_attempts"`
+	// Mode is "all" (the API server also runs the workers) or "api" (the API
+	// only publishes jobs and standalone workers consume them).
+	Mode string `json:"mode" mapstructure:"mode"`
+	// Topics a standalone worker consumes (all when empty) and the
+	// concurrency for each.
+	WorkerTopics      []string       `json:"worker_topics" mapstructure:"worker_topics"`
+	WorkerConcurrency map[string]int `json:"worker_concurrency" mapstructure:"worker_concurrency"`
 }
 
 // DatabaseConfig holds the configuration for the database connection.
@@ -45,6 +75,9 @@ type LoggingConfig struct {
 // UploadConfig holds the configuration for uploads.
 type UploadConfig struct {
 	Location string `json:"location" mapstructure:"location"`
+	// MaxFileSizeMB caps files sent through upload links, whatever the
+	// link itself allows.
+	MaxFileSizeMB int64 `json:"max_file_size_mb" mapstructure:"max_file_size_mb"`
 }
 
 // LibvipsConfig holds the configuration for libvips.
@@ -79,6 +112,55 @@ type CacheConfig struct {
 	Images                 ImageCacheConfig `json:"images" mapstructure:"images"`
 }
 
+// ExportConfig sets where background archive exports are built and how
+// long they're kept.
+type ExportConfig struct {
+	// Directory defaults to exports/ under the base directory. Standalone
+	// workers build archives there, so it must be shared with the API.
+	Directory string `json:"directory" mapstructure:"directory"`
+	// RetentionHours is how long a built archive can be downloaded.
+	RetentionHours int `json:"retention_hours" mapstructure:"retention_hours"`
+}
+
+// FederationConfig sets up talking to other Viz servers (RFC 001): the
+// discovery document, trust handshakes and mirroring their collections. It
+// needs baseUrl, which is what peers know this server by.
+type FederationConfig struct {
+	Enabled bool `json:"enabled" mapstructure:"enabled"`
+	// Name is shown to peers. Defaults to the host of baseUrl.
+	Name string `json:"name" mapstructure:"name"`
+	// Key is the base64 Ed25519 seed requests to peers are signed with. If
+	// empty, one is generated and kept in the base directory.
+	Key string `json:"key" mapstructure:"key"`
+	// SyncIntervalMinutes is how often mirrored collections pull changes.
+	SyncIntervalMinutes int `json:"sync_interval_minutes" mapstructure:"sync_interval_minutes"`
+	// AllowInsecure lets peers be reached over plain HTTP. Only for
+	// development.
+	AllowInsecure bool `json:"allow_insecure" mapstructure:"allow_insecure"`
+}
+
+// AnalyticsConfig sets up counting views and downloads of images,
+// collections and share links.
+type AnalyticsConfig struct {
+	Enabled bool `json:"enabled" mapstructure:"enabled"`
+	// IPHashing is how visitors' addresses are kept to count unique
+	// visitors. Addresses are never stored as they are: "daily" hashes them
+	// with a key that changes every day, so visits can't be linked from one
+	// day to the next, "persistent" with one that doesn't, and "off" keeps
+	// nothing, so unique visitors aren't counted.
+	IPHashing string `json:"ip_hashing" mapstructure:"ip_hashing"`
+	// BatchSize is how many events are written at once. A full batch is
+	// written straight away, the rest every FlushIntervalSeconds.
+	BatchSize            int `json:"batch_size" mapstructure:"batch_size"`
+	FlushIntervalSeconds int `json:"flush_interval_seconds" mapstructure:"flush_interval_seconds"`
+	// RollupIntervalMinutes is how often events are added up into daily
+	// counts, which is how far behind the analytics endpoints can be.
+	RollupIntervalMinutes int `json:"rollup_interval_minutes" mapstructure:"rollup_interval_minutes"`
+	// RetentionDays is how long single events are kept after they have been
+	// added up. The daily counts are kept for good.
+	RetentionDays int `json:"retention_days" mapstructure:"retention_days"`
+}
+
 type UserManagementConfig struct {
 	AllowManualRegistration bool `json:"allow_manual_registration" mapstructure:"allow_manual_registration"`
 }
@@ -87,6 +169,108 @@ type SecurityConfig struct {
 	Argon2MemoryMB int `json:"argon2_memory_mb" mapstructure:"argon2_memory_mb"`
 	Argon2Time     int `json:"argon2_time" mapstructure:"argon2_time"`
 	Argon2Threads  int `json:"argon2_threads" mapstructure:"argon2_threads"`
+	// RequireAdmin2FA refuses admin endpoints to admins who haven't enabled
+	// two-factor authentication.
+	RequireAdmin2FA bool `json:"require_admin_2fa" mapstructure:"require_admin_2fa"`
+	// URLSigningKey signs image URLs that work without signing in. If it's
+	// empty a key is generated and kept in the base directory.
+	URLSigningKey string `json:"url_signing_key" mapstructure:"url_signing_key"`
+	// WebAuthnRPID and WebAuthnOrigins identify this instance to passkeys.
+	// They default to the host and origin of baseUrl; changing the RP ID
+	// later invalidates every registered passkey.
+	WebAuthnRPID    string   `json:"webauthn_rp_id" mapstructure:"webauthn_rp_id"`
+	WebAuthnOrigins []string `json:"webauthn_origins" mapstructure:"webauthn_origins"`
+	// OIDCProviders are the OpenID Connect identity providers users can sign
+	// in with, alongside passwords and passkeys.
+	OIDCProviders []OIDCProviderConfig `json:"oidc_providers" mapstructure:"oidc_providers"`
+	RateLimit     RateLimitConfig      `json:"rate_limit" mapstructure:"rate_limit"`
+	Session       SessionConfig        `json:"session" mapstructure:"session"`
+}
+
+// SessionConfig sets how long sign-in sessions last.
+type SessionConfig struct {
+	// IdleTimeoutMinutes ends a session that hasn't been used for this long.
+	IdleTimeoutMinutes int `json:"idle_timeout_minutes" mapstructure:"idle_timeout_minutes"`
+	// RememberMeDays is how long a "remember me" session can last at most.
+	RememberMeDays int `json:"remember_me_days" mapstructure:"remember_me_days"`
+	// BrowserSessionHours is how long any other session can last at most.
+	// Its cookie also goes when the browser is closed.
+	BrowserSessionHours int `json:"browser_session_hours" mapstructure:"browser_session_hours"`
+}
+
+// RateLimitConfig throttles sign-in and password protected download
+// endpoints and locks out keys (an IP, an account or a token) after repeated
+// failures.
+type RateLimitConfig struct {
+	Enabled bool `json:"enabled" mapstructure:"enabled"`
+	// Store is "memory" or "redis". Redis uses the redis connection settings
+	// and shares counters between API instances.
+	Store string `json:"store" mapstructure:"store"`
+	// TrustProxyHeaders takes the client IP from X-Forwarded-For. Only
+	// enable it behind a reverse proxy that sets the header.
+	TrustProxyHeaders bool `json:"trust_proxy_headers" mapstructure:"trust_proxy_headers"`
+	// Requests each IP may make to a rate limited endpoint per minute.
+	RequestsPerMinute int `json:"requests_per_minute" mapstructure:"requests_per_minute"`
+	// MaxFailures within FailureWindowSeconds locks a key out for
+	// LockoutSeconds. Every further failure doubles the lockout, up to
+	// MaxLockoutSeconds.
+	MaxFailures          int `json:"max_failures" mapstructure:"max_failures"`
+	FailureWindowSeconds int `json:"failure_window_seconds" mapstructure:"failure_window_seconds"`
+	LockoutSeconds       int `json:"lockout_seconds" mapstructure:"lockout_seconds"`
+	MaxLockoutSeconds    int `json:"max_lockout_seconds" mapstructure:"max_lockout_seconds"`
+}
+
+// OIDCProviderConfig configures one OpenID Connect identity provider, such as
+// a Keycloak realm or an Authentik application.
+type OIDCProviderConfig struct {
+	// ID names the provider in URLs, e.g. /auth/oidc/{id}/login.
+	ID           string   `json:"id" mapstructure:"id"`
+	Name         string   `json:"name" mapstructure:"name"`
+	Issuer       string   `json:"issuer" mapstructure:"issuer"`
+	ClientID     string   `json:"client_id" mapstructure:"client_id"`
+	ClientSecret string   `json:"client_secret" mapstructure:"client_secret"`
+	Scopes       []string `json:"scopes" mapstructure:"scopes"`
+	// RedirectURL defaults to {baseUrl}/api/auth/oidc/{id}/callback.
+	RedirectURL string `json:"redirect_url" mapstructure:"redirect_url"`
+	// GroupsClaim is the claim holding the user's groups. Dots descend into
+	// nested claims, e.g. realm_access.roles for Keycloak realm roles.
+	GroupsClaim  string            `json:"groups_claim" mapstructure:"groups_claim"`
+	RoleMappings []OIDCRoleMapping `json:"role_mappings" mapstructure:"role_mappings"`
+	// DefaultRole is given to users none of whose groups are mapped.
+	DefaultRole string `json:"default_role" mapstructure:"default_role"`
+	// RequireMappedGroup refuses users none of whose groups are mapped.
+	RequireMappedGroup bool `json:"require_mapped_group" mapstructure:"require_mapped_group"`
+	// AllowSignup creates an account on first login. Without it only users
+	// that already exist, matched by verified email, can sign in.
+	AllowSignup bool `json:"allow_signup" mapstructure:"allow_signup"`
+}
+
+// OIDCRoleMapping gives members of an identity provider group a role.
+type OIDCRoleMapping struct {
+	Group string `json:"group" mapstructure:"group"`
+	Role  string `json:"role" mapstructure:"role"`
+}
+
+// MailConfig selects how outgoing email is delivered.
+type MailConfig struct {
+	// Driver is smtp, file or log. log only notes who messages are for in
+	// the server log, leaving out their bodies and the links in them.
+	Driver string `json:"driver" mapstructure:"driver"`
+	From   string `json:"from" mapstructure:"from"`
+	// FileDir is where the file driver writes .eml files. Defaults to
+	// mail/ under the base directory.
+	FileDir string     `json:"file_dir" mapstructure:"file_dir"`
+	SMTP    SMTPConfig `json:"smtp" mapstructure:"smtp"`
+}
+
+// SMTPConfig configures the smtp mail driver.
+type SMTPConfig struct {
+	Host     string `json:"host" mapstructure:"host"`
+	Port     int    `json:"port" mapstructure:"port"`
+	Username string `json:"username" mapstructure:"username"`
+	Password string `json:"password" mapstructure:"password"`
+	// TLS is starttls, tls (implicit, usually port 465) or none.
+	TLS string `json:"tls" mapstructure:"tls"`
 }
 
 // VizConfig is the root configuration structure.
@@ -102,4 +286,8 @@ type VizConfig struct {
 	UserManagement UserManagementConfig	`json:"user_management" mapstructure:"user_management"`
 	StorageMetrics StorageMetricsConfig `json:"storage_metrics" mapstructure:"storage_metrics"`
 	Security       SecurityConfig       `json:"security" mapstructure:"security"`
+	Mail           MailConfig           `json:"mail" mapstructure:"mail"`
+	Export         ExportConfig         `json:"export" mapstructure:"export"`
+	Federation     FederationConfig     `json:"federation" mapstructure:"federation"`
+	Analytics      AnalyticsConfig      `json:"analytics" mapstructure:"analytics"`
 }
@@ -8,6 +8,7 @@ import (
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 
+	"viz/internal/auth"
 	"viz/internal/entities"
 	imalog "viz/internal/logger"
 )
@@ -124,3 +125,37 @@ func BackfillOwnership(client *gorm.DB, logger *slog.Logger) {
 		logger.Error("Failed to backfill collection ownership", slog.Any("error", err))
 	}
 }
+
+// HashLegacySessionTokens moves sessions created before tokens were hashed
+// over to token_hash, so nobody is signed out, then drops the plaintext
+// token column.
+func HashLegacySessionTokens(client *gorm.DB, logger *slog.Logger) {
+	if !client.Migrator().HasColumn(&entities.SessionWithToken{}, "token") {
+		return
+	}
+
+	logger.Info("Hashing legacy session tokens...")
+
+	var legacy []struct {
+		Uid   string
+		Token string
+	}
+
+	err := client.Table("sessions").Select("uid, token").Where("token_hash IS NULL OR token_hash = ''").Scan(&legacy).Error
+	if err != nil {
+		logger.Error("Failed to read legacy session tokens", slog.Any("error", err))
+		return
+	}
+
+	for _, sess := range legacy {
+		tokenHash, _ := auth.HashSecret(sess.Token)
+		if err := client.Table("sessions").Where("uid = ?", sess.Uid).Update("token_hash", tokenHash).Error; err != nil {
+			logger.Error("Failed to hash legacy session token", slog.String("session_uid", sess.Uid), slog.Any("error", err))
+			return
+		}
+	}
+
+	if err := client.Migrator().DropColumn(&entities.SessionWithToken{}, "token"); err != nil {
+		logger.Error("Failed to drop plaintext session token column", slog.Any("error", err))
+	}
+}
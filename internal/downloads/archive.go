@@ -0,0 +1,266 @@
+package downloads
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+
+	"viz/internal/dto"
+	"viz/internal/entities"
+	"viz/internal/images"
+	"viz/internal/transform"
+)
+
+// ManifestName is the archive entry listing the images left out of it.
+const ManifestName = "manifest.json"
+
+// Manifest is written to ManifestName when an archive is missing images.
+type Manifest struct {
+	CreatedAt time.Time               `json:"created_at"`
+	FileCount int                     `json:"file_count"`
+	Skipped   []dto.ExportSkippedFile `json:"skipped"`
+}
+
+// RenderFunc renders an image with a transform, such as through the
+// transform cache.
+type RenderFunc func(params *transform.TransformParams, img entities.ImageAsset) ([]byte, error)
+
+// ArchiveOptions sets how images are written into an archive.
+type ArchiveOptions struct {
+	// Profile renders the images with Render. Without one, or with one
+	// that changes nothing, the original files are used.
+	Profile *dto.ExportProfile
+	Render  RenderFunc
+}
+
+// renderableFormats are the formats transforms can write, by the file type
+// libvips reports for an image.
+var renderableFormats = map[string]string{
+	"jpeg": "jpg",
+	"jpg":  "jpg",
+	"png":  "png",
+	"webp": "webp",
+	"avif": "avif",
+	"heif": "avif",
+}
+
+// ProfileParams works out the transform that renders img with profile. It
+// returns nil if the original file should be used as it is.
+func ProfileParams(profile *dto.ExportProfile, img entities.ImageAsset) *transform.TransformParams {
+	if profile == nil || img.ImageMetadata == nil {
+		return nil
+	}
+
+	format := string(lo.FromPtr(profile.Format))
+	keepOriginal := format == "" || format == string(dto.ExportProfileFormatOriginal)
+	if keepOriginal && lo.FromPtr(profile.LongEdge) <= 0 && profile.ColorProfile == nil && !lo.FromPtr(profile.StripMetadata) {
+		return nil
+	}
+
+	if keepOriginal {
+		var ok bool
+		if format, ok = renderableFormats[strings.ToLower(img.ImageMetadata.FileType)]; !ok {
+			format = "jpg"
+		}
+	}
+
+	params := &transform.TransformParams{
+		Format:       format,
+		LongEdge:     int64(max(lo.FromPtr(profile.LongEdge), 0)),
+		KeepMetadata: !lo.FromPtr(profile.StripMetadata),
+		Quality:      90,
+	}
+
+	if quality := lo.FromPtr(profile.Quality); quality > 0 {
+		params.Quality = int64(min(quality, 100))
+	}
+	if format == "png" {
+		// PNG is lossless, transforms take its compression level instead
+		params.Quality = 6
+	}
+
+	if colorProfile := lo.FromPtr(profile.ColorProfile); colorProfile != dto.ExportProfileColorProfileSrgb {
+		params.ColorProfile = string(colorProfile)
+	}
+
+	return params
+}
+
+// ArchiveFileName names img in an archive. template can use {name}, {date},
+// {seq} and {uid}; seq is padded to the width of total. An empty template
+// keeps the original filename. ext replaces the original extension if set.
+func ArchiveFileName(template string, img entities.ImageAsset, seq, total int, ext string) string {
+	original := filepath.Base(img.ImageMetadata.FileName)
+	name := strings.TrimSuffix(original, filepath.Ext(original))
+	if ext == "" {
+		ext = strings.TrimPrefix(filepath.Ext(original), ".")
+	}
+
+	var suffix string
+	if ext != "" {
+		suffix = "." + ext
+	}
+
+	if template == "" {
+		return name + suffix
+	}
+
+	date := img.CreatedAt
+	if img.TakenAt != nil {
+		date = *img.TakenAt
+	}
+
+	out := strings.NewReplacer(
+		"{name}", name,
+		"{date}", date.Format("2006-01-02"),
+		"{seq}", fmt.Sprintf("%0*d", len(strconv.Itoa(total)), seq),
+		"{uid}", img.Uid,
+	).Replace(template)
+
+	// Templates name files, not folders
+	out = strings.TrimSpace(strings.NewReplacer("/", "_", "\\", "_").Replace(out))
+	if out == "" || out == "." || out == ".." {
+		out = name
+	}
+
+	return out + suffix
+}
+
+// WriteArchive writes uids into zw, in the order of uids. Images that are
+// gone or can't be read are skipped rather than failing the archive; they're
+// returned with the number of images written so they can be reported.
+// onImage, if not nil, is called after each image with how many have been
+// handled.
+func WriteArchive(ctx context.Context, db *gorm.DB, zw *zip.Writer, uids []string, opts ArchiveOptions, onImage func(done int)) (int, []dto.ExportSkippedFile, error) {
+	skipped := []dto.ExportSkippedFile{}
+	if len(uids) == 0 {
+		return 0, skipped, nil
+	}
+
+	var imgs []entities.ImageAsset
+	if err := db.WithContext(ctx).Where("uid IN ? AND deleted_at IS NULL", uids).Find(&imgs).Error; err != nil {
+		return 0, nil, err
+	}
+
+	imgMap := make(map[string]entities.ImageAsset, len(imgs))
+	for _, im := range imgs {
+		imgMap[im.Uid] = im
+	}
+
+	var template string
+	if opts.Profile != nil {
+		template = lo.FromPtr(opts.Profile.FilenameTemplate)
+	}
+
+	written := 0
+	names := make(map[string]int, len(uids))
+	for i, uid := range uids {
+		if err := ctx.Err(); err != nil {
+			return written, skipped, err
+		}
+
+		imageEntity, ok := imgMap[uid]
+		if !ok || imageEntity.ImageMetadata == nil {
+			skipped = append(skipped, dto.ExportSkippedFile{Uid: uid, Reason: "Image not found"})
+		} else {
+			params := ProfileParams(opts.Profile, imageEntity)
+			if opts.Render == nil {
+				params = nil
+			}
+
+			var ext string
+			if params != nil {
+				ext = params.Format
+			}
+
+			name := uniqueArchiveName(names, ArchiveFileName(template, imageEntity, i+1, len(uids), ext))
+			if reason := writeArchiveImage(zw, imageEntity, name, params, opts.Render); reason != "" {
+				skipped = append(skipped, dto.ExportSkippedFile{Uid: uid, Name: &name, Reason: reason})
+			} else {
+				written++
+			}
+		}
+
+		if onImage != nil {
+			onImage(i + 1)
+		}
+	}
+
+	return written, skipped, nil
+}
+
+// uniqueArchiveName numbers name if an earlier file in the archive already
+// has it, since extracting the archive would overwrite one with the other.
+func uniqueArchiveName(names map[string]int, name string) string {
+	key := strings.ToLower(name)
+	names[key]++
+	if names[key] == 1 {
+		return name
+	}
+
+	ext := filepath.Ext(name)
+	numbered := fmt.Sprintf("%s_%d%s", strings.TrimSuffix(name, ext), names[key], ext)
+	return uniqueArchiveName(names, numbered)
+}
+
+// writeArchiveImage adds img to zw as name, rendered with params if they're
+// set. It returns why the image was skipped, or "" if it was written.
+func writeArchiveImage(zw *zip.Writer, img entities.ImageAsset, name string, params *transform.TransformParams, render RenderFunc) string {
+	var src io.Reader
+	if params != nil {
+		data, err := render(params, img)
+		if err != nil {
+			return "Couldn't render the image"
+		}
+		src = bytes.NewReader(data)
+	} else {
+		f, err := os.Open(images.GetImagePath(img.Uid, img.ImageMetadata.FileName))
+		if err != nil {
+			return "Original file is missing"
+		}
+		defer f.Close()
+		src = f
+	}
+
+	w, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: img.UpdatedAt,
+	})
+	if err != nil {
+		return "Couldn't add the file to the archive"
+	}
+
+	if _, err := io.Copy(w, src); err != nil {
+		return "Couldn't read the original file"
+	}
+
+	return ""
+}
+
+// WriteManifest adds a manifest of the images left out of an archive.
+func WriteManifest(zw *zip.Writer, fileCount int, skipped []dto.ExportSkippedFile) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     ManifestName,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(Manifest{CreatedAt: time.Now().UTC(), FileCount: fileCount, Skipped: skipped})
+}
@@ -0,0 +1,92 @@
+package downloads
+
+import (
+	"testing"
+	"time"
+
+	"viz/internal/dto"
+	"viz/internal/entities"
+)
+
+func testArchiveImage() entities.ImageAsset {
+	taken := time.Date(2025, 6, 14, 9, 30, 0, 0, time.UTC)
+	return entities.ImageAsset{
+		Uid:           "img1",
+		CreatedAt:     time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC),
+		TakenAt:       &taken,
+		ImageMetadata: &dto.ImageMetadata{FileName: "DSC_0042.JPG", FileType: "jpeg"},
+	}
+}
+
+func TestArchiveFileName(t *testing.T) {
+	img := testArchiveImage()
+
+	tests := []struct {
+		template string
+		seq      int
+		total    int
+		ext      string
+		want     string
+	}{
+		{"", 1, 1, "", "DSC_0042.JPG"},
+		{"", 1, 1, "webp", "DSC_0042.webp"},
+		{"{date}_{name}_{seq}", 7, 120, "jpg", "2025-06-14_DSC_0042_007.jpg"},
+		{"{uid}", 1, 1, "", "img1.JPG"},
+		{"../{name}", 1, 1, "", ".._DSC_0042.JPG"},
+		{"  ", 1, 1, "", "DSC_0042.JPG"},
+	}
+
+	for _, tt := range tests {
+		if got := ArchiveFileName(tt.template, img, tt.seq, tt.total, tt.ext); got != tt.want {
+			t.Errorf("ArchiveFileName(%q) = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+
+	img.TakenAt = nil
+	if got := ArchiveFileName("{date}", img, 1, 1, ""); got != "2026-01-02.JPG" {
+		t.Errorf("without a date taken got %q, want the upload date", got)
+	}
+}
+
+func TestUniqueArchiveName(t *testing.T) {
+	names := map[string]int{}
+	got := []string{
+		uniqueArchiveName(names, "a.jpg"),
+		uniqueArchiveName(names, "A.jpg"),
+		uniqueArchiveName(names, "a_2.jpg"),
+		uniqueArchiveName(names, "a.jpg"),
+	}
+
+	want := []string{"a.jpg", "A_2.jpg", "a_2_2.jpg", "a_3.jpg"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("name %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestProfileParams(t *testing.T) {
+	img := testArchiveImage()
+	ptr := func(v int) *int { return &v }
+	format := func(f dto.ExportProfileFormat) *dto.ExportProfileFormat { return &f }
+	strip := true
+
+	if params := ProfileParams(nil, img); params != nil {
+		t.Errorf("no profile gave %+v, want the original", params)
+	}
+
+	// The settings always fill in format and quality, which alone change nothing
+	if params := ProfileParams(&dto.ExportProfile{Format: format(dto.ExportProfileFormatOriginal), Quality: ptr(90)}, img); params != nil {
+		t.Errorf("original format gave %+v, want the original", params)
+	}
+
+	params := ProfileParams(&dto.ExportProfile{LongEdge: ptr(2048), StripMetadata: &strip}, img)
+	if params == nil || params.Format != "jpg" || params.LongEdge != 2048 || params.KeepMetadata || params.Quality != 90 {
+		t.Errorf("resizing the original format gave %+v", params)
+	}
+
+	params = ProfileParams(&dto.ExportProfile{Format: format(dto.ExportProfileFormatWebp), Quality: ptr(75)}, img)
+	if params == nil || params.Format != "webp" || params.Quality != 75 || !params.KeepMetadata || params.ColorProfile != "" {
+		t.Errorf("webp gave %+v", params)
+	}
+}
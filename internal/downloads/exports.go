@@ -0,0 +1,94 @@
+package downloads
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gorm.io/gorm"
+
+	"viz/internal/config"
+	"viz/internal/entities"
+)
+
+// ExportDirectory is where background exports are built.
+func ExportDirectory() string {
+	if dir := config.AppConfig.Export.Directory; dir != "" {
+		return dir
+	}
+
+	return filepath.Join(config.AppConfig.BaseDir, "exports")
+}
+
+// ExportPath is where the archive of the export uid is kept once built.
+func ExportPath(uid string) string {
+	return filepath.Join(ExportDirectory(), uid+".zip")
+}
+
+// ExportRetention is how long a built archive is kept.
+func ExportRetention() time.Duration {
+	hours := config.AppConfig.Export.RetentionHours
+	if hours <= 0 {
+		hours = 72
+	}
+
+	return time.Duration(hours) * time.Hour
+}
+
+// DeleteExport deletes an export and its archive.
+func DeleteExport(db *gorm.DB, export *entities.ExportArchive) error {
+	for _, path := range []string{ExportPath(export.Uid), ExportPath(export.Uid) + ".part"} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return db.Delete(export).Error
+}
+
+// DeleteExpiredExports deletes exports, and their archives, whose retention
+// period has passed.
+func DeleteExpiredExports(db *gorm.DB) (int64, error) {
+	var expired []entities.ExportArchive
+	if err := db.Where("expires_at < ?", time.Now()).Find(&expired).Error; err != nil {
+		return 0, err
+	}
+
+	var deleted int64
+	for i := range expired {
+		if err := DeleteExport(db, &expired[i]); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// StartExportCleanup starts a background goroutine that deletes expired
+// exports every interval. The goroutine will stop when ctx is canceled.
+func StartExportCleanup(ctx context.Context, logger *slog.Logger, db *gorm.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			deleted, err := DeleteExpiredExports(db.WithContext(ctx))
+			if err != nil {
+				logger.Warn("export cleanup failed", slog.Any("error", err))
+			} else if deleted > 0 {
+				logger.Debug("deleted expired exports", slog.Int64("count", deleted))
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -1,18 +1,26 @@
 package downloads
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"log/slog"
 	"net/http"
-	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 
 	"viz/internal/entities"
+	"viz/internal/uid"
 )
 
+// ErrTokenUsedUp is returned for a download with a token that has reached
+// its maximum number of uses.
+var ErrTokenUsedUp = errors.New("download token used up")
+
 // TokenOptions configures the download token creation
 type TokenOptions struct {
 	TTL           time.Duration
@@ -21,6 +29,16 @@ type TokenOptions struct {
 	ShowMetadata  bool
 	Password      string // Plain text password (will be hashed)
 	Description   string
+	// AllowProofing lets the people a collection share link is sent to
+	// pick, heart and comment on its images.
+	AllowProofing bool
+	// CollectionUid makes the token a share link for a whole collection
+	// instead of a fixed list of images.
+	CollectionUid string
+	// CreatedBy is the UID of the user the token belongs to.
+	CreatedBy string
+	// MaxUses limits how many downloads the token allows. 0 is no limit.
+	MaxUses int
 }
 
 // CreateToken stores a random opaque token (32 bytes) in the database.
@@ -47,14 +65,9 @@ func CreateTokenWithOptions(db *gorm.DB, uids []string, opts TokenOptions) (stri
 		expires = &t
 	}
 
-	var passwordHash *string
-	if opts.Password != "" {
-		hash, err := bcrypt.GenerateFromPassword([]byte(opts.Password), bcrypt.DefaultCost)
-		if err != nil {
-			return "", err
-		}
-		hashStr := string(hash)
-		passwordHash = &hashStr
+	passwordHash, err := HashPassword(opts.Password)
+	if err != nil {
+		return "", err
 	}
 
 	var description *string
@@ -62,12 +75,33 @@ func CreateTokenWithOptions(db *gorm.DB, uids []string, opts TokenOptions) (stri
 		description = &opts.Description
 	}
 
+	var collectionUid *string
+	if opts.CollectionUid != "" {
+		collectionUid = &opts.CollectionUid
+	}
+
+	var createdBy *string
+	if opts.CreatedBy != "" {
+		createdBy = &opts.CreatedBy
+	}
+
+	var maxUses *int
+	if opts.MaxUses > 0 {
+		maxUses = &opts.MaxUses
+	}
+
+	hasPassword := passwordHash != nil
 	dt := entities.DownloadToken{
 		Uid:           tok,
+		CreatedByID:   createdBy,
+		MaxUses:       maxUses,
+		HasPassword:   &hasPassword,
 		ImageUids:     uids,
+		CollectionUid: collectionUid,
 		AllowDownload: opts.AllowDownload,
 		AllowEmbed:    opts.AllowEmbed,
 		ShowMetadata:  opts.ShowMetadata,
+		AllowProofing: &opts.AllowProofing,
 		Password:      passwordHash,
 		Description:   description,
 		ExpiresAt:     expires,
@@ -80,6 +114,21 @@ func CreateTokenWithOptions(db *gorm.DB, uids []string, opts TokenOptions) (stri
 	return tok, nil
 }
 
+// HashPassword hashes a token's password, or returns nil for no password.
+func HashPassword(password string) (*string, error) {
+	if password == "" {
+		return nil, nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	hashStr := string(hash)
+	return &hashStr, nil
+}
+
 // ValidateToken checks token validity and returns associated data.
 // Returns: uids, token entity, valid flag
 func ValidateToken(db *gorm.DB, token string) ([]string, bool) {
@@ -119,31 +168,123 @@ func ValidateTokenWithPassword(db *gorm.DB, token, password string) ([]string, *
 		}
 	}
 
-	return dt.ImageUids, &dt, true
+	uids, err := TokenImageUids(db, &dt)
+	if err != nil {
+		return nil, nil, false
+	}
+
+	return uids, &dt, true
 }
 
-// ValidateEmbedAccess checks if token allows embedding based on Referer header.
-// If AllowEmbed is false, only direct access (no referer) is permitted.
-func ValidateEmbedAccess(dt *entities.DownloadToken, req *http.Request) bool {
-	if dt.AllowEmbed {
-		return true // Embedding explicitly allowed
+// TokenImageUids returns the images dt gives access to. A collection share
+// link gives access to whatever is in the collection now, so images added
+// after the link was made are included.
+func TokenImageUids(db *gorm.DB, dt *entities.DownloadToken) ([]string, error) {
+	if dt.CollectionUid == nil {
+		return dt.ImageUids, nil
 	}
 
-	// If embedding not allowed, check referer
-	referer := req.Header.Get("Referer")
-	origin := req.Header.Get("Origin")
+	var collection entities.Collection
+	if err := db.Select("uid", "images").First(&collection, "uid = ?", *dt.CollectionUid).Error; err != nil {
+		return nil, err
+	}
 
-	// Direct access (no referer/origin) is OK for downloads
-	if referer == "" && origin == "" {
-		return true
+	if collection.Images == nil {
+		return []string{}, nil
 	}
 
-	// Check if referer is from the same origin (our own domain)
-	host := req.Host
-	if strings.Contains(referer, host) || strings.Contains(origin, host) {
-		return true // Same-origin requests allowed
+	uids := make([]string, len(*collection.Images))
+	for i, img := range *collection.Images {
+		uids[i] = img.Uid
 	}
+	return uids, nil
+}
 
-	// Third-party embedding not allowed
-	return false
+// SetEmbedPolicy tells browsers whether other sites may embed what dt
+// serves. Browsers enforce it, unlike a Referer or Origin check, which any
+// client can leave out or fake. Images are embedded elsewhere through
+// signed URLs instead of the token.
+func SetEmbedPolicy(res http.ResponseWriter, dt *entities.DownloadToken) {
+	policy := "same-origin"
+	if dt.AllowEmbed {
+		policy = "cross-origin"
+	}
+
+	res.Header().Set("Cross-Origin-Resource-Policy", policy)
+}
+
+// PasswordVersion identifies dt's current password without giving it away,
+// so what was handed out under one password can stop working once it
+// changes. It is empty for tokens without a password.
+func PasswordVersion(dt *entities.DownloadToken) string {
+	if dt.Password == nil {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(*dt.Password))
+	return hex.EncodeToString(sum[:8])
+}
+
+// TouchToken counts dt being opened or downloaded with. Requests for what
+// it gives access to, such as the images of a gallery, aren't counted.
+func TouchToken(db *gorm.DB, dt *entities.DownloadToken) error {
+	return db.Model(&entities.DownloadToken{}).Where("uid = ?", dt.Uid).UpdateColumns(map[string]any{
+		"access_count": gorm.Expr("COALESCE(access_count, 0) + 1"),
+		"last_used_at": time.Now().UTC(),
+	}).Error
+}
+
+// RecordDownload counts a download of uids made with dt from ip and logs
+// it. The count and the limit are checked together, so concurrent downloads
+// can't go over MaxUses; going over returns ErrTokenUsedUp.
+func RecordDownload(db *gorm.DB, dt *entities.DownloadToken, ip string, uids []string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		counted := tx.Model(&entities.DownloadToken{}).
+			Where("uid = ? AND (max_uses IS NULL OR COALESCE(use_count, 0) < max_uses)", dt.Uid).
+			UpdateColumn("use_count", gorm.Expr("COALESCE(use_count, 0) + 1"))
+		if counted.Error != nil {
+			return counted.Error
+		}
+		if counted.RowsAffected == 0 {
+			return ErrTokenUsedUp
+		}
+
+		return tx.Create(&entities.DownloadLog{
+			Uid:       uid.MustGenerate(),
+			TokenUid:  dt.Uid,
+			Ip:        ip,
+			ImageUids: uids,
+		}).Error
+	})
+}
+
+// DeleteExpiredTokens deletes tokens whose expiry has passed.
+func DeleteExpiredTokens(db *gorm.DB) (int64, error) {
+	result := db.Where("expires_at < ?", time.Now()).Delete(&entities.DownloadToken{})
+	return result.RowsAffected, result.Error
+}
+
+// StartTokenCleanup starts a background goroutine that deletes expired
+// tokens every interval, rather than only when someone tries to use one.
+// The goroutine will stop when ctx is canceled.
+func StartTokenCleanup(ctx context.Context, logger *slog.Logger, db *gorm.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			deleted, err := DeleteExpiredTokens(db.WithContext(ctx))
+			if err != nil {
+				logger.Warn("download token cleanup failed", slog.Any("error", err))
+			} else if deleted > 0 {
+				logger.Debug("deleted expired download tokens", slog.Int64("count", deleted))
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
 }
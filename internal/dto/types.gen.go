@@ -14,6 +14,20 @@ const (
 	CookieAuthScopes = "CookieAuth.Scopes"
 )
 
+// Defines values for APIKeyQuotaPeriod.
+const (
+	APIKeyQuotaPeriodDay   APIKeyQuotaPeriod = "day"
+	APIKeyQuotaPeriodHour  APIKeyQuotaPeriod = "hour"
+	APIKeyQuotaPeriodMonth APIKeyQuotaPeriod = "month"
+)
+
+// Defines values for APIKeyCreateQuotaPeriod.
+const (
+	APIKeyCreateQuotaPeriodDay   APIKeyCreateQuotaPeriod = "day"
+	APIKeyCreateQuotaPeriodHour  APIKeyCreateQuotaPeriod = "hour"
+	APIKeyCreateQuotaPeriodMonth APIKeyCreateQuotaPeriod = "month"
+)
+
 // Defines values for AdminUserCreateRole.
 const (
 	AdminUserCreateRoleAdmin      AdminUserCreateRole = "admin"
@@ -30,6 +44,116 @@ const (
 	AdminUserUpdateRoleUser       AdminUserUpdateRole = "user"
 )
 
+// Defines values for CollectionDetailResponseRole.
+const (
+	CollectionDetailResponseRoleContributor CollectionDetailResponseRole = "contributor"
+	CollectionDetailResponseRoleEditor      CollectionDetailResponseRole = "editor"
+	CollectionDetailResponseRoleOwner       CollectionDetailResponseRole = "owner"
+	CollectionDetailResponseRoleViewer      CollectionDetailResponseRole = "viewer"
+)
+
+// Defines values for CollectionMirrorStatus.
+const (
+	CollectionMirrorStatusFailed  CollectionMirrorStatus = "failed"
+	CollectionMirrorStatusQueued  CollectionMirrorStatus = "queued"
+	CollectionMirrorStatusRunning CollectionMirrorStatus = "running"
+	CollectionMirrorStatusSynced  CollectionMirrorStatus = "synced"
+)
+
+// Defines values for CollectionShareRole.
+const (
+	CollectionShareRoleContributor CollectionShareRole = "contributor"
+	CollectionShareRoleEditor      CollectionShareRole = "editor"
+	CollectionShareRoleViewer      CollectionShareRole = "viewer"
+)
+
+// Defines values for CollectionShareCreateRole.
+const (
+	CollectionShareCreateRoleContributor CollectionShareCreateRole = "contributor"
+	CollectionShareCreateRoleEditor      CollectionShareCreateRole = "editor"
+	CollectionShareCreateRoleViewer      CollectionShareCreateRole = "viewer"
+)
+
+// Defines values for CollectionShareUpdateRole.
+const (
+	CollectionShareUpdateRoleContributor CollectionShareUpdateRole = "contributor"
+	CollectionShareUpdateRoleEditor      CollectionShareUpdateRole = "editor"
+	CollectionShareUpdateRoleViewer      CollectionShareUpdateRole = "viewer"
+)
+
+// Defines values for ExportArchiveStatus.
+const (
+	ExportArchiveStatusCompleted ExportArchiveStatus = "completed"
+	ExportArchiveStatusFailed    ExportArchiveStatus = "failed"
+	ExportArchiveStatusQueued    ExportArchiveStatus = "queued"
+	ExportArchiveStatusRunning   ExportArchiveStatus = "running"
+)
+
+// Defines values for ExportProfileColorProfile.
+const (
+	ExportProfileColorProfileOriginal ExportProfileColorProfile = "original"
+	ExportProfileColorProfileP3       ExportProfileColorProfile = "p3"
+	ExportProfileColorProfileSrgb     ExportProfileColorProfile = "srgb"
+)
+
+// Defines values for ExportProfileFormat.
+const (
+	ExportProfileFormatAvif     ExportProfileFormat = "avif"
+	ExportProfileFormatJpg      ExportProfileFormat = "jpg"
+	ExportProfileFormatOriginal ExportProfileFormat = "original"
+	ExportProfileFormatPng      ExportProfileFormat = "png"
+	ExportProfileFormatWebp     ExportProfileFormat = "webp"
+)
+
+// Defines values for FederationHandshakeStatus.
+const (
+	FederationHandshakeStatusBlocked FederationHandshakeStatus = "blocked"
+	FederationHandshakeStatusPending FederationHandshakeStatus = "pending"
+	FederationHandshakeStatusTrusted FederationHandshakeStatus = "trusted"
+)
+
+// Defines values for FederationPeerRemoteStatus.
+const (
+	FederationPeerRemoteStatusBlocked FederationPeerRemoteStatus = "blocked"
+	FederationPeerRemoteStatusPending FederationPeerRemoteStatus = "pending"
+	FederationPeerRemoteStatusTrusted FederationPeerRemoteStatus = "trusted"
+	FederationPeerRemoteStatusUnknown FederationPeerRemoteStatus = "unknown"
+)
+
+// Defines values for FederationPeerStatus.
+const (
+	FederationPeerStatusBlocked FederationPeerStatus = "blocked"
+	FederationPeerStatusPending FederationPeerStatus = "pending"
+	FederationPeerStatusTrusted FederationPeerStatus = "trusted"
+)
+
+// Defines values for FederationPeerUpdateStatus.
+const (
+	FederationPeerUpdateStatusBlocked FederationPeerUpdateStatus = "blocked"
+	FederationPeerUpdateStatusTrusted FederationPeerUpdateStatus = "trusted"
+)
+
+// Defines values for GroupMemberRole.
+const (
+	GroupMemberRoleMember GroupMemberRole = "member"
+	GroupMemberRoleOwner  GroupMemberRole = "owner"
+	GroupMemberRoleViewer GroupMemberRole = "viewer"
+)
+
+// Defines values for GroupMemberCreateRole.
+const (
+	GroupMemberCreateRoleMember GroupMemberCreateRole = "member"
+	GroupMemberCreateRoleOwner  GroupMemberCreateRole = "owner"
+	GroupMemberCreateRoleViewer GroupMemberCreateRole = "viewer"
+)
+
+// Defines values for GroupMemberUpdateRole.
+const (
+	Member GroupMemberUpdateRole = "member"
+	Owner  GroupMemberUpdateRole = "owner"
+	Viewer GroupMemberUpdateRole = "viewer"
+)
+
 // Defines values for ImageMetadataLabel.
 const (
 	ImageMetadataLabelBlue   ImageMetadataLabel = "Blue"
@@ -54,6 +178,43 @@ const (
 	ImageUpdateImageMetadataLabelYellow ImageUpdateImageMetadataLabel = "Yellow"
 )
 
+// Defines values for OAuthRevokeRequestTokenTypeHint.
+const (
+	OAuthRevokeRequestTokenTypeHintAccessToken  OAuthRevokeRequestTokenTypeHint = "access_token"
+	OAuthRevokeRequestTokenTypeHintRefreshToken OAuthRevokeRequestTokenTypeHint = "refresh_token"
+)
+
+// Defines values for OAuthTokenRequestGrantType.
+const (
+	OAuthTokenRequestGrantTypeAuthorizationCode OAuthTokenRequestGrantType = "authorization_code"
+	OAuthTokenRequestGrantTypeRefreshToken      OAuthTokenRequestGrantType = "refresh_token"
+)
+
+// Defines values for OEmbedType.
+const (
+	Link  OEmbedType = "link"
+	Photo OEmbedType = "photo"
+)
+
+// Defines values for OEmbedVersion.
+const (
+	N10 OEmbedVersion = "1.0"
+)
+
+// Defines values for ResolvedURIPeerStatus.
+const (
+	Blocked ResolvedURIPeerStatus = "blocked"
+	Pending ResolvedURIPeerStatus = "pending"
+	Trusted ResolvedURIPeerStatus = "trusted"
+	Unknown ResolvedURIPeerStatus = "unknown"
+)
+
+// Defines values for ResolvedURIResourceType.
+const (
+	Collections ResolvedURIResourceType = "collections"
+	Images      ResolvedURIResourceType = "images"
+)
+
 // Defines values for SettingDefaultValueType.
 const (
 	Boolean SettingDefaultValueType = "boolean"
@@ -63,6 +224,16 @@ const (
 	String  SettingDefaultValueType = "string"
 )
 
+// Defines values for SignedImageURLCreateFormat.
+const (
+	SignedImageURLCreateFormatAvif SignedImageURLCreateFormat = "avif"
+	SignedImageURLCreateFormatHeif SignedImageURLCreateFormat = "heif"
+	SignedImageURLCreateFormatJpeg SignedImageURLCreateFormat = "jpeg"
+	SignedImageURLCreateFormatJpg  SignedImageURLCreateFormat = "jpg"
+	SignedImageURLCreateFormatPng  SignedImageURLCreateFormat = "png"
+	SignedImageURLCreateFormatWebp SignedImageURLCreateFormat = "webp"
+)
+
 // Defines values for UserRole.
 const (
 	UserRoleAdmin      UserRole = "admin"
@@ -99,12 +270,12 @@ const (
 
 // Defines values for GetImageFileParamsFormat.
 const (
-	Avif GetImageFileParamsFormat = "avif"
-	Heif GetImageFileParamsFormat = "heif"
-	Jpeg GetImageFileParamsFormat = "jpeg"
-	Jpg  GetImageFileParamsFormat = "jpg"
-	Png  GetImageFileParamsFormat = "png"
-	Webp GetImageFileParamsFormat = "webp"
+	GetImageFileParamsFormatAvif GetImageFileParamsFormat = "avif"
+	GetImageFileParamsFormatHeif GetImageFileParamsFormat = "heif"
+	GetImageFileParamsFormatJpeg GetImageFileParamsFormat = "jpeg"
+	GetImageFileParamsFormatJpg  GetImageFileParamsFormat = "jpg"
+	GetImageFileParamsFormatPng  GetImageFileParamsFormat = "png"
+	GetImageFileParamsFormatWebp GetImageFileParamsFormat = "webp"
 )
 
 // Defines values for GetImageFileParamsDownload.
@@ -112,6 +283,11 @@ const (
 	N1 GetImageFileParamsDownload = "1"
 )
 
+// Defines values for GetImageFileParamsBind.
+const (
+	Ip GetImageFileParamsBind = "ip"
+)
+
 // Defines values for ListJobsParamsStatus.
 const (
 	Cancelled ListJobsParamsStatus = "cancelled"
@@ -123,6 +299,12 @@ const (
 
 // APIKey defines model for APIKey.
 type APIKey struct {
+	// AllowedCidrs IP ranges the key may be used from. Empty means anywhere
+	AllowedCidrs *[]string `json:"allowed_cidrs,omitempty"`
+
+	// AllowedCollections UIDs of the collections the key is limited to. Empty means it isn't limited
+	AllowedCollections *[]string `json:"allowed_collections,omitempty"`
+
 	// CreatedAt Creation time
 	CreatedAt time.Time `json:"created_at"`
 
@@ -141,6 +323,24 @@ type APIKey struct {
 	// Name API Key name
 	Name *string `json:"name,omitempty"`
 
+	// QuotaLimit Requests allowed per quota period. Null means unlimited
+	QuotaLimit *int `json:"quota_limit"`
+
+	// QuotaPeriod Period the quota resets after, in UTC
+	QuotaPeriod *APIKeyQuotaPeriod `json:"quota_period"`
+
+	// QuotaPeriodStart Start of the quota period quota_used counts
+	QuotaPeriodStart *time.Time `json:"quota_period_start"`
+
+	// QuotaUsed Requests made in the current quota period
+	QuotaUsed *int `json:"quota_used,omitempty"`
+
+	// ReadOnly Only allows GET and HEAD requests, even when the key belongs to an admin
+	ReadOnly *bool `json:"read_only,omitempty"`
+
+	// RequestCount Requests ever made with the key
+	RequestCount *int64 `json:"request_count,omitempty"`
+
 	// Revoked Is revoked
 	Revoked bool `json:"revoked"`
 
@@ -158,8 +358,17 @@ type APIKey struct {
 	User      *User     `json:"user,omitempty"`
 }
 
+// APIKeyQuotaPeriod Period the quota resets after, in UTC
+type APIKeyQuotaPeriod string
+
 // APIKeyCreate defines model for APIKeyCreate.
 type APIKeyCreate struct {
+	// AllowedCidrs IP ranges or addresses the key may be used from
+	AllowedCidrs *[]string `json:"allowed_cidrs,omitempty"`
+
+	// AllowedCollections UIDs of collections to limit the key to
+	AllowedCollections *[]string `json:"allowed_collections,omitempty"`
+
 	// Description API Key description
 	Description *string `json:"description"`
 
@@ -169,10 +378,22 @@ type APIKeyCreate struct {
 	// Name API Key name
 	Name *string `json:"name,omitempty"`
 
+	// QuotaLimit Requests allowed per quota period. Requires quota_period
+	QuotaLimit *int `json:"quota_limit"`
+
+	// QuotaPeriod Period the quota resets after
+	QuotaPeriod *APIKeyCreateQuotaPeriod `json:"quota_period"`
+
+	// ReadOnly Only allow GET and HEAD requests
+	ReadOnly *bool `json:"read_only,omitempty"`
+
 	// Scopes List of scopes
 	Scopes *[]string `json:"scopes,omitempty"`
 }
 
+// APIKeyCreateQuotaPeriod Period the quota resets after
+type APIKeyCreateQuotaPeriod string
+
 // APIKeyCreateResponse defines model for APIKeyCreateResponse.
 type APIKeyCreateResponse struct {
 	// ConsumerKey The consumer key (secret)
@@ -239,6 +460,72 @@ type AdminUserUpdate struct {
 // AdminUserUpdateRole User role
 type AdminUserUpdateRole string
 
+// AnalyticsImageStat defines model for AnalyticsImageStat.
+type AnalyticsImageStat struct {
+	Downloads  int64      `json:"downloads"`
+	ImagePaths ImagePaths `json:"image_paths"`
+	ImageUid   string     `json:"image_uid"`
+	Name       string     `json:"name"`
+	Views      int64      `json:"views"`
+
+	// Visitors Unique visitors of each day added up, so someone coming back on another day counts again. 0 if IP hashing is off
+	Visitors int64 `json:"visitors"`
+}
+
+// AnalyticsShareStat defines model for AnalyticsShareStat.
+type AnalyticsShareStat struct {
+	// CollectionUid Collection the share link is for, if it is one
+	CollectionUid *string `json:"collection_uid"`
+	Description   *string `json:"description"`
+	Downloads     int64   `json:"downloads"`
+	TokenUid      string  `json:"token_uid"`
+	Views         int64   `json:"views"`
+
+	// Visitors Unique visitors of each day added up, so someone coming back on another day counts again. 0 if IP hashing is off
+	Visitors int64 `json:"visitors"`
+}
+
+// AnalyticsShareStats defines model for AnalyticsShareStats.
+type AnalyticsShareStats struct {
+	// From First day, as YYYY-MM-DD
+	From  string               `json:"from"`
+	Items []AnalyticsShareStat `json:"items"`
+
+	// To Last day, as YYYY-MM-DD
+	To string `json:"to"`
+}
+
+// AnalyticsTimeSeries defines model for AnalyticsTimeSeries.
+type AnalyticsTimeSeries struct {
+	// From First day, as YYYY-MM-DD
+	From   string                     `json:"from"`
+	Points []AnalyticsTimeSeriesPoint `json:"points"`
+
+	// To Last day, as YYYY-MM-DD
+	To string `json:"to"`
+}
+
+// AnalyticsTimeSeriesPoint defines model for AnalyticsTimeSeriesPoint.
+type AnalyticsTimeSeriesPoint struct {
+	// Date Day, as YYYY-MM-DD
+	Date      string `json:"date"`
+	Downloads int64  `json:"downloads"`
+	Views     int64  `json:"views"`
+
+	// Visitors Unique visitors of each day added up, so someone coming back on another day counts again. 0 if IP hashing is off
+	Visitors int64 `json:"visitors"`
+}
+
+// AnalyticsTopImages defines model for AnalyticsTopImages.
+type AnalyticsTopImages struct {
+	// From First day, as YYYY-MM-DD
+	From  string               `json:"from"`
+	Items []AnalyticsImageStat `json:"items"`
+
+	// To Last day, as YYYY-MM-DD
+	To string `json:"to"`
+}
+
 // CacheConfig defines model for CacheConfig.
 type CacheConfig struct {
 	// GcEnabled GC enabled
@@ -281,10 +568,16 @@ type Collection struct {
 	// Images List of images
 	Images *[]CollectionImage `json:"images,omitempty"`
 
+	// MirrorUid Mirror keeping this collection in sync with one on another server. Mirrored collections are read-only
+	MirrorUid *string `json:"mirror_uid"`
+
 	// Name Collection name
 	Name  string `json:"name"`
 	Owner *User  `json:"owner,omitempty"`
 
+	// OwnerGroup A team of users who own images and collections together.
+	OwnerGroup *Group `json:"owner_group,omitempty"`
+
 	// Private Is private
 	Private   *bool       `json:"private"`
 	Thumbnail *ImageAsset `json:"thumbnail,omitempty"`
@@ -326,8 +619,11 @@ type CollectionDetailResponse struct {
 	Owner *User  `json:"owner,omitempty"`
 
 	// Private Is private
-	Private   *bool       `json:"private"`
-	Thumbnail *ImageAsset `json:"thumbnail,omitempty"`
+	Private *bool `json:"private"`
+
+	// Role The caller's role on the collection. Absent when the caller can only see it because it is public.
+	Role      *CollectionDetailResponseRole `json:"role,omitempty"`
+	Thumbnail *ImageAsset                   `json:"thumbnail,omitempty"`
 
 	// Uid Collection UID
 	Uid string `json:"uid"`
@@ -336,6 +632,9 @@ type CollectionDetailResponse struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// CollectionDetailResponseRole The caller's role on the collection. Absent when the caller can only see it because it is public.
+type CollectionDetailResponseRole string
+
 // CollectionImage defines model for CollectionImage.
 type CollectionImage struct {
 	// AddedAt Added timestamp
@@ -370,6 +669,98 @@ type CollectionListResponse struct {
 	Prev *string `json:"prev,omitempty"`
 }
 
+// CollectionMirror A local collection kept in sync with a public collection on a peer
+type CollectionMirror struct {
+	// CollectionUid Local read-only collection
+	CollectionUid string `json:"collection_uid"`
+
+	// CreatedAt Creation time
+	CreatedAt time.Time `json:"created_at"`
+	CreatedBy *User     `json:"created_by,omitempty"`
+
+	// Error Why the last sync failed
+	Error        *string         `json:"error,omitempty"`
+	Images       []MirroredImage `json:"images"`
+	LastSyncedAt *time.Time      `json:"last_synced_at,omitempty"`
+	PeerUid      string          `json:"peer_uid"`
+
+	// RemoteUri viz URI of the remote collection
+	RemoteUri string                 `json:"remote_uri"`
+	Status    CollectionMirrorStatus `json:"status"`
+	Uid       string                 `json:"uid"`
+
+	// UpdatedAt Update time
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CollectionMirrorStatus defines model for CollectionMirror.Status.
+type CollectionMirrorStatus string
+
+// CollectionMirrorCreate defines model for CollectionMirrorCreate.
+type CollectionMirrorCreate struct {
+	// Uri viz URI of a public collection on a trusted peer
+	Uri string `json:"uri"`
+}
+
+// CollectionMirrorList defines model for CollectionMirrorList.
+type CollectionMirrorList struct {
+	Items []CollectionMirror `json:"items"`
+}
+
+// CollectionShare Grants a user, or everyone in a group, a role on a collection that isn't theirs.
+type CollectionShare struct {
+	// CollectionUid UID of the shared collection
+	CollectionUid string `json:"collection_uid"`
+
+	// CreatedAt Creation time
+	CreatedAt time.Time `json:"created_at"`
+
+	// Group A team of users who own images and collections together.
+	Group *Group `json:"group,omitempty"`
+
+	// Role viewer can see the collection and its images. contributor can also add images and remove the ones they added. editor can also change the collection's details and remove any image.
+	Role CollectionShareRole `json:"role"`
+
+	// Uid Share UID
+	Uid string `json:"uid"`
+
+	// UpdatedAt Update time
+	UpdatedAt time.Time `json:"updated_at"`
+	User      *User     `json:"user,omitempty"`
+}
+
+// CollectionShareRole viewer can see the collection and its images. contributor can also add images and remove the ones they added. editor can also change the collection's details and remove any image.
+type CollectionShareRole string
+
+// CollectionShareCreate defines model for CollectionShareCreate.
+type CollectionShareCreate struct {
+	// GroupUid UID of the group to share with. Give either this or user_uid.
+	GroupUid *string `json:"group_uid,omitempty"`
+
+	// Role Role to grant
+	Role CollectionShareCreateRole `json:"role"`
+
+	// UserUid UID of the user to share with. Give either this or group_uid.
+	UserUid *string `json:"user_uid,omitempty"`
+}
+
+// CollectionShareCreateRole Role to grant
+type CollectionShareCreateRole string
+
+// CollectionShareList defines model for CollectionShareList.
+type CollectionShareList struct {
+	Items []CollectionShare `json:"items"`
+}
+
+// CollectionShareUpdate defines model for CollectionShareUpdate.
+type CollectionShareUpdate struct {
+	// Role New role
+	Role CollectionShareUpdateRole `json:"role"`
+}
+
+// CollectionShareUpdateRole New role
+type CollectionShareUpdateRole string
+
 // CollectionUpdate defines model for CollectionUpdate.
 type CollectionUpdate struct {
 	// Description Collection description
@@ -381,6 +772,9 @@ type CollectionUpdate struct {
 	// Name Collection name
 	Name *string `json:"name,omitempty"`
 
+	// OwnerGroupUID UID of the group to own the collection alongside its owner. An empty string takes it away from its group.
+	OwnerGroupUID *string `json:"ownerGroupUID,omitempty"`
+
 	// OwnerUID Owner UID
 	OwnerUID *string `json:"ownerUID,omitempty"`
 
@@ -451,25 +845,63 @@ type DeleteImagesResponse struct {
 	Error *string `json:"error,omitempty"`
 }
 
+// DownloadLog A download made with a download token or share link.
+type DownloadLog struct {
+	// CreatedAt When the download started
+	CreatedAt time.Time `json:"created_at"`
+
+	// ImageUids Images downloaded
+	ImageUids []string `json:"image_uids"`
+
+	// Ip Address the download came from
+	Ip       string `json:"ip"`
+	TokenUid string `json:"token_uid"`
+	Uid      string `json:"uid"`
+
+	// UpdatedAt Update time
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DownloadLogList defines model for DownloadLogList.
+type DownloadLogList struct {
+	Count  int           `json:"count"`
+	Items  []DownloadLog `json:"items"`
+	Limit  int           `json:"limit"`
+	Offset int           `json:"offset"`
+}
+
 // DownloadRequest defines model for DownloadRequest.
 type DownloadRequest struct {
 	// FileName Desired filename for the archive
 	FileName *string `json:"file_name,omitempty"`
 
+	// Profile How images are rendered into an archive. Format and quality default to the image_download_format and image_download_quality settings. With the original format and nothing else set, the original files are used
+	Profile *ExportProfile `json:"profile,omitempty"`
+
 	// Uids List of UIDs to download
 	Uids []string `json:"uids"`
 }
 
 // DownloadToken Persistent download token with granular access controls
 type DownloadToken struct {
+	// AccessCount Times the token has been opened or downloaded with. The images of a gallery loading aren't counted
+	AccessCount *int64 `json:"access_count,omitempty"`
+
 	// AllowDownload Whether downloads are permitted with this token
 	AllowDownload bool `json:"allow_download"`
 
 	// AllowEmbed Whether embedding on external sites is allowed (false prevents hotlinking)
 	AllowEmbed bool `json:"allow_embed"`
 
+	// AllowProofing Whether share link recipients can pick, heart and comment on images
+	AllowProofing *bool `json:"allow_proofing,omitempty"`
+
+	// CollectionUid Collection this token shares. Its images are looked up each time the token is used
+	CollectionUid *string `json:"collection_uid"`
+
 	// CreatedAt When this token was created
 	CreatedAt time.Time `json:"created_at"`
+	CreatedBy *User     `json:"created_by,omitempty"`
 
 	// Description Optional description of this download link
 	Description *string `json:"description"`
@@ -477,10 +909,19 @@ type DownloadToken struct {
 	// ExpiresAt When this token expires (null for no expiry)
 	ExpiresAt *time.Time `json:"expires_at"`
 
-	// ImageUids Array of authorized image UIDs
+	// HasPassword Whether the token needs a password
+	HasPassword *bool `json:"has_password,omitempty"`
+
+	// ImageUids Array of authorized image UIDs. Empty for collection share links
 	ImageUids []string `json:"image_uids"`
 
-	// Password Optional bcrypt hash of password (null if no password protection)
+	// LastUsedAt When the token was last opened or downloaded with
+	LastUsedAt *time.Time `json:"last_used_at"`
+
+	// MaxUses Downloads allowed before the token stops working (null for no limit)
+	MaxUses *int `json:"max_uses"`
+
+	// Password Optional bcrypt hash of password (null if no password protection). Never sent to clients
 	Password *string `json:"password"`
 
 	// ShowMetadata Whether to include EXIF and metadata in responses
@@ -491,6 +932,38 @@ type DownloadToken struct {
 
 	// UpdatedAt When this token was last updated
 	UpdatedAt time.Time `json:"updated_at"`
+
+	// UseCount Downloads made with the token
+	UseCount *int `json:"use_count,omitempty"`
+}
+
+// DownloadTokenList defines model for DownloadTokenList.
+type DownloadTokenList struct {
+	Items []DownloadToken `json:"items"`
+}
+
+// DownloadTokenUpdate defines model for DownloadTokenUpdate.
+type DownloadTokenUpdate struct {
+	AllowDownload *bool   `json:"allow_download,omitempty"`
+	AllowEmbed    *bool   `json:"allow_embed,omitempty"`
+	AllowProofing *bool   `json:"allow_proofing,omitempty"`
+	Description   *string `json:"description,omitempty"`
+
+	// ExpiresIn Seconds from now until the token expires. 0 removes the expiry
+	ExpiresIn *int `json:"expires_in,omitempty"`
+
+	// MaxUses Downloads allowed in total. 0 removes the limit
+	MaxUses *int `json:"max_uses,omitempty"`
+
+	// Password New password. An empty string removes the password
+	Password     *string `json:"password,omitempty"`
+	ShowMetadata *bool   `json:"show_metadata,omitempty"`
+}
+
+// EmailVerifyRequest defines model for EmailVerifyRequest.
+type EmailVerifyRequest struct {
+	// Token Token from the verification link
+	Token string `json:"token"`
 }
 
 // ErrorResponse defines model for ErrorResponse.
@@ -520,92 +993,363 @@ type EventRecord struct {
 	Timestamp time.Time `json:"timestamp"`
 }
 
-// ImageAsset defines model for ImageAsset.
-type ImageAsset struct {
+// ExportArchive A ZIP archive built to storage by a background job.
+type ExportArchive struct {
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+
 	// CreatedAt Creation time
 	CreatedAt time.Time `json:"created_at"`
+	CreatedBy *User     `json:"created_by,omitempty"`
 
-	// Description Image description
-	Description *string    `json:"description,omitempty"`
-	Exif        *ImageEXIF `json:"exif,omitempty"`
+	// Error Why the build failed
+	Error *string `json:"error,omitempty"`
 
-	// Favourited Is favourited
-	Favourited *bool `json:"favourited,omitempty"`
+	// ExpiresAt When the archive is removed
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 
-	// Height Image height
-	Height        int32          `json:"height"`
-	ImageMetadata *ImageMetadata `json:"image_metadata,omitempty"`
-	ImagePaths    ImagePaths     `json:"image_paths"`
+	// FileCount Images written to the archive
+	FileCount *int   `json:"file_count,omitempty"`
+	FileName  string `json:"file_name"`
 
-	// Name Image name
-	Name  string `json:"name"`
-	Owner *User  `json:"owner,omitempty"`
+	// ImageUids Images asked for, in archive order
+	ImageUids []string `json:"image_uids"`
 
-	// Private Is private
-	Private bool `json:"private"`
+	// JobUid Worker job building the archive. Its WebSocket events carry this as jobId
+	JobUid *string `json:"job_uid,omitempty"`
 
-	// Processed Is processed
-	Processed bool `json:"processed"`
+	// Profile How images are rendered into an archive. Format and quality default to the image_download_format and image_download_quality settings. With the original format and nothing else set, the original files are used
+	Profile *ExportProfile `json:"profile,omitempty"`
 
-	// TakenAt Taken time
-	TakenAt *time.Time `json:"taken_at"`
+	// Progress Percentage of images processed
+	Progress int `json:"progress"`
 
-	// Uid Image UID
-	Uid string `json:"uid"`
+	// Size Archive size in bytes
+	Size *int64 `json:"size,omitempty"`
 
-	// UpdatedAt Update time
-	UpdatedAt  time.Time `json:"updated_at"`
-	UploadedBy *User     `json:"uploaded_by,omitempty"`
+	// Skipped Images left out of the archive. They are also listed in the archive's manifest.json
+	Skipped *[]ExportSkippedFile `json:"skipped,omitempty"`
+	Status  ExportArchiveStatus  `json:"status"`
+	Uid     string               `json:"uid"`
 
-	// Width Image width
-	Width int32 `json:"width"`
+	// UpdatedAt Update time
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
-// ImageEXIF defines model for ImageEXIF.
-type ImageEXIF struct {
-	// Aperture Aperture
-	Aperture *string `json:"aperture,omitempty"`
+// ExportArchiveStatus defines model for ExportArchive.Status.
+type ExportArchiveStatus string
 
-	// Copyright Copyright
-	Copyright *string `json:"copyright,omitempty"`
+// ExportArchiveList defines model for ExportArchiveList.
+type ExportArchiveList struct {
+	Items []ExportArchive `json:"items"`
+}
 
-	// DateTime Date and time
-	DateTime *string `json:"date_time,omitempty"`
+// ExportCreate Images to export. Give either uids or collection_uid
+type ExportCreate struct {
+	// CollectionUid Export every image in a collection instead of uids
+	CollectionUid *string `json:"collection_uid,omitempty"`
 
-	// DateTimeOriginal Original date and time
-	DateTimeOriginal *string `json:"date_time_original,omitempty"`
+	// FileName Filename for the archive
+	FileName *string `json:"file_name,omitempty"`
 
-	// DigitalZoomRatio Digital zoom ratio
-	DigitalZoomRatio *string `json:"digital_zoom_ratio,omitempty"`
+	// Profile How images are rendered into an archive. Format and quality default to the image_download_format and image_download_quality settings. With the original format and nothing else set, the original files are used
+	Profile *ExportProfile `json:"profile,omitempty"`
 
-	// ExifVersion EXIF version
-	ExifVersion *string `json:"exif_version,omitempty"`
+	// Uids Images to put in the archive
+	Uids *[]string `json:"uids,omitempty"`
+}
 
-	// ExposureBiasValue Exposure bias value
-	ExposureBiasValue *string `json:"exposure_bias_value,omitempty"`
+// ExportProfile How images are rendered into an archive. Format and quality default to the image_download_format and image_download_quality settings. With the original format and nothing else set, the original files are used
+type ExportProfile struct {
+	// ColorProfile Color profile to convert images to. original keeps each image's own
+	ColorProfile *ExportProfileColorProfile `json:"color_profile,omitempty"`
 
-	// ExposureMode Exposure mode
-	ExposureMode *string `json:"exposure_mode,omitempty"`
+	// FilenameTemplate Names of the files in the archive. {name} is the original filename without its extension, {date} the date taken (or uploaded) as YYYY-MM-DD, {seq} the position in the archive and {uid} the image UID. The extension is added. Defaults to the original filename
+	FilenameTemplate *string `json:"filename_template,omitempty"`
 
-	// ExposureProgram Exposure program
-	ExposureProgram *string `json:"exposure_program,omitempty"`
+	// Format File format. original keeps each image's own format
+	Format *ExportProfileFormat `json:"format,omitempty"`
 
-	// ExposureTime Exposure time
-	ExposureTime *string `json:"exposure_time,omitempty"`
+	// LongEdge Shrink images so their longer side is at most this many pixels (0 for full size)
+	LongEdge *int `json:"long_edge,omitempty"`
 
-	// ExposureValue Exposure value
-	ExposureValue *string `json:"exposure_value,omitempty"`
+	// Quality Quality for lossy formats
+	Quality *int `json:"quality,omitempty"`
 
-	// FNumber F-number
-	FNumber *string `json:"f_number,omitempty"`
+	// StripMetadata Remove EXIF, XMP and IPTC metadata (default false)
+	StripMetadata *bool `json:"strip_metadata,omitempty"`
+}
 
-	// Flash Flash fired
-	Flash *int `json:"flash,omitempty"`
+// ExportProfileColorProfile Color profile to convert images to. original keeps each image's own
+type ExportProfileColorProfile string
 
-	// FocalLength Focal length
-	FocalLength *string `json:"focal_length,omitempty"`
+// ExportProfileFormat File format. original keeps each image's own format
+type ExportProfileFormat string
 
-	// FocalLengthIn35mmFormat Focal length in 35mm format
+// ExportSkippedFile An image left out of an archive
+type ExportSkippedFile struct {
+	// Name The image's filename, if it was found
+	Name *string `json:"name,omitempty"`
+
+	// Reason Why the image was skipped
+	Reason string `json:"reason"`
+	Uid    string `json:"uid"`
+}
+
+// FederationHandshake What a server tells a peer about itself in a handshake, sent both ways
+type FederationHandshake struct {
+	// Server URL of the server sending this
+	Server string `json:"server"`
+
+	// Status Whether the server sending this trusts the other
+	Status FederationHandshakeStatus `json:"status"`
+}
+
+// FederationHandshakeStatus Whether the server sending this trusts the other
+type FederationHandshakeStatus string
+
+// FederationPeer Another Viz server this one knows of
+type FederationPeer struct {
+	// CreatedAt Creation time
+	CreatedAt          time.Time  `json:"created_at"`
+	FederationEndpoint string     `json:"federation_endpoint"`
+	LastHandshakeAt    *time.Time `json:"last_handshake_at,omitempty"`
+	Name               string     `json:"name"`
+
+	// PublicKey Base64 Ed25519 key the peer signs requests with
+	PublicKey string `json:"public_key"`
+
+	// RemoteStatus Whether the peer trusts this server, as of the last handshake
+	RemoteStatus FederationPeerRemoteStatus `json:"remote_status"`
+
+	// Status Whether this server trusts the peer. Only trusted peers can fetch collections, and only their collections can be mirrored
+	Status FederationPeerStatus `json:"status"`
+	Uid    string               `json:"uid"`
+
+	// UpdatedAt Update time
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Url The peer's origin, which identifies it
+	Url string `json:"url"`
+}
+
+// FederationPeerRemoteStatus Whether the peer trusts this server, as of the last handshake
+type FederationPeerRemoteStatus string
+
+// FederationPeerStatus Whether this server trusts the peer. Only trusted peers can fetch collections, and only their collections can be mirrored
+type FederationPeerStatus string
+
+// FederationPeerCreate defines model for FederationPeerCreate.
+type FederationPeerCreate struct {
+	// Url The peer's origin, such as https://photos.example.com
+	Url string `json:"url"`
+}
+
+// FederationPeerList defines model for FederationPeerList.
+type FederationPeerList struct {
+	Items []FederationPeer `json:"items"`
+}
+
+// FederationPeerUpdate defines model for FederationPeerUpdate.
+type FederationPeerUpdate struct {
+	Status FederationPeerUpdateStatus `json:"status"`
+}
+
+// FederationPeerUpdateStatus defines model for FederationPeerUpdate.Status.
+type FederationPeerUpdateStatus string
+
+// Group A team of users who own images and collections together.
+type Group struct {
+	// CreatedAt Creation time
+	CreatedAt time.Time `json:"created_at"`
+
+	// Description What the group is for
+	Description *string `json:"description,omitempty"`
+
+	// Name Group name
+	Name string `json:"name"`
+
+	// Uid Group UID
+	Uid string `json:"uid"`
+
+	// UpdatedAt Update time
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// GroupCreate defines model for GroupCreate.
+type GroupCreate struct {
+	// Description What the group is for
+	Description *string `json:"description,omitempty"`
+
+	// Name Group name
+	Name string `json:"name"`
+}
+
+// GroupList defines model for GroupList.
+type GroupList struct {
+	Items []Group `json:"items"`
+}
+
+// GroupMember A user's membership of a group.
+type GroupMember struct {
+	// CreatedAt Creation time
+	CreatedAt time.Time `json:"created_at"`
+
+	// GroupUid UID of the group
+	GroupUid string `json:"group_uid"`
+
+	// Role viewer can see what the group owns. member can also change it and add it to collections. owner can also delete it and decide who it is shared with.
+	Role GroupMemberRole `json:"role"`
+
+	// Uid Membership UID
+	Uid string `json:"uid"`
+
+	// UpdatedAt Update time
+	UpdatedAt time.Time `json:"updated_at"`
+	User      *User     `json:"user,omitempty"`
+}
+
+// GroupMemberRole viewer can see what the group owns. member can also change it and add it to collections. owner can also delete it and decide who it is shared with.
+type GroupMemberRole string
+
+// GroupMemberCreate defines model for GroupMemberCreate.
+type GroupMemberCreate struct {
+	// Role Role in the group
+	Role GroupMemberCreateRole `json:"role"`
+
+	// UserUid UID of the user to add
+	UserUid string `json:"user_uid"`
+}
+
+// GroupMemberCreateRole Role in the group
+type GroupMemberCreateRole string
+
+// GroupMemberList defines model for GroupMemberList.
+type GroupMemberList struct {
+	Items []GroupMember `json:"items"`
+}
+
+// GroupMemberUpdate defines model for GroupMemberUpdate.
+type GroupMemberUpdate struct {
+	// Role New role in the group
+	Role GroupMemberUpdateRole `json:"role"`
+}
+
+// GroupMemberUpdateRole New role in the group
+type GroupMemberUpdateRole string
+
+// GroupUpdate defines model for GroupUpdate.
+type GroupUpdate struct {
+	// Description What the group is for
+	Description *string `json:"description,omitempty"`
+
+	// Name Group name
+	Name *string `json:"name,omitempty"`
+}
+
+// GuestProofing defines model for GuestProofing.
+type GuestProofing struct {
+	Comments []ProofingComment `json:"comments"`
+
+	// Guest Someone proofing a collection through a share link, without an account.
+	Guest ShareGuest     `json:"guest"`
+	Marks []ProofingMark `json:"marks"`
+}
+
+// ImageAsset defines model for ImageAsset.
+type ImageAsset struct {
+	// CreatedAt Creation time
+	CreatedAt time.Time `json:"created_at"`
+
+	// Description Image description
+	Description *string    `json:"description,omitempty"`
+	Exif        *ImageEXIF `json:"exif,omitempty"`
+
+	// Favourited Is favourited
+	Favourited *bool `json:"favourited,omitempty"`
+
+	// Height Image height
+	Height        int32          `json:"height"`
+	ImageMetadata *ImageMetadata `json:"image_metadata,omitempty"`
+	ImagePaths    ImagePaths     `json:"image_paths"`
+
+	// Name Image name
+	Name  string `json:"name"`
+	Owner *User  `json:"owner,omitempty"`
+
+	// OwnerGroup A team of users who own images and collections together.
+	OwnerGroup *Group `json:"owner_group,omitempty"`
+
+	// Private Is private
+	Private bool `json:"private"`
+
+	// Processed Is processed
+	Processed bool `json:"processed"`
+
+	// TakenAt Taken time
+	TakenAt *time.Time `json:"taken_at"`
+
+	// Uid Image UID
+	Uid string `json:"uid"`
+
+	// UpdatedAt Update time
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// UploadLinkUid Upload link the image was uploaded through
+	UploadLinkUid *string `json:"upload_link_uid"`
+	UploadedBy    *User   `json:"uploaded_by,omitempty"`
+
+	// UploaderName Who sent the image, for images uploaded through an upload link
+	UploaderName *string `json:"uploader_name"`
+
+	// Width Image width
+	Width int32 `json:"width"`
+}
+
+// ImageEXIF defines model for ImageEXIF.
+type ImageEXIF struct {
+	// Aperture Aperture
+	Aperture *string `json:"aperture,omitempty"`
+
+	// Copyright Copyright
+	Copyright *string `json:"copyright,omitempty"`
+
+	// DateTime Date and time
+	DateTime *string `json:"date_time,omitempty"`
+
+	// DateTimeOriginal Original date and time
+	DateTimeOriginal *string `json:"date_time_original,omitempty"`
+
+	// DigitalZoomRatio Digital zoom ratio
+	DigitalZoomRatio *string `json:"digital_zoom_ratio,omitempty"`
+
+	// ExifVersion EXIF version
+	ExifVersion *string `json:"exif_version,omitempty"`
+
+	// ExposureBiasValue Exposure bias value
+	ExposureBiasValue *string `json:"exposure_bias_value,omitempty"`
+
+	// ExposureMode Exposure mode
+	ExposureMode *string `json:"exposure_mode,omitempty"`
+
+	// ExposureProgram Exposure program
+	ExposureProgram *string `json:"exposure_program,omitempty"`
+
+	// ExposureTime Exposure time
+	ExposureTime *string `json:"exposure_time,omitempty"`
+
+	// ExposureValue Exposure value
+	ExposureValue *string `json:"exposure_value,omitempty"`
+
+	// FNumber F-number
+	FNumber *string `json:"f_number,omitempty"`
+
+	// Flash Flash fired
+	Flash *int `json:"flash,omitempty"`
+
+	// FocalLength Focal length
+	FocalLength *string `json:"focal_length,omitempty"`
+
+	// FocalLengthIn35mmFormat Focal length in 35mm format
 	FocalLengthIn35mmFormat *string `json:"focal_length_in_35mm_format,omitempty"`
 
 	// FocalPlaneResolutionUnit Focal plane resolution unit
@@ -781,6 +1525,9 @@ type ImageUpdate struct {
 	// Name Image name
 	Name *string `json:"name,omitempty"`
 
+	// OwnerGroupUid UID of the group to own the image alongside its owner. An empty string takes it away from its group.
+	OwnerGroupUid *string `json:"owner_group_uid"`
+
 	// OwnerUid Owner UID
 	OwnerUid *string `json:"owner_uid"`
 
@@ -844,6 +1591,92 @@ type ImagesResponse struct {
 	Image   ImageAsset `json:"image"`
 }
 
+// JobAuditEntry Records an automatic action taken on a job, such as the reaper requeueing a job whose worker stopped sending heartbeats.
+type JobAuditEntry struct {
+	// Action What was done to the job (requeued or failed)
+	Action string `json:"action"`
+
+	// Attempts Number of times the job had been started
+	Attempts int `json:"attempts"`
+
+	// CreatedAt Creation time
+	CreatedAt time.Time `json:"created_at"`
+
+	// JobUid UID of the job the action was taken on
+	JobUid string `json:"job_uid"`
+
+	// PreviousStatus Job status before the action
+	PreviousStatus string `json:"previous_status"`
+
+	// Reason Why the action was taken
+	Reason string `json:"reason"`
+
+	// Uid Entry UID
+	Uid string `json:"uid"`
+}
+
+// JobAuditResponse defines model for JobAuditResponse.
+type JobAuditResponse struct {
+	Items []JobAuditEntry `json:"items"`
+}
+
+// JobBatch Tracks the jobs enqueued by a single bulk request (e.g. "all" or "missing").
+type JobBatch struct {
+	// Cancelled Number of jobs that were cancelled
+	Cancelled int `json:"cancelled"`
+
+	// Command Bulk command that created the batch
+	Command *string `json:"command"`
+
+	// Completed Number of jobs that completed successfully
+	Completed int `json:"completed"`
+
+	// CompletedAt Time the last job in the batch finished
+	CompletedAt *time.Time `json:"completed_at"`
+
+	// CreatedAt Creation time
+	CreatedAt time.Time `json:"created_at"`
+
+	// EtaSeconds Estimated seconds until the batch finishes
+	EtaSeconds *int `json:"eta_seconds"`
+
+	// Failed Number of jobs that failed
+	Failed int `json:"failed"`
+
+	// StartedAt Time the first job in the batch started
+	StartedAt *time.Time `json:"started_at"`
+
+	// Status Batch status (queued, running, completed, failed when every job failed, or partial when some did)
+	Status string `json:"status"`
+
+	// Throughput Finished jobs per second since the batch started
+	Throughput float64 `json:"throughput"`
+
+	// Topic Job topic
+	Topic string `json:"topic"`
+
+	// Total Number of jobs in the batch
+	Total int `json:"total"`
+
+	// Type Job type
+	Type string `json:"type"`
+
+	// Uid Batch UID
+	Uid string `json:"uid"`
+
+	// UpdatedAt Update time
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// JobBatchResponse defines model for JobBatchResponse.
+type JobBatchResponse struct {
+	// Batch Tracks the jobs enqueued by a single bulk request (e.g. "all" or "missing").
+	Batch JobBatch `json:"batch"`
+
+	// FailedImageUids UIDs of images whose jobs failed in this batch
+	FailedImageUids []string `json:"failed_image_uids"`
+}
+
 // VizConfig defines model for VizConfig.
 type VizConfig struct {
 	// BaseUrl Base URL of the application
@@ -888,26 +1721,532 @@ type LoggingConfig struct {
 	Level *string `json:"level,omitempty"`
 }
 
+// LoginResult defines model for LoginResult.
+type LoginResult struct {
+	// ChallengeExpiresAt When the challenge token expires
+	ChallengeExpiresAt *time.Time `json:"challenge_expires_at,omitempty"`
+
+	// ChallengeToken Short-lived token to send to /auth/login/2fa. Only set when two_factor_required is true.
+	ChallengeToken *string `json:"challenge_token,omitempty"`
+
+	// Message Response message
+	Message string `json:"message"`
+
+	// TwoFactorMethods Second factors the user can complete the challenge with (totp, passkey, recovery_code)
+	TwoFactorMethods *[]string `json:"two_factor_methods,omitempty"`
+
+	// TwoFactorRequired True if the password was accepted but a TOTP or recovery code is still needed. No session is created until /auth/login/2fa succeeds.
+	TwoFactorRequired bool `json:"two_factor_required"`
+
+	// TwoFactorSetupRequired True if the instance requires admins to use two-factor authentication and this admin hasn't enrolled yet. Admin endpoints are refused until they do.
+	TwoFactorSetupRequired *bool `json:"two_factor_setup_required,omitempty"`
+}
+
+// LoginTwoFactorRequest defines model for LoginTwoFactorRequest.
+type LoginTwoFactorRequest struct {
+	// CeremonyId Ceremony ID from /auth/login/2fa/passkey, when answering with a passkey
+	CeremonyId *string `json:"ceremony_id,omitempty"`
+
+	// ChallengeToken Challenge token from /auth/login
+	ChallengeToken string `json:"challenge_token"`
+
+	// Code Current TOTP code
+	Code *string `json:"code,omitempty"`
+
+	// Credential PublicKeyCredential JSON returned by navigator.credentials.get(), when answering with a passkey
+	Credential *map[string]interface{} `json:"credential,omitempty"`
+
+	// RecoveryCode One-time recovery code, used instead of a TOTP code
+	RecoveryCode *string `json:"recovery_code,omitempty"`
+}
+
 // MessageResponse defines model for MessageResponse.
 type MessageResponse struct {
 	// Message Response message
 	Message string `json:"message"`
 }
 
+// MirroredImage A remote image and its local copy
+type MirroredImage struct {
+	// Checksum Checksum of the remote file the copy was made from
+	Checksum  string `json:"checksum"`
+	ImageUid  string `json:"image_uid"`
+	RemoteUid string `json:"remote_uid"`
+}
+
+// OAuthAuthorization An app the user has authorized and the scopes it holds.
+type OAuthAuthorization struct {
+	ClientName string `json:"client_name"`
+	ClientUid  string `json:"client_uid"`
+
+	// CreatedAt When the app was first authorized
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Scopes     []string   `json:"scopes"`
+}
+
+// OAuthAuthorizationList defines model for OAuthAuthorizationList.
+type OAuthAuthorizationList struct {
+	Items []OAuthAuthorization `json:"items"`
+}
+
+// OAuthClient A third-party app registered to act on behalf of users.
+type OAuthClient struct {
+	// Confidential Whether the app has a secret. Public apps like the CLI rely on PKCE alone
+	Confidential bool `json:"confidential"`
+
+	// CreatedAt Creation time
+	CreatedAt time.Time `json:"created_at"`
+
+	// Description What the app does
+	Description *string `json:"description,omitempty"`
+
+	// Name App name shown on the consent screen
+	Name string `json:"name"`
+
+	// RedirectUris Redirect URIs the app may use, matched exactly
+	RedirectUris []string `json:"redirect_uris"`
+
+	// Scopes Scopes the app may ask for
+	Scopes []string `json:"scopes"`
+
+	// Uid Client UID, used as the OAuth2 client_id
+	Uid string `json:"uid"`
+
+	// UpdatedAt Update time
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// OAuthClientCreate defines model for OAuthClientCreate.
+type OAuthClientCreate struct {
+	// Confidential Give the app a secret
+	Confidential *bool    `json:"confidential,omitempty"`
+	Description  *string  `json:"description,omitempty"`
+	Name         string   `json:"name"`
+	RedirectUris []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+}
+
+// OAuthClientList defines model for OAuthClientList.
+type OAuthClientList struct {
+	Items []OAuthClient `json:"items"`
+}
+
+// OAuthClientSecretResponse defines model for OAuthClientSecretResponse.
+type OAuthClientSecretResponse struct {
+	// Client A third-party app registered to act on behalf of users.
+	Client OAuthClient `json:"client"`
+
+	// ClientSecret The client secret. It can't be retrieved again
+	ClientSecret *string `json:"client_secret"`
+}
+
+// OAuthClientUpdate defines model for OAuthClientUpdate.
+type OAuthClientUpdate struct {
+	Description  *string   `json:"description,omitempty"`
+	Name         *string   `json:"name,omitempty"`
+	RedirectUris *[]string `json:"redirect_uris,omitempty"`
+	Scopes       *[]string `json:"scopes,omitempty"`
+}
+
+// OAuthConsentDecision defines model for OAuthConsentDecision.
+type OAuthConsentDecision struct {
+	Approve bool `json:"approve"`
+
+	// Scopes Grant only these of the requested scopes
+	Scopes *[]string `json:"scopes,omitempty"`
+}
+
+// OAuthConsentRequest defines model for OAuthConsentRequest.
+type OAuthConsentRequest struct {
+	ClientDescription *string   `json:"client_description,omitempty"`
+	ClientName        string    `json:"client_name"`
+	ClientUid         string    `json:"client_uid"`
+	ExpiresAt         time.Time `json:"expires_at"`
+
+	// RedirectUri Where the browser goes after the decision
+	RedirectUri string `json:"redirect_uri"`
+
+	// Scopes Scopes the app asks for
+	Scopes []OAuthScope `json:"scopes"`
+}
+
+// OAuthError An error in the format of RFC 6749 section 5.2.
+type OAuthError struct {
+	Error            string  `json:"error"`
+	ErrorDescription *string `json:"error_description,omitempty"`
+}
+
+// OAuthRedirectResponse defines model for OAuthRedirectResponse.
+type OAuthRedirectResponse struct {
+	// RedirectTo URL to send the browser to
+	RedirectTo string `json:"redirect_to"`
+}
+
+// OAuthRevokeRequest defines model for OAuthRevokeRequest.
+type OAuthRevokeRequest struct {
+	ClientId      *string                          `json:"client_id,omitempty"`
+	ClientSecret  *string                          `json:"client_secret,omitempty"`
+	Token         string                           `json:"token"`
+	TokenTypeHint *OAuthRevokeRequestTokenTypeHint `json:"token_type_hint,omitempty"`
+}
+
+// OAuthRevokeRequestTokenTypeHint defines model for OAuthRevokeRequest.TokenTypeHint.
+type OAuthRevokeRequestTokenTypeHint string
+
+// OAuthScope defines model for OAuthScope.
+type OAuthScope struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// OAuthTokenRequest defines model for OAuthTokenRequest.
+type OAuthTokenRequest struct {
+	ClientId     *string                    `json:"client_id,omitempty"`
+	ClientSecret *string                    `json:"client_secret,omitempty"`
+	Code         *string                    `json:"code,omitempty"`
+	CodeVerifier *string                    `json:"code_verifier,omitempty"`
+	GrantType    OAuthTokenRequestGrantType `json:"grant_type"`
+	RedirectUri  *string                    `json:"redirect_uri,omitempty"`
+	RefreshToken *string                    `json:"refresh_token,omitempty"`
+
+	// Scope Narrow a refreshed grant to these scopes
+	Scope *string `json:"scope,omitempty"`
+}
+
+// OAuthTokenRequestGrantType defines model for OAuthTokenRequest.GrantType.
+type OAuthTokenRequestGrantType string
+
+// OAuthTokenResponse defines model for OAuthTokenResponse.
+type OAuthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+
+	// ExpiresIn Seconds until the access token expires
+	ExpiresIn    int     `json:"expires_in"`
+	RefreshToken *string `json:"refresh_token,omitempty"`
+
+	// Scope Granted scopes separated by spaces
+	Scope string `json:"scope"`
+
+	// TokenType Always Bearer
+	TokenType string `json:"token_type"`
+}
+
 // OAuthUserData defines model for OAuthUserData.
 type OAuthUserData struct {
 	// Email User email
 	Email openapi_types.Email `json:"email"`
 
-	// Name User name
-	Name string `json:"name"`
+	// Name User name
+	Name string `json:"name"`
+
+	// Picture User profile picture URL
+	Picture string `json:"picture"`
+}
+
+// OEmbed An oEmbed 1.0 response. Images of links that allow embedding are photos with a signed URL; anything else is a link with a thumbnail
+type OEmbed struct {
+	// CacheAge Seconds the response may be cached for
+	CacheAge        *int       `json:"cache_age,omitempty"`
+	Height          *int       `json:"height,omitempty"`
+	ProviderName    *string    `json:"provider_name,omitempty"`
+	ProviderUrl     *string    `json:"provider_url,omitempty"`
+	ThumbnailHeight *int       `json:"thumbnail_height,omitempty"`
+	ThumbnailUrl    *string    `json:"thumbnail_url,omitempty"`
+	ThumbnailWidth  *int       `json:"thumbnail_width,omitempty"`
+	Title           *string    `json:"title,omitempty"`
+	Type            OEmbedType `json:"type"`
+
+	// Url Image URL, for photos
+	Url     *string       `json:"url,omitempty"`
+	Version OEmbedVersion `json:"version"`
+	Width   *int          `json:"width,omitempty"`
+}
+
+// OEmbedType defines model for OEmbed.Type.
+type OEmbedType string
+
+// OEmbedVersion defines model for OEmbed.Version.
+type OEmbedVersion string
+
+// OIDCProvider An OpenID Connect identity provider users can sign in with
+type OIDCProvider struct {
+	// Id Provider ID, used in /auth/oidc/{provider}/login
+	Id string `json:"id"`
+
+	// Name Name to show on the login button
+	Name string `json:"name"`
+}
+
+// OIDCProviderListResponse defines model for OIDCProviderListResponse.
+type OIDCProviderListResponse struct {
+	Items []OIDCProvider `json:"items"`
+}
+
+// Passkey A WebAuthn credential registered to the user. The public key itself is never returned.
+type Passkey struct {
+	// BackupEligible Whether the credential can be synced between devices
+	BackupEligible bool `json:"backup_eligible"`
+
+	// CreatedAt Creation time
+	CreatedAt time.Time `json:"created_at"`
+
+	// LastUsedAt Last time the passkey was used to sign in
+	LastUsedAt *time.Time `json:"last_used_at"`
+
+	// Name Name the user gave the passkey
+	Name string `json:"name"`
+
+	// Uid Passkey UID
+	Uid string `json:"uid"`
+}
+
+// PasskeyCeremony Options for a WebAuthn ceremony. Pass options to navigator.credentials and send the result back with ceremony_id.
+type PasskeyCeremony struct {
+	// CeremonyId Identifies this ceremony when finishing it
+	CeremonyId string `json:"ceremony_id"`
+
+	// ExpiresAt When the ceremony expires
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// Options CredentialCreationOptions or CredentialRequestOptions, with binary fields base64url encoded
+	Options map[string]interface{} `json:"options"`
+}
+
+// PasskeyFinishRequest defines model for PasskeyFinishRequest.
+type PasskeyFinishRequest struct {
+	// CeremonyId Ceremony ID from the matching begin call
+	CeremonyId string `json:"ceremony_id"`
+
+	// Credential PublicKeyCredential JSON returned by the browser, with binary fields base64url encoded
+	Credential map[string]interface{} `json:"credential"`
+
+	// RememberMe Keep the session after the browser is closed. Only used when signing in.
+	RememberMe *bool `json:"remember_me,omitempty"`
+}
+
+// PasskeyListResponse defines model for PasskeyListResponse.
+type PasskeyListResponse struct {
+	Items []Passkey `json:"items"`
+}
+
+// PasskeyRegistrationRequest defines model for PasskeyRegistrationRequest.
+type PasskeyRegistrationRequest struct {
+	// Name Name for the new passkey, e.g. the device it lives on
+	Name string `json:"name"`
+}
+
+// PasskeyRegistrationResult defines model for PasskeyRegistrationResult.
+type PasskeyRegistrationResult struct {
+	// Passkey A WebAuthn credential registered to the user. The public key itself is never returned.
+	Passkey Passkey `json:"passkey"`
+
+	// RecoveryCodes Set when this passkey turned on two-factor authentication. The codes are only shown once.
+	RecoveryCodes *[]string `json:"recovery_codes,omitempty"`
+}
+
+// PasskeySecondFactorRequest defines model for PasskeySecondFactorRequest.
+type PasskeySecondFactorRequest struct {
+	// ChallengeToken Challenge token from /auth/login
+	ChallengeToken string `json:"challenge_token"`
+}
+
+// PasskeyUpdate defines model for PasskeyUpdate.
+type PasskeyUpdate struct {
+	// Name New name for the passkey
+	Name string `json:"name"`
+}
+
+// PasswordForgotRequest defines model for PasswordForgotRequest.
+type PasswordForgotRequest struct {
+	// Email Email address of the account
+	Email openapi_types.Email `json:"email"`
+}
+
+// PasswordResetRequest defines model for PasswordResetRequest.
+type PasswordResetRequest struct {
+	// Password New password
+	Password string `json:"password"`
+
+	// Token Token from the password reset link
+	Token string `json:"token"`
+}
+
+// ProofingCollectionCreate defines model for ProofingCollectionCreate.
+type ProofingCollectionCreate struct {
+	// Favourites Use hearted images instead of picked ones
+	Favourites *bool `json:"favourites,omitempty"`
+
+	// GuestUids Only count these guests. Defaults to everyone who submitted
+	GuestUids *[]string `json:"guest_uids,omitempty"`
+
+	// Name Name of the new collection
+	Name string `json:"name"`
+}
+
+// ProofingComment A guest's comment on an image.
+type ProofingComment struct {
+	Body string `json:"body"`
+
+	// CreatedAt Creation time
+	CreatedAt time.Time `json:"created_at"`
+	GuestUid  string    `json:"guest_uid"`
+	ImageUid  string    `json:"image_uid"`
+	Uid       string    `json:"uid"`
+
+	// UpdatedAt Update time
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ProofingCommentCreate defines model for ProofingCommentCreate.
+type ProofingCommentCreate struct {
+	Body string `json:"body"`
+}
+
+// ProofingImage Everything the guests of a share link did with one image.
+type ProofingImage struct {
+	Comments []ProofingComment `json:"comments"`
+
+	// FavouritedBy UIDs of the guests who hearted the image
+	FavouritedBy []string `json:"favourited_by"`
+	ImageUid     string   `json:"image_uid"`
+
+	// SelectedBy UIDs of the guests who picked the image
+	SelectedBy []string `json:"selected_by"`
+}
+
+// ProofingMark A guest's pick and heart on one image.
+type ProofingMark struct {
+	// CreatedAt Creation time
+	CreatedAt  time.Time `json:"created_at"`
+	Favourited bool      `json:"favourited"`
+	GuestUid   string    `json:"guest_uid"`
+	ImageUid   string    `json:"image_uid"`
+	Selected   bool      `json:"selected"`
+	Uid        string    `json:"uid"`
+
+	// UpdatedAt Update time
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ProofingMarkUpdate defines model for ProofingMarkUpdate.
+type ProofingMarkUpdate struct {
+	Favourited *bool `json:"favourited,omitempty"`
+	Selected   *bool `json:"selected,omitempty"`
+}
+
+// ProofingSelection defines model for ProofingSelection.
+type ProofingSelection struct {
+	Description *string         `json:"description"`
+	Guests      []ShareGuest    `json:"guests"`
+	Images      []ProofingImage `json:"images"`
+	Token       string          `json:"token"`
+}
+
+// ProofingShare defines model for ProofingShare.
+type ProofingShare struct {
+	Description *string    `json:"description"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	GuestCount  int        `json:"guest_count"`
+
+	// SubmittedCount Guests who submitted their selection
+	SubmittedCount int    `json:"submitted_count"`
+	Token          string `json:"token"`
+}
+
+// ProofingShareList defines model for ProofingShareList.
+type ProofingShareList struct {
+	Items []ProofingShare `json:"items"`
+}
+
+// PublicCollection defines model for PublicCollection.
+type PublicCollection struct {
+	Description *string     `json:"description"`
+	ImageCount  int         `json:"image_count"`
+	Name        string      `json:"name"`
+	Thumbnail   *ImagePaths `json:"thumbnail,omitempty"`
+	Uid         string      `json:"uid"`
+}
+
+// PublicImage An image seen through a share link. Paths point at the share's own routes. Metadata is left out unless the link shows it
+type PublicImage struct {
+	AddedAt       time.Time      `json:"added_at"`
+	Description   *string        `json:"description"`
+	EmbedPaths    *ImagePaths    `json:"embed_paths,omitempty"`
+	Exif          *ImageEXIF     `json:"exif,omitempty"`
+	Height        int32          `json:"height"`
+	ImageMetadata *ImageMetadata `json:"image_metadata,omitempty"`
+	ImagePaths    ImagePaths     `json:"image_paths"`
+	Name          string         `json:"name"`
+	TakenAt       *time.Time     `json:"taken_at"`
+	Uid           string         `json:"uid"`
+	Width         int32          `json:"width"`
+}
+
+// PublicImageList defines model for PublicImageList.
+type PublicImageList struct {
+	// Count Images in the collection
+	Count  int           `json:"count"`
+	Items  []PublicImage `json:"items"`
+	Limit  int           `json:"limit"`
+	Next   *string       `json:"next"`
+	Offset int           `json:"offset"`
+	Prev   *string       `json:"prev"`
+}
+
+// PublicShare What a share link recipient sees of the shared collection
+type PublicShare struct {
+	AllowDownload bool             `json:"allow_download"`
+	AllowProofing bool             `json:"allow_proofing"`
+	Collection    PublicCollection `json:"collection"`
+
+	// Description Description of the share link
+	Description  *string    `json:"description"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	ShowMetadata bool       `json:"show_metadata"`
+}
+
+// PublicUploadLink What someone uploading through a link sees of it
+type PublicUploadLink struct {
+	AllowedTypes   []string  `json:"allowed_types"`
+	CollectionName string    `json:"collection_name"`
+	ExpiresAt      time.Time `json:"expires_at"`
+
+	// FilesRemaining Files that can still be uploaded (null for no limit)
+	FilesRemaining *int `json:"files_remaining"`
+
+	// MaxFileSize Largest file in bytes, the link's own limit or the server's if that is lower
+	MaxFileSize int64   `json:"max_file_size"`
+	MaxFiles    *int    `json:"max_files"`
+	Message     *string `json:"message"`
+
+	// OwnerName Who the images are sent to
+	OwnerName string `json:"owner_name"`
+}
+
+// PublicUploadRequest defines model for PublicUploadRequest.
+type PublicUploadRequest struct {
+	// Data Image file data
+	Data openapi_types.File `json:"data"`
+
+	// FileName Name of the file. Defaults to the uploaded file's name
+	FileName *string `json:"file_name,omitempty"`
 
-	// Picture User profile picture URL
-	Picture string `json:"picture"`
+	// Name Name of the person uploading, shown with their images
+	Name string `json:"name"`
 }
 
 // QueueConfig defines model for QueueConfig.
 type QueueConfig struct {
+	// Backend Queue backend (memory, redis or postgres). Empty uses Redis when enabled, otherwise memory
+	Backend *string `json:"backend,omitempty"`
+
+	// BulkRatePerSecond Maximum bulk jobs started per second (0 disables the limit)
+	BulkRatePerSecond *int `json:"bulk_rate_per_second,omitempty"`
+
+	// BulkWeight Share of worker slots given to the bulk lane
+	BulkWeight *int `json:"bulk_weight,omitempty"`
+
 	// Db Redis DB index
 	Db *int `json:"db,omitempty"`
 
@@ -917,12 +2256,33 @@ type QueueConfig struct {
 	// Enabled Is queue enabled
 	Enabled *bool `json:"enabled,omitempty"`
 
+	// HeartbeatIntervalSeconds Seconds between heartbeats from a running job
+	HeartbeatIntervalSeconds *int `json:"heartbeat_interval_seconds,omitempty"`
+
 	// Host Queue host
 	Host *string `json:"host,omitempty"`
 
+	// InteractiveWeight Share of worker slots given to the interactive lane
+	InteractiveWeight *int `json:"interactive_weight,omitempty"`
+
+	// LeaseTimeoutSeconds Seconds without a heartbeat before a running job is treated as abandoned
+	LeaseTimeoutSeconds *int `json:"lease_timeout_seconds,omitempty"`
+
+	// MaxAttempts Times an abandoned job is started before it is marked failed
+	MaxAttempts *int `json:"max_attempts,omitempty"`
+
+	// Mode "all" runs the workers in the API server, "api" only publishes jobs for standalone workers
+	Mode *string `json:"mode,omitempty"`
+
+	// NormalWeight Share of worker slots given to the normal lane
+	NormalWeight *int `json:"normal_weight,omitempty"`
+
 	// Password Masked password
 	Password *string `json:"password,omitempty"`
 
+	// PollIntervalMillis Milliseconds the Postgres backend waits before polling an empty topic again
+	PollIntervalMillis *int `json:"poll_interval_millis,omitempty"`
+
 	// PoolSize Connection pool size
 	PoolSize *int `json:"pool_size,omitempty"`
 
@@ -938,10 +2298,75 @@ type QueueConfig struct {
 	// Username Queue username
 	Username *string `json:"username,omitempty"`
 
+	// VisibilityTimeoutSeconds Seconds a message delivered by the Postgres backend stays leased before it is redelivered
+	VisibilityTimeoutSeconds *int `json:"visibility_timeout_seconds,omitempty"`
+
+	// WorkerConcurrency Concurrency per topic for a standalone worker
+	WorkerConcurrency *map[string]int `json:"worker_concurrency,omitempty"`
+
+	// WorkerTopics Topics a standalone worker consumes (all when empty)
+	WorkerTopics *[]string `json:"worker_topics,omitempty"`
+
 	// WriteTimeoutSeconds Write timeout
 	WriteTimeoutSeconds *int `json:"write_timeout_seconds,omitempty"`
 }
 
+// RecoveryCodesResponse defines model for RecoveryCodesResponse.
+type RecoveryCodesResponse struct {
+	// RecoveryCodes One-time recovery codes. They are stored hashed and can't be shown again.
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// RemoteCollection A public collection as a server serves it to its peers
+type RemoteCollection struct {
+	Description *string `json:"description,omitempty"`
+
+	// Images The collection's public images, in collection order
+	Images    []RemoteImage `json:"images"`
+	Name      string        `json:"name"`
+	Uid       string        `json:"uid"`
+	UpdatedAt time.Time     `json:"updated_at"`
+
+	// Uri viz URI of the collection
+	Uri string `json:"uri"`
+}
+
+// RemoteImage A public image as a server serves it to its peers
+type RemoteImage struct {
+	Checksum    string     `json:"checksum"`
+	Description *string    `json:"description,omitempty"`
+	FileName    string     `json:"file_name"`
+	Height      int        `json:"height"`
+	Name        string     `json:"name"`
+	TakenAt     *time.Time `json:"taken_at,omitempty"`
+	Uid         string     `json:"uid"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	// Uri viz URI of the image
+	Uri   string `json:"uri"`
+	Width int    `json:"width"`
+}
+
+// ResolvedURI defines model for ResolvedURI.
+type ResolvedURI struct {
+	// Endpoint Federation API URL of the resource. Fetching it needs a signed request
+	Endpoint string `json:"endpoint"`
+
+	// PeerStatus Whether this server trusts the resource's server
+	PeerStatus   ResolvedURIPeerStatus   `json:"peer_status"`
+	ResourceId   string                  `json:"resource_id"`
+	ResourceType ResolvedURIResourceType `json:"resource_type"`
+	ServerName   string                  `json:"server_name"`
+	ServerUrl    string                  `json:"server_url"`
+	Uri          string                  `json:"uri"`
+}
+
+// ResolvedURIPeerStatus Whether this server trusts the resource's server
+type ResolvedURIPeerStatus string
+
+// ResolvedURIResourceType defines model for ResolvedURI.ResourceType.
+type ResolvedURIResourceType string
+
 // SearchListResponse defines model for SearchListResponse.
 type SearchListResponse struct {
 	// Collections List of collections found
@@ -951,6 +2376,38 @@ type SearchListResponse struct {
 	Images []ImageAsset `json:"images"`
 }
 
+// SecurityEvent Records a security relevant event, such as a client being locked out after too many failed sign-in or download password attempts.
+type SecurityEvent struct {
+	// Action What happened, e.g. lockout
+	Action string `json:"action"`
+
+	// CreatedAt Creation time
+	CreatedAt time.Time `json:"created_at"`
+
+	// Failures Failed attempts counted so far
+	Failures int `json:"failures"`
+
+	// Ip Client IP of the request that triggered the event
+	Ip string `json:"ip"`
+
+	// Key What was locked out, e.g. ip:203.0.113.7 or account:ada@example.com
+	Key string `json:"key"`
+
+	// LockoutSeconds How long the key is locked out for
+	LockoutSeconds int `json:"lockout_seconds"`
+
+	// Scope What was being attempted, e.g. login, two_factor or download
+	Scope string `json:"scope"`
+
+	// Uid Event UID
+	Uid string `json:"uid"`
+}
+
+// SecurityEventList defines model for SecurityEventList.
+type SecurityEventList struct {
+	Items []SecurityEvent `json:"items"`
+}
+
 // Session defines model for Session.
 type Session struct {
 	// ClientId Client ID
@@ -959,13 +2416,13 @@ type Session struct {
 	// ClientIp Client IP
 	ClientIp *string `json:"client_ip,omitempty"`
 
-	// ClientName Client name
+	// ClientName Device name, derived from the user agent at sign in unless renamed
 	ClientName *string `json:"client_name,omitempty"`
 
 	// CreatedAt Creation time
 	CreatedAt time.Time `json:"created_at"`
 
-	// ExpiresAt Expiry time
+	// ExpiresAt Absolute expiry. The session ends then however active it is.
 	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 
 	// LastActive Last active time
@@ -980,15 +2437,15 @@ type Session struct {
 	// RefId Reference ID
 	RefId *string `json:"ref_id,omitempty"`
 
+	// RememberMe Whether the session outlives the browser session. Otherwise the cookie is dropped when the browser closes and the session has a shorter absolute expiry.
+	RememberMe *bool `json:"remember_me,omitempty"`
+
 	// Status Session status
 	Status *int `json:"status,omitempty"`
 
-	// Timeout Timeout in seconds
+	// Timeout Idle timeout in seconds. The session ends when unused for this long.
 	Timeout *int64 `json:"timeout,omitempty"`
 
-	// Token Session token
-	Token string `json:"token"`
-
 	// Uid Session UID
 	Uid string `json:"uid"`
 
@@ -1054,6 +2511,38 @@ type SettingOverride struct {
 	Value string `json:"value"`
 }
 
+// ShareGuest Someone proofing a collection through a share link, without an account.
+type ShareGuest struct {
+	CollectionUid string `json:"collection_uid"`
+
+	// CreatedAt Creation time
+	CreatedAt time.Time `json:"created_at"`
+	Email     *string   `json:"email"`
+	Name      *string   `json:"name"`
+
+	// SubmittedAt When the guest submitted their final selection
+	SubmittedAt *time.Time `json:"submitted_at"`
+	Uid         string     `json:"uid"`
+
+	// UpdatedAt Update time
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ShareGuestCreate defines model for ShareGuestCreate.
+type ShareGuestCreate struct {
+	Email *string `json:"email,omitempty"`
+	Name  *string `json:"name,omitempty"`
+}
+
+// ShareGuestSession defines model for ShareGuestSession.
+type ShareGuestSession struct {
+	// Guest Someone proofing a collection through a share link, without an account.
+	Guest ShareGuest `json:"guest"`
+
+	// GuestToken Send as X-Guest-Token. It can't be retrieved again
+	GuestToken string `json:"guest_token"`
+}
+
 // SignDownloadRequest Request to create a download token
 type SignDownloadRequest struct {
 	// AllowDownload Allow downloads using this token (default true)
@@ -1062,12 +2551,21 @@ type SignDownloadRequest struct {
 	// AllowEmbed Allow embedding images on external sites (default false to prevent hotlinking)
 	AllowEmbed *bool `json:"allow_embed,omitempty"`
 
+	// AllowProofing Let people with a collection share link pick, heart and comment on images (default false)
+	AllowProofing *bool `json:"allow_proofing,omitempty"`
+
+	// CollectionUid Share a whole collection instead of uids. The token follows the collection, so images added later are shared too
+	CollectionUid *string `json:"collection_uid,omitempty"`
+
 	// Description Optional description of this share/download link
 	Description *string `json:"description,omitempty"`
 
 	// ExpiresIn Time in seconds until the token expires (0 for no expiry, default 900 = 15 minutes)
 	ExpiresIn *int `json:"expires_in,omitempty"`
 
+	// MaxUses Downloads allowed before the token stops working (default no limit)
+	MaxUses *int `json:"max_uses,omitempty"`
+
 	// Password Optional password protection for the token (will be bcrypt hashed)
 	Password *string `json:"password,omitempty"`
 
@@ -1078,6 +2576,34 @@ type SignDownloadRequest struct {
 	Uids *[]string `json:"uids,omitempty"`
 }
 
+// SignedImageURL defines model for SignedImageURL.
+type SignedImageURL struct {
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// Url Path of the signed URL, relative to the API
+	Url string `json:"url"`
+}
+
+// SignedImageURLCreate defines model for SignedImageURLCreate.
+type SignedImageURLCreate struct {
+	// Download Serve the file as an attachment
+	Download *bool `json:"download,omitempty"`
+
+	// ExpiresIn Seconds until the URL stops working. Defaults to a day, at most a year
+	ExpiresIn *int                        `json:"expires_in,omitempty"`
+	Format    *SignedImageURLCreateFormat `json:"format,omitempty"`
+	Height    *int                        `json:"height,omitempty"`
+
+	// Ip Only let the URL be used from this address
+	Ip       *string `json:"ip,omitempty"`
+	LongEdge *int    `json:"long_edge,omitempty"`
+	Quality  *int    `json:"quality,omitempty"`
+	Width    *int    `json:"width,omitempty"`
+}
+
+// SignedImageURLCreateFormat defines model for SignedImageURLCreate.Format.
+type SignedImageURLCreateFormat string
+
 // StorageMetricsConfig defines model for StorageMetricsConfig.
 type StorageMetricsConfig struct {
 	// Enabled Metrics enabled
@@ -1157,12 +2683,107 @@ type SystemStatusResponse struct {
 	UserOnboardingRequired bool `json:"user_onboarding_required"`
 }
 
+// TwoFactorCodeRequest defines model for TwoFactorCodeRequest.
+type TwoFactorCodeRequest struct {
+	// Code Current TOTP code
+	Code string `json:"code"`
+}
+
+// TwoFactorDisableRequest defines model for TwoFactorDisableRequest.
+type TwoFactorDisableRequest struct {
+	// Code Current TOTP code
+	Code *string `json:"code,omitempty"`
+
+	// Password Current password
+	Password string `json:"password"`
+
+	// RecoveryCode One-time recovery code, used instead of a TOTP code
+	RecoveryCode *string `json:"recovery_code,omitempty"`
+}
+
+// TwoFactorSetupResponse defines model for TwoFactorSetupResponse.
+type TwoFactorSetupResponse struct {
+	// ProvisioningUri otpauth:// URI to render as a QR code
+	ProvisioningUri string `json:"provisioning_uri"`
+
+	// Secret Base32 TOTP secret, for manual entry
+	Secret string `json:"secret"`
+}
+
+// TwoFactorStatus defines model for TwoFactorStatus.
+type TwoFactorStatus struct {
+	// Enabled Whether two-factor authentication is enabled, by TOTP or a passkey
+	Enabled bool `json:"enabled"`
+
+	// EnabledAt When TOTP was enabled
+	EnabledAt *time.Time `json:"enabled_at"`
+
+	// PasskeyCount Number of registered passkeys, each of which can be used as a second factor
+	PasskeyCount int `json:"passkey_count"`
+
+	// RecoveryCodesRemaining Number of unused recovery codes
+	RecoveryCodesRemaining int `json:"recovery_codes_remaining"`
+
+	// Required Whether the instance requires this account to use two-factor authentication
+	Required bool `json:"required"`
+
+	// TotpEnabled Whether a TOTP authenticator is enrolled
+	TotpEnabled bool `json:"totp_enabled"`
+}
+
 // UploadConfig defines model for UploadConfig.
 type UploadConfig struct {
 	// Location Upload location
 	Location *string `json:"location,omitempty"`
 }
 
+// UploadLink Link letting people without an account upload images into a collection
+type UploadLink struct {
+	// AllowedTypes File extensions allowed, e.g. jpg or cr3. Empty allows any image
+	AllowedTypes  []string  `json:"allowed_types"`
+	CollectionUid string    `json:"collection_uid"`
+	CreatedAt     time.Time `json:"created_at"`
+	CreatedBy     *User     `json:"created_by,omitempty"`
+	ExpiresAt     time.Time `json:"expires_at"`
+
+	// FileCount Files uploaded through the link
+	FileCount  int        `json:"file_count"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+
+	// MaxFileSize Largest file allowed in bytes (null for no limit)
+	MaxFileSize *int64 `json:"max_file_size"`
+
+	// MaxFiles Files that can be uploaded through the link (null for no limit)
+	MaxFiles *int `json:"max_files"`
+
+	// Message Shown to people uploading through the link
+	Message *string `json:"message"`
+
+	// Token Signed token the link is shared with. Tokens stop working if the URL signing key changes
+	Token     string    `json:"token"`
+	Uid       string    `json:"uid"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// UploadLinkCreate defines model for UploadLinkCreate.
+type UploadLinkCreate struct {
+	// AllowedTypes File extensions allowed, e.g. jpg or cr3. Leave out to allow any image
+	AllowedTypes *[]string `json:"allowed_types,omitempty"`
+
+	// ExpiresIn Seconds until the link expires (default 7 days, at most 90 days)
+	ExpiresIn *int `json:"expires_in,omitempty"`
+
+	// MaxFileSize Largest file allowed in bytes
+	MaxFileSize *int64  `json:"max_file_size,omitempty"`
+	MaxFiles    *int    `json:"max_files,omitempty"`
+	Message     *string `json:"message,omitempty"`
+}
+
+// UploadLinkList defines model for UploadLinkList.
+type UploadLinkList struct {
+	Items []UploadLink `json:"items"`
+}
+
 // User defines model for User.
 type User struct {
 	// CreatedAt Creation time
@@ -1171,15 +2792,24 @@ type User struct {
 	// Email Email
 	Email string `json:"email"`
 
+	// EmailVerified Whether the user has confirmed they own their email address
+	EmailVerified bool `json:"email_verified"`
+
 	// FirstName First name
 	FirstName string `json:"first_name"`
 
 	// LastName Last name
 	LastName string `json:"last_name"`
 
+	// PendingEmail New email address waiting to be confirmed. The email only changes once the link sent to this address is opened.
+	PendingEmail *string `json:"pending_email"`
+
 	// Role User role
 	Role UserRole `json:"role"`
 
+	// TwoFactorEnabled Whether the user has two-factor authentication enabled, by TOTP or a passkey
+	TwoFactorEnabled bool `json:"two_factor_enabled"`
+
 	// Uid User UID
 	Uid string `json:"uid"`
 
@@ -1354,6 +2984,12 @@ type WorkerInfo struct {
 
 // WorkerJob defines model for WorkerJob.
 type WorkerJob struct {
+	// Attempts Number of times the job has been started
+	Attempts int `json:"attempts"`
+
+	// BatchUid UID of the batch this job belongs to, if any
+	BatchUid *string `json:"batch_uid"`
+
 	// Command Job command
 	Command *string `json:"command"`
 
@@ -1369,12 +3005,18 @@ type WorkerJob struct {
 	// ErrorMsg Error message if failed
 	ErrorMsg *string `json:"error_msg"`
 
+	// HeartbeatAt Last heartbeat from the worker running the job
+	HeartbeatAt *time.Time `json:"heartbeat_at"`
+
 	// ImageUid Related image UID
 	ImageUid *string `json:"image_uid"`
 
 	// Payload Job payload
 	Payload *string `json:"payload"`
 
+	// Priority Priority lane the job was queued on (interactive, normal or bulk)
+	Priority *string `json:"priority"`
+
 	// StartedAt Started timestamp
 	StartedAt *time.Time `json:"started_at"`
 
@@ -1396,6 +3038,9 @@ type WorkerJobCreateRequest struct {
 	// Command Command to execute (all=process all, missing=process missing)
 	Command WorkerJobCreateRequestCommand `json:"command"`
 
+	// Priority Priority lane (interactive, normal or bulk). Defaults to interactive for a single image and bulk otherwise
+	Priority *string `json:"priority,omitempty"`
+
 	// Type Job topic (e.g., exif_process, image_process)
 	Type string `json:"type"`
 
@@ -1408,6 +3053,9 @@ type WorkerJobCreateRequestCommand string
 
 // WorkerJobEnqueueResponse defines model for WorkerJobEnqueueResponse.
 type WorkerJobEnqueueResponse struct {
+	// BatchUid UID of the job batch tracking a bulk request
+	BatchUid *string `json:"batch_uid,omitempty"`
+
 	// Count Count of enqueued jobs
 	Count *int `json:"count,omitempty"`
 
@@ -1417,12 +3065,21 @@ type WorkerJobEnqueueResponse struct {
 
 // WorkerJobStatsResponse defines model for WorkerJobStatsResponse.
 type WorkerJobStatsResponse struct {
+	// AvgWaitMsByPriority Average time in milliseconds jobs waited in each lane before starting
+	AvgWaitMsByPriority map[string]int64 `json:"avg_wait_ms_by_priority"`
+
+	// QueuedByPriority Queued jobs by priority lane
+	QueuedByPriority map[string]int `json:"queued_by_priority"`
+
 	// QueuedByTopic Queued jobs by topic
 	QueuedByTopic map[string]int `json:"queued_by_topic"`
 
 	// Running Total running jobs
 	Running int `json:"running"`
 
+	// RunningByPriority Running jobs by priority lane
+	RunningByPriority map[string]int `json:"running_by_priority"`
+
 	// RunningByTopic Running jobs by topic
 	RunningByTopic map[string]int `json:"running_by_topic"`
 }
@@ -1463,12 +3120,63 @@ type UpdateUserSettingParams struct {
 	Name string `form:"name" json:"name"`
 }
 
+// ListSecurityEventsParams defines parameters for ListSecurityEvents.
+type ListSecurityEventsParams struct {
+	// Scope Only events for this scope, e.g. login
+	Scope *string `form:"scope,omitempty" json:"scope,omitempty"`
+
+	// Limit Maximum number of events to return
+	Limit *int `form:"limit,omitempty" json:"limit,omitempty"`
+}
+
 // AdminDeleteUserJSONBody defines parameters for AdminDeleteUser.
 type AdminDeleteUserJSONBody struct {
 	// Force If true, permanently deletes the user and all associated data (sessions, settings).
 	Force *bool `json:"force,omitempty"`
 }
 
+// GetTopImagesParams defines parameters for GetTopImages.
+type GetTopImagesParams struct {
+	// From First day, as YYYY-MM-DD (default 29 days before to)
+	From *string `form:"from,omitempty" json:"from,omitempty"`
+
+	// To Last day, as YYYY-MM-DD (default today)
+	To *string `form:"to,omitempty" json:"to,omitempty"`
+
+	// By view (default) or download
+	By *string `form:"by,omitempty" json:"by,omitempty"`
+
+	// Limit Images to list (default 20, at most 100)
+	Limit *int `form:"limit,omitempty" json:"limit,omitempty"`
+}
+
+// GetShareAnalyticsParams defines parameters for GetShareAnalytics.
+type GetShareAnalyticsParams struct {
+	// From First day, as YYYY-MM-DD (default 29 days before to)
+	From *string `form:"from,omitempty" json:"from,omitempty"`
+
+	// To Last day, as YYYY-MM-DD (default today)
+	To *string `form:"to,omitempty" json:"to,omitempty"`
+}
+
+// GetAnalyticsTimeSeriesParams defines parameters for GetAnalyticsTimeSeries.
+type GetAnalyticsTimeSeriesParams struct {
+	// From First day, as YYYY-MM-DD (default 29 days before to)
+	From *string `form:"from,omitempty" json:"from,omitempty"`
+
+	// To Last day, as YYYY-MM-DD (default today)
+	To *string `form:"to,omitempty" json:"to,omitempty"`
+
+	// ImageUid Only this image
+	ImageUid *string `form:"image_uid,omitempty" json:"image_uid,omitempty"`
+
+	// CollectionUid Only this collection, its images included
+	CollectionUid *string `form:"collection_uid,omitempty" json:"collection_uid,omitempty"`
+
+	// ShareToken Only this share link or download token
+	ShareToken *string `form:"share_token,omitempty" json:"share_token,omitempty"`
+}
+
 // LoginJSONBody defines parameters for Login.
 type LoginJSONBody struct {
 	// Email User email address
@@ -1476,6 +3184,9 @@ type LoginJSONBody struct {
 
 	// Password User password
 	Password string `json:"password"`
+
+	// RememberMe Keep the session after the browser is closed. Carried over to the two-factor step if one is needed.
+	RememberMe *bool `json:"remember_me,omitempty"`
 }
 
 // InitiateOAuthParams defines parameters for InitiateOAuth.
@@ -1499,6 +3210,24 @@ type CompleteOAuthParams struct {
 // CompleteOAuthParamsProvider defines parameters for CompleteOAuth.
 type CompleteOAuthParamsProvider string
 
+// CompleteOIDCLoginParams defines parameters for CompleteOIDCLogin.
+type CompleteOIDCLoginParams struct {
+	// Code Authorization code
+	Code *string `form:"code,omitempty" json:"code,omitempty"`
+
+	// State State from startOIDCLogin
+	State string `form:"state" json:"state"`
+}
+
+// StartOIDCLoginParams defines parameters for StartOIDCLogin.
+type StartOIDCLoginParams struct {
+	// RedirectTo Path on this site to return to after signing in. Defaults to /.
+	RedirectTo *string `form:"redirect_to,omitempty" json:"redirect_to,omitempty"`
+
+	// RememberMe Keep the session after the browser is closed
+	RememberMe *bool `form:"remember_me,omitempty" json:"remember_me,omitempty"`
+}
+
 // ListCollectionsParams defines parameters for ListCollections.
 type ListCollectionsParams struct {
 	Limit *int `form:"limit,omitempty" json:"limit,omitempty"`
@@ -1534,6 +3263,21 @@ type DownloadImagesParams struct {
 	Password *string `form:"password,omitempty" json:"password,omitempty"`
 }
 
+// ListDownloadTokensParams defines parameters for ListDownloadTokens.
+type ListDownloadTokensParams struct {
+	// CollectionUid Only share links for this collection
+	CollectionUid *string `form:"collection_uid,omitempty" json:"collection_uid,omitempty"`
+}
+
+// ListDownloadLogsParams defines parameters for ListDownloadLogs.
+type ListDownloadLogsParams struct {
+	// Limit Entries per page (default 100)
+	Limit *int `form:"limit,omitempty" json:"limit,omitempty"`
+
+	// Offset Entries to skip
+	Offset *int `form:"offset,omitempty" json:"offset,omitempty"`
+}
+
 // GetEventHistoryParams defines parameters for GetEventHistory.
 type GetEventHistoryParams struct {
 	// Limit Maximum number of events to return
@@ -1549,6 +3293,12 @@ type GetEventsSinceParams struct {
 	Limit *int `form:"limit,omitempty" json:"limit,omitempty"`
 }
 
+// ResolveVizUriParams defines parameters for ResolveVizUri.
+type ResolveVizUriParams struct {
+	// Uri viz URI
+	Uri string `form:"uri" json:"uri"`
+}
+
 // DeleteImagesBulkJSONBody defines parameters for DeleteImagesBulk.
 type DeleteImagesBulkJSONBody struct {
 	// Force Force deletion
@@ -1605,6 +3355,15 @@ type GetImageFileParams struct {
 
 	// Password Password for password-protected tokens (optional)
 	Password *string `form:"password,omitempty" json:"password,omitempty"`
+
+	// Exp Expiry of a signed URL, in Unix seconds
+	Exp *int64 `form:"exp,omitempty" json:"exp,omitempty"`
+
+	// Bind Set on signed URLs that only work from one address
+	Bind *GetImageFileParamsBind `form:"bind,omitempty" json:"bind,omitempty"`
+
+	// Sig Signature of a signed URL
+	Sig *string `form:"sig,omitempty" json:"sig,omitempty"`
 }
 
 // GetImageFileParamsFormat defines parameters for GetImageFile.
@@ -1613,6 +3372,9 @@ type GetImageFileParamsFormat string
 // GetImageFileParamsDownload defines parameters for GetImageFile.
 type GetImageFileParamsDownload string
 
+// GetImageFileParamsBind defines parameters for GetImageFile.
+type GetImageFileParamsBind string
+
 // ListJobsParams defines parameters for ListJobs.
 type ListJobsParams struct {
 	// Status Filter by job status
@@ -1631,6 +3393,132 @@ type ListJobsParams struct {
 // ListJobsParamsStatus defines parameters for ListJobs.
 type ListJobsParamsStatus string
 
+// OauthAuthorizeParams defines parameters for OauthAuthorize.
+type OauthAuthorizeParams struct {
+	// ResponseType Must be code
+	ResponseType string `form:"response_type" json:"response_type"`
+
+	// ClientId UID of the registered client
+	ClientId string `form:"client_id" json:"client_id"`
+
+	// RedirectUri One of the client's registered redirect URIs
+	RedirectUri string `form:"redirect_uri" json:"redirect_uri"`
+
+	// Scope Scopes separated by spaces. Defaults to all the client's scopes
+	Scope *string `form:"scope,omitempty" json:"scope,omitempty"`
+
+	// State Returned unchanged to the client
+	State *string `form:"state,omitempty" json:"state,omitempty"`
+
+	// CodeChallenge PKCE S256 code challenge
+	CodeChallenge string `form:"code_challenge" json:"code_challenge"`
+
+	// CodeChallengeMethod Must be S256
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+}
+
+// GetOEmbedParams defines parameters for GetOEmbed.
+type GetOEmbedParams struct {
+	// Url Share page URL, /share/{token} or /share/{token}/images/{uid}
+	Url string `form:"url" json:"url"`
+
+	// Maxwidth Largest width the preview image may have
+	Maxwidth *int `form:"maxwidth,omitempty" json:"maxwidth,omitempty"`
+
+	// Maxheight Largest height the preview image may have
+	Maxheight *int `form:"maxheight,omitempty" json:"maxheight,omitempty"`
+
+	// Format Response format. Only json is supported
+	Format *string `form:"format,omitempty" json:"format,omitempty"`
+}
+
+// GetPublicShareParams defines parameters for GetPublicShare.
+type GetPublicShareParams struct {
+	// Password Password of a password protected share link. Not needed with a share session, and the X-Share-Password header is preferred, since query strings end up in access logs
+	Password *string `form:"password,omitempty" json:"password,omitempty"`
+
+	// XSharePassword Password of a password protected share link
+	XSharePassword *string `json:"X-Share-Password,omitempty"`
+}
+
+// DownloadPublicShareParams defines parameters for DownloadPublicShare.
+type DownloadPublicShareParams struct {
+	// Password Password of a password protected share link. Not needed with a share session, and the X-Share-Password header is preferred, since query strings end up in access logs
+	Password *string `form:"password,omitempty" json:"password,omitempty"`
+}
+
+// ListPublicShareImagesParams defines parameters for ListPublicShareImages.
+type ListPublicShareImagesParams struct {
+	// Password Password of a password protected share link. Not needed with a share session, and the X-Share-Password header is preferred, since query strings end up in access logs
+	Password *string `form:"password,omitempty" json:"password,omitempty"`
+
+	// Offset Images to skip
+	Offset *int `form:"offset,omitempty" json:"offset,omitempty"`
+
+	// Limit Images per page (default 100)
+	Limit *int `form:"limit,omitempty" json:"limit,omitempty"`
+}
+
+// GetPublicShareImageFileParams defines parameters for GetPublicShareImageFile.
+type GetPublicShareImageFileParams struct {
+	// Password Password of a password protected share link. Not needed with a share session, and the X-Share-Password header is preferred, since query strings end up in access logs
+	Password *string `form:"password,omitempty" json:"password,omitempty"`
+
+	// Download Set to 1 to download the file. Needs allow_download
+	Download *string `form:"download,omitempty" json:"download,omitempty"`
+}
+
+// GetGuestProofingParams defines parameters for GetGuestProofing.
+type GetGuestProofingParams struct {
+	// Password Password of a password protected share link. Not needed with a share session, and the X-Share-Password header is preferred, since query strings end up in access logs
+	Password *string `form:"password,omitempty" json:"password,omitempty"`
+
+	// XGuestToken Guest token from createShareGuest
+	XGuestToken string `json:"X-Guest-Token"`
+}
+
+// DeleteProofingCommentParams defines parameters for DeleteProofingComment.
+type DeleteProofingCommentParams struct {
+	// Password Password of a password protected share link. Not needed with a share session, and the X-Share-Password header is preferred, since query strings end up in access logs
+	Password *string `form:"password,omitempty" json:"password,omitempty"`
+
+	// XGuestToken Guest token from createShareGuest
+	XGuestToken string `json:"X-Guest-Token"`
+}
+
+// CreateShareGuestParams defines parameters for CreateShareGuest.
+type CreateShareGuestParams struct {
+	// Password Password of a password protected share link. Not needed with a share session, and the X-Share-Password header is preferred, since query strings end up in access logs
+	Password *string `form:"password,omitempty" json:"password,omitempty"`
+}
+
+// MarkProofingImageParams defines parameters for MarkProofingImage.
+type MarkProofingImageParams struct {
+	// Password Password of a password protected share link. Not needed with a share session, and the X-Share-Password header is preferred, since query strings end up in access logs
+	Password *string `form:"password,omitempty" json:"password,omitempty"`
+
+	// XGuestToken Guest token from createShareGuest
+	XGuestToken string `json:"X-Guest-Token"`
+}
+
+// CreateProofingCommentParams defines parameters for CreateProofingComment.
+type CreateProofingCommentParams struct {
+	// Password Password of a password protected share link. Not needed with a share session, and the X-Share-Password header is preferred, since query strings end up in access logs
+	Password *string `form:"password,omitempty" json:"password,omitempty"`
+
+	// XGuestToken Guest token from createShareGuest
+	XGuestToken string `json:"X-Guest-Token"`
+}
+
+// SubmitProofingParams defines parameters for SubmitProofing.
+type SubmitProofingParams struct {
+	// Password Password of a password protected share link. Not needed with a share session, and the X-Share-Password header is preferred, since query strings end up in access logs
+	Password *string `form:"password,omitempty" json:"password,omitempty"`
+
+	// XGuestToken Guest token from createShareGuest
+	XGuestToken string `json:"X-Guest-Token"`
+}
+
 // ExecuteSearchParams defines parameters for ExecuteSearch.
 type ExecuteSearchParams struct {
 	// Q Search query string (e.g. "johannesburg rating:>=4")
@@ -1649,9 +3537,27 @@ type RegisterUserJSONRequestBody = UserCreate
 // UpdateCurrentUserJSONRequestBody defines body for UpdateCurrentUser for application/json ContentType.
 type UpdateCurrentUserJSONRequestBody = UserUpdate
 
+// DisableTwoFactorJSONRequestBody defines body for DisableTwoFactor for application/json ContentType.
+type DisableTwoFactorJSONRequestBody = TwoFactorDisableRequest
+
+// RegenerateRecoveryCodesJSONRequestBody defines body for RegenerateRecoveryCodes for application/json ContentType.
+type RegenerateRecoveryCodesJSONRequestBody = TwoFactorCodeRequest
+
+// VerifyTwoFactorJSONRequestBody defines body for VerifyTwoFactor for application/json ContentType.
+type VerifyTwoFactorJSONRequestBody = TwoFactorCodeRequest
+
 // DoUserOnboardingJSONRequestBody defines body for DoUserOnboarding for application/json ContentType.
 type DoUserOnboardingJSONRequestBody = UserOnboardingBody
 
+// BeginPasskeyRegistrationJSONRequestBody defines body for BeginPasskeyRegistration for application/json ContentType.
+type BeginPasskeyRegistrationJSONRequestBody = PasskeyRegistrationRequest
+
+// FinishPasskeyRegistrationJSONRequestBody defines body for FinishPasskeyRegistration for application/json ContentType.
+type FinishPasskeyRegistrationJSONRequestBody = PasskeyFinishRequest
+
+// UpdatePasskeyJSONRequestBody defines body for UpdatePasskey for application/json ContentType.
+type UpdatePasskeyJSONRequestBody = PasskeyUpdate
+
 // UpdatePasswordJSONRequestBody defines body for UpdatePassword for application/json ContentType.
 type UpdatePasswordJSONRequestBody = UserPasswordUpdate
 
@@ -1661,6 +3567,24 @@ type UpdateUserSettingJSONRequestBody UpdateUserSettingJSONBody
 // UpdateUserSettingsBatchJSONRequestBody defines body for UpdateUserSettingsBatch for application/json ContentType.
 type UpdateUserSettingsBatchJSONRequestBody = UserSettingUpdateRequest
 
+// CreateGroupJSONRequestBody defines body for CreateGroup for application/json ContentType.
+type CreateGroupJSONRequestBody = GroupCreate
+
+// UpdateGroupJSONRequestBody defines body for UpdateGroup for application/json ContentType.
+type UpdateGroupJSONRequestBody = GroupUpdate
+
+// AddGroupMemberJSONRequestBody defines body for AddGroupMember for application/json ContentType.
+type AddGroupMemberJSONRequestBody = GroupMemberCreate
+
+// UpdateGroupMemberJSONRequestBody defines body for UpdateGroupMember for application/json ContentType.
+type UpdateGroupMemberJSONRequestBody = GroupMemberUpdate
+
+// CreateOAuthClientJSONRequestBody defines body for CreateOAuthClient for application/json ContentType.
+type CreateOAuthClientJSONRequestBody = OAuthClientCreate
+
+// UpdateOAuthClientJSONRequestBody defines body for UpdateOAuthClient for application/json ContentType.
+type UpdateOAuthClientJSONRequestBody = OAuthClientUpdate
+
 // AdminCreateUserJSONRequestBody defines body for AdminCreateUser for application/json ContentType.
 type AdminCreateUserJSONRequestBody = AdminUserCreate
 
@@ -1673,9 +3597,27 @@ type AdminUpdateUserJSONRequestBody = AdminUserUpdate
 // CreateApiKeyJSONRequestBody defines body for CreateApiKey for application/json ContentType.
 type CreateApiKeyJSONRequestBody = APIKeyCreate
 
+// VerifyEmailJSONRequestBody defines body for VerifyEmail for application/json ContentType.
+type VerifyEmailJSONRequestBody = EmailVerifyRequest
+
 // LoginJSONRequestBody defines body for Login for application/json ContentType.
 type LoginJSONRequestBody LoginJSONBody
 
+// LoginTwoFactorJSONRequestBody defines body for LoginTwoFactor for application/json ContentType.
+type LoginTwoFactorJSONRequestBody = LoginTwoFactorRequest
+
+// BeginPasskeySecondFactorJSONRequestBody defines body for BeginPasskeySecondFactor for application/json ContentType.
+type BeginPasskeySecondFactorJSONRequestBody = PasskeySecondFactorRequest
+
+// FinishPasskeyLoginJSONRequestBody defines body for FinishPasskeyLogin for application/json ContentType.
+type FinishPasskeyLoginJSONRequestBody = PasskeyFinishRequest
+
+// RequestPasswordResetJSONRequestBody defines body for RequestPasswordReset for application/json ContentType.
+type RequestPasswordResetJSONRequestBody = PasswordForgotRequest
+
+// ResetPasswordJSONRequestBody defines body for ResetPassword for application/json ContentType.
+type ResetPasswordJSONRequestBody = PasswordResetRequest
+
 // CreateCollectionJSONRequestBody defines body for CreateCollection for application/json ContentType.
 type CreateCollectionJSONRequestBody = CollectionCreate
 
@@ -1688,18 +3630,48 @@ type DeleteCollectionImagesJSONRequestBody DeleteCollectionImagesJSONBody
 // AddCollectionImagesJSONRequestBody defines body for AddCollectionImages for application/json ContentType.
 type AddCollectionImagesJSONRequestBody AddCollectionImagesJSONBody
 
+// CreateProofingCollectionJSONRequestBody defines body for CreateProofingCollection for application/json ContentType.
+type CreateProofingCollectionJSONRequestBody = ProofingCollectionCreate
+
+// CreateCollectionShareJSONRequestBody defines body for CreateCollectionShare for application/json ContentType.
+type CreateCollectionShareJSONRequestBody = CollectionShareCreate
+
+// UpdateCollectionShareJSONRequestBody defines body for UpdateCollectionShare for application/json ContentType.
+type UpdateCollectionShareJSONRequestBody = CollectionShareUpdate
+
+// CreateUploadLinkJSONRequestBody defines body for CreateUploadLink for application/json ContentType.
+type CreateUploadLinkJSONRequestBody = UploadLinkCreate
+
 // DownloadImagesJSONRequestBody defines body for DownloadImages for application/json ContentType.
 type DownloadImagesJSONRequestBody = DownloadRequest
 
+// CreateExportJSONRequestBody defines body for CreateExport for application/json ContentType.
+type CreateExportJSONRequestBody = ExportCreate
+
 // SignDownloadJSONRequestBody defines body for SignDownload for application/json ContentType.
 type SignDownloadJSONRequestBody = SignDownloadRequest
 
+// UpdateDownloadTokenJSONRequestBody defines body for UpdateDownloadToken for application/json ContentType.
+type UpdateDownloadTokenJSONRequestBody = DownloadTokenUpdate
+
 // BroadcastWSEventJSONRequestBody defines body for BroadcastWSEvent for application/json ContentType.
 type BroadcastWSEventJSONRequestBody = WSBroadcastRequest
 
 // SendToWSClientJSONRequestBody defines body for SendToWSClient for application/json ContentType.
 type SendToWSClientJSONRequestBody = WSBroadcastRequest
 
+// FederationHandshakeJSONRequestBody defines body for FederationHandshake for application/json ContentType.
+type FederationHandshakeJSONRequestBody = FederationHandshake
+
+// CreateCollectionMirrorJSONRequestBody defines body for CreateCollectionMirror for application/json ContentType.
+type CreateCollectionMirrorJSONRequestBody = CollectionMirrorCreate
+
+// CreateFederationPeerJSONRequestBody defines body for CreateFederationPeer for application/json ContentType.
+type CreateFederationPeerJSONRequestBody = FederationPeerCreate
+
+// UpdateFederationPeerJSONRequestBody defines body for UpdateFederationPeer for application/json ContentType.
+type UpdateFederationPeerJSONRequestBody = FederationPeerUpdate
+
 // DeleteImagesBulkJSONRequestBody defines body for DeleteImagesBulk for application/json ContentType.
 type DeleteImagesBulkJSONRequestBody DeleteImagesBulkJSONBody
 
@@ -1712,12 +3684,36 @@ type UploadImageByUrlTextRequestBody = UploadImageByUrlTextBody
 // UpdateImageJSONRequestBody defines body for UpdateImage for application/json ContentType.
 type UpdateImageJSONRequestBody = ImageUpdate
 
+// CreateSignedImageUrlJSONRequestBody defines body for CreateSignedImageUrl for application/json ContentType.
+type CreateSignedImageUrlJSONRequestBody = SignedImageURLCreate
+
 // CreateJobJSONRequestBody defines body for CreateJob for application/json ContentType.
 type CreateJobJSONRequestBody = WorkerJobCreateRequest
 
 // RegisterWorkerJSONRequestBody defines body for RegisterWorker for application/json ContentType.
 type RegisterWorkerJSONRequestBody = WorkerRegisterRequest
 
+// DecideOAuthConsentRequestJSONRequestBody defines body for DecideOAuthConsentRequest for application/json ContentType.
+type DecideOAuthConsentRequestJSONRequestBody = OAuthConsentDecision
+
+// OauthRevokeFormdataRequestBody defines body for OauthRevoke for application/x-www-form-urlencoded ContentType.
+type OauthRevokeFormdataRequestBody = OAuthRevokeRequest
+
+// OauthTokenFormdataRequestBody defines body for OauthToken for application/x-www-form-urlencoded ContentType.
+type OauthTokenFormdataRequestBody = OAuthTokenRequest
+
+// CreateShareGuestJSONRequestBody defines body for CreateShareGuest for application/json ContentType.
+type CreateShareGuestJSONRequestBody = ShareGuestCreate
+
+// MarkProofingImageJSONRequestBody defines body for MarkProofingImage for application/json ContentType.
+type MarkProofingImageJSONRequestBody = ProofingMarkUpdate
+
+// CreateProofingCommentJSONRequestBody defines body for CreateProofingComment for application/json ContentType.
+type CreateProofingCommentJSONRequestBody = ProofingCommentCreate
+
+// UploadThroughLinkMultipartRequestBody defines body for UploadThroughLink for multipart/form-data ContentType.
+type UploadThroughLinkMultipartRequestBody = PublicUploadRequest
+
 // UpdateSessionJSONRequestBody defines body for UpdateSession for application/json ContentType.
 type UpdateSessionJSONRequestBody = SessionUpdate
 
@@ -4,6 +4,8 @@ package entities
 // generation and can be used to add fields that shouldn't appear in the DTOs
 // produced by the OpenAPI generator.
 
+import "time"
+
 // UserWithPassword embeds the generated User entity and adds a Password field
 // for internal/auth storage. GORM will AutoMigrate this type and add the
 // `password` column to the existing `users` table.
@@ -28,7 +30,279 @@ func FromUser(u User, password *string) UserWithPassword {
 	return UserWithPassword{User: u, Password: password}
 }
 
+// SessionWithToken embeds the generated Session entity and adds the hash of
+// its token. The token itself only lives in the client's cookie.
+type SessionWithToken struct {
+	Session
+	TokenHash string `gorm:"uniqueIndex"`
+}
+
+// TableName ensures GORM uses the same table as the generated Session type.
+func (SessionWithToken) TableName() string {
+	return "sessions"
+}
+
 // TableName overrides the default GORM table name (image_assets) to keep using "images".
 func (ImageAsset) TableName() string {
 	return "images"
 }
+
+// QueueMessage is a message waiting in the Postgres-backed job queue. It is
+// internal to the queue and never exposed through the API, so it has no DTO.
+// A message is invisible to other consumers while VisibleAt is in the future,
+// which is how a consumer holds its lease on it.
+type QueueMessage struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Uuid      string    `gorm:"index"`
+	Topic     string    `gorm:"index:idx_queue_messages_topic_visible,priority:1"`
+	VisibleAt time.Time `gorm:"index:idx_queue_messages_topic_visible,priority:2"`
+	Payload   []byte    `gorm:"type:bytea"`
+	// Metadata holds the Watermill message metadata encoded as JSON.
+	Metadata string `gorm:"type:text"`
+	Attempts int
+}
+
+// UserTOTP holds a user's TOTP secret. The secret has to be readable to
+// check codes, so it lives in its own table rather than on User, where it
+// would end up in the DTO. A row with Enabled false is an enrollment that
+// hasn't been confirmed yet.
+type UserTOTP struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserUid   string `gorm:"uniqueIndex"`
+	Secret    string
+	Enabled   bool
+	EnabledAt *time.Time
+	// LastUsedStep is the time step of the last accepted code, so the same
+	// code can't be used twice.
+	LastUsedStep int64
+}
+
+// TableName keeps GORM from pluralising to "user_totps".
+func (UserTOTP) TableName() string {
+	return "user_totp"
+}
+
+// RecoveryCode is a hashed one-time code that can stand in for a TOTP code.
+type RecoveryCode struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UserUid   string `gorm:"index"`
+	CodeHash  string `gorm:"uniqueIndex"`
+	UsedAt    *time.Time
+}
+
+// LoginChallenge is issued by the password step of a two-factor login and
+// exchanged for a session once the second factor checks out. Only the hash
+// of the token is stored.
+type LoginChallenge struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	TokenHash string `gorm:"uniqueIndex"`
+	UserUid   string `gorm:"index"`
+	ExpiresAt time.Time
+	Attempts  int
+	// RememberMe carries the choice made at /auth/login over to the session.
+	RememberMe bool
+}
+
+// PasskeyWithCredential embeds the generated Passkey entity and adds the
+// WebAuthn credential behind it, which never leaves the server.
+type PasskeyWithCredential struct {
+	Passkey
+	UserUid         string `gorm:"index"`
+	CredentialID    []byte `gorm:"uniqueIndex"`
+	PublicKey       []byte
+	AttestationType string
+	// Transports is a comma-separated list of AuthenticatorTransport values.
+	Transports   string
+	AAGUID       []byte
+	SignCount    uint32
+	UserVerified bool
+	BackupState  bool
+	// CloneWarning is set when the authenticator's sign count went
+	// backwards, which suggests the credential was copied.
+	CloneWarning bool
+}
+
+// TableName ensures GORM uses the same table as the generated Passkey type.
+func (PasskeyWithCredential) TableName() string {
+	return "passkeys"
+}
+
+// WebAuthnCeremony holds the server side of a WebAuthn registration or login
+// between its begin and finish calls. Only the hash of the ceremony ID given
+// to the client is stored.
+type WebAuthnCeremony struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	TokenHash string `gorm:"uniqueIndex"`
+	// Purpose is registration, login or second_factor.
+	Purpose string
+	// UserUid is empty for a discoverable login, where the user isn't known
+	// until the assertion comes back.
+	UserUid string `gorm:"index"`
+	// Name is the name for the passkey being registered.
+	Name string
+	// SessionData is the library's webauthn.SessionData, as JSON.
+	SessionData string `gorm:"type:text"`
+	ExpiresAt   time.Time
+}
+
+// UserIdentity links a user to their account at an OpenID Connect provider.
+// Users are matched by (Provider, Subject) on later logins, never by email,
+// which the provider may let people change.
+type UserIdentity struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserUid   string `gorm:"index"`
+	Provider  string `gorm:"uniqueIndex:idx_user_identities_provider_subject"`
+	Subject   string `gorm:"uniqueIndex:idx_user_identities_provider_subject"`
+	// Email is the email the provider last reported, for display only.
+	Email       string
+	LastLoginAt *time.Time
+}
+
+// OIDCLoginState holds an OpenID Connect login between the redirect to the
+// provider and the callback. Only the hash of the state parameter is stored.
+type OIDCLoginState struct {
+	ID           uint `gorm:"primarykey"`
+	CreatedAt    time.Time
+	StateHash    string `gorm:"uniqueIndex"`
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	RedirectTo   string
+	RememberMe   bool
+	ExpiresAt    time.Time
+}
+
+// EmailToken is a single-use token sent by email, for a password reset or
+// to confirm an address. Only the hash of the token is stored.
+type EmailToken struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	TokenHash string `gorm:"uniqueIndex"`
+	UserUid   string `gorm:"index"`
+	// Purpose is password_reset or verify_email.
+	Purpose string
+	// Email is the address the token was sent to. For verify_email it is the
+	// address being confirmed.
+	Email     string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// TableName keeps GORM from naming the table "o_auth_clients".
+func (OAuthClient) TableName() string {
+	return "oauth_clients"
+}
+
+// OAuthClientWithSecret embeds the generated OAuthClient and adds the hash of
+// a confidential client's secret, which never leaves the server.
+type OAuthClientWithSecret struct {
+	OAuthClient
+	SecretHash string
+}
+
+// TableName ensures GORM uses the same table as the generated OAuthClient type.
+func (OAuthClientWithSecret) TableName() string {
+	return "oauth_clients"
+}
+
+// OAuthAuthorizationRequest holds an OAuth2 authorization from
+// /oauth/authorize until the user decides on it, and then until the code it
+// ends in is exchanged for tokens. Only the hashes of the request ID and the
+// code are stored.
+type OAuthAuthorizationRequest struct {
+	ID            uint `gorm:"primarykey"`
+	CreatedAt     time.Time
+	RequestHash   string `gorm:"uniqueIndex"`
+	ClientUid     string `gorm:"index"`
+	RedirectURI   string
+	Scopes        []string `gorm:"serializer:json;type:text"`
+	State         string
+	CodeChallenge string
+	// UserUid and CodeHash are set when the user approves.
+	UserUid   string  `gorm:"index"`
+	CodeHash  *string `gorm:"uniqueIndex"`
+	ExpiresAt time.Time
+}
+
+// OAuthToken is an access token issued to an OAuth2 client, with the
+// refresh token that replaces it. Refreshing revokes the token and issues a
+// new one in the same grant, so a refresh token used twice gives away a
+// stolen copy and gets the whole grant revoked. Only the hashes of the
+// tokens are stored.
+type OAuthToken struct {
+	ID               uint `gorm:"primarykey"`
+	CreatedAt        time.Time
+	GrantUid         string   `gorm:"index"`
+	ClientUid        string   `gorm:"index"`
+	UserUid          string   `gorm:"index"`
+	User             *User    `gorm:"foreignKey:UserUid;references:Uid"`
+	Scopes           []string `gorm:"serializer:json;type:text"`
+	AccessTokenHash  string   `gorm:"uniqueIndex"`
+	AccessExpiresAt  time.Time
+	RefreshTokenHash *string `gorm:"uniqueIndex"`
+	RefreshExpiresAt *time.Time
+	// GrantedAt is when the user approved the grant, kept across refreshes.
+	GrantedAt  time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+// ShareGuestWithKey embeds the generated ShareGuest and adds the share link
+// the guest joined through and the hash of their guest token.
+type ShareGuestWithKey struct {
+	ShareGuest
+	ShareUid string `gorm:"index"`
+	KeyHash  string `gorm:"uniqueIndex"`
+}
+
+// TableName ensures GORM uses the same table as the generated ShareGuest type.
+func (ShareGuestWithKey) TableName() string {
+	return "share_guests"
+}
+
+// AnalyticsEvent is a single view or download, kept until it has been added
+// up into AnalyticsDailyStat and its retention period is over.
+type AnalyticsEvent struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	// Day is the UTC date of the event as YYYY-MM-DD, which events are
+	// added up by.
+	Day string `gorm:"index"`
+	// Kind is view or download.
+	Kind          string
+	ImageUid      *string
+	CollectionUid *string
+	// ShareToken is the share link or download token the event came
+	// through, if any.
+	ShareToken *string
+	// Visitor is the hashed IP address of the visitor, or nil if IP hashing
+	// is off.
+	Visitor  *string
+	RolledUp bool `gorm:"index"`
+}
+
+// AnalyticsDailyStat counts the views or downloads of an image, collection
+// or share link on one day. Each distinct combination of the three is
+// counted separately, so an image viewed through a share link and on its
+// own has two rows for the day.
+type AnalyticsDailyStat struct {
+	ID            uint   `gorm:"primarykey"`
+	Day           string `gorm:"index"`
+	Kind          string
+	ImageUid      *string `gorm:"index"`
+	CollectionUid *string `gorm:"index"`
+	ShareToken    *string `gorm:"index"`
+	Count         int64
+	// Visitors is the number of unique visitors on the day, or 0 if IP
+	// hashing is off.
+	Visitors int64
+}
@@ -41,7 +41,25 @@ func HardDeleteUser(db *gorm.DB, userUid string) error {
 			return fmt.Errorf("failed to delete user settings: %w", err)
 		}
 
-		// 3. Delete the user record itself
+		// 3. Delete their group memberships and the collections shared with them
+		if err := tx.Unscoped().Where("user_id = ?", userUid).Delete(&GroupMember{}).Error; err != nil {
+			return fmt.Errorf("failed to delete user group memberships: %w", err)
+		}
+
+		if err := tx.Unscoped().Where("user_id = ?", userUid).Delete(&CollectionShare{}).Error; err != nil {
+			return fmt.Errorf("failed to delete user collection shares: %w", err)
+		}
+
+		// 4. Delete the tokens and pending consent of the apps they authorized
+		if err := tx.Where("user_uid = ?", userUid).Delete(&OAuthToken{}).Error; err != nil {
+			return fmt.Errorf("failed to delete user oauth tokens: %w", err)
+		}
+
+		if err := tx.Where("user_uid = ?", userUid).Delete(&OAuthAuthorizationRequest{}).Error; err != nil {
+			return fmt.Errorf("failed to delete user oauth requests: %w", err)
+		}
+
+		// 5. Delete the user record itself
 		if err := tx.Unscoped().Where("uid = ?", userUid).Delete(&User{}).Error; err != nil {
 			return fmt.Errorf("failed to delete user: %w", err)
 		}
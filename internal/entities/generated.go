@@ -13,6 +13,10 @@ type WorkerJob struct {
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	// Attempts Number of times the job has been started
+	Attempts int
+	// BatchUid UID of the batch this job belongs to, if any
+	BatchUid *string `gorm:"index:idx_worker_jobs_batch_uid,priority:1"`
 	// Command Job command
 	Command *string
 	// CompletedAt Completed timestamp
@@ -23,10 +27,14 @@ type WorkerJob struct {
 	ErrorCode *string
 	// ErrorMsg Error message if failed
 	ErrorMsg *string
+	// HeartbeatAt Last heartbeat from the worker running the job
+	HeartbeatAt *time.Time
 	// ImageUid Related image UID
 	ImageUid *string
 	// Payload Job payload
 	Payload *string
+	// Priority Priority lane the job was queued on (interactive, normal or bulk)
+	Priority *string
 	// StartedAt Started timestamp
 	StartedAt *time.Time
 	// Status Job status
@@ -41,13 +49,17 @@ type WorkerJob struct {
 
 func (e WorkerJob) DTO() dto.WorkerJob {
 	return dto.WorkerJob{
+		Attempts:    e.Attempts,
+		BatchUid:    e.BatchUid,
 		Command:     e.Command,
 		CompletedAt: e.CompletedAt,
 		EnqueuedAt:  e.EnqueuedAt,
 		ErrorCode:   e.ErrorCode,
 		ErrorMsg:    e.ErrorMsg,
+		HeartbeatAt: e.HeartbeatAt,
 		ImageUid:    e.ImageUid,
 		Payload:     e.Payload,
+		Priority:    e.Priority,
 		StartedAt:   e.StartedAt,
 		Status:      e.Status,
 		Topic:       e.Topic,
@@ -58,13 +70,17 @@ func (e WorkerJob) DTO() dto.WorkerJob {
 
 func WorkerJobFromDTO(d dto.WorkerJob) WorkerJob {
 	return WorkerJob{
+		Attempts:    d.Attempts,
+		BatchUid:    d.BatchUid,
 		Command:     d.Command,
 		CompletedAt: d.CompletedAt,
 		EnqueuedAt:  d.EnqueuedAt,
 		ErrorCode:   d.ErrorCode,
 		ErrorMsg:    d.ErrorMsg,
+		HeartbeatAt: d.HeartbeatAt,
 		ImageUid:    d.ImageUid,
 		Payload:     d.Payload,
+		Priority:    d.Priority,
 		StartedAt:   d.StartedAt,
 		Status:      d.Status,
 		Topic:       d.Topic,
@@ -81,12 +97,18 @@ type User struct {
 	UpdatedAt time.Time
 	// Email Email
 	Email string
+	// EmailVerified Whether the user has confirmed they own their email address
+	EmailVerified bool
 	// FirstName First name
 	FirstName string
 	// LastName Last name
 	LastName string
+	// PendingEmail New email address waiting to be confirmed. The email only changes once the link sent to this address is opened.
+	PendingEmail *string
 	// Role User role
 	Role dto.UserRole `gorm:"type:text"`
+	// TwoFactorEnabled Whether the user has two-factor authentication enabled, by TOTP or a passkey
+	TwoFactorEnabled bool
 	// Uid User UID
 	Uid string `gorm:"uniqueIndex"`
 	// Username Username
@@ -95,27 +117,33 @@ type User struct {
 
 func (e User) DTO() dto.User {
 	return dto.User{
-		CreatedAt: e.CreatedAt,
-		UpdatedAt: e.UpdatedAt,
-		Email:     e.Email,
-		FirstName: e.FirstName,
-		LastName:  e.LastName,
-		Role:      e.Role,
-		Uid:       e.Uid,
-		Username:  e.Username,
+		CreatedAt:        e.CreatedAt,
+		UpdatedAt:        e.UpdatedAt,
+		Email:            e.Email,
+		EmailVerified:    e.EmailVerified,
+		FirstName:        e.FirstName,
+		LastName:         e.LastName,
+		PendingEmail:     e.PendingEmail,
+		Role:             e.Role,
+		TwoFactorEnabled: e.TwoFactorEnabled,
+		Uid:              e.Uid,
+		Username:         e.Username,
 	}
 }
 
 func UserFromDTO(d dto.User) User {
 	return User{
-		CreatedAt: d.CreatedAt,
-		UpdatedAt: d.UpdatedAt,
-		Email:     d.Email,
-		FirstName: d.FirstName,
-		LastName:  d.LastName,
-		Role:      d.Role,
-		Uid:       d.Uid,
-		Username:  d.Username,
+		CreatedAt:        d.CreatedAt,
+		UpdatedAt:        d.UpdatedAt,
+		Email:            d.Email,
+		EmailVerified:    d.EmailVerified,
+		FirstName:        d.FirstName,
+		LastName:         d.LastName,
+		PendingEmail:     d.PendingEmail,
+		Role:             d.Role,
+		TwoFactorEnabled: d.TwoFactorEnabled,
+		Uid:              d.Uid,
+		Username:         d.Username,
 	}
 }
 
@@ -137,7 +165,9 @@ type CollectionDetailResponse struct {
 	OwnerID *string
 	Owner   *User `gorm:"foreignKey:OwnerID;references:Uid"`
 	// Private Is private
-	Private     *bool
+	Private *bool
+	// Role The caller's role on the collection. Absent when the caller can only see it because it is public.
+	Role        *dto.CollectionDetailResponseRole `gorm:"serializer:json;type:JSONB"`
 	ThumbnailID *string
 	Thumbnail   *ImageAsset `gorm:"foreignKey:ThumbnailID;references:Uid"`
 	// Uid Collection UID
@@ -167,6 +197,7 @@ func (e CollectionDetailResponse) DTO() dto.CollectionDetailResponse {
 			return nil
 		}(),
 		Private: e.Private,
+		Role:    e.Role,
 		Thumbnail: func() *dto.ImageAsset {
 			if e.Thumbnail != nil {
 				d := e.Thumbnail.DTO()
@@ -199,6 +230,7 @@ func CollectionDetailResponseFromDTO(d dto.CollectionDetailResponse) CollectionD
 			return nil
 		}(),
 		Private: d.Private,
+		Role:    d.Role,
 		ThumbnailID: func() *string {
 			if d.Thumbnail != nil {
 				return &d.Thumbnail.Uid
@@ -225,10 +257,15 @@ type Collection struct {
 	ImageCount int
 	// Images List of images
 	Images *[]dto.CollectionImage `gorm:"serializer:json;type:JSONB"`
+	// MirrorUid Mirror keeping this collection in sync with one on another server. Mirrored collections are read-only
+	MirrorUid *string
 	// Name Collection name
-	Name    string
-	OwnerID *string
-	Owner   *User `gorm:"foreignKey:OwnerID;references:Uid"`
+	Name         string
+	OwnerID      *string
+	Owner        *User `gorm:"foreignKey:OwnerID;references:Uid"`
+	OwnerGroupID *string
+	// OwnerGroup A team of users who own images and collections together.
+	OwnerGroup *Group `gorm:"foreignKey:OwnerGroupID;references:Uid"`
 	// Private Is private
 	Private     *bool
 	ThumbnailID *string
@@ -252,6 +289,7 @@ func (e Collection) DTO() dto.Collection {
 		Favourited:  e.Favourited,
 		ImageCount:  e.ImageCount,
 		Images:      e.Images,
+		MirrorUid:   e.MirrorUid,
 		Name:        e.Name,
 		Owner: func() *dto.User {
 			if e.Owner != nil {
@@ -260,6 +298,13 @@ func (e Collection) DTO() dto.Collection {
 			}
 			return nil
 		}(),
+		OwnerGroup: func() *dto.Group {
+			if e.OwnerGroup != nil {
+				d := e.OwnerGroup.DTO()
+				return &d
+			}
+			return nil
+		}(),
 		Private: e.Private,
 		Thumbnail: func() *dto.ImageAsset {
 			if e.Thumbnail != nil {
@@ -286,6 +331,7 @@ func CollectionFromDTO(d dto.Collection) Collection {
 		Favourited:  d.Favourited,
 		ImageCount:  d.ImageCount,
 		Images:      d.Images,
+		MirrorUid:   d.MirrorUid,
 		Name:        d.Name,
 		OwnerID: func() *string {
 			if d.Owner != nil {
@@ -293,6 +339,12 @@ func CollectionFromDTO(d dto.Collection) Collection {
 			}
 			return nil
 		}(),
+		OwnerGroupID: func() *string {
+			if d.OwnerGroup != nil {
+				return &d.OwnerGroup.Uid
+			}
+			return nil
+		}(),
 		Private: d.Private,
 		ThumbnailID: func() *string {
 			if d.Thumbnail != nil {
@@ -350,9 +402,12 @@ type ImageAsset struct {
 	ImageMetadata *dto.ImageMetadata `gorm:"serializer:json;type:JSONB"`
 	ImagePaths    dto.ImagePaths     `gorm:"serializer:json;type:JSONB"`
 	// Name Image name
-	Name    string
-	OwnerID *string
-	Owner   *User `gorm:"foreignKey:OwnerID;references:Uid"`
+	Name         string
+	OwnerID      *string
+	Owner        *User `gorm:"foreignKey:OwnerID;references:Uid"`
+	OwnerGroupID *string
+	// OwnerGroup A team of users who own images and collections together.
+	OwnerGroup *Group `gorm:"foreignKey:OwnerGroupID;references:Uid"`
 	// Private Is private
 	Private bool
 	// Processed Is processed
@@ -360,9 +415,13 @@ type ImageAsset struct {
 	// TakenAt Taken time
 	TakenAt *time.Time
 	// Uid Image UID
-	Uid          string `gorm:"uniqueIndex"`
-	UploadedByID *string
-	UploadedBy   *User `gorm:"foreignKey:UploadedByID;references:Uid"`
+	Uid string `gorm:"uniqueIndex"`
+	// UploadLinkUid Upload link the image was uploaded through
+	UploadLinkUid *string
+	UploadedByID  *string
+	UploadedBy    *User `gorm:"foreignKey:UploadedByID;references:Uid"`
+	// UploaderName Who sent the image, for images uploaded through an upload link
+	UploaderName *string
 	// Width Image width
 	Width int32
 }
@@ -385,10 +444,18 @@ func (e ImageAsset) DTO() dto.ImageAsset {
 			}
 			return nil
 		}(),
-		Private:   e.Private,
-		Processed: e.Processed,
-		TakenAt:   e.TakenAt,
-		Uid:       e.Uid,
+		OwnerGroup: func() *dto.Group {
+			if e.OwnerGroup != nil {
+				d := e.OwnerGroup.DTO()
+				return &d
+			}
+			return nil
+		}(),
+		Private:       e.Private,
+		Processed:     e.Processed,
+		TakenAt:       e.TakenAt,
+		Uid:           e.Uid,
+		UploadLinkUid: e.UploadLinkUid,
 		UploadedBy: func() *dto.User {
 			if e.UploadedBy != nil {
 				d := e.UploadedBy.DTO()
@@ -396,7 +463,8 @@ func (e ImageAsset) DTO() dto.ImageAsset {
 			}
 			return nil
 		}(),
-		Width: e.Width,
+		UploaderName: e.UploaderName,
+		Width:        e.Width,
 	}
 }
 
@@ -417,17 +485,25 @@ func ImageAssetFromDTO(d dto.ImageAsset) ImageAsset {
 			}
 			return nil
 		}(),
-		Private:   d.Private,
-		Processed: d.Processed,
-		TakenAt:   d.TakenAt,
-		Uid:       d.Uid,
+		OwnerGroupID: func() *string {
+			if d.OwnerGroup != nil {
+				return &d.OwnerGroup.Uid
+			}
+			return nil
+		}(),
+		Private:       d.Private,
+		Processed:     d.Processed,
+		TakenAt:       d.TakenAt,
+		Uid:           d.Uid,
+		UploadLinkUid: d.UploadLinkUid,
 		UploadedByID: func() *string {
 			if d.UploadedBy != nil {
 				return &d.UploadedBy.Uid
 			}
 			return nil
 		}(),
-		Width: d.Width,
+		UploaderName: d.UploaderName,
+		Width:        d.Width,
 	}
 }
 
@@ -437,36 +513,66 @@ type DownloadToken struct {
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	// AccessCount Times the token has been opened or downloaded with. The images of a gallery loading aren't counted
+	AccessCount *int64
 	// AllowDownload Whether downloads are permitted with this token
 	AllowDownload bool
 	// AllowEmbed Whether embedding on external sites is allowed (false prevents hotlinking)
 	AllowEmbed bool
+	// AllowProofing Whether share link recipients can pick, heart and comment on images
+	AllowProofing *bool
+	// CollectionUid Collection this token shares. Its images are looked up each time the token is used
+	CollectionUid *string
+	CreatedByID   *string
+	CreatedBy     *User `gorm:"foreignKey:CreatedByID;references:Uid"`
 	// Description Optional description of this download link
 	Description *string
 	// ExpiresAt When this token expires (null for no expiry)
 	ExpiresAt *time.Time
-	// ImageUids Array of authorized image UIDs
+	// HasPassword Whether the token needs a password
+	HasPassword *bool
+	// ImageUids Array of authorized image UIDs. Empty for collection share links
 	ImageUids []string `gorm:"serializer:json;type:JSONB"`
-	// Password Optional bcrypt hash of password (null if no password protection)
+	// LastUsedAt When the token was last opened or downloaded with
+	LastUsedAt *time.Time
+	// MaxUses Downloads allowed before the token stops working (null for no limit)
+	MaxUses *int
+	// Password Optional bcrypt hash of password (null if no password protection). Never sent to clients
 	Password *string
 	// ShowMetadata Whether to include EXIF and metadata in responses
 	ShowMetadata bool
 	// Uid 64-character hex token that serves as both unique identifier and authorization key
 	Uid string `gorm:"uniqueIndex"`
+	// UseCount Downloads made with the token
+	UseCount *int
 }
 
 func (e DownloadToken) DTO() dto.DownloadToken {
 	return dto.DownloadToken{
 		CreatedAt:     e.CreatedAt,
 		UpdatedAt:     e.UpdatedAt,
+		AccessCount:   e.AccessCount,
 		AllowDownload: e.AllowDownload,
 		AllowEmbed:    e.AllowEmbed,
-		Description:   e.Description,
-		ExpiresAt:     e.ExpiresAt,
-		ImageUids:     e.ImageUids,
-		Password:      e.Password,
-		ShowMetadata:  e.ShowMetadata,
-		Uid:           e.Uid,
+		AllowProofing: e.AllowProofing,
+		CollectionUid: e.CollectionUid,
+		CreatedBy: func() *dto.User {
+			if e.CreatedBy != nil {
+				d := e.CreatedBy.DTO()
+				return &d
+			}
+			return nil
+		}(),
+		Description:  e.Description,
+		ExpiresAt:    e.ExpiresAt,
+		HasPassword:  e.HasPassword,
+		ImageUids:    e.ImageUids,
+		LastUsedAt:   e.LastUsedAt,
+		MaxUses:      e.MaxUses,
+		Password:     e.Password,
+		ShowMetadata: e.ShowMetadata,
+		Uid:          e.Uid,
+		UseCount:     e.UseCount,
 	}
 }
 
@@ -474,14 +580,27 @@ func DownloadTokenFromDTO(d dto.DownloadToken) DownloadToken {
 	return DownloadToken{
 		CreatedAt:     d.CreatedAt,
 		UpdatedAt:     d.UpdatedAt,
+		AccessCount:   d.AccessCount,
 		AllowDownload: d.AllowDownload,
 		AllowEmbed:    d.AllowEmbed,
-		Description:   d.Description,
-		ExpiresAt:     d.ExpiresAt,
-		ImageUids:     d.ImageUids,
-		Password:      d.Password,
-		ShowMetadata:  d.ShowMetadata,
-		Uid:           d.Uid,
+		AllowProofing: d.AllowProofing,
+		CollectionUid: d.CollectionUid,
+		CreatedByID: func() *string {
+			if d.CreatedBy != nil {
+				return &d.CreatedBy.Uid
+			}
+			return nil
+		}(),
+		Description:  d.Description,
+		ExpiresAt:    d.ExpiresAt,
+		HasPassword:  d.HasPassword,
+		ImageUids:    d.ImageUids,
+		LastUsedAt:   d.LastUsedAt,
+		MaxUses:      d.MaxUses,
+		Password:     d.Password,
+		ShowMetadata: d.ShowMetadata,
+		Uid:          d.Uid,
+		UseCount:     d.UseCount,
 	}
 }
 
@@ -532,6 +651,10 @@ type APIKey struct {
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	// AllowedCidrs IP ranges the key may be used from. Empty means anywhere
+	AllowedCidrs *[]string `gorm:"serializer:json;type:JSONB"`
+	// AllowedCollections UIDs of the collections the key is limited to. Empty means it isn't limited
+	AllowedCollections *[]string `gorm:"serializer:json;type:JSONB"`
 	// Description API Key description
 	Description *string
 	// ExpiresAt Expiry time
@@ -542,6 +665,18 @@ type APIKey struct {
 	LastUsedAt *time.Time
 	// Name API Key name
 	Name *string
+	// QuotaLimit Requests allowed per quota period. Null means unlimited
+	QuotaLimit *int
+	// QuotaPeriod Period the quota resets after, in UTC
+	QuotaPeriod *dto.APIKeyQuotaPeriod `gorm:"serializer:json;type:JSONB"`
+	// QuotaPeriodStart Start of the quota period quota_used counts
+	QuotaPeriodStart *time.Time
+	// QuotaUsed Requests made in the current quota period
+	QuotaUsed *int
+	// ReadOnly Only allows GET and HEAD requests, even when the key belongs to an admin
+	ReadOnly *bool
+	// RequestCount Requests ever made with the key
+	RequestCount *int64
 	// Revoked Is revoked
 	Revoked bool
 	// RevokedAt Revocation time
@@ -556,17 +691,25 @@ type APIKey struct {
 
 func (e APIKey) DTO() dto.APIKey {
 	return dto.APIKey{
-		CreatedAt:   e.CreatedAt,
-		UpdatedAt:   e.UpdatedAt,
-		Description: e.Description,
-		ExpiresAt:   e.ExpiresAt,
-		KeyHashed:   e.KeyHashed,
-		LastUsedAt:  e.LastUsedAt,
-		Name:        e.Name,
-		Revoked:     e.Revoked,
-		RevokedAt:   e.RevokedAt,
-		Scopes:      e.Scopes,
-		Uid:         e.Uid,
+		CreatedAt:          e.CreatedAt,
+		UpdatedAt:          e.UpdatedAt,
+		AllowedCidrs:       e.AllowedCidrs,
+		AllowedCollections: e.AllowedCollections,
+		Description:        e.Description,
+		ExpiresAt:          e.ExpiresAt,
+		KeyHashed:          e.KeyHashed,
+		LastUsedAt:         e.LastUsedAt,
+		Name:               e.Name,
+		QuotaLimit:         e.QuotaLimit,
+		QuotaPeriod:        e.QuotaPeriod,
+		QuotaPeriodStart:   e.QuotaPeriodStart,
+		QuotaUsed:          e.QuotaUsed,
+		ReadOnly:           e.ReadOnly,
+		RequestCount:       e.RequestCount,
+		Revoked:            e.Revoked,
+		RevokedAt:          e.RevokedAt,
+		Scopes:             e.Scopes,
+		Uid:                e.Uid,
 		User: func() *dto.User {
 			if e.User != nil {
 				d := e.User.DTO()
@@ -579,17 +722,25 @@ func (e APIKey) DTO() dto.APIKey {
 
 func APIKeyFromDTO(d dto.APIKey) APIKey {
 	return APIKey{
-		CreatedAt:   d.CreatedAt,
-		UpdatedAt:   d.UpdatedAt,
-		Description: d.Description,
-		ExpiresAt:   d.ExpiresAt,
-		KeyHashed:   d.KeyHashed,
-		LastUsedAt:  d.LastUsedAt,
-		Name:        d.Name,
-		Revoked:     d.Revoked,
-		RevokedAt:   d.RevokedAt,
-		Scopes:      d.Scopes,
-		Uid:         d.Uid,
+		CreatedAt:          d.CreatedAt,
+		UpdatedAt:          d.UpdatedAt,
+		AllowedCidrs:       d.AllowedCidrs,
+		AllowedCollections: d.AllowedCollections,
+		Description:        d.Description,
+		ExpiresAt:          d.ExpiresAt,
+		KeyHashed:          d.KeyHashed,
+		LastUsedAt:         d.LastUsedAt,
+		Name:               d.Name,
+		QuotaLimit:         d.QuotaLimit,
+		QuotaPeriod:        d.QuotaPeriod,
+		QuotaPeriodStart:   d.QuotaPeriodStart,
+		QuotaUsed:          d.QuotaUsed,
+		ReadOnly:           d.ReadOnly,
+		RequestCount:       d.RequestCount,
+		Revoked:            d.Revoked,
+		RevokedAt:          d.RevokedAt,
+		Scopes:             d.Scopes,
+		Uid:                d.Uid,
 		UserID: func() *string {
 			if d.User != nil {
 				return &d.User.Uid
@@ -659,9 +810,9 @@ type Session struct {
 	ClientId *string
 	// ClientIp Client IP
 	ClientIp *string
-	// ClientName Client name
+	// ClientName Device name, derived from the user agent at sign in unless renamed
 	ClientName *string
-	// ExpiresAt Expiry time
+	// ExpiresAt Absolute expiry. The session ends then however active it is.
 	ExpiresAt *time.Time
 	// LastActive Last active time
 	LastActive *time.Time
@@ -671,12 +822,12 @@ type Session struct {
 	LoginIp *string
 	// RefId Reference ID
 	RefId *string
+	// RememberMe Whether the session outlives the browser session. Otherwise the cookie is dropped when the browser closes and the session has a shorter absolute expiry.
+	RememberMe *bool
 	// Status Session status
 	Status *int
-	// Timeout Timeout in seconds
+	// Timeout Idle timeout in seconds. The session ends when unused for this long.
 	Timeout *int64
-	// Token Session token
-	Token string
 	// Uid Session UID
 	Uid    string `gorm:"uniqueIndex"`
 	UserID *string
@@ -699,9 +850,9 @@ func (e Session) DTO() dto.Session {
 		LoginAt:    e.LoginAt,
 		LoginIp:    e.LoginIp,
 		RefId:      e.RefId,
+		RememberMe: e.RememberMe,
 		Status:     e.Status,
 		Timeout:    e.Timeout,
-		Token:      e.Token,
 		Uid:        e.Uid,
 		User: func() *dto.User {
 			if e.User != nil {
@@ -727,9 +878,9 @@ func SessionFromDTO(d dto.Session) Session {
 		LoginAt:    d.LoginAt,
 		LoginIp:    d.LoginIp,
 		RefId:      d.RefId,
+		RememberMe: d.RememberMe,
 		Status:     d.Status,
 		Timeout:    d.Timeout,
-		Token:      d.Token,
 		Uid:        d.Uid,
 		UserID: func() *string {
 			if d.User != nil {
@@ -767,3 +918,1004 @@ func ImageUploadResponseFromDTO(d dto.ImageUploadResponse) ImageUploadResponse {
 		Uid:      d.Uid,
 	}
 }
+
+// JobBatch is a GORM entity inferred from dto.JobBatch
+type JobBatch struct {
+	ID        uint           `gorm:"primarykey" json:"-"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// Cancelled Number of jobs that were cancelled
+	Cancelled int
+	// Command Bulk command that created the batch
+	Command *string
+	// Completed Number of jobs that completed successfully
+	Completed int
+	// CompletedAt Time the last job in the batch finished
+	CompletedAt *time.Time
+	// EtaSeconds Estimated seconds until the batch finishes
+	EtaSeconds *int
+	// Failed Number of jobs that failed
+	Failed int
+	// StartedAt Time the first job in the batch started
+	StartedAt *time.Time
+	// Status Batch status (queued, running, completed, failed when every job failed, or partial when some did)
+	Status string
+	// Throughput Finished jobs per second since the batch started
+	Throughput float64
+	// Topic Job topic
+	Topic string
+	// Total Number of jobs in the batch
+	Total int
+	// Type Job type
+	Type string
+	// Uid Batch UID
+	Uid string `gorm:"uniqueIndex"`
+}
+
+func (e JobBatch) DTO() dto.JobBatch {
+	return dto.JobBatch{
+		CreatedAt:   e.CreatedAt,
+		UpdatedAt:   e.UpdatedAt,
+		Cancelled:   e.Cancelled,
+		Command:     e.Command,
+		Completed:   e.Completed,
+		CompletedAt: e.CompletedAt,
+		EtaSeconds:  e.EtaSeconds,
+		Failed:      e.Failed,
+		StartedAt:   e.StartedAt,
+		Status:      e.Status,
+		Throughput:  e.Throughput,
+		Topic:       e.Topic,
+		Total:       e.Total,
+		Type:        e.Type,
+		Uid:         e.Uid,
+	}
+}
+
+func JobBatchFromDTO(d dto.JobBatch) JobBatch {
+	return JobBatch{
+		CreatedAt:   d.CreatedAt,
+		UpdatedAt:   d.UpdatedAt,
+		Cancelled:   d.Cancelled,
+		Command:     d.Command,
+		Completed:   d.Completed,
+		CompletedAt: d.CompletedAt,
+		EtaSeconds:  d.EtaSeconds,
+		Failed:      d.Failed,
+		StartedAt:   d.StartedAt,
+		Status:      d.Status,
+		Throughput:  d.Throughput,
+		Topic:       d.Topic,
+		Total:       d.Total,
+		Type:        d.Type,
+		Uid:         d.Uid,
+	}
+}
+
+// JobAuditEntry is a GORM entity inferred from dto.JobAuditEntry
+type JobAuditEntry struct {
+	ID        uint           `gorm:"primarykey" json:"-"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// Action What was done to the job (requeued or failed)
+	Action string
+	// Attempts Number of times the job had been started
+	Attempts int
+	// JobUid UID of the job the action was taken on
+	JobUid string `gorm:"index:idx_job_audit_entries_job_uid,priority:1"`
+	// PreviousStatus Job status before the action
+	PreviousStatus string
+	// Reason Why the action was taken
+	Reason string
+	// Uid Entry UID
+	Uid string `gorm:"uniqueIndex"`
+}
+
+func (e JobAuditEntry) DTO() dto.JobAuditEntry {
+	return dto.JobAuditEntry{
+		Action:         e.Action,
+		Attempts:       e.Attempts,
+		JobUid:         e.JobUid,
+		PreviousStatus: e.PreviousStatus,
+		Reason:         e.Reason,
+		Uid:            e.Uid,
+	}
+}
+
+func JobAuditEntryFromDTO(d dto.JobAuditEntry) JobAuditEntry {
+	return JobAuditEntry{
+		Action:         d.Action,
+		Attempts:       d.Attempts,
+		JobUid:         d.JobUid,
+		PreviousStatus: d.PreviousStatus,
+		Reason:         d.Reason,
+		Uid:            d.Uid,
+	}
+}
+
+// Passkey is a GORM entity inferred from dto.Passkey
+type Passkey struct {
+	ID        uint           `gorm:"primarykey" json:"-"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// BackupEligible Whether the credential can be synced between devices
+	BackupEligible bool
+	// LastUsedAt Last time the passkey was used to sign in
+	LastUsedAt *time.Time
+	// Name Name the user gave the passkey
+	Name string
+	// Uid Passkey UID
+	Uid string `gorm:"uniqueIndex"`
+}
+
+func (e Passkey) DTO() dto.Passkey {
+	return dto.Passkey{
+		BackupEligible: e.BackupEligible,
+		LastUsedAt:     e.LastUsedAt,
+		Name:           e.Name,
+		Uid:            e.Uid,
+	}
+}
+
+func PasskeyFromDTO(d dto.Passkey) Passkey {
+	return Passkey{
+		BackupEligible: d.BackupEligible,
+		LastUsedAt:     d.LastUsedAt,
+		Name:           d.Name,
+		Uid:            d.Uid,
+	}
+}
+
+// SecurityEvent is a GORM entity inferred from dto.SecurityEvent
+type SecurityEvent struct {
+	ID        uint           `gorm:"primarykey" json:"-"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// Action What happened, e.g. lockout
+	Action string
+	// Failures Failed attempts counted so far
+	Failures int
+	// Ip Client IP of the request that triggered the event
+	Ip string
+	// Key What was locked out, e.g. ip:203.0.113.7 or account:ada@example.com
+	Key string
+	// LockoutSeconds How long the key is locked out for
+	LockoutSeconds int
+	// Scope What was being attempted, e.g. login, two_factor or download
+	Scope string
+	// Uid Event UID
+	Uid string `gorm:"uniqueIndex"`
+}
+
+func (e SecurityEvent) DTO() dto.SecurityEvent {
+	return dto.SecurityEvent{
+		Action:         e.Action,
+		Failures:       e.Failures,
+		Ip:             e.Ip,
+		Key:            e.Key,
+		LockoutSeconds: e.LockoutSeconds,
+		Scope:          e.Scope,
+		Uid:            e.Uid,
+	}
+}
+
+func SecurityEventFromDTO(d dto.SecurityEvent) SecurityEvent {
+	return SecurityEvent{
+		Action:         d.Action,
+		Failures:       d.Failures,
+		Ip:             d.Ip,
+		Key:            d.Key,
+		LockoutSeconds: d.LockoutSeconds,
+		Scope:          d.Scope,
+		Uid:            d.Uid,
+	}
+}
+
+// CollectionShare is a GORM entity inferred from dto.CollectionShare
+type CollectionShare struct {
+	ID        uint           `gorm:"primarykey" json:"-"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// CollectionUid UID of the shared collection
+	CollectionUid string
+	GroupID       *string
+	// Group A team of users who own images and collections together.
+	Group *Group `gorm:"foreignKey:GroupID;references:Uid"`
+	// Role viewer can see the collection and its images. contributor can also add images and remove the ones they added. editor can also change the collection's details and remove any image.
+	Role dto.CollectionShareRole `gorm:"type:text"`
+	// Uid Share UID
+	Uid    string `gorm:"uniqueIndex"`
+	UserID *string
+	User   *User `gorm:"foreignKey:UserID;references:Uid"`
+}
+
+func (e CollectionShare) DTO() dto.CollectionShare {
+	return dto.CollectionShare{
+		CreatedAt:     e.CreatedAt,
+		UpdatedAt:     e.UpdatedAt,
+		CollectionUid: e.CollectionUid,
+		Group: func() *dto.Group {
+			if e.Group != nil {
+				d := e.Group.DTO()
+				return &d
+			}
+			return nil
+		}(),
+		Role: e.Role,
+		Uid:  e.Uid,
+		User: func() *dto.User {
+			if e.User != nil {
+				d := e.User.DTO()
+				return &d
+			}
+			return nil
+		}(),
+	}
+}
+
+func CollectionShareFromDTO(d dto.CollectionShare) CollectionShare {
+	return CollectionShare{
+		CreatedAt:     d.CreatedAt,
+		UpdatedAt:     d.UpdatedAt,
+		CollectionUid: d.CollectionUid,
+		GroupID: func() *string {
+			if d.Group != nil {
+				return &d.Group.Uid
+			}
+			return nil
+		}(),
+		Role: d.Role,
+		Uid:  d.Uid,
+		UserID: func() *string {
+			if d.User != nil {
+				return &d.User.Uid
+			}
+			return nil
+		}(),
+	}
+}
+
+// Group is a GORM entity inferred from dto.Group
+type Group struct {
+	ID        uint           `gorm:"primarykey" json:"-"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// Description What the group is for
+	Description *string
+	// Name Group name
+	Name string
+	// Uid Group UID
+	Uid string `gorm:"uniqueIndex"`
+}
+
+func (e Group) DTO() dto.Group {
+	return dto.Group{
+		CreatedAt:   e.CreatedAt,
+		UpdatedAt:   e.UpdatedAt,
+		Description: e.Description,
+		Name:        e.Name,
+		Uid:         e.Uid,
+	}
+}
+
+func GroupFromDTO(d dto.Group) Group {
+	return Group{
+		CreatedAt:   d.CreatedAt,
+		UpdatedAt:   d.UpdatedAt,
+		Description: d.Description,
+		Name:        d.Name,
+		Uid:         d.Uid,
+	}
+}
+
+// GroupMember is a GORM entity inferred from dto.GroupMember
+type GroupMember struct {
+	ID        uint           `gorm:"primarykey" json:"-"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// GroupUid UID of the group
+	GroupUid string
+	// Role viewer can see what the group owns. member can also change it and add it to collections. owner can also delete it and decide who it is shared with.
+	Role dto.GroupMemberRole `gorm:"type:text"`
+	// Uid Membership UID
+	Uid    string `gorm:"uniqueIndex"`
+	UserID *string
+	User   *User `gorm:"foreignKey:UserID;references:Uid"`
+}
+
+func (e GroupMember) DTO() dto.GroupMember {
+	return dto.GroupMember{
+		CreatedAt: e.CreatedAt,
+		UpdatedAt: e.UpdatedAt,
+		GroupUid:  e.GroupUid,
+		Role:      e.Role,
+		Uid:       e.Uid,
+		User: func() *dto.User {
+			if e.User != nil {
+				d := e.User.DTO()
+				return &d
+			}
+			return nil
+		}(),
+	}
+}
+
+func GroupMemberFromDTO(d dto.GroupMember) GroupMember {
+	return GroupMember{
+		CreatedAt: d.CreatedAt,
+		UpdatedAt: d.UpdatedAt,
+		GroupUid:  d.GroupUid,
+		Role:      d.Role,
+		Uid:       d.Uid,
+		UserID: func() *string {
+			if d.User != nil {
+				return &d.User.Uid
+			}
+			return nil
+		}(),
+	}
+}
+
+// OAuthClient is a GORM entity inferred from dto.OAuthClient
+type OAuthClient struct {
+	ID        uint           `gorm:"primarykey" json:"-"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// Confidential Whether the app has a secret. Public apps like the CLI rely on PKCE alone
+	Confidential bool
+	// Description What the app does
+	Description *string
+	// Name App name shown on the consent screen
+	Name string
+	// RedirectUris Redirect URIs the app may use, matched exactly
+	RedirectUris []string `gorm:"serializer:json;type:JSONB"`
+	// Scopes Scopes the app may ask for
+	Scopes []string `gorm:"serializer:json;type:JSONB"`
+	// Uid Client UID, used as the OAuth2 client_id
+	Uid string `gorm:"uniqueIndex"`
+}
+
+func (e OAuthClient) DTO() dto.OAuthClient {
+	return dto.OAuthClient{
+		CreatedAt:    e.CreatedAt,
+		UpdatedAt:    e.UpdatedAt,
+		Confidential: e.Confidential,
+		Description:  e.Description,
+		Name:         e.Name,
+		RedirectUris: e.RedirectUris,
+		Scopes:       e.Scopes,
+		Uid:          e.Uid,
+	}
+}
+
+func OAuthClientFromDTO(d dto.OAuthClient) OAuthClient {
+	return OAuthClient{
+		CreatedAt:    d.CreatedAt,
+		UpdatedAt:    d.UpdatedAt,
+		Confidential: d.Confidential,
+		Description:  d.Description,
+		Name:         d.Name,
+		RedirectUris: d.RedirectUris,
+		Scopes:       d.Scopes,
+		Uid:          d.Uid,
+	}
+}
+
+// PublicCollection is a GORM entity inferred from dto.PublicCollection
+type PublicCollection struct {
+	ID          uint           `gorm:"primarykey" json:"-"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Description *string
+	ImageCount  int
+	Name        string
+	Thumbnail   *dto.ImagePaths `gorm:"serializer:json;type:JSONB"`
+	Uid         string          `gorm:"uniqueIndex"`
+}
+
+func (e PublicCollection) DTO() dto.PublicCollection {
+	return dto.PublicCollection{
+		Description: e.Description,
+		ImageCount:  e.ImageCount,
+		Name:        e.Name,
+		Thumbnail:   e.Thumbnail,
+		Uid:         e.Uid,
+	}
+}
+
+func PublicCollectionFromDTO(d dto.PublicCollection) PublicCollection {
+	return PublicCollection{
+		Description: d.Description,
+		ImageCount:  d.ImageCount,
+		Name:        d.Name,
+		Thumbnail:   d.Thumbnail,
+		Uid:         d.Uid,
+	}
+}
+
+// PublicImage is a GORM entity inferred from dto.PublicImage
+type PublicImage struct {
+	ID            uint           `gorm:"primarykey" json:"-"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	AddedAt       time.Time
+	Description   *string
+	EmbedPaths    *dto.ImagePaths `gorm:"serializer:json;type:JSONB"`
+	Exif          *dto.ImageEXIF  `gorm:"serializer:json;type:JSONB"`
+	Height        int32
+	ImageMetadata *dto.ImageMetadata `gorm:"serializer:json;type:JSONB"`
+	ImagePaths    dto.ImagePaths     `gorm:"serializer:json;type:JSONB"`
+	Name          string
+	TakenAt       *time.Time
+	Uid           string `gorm:"uniqueIndex"`
+	Width         int32
+}
+
+func (e PublicImage) DTO() dto.PublicImage {
+	return dto.PublicImage{
+		AddedAt:       e.AddedAt,
+		Description:   e.Description,
+		EmbedPaths:    e.EmbedPaths,
+		Exif:          e.Exif,
+		Height:        e.Height,
+		ImageMetadata: e.ImageMetadata,
+		ImagePaths:    e.ImagePaths,
+		Name:          e.Name,
+		TakenAt:       e.TakenAt,
+		Uid:           e.Uid,
+		Width:         e.Width,
+	}
+}
+
+func PublicImageFromDTO(d dto.PublicImage) PublicImage {
+	return PublicImage{
+		AddedAt:       d.AddedAt,
+		Description:   d.Description,
+		EmbedPaths:    d.EmbedPaths,
+		Exif:          d.Exif,
+		Height:        d.Height,
+		ImageMetadata: d.ImageMetadata,
+		ImagePaths:    d.ImagePaths,
+		Name:          d.Name,
+		TakenAt:       d.TakenAt,
+		Uid:           d.Uid,
+		Width:         d.Width,
+	}
+}
+
+// ProofingComment is a GORM entity inferred from dto.ProofingComment
+type ProofingComment struct {
+	ID        uint           `gorm:"primarykey" json:"-"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	GuestUid  string `gorm:"index:idx_proofing_comments_guest_uid,priority:1"`
+	ImageUid  string
+	Uid       string `gorm:"uniqueIndex"`
+}
+
+func (e ProofingComment) DTO() dto.ProofingComment {
+	return dto.ProofingComment{
+		CreatedAt: e.CreatedAt,
+		UpdatedAt: e.UpdatedAt,
+		Body:      e.Body,
+		GuestUid:  e.GuestUid,
+		ImageUid:  e.ImageUid,
+		Uid:       e.Uid,
+	}
+}
+
+func ProofingCommentFromDTO(d dto.ProofingComment) ProofingComment {
+	return ProofingComment{
+		CreatedAt: d.CreatedAt,
+		UpdatedAt: d.UpdatedAt,
+		Body:      d.Body,
+		GuestUid:  d.GuestUid,
+		ImageUid:  d.ImageUid,
+		Uid:       d.Uid,
+	}
+}
+
+// ProofingMark is a GORM entity inferred from dto.ProofingMark
+type ProofingMark struct {
+	ID         uint           `gorm:"primarykey" json:"-"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Favourited bool
+	GuestUid   string `gorm:"uniqueIndex:idx_proofing_marks_guest_image,priority:1"`
+	ImageUid   string `gorm:"uniqueIndex:idx_proofing_marks_guest_image,priority:2"`
+	Selected   bool
+	Uid        string `gorm:"uniqueIndex"`
+}
+
+func (e ProofingMark) DTO() dto.ProofingMark {
+	return dto.ProofingMark{
+		CreatedAt:  e.CreatedAt,
+		UpdatedAt:  e.UpdatedAt,
+		Favourited: e.Favourited,
+		GuestUid:   e.GuestUid,
+		ImageUid:   e.ImageUid,
+		Selected:   e.Selected,
+		Uid:        e.Uid,
+	}
+}
+
+func ProofingMarkFromDTO(d dto.ProofingMark) ProofingMark {
+	return ProofingMark{
+		CreatedAt:  d.CreatedAt,
+		UpdatedAt:  d.UpdatedAt,
+		Favourited: d.Favourited,
+		GuestUid:   d.GuestUid,
+		ImageUid:   d.ImageUid,
+		Selected:   d.Selected,
+		Uid:        d.Uid,
+	}
+}
+
+// ShareGuest is a GORM entity inferred from dto.ShareGuest
+type ShareGuest struct {
+	ID            uint           `gorm:"primarykey" json:"-"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	CollectionUid string
+	Email         *string
+	Name          *string
+	// SubmittedAt When the guest submitted their final selection
+	SubmittedAt *time.Time
+	Uid         string `gorm:"uniqueIndex"`
+}
+
+func (e ShareGuest) DTO() dto.ShareGuest {
+	return dto.ShareGuest{
+		CreatedAt:     e.CreatedAt,
+		UpdatedAt:     e.UpdatedAt,
+		CollectionUid: e.CollectionUid,
+		Email:         e.Email,
+		Name:          e.Name,
+		SubmittedAt:   e.SubmittedAt,
+		Uid:           e.Uid,
+	}
+}
+
+func ShareGuestFromDTO(d dto.ShareGuest) ShareGuest {
+	return ShareGuest{
+		CreatedAt:     d.CreatedAt,
+		UpdatedAt:     d.UpdatedAt,
+		CollectionUid: d.CollectionUid,
+		Email:         d.Email,
+		Name:          d.Name,
+		SubmittedAt:   d.SubmittedAt,
+		Uid:           d.Uid,
+	}
+}
+
+// DownloadLog is a GORM entity inferred from dto.DownloadLog
+type DownloadLog struct {
+	ID        uint           `gorm:"primarykey" json:"-"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// ImageUids Images downloaded
+	ImageUids []string `gorm:"serializer:json;type:JSONB"`
+	// Ip Address the download came from
+	Ip       string
+	TokenUid string `gorm:"index:idx_download_logs_token_uid,priority:1"`
+	Uid      string `gorm:"uniqueIndex"`
+}
+
+func (e DownloadLog) DTO() dto.DownloadLog {
+	return dto.DownloadLog{
+		CreatedAt: e.CreatedAt,
+		UpdatedAt: e.UpdatedAt,
+		ImageUids: e.ImageUids,
+		Ip:        e.Ip,
+		TokenUid:  e.TokenUid,
+		Uid:       e.Uid,
+	}
+}
+
+func DownloadLogFromDTO(d dto.DownloadLog) DownloadLog {
+	return DownloadLog{
+		CreatedAt: d.CreatedAt,
+		UpdatedAt: d.UpdatedAt,
+		ImageUids: d.ImageUids,
+		Ip:        d.Ip,
+		TokenUid:  d.TokenUid,
+		Uid:       d.Uid,
+	}
+}
+
+// ExportArchive is a GORM entity inferred from dto.ExportArchive
+type ExportArchive struct {
+	ID          uint           `gorm:"primarykey" json:"-"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	CompletedAt *time.Time
+	CreatedByID *string
+	CreatedBy   *User `gorm:"foreignKey:CreatedByID;references:Uid"`
+	// Error Why the build failed
+	Error *string
+	// ExpiresAt When the archive is removed
+	ExpiresAt *time.Time `gorm:"index:idx_export_archives_expires_at,priority:1"`
+	// FileCount Images written to the archive
+	FileCount *int
+	FileName  string
+	// ImageUids Images asked for, in archive order
+	ImageUids []string `gorm:"serializer:json;type:JSONB"`
+	// JobUid Worker job building the archive. Its WebSocket events carry this as jobId
+	JobUid *string
+	// Profile How images are rendered into an archive. Format and quality default to the image_download_format and image_download_quality settings. With the original format and nothing else set, the original files are used
+	Profile *dto.ExportProfile `gorm:"serializer:json;type:JSONB"`
+	// Progress Percentage of images processed
+	Progress int
+	// Size Archive size in bytes
+	Size *int64
+	// Skipped Images left out of the archive. They are also listed in the archive's manifest.json
+	Skipped *[]dto.ExportSkippedFile `gorm:"serializer:json;type:JSONB"`
+	Status  dto.ExportArchiveStatus  `gorm:"type:text"`
+	Uid     string                   `gorm:"uniqueIndex"`
+}
+
+func (e ExportArchive) DTO() dto.ExportArchive {
+	return dto.ExportArchive{
+		CreatedAt:   e.CreatedAt,
+		UpdatedAt:   e.UpdatedAt,
+		CompletedAt: e.CompletedAt,
+		CreatedBy: func() *dto.User {
+			if e.CreatedBy != nil {
+				d := e.CreatedBy.DTO()
+				return &d
+			}
+			return nil
+		}(),
+		Error:     e.Error,
+		ExpiresAt: e.ExpiresAt,
+		FileCount: e.FileCount,
+		FileName:  e.FileName,
+		ImageUids: e.ImageUids,
+		JobUid:    e.JobUid,
+		Profile:   e.Profile,
+		Progress:  e.Progress,
+		Size:      e.Size,
+		Skipped:   e.Skipped,
+		Status:    e.Status,
+		Uid:       e.Uid,
+	}
+}
+
+func ExportArchiveFromDTO(d dto.ExportArchive) ExportArchive {
+	return ExportArchive{
+		CreatedAt:   d.CreatedAt,
+		UpdatedAt:   d.UpdatedAt,
+		CompletedAt: d.CompletedAt,
+		CreatedByID: func() *string {
+			if d.CreatedBy != nil {
+				return &d.CreatedBy.Uid
+			}
+			return nil
+		}(),
+		Error:     d.Error,
+		ExpiresAt: d.ExpiresAt,
+		FileCount: d.FileCount,
+		FileName:  d.FileName,
+		ImageUids: d.ImageUids,
+		JobUid:    d.JobUid,
+		Profile:   d.Profile,
+		Progress:  d.Progress,
+		Size:      d.Size,
+		Skipped:   d.Skipped,
+		Status:    d.Status,
+		Uid:       d.Uid,
+	}
+}
+
+// ExportSkippedFile is a GORM entity inferred from dto.ExportSkippedFile
+type ExportSkippedFile struct {
+	ID        uint           `gorm:"primarykey" json:"-"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// Name The image's filename, if it was found
+	Name *string
+	// Reason Why the image was skipped
+	Reason string
+	Uid    string `gorm:"uniqueIndex"`
+}
+
+func (e ExportSkippedFile) DTO() dto.ExportSkippedFile {
+	return dto.ExportSkippedFile{
+		Name:   e.Name,
+		Reason: e.Reason,
+		Uid:    e.Uid,
+	}
+}
+
+func ExportSkippedFileFromDTO(d dto.ExportSkippedFile) ExportSkippedFile {
+	return ExportSkippedFile{
+		Name:   d.Name,
+		Reason: d.Reason,
+		Uid:    d.Uid,
+	}
+}
+
+// CollectionMirror is a GORM entity inferred from dto.CollectionMirror
+type CollectionMirror struct {
+	ID        uint           `gorm:"primarykey" json:"-"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// CollectionUid Local read-only collection
+	CollectionUid string
+	CreatedByID   *string
+	CreatedBy     *User `gorm:"foreignKey:CreatedByID;references:Uid"`
+	// Error Why the last sync failed
+	Error        *string
+	Images       []dto.MirroredImage `gorm:"serializer:json;type:JSONB"`
+	LastSyncedAt *time.Time          `gorm:"index:idx_collection_mirrors_last_synced_at,priority:1"`
+	PeerUid      string
+	// RemoteUri viz URI of the remote collection
+	RemoteUri string
+	Status    dto.CollectionMirrorStatus `gorm:"type:text"`
+	Uid       string                     `gorm:"uniqueIndex"`
+}
+
+func (e CollectionMirror) DTO() dto.CollectionMirror {
+	return dto.CollectionMirror{
+		CreatedAt:     e.CreatedAt,
+		UpdatedAt:     e.UpdatedAt,
+		CollectionUid: e.CollectionUid,
+		CreatedBy: func() *dto.User {
+			if e.CreatedBy != nil {
+				d := e.CreatedBy.DTO()
+				return &d
+			}
+			return nil
+		}(),
+		Error:        e.Error,
+		Images:       e.Images,
+		LastSyncedAt: e.LastSyncedAt,
+		PeerUid:      e.PeerUid,
+		RemoteUri:    e.RemoteUri,
+		Status:       e.Status,
+		Uid:          e.Uid,
+	}
+}
+
+func CollectionMirrorFromDTO(d dto.CollectionMirror) CollectionMirror {
+	return CollectionMirror{
+		CreatedAt:     d.CreatedAt,
+		UpdatedAt:     d.UpdatedAt,
+		CollectionUid: d.CollectionUid,
+		CreatedByID: func() *string {
+			if d.CreatedBy != nil {
+				return &d.CreatedBy.Uid
+			}
+			return nil
+		}(),
+		Error:        d.Error,
+		Images:       d.Images,
+		LastSyncedAt: d.LastSyncedAt,
+		PeerUid:      d.PeerUid,
+		RemoteUri:    d.RemoteUri,
+		Status:       d.Status,
+		Uid:          d.Uid,
+	}
+}
+
+// FederationPeer is a GORM entity inferred from dto.FederationPeer
+type FederationPeer struct {
+	ID                 uint           `gorm:"primarykey" json:"-"`
+	DeletedAt          gorm.DeletedAt `gorm:"index" json:"-"`
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+	FederationEndpoint string
+	LastHandshakeAt    *time.Time
+	Name               string
+	// PublicKey Base64 Ed25519 key the peer signs requests with
+	PublicKey string
+	// RemoteStatus Whether the peer trusts this server, as of the last handshake
+	RemoteStatus dto.FederationPeerRemoteStatus `gorm:"type:text"`
+	// Status Whether this server trusts the peer. Only trusted peers can fetch collections, and only their collections can be mirrored
+	Status dto.FederationPeerStatus `gorm:"type:text"`
+	Uid    string                   `gorm:"uniqueIndex"`
+	// Url The peer's origin, which identifies it
+	Url string `gorm:"uniqueIndex:idx_federation_peers_url,priority:1"`
+}
+
+func (e FederationPeer) DTO() dto.FederationPeer {
+	return dto.FederationPeer{
+		CreatedAt:          e.CreatedAt,
+		UpdatedAt:          e.UpdatedAt,
+		FederationEndpoint: e.FederationEndpoint,
+		LastHandshakeAt:    e.LastHandshakeAt,
+		Name:               e.Name,
+		PublicKey:          e.PublicKey,
+		RemoteStatus:       e.RemoteStatus,
+		Status:             e.Status,
+		Uid:                e.Uid,
+		Url:                e.Url,
+	}
+}
+
+func FederationPeerFromDTO(d dto.FederationPeer) FederationPeer {
+	return FederationPeer{
+		CreatedAt:          d.CreatedAt,
+		UpdatedAt:          d.UpdatedAt,
+		FederationEndpoint: d.FederationEndpoint,
+		LastHandshakeAt:    d.LastHandshakeAt,
+		Name:               d.Name,
+		PublicKey:          d.PublicKey,
+		RemoteStatus:       d.RemoteStatus,
+		Status:             d.Status,
+		Uid:                d.Uid,
+		Url:                d.Url,
+	}
+}
+
+// RemoteCollection is a GORM entity inferred from dto.RemoteCollection
+type RemoteCollection struct {
+	ID          uint           `gorm:"primarykey" json:"-"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Description *string
+	// Images The collection's public images, in collection order
+	Images []dto.RemoteImage `gorm:"serializer:json;type:JSONB"`
+	Name   string
+	Uid    string `gorm:"uniqueIndex"`
+	// Uri viz URI of the collection
+	Uri string
+}
+
+func (e RemoteCollection) DTO() dto.RemoteCollection {
+	return dto.RemoteCollection{
+		Description: e.Description,
+		Images:      e.Images,
+		Name:        e.Name,
+		Uid:         e.Uid,
+		Uri:         e.Uri,
+	}
+}
+
+func RemoteCollectionFromDTO(d dto.RemoteCollection) RemoteCollection {
+	return RemoteCollection{
+		Description: d.Description,
+		Images:      d.Images,
+		Name:        d.Name,
+		Uid:         d.Uid,
+		Uri:         d.Uri,
+	}
+}
+
+// RemoteImage is a GORM entity inferred from dto.RemoteImage
+type RemoteImage struct {
+	ID          uint           `gorm:"primarykey" json:"-"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Checksum    string
+	Description *string
+	FileName    string
+	Height      int
+	Name        string
+	TakenAt     *time.Time
+	Uid         string `gorm:"uniqueIndex"`
+	// Uri viz URI of the image
+	Uri   string
+	Width int
+}
+
+func (e RemoteImage) DTO() dto.RemoteImage {
+	return dto.RemoteImage{
+		Checksum:    e.Checksum,
+		Description: e.Description,
+		FileName:    e.FileName,
+		Height:      e.Height,
+		Name:        e.Name,
+		TakenAt:     e.TakenAt,
+		Uid:         e.Uid,
+		Uri:         e.Uri,
+		Width:       e.Width,
+	}
+}
+
+func RemoteImageFromDTO(d dto.RemoteImage) RemoteImage {
+	return RemoteImage{
+		Checksum:    d.Checksum,
+		Description: d.Description,
+		FileName:    d.FileName,
+		Height:      d.Height,
+		Name:        d.Name,
+		TakenAt:     d.TakenAt,
+		Uid:         d.Uid,
+		Uri:         d.Uri,
+		Width:       d.Width,
+	}
+}
+
+// UploadLink is a GORM entity inferred from dto.UploadLink
+type UploadLink struct {
+	ID        uint           `gorm:"primarykey" json:"-"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// AllowedTypes File extensions allowed, e.g. jpg or cr3. Empty allows any image
+	AllowedTypes  []string `gorm:"serializer:json;type:JSONB"`
+	CollectionUid string   `gorm:"index:idx_upload_links_collection_uid,priority:1"`
+	CreatedByID   *string
+	CreatedBy     *User `gorm:"foreignKey:CreatedByID;references:Uid"`
+	ExpiresAt     time.Time
+	// FileCount Files uploaded through the link
+	FileCount  int
+	LastUsedAt *time.Time
+	// MaxFileSize Largest file allowed in bytes (null for no limit)
+	MaxFileSize *int64
+	// MaxFiles Files that can be uploaded through the link (null for no limit)
+	MaxFiles *int
+	// Message Shown to people uploading through the link
+	Message *string
+	// Token Signed token the link is shared with. Tokens stop working if the URL signing key changes
+	Token string
+	Uid   string `gorm:"uniqueIndex"`
+}
+
+func (e UploadLink) DTO() dto.UploadLink {
+	return dto.UploadLink{
+		CreatedAt:     e.CreatedAt,
+		UpdatedAt:     e.UpdatedAt,
+		AllowedTypes:  e.AllowedTypes,
+		CollectionUid: e.CollectionUid,
+		CreatedBy: func() *dto.User {
+			if e.CreatedBy != nil {
+				d := e.CreatedBy.DTO()
+				return &d
+			}
+			return nil
+		}(),
+		ExpiresAt:   e.ExpiresAt,
+		FileCount:   e.FileCount,
+		LastUsedAt:  e.LastUsedAt,
+		MaxFileSize: e.MaxFileSize,
+		MaxFiles:    e.MaxFiles,
+		Message:     e.Message,
+		Token:       e.Token,
+		Uid:         e.Uid,
+	}
+}
+
+func UploadLinkFromDTO(d dto.UploadLink) UploadLink {
+	return UploadLink{
+		CreatedAt:     d.CreatedAt,
+		UpdatedAt:     d.UpdatedAt,
+		AllowedTypes:  d.AllowedTypes,
+		CollectionUid: d.CollectionUid,
+		CreatedByID: func() *string {
+			if d.CreatedBy != nil {
+				return &d.CreatedBy.Uid
+			}
+			return nil
+		}(),
+		ExpiresAt:   d.ExpiresAt,
+		FileCount:   d.FileCount,
+		LastUsedAt:  d.LastUsedAt,
+		MaxFileSize: d.MaxFileSize,
+		MaxFiles:    d.MaxFiles,
+		Message:     d.Message,
+		Token:       d.Token,
+		Uid:         d.Uid,
+	}
+}
@@ -0,0 +1,101 @@
+package federation
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// WellKnownPath is where a server publishes its discovery document.
+const WellKnownPath = "/.well-known/viz"
+
+// ProtocolVersion is the version of RFC 001 this server speaks.
+const ProtocolVersion = "0.1"
+
+// Capabilities this server offers peers.
+const (
+	CapabilityHandshake   = "handshake"
+	CapabilityCollections = "collections.mirror"
+)
+
+var ErrInvalidServerURL = errors.New("server URL must be an http or https origin")
+
+// Document is a server's discovery document, which tells peers how to
+// reach it and the key it signs requests with.
+type Document struct {
+	Protocol string         `json:"protocol"`
+	Version  string         `json:"version"`
+	Server   DocumentServer `json:"server"`
+	// PublicKey is the server's base64 Ed25519 public key.
+	PublicKey     string            `json:"public_key"`
+	Endpoints     DocumentEndpoints `json:"endpoints"`
+	ResourceTypes []string          `json:"resource_types"`
+	Capabilities  []string          `json:"capabilities"`
+}
+
+type DocumentServer struct {
+	Name string `json:"name"`
+	// URL is the server's origin, which identifies it to peers.
+	URL string `json:"url"`
+}
+
+type DocumentEndpoints struct {
+	API        string `json:"api"`
+	Federation string `json:"federation"`
+}
+
+// Key decodes the document's public key.
+func (d *Document) Key() (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(d.PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid public key in discovery document")
+	}
+
+	return key, nil
+}
+
+// validate checks the document is one a server at serverURL would publish.
+// Its endpoints must be on that server, so a document can't send requests
+// signed for it elsewhere.
+func (d *Document) validate(serverURL string) error {
+	if d.Protocol != Scheme {
+		return errors.New("not a viz discovery document")
+	}
+
+	if own, err := NormalizeServerURL(d.Server.URL); err != nil || own != serverURL {
+		return errors.New("discovery document is for another server: " + d.Server.URL)
+	}
+
+	for _, endpoint := range []string{d.Endpoints.API, d.Endpoints.Federation} {
+		if !strings.HasPrefix(endpoint, serverURL+"/") {
+			return errors.New("discovery document endpoint is on another server: " + endpoint)
+		}
+	}
+
+	_, err := d.Key()
+	return err
+}
+
+// NormalizeServerURL turns raw into the origin form servers are known by,
+// such as https://photos.example.com, with no path or trailing slash.
+func NormalizeServerURL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil ||
+		strings.Trim(u.Path, "/") != "" || u.RawQuery != "" || u.Fragment != "" {
+		return "", ErrInvalidServerURL
+	}
+
+	return u.Scheme + "://" + strings.ToLower(u.Host), nil
+}
+
+// ServeDiscovery serves the instance's discovery document.
+func (i *Instance) ServeDiscovery(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	_ = json.NewEncoder(w).Encode(i.Document())
+}
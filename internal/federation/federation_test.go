@@ -0,0 +1,190 @@
+package federation
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newServer starts an in-process server with its own key, serving its
+// discovery document and a signed echo endpoint that answers with who sent
+// the request.
+func newServer(t *testing.T, name string) *Instance {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instance := &Instance{Name: name, Key: key, Insecure: true}
+	mux := http.NewServeMux()
+	mux.HandleFunc(WellKnownPath, instance.ServeDiscovery)
+	mux.HandleFunc("/api/federation/echo", func(w http.ResponseWriter, r *http.Request) {
+		sender, err := instance.Verify(r, instance.DiscoveredKey)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]string{"sender": sender})
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	instance.URL = server.URL
+	instance.Client = server.Client()
+
+	return instance
+}
+
+func TestParseURI(t *testing.T) {
+	uri, err := ParseURI("viz://Photos.Example.com/images/12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Authority != "photos.example.com" || uri.Type != ResourceImages || uri.ID != "12345" || uri.IsCollection() {
+		t.Errorf("parsed %+v", uri)
+	}
+	if uri.String() != "viz://photos.example.com/images/12345" {
+		t.Errorf("String() = %s", uri.String())
+	}
+
+	if uri, err := ParseURI("viz://localhost:7770/albums/abc"); err != nil || !uri.IsCollection() || uri.Authority != "localhost:7770" {
+		t.Errorf("album URI = %+v, %v", uri, err)
+	}
+
+	for _, raw := range []string{
+		"https://photos.example.com/images/1",
+		"viz:///images/1",
+		"viz://photos.example.com/videos/1",
+		"viz://photos.example.com/images",
+		"viz://photos.example.com/images/1/file",
+		"viz://user@photos.example.com/images/1",
+		"viz://photos.example.com/images/1?x=1",
+	} {
+		if _, err := ParseURI(raw); err != ErrInvalidURI {
+			t.Errorf("%s: err = %v, want ErrInvalidURI", raw, err)
+		}
+	}
+}
+
+func TestHandshakeBetweenServers(t *testing.T) {
+	ctx := context.Background()
+	a := newServer(t, "a")
+	b := newServer(t, "b")
+
+	doc, err := a.Discover(ctx, b.URL)
+	if err != nil {
+		t.Fatalf("a failed to discover b: %v", err)
+	}
+	if doc.Server.Name != "b" || doc.Endpoints.Federation != b.URL+"/api/federation" {
+		t.Errorf("b's document = %+v", doc)
+	}
+	if key, err := doc.Key(); err != nil || !key.Equal(b.PublicKey()) {
+		t.Errorf("b's key = %x, %v", key, err)
+	}
+
+	var answer struct{ Sender string }
+	if err := a.Call(ctx, http.MethodPost, b.URL+"/api/federation/echo?x=1", map[string]string{"hello": "b"}, &answer); err != nil {
+		t.Fatalf("b refused a's signed request: %v", err)
+	}
+	if answer.Sender != a.URL {
+		t.Errorf("b saw the request come from %q, want %q", answer.Sender, a.URL)
+	}
+
+	// A third server can't pass itself off as a
+	impostor := newServer(t, "impostor")
+	impostor.URL = a.URL
+	err = impostor.Call(ctx, http.MethodGet, b.URL+"/api/federation/echo", nil, nil)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("impostor's request: err = %v, want 401", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, b.URL+"/api/federation/echo", nil)
+	if res, err := b.Client.Do(req); err != nil || res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("unsigned request = %v, %v, want 401", res, err)
+	}
+
+	// A signature doesn't carry over to another URL or body
+	req, _ = http.NewRequest(http.MethodPost, b.URL+"/api/federation/echo?x=1", strings.NewReader(`{"hello":"b"}`))
+	Sign(req, a.URL, a.Key, []byte(`{"hello":"b"}`))
+	req.URL.RawQuery = "x=2"
+	if res, err := b.Client.Do(req); err != nil || res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("request sent elsewhere = %v, %v, want 401", res, err)
+	}
+
+	req, _ = http.NewRequest(http.MethodPost, b.URL+"/api/federation/echo", strings.NewReader(`{"hello":"c"}`))
+	Sign(req, a.URL, a.Key, []byte(`{"hello":"b"}`))
+	if res, err := b.Client.Do(req); err != nil || res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("request with a changed body = %v, %v, want 401", res, err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	ctx := context.Background()
+	a := newServer(t, "a")
+	b := newServer(t, "b")
+
+	uri := b.URI(ResourceAlbums, "col1")
+	resolved, err := a.Resolve(ctx, uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved.Endpoint != b.URL+"/api/federation/collections/col1" || resolved.Server.Server.Name != "b" {
+		t.Errorf("resolved %s to %+v", uri, resolved)
+	}
+
+	// Peers must be reached over https unless insecure peers are allowed
+	a.Insecure = false
+	if _, err := a.Resolve(ctx, uri); err == nil {
+		t.Error("resolved a URI over plain http")
+	}
+}
+
+func TestDiscoverRejectsOtherServersDocument(t *testing.T) {
+	a := newServer(t, "a")
+	b := newServer(t, "b")
+
+	// b publishing a's document can't claim a's identity
+	mux := http.NewServeMux()
+	mux.HandleFunc(WellKnownPath, a.ServeDiscovery)
+	mirror := httptest.NewServer(mux)
+	defer mirror.Close()
+
+	if _, err := b.Discover(context.Background(), mirror.URL); err == nil {
+		t.Error("accepted a document for another server")
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	dir := t.TempDir()
+
+	generated, err := LoadKey("", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, KeyFile))
+	if err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("key file = %v, %v", info, err)
+	}
+
+	again, err := LoadKey("", dir)
+	if err != nil || !again.Equal(generated) {
+		t.Errorf("key changed between loads: %v", err)
+	}
+
+	if _, err := LoadKey("not a key", dir); err == nil {
+		t.Error("accepted an invalid configured key")
+	}
+}
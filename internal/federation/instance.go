@@ -0,0 +1,225 @@
+package federation
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxDocumentSize is the most of a discovery document or JSON response
+// read from a peer.
+const maxDocumentSize = 8 << 20
+
+// Instance is this server as its peers see it, and signs what it sends
+// them.
+type Instance struct {
+	// URL is the server's origin, as NormalizeServerURL gives it.
+	URL  string
+	Name string
+	Key  ed25519.PrivateKey
+	// Client sends requests to peers. Defaults to one with a 30 second
+	// timeout.
+	Client *http.Client
+	// Insecure lets peers be reached over plain HTTP.
+	Insecure bool
+}
+
+// StatusError is a peer's answer to a request it didn't accept.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("peer answered %d", e.StatusCode)
+	}
+	return fmt.Sprintf("peer answered %d: %s", e.StatusCode, e.Message)
+}
+
+// Resolved is where a viz URI can be fetched from.
+type Resolved struct {
+	URI    URI
+	Server *Document
+	// Endpoint is the federation API URL of the resource.
+	Endpoint string
+}
+
+func (i *Instance) client() *http.Client {
+	if i.Client != nil {
+		return i.Client
+	}
+	return &http.Client{Timeout: 30 * time.Second}
+}
+
+// Authority is the authority viz URIs of this server's resources have.
+func (i *Instance) Authority() string {
+	u, _ := url.Parse(i.URL)
+	return strings.ToLower(u.Host)
+}
+
+// PublicKey is the key peers verify this server's requests with.
+func (i *Instance) PublicKey() ed25519.PublicKey {
+	return i.Key.Public().(ed25519.PublicKey)
+}
+
+// Document is the instance's discovery document.
+func (i *Instance) Document() Document {
+	return Document{
+		Protocol:  Scheme,
+		Version:   ProtocolVersion,
+		Server:    DocumentServer{Name: i.Name, URL: i.URL},
+		PublicKey: base64.StdEncoding.EncodeToString(i.PublicKey()),
+		Endpoints: DocumentEndpoints{
+			API:        i.URL + "/api",
+			Federation: i.URL + "/api/federation",
+		},
+		ResourceTypes: ResourceTypes,
+		Capabilities:  []string{CapabilityHandshake, CapabilityCollections},
+	}
+}
+
+// ServerURL is the URL of the server with the given authority.
+func (i *Instance) ServerURL(authority string) string {
+	if i.Insecure {
+		return "http://" + authority
+	}
+	return "https://" + authority
+}
+
+// URI is the viz URI of one of this server's resources.
+func (i *Instance) URI(resourceType, id string) URI {
+	return URI{Authority: i.Authority(), Type: resourceType, ID: id}
+}
+
+// Discover fetches and checks the discovery document of the server at
+// serverURL.
+func (i *Instance) Discover(ctx context.Context, serverURL string) (*Document, error) {
+	serverURL, err := NormalizeServerURL(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	if !i.Insecure && !strings.HasPrefix(serverURL, "https://") {
+		return nil, errors.New("peers must be reached over https")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, serverURL+WellKnownPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := i.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch discovery document: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch discovery document: %w", &StatusError{StatusCode: res.StatusCode})
+	}
+
+	var doc Document
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxDocumentSize)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to read discovery document: %w", err)
+	}
+
+	if err := doc.validate(serverURL); err != nil {
+		return nil, err
+	}
+
+	return &doc, nil
+}
+
+// Do sends a request signed by this server to a peer. in, if not nil, is
+// sent as JSON.
+func (i *Instance) Do(ctx context.Context, method, target string, in any) (*http.Response, error) {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	Sign(req, i.URL, i.Key, body)
+	return i.client().Do(req)
+}
+
+// Call sends a signed request to a peer and decodes its JSON answer into
+// out, if that's not nil. Answers other than 2xx are a *StatusError.
+func (i *Instance) Call(ctx context.Context, method, target string, in, out any) error {
+	res, err := i.Do(ctx, method, target, in)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		var answer struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(io.LimitReader(res.Body, 4096)).Decode(&answer)
+		return &StatusError{StatusCode: res.StatusCode, Message: answer.Error}
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(io.LimitReader(res.Body, maxDocumentSize)).Decode(out)
+}
+
+// Resolve finds where the resource uri names can be fetched from.
+func (i *Instance) Resolve(ctx context.Context, uri URI) (*Resolved, error) {
+	doc, err := i.Discover(ctx, i.ServerURL(uri.Authority))
+	if err != nil {
+		return nil, err
+	}
+
+	resourceType := uri.Type
+	if uri.IsCollection() {
+		resourceType = ResourceCollections
+	}
+
+	return &Resolved{
+		URI:      uri,
+		Server:   doc,
+		Endpoint: doc.Endpoints.Federation + "/" + resourceType + "/" + url.PathEscape(uri.ID),
+	}, nil
+}
+
+// Verify checks that r was signed by the peer it says sent it, and sent to
+// this server. See the package function Verify.
+func (i *Instance) Verify(r *http.Request, lookup KeyLookup) (string, error) {
+	return Verify(r, i.URL, lookup)
+}
+
+// DiscoveredKey is a KeyLookup that takes the key from a peer's discovery
+// document.
+func (i *Instance) DiscoveredKey(ctx context.Context, serverURL string) (ed25519.PublicKey, error) {
+	doc, err := i.Discover(ctx, serverURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return doc.Key()
+}
@@ -0,0 +1,101 @@
+package federation
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"viz/internal/config"
+)
+
+// KeyFile is where a generated key is kept under the base directory, so the
+// server keeps its identity across restarts.
+const KeyFile = "federation.key"
+
+var ErrDisabled = errors.New("federation is disabled")
+
+// LoadKey returns the key from configured, a base64 Ed25519 seed, or, if
+// that's empty, a key generated once and kept in dir.
+func LoadKey(configured, dir string) (ed25519.PrivateKey, error) {
+	if configured != "" {
+		return parseSeed(configured)
+	}
+
+	path := filepath.Join(dir, KeyFile)
+	if data, err := os.ReadFile(path); err == nil {
+		key, err := parseSeed(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("federation key file is invalid: %s", path)
+		}
+		return key, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(seed)+"\n"), 0o600); err != nil {
+		return nil, err
+	}
+
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+func parseSeed(encoded string) (ed25519.PrivateKey, error) {
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, errors.New("federation key must be a base64 Ed25519 seed")
+	}
+
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+var configured = sync.OnceValues(func() (*Instance, error) {
+	cfg := config.AppConfig
+	if !cfg.Federation.Enabled {
+		return nil, ErrDisabled
+	}
+
+	serverURL, err := NormalizeServerURL(cfg.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("federation needs baseUrl to be this server's origin: %w", err)
+	}
+
+	key, err := LoadKey(cfg.Federation.Key, cfg.BaseDir)
+	if err != nil {
+		return nil, err
+	}
+
+	name := cfg.Federation.Name
+	if name == "" {
+		u, _ := url.Parse(serverURL)
+		name = u.Hostname()
+	}
+
+	return &Instance{
+		URL:      serverURL,
+		Name:     name,
+		Key:      key,
+		Insecure: cfg.Federation.AllowInsecure,
+	}, nil
+})
+
+// Configured is this server's instance as config.AppConfig sets it up. It
+// is ErrDisabled if federation isn't enabled.
+func Configured() (*Instance, error) {
+	return configured()
+}
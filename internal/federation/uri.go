@@ -0,0 +1,57 @@
+package federation
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Scheme is the URI scheme resources are identified by across servers,
+// viz://<authority>/<resource-type>/<resource-id>.
+const Scheme = "viz"
+
+// Resource types a viz URI can name. Albums are collections by another name.
+const (
+	ResourceImages      = "images"
+	ResourceCollections = "collections"
+	ResourceAlbums      = "albums"
+)
+
+// ResourceTypes are the resource types this server resolves.
+var ResourceTypes = []string{ResourceImages, ResourceCollections, ResourceAlbums}
+
+var ErrInvalidURI = errors.New("invalid viz URI")
+
+// URI is a parsed viz URI.
+type URI struct {
+	// Authority is the host, and port if there is one, of the server the
+	// resource is on.
+	Authority string
+	Type      string
+	ID        string
+}
+
+// ParseURI parses a viz URI, such as viz://photos.example.com/images/12345.
+func ParseURI(raw string) (URI, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Scheme != Scheme || u.Host == "" || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return URI{}, ErrInvalidURI
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) != 2 || parts[1] == "" || !slices.Contains(ResourceTypes, parts[0]) {
+		return URI{}, ErrInvalidURI
+	}
+
+	return URI{Authority: strings.ToLower(u.Host), Type: parts[0], ID: parts[1]}, nil
+}
+
+// IsCollection reports whether the URI names a collection.
+func (u URI) IsCollection() bool {
+	return u.Type == ResourceCollections || u.Type == ResourceAlbums
+}
+
+func (u URI) String() string {
+	return Scheme + "://" + u.Authority + "/" + u.Type + "/" + url.PathEscape(u.ID)
+}
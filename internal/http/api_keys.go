@@ -0,0 +1,142 @@
+package http
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"viz/internal/dto"
+	"viz/internal/entities"
+)
+
+// TrustProxyHeaders mirrors security.rate_limit.trust_proxy_headers, for
+// checking API keys against the IP ranges they're allowed from. It is set
+// once at startup, since this package can't import config.
+var TrustProxyHeaders bool
+
+// ParseCIDR normalises an IP range for an API key. A bare address is taken
+// as a range holding only that address.
+func ParseCIDR(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return "", fmt.Errorf("invalid IP address %q", s)
+		}
+
+		if ip.To4() != nil {
+			return ip.String() + "/32", nil
+		}
+		return ip.String() + "/128", nil
+	}
+
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid IP range %q", s)
+	}
+	return ipNet.String(), nil
+}
+
+// APIKeyAllowsIP reports whether key may be used from ip.
+func APIKeyAllowsIP(key *entities.APIKey, ip string) bool {
+	cidrs := lo.FromPtr(key.AllowedCidrs)
+	if len(cidrs) == 0 {
+		return true
+	}
+
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err == nil && ipNet.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyAllowsMethod reports whether key may make requests with method.
+// Read-only keys only read, whoever they belong to.
+func APIKeyAllowsMethod(key *entities.APIKey, method string) bool {
+	if !lo.FromPtr(key.ReadOnly) {
+		return true
+	}
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// QuotaPeriodStart is the start of the quota period now is in. Periods
+// follow the UTC calendar.
+func QuotaPeriodStart(period dto.APIKeyQuotaPeriod, now time.Time) time.Time {
+	now = now.UTC()
+	switch period {
+	case dto.APIKeyQuotaPeriodHour:
+		return now.Truncate(time.Hour)
+	case dto.APIKeyQuotaPeriodMonth:
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// QuotaPeriodEnd is when the quota period starting at start resets.
+func QuotaPeriodEnd(period dto.APIKeyQuotaPeriod, start time.Time) time.Time {
+	switch period {
+	case dto.APIKeyQuotaPeriodHour:
+		return start.Add(time.Hour)
+	case dto.APIKeyQuotaPeriodMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// CountAPIKeyRequest records a request made with key and reports whether
+// it is within the key's quota. The counters are updated in one statement,
+// so concurrent requests can't both take the last one left.
+func CountAPIKeyRequest(db *gorm.DB, key *entities.APIKey, now time.Time) (bool, error) {
+	updates := map[string]any{
+		"request_count": gorm.Expr("COALESCE(request_count, 0) + 1"),
+		"last_used_at":  now,
+	}
+
+	limit := lo.FromPtr(key.QuotaLimit)
+	if limit > 0 && key.QuotaPeriod != nil {
+		start := QuotaPeriodStart(*key.QuotaPeriod, now)
+		updates["quota_used"] = gorm.Expr("CASE WHEN quota_period_start IS NULL OR quota_period_start < ? THEN 1 ELSE COALESCE(quota_used, 0) + 1 END", start)
+		updates["quota_period_start"] = start
+	}
+
+	err := db.Model(key).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "request_count"}, {Name: "quota_used"}, {Name: "quota_period_start"}}}).
+		UpdateColumns(updates).Error
+	if err != nil {
+		return false, err
+	}
+
+	return limit <= 0 || lo.FromPtr(key.QuotaUsed) <= limit, nil
+}
+
+// quotaExceeded answers a request made with key after it has used up its
+// quota, saying when it resets.
+func quotaExceeded(w http.ResponseWriter, r *http.Request, key *entities.APIKey, now time.Time) {
+	retryAfter := time.Hour
+	if key.QuotaPeriod != nil && key.QuotaPeriodStart != nil {
+		retryAfter = QuotaPeriodEnd(*key.QuotaPeriod, *key.QuotaPeriodStart).Sub(now)
+	}
+
+	seconds := int((retryAfter + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+	render.Status(r, http.StatusTooManyRequests)
+	render.JSON(w, r, dto.ErrorResponse{Error: "API key quota exceeded"})
+}
@@ -0,0 +1,118 @@
+package http
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"viz/internal/dto"
+	"viz/internal/entities"
+)
+
+func TestParseCIDR(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "10.0.0.0/8", want: "10.0.0.0/8"},
+		{in: " 10.1.2.3/8 ", want: "10.0.0.0/8"},
+		{in: "192.168.1.20", want: "192.168.1.20/32"},
+		{in: "2001:db8::1", want: "2001:db8::1/128"},
+		{in: "2001:db8::/32", want: "2001:db8::/32"},
+		{in: "10.0.0.0/33", wantErr: true},
+		{in: "example.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseCIDR(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseCIDR(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseCIDR(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAPIKeyAllowsIP(t *testing.T) {
+	cidrs := []string{"10.0.0.0/8", "2001:db8::/32"}
+	limited := &entities.APIKey{AllowedCidrs: &cidrs}
+
+	tests := []struct {
+		key  *entities.APIKey
+		ip   string
+		want bool
+	}{
+		{key: &entities.APIKey{}, ip: "203.0.113.9", want: true},
+		{key: limited, ip: "10.20.30.40", want: true},
+		{key: limited, ip: "2001:db8::5", want: true},
+		{key: limited, ip: "203.0.113.9", want: false},
+		{key: limited, ip: "not-an-ip", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := APIKeyAllowsIP(tt.key, tt.ip); got != tt.want {
+			t.Errorf("APIKeyAllowsIP(%v, %q) = %v, want %v", tt.key.AllowedCidrs, tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestAPIKeyAllowsMethod(t *testing.T) {
+	readOnly := true
+	// Read-only holds for admins' keys as well
+	key := &entities.APIKey{ReadOnly: &readOnly, User: &entities.User{Role: "admin"}}
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		if !APIKeyAllowsMethod(key, method) {
+			t.Errorf("read-only key refused %s", method)
+		}
+	}
+
+	for _, method := range []string{http.MethodPost, http.MethodPatch, http.MethodPut, http.MethodDelete} {
+		if APIKeyAllowsMethod(key, method) {
+			t.Errorf("read-only key allowed %s", method)
+		}
+	}
+
+	if !APIKeyAllowsMethod(&entities.APIKey{}, http.MethodDelete) {
+		t.Error("key without read-only refused DELETE")
+	}
+}
+
+func TestQuotaPeriods(t *testing.T) {
+	now := time.Date(2026, 2, 14, 15, 42, 7, 0, time.FixedZone("UTC+2", 2*60*60))
+
+	tests := []struct {
+		period    dto.APIKeyQuotaPeriod
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{
+			period:    dto.APIKeyQuotaPeriodHour,
+			wantStart: time.Date(2026, 2, 14, 13, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2026, 2, 14, 14, 0, 0, 0, time.UTC),
+		},
+		{
+			period:    dto.APIKeyQuotaPeriodDay,
+			wantStart: time.Date(2026, 2, 14, 0, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2026, 2, 15, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			period:    dto.APIKeyQuotaPeriodMonth,
+			wantStart: time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		start := QuotaPeriodStart(tt.period, now)
+		if !start.Equal(tt.wantStart) {
+			t.Errorf("%s: start = %s, want %s", tt.period, start, tt.wantStart)
+		}
+		if end := QuotaPeriodEnd(tt.period, start); !end.Equal(tt.wantEnd) {
+			t.Errorf("%s: end = %s, want %s", tt.period, end, tt.wantEnd)
+		}
+	}
+}
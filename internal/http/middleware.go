@@ -2,9 +2,11 @@ package http
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -69,6 +71,7 @@ func GetSessionCache(token string) (*entities.User, bool) {
 }
 
 // ClearSessionCache removes a cached entry — used during logout or explicit revocation.
+// Like the other session cache functions it takes the HashSessionToken of the token.
 func ClearSessionCache(token string) {
 	sessionCacheMu.Lock()
 	defer sessionCacheMu.Unlock()
@@ -82,6 +85,7 @@ const (
 	ctxUserKey    ctxKey = "currentUser"
 	ctxAPIKey     ctxKey = "apiKey"
 	ctxAPIKeyAuth ctxKey = "apiKeyAuth"
+	ctxOAuthToken ctxKey = "oauthToken"
 )
 
 // WithUser returns a request with the authenticated user added to the context.
@@ -115,7 +119,50 @@ func APIKeyFromContext(r *http.Request) (*entities.APIKey, bool) {
 func AuthMiddleware(db *gorm.DB, logger *slog.Logger) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// A signed URL is its own authorization, for reading the one path
+			// it was signed for. Checking it needs no lookups, so CDNs and
+			// other sites can fetch it as often as they like.
+			if r.URL.Query().Has(SignatureParam) && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+				if err := VerifySignedURL(r, apiPath(r)); err != nil {
+					message := "Invalid signed URL"
+					if errors.Is(err, ErrSignatureExpired) {
+						message = "Signed URL has expired"
+					}
+
+					render.Status(r, http.StatusForbidden)
+					render.JSON(w, r, dto.ErrorResponse{Error: message})
+					return
+				}
+
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxSignedURL, true)))
+				return
+			}
+
 			apiKey := getAPIKeyFromRequest(r)
+
+			// Access tokens from the OAuth2 server share the Authorization
+			// header with API keys, and are told apart by their prefix.
+			if strings.HasPrefix(apiKey, imaAuth.OAuthAccessTokenPrefix) {
+				token, err := FindOAuthAccessToken(db, apiKey)
+				if err != nil {
+					if !errors.Is(err, gorm.ErrRecordNotFound) {
+						logger.Error("auth middleware: failed to query oauth token", slog.Any("error", err))
+						render.Status(r, http.StatusInternalServerError)
+						render.JSON(w, r, dto.ErrorResponse{Error: "Failed to authenticate access token"})
+						return
+					}
+
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+					render.Status(r, http.StatusUnauthorized)
+					render.JSON(w, r, dto.ErrorResponse{Error: "Invalid or expired access token"})
+					return
+				}
+
+				r = r.WithContext(context.WithValue(r.Context(), ctxOAuthToken, token))
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			if apiKey != "" {
 				hashed, _ := imaAuth.HashSecret(apiKey)
 
@@ -139,6 +186,33 @@ func AuthMiddleware(db *gorm.DB, logger *slog.Logger) func(next http.Handler) ht
 					return
 				}
 
+				// A key's own constraints hold whoever it belongs to, admins included
+				if !APIKeyAllowsIP(&key, ClientIP(r, TrustProxyHeaders)) {
+					render.Status(r, http.StatusForbidden)
+					render.JSON(w, r, dto.ErrorResponse{Error: "API key not allowed from this address"})
+					return
+				}
+
+				if !APIKeyAllowsMethod(&key, r.Method) {
+					render.Status(r, http.StatusForbidden)
+					render.JSON(w, r, dto.ErrorResponse{Error: "API key is read-only"})
+					return
+				}
+
+				now := time.Now()
+				allowed, err := CountAPIKeyRequest(db, &key, now)
+				if err != nil {
+					logger.Error("auth middleware: failed to count api key request", slog.Any("error", err))
+					render.Status(r, http.StatusInternalServerError)
+					render.JSON(w, r, dto.ErrorResponse{Error: "Failed to authenticate API key"})
+					return
+				}
+
+				if !allowed {
+					quotaExceeded(w, r, &key, now)
+					return
+				}
+
 				r = r.WithContext(context.WithValue(r.Context(), ctxAPIKey, &key))
 				r = r.WithContext(context.WithValue(r.Context(), ctxAPIKeyAuth, true))
 				next.ServeHTTP(w, r)
@@ -156,23 +230,29 @@ func AuthMiddleware(db *gorm.DB, logger *slog.Logger) func(next http.Handler) ht
 
 			// Try in-memory cache first to avoid a DB roundtrip for every request.
 			// If the cache misses, fall back to DB lookup and populate the cache.
-			var sess entities.Session
 			var userPtr *entities.User
+			tokenHash := HashSessionToken(cookie.Value)
 
-			if u, ok := GetSessionCache(cookie.Value); ok {
+			if u, ok := GetSessionCache(tokenHash); ok {
 				// Use cached user — attach pointer to context.
 				userPtr = u
 			} else {
-				if err := db.Where("token = ?", cookie.Value).First(&sess).Error; err != nil {
-					if err == gorm.ErrRecordNotFound {
-						logger.Debug("auth middleware: cookie auth failed", slog.String("reason", "session_not_found_in_db"))
+				sess, err := FindSession(db, cookie.Value)
+				if err != nil {
+					if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, ErrSessionExpired) {
+						reason, message := "session_not_found_in_db", "Invalid session"
+						if errors.Is(err, ErrSessionExpired) {
+							reason, message = "session_expired", "Session expired"
+						}
+
+						logger.Debug("auth middleware: cookie auth failed", slog.String("reason", reason))
 						ClearCookie(AuthTokenCookie, w)
 						ClearCookie(StateCookie, w)
 						render.Status(r, http.StatusUnauthorized)
-						render.JSON(w, r, dto.ErrorResponse{Error: "Invalid session"})
+						render.JSON(w, r, dto.ErrorResponse{Error: message})
 						return
 					}
-					
+
 					// For other errors (e.g. DB connection, locks), return 500 to allow retry
 					logger.Error("auth middleware: failed to query session", slog.Any("error", err))
 					render.Status(r, http.StatusInternalServerError)
@@ -180,20 +260,7 @@ func AuthMiddleware(db *gorm.DB, logger *slog.Logger) func(next http.Handler) ht
 					return
 				}
 
-				if sess.ExpiresAt != nil && !sess.ExpiresAt.IsZero() && time.Now().After(*sess.ExpiresAt) {
-					logger.Debug("auth middleware: cookie auth failed", slog.String("reason", "session_expired"))
-					render.Status(r, http.StatusUnauthorized)
-					render.JSON(w, r, dto.ErrorResponse{Error: "Session expired"})
-					return
-				}
-
-				if sess.LastActive == nil || time.Since(*sess.LastActive) > 5*time.Minute {
-					go func(uid string) {
-						if err := db.Model(&entities.Session{}).Where("uid = ?", uid).Update("last_active", time.Now()).Error; err != nil {
-							logger.Error("failed to update session last_active", slog.Any("error", err))
-						}
-					}(sess.Uid)
-				}
+				TouchSession(db, &sess.Session, ClientIP(r, false), logger)
 
 				if sess.UserUid == "" {
 					logger.Debug("auth middleware: cookie auth failed", slog.String("reason", "session_user_uid_empty"))
@@ -212,7 +279,8 @@ func AuthMiddleware(db *gorm.DB, logger *slog.Logger) func(next http.Handler) ht
 
 				// Attach to request context and cache the resolved user for short time.
 				userPtr = &user
-				SetSessionCache(cookie.Value, userPtr, sess.ExpiresAt)
+				expiry := SessionExpiry(&sess.Session)
+				SetSessionCache(tokenHash, userPtr, &expiry)
 			}
 
 			// Attach the resolved user pointer to the request context.
@@ -246,8 +314,12 @@ func AuthMiddleware(db *gorm.DB, logger *slog.Logger) func(next http.Handler) ht
 }
 
 // ScopeMiddleware requires that the request context contains an authenticated
-// API Key with the required scopes. It assumes AuthMiddleware has run
-// earlier in the chain to populate the API Key in context.
+// API Key or OAuth2 access token with the required scopes. It assumes
+// AuthMiddleware has run earlier in the chain to populate them in context.
+//
+// Keys belonging to admins skip the scope check, but not the IP, read-only
+// and quota constraints AuthMiddleware enforces on every key. Access tokens
+// never skip it.
 func ScopeMiddleware(requiredScopes []imaAuth.Scope) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -257,6 +329,25 @@ func ScopeMiddleware(requiredScopes []imaAuth.Scope) func(next http.Handler) htt
 				return
 			}
 
+			// So should signed URLs, whoever signed them had access
+			if SignedURLFromContext(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Apps only get the scopes the user consented to, admin or not
+			if token, ok := OAuthTokenFromContext(r); ok && token != nil {
+				if !hasScopes(token.Scopes, requiredScopes) {
+					w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+					render.Status(r, http.StatusForbidden)
+					render.JSON(w, r, dto.ErrorResponse{Error: "Insufficient scopes"})
+					return
+				}
+
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			apiKey, ok := APIKeyFromContext(r)
 			if !ok || apiKey == nil {
 				render.Status(r, http.StatusUnauthorized)
@@ -276,17 +367,10 @@ func ScopeMiddleware(requiredScopes []imaAuth.Scope) func(next http.Handler) htt
 				return
 			}
 
-			userScopes := make(map[imaAuth.Scope]bool)
-			for _, s := range apiKey.Scopes {
-				userScopes[imaAuth.Scope(s)] = true
-			}
-
-			for _, requiredScope := range requiredScopes {
-				if !userScopes[requiredScope] {
-					render.Status(r, http.StatusForbidden)
-					render.JSON(w, r, dto.ErrorResponse{Error: "Insufficient scopes"})
-					return
-				}
+			if !hasScopes(apiKey.Scopes, requiredScopes) {
+				render.Status(r, http.StatusForbidden)
+				render.JSON(w, r, dto.ErrorResponse{Error: "Insufficient scopes"})
+				return
 			}
 
 			next.ServeHTTP(w, r)
@@ -312,10 +396,26 @@ func AdminMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		if TwoFactorRequired(user) && !user.TwoFactorEnabled {
+			render.Status(r, http.StatusForbidden)
+			render.JSON(w, r, dto.ErrorResponse{Error: "Two-factor authentication is required for admin accounts"})
+			return
+		}
+
 		next.ServeHTTP(w, r)
 	})
 }
 
+// RequireAdminTwoFactor mirrors security.require_admin_2fa. It is set once at
+// startup, since this package can't import config.
+var RequireAdminTwoFactor bool
+
+// TwoFactorRequired reports whether policy requires user to have two-factor
+// authentication enabled.
+func TwoFactorRequired(user *entities.User) bool {
+	return RequireAdminTwoFactor && (user.Role == "admin" || user.Role == "superadmin")
+}
+
 // UserAuthMiddleware ensures that a user is authenticated and present in the request context.
 // It assumes AuthMiddleware has run earlier in the chain to populate the user in context.
 func UserAuthMiddleware(next http.Handler) http.Handler {
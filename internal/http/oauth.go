@@ -0,0 +1,67 @@
+package http
+
+import (
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+
+	imaAuth "viz/internal/auth"
+	"viz/internal/entities"
+)
+
+// oauthActivityInterval debounces writes to an OAuth token's last_used_at.
+const oauthActivityInterval = time.Minute
+
+// OAuthTokenFromContext returns the OAuth2 access token the request was made
+// with, if any.
+func OAuthTokenFromContext(r *http.Request) (*entities.OAuthToken, bool) {
+	v := r.Context().Value(ctxOAuthToken)
+	if v == nil {
+		return nil, false
+	}
+	t, ok := v.(*entities.OAuthToken)
+	return t, ok
+}
+
+// FindOAuthAccessToken returns the live token for an access token issued by
+// the OAuth2 server, with its user. Unknown, expired and revoked tokens are
+// all gorm.ErrRecordNotFound.
+func FindOAuthAccessToken(db *gorm.DB, accessToken string) (*entities.OAuthToken, error) {
+	hash, _ := imaAuth.HashSecret(accessToken)
+	now := time.Now().UTC()
+
+	var token entities.OAuthToken
+	err := db.Preload("User").
+		Where("access_token_hash = ? AND revoked_at IS NULL AND access_expires_at > ?", hash, now).
+		First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if token.User == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > oauthActivityInterval {
+		db.Model(&token).UpdateColumn("last_used_at", now)
+		token.LastUsedAt = &now
+	}
+
+	return &token, nil
+}
+
+// hasScopes reports whether granted holds every one of required.
+func hasScopes(granted []string, required []imaAuth.Scope) bool {
+	have := make(map[imaAuth.Scope]bool, len(granted))
+	for _, s := range granted {
+		have[imaAuth.Scope(s)] = true
+	}
+
+	for _, scope := range required {
+		if !have[scope] {
+			return false
+		}
+	}
+	return true
+}
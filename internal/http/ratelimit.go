@@ -0,0 +1,383 @@
+package http
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/render"
+	goredis "github.com/redis/go-redis/v9"
+
+	"viz/internal/dto"
+)
+
+// RateLimitStore keeps the counters and lockouts behind a Limiter.
+type RateLimitStore interface {
+	// Incr adds one to key and returns the new count. A new key expires
+	// window after its first increment.
+	Incr(ctx context.Context, key string, window time.Duration) (int64, error)
+	// Lock marks key as locked for d.
+	Lock(ctx context.Context, key string, d time.Duration) error
+	// LockedFor returns how long key stays locked, or 0 if it isn't.
+	LockedFor(ctx context.Context, key string) (time.Duration, error)
+	Reset(ctx context.Context, keys ...string) error
+}
+
+// MemoryRateLimitStore keeps counters in process. Each API instance counts
+// on its own, so use the Redis store when running several.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	entries   map[string]*rateLimitEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type rateLimitEntry struct {
+	count     int64
+	expiresAt time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{entries: make(map[string]*rateLimitEntry), now: time.Now}
+}
+
+// live returns key's entry if it hasn't expired. The caller holds mu.
+func (s *MemoryRateLimitStore) live(key string, now time.Time) *rateLimitEntry {
+	entry, ok := s.entries[key]
+	if !ok || !now.Before(entry.expiresAt) {
+		delete(s.entries, key)
+		return nil
+	}
+	return entry
+}
+
+// sweep drops expired entries at most once a minute. The caller holds mu.
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for key, entry := range s.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+func (s *MemoryRateLimitStore) Incr(ctx context.Context, key string, window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	entry := s.live(key, now)
+	if entry == nil {
+		entry = &rateLimitEntry{expiresAt: now.Add(window)}
+		s.entries[key] = entry
+	}
+	entry.count++
+
+	return entry.count, nil
+}
+
+func (s *MemoryRateLimitStore) Lock(ctx context.Context, key string, d time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = &rateLimitEntry{count: 1, expiresAt: s.now().Add(d)}
+	return nil
+}
+
+func (s *MemoryRateLimitStore) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if entry := s.live(key, now); entry != nil {
+		return entry.expiresAt.Sub(now), nil
+	}
+	return 0, nil
+}
+
+func (s *MemoryRateLimitStore) Reset(ctx context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// RedisRateLimitStore shares counters between API instances.
+type RedisRateLimitStore struct {
+	client *goredis.Client
+	prefix string
+}
+
+// incrScript sets the expiry in the same step as the first increment, so a
+// counter can't be left behind without one.
+var incrScript = goredis.NewScript(`
+local n = redis.call("INCR", KEYS[1])
+if n == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return n
+`)
+
+func NewRedisRateLimitStore(client *goredis.Client) *RedisRateLimitStore {
+	return &RedisRateLimitStore{client: client, prefix: "viz:ratelimit:"}
+}
+
+func (s *RedisRateLimitStore) Incr(ctx context.Context, key string, window time.Duration) (int64, error) {
+	return incrScript.Run(ctx, s.client, []string{s.prefix + key}, window.Milliseconds()).Int64()
+}
+
+func (s *RedisRateLimitStore) Lock(ctx context.Context, key string, d time.Duration) error {
+	return s.client.Set(ctx, s.prefix+key, 1, d).Err()
+}
+
+func (s *RedisRateLimitStore) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := s.client.PTTL(ctx, s.prefix+key).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	// PTTL is negative for a missing key or one without an expiry.
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+func (s *RedisRateLimitStore) Reset(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = s.prefix + key
+	}
+	return s.client.Del(ctx, prefixed...).Err()
+}
+
+// RateLimitPolicy says how hard a Limiter pushes back.
+type RateLimitPolicy struct {
+	// Requests each key may make per Window. 0 turns throttling off.
+	Requests int
+	Window   time.Duration
+	// MaxFailures within FailureWindow locks a key out for Lockout. Each
+	// further failure doubles the lockout, up to MaxLockout.
+	MaxFailures   int
+	FailureWindow time.Duration
+	Lockout       time.Duration
+	MaxLockout    time.Duration
+}
+
+// Lockout describes a key being locked out after repeated failures.
+type Lockout struct {
+	Scope    string
+	Key      string
+	IP       string
+	Failures int64
+	Duration time.Duration
+}
+
+// Limiter throttles requests and locks out keys that keep failing, e.g. an
+// IP guessing passwords. Keys are made with IPKey, AccountKey and TokenKey
+// and counted separately per scope, such as "login" or "download".
+//
+// A nil *Limiter allows everything, which is how rate limiting is turned off.
+type Limiter struct {
+	store  RateLimitStore
+	policy RateLimitPolicy
+	logger *slog.Logger
+
+	// TrustProxyHeaders takes the client IP from X-Forwarded-For.
+	TrustProxyHeaders bool
+	// OnLockout, if set, is called whenever a key is locked out.
+	OnLockout func(ctx context.Context, lockout Lockout)
+}
+
+func NewLimiter(store RateLimitStore, policy RateLimitPolicy, logger *slog.Logger) *Limiter {
+	return &Limiter{store: store, policy: policy, logger: logger}
+}
+
+const tooManyAttemptsMessage = "Too many attempts, please try again later"
+
+// ClientIP is the address req came from. With trustProxy it is the address
+// the nearest proxy saw, the last entry in X-Forwarded-For.
+func ClientIP(req *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if forwarded := req.Header.Get("X-Forwarded-For"); forwarded != "" {
+			hops := strings.Split(forwarded, ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// IPKey keys on the address req came from.
+func (l *Limiter) IPKey(req *http.Request) string {
+	return "ip:" + ClientIP(req, l != nil && l.TrustProxyHeaders)
+}
+
+// AccountKey keys on an account, by email or UID.
+func AccountKey(account string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(account))
+}
+
+// TokenKey keys on a share or download token.
+func TokenKey(token string) string {
+	return "token:" + token
+}
+
+func failuresKey(scope, key string) string { return "fail:" + scope + ":" + key }
+func lockKey(scope, key string) string     { return "lock:" + scope + ":" + key }
+func requestsKey(scope, key string) string { return "req:" + scope + ":" + key }
+
+// Check returns how long until none of keys is locked out of scope.
+func (l *Limiter) Check(ctx context.Context, scope string, keys ...string) time.Duration {
+	if l == nil {
+		return 0
+	}
+
+	var wait time.Duration
+	for _, key := range keys {
+		d, err := l.store.LockedFor(ctx, lockKey(scope, key))
+		if err != nil {
+			// A broken store shouldn't lock everybody out.
+			l.logger.Warn("rate limit store unavailable", slog.Any("error", err))
+			return 0
+		}
+		wait = max(wait, d)
+	}
+
+	return wait
+}
+
+// Failure counts a failed attempt against each of keys and locks out the
+// ones that have failed too often.
+func (l *Limiter) Failure(req *http.Request, scope string, keys ...string) {
+	if l == nil || l.policy.MaxFailures <= 0 {
+		return
+	}
+
+	ctx := req.Context()
+	for _, key := range keys {
+		failures, err := l.store.Incr(ctx, failuresKey(scope, key), l.policy.FailureWindow)
+		if err != nil {
+			l.logger.Warn("rate limit store unavailable", slog.Any("error", err))
+			return
+		}
+
+		if failures < int64(l.policy.MaxFailures) {
+			continue
+		}
+
+		lockout := l.lockoutFor(failures)
+		if err := l.store.Lock(ctx, lockKey(scope, key), lockout); err != nil {
+			l.logger.Warn("rate limit store unavailable", slog.Any("error", err))
+			return
+		}
+
+		event := Lockout{
+			Scope:    scope,
+			Key:      key,
+			IP:       ClientIP(req, l.TrustProxyHeaders),
+			Failures: failures,
+			Duration: lockout,
+		}
+
+		l.logger.Warn("locked out after repeated failures",
+			slog.String("scope", scope),
+			slog.String("key", key),
+			slog.Int64("failures", failures),
+			slog.Duration("lockout", lockout),
+		)
+
+		if l.OnLockout != nil {
+			l.OnLockout(ctx, event)
+		}
+	}
+}
+
+// lockoutFor doubles the base lockout for every failure past the limit.
+func (l *Limiter) lockoutFor(failures int64) time.Duration {
+	lockout := l.policy.Lockout
+	for i := int64(l.policy.MaxFailures); i < failures && lockout < l.policy.MaxLockout; i++ {
+		lockout *= 2
+	}
+	return min(lockout, l.policy.MaxLockout)
+}
+
+// Success clears the failures and lockouts of keys in scope.
+func (l *Limiter) Success(ctx context.Context, scope string, keys ...string) {
+	if l == nil {
+		return
+	}
+
+	var clear []string
+	for _, key := range keys {
+		clear = append(clear, failuresKey(scope, key), lockKey(scope, key))
+	}
+
+	if err := l.store.Reset(ctx, clear...); err != nil {
+		l.logger.Warn("rate limit store unavailable", slog.Any("error", err))
+	}
+}
+
+// TooManyRequests writes the response every rate limited request gets,
+// whichever key tripped the limit.
+func TooManyRequests(res http.ResponseWriter, req *http.Request, retryAfter time.Duration) {
+	seconds := int((retryAfter + time.Second - 1) / time.Second)
+	res.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+	render.Status(req, http.StatusTooManyRequests)
+	render.JSON(res, req, dto.ErrorResponse{Error: tooManyAttemptsMessage})
+}
+
+// Throttle is middleware allowing each client IP policy.Requests requests
+// to scope per policy.Window, and none while the IP is locked out of scope.
+func (l *Limiter) Throttle(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if l == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			key := l.IPKey(req)
+
+			if wait := l.Check(req.Context(), scope, key); wait > 0 {
+				TooManyRequests(res, req, wait)
+				return
+			}
+
+			if l.policy.Requests > 0 {
+				count, err := l.store.Incr(req.Context(), requestsKey(scope, key), l.policy.Window)
+				if err != nil {
+					l.logger.Warn("rate limit store unavailable", slog.Any("error", err))
+				} else if count > int64(l.policy.Requests) {
+					TooManyRequests(res, req, l.policy.Window)
+					return
+				}
+			}
+
+			next.ServeHTTP(res, req)
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package http
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestLimiter(policy RateLimitPolicy) (*Limiter, *time.Time) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+
+	return NewLimiter(store, policy, slog.New(slog.NewTextHandler(io.Discard, nil))), &now
+}
+
+func TestLimiterLockout(t *testing.T) {
+	limiter, now := newTestLimiter(RateLimitPolicy{
+		MaxFailures:   3,
+		FailureWindow: time.Hour,
+		Lockout:       time.Minute,
+		MaxLockout:    5 * time.Minute,
+	})
+
+	var lockouts []Lockout
+	limiter.OnLockout = func(ctx context.Context, lockout Lockout) { lockouts = append(lockouts, lockout) }
+
+	req := httptest.NewRequest(http.MethodPost, "/login", nil)
+	ctx := context.Background()
+	key := AccountKey("Ada@Example.com ")
+
+	for range 2 {
+		limiter.Failure(req, "login", key)
+	}
+	if wait := limiter.Check(ctx, "login", key); wait != 0 {
+		t.Fatalf("locked out before the limit, wait = %s", wait)
+	}
+
+	// Each failure past the limit doubles the lockout, up to the maximum.
+	for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute} {
+		limiter.Failure(req, "login", key)
+		if wait := limiter.Check(ctx, "login", AccountKey("ada@example.com")); wait != want {
+			t.Errorf("wait = %s, want %s", wait, want)
+		}
+	}
+
+	if len(lockouts) != 4 || lockouts[0].Key != "account:ada@example.com" || lockouts[0].IP != "192.0.2.1" {
+		t.Errorf("lockouts = %+v", lockouts)
+	}
+
+	if wait := limiter.Check(ctx, "download", key); wait != 0 {
+		t.Errorf("lockout leaked into another scope, wait = %s", wait)
+	}
+
+	*now = now.Add(5 * time.Minute)
+	if wait := limiter.Check(ctx, "login", key); wait != 0 {
+		t.Errorf("lockout didn't expire, wait = %s", wait)
+	}
+
+	limiter.Success(ctx, "login", key)
+	limiter.Failure(req, "login", key)
+	if wait := limiter.Check(ctx, "login", key); wait != 0 {
+		t.Errorf("success didn't reset failures, wait = %s", wait)
+	}
+}
+
+func TestLimiterThrottle(t *testing.T) {
+	limiter, now := newTestLimiter(RateLimitPolicy{Requests: 2, Window: time.Minute})
+
+	handler := limiter.Throttle("login")(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusNoContent)
+	}))
+
+	do := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = remoteAddr
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res
+	}
+
+	for range 2 {
+		if res := do("192.0.2.1:1234"); res.Code != http.StatusNoContent {
+			t.Fatalf("status = %d, want 204", res.Code)
+		}
+	}
+
+	res := do("192.0.2.1:5678")
+	if res.Code != http.StatusTooManyRequests || res.Header().Get("Retry-After") == "" {
+		t.Errorf("status = %d, Retry-After = %q", res.Code, res.Header().Get("Retry-After"))
+	}
+
+	if res := do("192.0.2.2:1234"); res.Code != http.StatusNoContent {
+		t.Errorf("another IP was throttled, status = %d", res.Code)
+	}
+
+	*now = now.Add(time.Minute)
+	if res := do("192.0.2.1:1234"); res.Code != http.StatusNoContent {
+		t.Errorf("throttle didn't reset after the window, status = %d", res.Code)
+	}
+}
+
+func TestNilLimiterAllowsEverything(t *testing.T) {
+	var limiter *Limiter
+	req := httptest.NewRequest(http.MethodPost, "/login", nil)
+
+	limiter.Failure(req, "login", limiter.IPKey(req))
+	if wait := limiter.Check(req.Context(), "login", limiter.IPKey(req)); wait != 0 {
+		t.Errorf("wait = %s", wait)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.2:4321"
+	req.Header.Set("X-Forwarded-For", "198.51.100.9, 203.0.113.7")
+
+	if ip := ClientIP(req, false); ip != "10.0.0.2" {
+		t.Errorf("untrusted ClientIP = %q", ip)
+	}
+	if ip := ClientIP(req, true); ip != "203.0.113.7" {
+		t.Errorf("trusted ClientIP = %q", ip)
+	}
+}
@@ -0,0 +1,86 @@
+package http
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+
+	imaAuth "viz/internal/auth"
+	"viz/internal/entities"
+)
+
+// ErrSessionExpired is returned for a session past its absolute expiry or
+// its idle timeout.
+var ErrSessionExpired = errors.New("session expired")
+
+// HashSessionToken is how a session token is stored, and how the session
+// cache is keyed, so that neither holds a usable token.
+func HashSessionToken(token string) string {
+	hash, _ := imaAuth.HashSecret(token)
+	return hash
+}
+
+// SessionExpiry is when sess ends: at ExpiresAt, or Timeout seconds after it
+// was last active, whichever comes first. It is zero for a session that
+// never ends.
+func SessionExpiry(sess *entities.Session) time.Time {
+	var expiry time.Time
+	if sess.ExpiresAt != nil {
+		expiry = *sess.ExpiresAt
+	}
+
+	if sess.Timeout != nil && *sess.Timeout > 0 {
+		lastActive := sess.CreatedAt
+		if sess.LastActive != nil {
+			lastActive = *sess.LastActive
+		}
+
+		idle := lastActive.Add(time.Duration(*sess.Timeout) * time.Second)
+		if expiry.IsZero() || idle.Before(expiry) {
+			expiry = idle
+		}
+	}
+
+	return expiry
+}
+
+// FindSession returns the session for the token in a client's cookie. It
+// returns gorm.ErrRecordNotFound for an unknown token and ErrSessionExpired
+// for one that has ended, which it also deletes.
+func FindSession(db *gorm.DB, token string) (*entities.SessionWithToken, error) {
+	var sess entities.SessionWithToken
+	if err := db.Where("token_hash = ?", HashSessionToken(token)).First(&sess).Error; err != nil {
+		return nil, err
+	}
+
+	if expiry := SessionExpiry(&sess.Session); !expiry.IsZero() && time.Now().After(expiry) {
+		db.Delete(&sess.Session)
+		return nil, ErrSessionExpired
+	}
+
+	return &sess, nil
+}
+
+// sessionActivityInterval debounces writes to a session's last_active.
+const sessionActivityInterval = 5 * time.Minute
+
+// TouchSession records that sess is in use, which keeps its idle timeout
+// from running out. Writes are debounced and happen in the background.
+func TouchSession(db *gorm.DB, sess *entities.Session, clientIP string, logger *slog.Logger) {
+	if sess.LastActive != nil && time.Since(*sess.LastActive) < sessionActivityInterval {
+		return
+	}
+
+	go func(uid string) {
+		err := db.Model(&entities.Session{}).Where("uid = ?", uid).Updates(map[string]any{
+			"last_active": time.Now(),
+			"client_ip":   clientIP,
+		}).Error
+
+		if err != nil {
+			logger.Error("failed to update session last_active", slog.Any("error", err))
+		}
+	}(sess.Uid)
+}
@@ -0,0 +1,197 @@
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Query parameters a signed URL carries besides the ones it signs.
+const (
+	SignatureParam        = "sig"
+	SignatureExpiresParam = "exp"
+	// SignatureBindParam is set to "ip" when the URL only works from the
+	// address it was signed for. The address itself is part of the
+	// signature, not the URL, so it isn't given away to whoever sees it.
+	SignatureBindParam = "bind"
+)
+
+// URLSigningKeyFile is where a generated signing key is kept under the base
+// directory, so signed URLs survive restarts.
+const URLSigningKeyFile = "url_signing.key"
+
+var (
+	ErrSignatureInvalid = errors.New("invalid signature")
+	ErrSignatureExpired = errors.New("signature expired")
+)
+
+// URLSigningKey is the HMAC key for signed URLs. It is set once at startup,
+// since this package can't import config.
+var URLSigningKey []byte
+
+const ctxSignedURL ctxKey = "signedURL"
+
+// LoadURLSigningKey returns the configured signing key, or, if there isn't
+// one, a random key generated once and kept in dir. Every instance sharing
+// dir then signs and verifies alike.
+func LoadURLSigningKey(configured, dir string) ([]byte, error) {
+	if configured != "" {
+		return []byte(configured), nil
+	}
+
+	path := filepath.Join(dir, URLSigningKeyFile)
+	if data, err := os.ReadFile(path); err == nil {
+		if key, err := hex.DecodeString(strings.TrimSpace(string(data))); err == nil && len(key) >= 32 {
+			return key, nil
+		}
+		return nil, errors.New("url signing key file is invalid: " + path)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0o600); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// SignURL signs path and query so the URL can be used without signing in
+// until expires. If clientIP is set, the URL only works from that address.
+// path is relative to the API, e.g. /images/{uid}/file.
+func SignURL(path string, query url.Values, expires time.Time, clientIP string) string {
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = append([]string(nil), v...)
+	}
+
+	q.Del(SignatureParam)
+	q.Del(SignatureBindParam)
+	q.Set(SignatureExpiresParam, strconv.FormatInt(expires.Unix(), 10))
+	if clientIP != "" {
+		q.Set(SignatureBindParam, "ip")
+	}
+
+	q.Set(SignatureParam, urlSignature(path, q, clientIP))
+	return path + "?" + q.Encode()
+}
+
+// urlSignature is the signature of path and q, which mustn't have one
+// already. Encode sorts the query by key, so the order parameters are given
+// in doesn't matter.
+func urlSignature(path string, q url.Values, clientIP string) string {
+	if ip := net.ParseIP(clientIP); ip != nil {
+		clientIP = ip.String()
+	}
+
+	mac := hmac.New(sha256.New, URLSigningKey)
+	mac.Write([]byte(path))
+	mac.Write([]byte{'\n'})
+	mac.Write([]byte(q.Encode()))
+	mac.Write([]byte{'\n'})
+	mac.Write([]byte(clientIP))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignedURL checks that r was made with a URL SignURL signed for path
+// and that it hasn't expired. It needs nothing but the key, so no lookups.
+func VerifySignedURL(r *http.Request, path string) error {
+	q := r.URL.Query()
+	sig := q.Get(SignatureParam)
+	if sig == "" || len(URLSigningKey) == 0 {
+		return ErrSignatureInvalid
+	}
+	q.Del(SignatureParam)
+
+	expires, err := strconv.ParseInt(q.Get(SignatureExpiresParam), 10, 64)
+	if err != nil {
+		return ErrSignatureInvalid
+	}
+
+	var clientIP string
+	if q.Get(SignatureBindParam) == "ip" {
+		clientIP = ClientIP(r, TrustProxyHeaders)
+	}
+
+	if !hmac.Equal([]byte(sig), []byte(urlSignature(path, q, clientIP))) {
+		return ErrSignatureInvalid
+	}
+
+	if time.Now().Unix() > expires {
+		return ErrSignatureExpired
+	}
+
+	return nil
+}
+
+// SignToken signs id so it can be handed out as a token for kind, e.g. an
+// upload link. The token is id and its signature, so a guessed or altered
+// token is turned away before anything is looked up.
+func SignToken(kind, id string) string {
+	return id + "." + tokenSignature(kind, id)
+}
+
+// VerifySignedToken returns the id of a token SignToken made for kind.
+func VerifySignedToken(kind, token string) (string, error) {
+	id, sig, found := strings.Cut(token, ".")
+	if !found || id == "" || len(URLSigningKey) == 0 {
+		return "", ErrSignatureInvalid
+	}
+
+	if !hmac.Equal([]byte(sig), []byte(tokenSignature(kind, id))) {
+		return "", ErrSignatureInvalid
+	}
+
+	return id, nil
+}
+
+// tokenSignature is the signature of id as a token for kind. kind keeps a
+// token for one thing from being used for another.
+func tokenSignature(kind, id string) string {
+	mac := hmac.New(sha256.New, URLSigningKey)
+	mac.Write([]byte("token:" + kind))
+	mac.Write([]byte{'\n'})
+	mac.Write([]byte(id))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SignedURLFromContext reports whether the request was let through by its
+// signed URL rather than by signing in.
+func SignedURLFromContext(r *http.Request) bool {
+	signed, _ := r.Context().Value(ctxSignedURL).(bool)
+	return signed
+}
+
+// apiPath is the request path within the router AuthMiddleware is mounted
+// in, which is what SignURL is given.
+func apiPath(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePath != "" {
+		return rctx.RoutePath
+	}
+
+	return r.URL.Path
+}
@@ -0,0 +1,162 @@
+package http
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func withSigningKey(t *testing.T) {
+	t.Helper()
+	previous := URLSigningKey
+	URLSigningKey = []byte("0123456789abcdef0123456789abcdef")
+	t.Cleanup(func() { URLSigningKey = previous })
+}
+
+func TestSignedURL(t *testing.T) {
+	withSigningKey(t)
+
+	query := url.Values{"format": {"webp"}, "w": {"400"}}
+	signed := SignURL("/images/img1/file", query, time.Now().Add(time.Hour), "")
+	if query.Has(SignatureParam) {
+		t.Fatal("SignURL changed the query it was given")
+	}
+
+	verify := func(target, remoteAddr string) error {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if remoteAddr != "" {
+			req.RemoteAddr = remoteAddr
+		}
+		return VerifySignedURL(req, strings.SplitN(target, "?", 2)[0])
+	}
+
+	if err := verify(signed, ""); err != nil {
+		t.Fatalf("signed URL didn't verify: %v", err)
+	}
+
+	for name, target := range map[string]string{
+		"changed transform": strings.Replace(signed, "w=400", "w=4000", 1),
+		"added param":       signed + "&download=1",
+		"other image":       strings.Replace(signed, "img1", "img2", 1),
+		"longer expiry":     strings.Replace(signed, "exp=", "exp=9", 1),
+		"unsigned":          "/images/img1/file?format=webp&w=400",
+	} {
+		if err := verify(target, ""); err != ErrSignatureInvalid {
+			t.Errorf("%s: err = %v, want ErrSignatureInvalid", name, err)
+		}
+	}
+
+	expired := SignURL("/images/img1/file", query, time.Now().Add(-time.Minute), "")
+	if err := verify(expired, ""); err != ErrSignatureExpired {
+		t.Errorf("expired URL: err = %v, want ErrSignatureExpired", err)
+	}
+
+	bound := SignURL("/images/img1/file", query, time.Now().Add(time.Hour), "203.0.113.7")
+	if strings.Contains(bound, "203.0.113.7") {
+		t.Errorf("bound URL gives away its address: %s", bound)
+	}
+	if err := verify(bound, "203.0.113.7:5000"); err != nil {
+		t.Errorf("bound URL from its address: %v", err)
+	}
+	if err := verify(bound, "198.51.100.1:5000"); err != ErrSignatureInvalid {
+		t.Errorf("bound URL from another address: err = %v, want ErrSignatureInvalid", err)
+	}
+
+	URLSigningKey = []byte("another key, another instance")
+	if err := verify(signed, ""); err != ErrSignatureInvalid {
+		t.Errorf("other key: err = %v, want ErrSignatureInvalid", err)
+	}
+}
+
+func TestSignedToken(t *testing.T) {
+	withSigningKey(t)
+
+	token := SignToken("upload", "link1")
+	if id, err := VerifySignedToken("upload", token); err != nil || id != "link1" {
+		t.Fatalf("VerifySignedToken = %q, %v; want link1", id, err)
+	}
+
+	for name, bad := range map[string]string{
+		"other kind": SignToken("share", "link1"),
+		"altered id": "link2" + strings.TrimPrefix(token, "link1"),
+		"unsigned":   "link1",
+		"empty":      "",
+		"no id":      strings.TrimPrefix(token, "link1"),
+	} {
+		if _, err := VerifySignedToken("upload", bad); err != ErrSignatureInvalid {
+			t.Errorf("%s: err = %v, want ErrSignatureInvalid", name, err)
+		}
+	}
+}
+
+func TestAuthMiddlewareSignedURL(t *testing.T) {
+	withSigningKey(t)
+
+	// Mounted the way the API is, so the signed path is the one within it
+	images := chi.NewRouter()
+	images.Get("/{uid}/file", func(w http.ResponseWriter, r *http.Request) {
+		if !SignedURLFromContext(r) {
+			t.Error("signed request wasn't marked as signed")
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	router := chi.NewRouter()
+	router.Route("/api", func(r chi.Router) {
+		r.Use(AuthMiddleware(nil, slog.New(slog.NewTextHandler(io.Discard, nil))))
+		r.Use(ScopeMiddleware(nil))
+		r.Mount("/images", images)
+	})
+
+	serve := func(method, target string) int {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec.Code
+	}
+
+	signed := SignURL("/images/img1/file", url.Values{"w": {"400"}}, time.Now().Add(time.Hour), "")
+	if code := serve(http.MethodGet, "/api"+signed); code != http.StatusOK {
+		t.Errorf("signed GET = %d, want 200", code)
+	}
+
+	if code := serve(http.MethodGet, "/api"+strings.Replace(signed, "img1", "img2", 1)); code != http.StatusForbidden {
+		t.Errorf("signed GET of another image = %d, want 403", code)
+	}
+
+	// Signatures only stand in for signing in to read
+	if code := serve(http.MethodPost, "/api"+signed); code != http.StatusUnauthorized {
+		t.Errorf("signed POST = %d, want 401", code)
+	}
+}
+
+func TestLoadURLSigningKey(t *testing.T) {
+	dir := t.TempDir()
+
+	if key, err := LoadURLSigningKey("configured", dir); err != nil || string(key) != "configured" {
+		t.Fatalf("configured key = %q, %v", key, err)
+	}
+
+	generated, err := LoadURLSigningKey("", dir)
+	if err != nil || len(generated) != 32 {
+		t.Fatalf("generated key = %x, %v", generated, err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, URLSigningKeyFile))
+	if err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("key file = %v, %v", info, err)
+	}
+
+	again, err := LoadURLSigningKey("", dir)
+	if err != nil || string(again) != string(generated) {
+		t.Errorf("key changed between loads: %x, %v", again, err)
+	}
+}
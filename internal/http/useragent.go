@@ -0,0 +1,61 @@
+package http
+
+import "strings"
+
+// Checked in order, since most browsers also claim to be the ones before
+// them, e.g. Edge's user agent mentions both Chrome and Safari.
+var userAgentBrowsers = []struct{ token, name string }{
+	{"Edg/", "Edge"},
+	{"OPR/", "Opera"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+}
+
+var userAgentPlatforms = []struct{ token, name string }{
+	{"iPhone", "iPhone"},
+	{"iPad", "iPad"},
+	{"Android", "Android"},
+	{"CrOS", "ChromeOS"},
+	{"Windows", "Windows"},
+	{"Macintosh", "macOS"},
+	{"Linux", "Linux"},
+}
+
+// DeviceName makes a name a person would recognise a session by, such as
+// "Firefox on Windows", from a User-Agent header.
+func DeviceName(userAgent string) string {
+	var browser, platform string
+	for _, b := range userAgentBrowsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	for _, p := range userAgentPlatforms {
+		if strings.Contains(userAgent, p.token) {
+			platform = p.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	}
+
+	// Not a browser, e.g. curl/8.5.0 or a client library.
+	if product, _, _ := strings.Cut(strings.TrimSpace(userAgent), " "); product != "" {
+		name, _, _ := strings.Cut(product, "/")
+		return name
+	}
+
+	return "Unknown device"
+}
@@ -16,7 +16,9 @@ import (
 
 // WSClient represents a connected WebSocket client
 type WSClient struct {
-	ID     string
+	ID string
+	// UserID is the user who connected, if they were signed in.
+	UserID string
 	Conn   *websocket.Conn
 	Send   chan []byte
 	Broker *WSBroker
@@ -39,6 +41,8 @@ type WSBroker struct {
 	logger *slog.Logger
 
 	upgrader websocket.Upgrader
+
+	relay func(eventType string, data interface{})
 }
 
 // WSMessage represents a message to be sent via WebSocket
@@ -46,6 +50,7 @@ type WSMessage struct {
 	Event    string      `json:"event"`
 	Data     interface{} `json:"data"`
 	ClientID string      `json:"-"`  // If empty, broadcast to all
+	UserID   string      `json:"-"`  // If set, only sent to the user's clients
 	ID       uint64      `json:"id"` // Monotonic ID for message tracking
 }
 
@@ -120,7 +125,9 @@ func (b *WSBroker) run() {
 			b.mu.Unlock()
 
 		case message := <-b.broadcast:
-			if message.ClientID != "" {
+			if message.UserID != "" {
+				b.sendToUser(message.UserID, message)
+			} else if message.ClientID != "" {
 				// Send to specific client
 				b.sendToClient(message.ClientID, message)
 			} else {
@@ -184,8 +191,46 @@ func (b *WSBroker) sendToClient(clientID string, msg *WSMessage) {
 	}
 }
 
+// sendToUser sends a message to every client of a user. It isn't kept in
+// the history, which everyone connected can read.
+func (b *WSBroker) sendToUser(userID string, msg *WSMessage) {
+	msg.ID = atomic.AddUint64(&b.lastID, 1)
+
+	jsonData, err := json.Marshal(msg)
+	if err != nil {
+		b.logger.Error("Failed to marshal user message", slog.String("error", err.Error()))
+		return
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, client := range b.clients {
+		if client.UserID != userID {
+			continue
+		}
+
+		select {
+		case client.Send <- jsonData:
+		default:
+			b.logger.Warn("Client send buffer full", slog.String("clientId", client.ID))
+		}
+	}
+}
+
+// SetRelay forwards every broadcast to relay as well. Standalone workers use it
+// to pass their events on to the API server, which the clients connect to.
+// Call it before the broker is shared.
+func (b *WSBroker) SetRelay(relay func(eventType string, data interface{})) {
+	b.relay = relay
+}
+
 // Broadcast sends an event to all connected clients
 func (b *WSBroker) Broadcast(eventType string, data interface{}) error {
+	if b.relay != nil {
+		b.relay(eventType, data)
+	}
+
 	select {
 	case b.broadcast <- &WSMessage{
 		Event: eventType,
@@ -211,6 +256,22 @@ func (b *WSBroker) SendToClient(clientID, eventType string, data interface{}) er
 	}
 }
 
+// SendToUser sends an event only to the clients of the user userID, for
+// events others mustn't see. Unlike broadcasts, they aren't relayed or kept
+// in the history.
+func (b *WSBroker) SendToUser(userID, eventType string, data interface{}) error {
+	select {
+	case b.broadcast <- &WSMessage{
+		Event:  eventType,
+		Data:   data,
+		UserID: userID,
+	}:
+		return nil
+	default:
+		return fmt.Errorf("broadcast channel full")
+	}
+}
+
 // GetClientCount returns the number of connected clients
 func (b *WSBroker) GetClientCount() int {
 	b.mu.RLock()
@@ -245,6 +306,9 @@ func (b *WSBroker) ServeWS(w http.ResponseWriter, r *http.Request) {
 		Send:   make(chan []byte, 256),
 		Broker: b,
 	}
+	if user, ok := UserFromContext(r); ok && user != nil {
+		client.UserID = user.Uid
+	}
 
 	// Register client
 	b.register <- client
@@ -42,3 +42,16 @@ func NormalizeToSRGB(img *libvips.Image) error {
 
 	return nil
 }
+
+// ConvertToProfile converts the image to one of libvips' built-in profiles,
+// such as "p3", going through sRGB first so untagged images convert too.
+func ConvertToProfile(img *libvips.Image, profile string) error {
+	if err := NormalizeToSRGB(img); err != nil {
+		return err
+	}
+
+	return img.IccTransform(profile, &libvips.IccTransformOptions{
+		InputProfile: "srgb",
+		Intent:       libvips.IntentPerceptual,
+	})
+}
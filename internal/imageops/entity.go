@@ -0,0 +1,116 @@
+package imageops
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"viz/internal/dto"
+	"viz/internal/entities"
+	libvips "viz/internal/imageops/vips"
+	"viz/internal/images"
+	"viz/internal/uid"
+)
+
+// NewImageEntity builds the entity of a new image from its file, read with
+// libvips. It isn't saved; the caller stores it and the file.
+func NewImageEntity(logger *slog.Logger, fileName string, libvipsImg *libvips.Image) (*entities.ImageAsset, error) {
+	logger.Info("Generating ID", slog.String("file", fileName))
+	id, err := uid.Generate()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ID: %w", err)
+	}
+
+	if strings.Trim(fileName, " ") == "" {
+		fileName = id
+	}
+
+	logger = logger.With(
+		slog.String("name", fileName),
+		slog.String("id", id),
+	)
+
+	logger.Info("reading exif data")
+	exifData := libvipsImg.Exif()
+
+	if len(exifData) == 0 {
+		logger.Warn("No exif data found. Blank fields", slog.String("file", fileName))
+	} else {
+		logger.Debug("exif data", slog.Any("data", exifData), slog.Int("length", len(exifData)))
+	}
+
+	exif, fileCreatedAt, fileModifiedAt := BuildImageEXIF(exifData)
+
+	// If EXIF contains a rating-like value, parse it and set the initial
+	// canonical rating on the image entity (clamped to 0..5). We store the
+	// raw EXIF rating in Exif.Rating as provenance but the top-level Rating
+	// becomes the canonical value once DB column exists / migration runs.
+	var initialRating *int
+	if exif.Rating != nil {
+		if r, err := strconv.Atoi(*exif.Rating); err == nil {
+			if r < 0 {
+				r = 0
+			} else if r > 5 {
+				r = 5
+			}
+			initialRating = &r
+		}
+	}
+
+	var keywords []string
+	keywordsPtr := FindExif(exifData, "Keywords", "Subject")
+	if keywordsPtr != nil {
+		keywords = strings.Split(*keywordsPtr, ",")
+	}
+
+	label := dto.ImageMetadataLabelNone
+
+	metadata := dto.ImageMetadata{
+		FileName:         fileName,
+		OriginalFileName: &fileName,
+		FileType:         string(libvipsImg.Format()),
+		ColorSpace:       GetColourSpaceString(libvipsImg),
+		FileModifiedAt:   fileModifiedAt,
+		FileCreatedAt:    fileCreatedAt,
+		Keywords:         &keywords,
+		Label:            &label,
+	}
+
+	// Seed canonical rating into the stored image metadata (NULL = unrated)
+	metadata.Rating = initialRating
+
+	// Construct paths with reasonable defaults matching the {uid}/file route params
+	originalPath := fmt.Sprintf("/images/%s/file", id)
+
+	thumbParams, _ := images.GetPermanentTransformParams(images.TransformThumbnail)
+	previewParams, _ := images.GetPermanentTransformParams(images.TransformPreview)
+
+	thumbnailPath := fmt.Sprintf("/images/%s/file?%s", id, thumbParams.ToQueryString())
+	previewPath := fmt.Sprintf("/images/%s/file?%s", id, previewParams.ToQueryString())
+
+	paths := dto.ImagePaths{
+		Original:  originalPath,
+		Thumbnail: thumbnailPath,
+		Preview:   previewPath,
+	}
+
+	allImageData := entities.ImageAsset{
+		Uid:           id,
+		Name:          fileName,
+		Private:       false,
+		Processed:     false,
+		Exif:          &exif,
+		ImageMetadata: &metadata,
+		ImagePaths:    paths,
+		Width:         int32(libvipsImg.Width()),
+		Height:        int32(libvipsImg.Height()),
+		Description:   nil, // TODO: evaluate if necessary, blank for now
+	}
+
+	ta := GetTakenAt(allImageData)
+	allImageData.TakenAt = &ta
+
+	return &allImageData, nil
+}
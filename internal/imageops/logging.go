@@ -0,0 +1,50 @@
+package imageops
+
+import (
+	"fmt"
+	"log/slog"
+
+	"viz/internal/config"
+	libvips "viz/internal/imageops/vips"
+	imalog "viz/internal/logger"
+)
+
+// ConfigureLogging routes libvips log messages to logger, at the server's log
+// level if cfg.MatchSystemLogging is set.
+func ConfigureLogging(cfg config.LibvipsConfig, logger *slog.Logger, logLevel slog.Level) {
+	var libvipsLogLevel libvips.LogLevel = libvips.LogLevelInfo
+	if cfg.MatchSystemLogging {
+		switch logLevel {
+		case slog.LevelDebug:
+			libvipsLogLevel = libvips.LogLevelDebug
+		case slog.LevelInfo:
+			libvipsLogLevel = libvips.LogLevelInfo
+		case slog.LevelWarn:
+			libvipsLogLevel = libvips.LogLevelWarning
+		case slog.LevelError:
+			libvipsLogLevel = libvips.LogLevelError
+		default:
+			libvipsLogLevel = libvips.LogLevelInfo
+		}
+	} else {
+		// TODO: fix this error message, it sucks and is confusing
+		logger.Info("libvipsLogLevel: matching server level is off. using default: info")
+	}
+
+	var libvipsLogHandler libvips.LoggingHandlerFunction = func(messageDomain string, messageLevel libvips.LogLevel, message string) {
+		switch messageLevel {
+		case libvips.LogLevelCritical:
+			imalog.Fatal(logger, fmt.Sprintf("%s: %s", messageDomain, message))
+		case libvips.LogLevelError:
+			logger.Error(fmt.Sprintf("%s: %s", messageDomain, message))
+		case libvips.LogLevelWarning:
+			logger.Warn(fmt.Sprintf("%s: %s", messageDomain, message))
+		case libvips.LogLevelMessage, libvips.LogLevelInfo:
+			logger.Info(fmt.Sprintf("%s: %s", messageDomain, message))
+		case libvips.LogLevelDebug:
+			logger.Debug(fmt.Sprintf("%s: %s", messageDomain, message))
+		}
+	}
+
+	libvips.SetLogging(libvipsLogHandler, libvipsLogLevel)
+}
@@ -3,6 +3,7 @@ package imageops
 import (
 	"fmt"
 	"viz/internal/entities"
+	"viz/internal/images"
 	libvips "viz/internal/imageops/vips"
 	"viz/internal/transform"
 	"net/url"
@@ -27,6 +28,11 @@ func ParseTransformParams(pathStr string) (*transform.TransformParams, error) {
 	params.Format = q.Get("format")
 	params.Flip = q.Get("flip")
 	params.Kernel = q.Get("kernel")
+	// sRGB is the default and has no name of its own
+	if profile := q.Get("profile"); profile == "p3" || profile == "original" {
+		params.ColorProfile = profile
+	}
+	params.KeepMetadata = q.Get("metadata") == "keep"
 
 	// Check for 'w' (short for width) first, then 'width'
 	if widthParam := q.Get("w"); widthParam != "" {
@@ -56,6 +62,12 @@ func ParseTransformParams(pathStr string) (*transform.TransformParams, error) {
 		}
 	}
 
+	if longParam := q.Get("long"); longParam != "" {
+		if l, err := strconv.ParseInt(longParam, 10, 64); err == nil {
+			params.LongEdge = l
+		}
+	}
+
 	if rotateParam := q.Get("rotate"); rotateParam != "" {
 		if r, err := strconv.Atoi(rotateParam); err == nil {
 			params.Rotate = r
@@ -98,9 +110,18 @@ func GenerateTransform(params *transform.TransformParams, imgEnt entities.ImageA
 		return nil, fmt.Errorf("failed to auto-rotate image: %w", err)
 	}
 
-	// Ensure consistent color profile (sRGB) for web display
-	if err := NormalizeToSRGB(libvipsImg); err != nil {
-		return nil, fmt.Errorf("failed to normalize to sRGB: %w", err)
+	// Ensure consistent color profile (sRGB) for web display, unless
+	// another profile was asked for
+	switch params.ColorProfile {
+	case "original":
+	case "p3":
+		if err := ConvertToProfile(libvipsImg, "p3"); err != nil {
+			return nil, fmt.Errorf("failed to convert to Display P3: %w", err)
+		}
+	default:
+		if err := NormalizeToSRGB(libvipsImg); err != nil {
+			return nil, fmt.Errorf("failed to normalize to sRGB: %w", err)
+		}
 	}
 
 	if params.Rotate > 0 {
@@ -184,17 +205,35 @@ func GenerateTransform(params *transform.TransformParams, imgEnt entities.ImageA
 		}
 	}
 
+	if params.LongEdge > 0 {
+		longest := max(libvipsImg.Width(), libvipsImg.Height())
+		if scale := float64(params.LongEdge) / float64(longest); scale < 1 {
+			if err := libvipsImg.Resize(scale, &libvips.ResizeOptions{Kernel: libvips.KernelLanczos3}); err != nil {
+				return nil, fmt.Errorf("failed to resize image: %w", err)
+			}
+		}
+	}
+
+	// Metadata is stripped unless asked for, but a profile other than sRGB
+	// means nothing without its ICC profile
+	keep := libvips.KeepNone
+	if params.KeepMetadata {
+		keep = libvips.KeepAll
+	} else if params.ColorProfile != "" {
+		keep = libvips.KeepIcc
+	}
+
 	// Encode
 	var imageData []byte
 	switch params.Format {
 	case "webp":
-		imageData, err = libvipsImg.WebpsaveBuffer(&libvips.WebpsaveBufferOptions{Q: int(params.Quality)})
+		imageData, err = libvipsImg.WebpsaveBuffer(&libvips.WebpsaveBufferOptions{Q: int(params.Quality), Keep: keep})
 	case "png":
-		imageData, err = libvipsImg.PngsaveBuffer(&libvips.PngsaveBufferOptions{Filter: libvips.PngFilterNone, Interlace: false, Palette: false, Compression: int(params.Quality)})
+		imageData, err = libvipsImg.PngsaveBuffer(&libvips.PngsaveBufferOptions{Filter: libvips.PngFilterNone, Interlace: false, Palette: false, Compression: int(params.Quality), Keep: keep})
 	case "jpg", "jpeg":
-		imageData, err = libvipsImg.JpegsaveBuffer(&libvips.JpegsaveBufferOptions{Q: int(params.Quality), Interlace: true})
+		imageData, err = libvipsImg.JpegsaveBuffer(&libvips.JpegsaveBufferOptions{Q: int(params.Quality), Interlace: true, Keep: keep})
 	case "avif", "heif":
-		imageData, err = libvipsImg.HeifsaveBuffer(&libvips.HeifsaveBufferOptions{Q: int(params.Quality), Bitdepth: 8, Effort: 5, Lossless: false})
+		imageData, err = libvipsImg.HeifsaveBuffer(&libvips.HeifsaveBufferOptions{Q: int(params.Quality), Bitdepth: 8, Effort: 5, Lossless: false, Keep: keep})
 	default:
 		imageData, err = libvipsImg.RawsaveBuffer(&libvips.RawsaveBufferOptions{Keep: libvips.KeepAll})
 	}
@@ -208,3 +247,36 @@ func GenerateTransform(params *transform.TransformParams, imgEnt entities.ImageA
 		Ext:           ext,
 	}, nil
 }
+
+// CachedTransform returns the transformed image from the transform cache,
+// generating and caching it first if it isn't there yet.
+func CachedTransform(params *transform.TransformParams, imgEnt entities.ImageAsset) ([]byte, error) {
+	if imgEnt.ImageMetadata == nil {
+		return nil, fmt.Errorf("missing image metadata to determine file type")
+	}
+
+	ext := params.Format
+	if ext == "" {
+		ext = imgEnt.ImageMetadata.FileType
+	}
+
+	key := transform.CreateTransformEtag(imgEnt, params)
+	if data, err := images.ReadCachedTransform(imgEnt.Uid, *key, ext); err == nil {
+		return data, nil
+	}
+
+	originalData, err := images.ReadImage(imgEnt.Uid, imgEnt.ImageMetadata.FileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read original for transform: %w", err)
+	}
+
+	result, err := GenerateTransform(params, imgEnt, originalData)
+	if err != nil {
+		return nil, err
+	}
+
+	// A transform that couldn't be cached is still good to use
+	_ = images.WriteCachedTransform(imgEnt.Uid, *key, ext, result.ImageData)
+
+	return result.ImageData, nil
+}
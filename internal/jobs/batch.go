@@ -0,0 +1,325 @@
+package jobs
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"gorm.io/gorm"
+
+	"viz/internal/entities"
+	libhttp "viz/internal/http"
+)
+
+// Broker receives "batch-progress" events. It is set during startup; when nil,
+// batch progress is still persisted but nothing is broadcast.
+var Broker *libhttp.WSBroker
+
+// batchBroadcastInterval throttles batch-progress events so a batch of
+// thousands of small jobs doesn't flood the WebSocket clients.
+const batchBroadcastInterval = 500 * time.Millisecond
+
+// batchTracker holds the last persisted state of an active batch plus the
+// progress of its currently running jobs, which is only known in memory.
+type batchTracker struct {
+	batch         entities.JobBatch
+	running       map[string]int
+	lastBroadcast time.Time
+}
+
+var (
+	batchesMu  sync.Mutex
+	batches    = map[string]*batchTracker{}
+	jobBatches = map[string]string{}
+)
+
+// CreateBatch persists a new JobBatch for a bulk request. The total is a first
+// estimate; call SealBatch once every job has been enqueued.
+func CreateBatch(db *gorm.DB, topic string, cmd *JobCommand, total int) (*entities.JobBatch, error) {
+	var cmdStr *string
+	if cmd != nil {
+		s := string(*cmd)
+		cmdStr = &s
+	}
+
+	batch := entities.JobBatch{
+		Uid:     watermill.NewUUID(),
+		Type:    topic,
+		Topic:   topic,
+		Command: cmdStr,
+		Status:  string(WorkerJobStatusQueued),
+		Total:   total,
+	}
+
+	if err := db.Create(&batch).Error; err != nil {
+		return nil, fmt.Errorf("failed to persist job batch: %w", err)
+	}
+
+	return &batch, nil
+}
+
+// SealBatch sets the batch total to the number of jobs that were actually
+// enqueued for it. Images can disappear (or fail to load) between counting
+// and enqueueing, and without this the batch would never finish.
+func SealBatch(db *gorm.DB, batchUid string) error {
+	var batch entities.JobBatch
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var total int64
+		if err := tx.Model(&entities.WorkerJob{}).Where("batch_uid = ?", batchUid).Count(&total).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&entities.JobBatch{}).Where("uid = ?", batchUid).Update("total", total).Error; err != nil {
+			return err
+		}
+
+		return refreshBatch(tx, batchUid, &batch)
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to seal job batch: %w", err)
+	}
+
+	trackBatchJob(batch, "", WorkerJobStatusQueued)
+	return nil
+}
+
+// GetBatchFailedImageUids returns the image UIDs of the failed jobs in a batch.
+func GetBatchFailedImageUids(db *gorm.DB, batchUid string) ([]string, error) {
+	uids := []string{}
+	err := db.Model(&entities.WorkerJob{}).
+		Where("batch_uid = ? AND status = ? AND image_uid IS NOT NULL", batchUid, WorkerJobStatusFailed).
+		Order("enqueued_at asc").
+		Pluck("image_uid", &uids).Error
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list failed batch images: %w", err)
+	}
+
+	return uids, nil
+}
+
+// batchCounterColumn maps a terminal job status to the batch counter it is
+// tallied under.
+func batchCounterColumn(status JobStatus) string {
+	switch status {
+	case WorkerJobStatusSuccess:
+		return "completed"
+	case WorkerJobStatusFailed:
+		return "failed"
+	case WorkerJobStatusCancelled:
+		return "cancelled"
+	}
+	return ""
+}
+
+// updateBatchCounters moves a job's contribution from its previous status to
+// the new one. Counting transitions (instead of incrementing on every update)
+// keeps the totals right when the Retry middleware re-runs a failed job.
+func updateBatchCounters(tx *gorm.DB, batchUid string, prev JobStatus, next JobStatus) (*entities.JobBatch, error) {
+	if prev == next {
+		return nil, nil
+	}
+
+	updates := map[string]any{}
+	if col := batchCounterColumn(prev); col != "" {
+		updates[col] = gorm.Expr(col + " - 1")
+	}
+
+	if col := batchCounterColumn(next); col != "" {
+		updates[col] = gorm.Expr(col + " + 1")
+	}
+
+	if next == WorkerJobStatusRunning {
+		updates["started_at"] = gorm.Expr("COALESCE(started_at, ?)", time.Now().UTC())
+	}
+
+	if len(updates) > 0 {
+		if err := tx.Model(&entities.JobBatch{}).Where("uid = ?", batchUid).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	var batch entities.JobBatch
+	if err := refreshBatch(tx, batchUid, &batch); err != nil {
+		return nil, err
+	}
+
+	return &batch, nil
+}
+
+// batchStatusPartial is the status of a finished batch where some jobs
+// failed and others completed.
+const batchStatusPartial = "partial"
+
+// batchStatus works out a batch's status from its counters. A finished batch
+// with failed jobs is failed when none completed, and partial otherwise, so
+// failures aren't reported as success; the counters say how many.
+func batchStatus(batch entities.JobBatch) string {
+	processed := batch.Completed + batch.Failed + batch.Cancelled
+
+	switch {
+	case processed < batch.Total && batch.StartedAt != nil:
+		return string(WorkerJobStatusRunning)
+	case processed < batch.Total:
+		return string(WorkerJobStatusQueued)
+	case batch.Failed == 0:
+		return string(WorkerJobStatusSuccess)
+	case batch.Completed == 0:
+		return string(WorkerJobStatusFailed)
+	default:
+		return batchStatusPartial
+	}
+}
+
+// refreshBatch reloads the batch and recomputes its derived fields (status,
+// completion time, throughput and ETA) from the counters.
+func refreshBatch(tx *gorm.DB, batchUid string, batch *entities.JobBatch) error {
+	if err := tx.Where("uid = ?", batchUid).First(batch).Error; err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	batch.Status = batchStatus(*batch)
+	if batch.Completed+batch.Failed+batch.Cancelled < batch.Total {
+		batch.CompletedAt = nil
+	} else if batch.CompletedAt == nil {
+		batch.CompletedAt = &now
+	}
+
+	batch.Throughput, batch.EtaSeconds = batchRate(*batch, now)
+
+	return tx.Model(&entities.JobBatch{}).Where("uid = ?", batchUid).Updates(map[string]any{
+		"status":       batch.Status,
+		"completed_at": batch.CompletedAt,
+		"throughput":   batch.Throughput,
+		"eta_seconds":  batch.EtaSeconds,
+	}).Error
+}
+
+// batchRate returns finished jobs per second since the batch started and the
+// estimated seconds remaining at that rate.
+func batchRate(batch entities.JobBatch, now time.Time) (float64, *int) {
+	if batch.StartedAt == nil {
+		return 0, nil
+	}
+
+	end := now
+	if batch.CompletedAt != nil {
+		end = *batch.CompletedAt
+	}
+
+	processed := batch.Completed + batch.Failed + batch.Cancelled
+	elapsed := end.Sub(*batch.StartedAt).Seconds()
+	if elapsed <= 0 || processed == 0 {
+		return 0, nil
+	}
+
+	throughput := float64(processed) / elapsed
+	eta := 0
+	if batch.CompletedAt == nil {
+		eta = int(math.Ceil(float64(batch.Total-processed) / throughput))
+	}
+
+	return throughput, &eta
+}
+
+// trackBatchJob records a job status change against the in-memory batch
+// tracker and broadcasts the batch progress.
+func trackBatchJob(batch entities.JobBatch, jobUid string, status JobStatus) {
+	batchesMu.Lock()
+	t, ok := batches[batch.Uid]
+	if !ok {
+		t = &batchTracker{running: map[string]int{}}
+		batches[batch.Uid] = t
+	}
+	t.batch = batch
+
+	if jobUid != "" {
+		if status == WorkerJobStatusRunning {
+			t.running[jobUid] = 0
+			jobBatches[jobUid] = batch.Uid
+		} else {
+			delete(t.running, jobUid)
+			delete(jobBatches, jobUid)
+		}
+	}
+
+	finished := batch.CompletedAt != nil
+	if finished {
+		for id := range t.running {
+			delete(jobBatches, id)
+		}
+		delete(batches, batch.Uid)
+	}
+
+	payload := t.nextEvent(finished)
+	batchesMu.Unlock()
+
+	broadcastBatch(payload)
+}
+
+// reportBatchProgress folds a running job's progress into its batch.
+func reportBatchProgress(jobUid string, progress int) {
+	batchesMu.Lock()
+	t, ok := batches[jobBatches[jobUid]]
+	if !ok {
+		batchesMu.Unlock()
+		return
+	}
+
+	t.running[jobUid] = max(0, min(progress, 100))
+	payload := t.nextEvent(false)
+	batchesMu.Unlock()
+
+	broadcastBatch(payload)
+}
+
+// nextEvent builds the batch-progress payload, or returns nil if the last
+// event went out less than batchBroadcastInterval ago. Must be called with
+// batchesMu held.
+func (t *batchTracker) nextEvent(force bool) map[string]any {
+	now := time.Now()
+	if !force && now.Sub(t.lastBroadcast) < batchBroadcastInterval {
+		return nil
+	}
+	t.lastBroadcast = now
+
+	b := t.batch
+	processed := b.Completed + b.Failed + b.Cancelled
+
+	inFlight := 0
+	for _, p := range t.running {
+		inFlight += p
+	}
+
+	progress := 100
+	if b.Total > 0 {
+		progress = min((processed*100+inFlight)/b.Total, 100)
+	}
+
+	return map[string]any{
+		"uid":         b.Uid,
+		"type":        b.Type,
+		"topic":       b.Topic,
+		"status":      b.Status,
+		"total":       b.Total,
+		"completed":   b.Completed,
+		"failed":      b.Failed,
+		"cancelled":   b.Cancelled,
+		"running":     len(t.running),
+		"progress":    progress,
+		"throughput":  b.Throughput,
+		"eta_seconds": b.EtaSeconds,
+	}
+}
+
+func broadcastBatch(payload map[string]any) {
+	if Broker == nil || payload == nil {
+		return
+	}
+
+	Broker.Broadcast("batch-progress", payload)
+}
@@ -0,0 +1,108 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"viz/internal/entities"
+)
+
+func TestBatchRate(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	started := now.Add(-10 * time.Second)
+	completed := now.Add(-5 * time.Second)
+
+	tests := []struct {
+		name           string
+		batch          entities.JobBatch
+		wantThroughput float64
+		wantEta        *int
+	}{
+		{
+			name:  "not started",
+			batch: entities.JobBatch{Total: 10},
+		},
+		{
+			name:  "started but nothing finished",
+			batch: entities.JobBatch{Total: 10, StartedAt: &started},
+		},
+		{
+			name:           "in progress",
+			batch:          entities.JobBatch{Total: 100, Completed: 15, Failed: 5, StartedAt: &started},
+			wantThroughput: 2,
+			wantEta:        intPtr(40),
+		},
+		{
+			name:           "finished uses completion time",
+			batch:          entities.JobBatch{Total: 10, Completed: 8, Cancelled: 2, StartedAt: &started, CompletedAt: &completed},
+			wantThroughput: 2,
+			wantEta:        intPtr(0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			throughput, eta := batchRate(tt.batch, now)
+			if throughput != tt.wantThroughput {
+				t.Errorf("throughput = %v, want %v", throughput, tt.wantThroughput)
+			}
+
+			if (eta == nil) != (tt.wantEta == nil) || (eta != nil && *eta != *tt.wantEta) {
+				t.Errorf("eta = %v, want %v", fmtIntPtr(eta), fmtIntPtr(tt.wantEta))
+			}
+		})
+	}
+}
+
+func TestBatchTrackerProgress(t *testing.T) {
+	tracker := &batchTracker{
+		batch:   entities.JobBatch{Uid: "b1", Total: 4, Completed: 1, Failed: 1},
+		running: map[string]int{"j1": 50, "j2": 30},
+	}
+
+	payload := tracker.nextEvent(true)
+	if got := payload["progress"]; got != 70 {
+		t.Errorf("progress = %v, want 70", got)
+	}
+
+	if got := payload["running"]; got != 2 {
+		t.Errorf("running = %v, want 2", got)
+	}
+
+	if tracker.nextEvent(false) != nil {
+		t.Error("expected throttled event to be nil")
+	}
+}
+
+func TestBatchStatus(t *testing.T) {
+	started := time.Now()
+
+	tests := []struct {
+		name  string
+		batch entities.JobBatch
+		want  string
+	}{
+		{"queued", entities.JobBatch{Total: 3}, "queued"},
+		{"running", entities.JobBatch{Total: 3, Completed: 1, Failed: 1, StartedAt: &started}, "running"},
+		{"completed", entities.JobBatch{Total: 3, Completed: 2, Cancelled: 1, StartedAt: &started}, "completed"},
+		{"some failed", entities.JobBatch{Total: 3, Completed: 2, Failed: 1, StartedAt: &started}, "partial"},
+		{"all failed", entities.JobBatch{Total: 3, Failed: 2, Cancelled: 1, StartedAt: &started}, "failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := batchStatus(tt.batch); got != tt.want {
+				t.Errorf("batchStatus() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func intPtr(i int) *int { return &i }
+
+func fmtIntPtr(i *int) any {
+	if i == nil {
+		return nil
+	}
+	return *i
+}
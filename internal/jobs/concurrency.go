@@ -2,6 +2,7 @@ package jobs
 
 import (
 	"runtime"
+	"slices"
 	"sync"
 
 	"github.com/ThreeDotsLabs/watermill/message"
@@ -9,11 +10,19 @@ import (
 
 // ConcurrencyManager restricts the number of concurrent running jobs.
 // This implementation supports dynamic updates to the max concurrency at runtime.
+//
+// When jobs from several priority lanes are waiting, free slots are handed out
+// using stride scheduling: every grant advances the lane's pass by 1/weight and
+// the waiting lane with the lowest pass goes next, so lanes get slots in
+// proportion to their weights without any lane being starved.
 type ConcurrencyManager struct {
 	mu            sync.Mutex
 	cond          *sync.Cond
 	maxConcurrent int
 	current       int
+	waiting       map[Priority]int
+	pass          map[Priority]float64
+	vtime         float64
 }
 
 // NewConcurrencyManager creates a new manager with the default max concurrency.
@@ -22,28 +31,70 @@ func NewConcurrencyManager() *ConcurrencyManager {
 	if max < 1 {
 		max = 1
 	}
-	cm := &ConcurrencyManager{maxConcurrent: max}
+	cm := &ConcurrencyManager{
+		maxConcurrent: max,
+		waiting:       map[Priority]int{},
+		pass:          map[Priority]float64{},
+	}
 	cm.cond = sync.NewCond(&cm.mu)
 	return cm
 }
 
-// Acquire blocks until a slot is available.
+// Acquire blocks until a slot is available on the normal lane.
 func (l *ConcurrencyManager) Acquire() {
+	l.AcquirePriority(PriorityNormal)
+}
+
+// AcquirePriority blocks until a slot is available and it is this lane's turn.
+func (l *ConcurrencyManager) AcquirePriority(p Priority) {
+	if !slices.Contains(Priorities, p) {
+		p = PriorityNormal
+	}
+
 	l.mu.Lock()
-	for l.current >= l.maxConcurrent {
+	if l.waiting[p] == 0 {
+		// A lane that was idle must not bank credit for the time it had
+		// nothing to run, otherwise it would monopolise slots on return.
+		l.pass[p] = max(l.pass[p], l.vtime)
+	}
+	l.waiting[p]++
+
+	for l.current >= l.maxConcurrent || l.nextLane() != p {
 		l.cond.Wait()
 	}
+
+	l.waiting[p]--
 	l.current++
+	l.vtime = l.pass[p]
+	l.pass[p] += 1 / float64(priorityWeight(p))
+
+	// Other lanes may now be next in line for any remaining free slots.
+	l.cond.Broadcast()
 	l.mu.Unlock()
 }
 
+// nextLane returns the waiting lane with the lowest pass. Ties go to the
+// higher priority lane. Must be called with l.mu held.
+func (l *ConcurrencyManager) nextLane() Priority {
+	var next Priority
+	for _, p := range Priorities {
+		if l.waiting[p] == 0 {
+			continue
+		}
+		if next == "" || l.pass[p] < l.pass[next] {
+			next = p
+		}
+	}
+	return next
+}
+
 // Release frees up a slot.
 func (l *ConcurrencyManager) Release() {
 	l.mu.Lock()
 	if l.current > 0 {
 		l.current--
 	}
-	l.cond.Signal()
+	l.cond.Broadcast()
 	l.mu.Unlock()
 }
 
@@ -0,0 +1,92 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConcurrencyManagerWeightedLanes(t *testing.T) {
+	cm := NewConcurrencyManager()
+	cm.SetMaxConcurrent(1)
+
+	// Hold the only slot until every waiter is queued up.
+	cm.Acquire()
+
+	const perLane = 10
+	got := make(chan Priority)
+	for _, p := range []Priority{PriorityBulk, PriorityInteractive} {
+		for range perLane {
+			go func(p Priority) {
+				cm.AcquirePriority(p)
+				got <- p
+			}(p)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cm.mu.Lock()
+		ready := cm.waiting[PriorityBulk] == perLane && cm.waiting[PriorityInteractive] == perLane
+		cm.mu.Unlock()
+		if ready {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for goroutines to queue")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	counts := map[Priority]int{}
+	for range 8 {
+		cm.Release()
+		counts[<-got]++
+	}
+
+	// With the default 6:1 weighting interactive jobs should get most of the
+	// slots, but bulk must not be starved.
+	if counts[PriorityInteractive] < 6 {
+		t.Errorf("interactive got %d of 8 slots, want at least 6", counts[PriorityInteractive])
+	}
+	if counts[PriorityBulk] < 1 {
+		t.Errorf("bulk got %d of 8 slots, want at least 1", counts[PriorityBulk])
+	}
+
+	// Drain the rest so no goroutines are left blocked.
+	for range 2*perLane - 8 {
+		cm.Release()
+		<-got
+	}
+}
+
+func TestLaneTopic(t *testing.T) {
+	tests := []struct {
+		priority Priority
+		want     string
+	}{
+		{"", "image_process"},
+		{PriorityNormal, "image_process"},
+		{PriorityInteractive, "image_process.interactive"},
+		{PriorityBulk, "image_process.bulk"},
+	}
+
+	for _, tt := range tests {
+		if got := LaneTopic("image_process", tt.priority); got != tt.want {
+			t.Errorf("LaneTopic(%q) = %q, want %q", tt.priority, got, tt.want)
+		}
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	if p, err := ParsePriority("", PriorityBulk); err != nil || p != PriorityBulk {
+		t.Errorf("ParsePriority(\"\") = %q, %v; want fallback", p, err)
+	}
+
+	if p, err := ParsePriority("interactive", PriorityBulk); err != nil || p != PriorityInteractive {
+		t.Errorf("ParsePriority(interactive) = %q, %v", p, err)
+	}
+
+	if _, err := ParsePriority("urgent", PriorityBulk); err == nil {
+		t.Error("expected error for unknown priority")
+	}
+}
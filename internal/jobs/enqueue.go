@@ -25,9 +25,23 @@ const (
 )
 
 // Enqueue creates a persisted WorkerJob and publishes the message to the
-// router. It returns the created WorkerJob UID which is also set as the
-// Watermill message UUID.
-func Enqueue(db *gorm.DB, topic string, payload any, cmd *JobCommand, imageUid *string) (string, error) {
+// router on the lane for the given priority. It returns the created WorkerJob
+// UID which is also set as the Watermill message UUID.
+func Enqueue(db *gorm.DB, topic string, priority Priority, payload any, cmd *JobCommand, imageUid *string) (string, error) {
+	return enqueue(db, topic, priority, payload, cmd, imageUid, nil)
+}
+
+// EnqueueInBatch is like Enqueue but attaches the job to a JobBatch so its
+// outcome is rolled up into the batch progress.
+func EnqueueInBatch(db *gorm.DB, batchUid string, topic string, priority Priority, payload any, cmd *JobCommand, imageUid *string) (string, error) {
+	return enqueue(db, topic, priority, payload, cmd, imageUid, &batchUid)
+}
+
+func enqueue(db *gorm.DB, topic string, priority Priority, payload any, cmd *JobCommand, imageUid *string, batchUid *string) (string, error) {
+	if priority == "" {
+		priority = PriorityNormal
+	}
+
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
 		return "", fmt.Errorf("marshal payload: %w", err)
@@ -53,6 +67,8 @@ func Enqueue(db *gorm.DB, topic string, payload any, cmd *JobCommand, imageUid *
 		Topic:      topic,
 		Command:    cmdStr,
 		ImageUid:   imageUid,
+		BatchUid:   batchUid,
+		Priority:   utils.StringPtr(string(priority)),
 		Status:     string(WorkerJobStatusQueued),
 		Payload:    &payloadStr,
 		EnqueuedAt: time.Now().UTC(),
@@ -62,12 +78,7 @@ func Enqueue(db *gorm.DB, topic string, payload any, cmd *JobCommand, imageUid *
 		return "", fmt.Errorf("failed to persist worker job: %w", err)
 	}
 
-	msg := message.NewMessage(uid, payloadBytes)
-	msg.Metadata.Set("X-Worker-Job-Uid", uid)
-	if imageUid != nil {
-		msg.Metadata.Set("X-Image-Uid", *imageUid)
-	}
-
+	msg := newJobMessage(uid, payloadBytes, priority, wj.EnqueuedAt, imageUid)
 	if err := Publish(topic, msg); err != nil {
 		_ = UpdateWorkerJobStatus(db, uid, WorkerJobStatusFailed, utils.StringPtr("publish_failed"), utils.StringPtr("failed to publish message"), nil, nil)
 		return uid, fmt.Errorf("publish: %w", err)
@@ -76,6 +87,19 @@ func Enqueue(db *gorm.DB, topic string, payload any, cmd *JobCommand, imageUid *
 	return uid, nil
 }
 
+// newJobMessage builds the broker message for a persisted WorkerJob.
+func newJobMessage(uid string, payload []byte, priority Priority, enqueuedAt time.Time, imageUid *string) *message.Message {
+	msg := message.NewMessage(uid, payload)
+	msg.Metadata.Set("X-Worker-Job-Uid", uid)
+	msg.Metadata.Set("X-Job-Priority", string(priority))
+	msg.Metadata.Set("X-Enqueued-At", enqueuedAt.Format(time.RFC3339Nano))
+	if imageUid != nil {
+		msg.Metadata.Set("X-Image-Uid", *imageUid)
+	}
+
+	return msg
+}
+
 // UpdateWorkerJobStatus updates WorkerJob status and optional timestamps and error info.
 func UpdateWorkerJobStatus(db *gorm.DB, uid string, status JobStatus, errorCode *string, errorMsg *string, startedAt *time.Time, completedAt *time.Time) error {
 	updates := map[string]any{"status": status}
@@ -100,8 +124,39 @@ func UpdateWorkerJobStatus(db *gorm.DB, uid string, status JobStatus, errorCode
 		updates["completed_at"] = *completedAt
 	}
 
-	if err := db.Model(&entities.WorkerJob{}).Where("uid = ?", uid).Updates(updates).Error; err != nil {
+	// Starting a job counts as an attempt and takes out its first lease.
+	if status == WorkerJobStatusRunning {
+		updates["heartbeat_at"] = time.Now().UTC()
+		updates["attempts"] = gorm.Expr("attempts + 1")
+	}
+
+	var batch *entities.JobBatch
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var prev entities.WorkerJob
+		if err := tx.Select("status", "batch_uid").Where("uid = ?", uid).First(&prev).Error; err != nil && err != gorm.ErrRecordNotFound {
+			return err
+		}
+
+		if err := tx.Model(&entities.WorkerJob{}).Where("uid = ?", uid).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		if prev.BatchUid == nil {
+			return nil
+		}
+
+		var err error
+		batch, err = updateBatchCounters(tx, *prev.BatchUid, JobStatus(prev.Status), status)
+		return err
+	})
+
+	if err != nil {
 		return fmt.Errorf("failed to update worker job: %w", err)
 	}
+
+	if batch != nil {
+		trackBatchJob(*batch, uid, status)
+	}
+
 	return nil
 }
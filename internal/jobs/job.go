@@ -7,6 +7,7 @@ type Job struct {
 	ID       string
 	topic    string
 	status   JobStatus
+	priority Priority
 	ImageUid string
 }
 
@@ -22,6 +23,10 @@ func (j *Job) Topic() string {
 	return j.topic
 }
 
+func (j *Job) Priority() Priority {
+	return j.priority
+}
+
 func (j *Job) SetContext(ctx context.Context) {
 	j.ctx = ctx
 }
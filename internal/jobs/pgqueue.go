@@ -0,0 +1,250 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"gorm.io/gorm"
+
+	"viz/internal/entities"
+)
+
+// Queue backends selectable through QueueConfig.Backend.
+const (
+	QueueBackendMemory   = "memory"
+	QueueBackendRedis    = "redis"
+	QueueBackendPostgres = "postgres"
+)
+
+// PostgresPubSubConfig configures the Postgres-backed queue.
+type PostgresPubSubConfig struct {
+	// VisibilityTimeout is how long a delivered message stays hidden from other
+	// consumers. The lease is renewed while the message is being handled, so it
+	// only runs out when the consumer dies.
+	VisibilityTimeout time.Duration
+	// PollInterval is how long a subscriber waits before polling an empty topic
+	// again.
+	PollInterval time.Duration
+}
+
+// PostgresPubSub is a Watermill Publisher and Subscriber backed by the
+// queue_messages table. Consumers claim messages with FOR UPDATE SKIP LOCKED,
+// so any number of API or worker processes can share a topic without two of
+// them getting the same message. Delivery is at-least-once: a message is only
+// deleted once it is acked, and becomes visible again if its lease expires.
+type PostgresPubSub struct {
+	db     *gorm.DB
+	config PostgresPubSubConfig
+	logger watermill.LoggerAdapter
+
+	closing   chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+func NewPostgresPubSub(db *gorm.DB, cfg PostgresPubSubConfig, logger watermill.LoggerAdapter) *PostgresPubSub {
+	if cfg.VisibilityTimeout <= 0 {
+		cfg.VisibilityTimeout = 5 * time.Minute
+	}
+
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	return &PostgresPubSub{
+		db:      db,
+		config:  cfg,
+		logger:  logger,
+		closing: make(chan struct{}),
+	}
+}
+
+func (ps *PostgresPubSub) Publish(topic string, messages ...*message.Message) error {
+	if ps.isClosed() {
+		return errors.New("postgres pubsub is closed")
+	}
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	rows := make([]entities.QueueMessage, 0, len(messages))
+	for _, msg := range messages {
+		metadata, err := json.Marshal(msg.Metadata)
+		if err != nil {
+			return err
+		}
+
+		rows = append(rows, entities.QueueMessage{
+			Uuid:      msg.UUID,
+			Topic:     topic,
+			VisibleAt: now,
+			Payload:   msg.Payload,
+			Metadata:  string(metadata),
+		})
+	}
+
+	return ps.db.Create(&rows).Error
+}
+
+// Subscribe delivers messages from topic one at a time, like the other
+// backends: the next message is only claimed once the previous one has been
+// acked or nacked.
+func (ps *PostgresPubSub) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	if ps.isClosed() {
+		return nil, errors.New("postgres pubsub is closed")
+	}
+
+	out := make(chan *message.Message)
+	ps.wg.Add(1)
+	go func() {
+		defer ps.wg.Done()
+		defer close(out)
+		ps.consume(ctx, topic, out)
+	}()
+
+	return out, nil
+}
+
+func (ps *PostgresPubSub) Close() error {
+	ps.closeOnce.Do(func() {
+		close(ps.closing)
+	})
+	ps.wg.Wait()
+	return nil
+}
+
+func (ps *PostgresPubSub) isClosed() bool {
+	select {
+	case <-ps.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+func (ps *PostgresPubSub) consume(ctx context.Context, topic string, out chan<- *message.Message) {
+	fields := watermill.LogFields{"topic": topic}
+
+	for {
+		if ctx.Err() != nil || ps.isClosed() {
+			return
+		}
+
+		row, err := ps.claim(topic)
+		if err != nil {
+			ps.logger.Error("Failed to claim queue message", err, fields)
+		}
+
+		if row == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ps.closing:
+				return
+			case <-time.After(ps.config.PollInterval):
+			}
+			continue
+		}
+
+		ps.deliver(ctx, row, out)
+	}
+}
+
+// claim leases the oldest visible message on topic, or returns nil if there is
+// none. Rows locked by another consumer's claim are skipped rather than waited
+// on.
+func (ps *PostgresPubSub) claim(topic string) (*entities.QueueMessage, error) {
+	now := time.Now().UTC()
+
+	var rows []entities.QueueMessage
+	err := ps.db.Raw(`
+		UPDATE queue_messages
+		SET visible_at = ?, attempts = attempts + 1, updated_at = ?
+		WHERE id = (
+			SELECT id FROM queue_messages
+			WHERE topic = ? AND visible_at <= ?
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		now.Add(ps.config.VisibilityTimeout), now, topic, now,
+	).Scan(&rows).Error
+
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+
+	return &rows[0], nil
+}
+
+func (ps *PostgresPubSub) deliver(ctx context.Context, row *entities.QueueMessage, out chan<- *message.Message) {
+	msg := message.NewMessage(row.Uuid, row.Payload)
+	if row.Metadata != "" {
+		if err := json.Unmarshal([]byte(row.Metadata), &msg.Metadata); err != nil {
+			ps.logger.Error("Failed to decode queue message metadata", err, watermill.LogFields{"uuid": row.Uuid})
+		}
+	}
+
+	msgCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	msg.SetContext(msgCtx)
+
+	select {
+	case out <- msg:
+	case <-ctx.Done():
+		ps.release(row.ID, 0)
+		return
+	case <-ps.closing:
+		ps.release(row.ID, 0)
+		return
+	}
+
+	renew := time.NewTicker(ps.config.VisibilityTimeout / 2)
+	defer renew.Stop()
+
+	for {
+		select {
+		case <-msg.Acked():
+			if err := ps.db.Where("id = ?", row.ID).Delete(&entities.QueueMessage{}).Error; err != nil {
+				ps.logger.Error("Failed to delete acked queue message", err, watermill.LogFields{"uuid": row.Uuid})
+			}
+			return
+		case <-msg.Nacked():
+			// Back off for one poll interval so a handler that keeps failing
+			// doesn't spin on the same message.
+			ps.release(row.ID, ps.config.PollInterval)
+			return
+		case <-renew.C:
+			ps.release(row.ID, ps.config.VisibilityTimeout)
+		case <-ctx.Done():
+			// The handler may still be running; leave the lease to expire so
+			// the message is redelivered if it never gets acked.
+			return
+		case <-ps.closing:
+			return
+		}
+	}
+}
+
+// release sets when a leased message becomes visible to consumers again.
+func (ps *PostgresPubSub) release(id uint, after time.Duration) {
+	err := ps.db.Model(&entities.QueueMessage{}).
+		Where("id = ?", id).
+		Update("visible_at", time.Now().UTC().Add(after)).Error
+
+	if err != nil {
+		ps.logger.Error("Failed to update queue message lease", err, watermill.LogFields{"id": id})
+	}
+}
@@ -0,0 +1,112 @@
+package jobs
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Priority is the lane a job is queued on. Each lane is published to its own
+// topic so interactive work never sits behind a bulk backlog in the broker,
+// and free worker slots are shared between lanes by weight.
+type Priority string
+
+const (
+	PriorityInteractive Priority = "interactive"
+	PriorityNormal      Priority = "normal"
+	PriorityBulk        Priority = "bulk"
+)
+
+// Priorities lists every lane, highest priority first.
+var Priorities = []Priority{PriorityInteractive, PriorityNormal, PriorityBulk}
+
+// ParsePriority validates a priority string. An empty string yields fallback.
+func ParsePriority(s string, fallback Priority) (Priority, error) {
+	if s == "" {
+		return fallback, nil
+	}
+
+	for _, p := range Priorities {
+		if string(p) == s {
+			return p, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown priority: %s", s)
+}
+
+// LaneTopic returns the broker topic for a priority lane. The normal lane keeps
+// the plain topic name so messages published before lanes existed still drain.
+func LaneTopic(topic string, priority Priority) string {
+	if priority == "" || priority == PriorityNormal {
+		return topic
+	}
+	return topic + "." + string(priority)
+}
+
+var (
+	priorityWeightsMu sync.RWMutex
+	priorityWeights   = map[Priority]int{
+		PriorityInteractive: 6,
+		PriorityNormal:      3,
+		PriorityBulk:        1,
+	}
+)
+
+// SetPriorityWeights sets the relative share of worker slots each lane gets
+// while several lanes have jobs waiting. Weights below 1 are clamped to 1 so no
+// lane can be starved completely.
+func SetPriorityWeights(weights map[Priority]int) {
+	priorityWeightsMu.Lock()
+	defer priorityWeightsMu.Unlock()
+
+	for p, w := range weights {
+		priorityWeights[p] = max(w, 1)
+	}
+}
+
+func priorityWeight(p Priority) int {
+	priorityWeightsMu.RLock()
+	defer priorityWeightsMu.RUnlock()
+
+	if w, ok := priorityWeights[p]; ok {
+		return w
+	}
+	return 1
+}
+
+var (
+	waitStatsMu sync.Mutex
+	waitTotals  = map[Priority]time.Duration{}
+	waitCounts  = map[Priority]int64{}
+)
+
+// recordQueueWait records how long a job waited between being enqueued and
+// starting, which is the number that shows whether a lane is being starved.
+func recordQueueWait(p Priority, wait time.Duration) {
+	if wait < 0 {
+		return
+	}
+
+	waitStatsMu.Lock()
+	waitTotals[p] += wait
+	waitCounts[p]++
+	waitStatsMu.Unlock()
+}
+
+// averageQueueWaits returns the mean queue wait in milliseconds per lane since
+// the process started.
+func averageQueueWaits() map[Priority]int64 {
+	waitStatsMu.Lock()
+	defer waitStatsMu.Unlock()
+
+	out := make(map[Priority]int64, len(Priorities))
+	for _, p := range Priorities {
+		if n := waitCounts[p]; n > 0 {
+			out[p] = (waitTotals[p] / time.Duration(n)).Milliseconds()
+		} else {
+			out[p] = 0
+		}
+	}
+	return out
+}
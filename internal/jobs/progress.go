@@ -6,7 +6,8 @@ import (
 
 // NewProgressCallback creates a reusable progress reporter closure that broadcasts
 // generic job-progress WebSocket events with a consistent payload shape.
-// If wsBroker is nil, the returned function is a no-op.
+// Progress of jobs that belong to a batch is also rolled up into batch-progress
+// events. If wsBroker is nil, the returned function is a no-op.
 func NewProgressCallback(
 	wsBroker *libhttp.WSBroker,
 	jobId string,
@@ -31,5 +32,7 @@ func NewProgressCallback(
 			"status":    step,
 			"step":      step,
 		})
+
+		reportBatchProgress(jobId, progress)
 	}
 }
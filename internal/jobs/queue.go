@@ -16,15 +16,22 @@ import (
 	"github.com/ThreeDotsLabs/watermill/message/router/plugin"
 	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
 	goredis "github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
 
 	"viz/internal/config"
+	"viz/internal/entities"
 )
 
 var (
-	allJobs        = make(map[string]*Job)
-	allJobsMu      sync.RWMutex
-	queuedCounts   = make(map[string]int)
-	queuedCountsMu sync.RWMutex
+	allJobs          = make(map[string]*Job)
+	allJobsMu        sync.RWMutex
+	queuedCounts     = make(map[string]int)
+	queuedByPriority = make(map[Priority]int)
+	queuedCountsMu   sync.RWMutex
+
+	// publishOnly is set when standalone workers consume the jobs this
+	// process publishes; see SetPublishOnly.
+	publishOnly bool
 )
 
 var (
@@ -51,37 +58,77 @@ func GetAllJobs() map[string]*Job {
 	return copy
 }
 
-// Publish is a wrapper around Publisher.Publish which tracks queued counts per topic.
+// SetPublishOnly marks this process as one that only publishes jobs, for
+// QueueModeAPI. Standalone workers start and finish them, so the in-memory
+// counters here would never go down; CountJobs reads worker_jobs instead.
+func SetPublishOnly(v bool) {
+	publishOnly = v
+}
+
+// PublishOnly reports whether standalone workers consume this process's jobs.
+func PublishOnly() bool {
+	return publishOnly
+}
+
+// Publish is a wrapper around Publisher.Publish which tracks queued counts per
+// topic and priority. The message is published to the lane topic for the
+// priority in its X-Job-Priority metadata (normal if unset).
 func Publish(topic string, msg *message.Message) error {
 	if Publisher == nil {
 		return fmt.Errorf("publisher not initialized")
 	}
 
-	queuedCountsMu.Lock()
-	queuedCounts[topic] = queuedCounts[topic] + 1
-	queuedCountsMu.Unlock()
+	priority, err := ParsePriority(msg.Metadata.Get("X-Job-Priority"), PriorityNormal)
+	if err != nil {
+		return err
+	}
 
-	return Publisher.Publish(topic, msg)
+	if !publishOnly {
+		queuedCountsMu.Lock()
+		queuedCounts[topic] = queuedCounts[topic] + 1
+		queuedByPriority[priority] = queuedByPriority[priority] + 1
+		queuedCountsMu.Unlock()
+	}
+
+	return Publisher.Publish(LaneTopic(topic, priority), msg)
 }
 
-// JobCounts describes running and queued counts by topic.
+// JobCounts describes running and queued counts by topic and priority.
 type JobCounts struct {
-	Running        int64          `json:"running"`
-	RunningByTopic map[string]int `json:"running_by_topic"`
-	QueuedByTopic  map[string]int `json:"queued_by_topic"`
+	Running             int64              `json:"running"`
+	RunningByTopic      map[string]int     `json:"running_by_topic"`
+	QueuedByTopic       map[string]int     `json:"queued_by_topic"`
+	RunningByPriority   map[Priority]int   `json:"running_by_priority"`
+	QueuedByPriority    map[Priority]int   `json:"queued_by_priority"`
+	AvgWaitMsByPriority map[Priority]int64 `json:"avg_wait_ms_by_priority"`
 }
 
-// GetCounts returns a snapshot of running and queued counts.
-func GetCounts() JobCounts {
+func newJobCounts() JobCounts {
 	jc := JobCounts{
-		RunningByTopic: make(map[string]int),
-		QueuedByTopic:  make(map[string]int),
+		RunningByTopic:      make(map[string]int),
+		QueuedByTopic:       make(map[string]int),
+		RunningByPriority:   make(map[Priority]int, len(Priorities)),
+		QueuedByPriority:    make(map[Priority]int, len(Priorities)),
+		AvgWaitMsByPriority: averageQueueWaits(),
+	}
+
+	for _, p := range Priorities {
+		jc.RunningByPriority[p] = 0
+		jc.QueuedByPriority[p] = 0
 	}
 
+	return jc
+}
+
+// GetCounts returns a snapshot of running and queued counts.
+func GetCounts() JobCounts {
+	jc := newJobCounts()
+
 	// running
 	allJobsMu.RLock()
 	for _, j := range allJobs {
 		jc.RunningByTopic[j.Topic()]++
+		jc.RunningByPriority[j.Priority()]++
 	}
 	jc.Running = int64(len(allJobs))
 	allJobsMu.RUnlock()
@@ -91,104 +138,221 @@ func GetCounts() JobCounts {
 	for k, v := range queuedCounts {
 		jc.QueuedByTopic[k] = v
 	}
+	for k, v := range queuedByPriority {
+		jc.QueuedByPriority[k] = v
+	}
 	queuedCountsMu.RUnlock()
 
 	return jc
 }
 
+// CountJobs returns running and queued counts. A publish-only process never
+// sees its jobs start or finish, so its counts come from worker_jobs; other
+// processes use the in-memory snapshot from GetCounts.
+func CountJobs(db *gorm.DB) (JobCounts, error) {
+	if !publishOnly {
+		return GetCounts(), nil
+	}
+
+	var rows []struct {
+		Topic    string
+		Priority *string
+		Status   JobStatus
+		N        int
+	}
+
+	err := db.Model(&entities.WorkerJob{}).
+		Select("topic, priority, status, COUNT(*) AS n").
+		Where("status IN ?", []JobStatus{WorkerJobStatusQueued, WorkerJobStatusRunning}).
+		Group("topic, priority, status").
+		Scan(&rows).Error
+	if err != nil {
+		return JobCounts{}, fmt.Errorf("failed to count worker jobs: %w", err)
+	}
+
+	jc := newJobCounts()
+	for _, row := range rows {
+		priority := PriorityNormal
+		if row.Priority != nil {
+			if p, err := ParsePriority(*row.Priority, PriorityNormal); err == nil {
+				priority = p
+			}
+		}
+
+		if row.Status == WorkerJobStatusRunning {
+			jc.Running += int64(row.N)
+			jc.RunningByTopic[row.Topic] += row.N
+			jc.RunningByPriority[priority] += row.N
+		} else {
+			jc.QueuedByTopic[row.Topic] += row.N
+			jc.QueuedByPriority[priority] += row.N
+		}
+	}
+
+	return jc, nil
+}
+
 // RegisterWorkers registers all JobWorkers with the router.
 // Call this after initializing Router and PubSub, but before Router.Run().
-func RegisterWorkers(workers ...*Worker) {
-
+//
+// Each worker gets one consumer handler per priority lane. The lanes share the
+// worker's concurrency manager, which hands out slots by lane weight, and the
+// bulk lane is additionally rate limited by bulkThrottle when it is non-nil.
+func RegisterWorkers(bulkThrottle message.HandlerMiddleware, workers ...*Worker) {
 	for _, worker := range workers {
-		handler := worker.Handler
-		topic := worker.Topic
-		cm := getOrCreateManager(topic)
-
-		Router.AddConsumerHandler(
-			worker.Name,
-			topic,
-			Subscriber,
-			func(msg *message.Message) error {
-
-				cm.Acquire()
-				defer cm.Release()
-
-				worker.Start()
-				job := &Job{
-					ctx:      msg.Context(),
-					ID:       msg.UUID,
-					topic:    topic,
-					status:   JobStatusRunning,
-					ImageUid: msg.Metadata.Get("X-Image-Uid"),
-				}
-
-				if job.ID == "" {
-					job.ID = watermill.NewUUID()
-				}
-
-				// Transition from queued -> running: decrement queued count for topic.
-				queuedCountsMu.Lock()
-				if v, ok := queuedCounts[topic]; ok && v > 0 {
-					queuedCounts[topic] = v - 1
-				}
-				queuedCountsMu.Unlock()
-
-				// Register running job in a thread-safe way.
+		for _, priority := range Priorities {
+			h := registerWorkerLane(worker, priority)
+			if priority == PriorityBulk && bulkThrottle != nil {
+				h.AddMiddleware(bulkThrottle)
+			}
+		}
+	}
+}
+
+func registerWorkerLane(worker *Worker, priority Priority) *message.Handler {
+	handler := worker.Handler
+	topic := worker.Topic
+	cm := getOrCreateManager(topic)
+
+	return Router.AddConsumerHandler(
+		fmt.Sprintf("%s_%s", worker.Name, priority),
+		LaneTopic(topic, priority),
+		Subscriber,
+		func(msg *message.Message) error {
+			if wasReaped(msg.UUID) {
+				Logger.Info("Skipping redelivered job that was already reaped", watermill.LogFields{"uid": msg.UUID})
+				return nil
+			}
+
+			if wasCancelled(msg.UUID) {
+				Logger.Info("Skipping job that was cancelled while queued", watermill.LogFields{"uid": msg.UUID})
+				dequeue(topic, priority)
+				return nil
+			}
+
+			cm.AcquirePriority(priority)
+			defer cm.Release()
+
+			worker.Start()
+			job := &Job{
+				ctx:      msg.Context(),
+				ID:       msg.UUID,
+				topic:    topic,
+				status:   JobStatusRunning,
+				priority: priority,
+				ImageUid: msg.Metadata.Get("X-Image-Uid"),
+			}
+
+			if job.ID == "" {
+				job.ID = watermill.NewUUID()
+			}
+
+			if enqueuedAt, err := time.Parse(time.RFC3339Nano, msg.Metadata.Get("X-Enqueued-At")); err == nil {
+				recordQueueWait(priority, time.Since(enqueuedAt))
+			}
+
+			// Transition from queued -> running: decrement queued counts for topic and lane.
+			dequeue(topic, priority)
+
+			// Register running job in a thread-safe way.
+			allJobsMu.Lock()
+			allJobs[job.ID] = job
+			allJobsMu.Unlock()
+
+			stopHeartbeat := startHeartbeat(job.ID)
+			defer stopHeartbeat()
+
+			defer func() {
+				worker.Stop()
+				job.SetStatus(JobStatusSuccess)
 				allJobsMu.Lock()
-				allJobs[job.ID] = job
+				delete(allJobs, job.ID)
 				allJobsMu.Unlock()
+			}()
 
-				defer func() {
-					worker.Stop()
-					job.SetStatus(JobStatusSuccess)
-					allJobsMu.Lock()
-					delete(allJobs, job.ID)
-					allJobsMu.Unlock()
-				}()
+			return handler(msg)
+		},
+	)
+}
 
-				return handler(msg)
-			},
-		)
+// dequeue decrements the queued counts for topic and lane.
+func dequeue(topic string, priority Priority) {
+	queuedCountsMu.Lock()
+	defer queuedCountsMu.Unlock()
+
+	if v, ok := queuedCounts[topic]; ok && v > 0 {
+		queuedCounts[topic] = v - 1
+	}
+	if v, ok := queuedByPriority[priority]; ok && v > 0 {
+		queuedByPriority[priority] = v - 1
 	}
 }
 
-func RunJobQueue(cfg config.QueueConfig, logger *slog.Logger, workers ...*Worker) {
-	var err error
-	Logger = watermill.NewSlogLogger(logger)
+// Queue modes selectable through QueueConfig.Mode.
+const (
+	QueueModeAll = "all"
+	QueueModeAPI = "api"
+)
+
+// ResolveBackend returns the configured queue backend. When none is set, Redis
+// is used if it is enabled and the in-memory channel otherwise.
+func ResolveBackend(cfg config.QueueConfig) string {
+	if cfg.Backend != "" {
+		return cfg.Backend
+	}
 
 	if cfg.Enabled {
-		address := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
-		Logger.Info("Using Redis Streams for jobs", watermill.LogFields{
-			"address": address,
-		})
+		return QueueBackendRedis
+	}
+	return QueueBackendMemory
+}
 
-		var tlsConfig *tls.Config
-		if cfg.UseTLS {
-			tlsConfig = &tls.Config{
-				InsecureSkipVerify: true,
-			}
+// NewRedisClient connects to the Redis server in cfg.
+func NewRedisClient(cfg config.QueueConfig) *goredis.Client {
+	var tlsConfig *tls.Config
+	if cfg.UseTLS {
+		tlsConfig = &tls.Config{
+			InsecureSkipVerify: true,
 		}
+	}
+
+	return goredis.NewClient(&goredis.Options{
+		Addr:         fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		Username:     cfg.Username,
+		Password:     cfg.Password,
+		DB:           cfg.DB,
+		PoolSize:     cfg.PoolSize,
+		DialTimeout:  time.Duration(cfg.DialTimeoutSeconds) * time.Second,
+		ReadTimeout:  time.Duration(cfg.ReadTimeoutSeconds) * time.Second,
+		WriteTimeout: time.Duration(cfg.WriteTimeoutSeconds) * time.Second,
+		TLSConfig:    tlsConfig,
+	})
+}
+
+// OpenQueue connects Publisher and Subscriber to the configured backend and
+// returns the backend name. It is all an API server that only publishes jobs
+// needs; RunJobQueue calls it before starting the workers.
+func OpenQueue(cfg config.QueueConfig, db *gorm.DB, logger *slog.Logger) string {
+	var err error
+	Logger = watermill.NewSlogLogger(logger)
+
+	backend := ResolveBackend(cfg)
 
-		redisClient := goredis.NewClient(&goredis.Options{
-			Addr:         address,
-			Username:     cfg.Username,
-			Password:     cfg.Password,
-			DB:           cfg.DB,
-			PoolSize:     cfg.PoolSize,
-			DialTimeout:  time.Duration(cfg.DialTimeoutSeconds) * time.Second,
-			ReadTimeout:  time.Duration(cfg.ReadTimeoutSeconds) * time.Second,
-			WriteTimeout: time.Duration(cfg.WriteTimeoutSeconds) * time.Second,
-			TLSConfig:    tlsConfig,
+	switch backend {
+	case QueueBackendRedis:
+		Logger.Info("Using Redis Streams for jobs", watermill.LogFields{
+			"address": fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
 		})
 
+		redisClient := NewRedisClient(cfg)
+
 		Publisher, err = redisstream.NewPublisher(
 			redisstream.PublisherConfig{
 				Client: redisClient,
 			},
 			Logger,
 		)
-		
+
 		if err != nil {
 			panic(err)
 		}
@@ -204,7 +368,19 @@ func RunJobQueue(cfg config.QueueConfig, logger *slog.Logger, workers ...*Worker
 		if err != nil {
 			panic(err)
 		}
-	} else {
+	case QueueBackendPostgres:
+		visibility := time.Duration(cfg.VisibilityTimeoutSeconds) * time.Second
+		Logger.Info("Using Postgres for jobs", watermill.LogFields{
+			"visibility_timeout": visibility.String(),
+		})
+
+		pubSub := NewPostgresPubSub(db, PostgresPubSubConfig{
+			VisibilityTimeout: visibility,
+			PollInterval:      time.Duration(cfg.PollIntervalMillis) * time.Millisecond,
+		}, Logger)
+		Publisher = pubSub
+		Subscriber = pubSub
+	default:
 		Logger.Info("Using in-memory GoChannel for jobs", nil)
 		// Fallback to gochannel
 		gc := gochannel.NewGoChannel(gochannel.Config{}, Logger)
@@ -212,6 +388,13 @@ func RunJobQueue(cfg config.QueueConfig, logger *slog.Logger, workers ...*Worker
 		Subscriber = gc
 	}
 
+	return backend
+}
+
+func RunJobQueue(cfg config.QueueConfig, db *gorm.DB, logger *slog.Logger, workers ...*Worker) {
+	backend := OpenQueue(cfg, db, logger)
+
+	var err error
 	Router, err = message.NewRouter(message.RouterConfig{}, Logger)
 	if err != nil {
 		panic(err)
@@ -225,7 +408,7 @@ func RunJobQueue(cfg config.QueueConfig, logger *slog.Logger, workers ...*Worker
 	if err != nil {
 		panic(err)
 	}
-	
+
 	// Router level middleware are executed for every message sent to the router
 	Router.AddMiddleware(
 		// CorrelationID will copy the correlation id from the incoming message's metadata to the produced messages
@@ -248,15 +431,53 @@ func RunJobQueue(cfg config.QueueConfig, logger *slog.Logger, workers ...*Worker
 		}.Middleware,
 
 		poisonQueue,
-
-		middleware.NewThrottle(10, time.Second).Middleware,
 	)
 
-	RegisterWorkers(workers...)
+	// Throttling used to be applied router-wide, which meant a bulk backlog
+	// also slowed down interactive jobs. It now only applies to the bulk lane.
+	SetPriorityWeights(map[Priority]int{
+		PriorityInteractive: cfg.InteractiveWeight,
+		PriorityNormal:      cfg.NormalWeight,
+		PriorityBulk:        cfg.BulkWeight,
+	})
+
+	var bulkThrottle message.HandlerMiddleware
+	if cfg.BulkRatePerSecond > 0 {
+		bulkThrottle = middleware.NewThrottle(int64(cfg.BulkRatePerSecond), time.Second).Middleware
+	}
+
+	RegisterWorkers(bulkThrottle, workers...)
+
+	queueDB = db
+	consumedTopics = consumedTopics[:0]
+	for _, w := range workers {
+		consumedTopics = append(consumedTopics, w.Topic)
+	}
+	leaseConfig = LeaseConfig{
+		HeartbeatInterval: time.Duration(max(cfg.HeartbeatIntervalSeconds, 1)) * time.Second,
+		Timeout:           time.Duration(max(cfg.LeaseTimeoutSeconds, 1)) * time.Second,
+		MaxAttempts:       max(cfg.MaxAttempts, 1),
+		BrokerRedelivers:  backend != QueueBackendMemory,
+	}
+
+	ctx := context.Background()
+
+	// Reconcile after the router is running so jobs republished to the
+	// in-memory broker have subscribers to go to.
+	go func() {
+		<-Router.Running()
+
+		if n, err := ReconcileOrphanedJobs(db); err != nil {
+			Logger.Error("Failed to reconcile orphaned jobs", err, nil)
+		} else if n > 0 {
+			Logger.Info("Reconciled jobs orphaned by a previous run", watermill.LogFields{"count": n})
+		}
+
+		RunReaper(ctx, db)
+	}()
 
 	// Now that all handlers are registered, we're running the Router.
 	// Run is blocking while the router is running.
-	ctx := context.Background()
 	if err := Router.Run(ctx); err != nil {
 		panic(err)
 	}
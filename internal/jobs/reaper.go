@@ -0,0 +1,297 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"gorm.io/gorm"
+
+	"viz/internal/entities"
+	"viz/internal/utils"
+)
+
+// ErrorCodeLeaseExpired is recorded on jobs the reaper marks failed.
+const ErrorCodeLeaseExpired = "lease_expired"
+
+// Actions recorded in JobAuditEntry.
+const (
+	AuditActionRequeued = "requeued"
+	AuditActionFailed   = "failed"
+)
+
+// LeaseConfig controls job heartbeats and when the reaper treats a running
+// job as abandoned.
+type LeaseConfig struct {
+	HeartbeatInterval time.Duration
+	Timeout           time.Duration
+	MaxAttempts       int
+	// BrokerRedelivers is true when the broker hands an unacked message to
+	// another consumer by itself (Redis Streams, Postgres). Requeueing a job
+	// then only resets its status; the in-memory broker loses the message, so
+	// it has to be republished.
+	BrokerRedelivers bool
+}
+
+var (
+	queueDB *gorm.DB
+	// consumedTopics are the topics this process runs workers for. Each
+	// process only reaps its own topics, so a standalone worker never fails a
+	// job just because it doesn't have the worker for it.
+	consumedTopics []string
+	leaseConfig    = LeaseConfig{
+		HeartbeatInterval: 15 * time.Second,
+		Timeout:           90 * time.Second,
+		MaxAttempts:       3,
+	}
+)
+
+var errNotReaped = errors.New("job is no longer running")
+
+// startHeartbeat periodically refreshes heartbeat_at for a running job until
+// the returned stop function is called.
+func startHeartbeat(uid string) (stop func()) {
+	db := queueDB
+	if db == nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(leaseConfig.HeartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				err := db.Model(&entities.WorkerJob{}).
+					Where("uid = ? AND status = ?", uid, WorkerJobStatusRunning).
+					Update("heartbeat_at", time.Now().UTC()).Error
+
+				if err != nil {
+					Logger.Error("Failed to record job heartbeat", err, watermill.LogFields{"uid": uid})
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// wasReaped reports whether the reaper already marked this job failed. Redis
+// Streams and Postgres can still redeliver its message afterwards, and a job
+// that isn't safe to run twice must not be started again.
+func wasReaped(uid string) bool {
+	if queueDB == nil {
+		return false
+	}
+
+	var n int64
+	err := queueDB.Model(&entities.WorkerJob{}).
+		Where("uid = ? AND status = ? AND error_code = ?", uid, WorkerJobStatusFailed, ErrorCodeLeaseExpired).
+		Count(&n).Error
+
+	return err == nil && n > 0
+}
+
+// wasCancelled reports whether the job was cancelled before a worker picked it
+// up. The API server can't take a message back off a shared broker, so it only
+// marks the row; the worker has to drop the message when it arrives.
+func wasCancelled(uid string) bool {
+	if queueDB == nil {
+		return false
+	}
+
+	var n int64
+	err := queueDB.Model(&entities.WorkerJob{}).
+		Where("uid = ? AND status = ?", uid, WorkerJobStatusCancelled).
+		Count(&n).Error
+
+	return err == nil && n > 0
+}
+
+// ReconcileOrphanedJobs reaps jobs left running by a previous process. With
+// the in-memory broker this process is the only consumer and the messages died
+// with the old process, so every running job is orphaned. With a shared broker
+// other processes may still be working, so only expired leases are reaped.
+func ReconcileOrphanedJobs(db *gorm.DB) (int, error) {
+	cutoff := time.Now().UTC()
+	if leaseConfig.BrokerRedelivers {
+		cutoff = cutoff.Add(-leaseConfig.Timeout)
+	}
+
+	return ReapExpiredJobs(db, cutoff)
+}
+
+// RunReaper reaps expired leases every half lease timeout until ctx is done.
+func RunReaper(ctx context.Context, db *gorm.DB) {
+	ticker := time.NewTicker(max(leaseConfig.Timeout/2, time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := ReapExpiredJobs(db, time.Now().UTC().Add(-leaseConfig.Timeout)); err != nil {
+				Logger.Error("Failed to reap expired jobs", err, nil)
+			}
+		}
+	}
+}
+
+// ReapExpiredJobs requeues or fails running jobs whose last heartbeat is older
+// than cutoff and returns how many were reaped.
+func ReapExpiredJobs(db *gorm.DB, cutoff time.Time) (int, error) {
+	if len(consumedTopics) == 0 {
+		return 0, nil
+	}
+
+	var expired []entities.WorkerJob
+	err := db.Where("status = ? AND topic IN ? AND COALESCE(heartbeat_at, started_at, enqueued_at) < ?", WorkerJobStatusRunning, consumedTopics, cutoff).
+		Find(&expired).Error
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to find expired jobs: %w", err)
+	}
+
+	running := GetAllJobs()
+	reaped := 0
+	for _, wj := range expired {
+		// Still running in this process; its heartbeat writes are failing,
+		// which isn't a reason to run it twice.
+		if _, ok := running[wj.Uid]; ok {
+			continue
+		}
+
+		ok, err := reapJob(db, wj, leaseConfig)
+		if err != nil {
+			Logger.Error("Failed to reap job", err, watermill.LogFields{"uid": wj.Uid})
+			continue
+		}
+
+		if ok {
+			reaped++
+		}
+	}
+
+	return reaped, nil
+}
+
+// reapDecision picks what to do with an abandoned job and why.
+func reapDecision(wj entities.WorkerJob, worker *Worker, cfg LeaseConfig) (action string, reason string) {
+	switch {
+	case worker == nil:
+		return AuditActionFailed, fmt.Sprintf("lease expired and no worker is registered for %s", wj.Topic)
+	case !worker.Idempotent():
+		return AuditActionFailed, "lease expired and the job is not safe to run twice"
+	case wj.Attempts >= cfg.MaxAttempts:
+		return AuditActionFailed, fmt.Sprintf("lease expired after %d attempts", wj.Attempts)
+	case !cfg.BrokerRedelivers && (wj.Payload == nil || !json.Valid([]byte(*wj.Payload))):
+		// enqueue truncates large payloads, which can't be republished.
+		return AuditActionFailed, "lease expired and the stored payload is incomplete"
+	}
+
+	return AuditActionRequeued, "lease expired"
+}
+
+// reapJob applies the reap decision to one job and writes its audit entry. It
+// returns false if the job stopped running in the meantime, e.g. because
+// another process reaped it first.
+func reapJob(db *gorm.DB, wj entities.WorkerJob, cfg LeaseConfig) (bool, error) {
+	action, reason := reapDecision(wj, FindWorkerByTopic(wj.Topic), cfg)
+
+	next := WorkerJobStatusQueued
+	updates := map[string]any{
+		"heartbeat_at": nil,
+	}
+
+	if action == AuditActionFailed {
+		next = WorkerJobStatusFailed
+		updates["error_code"] = ErrorCodeLeaseExpired
+		updates["error_msg"] = reason
+		updates["completed_at"] = time.Now().UTC()
+	} else {
+		updates["started_at"] = nil
+	}
+	updates["status"] = next
+
+	var batch *entities.JobBatch
+	err := db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&entities.WorkerJob{}).
+			Where("uid = ? AND status = ?", wj.Uid, WorkerJobStatusRunning).
+			Updates(updates)
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if res.RowsAffected == 0 {
+			return errNotReaped
+		}
+
+		entry := entities.JobAuditEntry{
+			Uid:            watermill.NewUUID(),
+			JobUid:         wj.Uid,
+			Action:         action,
+			Reason:         reason,
+			PreviousStatus: wj.Status,
+			Attempts:       wj.Attempts,
+		}
+
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+
+		if wj.BatchUid == nil {
+			return nil
+		}
+
+		var err error
+		batch, err = updateBatchCounters(tx, *wj.BatchUid, WorkerJobStatusRunning, next)
+		return err
+	})
+
+	if errors.Is(err, errNotReaped) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("failed to reap job: %w", err)
+	}
+
+	if batch != nil {
+		trackBatchJob(*batch, wj.Uid, next)
+	}
+
+	Logger.Info("Reaped abandoned job", watermill.LogFields{
+		"uid":      wj.Uid,
+		"topic":    wj.Topic,
+		"action":   action,
+		"attempts": wj.Attempts,
+	})
+
+	if action != AuditActionRequeued || cfg.BrokerRedelivers {
+		return true, nil
+	}
+
+	priority := PriorityNormal
+	if wj.Priority != nil {
+		if p, err := ParsePriority(*wj.Priority, PriorityNormal); err == nil {
+			priority = p
+		}
+	}
+
+	msg := newJobMessage(wj.Uid, []byte(*wj.Payload), priority, time.Now().UTC(), wj.ImageUid)
+	if err := Publish(wj.Topic, msg); err != nil {
+		_ = UpdateWorkerJobStatus(db, wj.Uid, WorkerJobStatusFailed, utils.StringPtr("publish_failed"), utils.StringPtr("failed to republish reaped job"), nil, nil)
+		return true, fmt.Errorf("failed to republish reaped job: %w", err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,250 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"viz/internal/entities"
+	"viz/internal/utils"
+)
+
+// Topics the reaper tests register workers for.
+const (
+	testIdempotentTopic = "reaper_test_idempotent"
+	testUnsafeTopic     = "reaper_test_unsafe"
+)
+
+// newReaperTestDB opens a private in-memory database and sets up the queue
+// globals as RunJobQueue would for a process consuming the test topics.
+func newReaperTestDB(t *testing.T, cfg LeaseConfig) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file:"+watermill.NewShortUUID()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+
+	if err := db.AutoMigrate(&entities.WorkerJob{}, &entities.JobAuditEntry{}, &entities.JobBatch{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	prevLogger, prevTopics, prevLease := Logger, consumedTopics, leaseConfig
+	t.Cleanup(func() {
+		Logger, consumedTopics, leaseConfig = prevLogger, prevTopics, prevLease
+
+		workersMu.Lock()
+		delete(workers, testIdempotentTopic)
+		delete(workers, testUnsafeTopic)
+		workersMu.Unlock()
+	})
+
+	Logger = watermill.NopLogger{}
+	consumedTopics = []string{testIdempotentTopic, testUnsafeTopic}
+	leaseConfig = cfg
+
+	RegisterWorker((&Worker{Name: testIdempotentTopic, Topic: testIdempotentTopic}).SetIdempotent(true))
+	RegisterWorker(&Worker{Name: testUnsafeTopic, Topic: testUnsafeTopic})
+
+	return db
+}
+
+// seedRunningJob inserts a running job whose last heartbeat was at heartbeat.
+func seedRunningJob(t *testing.T, db *gorm.DB, uid string, topic string, heartbeat time.Time) {
+	t.Helper()
+
+	started := heartbeat.Add(-time.Minute)
+	wj := entities.WorkerJob{
+		Uid:         uid,
+		Topic:       topic,
+		Status:      string(WorkerJobStatusRunning),
+		Attempts:    1,
+		Payload:     utils.StringPtr(`{"image":{"uid":"abc"}}`),
+		EnqueuedAt:  started,
+		StartedAt:   &started,
+		HeartbeatAt: &heartbeat,
+	}
+
+	if err := db.Create(&wj).Error; err != nil {
+		t.Fatalf("failed to seed job %s: %v", uid, err)
+	}
+}
+
+func loadJob(t *testing.T, db *gorm.DB, uid string) entities.WorkerJob {
+	t.Helper()
+
+	var wj entities.WorkerJob
+	if err := db.Where("uid = ?", uid).First(&wj).Error; err != nil {
+		t.Fatalf("failed to load job %s: %v", uid, err)
+	}
+	return wj
+}
+
+func loadAudit(t *testing.T, db *gorm.DB, uid string) []entities.JobAuditEntry {
+	t.Helper()
+
+	var entries []entities.JobAuditEntry
+	if err := db.Where("job_uid = ?", uid).Find(&entries).Error; err != nil {
+		t.Fatalf("failed to load audit entries for %s: %v", uid, err)
+	}
+	return entries
+}
+
+func TestReapDecision(t *testing.T) {
+	idempotent := (&Worker{Topic: "image_process"}).SetIdempotent(true)
+	unsafe := &Worker{Topic: "image_process"}
+
+	cfg := LeaseConfig{MaxAttempts: 3}
+	redelivers := LeaseConfig{MaxAttempts: 3, BrokerRedelivers: true}
+
+	valid := utils.StringPtr(`{"image":{"uid":"abc"}}`)
+	truncated := utils.StringPtr(`{"image":{"uid":"ab`)
+
+	tests := []struct {
+		name   string
+		job    entities.WorkerJob
+		worker *Worker
+		cfg    LeaseConfig
+		want   string
+	}{
+		{"idempotent job is requeued", entities.WorkerJob{Attempts: 1, Payload: valid}, idempotent, cfg, AuditActionRequeued},
+		{"unknown worker fails", entities.WorkerJob{Attempts: 1, Payload: valid}, nil, cfg, AuditActionFailed},
+		{"non-idempotent job fails", entities.WorkerJob{Attempts: 1, Payload: valid}, unsafe, cfg, AuditActionFailed},
+		{"attempts exhausted fails", entities.WorkerJob{Attempts: 3, Payload: valid}, idempotent, cfg, AuditActionFailed},
+		{"truncated payload can't be republished", entities.WorkerJob{Attempts: 1, Payload: truncated}, idempotent, cfg, AuditActionFailed},
+		{"truncated payload is fine if the broker redelivers", entities.WorkerJob{Attempts: 1, Payload: truncated}, idempotent, redelivers, AuditActionRequeued},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := reapDecision(tt.job, tt.worker, tt.cfg)
+			if got != tt.want {
+				t.Errorf("action = %q (%s), want %q", got, reason, tt.want)
+			}
+
+			if reason == "" {
+				t.Error("expected a reason")
+			}
+		})
+	}
+}
+
+func TestReapExpiredJobs(t *testing.T) {
+	// The broker redelivers, so requeued jobs aren't republished from here.
+	db := newReaperTestDB(t, LeaseConfig{Timeout: time.Minute, MaxAttempts: 3, BrokerRedelivers: true})
+
+	now := time.Now().UTC()
+	expired := now.Add(-5 * time.Minute)
+	seedRunningJob(t, db, "reap-idempotent", testIdempotentTopic, expired)
+	seedRunningJob(t, db, "reap-unsafe", testUnsafeTopic, expired)
+	seedRunningJob(t, db, "reap-live", testIdempotentTopic, now.Add(-10*time.Second))
+	seedRunningJob(t, db, "reap-other-topic", "reaper_test_not_consumed", expired)
+
+	n, err := ReapExpiredJobs(db, now.Add(-leaseConfig.Timeout))
+	if err != nil {
+		t.Fatalf("ReapExpiredJobs: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("reaped %d jobs, want 2", n)
+	}
+
+	requeued := loadJob(t, db, "reap-idempotent")
+	if requeued.Status != string(WorkerJobStatusQueued) {
+		t.Errorf("idempotent job status = %q, want %q", requeued.Status, WorkerJobStatusQueued)
+	}
+	if requeued.StartedAt != nil || requeued.HeartbeatAt != nil {
+		t.Error("requeued job should have its lease cleared")
+	}
+	if requeued.ErrorCode != nil {
+		t.Errorf("requeued job error_code = %q, want none", *requeued.ErrorCode)
+	}
+
+	failed := loadJob(t, db, "reap-unsafe")
+	if failed.Status != string(WorkerJobStatusFailed) {
+		t.Errorf("non-idempotent job status = %q, want %q", failed.Status, WorkerJobStatusFailed)
+	}
+	if failed.ErrorCode == nil || *failed.ErrorCode != ErrorCodeLeaseExpired {
+		t.Errorf("non-idempotent job error_code = %v, want %q", failed.ErrorCode, ErrorCodeLeaseExpired)
+	}
+	if failed.CompletedAt == nil {
+		t.Error("failed job should have completed_at set")
+	}
+
+	for _, uid := range []string{"reap-live", "reap-other-topic"} {
+		if wj := loadJob(t, db, uid); wj.Status != string(WorkerJobStatusRunning) {
+			t.Errorf("%s status = %q, want it left running", uid, wj.Status)
+		}
+		if entries := loadAudit(t, db, uid); len(entries) != 0 {
+			t.Errorf("%s has %d audit entries, want none", uid, len(entries))
+		}
+	}
+
+	for uid, action := range map[string]string{"reap-idempotent": AuditActionRequeued, "reap-unsafe": AuditActionFailed} {
+		entries := loadAudit(t, db, uid)
+		if len(entries) != 1 {
+			t.Fatalf("%s has %d audit entries, want 1", uid, len(entries))
+		}
+
+		entry := entries[0]
+		if entry.Action != action {
+			t.Errorf("%s audit action = %q, want %q", uid, entry.Action, action)
+		}
+		if entry.PreviousStatus != string(WorkerJobStatusRunning) || entry.Attempts != 1 || entry.Reason == "" {
+			t.Errorf("%s audit entry = %+v, want previous status running, 1 attempt and a reason", uid, entry)
+		}
+	}
+
+	// Reaped jobs are no longer running, so a second pass finds nothing.
+	if n, err := ReapExpiredJobs(db, now.Add(-leaseConfig.Timeout)); err != nil || n != 0 {
+		t.Errorf("second pass reaped %d jobs (err %v), want 0", n, err)
+	}
+}
+
+func TestReconcileOrphanedJobs(t *testing.T) {
+	tests := []struct {
+		name       string
+		redelivers bool
+		want       []string
+	}{
+		// Another process may still be working on the fresh job.
+		{"shared broker only reaps expired leases", true, []string{"reconcile-stale"}},
+		// The in-memory broker's messages died with the old process.
+		{"in-memory broker reaps every running job", false, []string{"reconcile-stale", "reconcile-fresh"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newReaperTestDB(t, LeaseConfig{Timeout: time.Minute, MaxAttempts: 3, BrokerRedelivers: tt.redelivers})
+
+			// Non-idempotent jobs are failed rather than republished.
+			now := time.Now().UTC()
+			seedRunningJob(t, db, "reconcile-stale", testUnsafeTopic, now.Add(-5*time.Minute))
+			seedRunningJob(t, db, "reconcile-fresh", testUnsafeTopic, now.Add(-10*time.Second))
+
+			n, err := ReconcileOrphanedJobs(db)
+			if err != nil {
+				t.Fatalf("ReconcileOrphanedJobs: %v", err)
+			}
+			if n != len(tt.want) {
+				t.Errorf("reconciled %d jobs, want %d", n, len(tt.want))
+			}
+
+			for _, uid := range []string{"reconcile-stale", "reconcile-fresh"} {
+				want := WorkerJobStatusRunning
+				for _, reaped := range tt.want {
+					if reaped == uid {
+						want = WorkerJobStatusFailed
+					}
+				}
+
+				if wj := loadJob(t, db, uid); wj.Status != string(want) {
+					t.Errorf("%s status = %q, want %q", uid, wj.Status, want)
+				}
+			}
+		})
+	}
+}
@@ -43,6 +43,18 @@ func FindWorker(id string) *Worker {
 	return nil
 }
 
+// FindWorkerByTopic returns the registered worker consuming topic, or nil.
+func FindWorkerByTopic(topic string) *Worker {
+	workersMu.RLock()
+	defer workersMu.RUnlock()
+	for _, w := range workers {
+		if w.Topic == topic {
+			return w
+		}
+	}
+	return nil
+}
+
 // SetPersisted sets a key/value pair for a worker id in the in-memory persisted map.
 func SetPersisted(workerID string, key string, value any) error {
 	if persisted == nil {
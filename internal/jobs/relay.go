@@ -0,0 +1,190 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/jackc/pgx/v5/stdlib"
+	goredis "github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+
+	"viz/internal/config"
+	libhttp "viz/internal/http"
+)
+
+// relayChannel is the Redis pub/sub channel or Postgres NOTIFY channel that
+// worker events travel on.
+const relayChannel = "viz_worker_events"
+
+// pgNotifyMaxBytes is the largest payload Postgres accepts for NOTIFY.
+const pgNotifyMaxBytes = 7999
+
+// EventRelay carries WebSocket events from standalone workers to the API
+// server, whose WSBroker the clients are connected to. Delivery is best
+// effort: events published while no API server is listening are dropped.
+type EventRelay interface {
+	Publish(eventType string, data any) error
+	Listen(ctx context.Context, handler func(eventType string, data json.RawMessage)) error
+}
+
+type relayEvent struct {
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// NewEventRelay returns the relay for the configured queue backend. The
+// in-memory backend can't be shared between processes, so it has none.
+func NewEventRelay(cfg config.QueueConfig, db *gorm.DB) (EventRelay, error) {
+	switch backend := ResolveBackend(cfg); backend {
+	case QueueBackendRedis:
+		return &redisEventRelay{client: NewRedisClient(cfg)}, nil
+	case QueueBackendPostgres:
+		return &postgresEventRelay{db: db}, nil
+	default:
+		return nil, fmt.Errorf("the %s queue backend can't be shared between processes, use redis or postgres", backend)
+	}
+}
+
+// RelayEvents rebroadcasts every relayed event on broker until ctx is done,
+// reconnecting if the listener drops.
+func RelayEvents(ctx context.Context, relay EventRelay, broker *libhttp.WSBroker) {
+	for {
+		err := relay.Listen(ctx, func(eventType string, data json.RawMessage) {
+			broker.Broadcast(eventType, data)
+		})
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		Logger.Error("Worker event relay disconnected, reconnecting", err, nil)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// ForwardEvents makes broker pass every broadcast on through relay.
+func ForwardEvents(broker *libhttp.WSBroker, relay EventRelay) {
+	broker.SetRelay(func(eventType string, data any) {
+		if err := relay.Publish(eventType, data); err != nil {
+			Logger.Error("Failed to relay worker event", err, watermill.LogFields{"event": eventType})
+		}
+	})
+}
+
+func encodeRelayEvent(eventType string, data any) ([]byte, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(relayEvent{Event: eventType, Data: raw})
+}
+
+func dispatchRelayEvent(payload []byte, handler func(eventType string, data json.RawMessage)) {
+	var ev relayEvent
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		Logger.Error("Failed to decode relayed worker event", err, nil)
+		return
+	}
+
+	handler(ev.Event, ev.Data)
+}
+
+type redisEventRelay struct {
+	client *goredis.Client
+}
+
+func (r *redisEventRelay) Publish(eventType string, data any) error {
+	payload, err := encodeRelayEvent(eventType, data)
+	if err != nil {
+		return err
+	}
+
+	return r.client.Publish(context.Background(), relayChannel, payload).Err()
+}
+
+func (r *redisEventRelay) Listen(ctx context.Context, handler func(eventType string, data json.RawMessage)) error {
+	sub := r.client.Subscribe(ctx, relayChannel)
+	defer sub.Close()
+
+	// Wait for the subscription to be confirmed so connection errors surface.
+	if _, err := sub.Receive(ctx); err != nil {
+		return err
+	}
+
+	messages := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-messages:
+			if !ok {
+				return errors.New("redis subscription closed")
+			}
+			dispatchRelayEvent([]byte(msg.Payload), handler)
+		}
+	}
+}
+
+// postgresEventRelay uses LISTEN/NOTIFY, so a Postgres-only deployment needs
+// no extra infrastructure for the relay.
+type postgresEventRelay struct {
+	db *gorm.DB
+}
+
+func (p *postgresEventRelay) Publish(eventType string, data any) error {
+	payload, err := encodeRelayEvent(eventType, data)
+	if err != nil {
+		return err
+	}
+
+	if len(payload) > pgNotifyMaxBytes {
+		return fmt.Errorf("event is %d bytes, over the NOTIFY limit", len(payload))
+	}
+
+	return p.db.Exec("SELECT pg_notify(?, ?)", relayChannel, string(payload)).Error
+}
+
+func (p *postgresEventRelay) Listen(ctx context.Context, handler func(eventType string, data json.RawMessage)) error {
+	sqlDB, err := p.db.DB()
+	if err != nil {
+		return err
+	}
+
+	// LISTEN is per connection, so hold one out of the pool for as long as
+	// we're listening.
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		stdConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return errors.New("postgres event relay requires the pgx driver")
+		}
+
+		pgConn := stdConn.Conn()
+		if _, err := pgConn.Exec(ctx, "LISTEN "+relayChannel); err != nil {
+			return err
+		}
+
+		for {
+			notification, err := pgConn.WaitForNotification(ctx)
+			if err != nil {
+				return err
+			}
+			dispatchRelayEvent([]byte(notification.Payload), handler)
+		}
+	})
+}
@@ -0,0 +1,30 @@
+package jobs
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRelayEventRoundTrip(t *testing.T) {
+	payload, err := encodeRelayEvent("job-progress", map[string]any{"uid": "j1", "progress": 40})
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	var gotEvent string
+	var gotData map[string]any
+	dispatchRelayEvent(payload, func(eventType string, data json.RawMessage) {
+		gotEvent = eventType
+		if err := json.Unmarshal(data, &gotData); err != nil {
+			t.Fatalf("decode data: %v", err)
+		}
+	})
+
+	if gotEvent != "job-progress" {
+		t.Errorf("event = %q, want job-progress", gotEvent)
+	}
+
+	if gotData["uid"] != "j1" || gotData["progress"] != float64(40) {
+		t.Errorf("data = %v", gotData)
+	}
+}
@@ -18,6 +18,7 @@ type Worker struct {
 	Count         func(db any, command string, payload any) (int64, error)
 	Enqueue       func(db any, command string, payload any) (int, error)
 	CustomHandler any
+	idempotent    bool
 	mutex         sync.Mutex
 	busy          bool
 	canceled      bool
@@ -35,6 +36,24 @@ func (w *Worker) Context() context.Context {
 	return context.Background()
 }
 
+// SetIdempotent marks whether running a job more than once is safe. Jobs of an
+// idempotent worker are requeued when the reaper finds them abandoned; other
+// jobs are marked failed instead.
+func (w *Worker) SetIdempotent(idempotent bool) *Worker {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.idempotent = idempotent
+	return w
+}
+
+func (w *Worker) Idempotent() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.idempotent
+}
+
 // Running checks if the Worker is currently running.
 func (w *Worker) Running() bool {
 	w.mutex.Lock()
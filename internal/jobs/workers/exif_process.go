@@ -35,7 +35,8 @@ type ExifProcessJob struct {
 	Image entities.ImageAsset
 }
 
-// NewExifWorker creates a worker that extracts EXIF and updates the DB
+// NewExifWorker creates a worker that extracts EXIF and updates the DB. Re-reading
+// the same file yields the same metadata, so it is idempotent.
 func NewExifWorker(db *gorm.DB, wsBroker *libhttp.WSBroker) *jobs.Worker {
 	return jobs.NewWorker(JobTypeExifProcess, TopicExifProcess, "EXIF Processing", 2, func(msg *message.Message) error {
 		var job ExifProcessJob
@@ -108,7 +109,7 @@ func NewExifWorker(db *gorm.DB, wsBroker *libhttp.WSBroker) *jobs.Worker {
 
 		return nil
 	},
-	)
+	).SetIdempotent(true)
 }
 
 // ExifProcess extracts EXIF and updates the DB (exif + taken_at + optional metadata)
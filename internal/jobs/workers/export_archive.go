@@ -0,0 +1,206 @@
+package workers
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"gorm.io/gorm"
+
+	"viz/internal/downloads"
+	"viz/internal/dto"
+	"viz/internal/entities"
+	libhttp "viz/internal/http"
+	"viz/internal/imageops"
+	"viz/internal/jobs"
+	"viz/internal/utils"
+)
+
+const (
+	JobTypeExportArchive = "export_archive"
+	TopicExportArchive   = JobTypeExportArchive
+)
+
+type ExportArchiveJob struct {
+	ExportUid string
+}
+
+// NewExportWorker creates a worker that builds export archives to storage.
+// The archive is rebuilt from scratch each time, so it is idempotent.
+func NewExportWorker(db *gorm.DB, wsBroker *libhttp.WSBroker) *jobs.Worker {
+	return jobs.NewWorker(JobTypeExportArchive, TopicExportArchive, "Archive Export", 1, func(msg *message.Message) error {
+		var job ExportArchiveJob
+		err := json.Unmarshal(msg.Payload, &job)
+		if err != nil {
+			return fmt.Errorf("%s: %w", JobTypeExportArchive, err)
+		}
+
+		var export entities.ExportArchive
+		if err := db.Where("uid = ?", job.ExportUid).First(&export).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				// Deleted before it was built
+				_ = jobs.UpdateWorkerJobStatus(db, msg.UUID, jobs.WorkerJobStatusCancelled, nil, nil, nil, nil)
+				return nil
+			}
+			return fmt.Errorf("%s: %w", JobTypeExportArchive, err)
+		}
+
+		if wsBroker != nil {
+			wsBroker.Broadcast("job-started", map[string]any{
+				"uid":        msg.UUID,
+				"jobId":      msg.UUID,
+				"type":       JobTypeExportArchive,
+				"topic":      JobTypeExportArchive,
+				"export_uid": export.Uid,
+				"filename":   export.FileName,
+			})
+		}
+
+		// mark running
+		startedAt := time.Now().UTC()
+		_ = jobs.UpdateWorkerJobStatus(db, msg.UUID, jobs.WorkerJobStatusRunning, nil, nil, &startedAt, nil)
+		_ = db.Model(&export).Updates(map[string]any{"status": dto.ExportArchiveStatusRunning, "progress": 0, "error": nil}).Error
+
+		onProgress := jobs.NewProgressCallback(
+			wsBroker,
+			msg.UUID,
+			JobTypeExportArchive,
+			"",
+			export.FileName,
+		)
+
+		err = buildExportArchive(msg.Context(), db, &export, onProgress)
+
+		if err != nil {
+			if wsBroker != nil {
+				wsBroker.Broadcast("job-failed", map[string]any{
+					"uid":        msg.UUID,
+					"jobId":      msg.UUID,
+					"type":       JobTypeExportArchive,
+					"topic":      JobTypeExportArchive,
+					"export_uid": export.Uid,
+					"error":      err.Error(),
+				})
+			}
+
+			// Failed exports are cleaned up like built ones
+			expiresAt := time.Now().Add(downloads.ExportRetention())
+			_ = db.Model(&export).Updates(map[string]any{
+				"status":     dto.ExportArchiveStatusFailed,
+				"error":      jobs.Truncate(err.Error(), 1024),
+				"expires_at": expiresAt,
+			}).Error
+			_ = jobs.UpdateWorkerJobStatus(db, msg.UUID, jobs.WorkerJobStatusFailed, utils.StringPtr("worker_error"), utils.StringPtr(jobs.Truncate(err.Error(), 1024)), nil, nil)
+			return err
+		}
+
+		if wsBroker != nil {
+			wsBroker.Broadcast("job-completed", map[string]any{
+				"uid":        msg.UUID,
+				"jobId":      msg.UUID,
+				"type":       JobTypeExportArchive,
+				"topic":      JobTypeExportArchive,
+				"export_uid": export.Uid,
+			})
+		}
+
+		completedAt := time.Now().UTC()
+		_ = jobs.UpdateWorkerJobStatus(db, msg.UUID, jobs.WorkerJobStatusSuccess, nil, nil, nil, &completedAt)
+
+		return nil
+	},
+	).SetIdempotent(true)
+}
+
+// buildExportArchive writes the export's archive next to where it will be
+// kept and moves it into place once it's complete, so a half written
+// archive is never served.
+func buildExportArchive(ctx context.Context, db *gorm.DB, export *entities.ExportArchive, onProgress func(step string, progress int)) error {
+	if err := os.MkdirAll(downloads.ExportDirectory(), 0o755); err != nil {
+		return fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	finalPath := downloads.ExportPath(export.Uid)
+	partPath := finalPath + ".part"
+
+	f, err := os.Create(partPath)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer os.Remove(partPath)
+	defer f.Close()
+
+	onProgress("Adding images", 0)
+
+	total := len(export.ImageUids)
+	lastProgress := 0
+	zw := zip.NewWriter(f)
+	opts := downloads.ArchiveOptions{Profile: export.Profile, Render: imageops.CachedTransform}
+	written, skipped, err := downloads.WriteArchive(ctx, db, zw, export.ImageUids, opts, func(done int) {
+		// Report whole percentages only, large exports have many images
+		progress := done * 100 / total
+		if progress == lastProgress {
+			return
+		}
+
+		lastProgress = progress
+		onProgress("Adding images", progress)
+		_ = db.Model(export).Update("progress", progress).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	if len(skipped) > 0 {
+		jobs.Logger.Info("export skipped images", watermill.LogFields{
+			"export_uid": export.Uid,
+			"skipped":    len(skipped),
+		})
+		if err := downloads.WriteManifest(zw, written, skipped); err != nil {
+			return fmt.Errorf("failed to write manifest: %w", err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to finish archive: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to finish archive: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to finish archive: %w", err)
+	}
+
+	if err := os.Rename(partPath, finalPath); err != nil {
+		return fmt.Errorf("failed to store archive: %w", err)
+	}
+
+	completedAt := time.Now().UTC()
+	expiresAt := completedAt.Add(downloads.ExportRetention())
+	size := info.Size()
+
+	export.Status = dto.ExportArchiveStatusCompleted
+	export.Progress = 100
+	export.Error = nil
+	export.FileCount = &written
+	export.Size = &size
+	export.Skipped = &skipped
+	export.CompletedAt = &completedAt
+	export.ExpiresAt = &expiresAt
+
+	if err := db.Omit("CreatedBy").Save(export).Error; err != nil {
+		return fmt.Errorf("failed to save export: %w", err)
+	}
+
+	onProgress("Complete", 100)
+	return nil
+}
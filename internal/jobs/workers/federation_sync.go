@@ -0,0 +1,380 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+
+	"viz/internal/dto"
+	"viz/internal/entities"
+	"viz/internal/federation"
+	libhttp "viz/internal/http"
+	"viz/internal/imageops"
+	libvips "viz/internal/imageops/vips"
+	"viz/internal/images"
+	"viz/internal/jobs"
+	"viz/internal/utils"
+)
+
+const (
+	JobTypeFederationSync = "federation_sync"
+	TopicFederationSync   = JobTypeFederationSync
+)
+
+const (
+	// maxMirroredFileSize is the largest image file a mirror copies.
+	maxMirroredFileSize = 512 << 20
+	// staleMirrorSync is how long a sync can be queued or running before
+	// another may be queued, in case a worker died with it.
+	staleMirrorSync = time.Hour
+)
+
+// ErrMirrorSyncPending is returned for queueing a sync of a mirror that has
+// one queued or running.
+var ErrMirrorSyncPending = errors.New("mirror sync already queued")
+
+type FederationSyncJob struct {
+	MirrorUid string
+}
+
+// NewFederationSyncWorker creates a worker that pulls changes to mirrored
+// collections from their peers. Images already copied are kept, so a sync
+// can be retried.
+func NewFederationSyncWorker(db *gorm.DB, wsBroker *libhttp.WSBroker) *jobs.Worker {
+	return jobs.NewWorker(JobTypeFederationSync, TopicFederationSync, "Collection Mirror Sync", 1, func(msg *message.Message) error {
+		var job FederationSyncJob
+		err := json.Unmarshal(msg.Payload, &job)
+		if err != nil {
+			return fmt.Errorf("%s: %w", JobTypeFederationSync, err)
+		}
+
+		var mirror entities.CollectionMirror
+		if err := db.Where("uid = ?", job.MirrorUid).First(&mirror).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				// Stopped before it synced
+				_ = jobs.UpdateWorkerJobStatus(db, msg.UUID, jobs.WorkerJobStatusCancelled, nil, nil, nil, nil)
+				return nil
+			}
+			return fmt.Errorf("%s: %w", JobTypeFederationSync, err)
+		}
+
+		if err := db.Where("uid = ?", mirror.CollectionUid).First(&entities.Collection{}).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				// Left over from a collection deleted before its mirror was
+				// deleted with it
+				_ = db.Delete(&mirror).Error
+				_ = jobs.UpdateWorkerJobStatus(db, msg.UUID, jobs.WorkerJobStatusCancelled, nil, nil, nil, nil)
+				return nil
+			}
+			return fmt.Errorf("%s: %w", JobTypeFederationSync, err)
+		}
+
+		if wsBroker != nil {
+			wsBroker.Broadcast("job-started", map[string]any{
+				"uid":            msg.UUID,
+				"jobId":          msg.UUID,
+				"type":           JobTypeFederationSync,
+				"topic":          JobTypeFederationSync,
+				"mirror_uid":     mirror.Uid,
+				"collection_uid": mirror.CollectionUid,
+			})
+		}
+
+		startedAt := time.Now().UTC()
+		_ = jobs.UpdateWorkerJobStatus(db, msg.UUID, jobs.WorkerJobStatusRunning, nil, nil, &startedAt, nil)
+		_ = db.Model(&mirror).Update("status", dto.CollectionMirrorStatusRunning).Error
+
+		onProgress := jobs.NewProgressCallback(wsBroker, msg.UUID, JobTypeFederationSync, "", mirror.RemoteUri)
+
+		err = syncMirror(msg.Context(), db, &mirror, onProgress)
+
+		if err != nil {
+			if wsBroker != nil {
+				wsBroker.Broadcast("job-failed", map[string]any{
+					"uid":        msg.UUID,
+					"jobId":      msg.UUID,
+					"type":       JobTypeFederationSync,
+					"topic":      JobTypeFederationSync,
+					"mirror_uid": mirror.Uid,
+					"error":      err.Error(),
+				})
+			}
+
+			_ = db.Model(&mirror).Updates(map[string]any{
+				"status": dto.CollectionMirrorStatusFailed,
+				"error":  jobs.Truncate(err.Error(), 1024),
+			}).Error
+			_ = jobs.UpdateWorkerJobStatus(db, msg.UUID, jobs.WorkerJobStatusFailed, utils.StringPtr("worker_error"), utils.StringPtr(jobs.Truncate(err.Error(), 1024)), nil, nil)
+			return err
+		}
+
+		if wsBroker != nil {
+			wsBroker.Broadcast("job-completed", map[string]any{
+				"uid":            msg.UUID,
+				"jobId":          msg.UUID,
+				"type":           JobTypeFederationSync,
+				"topic":          JobTypeFederationSync,
+				"mirror_uid":     mirror.Uid,
+				"collection_uid": mirror.CollectionUid,
+			})
+		}
+
+		completedAt := time.Now().UTC()
+		_ = jobs.UpdateWorkerJobStatus(db, msg.UUID, jobs.WorkerJobStatusSuccess, nil, nil, nil, &completedAt)
+
+		return nil
+	},
+	).SetIdempotent(true)
+}
+
+// EnqueueMirrorSync queues a sync of mirror, unless one is already queued
+// or running.
+func EnqueueMirrorSync(db *gorm.DB, mirror *entities.CollectionMirror, priority jobs.Priority) (string, error) {
+	pending := []dto.CollectionMirrorStatus{dto.CollectionMirrorStatusQueued, dto.CollectionMirrorStatusRunning}
+	result := db.Model(&entities.CollectionMirror{}).
+		Where("uid = ? AND (status NOT IN ? OR updated_at < ?)", mirror.Uid, pending, time.Now().Add(-staleMirrorSync)).
+		Update("status", dto.CollectionMirrorStatusQueued)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return "", ErrMirrorSyncPending
+	}
+
+	mirror.Status = dto.CollectionMirrorStatusQueued
+	return jobs.Enqueue(db, TopicFederationSync, priority, FederationSyncJob{MirrorUid: mirror.Uid}, nil, nil)
+}
+
+// StartMirrorSync queues a sync of every mirror that hasn't synced within
+// interval, checking every interval until ctx is done.
+func StartMirrorSync(ctx context.Context, logger *slog.Logger, db *gorm.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				var mirrors []entities.CollectionMirror
+				err := db.Where("last_synced_at IS NULL OR last_synced_at < ?", time.Now().Add(-interval)).Find(&mirrors).Error
+				if err != nil {
+					logger.Error("failed to find mirrors to sync", slog.Any("error", err))
+					continue
+				}
+
+				for i := range mirrors {
+					if _, err := EnqueueMirrorSync(db, &mirrors[i], jobs.PriorityBulk); err != nil && !errors.Is(err, ErrMirrorSyncPending) {
+						logger.Error("failed to queue mirror sync", slog.String("mirror_uid", mirrors[i].Uid), slog.Any("error", err))
+					}
+				}
+			}
+		}
+	}()
+}
+
+// syncMirror makes mirror's collection hold what the remote collection does,
+// in the same order. New and changed images are copied and processed like
+// uploads; copies of images no longer in it are removed. Images that fail to
+// copy are left out until the next sync, which then fails with why.
+func syncMirror(ctx context.Context, db *gorm.DB, mirror *entities.CollectionMirror, onProgress func(step string, progress int)) error {
+	instance, err := federation.Configured()
+	if err != nil {
+		return err
+	}
+
+	var peer entities.FederationPeer
+	if err := db.Where("uid = ?", mirror.PeerUid).First(&peer).Error; err != nil {
+		return fmt.Errorf("failed to load peer: %w", err)
+	}
+	if peer.Status != dto.FederationPeerStatusTrusted {
+		return fmt.Errorf("%s is no longer a trusted peer", peer.Url)
+	}
+
+	uri, err := federation.ParseURI(mirror.RemoteUri)
+	if err != nil {
+		return err
+	}
+
+	onProgress("Fetching collection", 0)
+
+	var remote dto.RemoteCollection
+	endpoint := peer.FederationEndpoint + "/collections/" + url.PathEscape(uri.ID)
+	if err := instance.Call(ctx, http.MethodGet, endpoint, nil, &remote); err != nil {
+		return fmt.Errorf("failed to fetch remote collection: %w", err)
+	}
+
+	var collection entities.Collection
+	if err := db.Where("uid = ?", mirror.CollectionUid).First(&collection).Error; err != nil {
+		return fmt.Errorf("failed to load mirrored collection: %w", err)
+	}
+
+	copied := lo.SliceToMap(mirror.Images, func(m dto.MirroredImage) (string, dto.MirroredImage) {
+		return m.RemoteUid, m
+	})
+	added := map[string]time.Time{}
+	if collection.Images != nil {
+		for _, img := range *collection.Images {
+			added[img.Uid] = img.AddedAt
+		}
+	}
+
+	var kept []dto.MirroredImage
+	var collectionImages []dto.CollectionImage
+	var failed error
+	total := len(remote.Images)
+
+	for i, remoteImg := range remote.Images {
+		mirrored, ok := copied[remoteImg.Uid]
+		if ok && mirrored.Checksum == remoteImg.Checksum {
+			delete(copied, remoteImg.Uid)
+		} else {
+			imageUid, err := copyRemoteImage(ctx, db, instance, &peer, mirror, remoteImg)
+			if err != nil {
+				if failed == nil {
+					failed = fmt.Errorf("failed to copy %s: %w", remoteImg.Uid, err)
+				}
+				if !ok {
+					continue
+				}
+
+				// Keep the old copy of a changed image until the new one
+				// can be made
+				delete(copied, remoteImg.Uid)
+			} else {
+				mirrored = dto.MirroredImage{RemoteUid: remoteImg.Uid, ImageUid: imageUid, Checksum: remoteImg.Checksum}
+			}
+		}
+
+		kept = append(kept, mirrored)
+		addedAt, ok := added[mirrored.ImageUid]
+		if !ok {
+			addedAt = time.Now()
+		}
+		collectionImages = append(collectionImages, dto.CollectionImage{Uid: mirrored.ImageUid, AddedAt: addedAt})
+
+		onProgress("Copying images", (i+1)*100/max(total, 1))
+	}
+
+	// Whatever's left has gone from the remote collection or changed
+	for _, gone := range copied {
+		if err := removeMirroredImage(db, gone.ImageUid); err != nil {
+			jobs.Logger.Error("failed to remove mirrored image", err, watermill.LogFields{
+				"mirror_uid": mirror.Uid,
+				"image_uid":  gone.ImageUid,
+			})
+		}
+	}
+
+	now := time.Now().UTC()
+	err = db.Transaction(func(tx *gorm.DB) error {
+		collection.Name = remote.Name
+		collection.Description = remote.Description
+		collection.Images = &collectionImages
+		collection.ImageCount = len(collectionImages)
+		if err := tx.Save(&collection).Error; err != nil {
+			return err
+		}
+
+		mirror.Images = kept
+		mirror.LastSyncedAt = &now
+		mirror.Status = dto.CollectionMirrorStatusSynced
+		mirror.Error = nil
+		return tx.Omit("CreatedBy").Save(mirror).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save mirror: %w", err)
+	}
+
+	return failed
+}
+
+// copyRemoteImage downloads one of the remote collection's images and adds
+// it as a private image of whoever set up the mirror, then queues its
+// processing.
+func copyRemoteImage(ctx context.Context, db *gorm.DB, instance *federation.Instance, peer *entities.FederationPeer, mirror *entities.CollectionMirror, remote dto.RemoteImage) (string, error) {
+	res, err := instance.Do(ctx, http.MethodGet, peer.FederationEndpoint+"/images/"+url.PathEscape(remote.Uid)+"/file", nil)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", &federation.StatusError{StatusCode: res.StatusCode}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxMirroredFileSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxMirroredFileSize {
+		return "", errors.New("file is too large")
+	}
+
+	checksum, err := images.CalculateImageChecksum(data)
+	if err != nil {
+		return "", err
+	}
+	if checksum != remote.Checksum {
+		return "", errors.New("file doesn't match its checksum")
+	}
+
+	libvipsImg, err := libvips.NewImageFromBuffer(data, libvips.DefaultLoadOptions())
+	if err != nil {
+		return "", fmt.Errorf("invalid image data: %w", err)
+	}
+	defer libvipsImg.Close()
+
+	imageEntity, err := imageops.NewImageEntity(slog.Default(), remote.FileName, libvipsImg)
+	if err != nil {
+		return "", err
+	}
+
+	fileSize := int64(len(data))
+	imageEntity.Name = remote.Name
+	imageEntity.Description = remote.Description
+	imageEntity.Private = true
+	imageEntity.OwnerID = mirror.CreatedByID
+	imageEntity.UploadedByID = mirror.CreatedByID
+	imageEntity.ImageMetadata.FileSize = &fileSize
+	imageEntity.ImageMetadata.Checksum = checksum
+
+	if err := db.Create(imageEntity).Error; err != nil {
+		return "", err
+	}
+
+	if err := images.SaveImage(data, imageEntity.Uid, imageEntity.ImageMetadata.FileName); err != nil {
+		_ = db.Unscoped().Delete(imageEntity).Error
+		return "", err
+	}
+
+	if _, err := jobs.Enqueue(db, TopicImageProcess, jobs.PriorityBulk, &ImageProcessJob{Image: *imageEntity}, nil, &imageEntity.Uid); err != nil {
+		return "", err
+	}
+
+	return imageEntity.Uid, nil
+}
+
+// removeMirroredImage deletes the copy of an image that's no longer in the
+// remote collection. It can be copied again if it comes back.
+func removeMirroredImage(db *gorm.DB, imageUid string) error {
+	if err := db.Unscoped().Where("uid = ?", imageUid).Delete(&entities.ImageAsset{}).Error; err != nil {
+		return err
+	}
+
+	return os.RemoveAll(filepath.Join(images.Directory, imageUid))
+}
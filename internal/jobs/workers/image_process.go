@@ -29,7 +29,8 @@ type ImageProcessJob struct {
 	Image entities.ImageAsset
 }
 
-// NewImageWorker creates a worker that processes images and sends WebSocket updates
+// NewImageWorker creates a worker that processes images and sends WebSocket updates.
+// Reprocessing only overwrites the same thumbnails and metadata, so it is idempotent.
 func NewImageWorker(db *gorm.DB, wsBroker *libhttp.WSBroker) *jobs.Worker {
 	return jobs.NewWorker(JobTypeImageProcess, TopicImageProcess, "Image Processing", 5, func(msg *message.Message) error {
 		var job ImageProcessJob
@@ -105,7 +106,7 @@ func NewImageWorker(db *gorm.DB, wsBroker *libhttp.WSBroker) *jobs.Worker {
 
 		return nil
 	},
-	)
+	).SetIdempotent(true)
 }
 
 func ImageProcess(ctx context.Context, db *gorm.DB, imgEnt entities.ImageAsset, onProgress func(step string, progress int)) error {
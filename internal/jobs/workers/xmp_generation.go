@@ -36,7 +36,8 @@ type XMPGenerationJob struct {
 	Image entities.ImageAsset
 }
 
-// NewXMPWorker creates a worker that generates XMP sidecar files
+// NewXMPWorker creates a worker that generates XMP sidecar files. The sidecar is
+// rewritten from the database each time, so it is idempotent.
 func NewXMPWorker(db *gorm.DB, wsBroker *libhttp.WSBroker) *jobs.Worker {
 	return jobs.NewWorker(JobTypeXMPGeneration, TopicXMPGeneration, "XMP Sidecar Generation", 2, func(msg *message.Message) error {
 		var job XMPGenerationJob
@@ -109,7 +110,7 @@ func NewXMPWorker(db *gorm.DB, wsBroker *libhttp.WSBroker) *jobs.Worker {
 
 		return nil
 	},
-	)
+	).SetIdempotent(true)
 }
 
 func generateXMPSidecar(img entities.ImageAsset, onProgress func(step string, progress int)) error {
@@ -0,0 +1,249 @@
+package mail
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"viz/internal/config"
+)
+
+func TestRender(t *testing.T) {
+	for _, name := range []string{TemplatePasswordReset, TemplateVerifyEmail, TemplateEmailChanged} {
+		t.Run(name, func(t *testing.T) {
+			msg, err := Render(name, "ada@example.com", TemplateData{
+				Name:      "Ada <script>",
+				Email:     "ada@example.com",
+				Link:      "https://photos.example.com/auth/reset-password?token=abc&x=1",
+				ExpiresIn: "1 hour",
+			})
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+
+			if msg.Subject == "" || strings.Contains(msg.Subject, "\n") {
+				t.Errorf("bad subject %q", msg.Subject)
+			}
+
+			if !strings.Contains(msg.Text, "Hi Ada <script>,") {
+				t.Errorf("text body missing greeting:\n%s", msg.Text)
+			}
+
+			if strings.Contains(msg.HTML, "<script>") || !strings.Contains(msg.HTML, "Ada &lt;script&gt;") {
+				t.Errorf("html body not escaped:\n%s", msg.HTML)
+			}
+		})
+	}
+
+	msg, _ := Render(TemplatePasswordReset, "ada@example.com", TemplateData{Link: "https://photos.example.com/r?token=abc&x=1"})
+	if !strings.Contains(msg.Text, "https://photos.example.com/r?token=abc&x=1") {
+		t.Errorf("text link was altered:\n%s", msg.Text)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	data, err := Build("Viz <noreply@photos.example.com>", Message{
+		To:      "ada@example.com",
+		Subject: "Réinitialiser",
+		Text:    "plain body",
+		HTML:    "<p>html body</p>",
+	}, time.Now())
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+
+	subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if subject != "Réinitialiser" {
+		t.Errorf("subject = %q", subject)
+	}
+
+	_, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("content type: %v", err)
+	}
+
+	parts := multipart.NewReader(parsed.Body, params["boundary"])
+	var types []string
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("NextPart: %v", err)
+		}
+		types = append(types, part.Header.Get("Content-Type"))
+	}
+
+	if len(types) != 2 || !strings.HasPrefix(types[0], "text/plain") || !strings.HasPrefix(types[1], "text/html") {
+		t.Errorf("parts = %v", types)
+	}
+
+	if _, err := Build("noreply@example.com", Message{To: "ada@example.com", Subject: "hi\r\nBcc: eve@example.com"}, time.Now()); err == nil {
+		t.Error("subject with a line break was accepted")
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	mailer, err := New(config.MailConfig{Driver: "file", From: "noreply@example.com", FileDir: dir}, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	if err := mailer.Send(context.Background(), Message{To: "ada@example.com", Subject: "Hello", Text: "body"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("got %d files, want 1", len(files))
+	}
+
+	data, _ := os.ReadFile(files[0])
+	if !bytes.Contains(data, []byte("To: ada@example.com")) {
+		t.Errorf("unexpected message:\n%s", data)
+	}
+}
+
+// fakeSMTP accepts one plaintext SMTP session and returns what it received.
+func fakeSMTP(t *testing.T) (int, <-chan string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		var transcript strings.Builder
+		reply("220 fake ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			transcript.WriteString(line)
+
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"):
+				reply("250 fake")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					transcript.WriteString(line)
+				}
+				reply("250 queued")
+			case cmd == "QUIT":
+				reply("221 bye")
+				received <- transcript.String()
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port, received
+}
+
+func TestSMTPMailer(t *testing.T) {
+	port, received := fakeSMTP(t)
+
+	mailer, err := New(config.MailConfig{
+		Driver: "smtp",
+		From:   "Viz <noreply@example.com>",
+		SMTP:   config.SMTPConfig{Host: "127.0.0.1", Port: port, TLS: "none"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	if err := mailer.Send(context.Background(), Message{To: "Ada <ada@example.com>", Subject: "Hello", Text: "body"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	transcript := <-received
+	for _, want := range []string{"MAIL FROM:<noreply@example.com>", "RCPT TO:<ada@example.com>", "Subject: Hello"} {
+		if !strings.Contains(transcript, want) {
+			t.Errorf("transcript missing %q:\n%s", want, transcript)
+		}
+	}
+}
+
+func TestNewRejectsBadConfig(t *testing.T) {
+	tests := []config.MailConfig{
+		{Driver: "pigeon", From: "noreply@example.com"},
+		{Driver: "log", From: "not an address"},
+		{Driver: "smtp", From: "noreply@example.com"},
+		{Driver: "smtp", From: "noreply@example.com", SMTP: config.SMTPConfig{Host: "smtp.example.com", TLS: "sometimes"}},
+	}
+
+	for i, cfg := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			if _, err := New(cfg, nil); err == nil {
+				t.Errorf("New(%+v) succeeded", cfg)
+			}
+		})
+	}
+}
+
+func TestLogMailerLeavesOutLinks(t *testing.T) {
+	msg, err := Render(TemplatePasswordReset, "ada@example.com", TemplateData{
+		Name:      "Ada",
+		Email:     "ada@example.com",
+		Link:      "https://photos.example.com/auth/reset-password?token=secret-token",
+		ExpiresIn: "1 hour",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var logs bytes.Buffer
+	mailer := NewLogMailer(slog.New(slog.NewTextHandler(&logs, nil)), "noreply@example.com")
+	if err := mailer.Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(logs.String(), "secret-token") {
+		t.Errorf("log has the reset link:\n%s", logs.String())
+	}
+	if !strings.Contains(logs.String(), "ada@example.com") {
+		t.Errorf("log doesn't say who the message was for:\n%s", logs.String())
+	}
+}
@@ -0,0 +1,120 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"viz/internal/config"
+)
+
+const smtpTimeout = 30 * time.Second
+
+// SMTPMailer sends messages through an SMTP relay.
+type SMTPMailer struct {
+	cfg  config.SMTPConfig
+	from string
+	// sender is the bare address from From, used for MAIL FROM.
+	sender string
+}
+
+func NewSMTPMailer(cfg config.SMTPConfig, from string) (*SMTPMailer, error) {
+	if cfg.Host == "" {
+		return nil, errors.New("mail.smtp.host is required for the smtp driver")
+	}
+
+	switch cfg.TLS {
+	case "starttls", "tls", "none":
+	default:
+		return nil, fmt.Errorf("mail.smtp.tls must be starttls, tls or none, got %q", cfg.TLS)
+	}
+
+	addr, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SMTPMailer{cfg: cfg, from: from, sender: addr.Address}, nil
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	data, err := Build(m.from, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	recipient, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+
+	address := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	tlsConfig := &tls.Config{ServerName: m.cfg.Host}
+
+	var conn net.Conn
+	if m.cfg.TLS == "tls" {
+		conn, err = (&tls.Dialer{Config: tlsConfig}).DialContext(ctx, "tcp", address)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return fmt.Errorf("connecting to smtp server: %w", err)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if m.cfg.TLS == "starttls" {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("smtp starttls: %w", err)
+		}
+	}
+
+	if m.cfg.Username != "" {
+		// PlainAuth refuses to send credentials over an unencrypted
+		// connection to anything but localhost.
+		if err := client.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+
+	if err := client.Mail(m.sender); err != nil {
+		return err
+	}
+
+	if err := client.Rcpt(recipient.Address); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
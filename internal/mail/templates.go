@@ -0,0 +1,66 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Templates, one per file in templates/. Each file defines "subject",
+// "text" and "html".
+const (
+	TemplatePasswordReset = "password_reset"
+	TemplateVerifyEmail   = "verify_email"
+	TemplateEmailChanged  = "email_changed"
+)
+
+//go:embed templates/*.tmpl
+var templateFiles embed.FS
+
+// TemplateData is what the templates can refer to.
+type TemplateData struct {
+	// Name is how to greet the recipient.
+	Name string
+	// Email is the address the message is about, which isn't always the
+	// one it is sent to.
+	Email string
+	Link  string
+	// ExpiresIn says how long Link is good for, e.g. "1 hour".
+	ExpiresIn string
+}
+
+// Render fills in the named template for to.
+func Render(name, to string, data TemplateData) (Message, error) {
+	file := "templates/" + name + ".tmpl"
+
+	text, err := texttemplate.ParseFS(templateFiles, file)
+	if err != nil {
+		return Message{}, fmt.Errorf("parsing email template %s: %w", name, err)
+	}
+
+	html, err := htmltemplate.ParseFS(templateFiles, "templates/layout.html.tmpl", file)
+	if err != nil {
+		return Message{}, fmt.Errorf("parsing email template %s: %w", name, err)
+	}
+
+	var subject, textBody, htmlBody bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := text.ExecuteTemplate(&textBody, "text", data); err != nil {
+		return Message{}, err
+	}
+	if err := html.ExecuteTemplate(&htmlBody, "layout", data); err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(textBody.String()) + "\n",
+		HTML:    htmlBody.String(),
+	}, nil
+}
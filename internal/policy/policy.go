@@ -0,0 +1,249 @@
+// Package policy decides what a user may do with an image or collection,
+// from who owns it, the groups they're in and who it has been shared with.
+package policy
+
+import (
+	"gorm.io/gorm"
+
+	"viz/internal/dto"
+	"viz/internal/entities"
+)
+
+// Role is how much a user may do with an image or collection. Each role can
+// do everything the ones before it can.
+type Role int
+
+const (
+	None Role = iota
+	// Public sees something because it is public. In a public collection
+	// they only see the images they could see anyway.
+	Public
+	Viewer
+	// Contributor adds images to a collection and removes the ones they added.
+	Contributor
+	Editor
+	Owner
+)
+
+func (r Role) String() string {
+	switch r {
+	case Public:
+		return "public"
+	case Viewer:
+		return "viewer"
+	case Contributor:
+		return "contributor"
+	case Editor:
+		return "editor"
+	case Owner:
+		return "owner"
+	default:
+		return "none"
+	}
+}
+
+var shareRoles = map[dto.CollectionShareRole]Role{
+	dto.CollectionShareRoleViewer:      Viewer,
+	dto.CollectionShareRoleContributor: Contributor,
+	dto.CollectionShareRoleEditor:      Editor,
+}
+
+// Group members have these roles on what their group owns.
+var groupRoles = map[dto.GroupMemberRole]Role{
+	dto.GroupMemberRoleViewer: Viewer,
+	dto.GroupMemberRoleMember: Editor,
+	dto.GroupMemberRoleOwner:  Owner,
+}
+
+// ShareRole is the role a collection share grants, and false for a role
+// that doesn't exist.
+func ShareRole(role dto.CollectionShareRole) (Role, bool) {
+	r, ok := shareRoles[role]
+	return r, ok
+}
+
+// GroupRole is the role a group member has on what the group owns, and
+// false for a role that doesn't exist.
+func GroupRole(role dto.GroupMemberRole) (Role, bool) {
+	r, ok := groupRoles[role]
+	return r, ok
+}
+
+// newQuery starts a query that doesn't inherit the conditions on db, for
+// use as a subquery.
+func newQuery(db *gorm.DB) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true})
+}
+
+// groupUIDs selects the UIDs of the groups userUid is in.
+func groupUIDs(db *gorm.DB, userUid string) *gorm.DB {
+	return newQuery(db).Model(&entities.GroupMember{}).Select("group_uid").Where("user_id = ?", userUid)
+}
+
+// sharedCollectionUIDs selects the UIDs of the collections shared with
+// userUid or with a group they're in.
+func sharedCollectionUIDs(db *gorm.DB, userUid string) *gorm.DB {
+	return newQuery(db).Model(&entities.CollectionShare{}).
+		Select("collection_uid").
+		Where("user_id = ? OR group_id IN (?)", userUid, groupUIDs(db, userUid))
+}
+
+// GroupRoles returns the role userUid has on what each of their groups owns.
+func GroupRoles(db *gorm.DB, userUid string) (map[string]Role, error) {
+	var members []entities.GroupMember
+	if err := db.Where("user_id = ?", userUid).Find(&members).Error; err != nil {
+		return nil, err
+	}
+
+	roles := make(map[string]Role, len(members))
+	for _, member := range members {
+		roles[member.GroupUid] = groupRoles[member.Role]
+	}
+
+	return roles, nil
+}
+
+// CollectionRole works out user's role on collection. user is nil for
+// anonymous requests.
+func CollectionRole(db *gorm.DB, collection *entities.Collection, user *entities.User) (Role, error) {
+	role := None
+	if collection.Private == nil || !*collection.Private {
+		role = Public
+	}
+
+	if user == nil {
+		return role, nil
+	}
+
+	// Collections from before ownership was recorded belong to everyone.
+	if collection.OwnerID == nil || *collection.OwnerID == user.Uid {
+		return Owner, nil
+	}
+
+	if collection.OwnerGroupID != nil {
+		groups, err := GroupRoles(db, user.Uid)
+		if err != nil {
+			return None, err
+		}
+		role = max(role, groups[*collection.OwnerGroupID])
+	}
+
+	var shares []entities.CollectionShare
+	err := db.Where("collection_uid = ?", collection.Uid).
+		Where("user_id = ? OR group_id IN (?)", user.Uid, groupUIDs(db, user.Uid)).
+		Find(&shares).Error
+	if err != nil {
+		return None, err
+	}
+
+	for _, share := range shares {
+		role = max(role, shareRoles[share.Role])
+	}
+
+	return role, nil
+}
+
+// ImageRole works out user's role on img. Someone who can see a private
+// image only because it is in a collection they can see is a Viewer.
+func ImageRole(db *gorm.DB, img *entities.ImageAsset, user *entities.User) (Role, error) {
+	role := None
+	if !img.Private {
+		role = Public
+	}
+
+	if user == nil {
+		return role, nil
+	}
+
+	// Images from before ownership was recorded belong to everyone.
+	if img.OwnerID == nil || *img.OwnerID == user.Uid {
+		return Owner, nil
+	}
+
+	if img.OwnerGroupID != nil {
+		groups, err := GroupRoles(db, user.Uid)
+		if err != nil {
+			return None, err
+		}
+		role = max(role, groups[*img.OwnerGroupID])
+	}
+
+	if role < Viewer {
+		var count int64
+		err := db.Model(&entities.ImageAsset{}).
+			Where("images.uid = ? AND EXISTS (?)", img.Uid, visibleCollectionsContaining(db, user.Uid)).
+			Count(&count).Error
+		if err != nil {
+			return None, err
+		}
+
+		if count > 0 {
+			role = Viewer
+		}
+	}
+
+	return role, nil
+}
+
+// CanSeeImage reports whether user may see img.
+func CanSeeImage(db *gorm.DB, img *entities.ImageAsset, user *entities.User) (bool, error) {
+	role, err := ImageRole(db, img, user)
+	return role > None, err
+}
+
+// VisibleCollections limits a query on collections to those user can see:
+// public ones, their own, their groups' and the ones shared with them.
+func VisibleCollections(user *entities.User) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if user == nil {
+			return db.Where("collections.private = ?", false)
+		}
+
+		return db.Where(
+			"collections.private = ? OR collections.owner_id = ? OR collections.owner_group_id IN (?) OR collections.uid IN (?)",
+			false, user.Uid, groupUIDs(db, user.Uid), sharedCollectionUIDs(db, user.Uid),
+		)
+	}
+}
+
+// containsImage matches the collections holding the image in the enclosing
+// query.
+const containsImage = "collections.images @> jsonb_build_array(jsonb_build_object('uid', images.uid))"
+
+// visibleCollectionsContaining selects the collections holding the image
+// in the enclosing query that are shared with userUid or owned by one of
+// their groups.
+func visibleCollectionsContaining(db *gorm.DB, userUid string) *gorm.DB {
+	return newQuery(db).Model(&entities.Collection{}).
+		Select("1").
+		Where("collections.uid IN (?) OR collections.owner_group_id IN (?)",
+			sharedCollectionUIDs(db, userUid), groupUIDs(db, userUid)).
+		Where(containsImage)
+}
+
+// VisibleImages limits a query on images to those user can see: public
+// ones, their own, their groups', and private ones in a collection shared
+// with them or their groups.
+func VisibleImages(user *entities.User) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if user == nil {
+			return db.Where("images.private = ?", false)
+		}
+
+		return db.Where(
+			"images.private = ? OR images.owner_id = ? OR images.owner_group_id IN (?) OR EXISTS (?)",
+			false, user.Uid, groupUIDs(db, user.Uid), visibleCollectionsContaining(db, user.Uid),
+		)
+	}
+}
+
+// WithinCollections limits a query on images to those in one of the
+// collections collectionUIDs, as for an API key limited to them.
+func WithinCollections(collectionUIDs []string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("EXISTS (?)", newQuery(db).Model(&entities.Collection{}).
+			Select("1").
+			Where("collections.uid IN ?", collectionUIDs).
+			Where(containsImage))
+	}
+}
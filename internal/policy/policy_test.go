@@ -0,0 +1,137 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"viz/internal/dto"
+	"viz/internal/entities"
+)
+
+func TestRoleOrder(t *testing.T) {
+	viewer, _ := ShareRole(dto.CollectionShareRoleViewer)
+	contributor, _ := ShareRole(dto.CollectionShareRoleContributor)
+	editor, _ := ShareRole(dto.CollectionShareRoleEditor)
+	if !(Public < viewer && viewer < contributor && contributor < editor && editor < Owner) {
+		t.Errorf("share roles out of order: %s, %s, %s", viewer, contributor, editor)
+	}
+
+	if _, ok := ShareRole("owner"); ok {
+		t.Error("a share can't make someone the owner")
+	}
+
+	// Group members co-own what the group owns
+	if role, _ := GroupRole(dto.GroupMemberRoleOwner); role != Owner {
+		t.Errorf("group owner role = %s, want owner", role)
+	}
+	if role, _ := GroupRole(dto.GroupMemberRoleMember); role != Editor {
+		t.Errorf("group member role = %s, want editor", role)
+	}
+	if _, ok := GroupRole("admin"); ok {
+		t.Error("unknown group role accepted")
+	}
+}
+
+func dryRunDB() *gorm.DB {
+	return &gorm.DB{
+		Statement: &gorm.Statement{
+			Clauses: make(map[string]clause.Clause),
+			Vars:    make([]interface{}, 0),
+		},
+		Config: &gorm.Config{DryRun: true},
+	}
+}
+
+// whereSQL returns the conditions a scope adds to a query.
+func whereSQL(db *gorm.DB) string {
+	c, ok := db.Statement.Clauses["WHERE"]
+	if !ok {
+		return ""
+	}
+
+	var sql []string
+	for _, expr := range c.Expression.(clause.Where).Exprs {
+		if e, ok := expr.(clause.Expr); ok {
+			sql = append(sql, e.SQL)
+		}
+	}
+	return strings.Join(sql, " AND ")
+}
+
+func TestVisibleScopes(t *testing.T) {
+	user := &entities.User{Uid: "u1"}
+
+	tests := []struct {
+		name    string
+		scope   func(*gorm.DB) *gorm.DB
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "anonymous images",
+			scope:   VisibleImages(nil),
+			want:    []string{"images.private = ?"},
+			notWant: []string{"owner_id"},
+		},
+		{
+			name:  "user images",
+			scope: VisibleImages(user),
+			want:  []string{"images.owner_id = ?", "images.owner_group_id IN (?)", "EXISTS (?)"},
+		},
+		{
+			name:    "anonymous collections",
+			scope:   VisibleCollections(nil),
+			want:    []string{"collections.private = ?"},
+			notWant: []string{"owner_id"},
+		},
+		{
+			name:  "images within collections",
+			scope: WithinCollections([]string{"c1"}),
+			want:  []string{"EXISTS (?)"},
+		},
+		{
+			name:  "user collections",
+			scope: VisibleCollections(user),
+			want:  []string{"collections.owner_id = ?", "collections.owner_group_id IN (?)", "collections.uid IN (?)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql := whereSQL(tt.scope(dryRunDB()))
+			for _, want := range tt.want {
+				if !strings.Contains(sql, want) {
+					t.Errorf("where %q doesn't contain %q", sql, want)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(sql, notWant) {
+					t.Errorf("where %q contains %q", sql, notWant)
+				}
+			}
+		})
+	}
+}
+
+func TestRoleWithoutUser(t *testing.T) {
+	private := true
+	public := false
+
+	if role, _ := CollectionRole(nil, &entities.Collection{Private: &private}, nil); role != None {
+		t.Errorf("anonymous role on private collection = %s", role)
+	}
+	if role, _ := CollectionRole(nil, &entities.Collection{Private: &public}, nil); role != Public {
+		t.Errorf("anonymous role on public collection = %s", role)
+	}
+	if role, _ := ImageRole(nil, &entities.ImageAsset{Private: true}, nil); role != None {
+		t.Errorf("anonymous role on private image = %s", role)
+	}
+
+	owner := &entities.User{Uid: "u1"}
+	if role, _ := ImageRole(nil, &entities.ImageAsset{Private: true, OwnerID: &owner.Uid}, owner); role != Owner {
+		t.Errorf("owner's role on own image = %s", role)
+	}
+}
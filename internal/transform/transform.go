@@ -17,6 +17,15 @@ type TransformParams struct {
 	Rotate   int
 	Flip     string
 	Kernel   string
+	// LongEdge shrinks the image so its longer side is at most this many
+	// pixels. Images are never enlarged to fit it.
+	LongEdge int64
+	// ColorProfile is the profile the result is converted to: "" for sRGB,
+	// "p3" for Display P3 or "original" to keep the image's own.
+	ColorProfile string
+	// KeepMetadata keeps EXIF, XMP and IPTC metadata, which transforms
+	// strip by default.
+	KeepMetadata bool
 }
 
 // ToQueryString serializes the transform parameters into a URL query string.
@@ -43,6 +52,15 @@ func (p *TransformParams) ToQueryString() string {
 	if p.Kernel != "" {
 		q.Set("kernel", p.Kernel)
 	}
+	if p.LongEdge > 0 {
+		q.Set("long", strconv.FormatInt(p.LongEdge, 10))
+	}
+	if p.ColorProfile != "" {
+		q.Set("profile", p.ColorProfile)
+	}
+	if p.KeepMetadata {
+		q.Set("metadata", "keep")
+	}
 	return q.Encode()
 }
 
@@ -52,5 +70,12 @@ func CreateTransformEtag(imgEnt entities.ImageAsset, params *TransformParams) *s
 	if imgEnt.ImageMetadata != nil {
 		checksum = imgEnt.ImageMetadata.Checksum
 	}
-	return utils.StringPtr(fmt.Sprintf("%s-%dx%d-%s-%d-%d-%s-%s", checksum, params.Width, params.Height, params.Format, params.Quality, params.Rotate, params.Flip, params.Kernel))
+	etag := fmt.Sprintf("%s-%dx%d-%s-%d-%d-%s-%s", checksum, params.Width, params.Height, params.Format, params.Quality, params.Rotate, params.Flip, params.Kernel)
+
+	// Only added when set, so existing cached transforms keep their keys
+	if params.LongEdge > 0 || params.ColorProfile != "" || params.KeepMetadata {
+		etag += fmt.Sprintf("-%d-%s-%t", params.LongEdge, params.ColorProfile, params.KeepMetadata)
+	}
+
+	return utils.StringPtr(etag)
 }